@@ -0,0 +1,98 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"strings"
+
+	"blueprint/config"
+	"blueprint/pkg/crash"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/errors"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// NewAdminServer is the gRPC server for the AdminService, kept apart from
+// the public server so ops calls never share its port, interceptors or
+// response cache. Every call needs cfg.Admin.Token.
+func NewAdminServer(cfg *config.Config, crashReporter *crash.Reporter) *grpc.Server {
+	recoveryOpts := []recovery.Option{
+		recovery.WithRecoveryHandlerContext(crashReporter.RecoveryHandler),
+	}
+
+	return grpc.NewServer(append(serverOptions(cfg),
+		grpc.ChainUnaryInterceptor(
+			recovery.UnaryServerInterceptor(recoveryOpts...),
+			errors.UnaryServerInterceptor(cfg.Debug.VerboseErrors),
+			ctxmeta.UnaryServerInterceptor(adminPeers(cfg.Admin.Token)),
+			tokenAuthUnary(cfg.Admin.Token),
+		),
+		grpc.ChainStreamInterceptor(
+			recovery.StreamServerInterceptor(recoveryOpts...),
+			errors.StreamServerInterceptor(cfg.Debug.VerboseErrors),
+			ctxmeta.StreamServerInterceptor(adminPeers(cfg.Admin.Token)),
+			tokenAuthStream(cfg.Admin.Token),
+		),
+	)...)
+}
+
+func tokenAuthUnary(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkToken(ctx, token); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func tokenAuthStream(token string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkToken(ss.Context(), token); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// adminPeers vouches for callers holding the admin token, the user they
+// name is who e.g. changed a setting
+type adminPeers string
+
+func (t adminPeers) Trusted(ctx context.Context) bool {
+	return checkToken(ctx, string(t)) == nil
+}
+
+// ClientIP is the transport peer, nothing proxies the admin port
+func (t adminPeers) ClientIP(ctx context.Context) net.IP {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// checkToken wants "authorization: Bearer <token>", an empty token locks
+// everyone out rather than letting everyone in
+func checkToken(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		scheme, got, ok := strings.Cut(v, " ")
+		if ok && strings.EqualFold(scheme, "bearer") && token != "" &&
+			subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid admin token")
+}
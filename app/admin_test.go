@@ -0,0 +1,30 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestCheckToken(t *testing.T) {
+	withAuth := func(v string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", v))
+	}
+
+	assert.NoError(t, checkToken(withAuth("Bearer s3cret"), "s3cret"))
+	assert.NoError(t, checkToken(withAuth("bearer s3cret"), "s3cret"), "the scheme is case insensitive")
+
+	for name, ctx := range map[string]context.Context{
+		"missing":      context.Background(),
+		"wrong token":  withAuth("Bearer nope"),
+		"wrong scheme": withAuth("Basic s3cret"),
+		"bare token":   withAuth("s3cret"),
+	} {
+		assert.Equal(t, codes.Unauthenticated, status.Code(checkToken(ctx, "s3cret")), name)
+	}
+	assert.Error(t, checkToken(withAuth("Bearer "), ""), "an empty token admits no one")
+}
@@ -3,40 +3,66 @@ package app
 
 import (
 	"blueprint/config"
+	other "blueprint/model/other"
 	"blueprint/handler"
+	"blueprint/pkg/account"
+	"blueprint/pkg/buildinfo"
 	"blueprint/pkg/cache"
+	"blueprint/pkg/compress"
 	"blueprint/pkg/logger"
 	"blueprint/pkg/redis"
+	"blueprint/pkg/retention"
+	"blueprint/pkg/partition"
 	"blueprint/pkg/db"
+	"blueprint/pkg/dispatch"
 	"blueprint/pkg/i18n"
+	"blueprint/pkg/discovery"
+	"blueprint/pkg/eventbus"
+	"blueprint/pkg/fault"
+	"blueprint/pkg/gctune"
+	"blueprint/pkg/health"
+	"blueprint/pkg/hedge"
+	"blueprint/pkg/httpmw"
+	"blueprint/pkg/inflight"
+	"blueprint/pkg/lifecycle"
+	"blueprint/pkg/maintenance"
+	"blueprint/pkg/netacl"
+	"blueprint/pkg/notify"
+	"blueprint/pkg/quota"
+	"blueprint/pkg/reporting"
+	"blueprint/pkg/run"
+	"blueprint/pkg/server"
+	"blueprint/pkg/settings"
+	"blueprint/pkg/startup"
+	"blueprint/pkg/warmup"
 	
 	"context"
 	"fmt"	
-	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
-	"time"
 
+	adminpb "blueprint/proto/admin"
 	pb "blueprint/proto/blueprint"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/keepalive"
-	"google.golang.org/grpc/reflection"
-	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
+	"google.golang.org/grpc/credentials/insecure"
 	"github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	goredis "github.com/redis/go-redis/v9"
 )
 
-var (
-	service = "platform-blueprint"
-	version = "v2.0.0"
-)
+// the version is stamped at build time, see buildinfo
+var service = "platform-blueprint"
 
 func Start() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	cfg := config.NewConfig()		
+	build := buildinfo.Get()
+	version := build.Version
 	
 	fmt.Printf("Starting %s %s\n", service, version)
 	
@@ -44,95 +70,488 @@ func Start() {
 	if err != nil {
 		panic(fmt.Errorf("failed to initialize logger: %w", err))
 	}
-	defer log.Flush()
+	defer log.Close()
+
+	// before the caches and pools fill the heap
+	gc := gctune.Apply(gctune.Options{
+		GCPercent:        cfg.Runtime.GCPercent,
+		MemoryLimit:      int64(cfg.Runtime.MemoryLimit),
+		MemoryLimitRatio: cfg.Runtime.MemoryLimitRatio,
+		Ballast:          int64(cfg.Runtime.Ballast),
+		Log:              log.Module("runtime"),
+	})
+	log.WithFields(gc.Fields()).Info("Garbage collector configured")
+
+	var tracker *reporting.Reporter
+	if cfg.ErrorTracking.SentryDSN != "" || cfg.ErrorTracking.WebhookURL != "" {
+		tracker, err = reporting.NewReporter(cfg, version)
+		if err != nil {
+			log.Errorf("failed to init error tracking: %v", err)
+		} else {
+			log.AddErrorSink(tracker)
+			defer tracker.Close()
+		}
+	}
+
+	if meta := lifecycle.MetadataFromConfig(cfg); meta.InKubernetes() {
+		log = log.WithFields(meta.Fields())
+	}
+	lc := lifecycle.NewLifecycle(cfg, log)
 
-	local, err := i18n.New(cfg, "en-US", "el-GR", "zh-CN")
+	if err := lc.Start(); err != nil {
+		log.Fatalf("failed to start probe server: %v", err)
+	}
+	log.Infof("Probe server listening on :%s", cfg.Kube.ProbePort)
+
+	local, err := i18n.New(cfg, "en-US", "el-GR", "zh-CN", "ar-SA")
 	if err != nil {
 		log.Errorf("failed to init i18n package: %v", err)
 	}
+
+	// alerts people about failing readiness checks, off without channels
+	var translator i18n.Translator
+	if local != nil {
+		translator = local
+	}
+	notifier := notify.NewNotifier(cfg, log.Module("notify"), translator, service)
+	if notifier != nil {
+		defer notifier.Close()
+	}
+	// every check result moves its dependency between healthy, degraded
+	// and down, changes are logged, exported and notified
+	lc.SetCheckObserver(health.NewTracker(health.FromConfig(cfg, log.Module("health"), notifier)).Observe)
 	
-	log.Infof("Starting service: %s@%s", service, version)
+	log.WithFields(build.Fields()).Infof("Starting service: %s@%s", service, version)
+	logBanner(log, cfg, build)
 	
-	lis, err := net.Listen("tcp", ":" + cfg.GRPC.Port)
+	// every interceptor of the gRPC chain, their stores are plugged in
+	// once redis is up
+	serverDeps, err := BuildServerDeps(cfg, log, nil, translator)
 	if err != nil {
-		log.Fatalf("failed to listen on port %s: %v", cfg.GRPC.Port, err)
+		log.Fatalf("%v", err)
+	}
+	if tracker != nil {
+		serverDeps.Crash.AddSink(tracker)
 	}
+	serverDeps.Start()
+	defer serverDeps.Stop()
+
+	// the pod reports degraded while maintenance mode is on
+	mode := serverDeps.Maintenance
+	lc.AddReadinessCheck("maintenance", mode.Readiness)
 
-	kaep := keepalive.EnforcementPolicy{
-		MinTime:             5 * time.Second,
-		PermitWithoutStream: true,
+	// nil unless FAULT_INJECTION is on, never in production
+	faults, err := fault.New(cfg, log.Module("fault"))
+	if err != nil {
+		log.Fatalf("Invalid fault rules: %v", err)
 	}
 
-	kasp := keepalive.ServerParameters{
-		MaxConnectionIdle:     15 * time.Second,
-		MaxConnectionAge:      30 * time.Second,
-		MaxConnectionAgeGrace: 5 * time.Second,
-		Time:                  5 * time.Second,
-		Timeout:               1 * time.Second,
+	s := NewGRPCServer(cfg, log, serverDeps)
+
+	// gRPC plus the optional HTTP listeners, all bound now so a taken port
+	// fails before we connect to anything
+	servers := server.NewManager(log.Module("server"), lc.ShutdownTimeout())
+	grpcAddrs := cfg.GRPC.ListenAddrs
+	if len(grpcAddrs) == 0 {
+		grpcAddrs = []string{":" + cfg.GRPC.Port}
+	}
+	for i, addr := range grpcAddrs {
+		name := "grpc"
+		if i > 0 {
+			name = fmt.Sprintf("grpc-%d", i)
+		}
+		servers.Add(name, addr, server.GRPC(s))
 	}
 
-	// Recovery options for panic handling
-	recoveryOpts := []recovery.Option{
-		recovery.WithRecoveryHandler(func(p interface{}) error {
-			log.Errorf("panic recovered: %v", p)
-			return fmt.Errorf("internal server error")
-		}),
+	if cfg.GRPC.UnixSocket != "" {
+		servers.AddUnix("grpc-unix", cfg.GRPC.UnixSocket, cfg.GRPC.UnixSocketMode, server.GRPC(s))
 	}
 
-	s := grpc.NewServer(
-		grpc.KeepaliveEnforcementPolicy(kaep),
-		grpc.KeepaliveParams(kasp),
-		grpc.ChainUnaryInterceptor(
-			recovery.UnaryServerInterceptor(recoveryOpts...),
-			grpc_prometheus.UnaryServerInterceptor,
-		),
-		grpc.ChainStreamInterceptor(
-			recovery.StreamServerInterceptor(recoveryOpts...),
-			grpc_prometheus.StreamServerInterceptor,
-		),
-	)
+	if cfg.HTTP.GatewayPort != "" {
+		dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+		if faults != nil {
+			dialOpts = append(dialOpts,
+				grpc.WithChainUnaryInterceptor(faults.UnaryClientInterceptor()),
+				grpc.WithChainStreamInterceptor(faults.StreamClientInterceptor()))
+		}
+		conn, err := grpc.NewClient(loopbackTarget(cfg, grpcAddrs[0]), dialOpts...)
+		if err != nil {
+			log.Fatalf("failed to create gateway client: %v", err)
+		}
+		defer conn.Close()
+		gateway := handler.NewGateway(conn)
+		gateway.Docs = cfg.Debug.APIDocs
+		// already checked by the network ACL
+		trusted, _ := netacl.ParseCIDRs(cfg.NetACL.TrustedProxies)
+		servers.Add("gateway", ":"+cfg.HTTP.GatewayPort, server.NewHTTP(httpmw.Chain(gateway,
+			httpmw.RequestID(trusted),
+			httpmw.AccessLog(log.Module("gateway")),
+			httpmw.Metrics(gateway.Route),
+			httpmw.Gzip(),
+			httpmw.Recovery(serverDeps.Crash),
+		)))
+	}
+
+	// services are registered below, once the handlers exist
+	var adminServer *grpc.Server
+	if cfg.Admin.Port != "" {
+		adminServer = NewAdminServer(cfg, serverDeps.Crash)
+		servers.Add("admin", ":"+cfg.Admin.Port, server.GRPC(adminServer))
+	}
 
-	reflection.Register(s)
+	if cfg.HTTP.MetricsPort != "" {
+		servers.Add("metrics", ":"+cfg.HTTP.MetricsPort, server.NewHTTP(lc.Handler()))
+	}
+
+	if cfg.HTTP.DebugPort != "" {
+		if cfg.Debug.Endpoints {
+			servers.Add("debug", ":"+cfg.HTTP.DebugPort, server.NewHTTP(server.DebugHandler()))
+		} else {
+			log.Warnf("DEBUG_PORT %s ignored, debug endpoints are disabled in %s", cfg.HTTP.DebugPort, cfg.Setting.Environment)
+		}
+	}
 
-	log.Infof("gRPC server listening on %v", lis.Addr())
+	if err := servers.Listen(); err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
 	
-	redisClient, err := redis.NewRedisClient(cfg)
+	scopes, err := cache.ParseScopes(cfg.Cache.KeyScope)
+	if err != nil {
+		log.Fatalf("Invalid cache key scope: %v", err)
+	}
+	compression, err := compress.FromConfig(cfg)
 	if err != nil {
-		log.Fatalf("Error connecting to Redis at %v: %v", cfg.Redis.RedisAddr, err)
+		log.Fatalf("Invalid compression: %v", err)
 	}
-	defer redisClient.Close()
+	cacheCodec, err := compress.New(compression.Cache, compression.CacheLevel)
+	if err != nil {
+		log.Fatalf("Invalid cache compression: %v", err)
+	}
+
+	var (
+		redisClient  *redis.RedisClient
+		sentinel     *redis.SentinelMonitor
+		cacheClient  *cache.Cache
+		quotaTracker *quota.Tracker
+		dbSess       *db.PostgresDB
+		invalidator  *db.CacheInvalidator
+		partitionJob *partition.Job
+		retentionJob *retention.Job
+		bus          eventbus.Bus
+	)
 
-	log.Infof("Connected to Redis at %s", cfg.Redis.RedisAddr)
+	// redis and postgres connect in parallel, everything else waits for
+	// what it needs; with STARTUP_DEGRADED the cache side may be missing
+	deps := startup.NewGraph(log.Module("startup"))
+	deps.Add(startup.Step{Name: "redis", Optional: cfg.Startup.Degraded, Run: func(ctx context.Context) error {
+		opts := redis.OptionsFromConfig(cfg)
+		opts.Logger = log.Module("redis")
+		if faults != nil {
+			opts.Hooks = append(opts.Hooks, faults.RedisHook())
+		}
+		client, err := redis.NewRedisClientWithOptions(cfg, opts)
+		if err != nil {
+			return fmt.Errorf("connecting to %v: %w", cfg.Redis.RedisAddr, err)
+		}
+		redisClient = client
+		if client.Degraded() {
+			log.Warnf("Redis at %s is unreachable, serving without cache until it answers", cfg.Redis.RedisAddr)
+		} else {
+			log.Infof("Connected to Redis at %s", cfg.Redis.RedisAddr)
+		}
+
+		if cfg.Maintenance.Key != "" {
+			mode.SetStore(maintenance.NewRedisStore(client.GetClient(), cfg.Maintenance.Key))
+		}
+		if serverDeps.Concurrency != nil && cfg.Concurrency.Store == "redis" {
+			serverDeps.Concurrency.SetSemaphore(inflight.NewRedis(client.GetClient(), cfg.Concurrency.LeaseTTL))
+		}
 
-	cacheClient := cache.NewCache(redisClient.GetClient())
-	if cacheClient == nil {
-		panic("Could not initialize cache client")
+		if sentinel = redis.NewSentinelMonitor(cfg, client.GetClient(), log.Module("redis")); sentinel != nil {
+			sentinel.Start(context.Background())
+		}
+		// an optional cache being down must not take us out of rotation,
+		// it only degrades us
+		if !cfg.Cache.Optional {
+			lc.AddReadinessCheck("redis", client.Readiness)
+			if sentinel != nil {
+				lc.AddReadinessCheck("redis-sentinel", sentinel.HealthCheck)
+			}
+		} else {
+			lc.AddReadinessCheck("redis", func(ctx context.Context) error {
+				return health.Degrade(client.Readiness(ctx))
+			})
+		}
+		return nil
+	}})
+	deps.Add(startup.Step{Name: "cache", After: []string{"redis"}, Optional: cfg.Startup.Degraded, Run: func(ctx context.Context) error {
+		opts := cache.Options{
+			Scope:       scopes,
+			Expiration:  cfg.Cache.TTL,
+			StaleWindow: cfg.Cache.StaleWindow,
+
+			Compression:      cacheCodec,
+			CompressMinBytes: compression.CacheMinBytes,
+		}
+		if cfg.Cache.Optional {
+			opts.Available = func() bool { return !redisClient.Degraded() }
+		}
+		cacheClient = cache.NewCacheWithOptions(redisClient.GetClient(), opts)
+		if cacheClient == nil {
+			return fmt.Errorf("could not initialize cache client")
+		}
+		if serverDeps.Responses != nil {
+			serverDeps.Responses.SetStore(cacheClient)
+		}
+		if serverDeps.Quotas != nil {
+			quotaTracker = quota.NewTracker(redisClient.GetClient(), quota.Limits{
+				Daily:   int64(cfg.Quota.DailyLimit),
+				Monthly: int64(cfg.Quota.MonthlyLimit),
+			})
+			serverDeps.Quotas.SetStore(quotaTracker)
+		}
+		return nil
+	}})
+	// the redis backend and redis dead letters share the client, a redis
+	// outage fails them even with STARTUP_DEGRADED
+	var busAfter []string
+	if cfg.EventBus.Backend == eventbus.BackendRedis || (cfg.EventBus.Backend != "" && cfg.EventBus.DeadLetterStore == eventbus.DeadLetterRedis) {
+		busAfter = []string{"redis"}
 	}
+	deps.Add(startup.Step{Name: "eventbus", After: busAfter, Run: func(ctx context.Context) error {
+		var rdb *goredis.Client
+		if redisClient != nil {
+			rdb = redisClient.GetClient()
+		}
+		b, err := eventbus.New(cfg, rdb, log.Module("eventbus"), service)
+		if err != nil {
+			return fmt.Errorf("opening event bus: %w", err)
+		}
+		bus = b
+		return nil
+	}})
+	deps.Add(startup.Step{Name: "postgres", Run: func(ctx context.Context) error {
+		sess, err := db.NewPostgresDB(cfg, log.Module("postgres"))
+		if err != nil {
+			return fmt.Errorf("connecting to database: %w", err)
+		}
+		dbSess = sess
+		log.Info("Connected to PostgreSQL database")
+		if faults != nil {
+			if err := sess.DB.Use(faults.Plugin()); err != nil {
+				return fmt.Errorf("installing fault injection: %w", err)
+			}
+		}
+		lc.AddReadinessCheck("postgres", sess.Ping)
+		return nil
+	}})
+	// models cached by the handlers register their keys here
+	deps.Add(startup.Step{Name: "cache-invalidation", After: []string{"postgres", "cache"}, Optional: cfg.Startup.Degraded, Run: func(ctx context.Context) error {
+		inv := db.NewCacheInvalidator(cacheClient, log.Module("postgres"), db.InvalidatorOptions{})
+		inv.Register(&other.Account{}, account.Invalidation)
+		if err := dbSess.DB.Use(inv); err != nil {
+			return fmt.Errorf("installing cache invalidation: %w", err)
+		}
+		invalidator = inv
+		return nil
+	}})
+	deps.Add(startup.Step{Name: "migrate", After: []string{"postgres"}, Run: func(ctx context.Context) error {
+		if err := db.Migrate(cfg); err != nil {
+			log.Warnf("Migration failed: %v", err)
+		}
+		return nil
+	}})
+	deps.Add(startup.Step{Name: "partition", After: []string{"migrate"}, Run: func(ctx context.Context) error {
+		sqlDB, err := dbSess.DB.DB()
+		if err != nil {
+			return fmt.Errorf("getting database pool: %w", err)
+		}
+		job, err := partition.NewJob(cfg, sqlDB, log.Module("partition"))
+		if err != nil {
+			return fmt.Errorf("invalid partition policies: %w", err)
+		}
+		if job != nil {
+			job.Start(context.Background())
+			partitionJob = job
+		}
+		return nil
+	}})
+	// after partition so the first cleanup sees this period's partitions
+	deps.Add(startup.Step{Name: "retention", After: []string{"partition"}, Run: func(ctx context.Context) error {
+		sqlDB, err := dbSess.DB.DB()
+		if err != nil {
+			return fmt.Errorf("getting database pool: %w", err)
+		}
+		job, err := retention.NewJob(cfg, sqlDB, log.Module("retention"))
+		if err != nil {
+			return fmt.Errorf("invalid retention policies: %w", err)
+		}
+		if job != nil {
+			job.Start()
+			retentionJob = job
+		}
+		return nil
+	}})
 
-	dbSess, err := db.NewPostgresDB(cfg)
+	started, err := deps.Run(ctx)
+	if redisClient != nil {
+		defer redisClient.Close()
+	}
+	if sentinel != nil {
+		defer sentinel.Stop()
+	}
+	if dbSess != nil {
+		defer dbSess.Close()
+	}
+	if invalidator != nil {
+		defer invalidator.Wait()
+	}
+	if partitionJob != nil {
+		defer partitionJob.Stop()
+	}
+	if retentionJob != nil {
+		defer retentionJob.Stop()
+	}
+	if bus != nil {
+		defer bus.Close()
+	}
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Fatalf("Startup failed:\n%v", err)
 	}
-	defer dbSess.Close()
+	if degraded := started.Degraded(); len(degraded) > 0 {
+		log.Warnf("Started degraded without %v", degraded)
+	}
+	// picks up a switch set before this replica started
+	mode.Start()
+	defer mode.Stop()
 
-	log.Info("Connected to PostgreSQL database")
+	// typed nils would reach the handlers as non-nil interfaces
+	var handlerCache handler.Cache
+	var flusher handler.PrefixFlusher
+	var primed warmup.Fetcher
+	var cacheStore cache.Store
+	if cacheClient != nil {
+		handlerCache, flusher, primed, cacheStore = cacheClient, cacheClient, cacheClient, cacheClient
+	}
 
-	if err := db.Migrate(cfg); err != nil {
-		log.Warnf("Migration failed: %v", err)
+	// modules register the cache keys they can load with warmer.Prime,
+	// WARMUP_CACHE_KEYS picks the ones loaded before readiness
+	warmOpts := warmup.Options{
+		DBConns: cfg.Warmup.DBConns,
+		Cache:   primed,
+		Keys:    cfg.Warmup.CacheKeys,
+		Log:     log.Module("warmup"),
+	}
+	if redisClient != nil && !redisClient.Degraded() {
+		warmOpts.Redis = redisClient.GetClient()
+		warmOpts.RedisConns = warmOpts.Redis.Options().MinIdleConns
+	}
+	if sqlDB, err := dbSess.DB.DB(); err == nil {
+		warmOpts.DB = sqlDB
 	}
+	warmer := warmup.New(warmOpts)
 
-	blueprintHandler := handler.NewBlueprint(local, log, cacheClient, dbSess.DB)
+	blueprintHandler := handler.NewBlueprint(local, log.Module("handler"), handlerCache, handler.GormStore(dbSess.DB))
+	blueprintHandler.CacheOptional = cfg.Cache.Optional
+	blueprintHandler.Service = service
+	// modules react to each other's domain events through it, the async
+	// handlers work off their queues once the servers stopped
+	events := dispatch.New(log.Module("dispatch"), dispatch.Options{})
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lc.ShutdownTimeout())
+		defer cancel()
+		if err := events.Close(ctx); err != nil {
+			log.Warnf("In-process events left unhandled: %v", err)
+		}
+	}()
+	blueprintHandler.Events = events
+
+	settingStore := settings.New(dbSess.DB, cacheStore, log.Module("settings"), settings.Options{})
+	if err := settingStore.Register(handler.SettingDefs...); err != nil {
+		log.Fatalf("Invalid settings: %v", err)
+	}
+	blueprintHandler.Settings = settingStore
+
+	blueprintHandler.Accounts = account.New(account.NewGormStore(dbSess.DB), cacheStore, translator, account.Options{})
+
+	if cfg.Hedge.Percentile > 0 {
+		blueprintHandler.Hedge = hedge.New(hedge.Options{
+			Name:       "postgres",
+			Percentile: cfg.Hedge.Percentile,
+			Budget:     cfg.Hedge.Budget,
+			MaxDelay:   cfg.Hedge.MaxDelay,
+		})
+	}
 
 	pb.RegisterBlueprintServer(s, blueprintHandler)
 
+	if adminServer != nil {
+		admin := handler.NewAdmin(blueprintHandler, log.Module("admin"), log, flusher)
+		if quotaTracker != nil {
+			admin.Quota = quotaTracker
+		}
+		if store := eventbus.DeadLetters(bus); store != nil {
+			admin.DeadLetters = &eventbus.DeadLetterQueue{Store: store, Bus: bus}
+		}
+		admin.Maintenance = mode
+		if faults != nil {
+			admin.Faults = faults
+		}
+		admin.Settings = settingStore
+		adminpb.RegisterAdminServiceServer(adminServer, admin)
+	}
+
 	grpc_prometheus.Register(s)
 
+	if err := lc.RegisterPodInfo(prometheus.DefaultRegisterer, service, version); err != nil {
+		log.Warnf("Failed to register pod info metric: %v", err)
+	}
+
+	serveCtx, stopServers := context.WithCancel(context.Background())
+	defer stopServers()
+
+	serveErr := make(chan error, 1)
+	// a panicking server shuts the service down like a failed one
 	go func() {
-		if err := s.Serve(lis); err != nil {
-			log.Fatalf("failed to serve: %v", err)
-		}
+		serveErr <- run.Safe(log, "servers", func() error { return servers.Run(serveCtx) })
 	}()
 
+	var registry *discovery.Discovery
+	if cfg.Discovery.Backend != "" {
+		port, _ := strconv.Atoi(cfg.GRPC.Port)
+		registry, err = discovery.NewDiscovery(cfg, discovery.Service{
+			Name:    service,
+			Version: version,
+			Host:    discovery.AdvertiseHost(cfg.GRPC.Host),
+			Port:    port,
+		})
+		if err != nil {
+			log.Fatalf("Failed to init service discovery: %v", err)
+		}
+
+		if err := registry.Start(ctx); err != nil {
+			log.Errorf("Service discovery registration failed: %v", err)
+			registry = nil
+		} else {
+			log.Infof("Registered %s with %s at %s", registry.Service().ID, cfg.Discovery.Backend, cfg.Discovery.Addr)
+		}
+	}
+
+	lc.MarkStarted()
+	// the servers already listen, readiness keeps traffic away until the
+	// pools and the cache are warm
+	if cfg.Warmup.Enabled {
+		warmCtx, cancelWarm := context.WithTimeout(ctx, cfg.Warmup.Timeout)
+		warmed, err := warmer.Run(warmCtx)
+		cancelWarm()
+		if err != nil {
+			log.WithFields(warmed.Fields()).Warnf("Warm-up incomplete, going ready anyway: %v", err)
+		} else {
+			log.WithFields(warmed.Fields()).Info("Warmed up connections and cache")
+		}
+	}
+	lc.SetReady(true)
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 
@@ -141,25 +560,39 @@ func Start() {
 		log.Infof("Received shutdown signal: %v", sig)
 	case <-ctx.Done():
 		log.Info("Context cancelled")
+	case err := <-serveErr:
+		// the manager already stopped the other servers
+		log.Errorf("Server failed: %v", err)
+		serveErr = nil
 	}
 	
 	log.Info("Shutting down gracefully...")
-	
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	// no-op when the preStop hook already drained us
+	lc.Drain()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), lc.ShutdownTimeout())
 	defer shutdownCancel()
 
-	stopped := make(chan struct{})
-	go func() {
-		s.GracefulStop()
-		close(stopped)
-	}()
+	// leave the registry first so no new traffic is routed to us while draining
+	if registry != nil {
+		if err := registry.Stop(shutdownCtx); err != nil {
+			log.Warnf("Service discovery deregistration failed: %v", err)
+		}
+	}
 
-	select {
-	case <-shutdownCtx.Done():
-		log.Warn("Graceful shutdown timed out, forcing stop")
-		s.Stop()
-	case <-stopped:
-		log.Info("Server stopped gracefully")
+	// every server stops gracefully within the manager's shutdown timeout
+	stopServers()
+	if serveErr != nil {
+		if err := <-serveErr; err != nil {
+			log.Warnf("Servers did not stop cleanly: %v", err)
+		} else {
+			log.Info("Servers stopped gracefully")
+		}
+	}
+
+	if err := lc.Shutdown(context.Background()); err != nil {
+		log.Warnf("Probe server shutdown failed: %v", err)
 	}
 
 	log.Info("Shutdown complete")
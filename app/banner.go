@@ -0,0 +1,116 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package app
+
+import (
+	"blueprint/config"
+	"blueprint/pkg/buildinfo"
+	"blueprint/pkg/logger"
+)
+
+// logBanner logs what actually took effect: a summary operators can scan
+// and, next to it, the whole config with secrets masked like config print
+func logBanner(log *logger.Logger, cfg *config.Config, build buildinfo.Info) {
+	log.Infow("Startup banner",
+		"service", service,
+		"version", build.Version,
+		"commit", build.Commit,
+		"environment", cfg.Setting.Environment,
+		"profile", cfg.Setting.Profile,
+		"modules", enabledModules(cfg),
+		"ports", listenPorts(cfg),
+		"pools", poolSizes(cfg),
+		"flags", featureFlags(cfg),
+	)
+	log.Infow("Effective configuration", "config", config.Fields(cfg))
+}
+
+// enabledModules are the optional parts switched on by config
+func enabledModules(cfg *config.Config) []string {
+	var modules []string
+	add := func(name string, on bool) {
+		if on {
+			modules = append(modules, name)
+		}
+	}
+	add("gateway", cfg.HTTP.GatewayPort != "")
+	add("admin", cfg.Admin.Port != "")
+	add("discovery", cfg.Discovery.Backend != "")
+	add("error_tracking", cfg.ErrorTracking.SentryDSN != "" || cfg.ErrorTracking.WebhookURL != "")
+	add("payload_log", cfg.PayloadLog.SampleRate > 0 || len(cfg.PayloadLog.Methods) > 0)
+	add("netacl", len(cfg.NetACL.Allow) > 0 || len(cfg.NetACL.Deny) > 0 || cfg.NetACL.File != "")
+	add("rate_limit", cfg.RateLimit.Enabled)
+	add("concurrency", cfg.Concurrency.Limit > 0)
+	add("quota", cfg.Quota.Enabled())
+	add("response_cache", cfg.ResponseCache.Enabled)
+	add("redis_sentinel", len(cfg.Redis.SentinelAddrs) > 0)
+	add("hedge", cfg.Hedge.Percentile > 0)
+	add("retention", len(cfg.Retention.Policies) > 0)
+	add("partition", len(cfg.Partition.Policies) > 0)
+	add("notify", cfg.Notify.Enabled())
+	add("eventbus", cfg.EventBus.Backend != "")
+	return modules
+}
+
+// listenPorts are the listeners NewGRPCServer and Start open, unset ones
+// are left out
+func listenPorts(cfg *config.Config) map[string]interface{} {
+	grpcAddrs := cfg.GRPC.ListenAddrs
+	if len(grpcAddrs) == 0 {
+		grpcAddrs = []string{":" + cfg.GRPC.Port}
+	}
+	ports := map[string]interface{}{
+		"grpc":  grpcAddrs,
+		"probe": cfg.Kube.ProbePort,
+	}
+	for name, port := range map[string]string{
+		"grpc_unix": cfg.GRPC.UnixSocket,
+		"gateway":   cfg.HTTP.GatewayPort,
+		"metrics":   cfg.HTTP.MetricsPort,
+		"debug":     cfg.HTTP.DebugPort,
+		"admin":     cfg.Admin.Port,
+	} {
+		if port != "" {
+			ports[name] = port
+		}
+	}
+	return ports
+}
+
+// poolSizes are as configured, the packages pick their own default for 0
+// and 0 turns auto tuning off
+func poolSizes(cfg *config.Config) map[string]interface{} {
+	return map[string]interface{}{
+		"redis_pool_size":             orElse(cfg.Redis.PoolSize, "default"),
+		"redis_min_idle_conns":        orElse(cfg.Redis.MinIdleConn, "default"),
+		"redis_pool_max_size":         orElse(cfg.Redis.PoolMaxSize, "off"),
+		"postgres_max_open_conns":     orElse(cfg.Postgres.MaxOpenConns, "default"),
+		"postgres_max_idle_conns":     orElse(cfg.Postgres.MaxIdleConns, "default"),
+		"postgres_max_open_tuned":     orElse(cfg.Postgres.MaxOpenConnsTuned, "off"),
+		"grpc_max_concurrent_streams": orElse(cfg.GRPC.MaxConcurrentStreams, "unlimited"),
+	}
+}
+
+func orElse(n int, zero string) interface{} {
+	if n == 0 {
+		return zero
+	}
+	return n
+}
+
+func featureFlags(cfg *config.Config) map[string]bool {
+	return map[string]bool{
+		"grpc_reflection":        cfg.Debug.Reflection,
+		"verbose_errors":         cfg.Debug.VerboseErrors,
+		"debug_endpoints":        cfg.Debug.Endpoints,
+		"api_docs":               cfg.Debug.APIDocs,
+		"fault_injection":        cfg.Faults.Enabled,
+		"crash_goroutine_dump":   cfg.Crash.GoroutineDump,
+		"postgres_explain_slow":  cfg.Postgres.ExplainSlow,
+		"query_budget_reject":    cfg.Postgres.QueryBudgetReject,
+		"load_shed":              cfg.LoadShed.Enabled,
+		"cache_read_your_writes": cfg.Cache.ReadYourWrites,
+		"cache_optional":         cfg.Cache.Optional,
+		"startup_degraded":       cfg.Startup.Degraded,
+		"warmup":                 cfg.Warmup.Enabled,
+	}
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"testing"
+
+	"blueprint/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnabledModules(t *testing.T) {
+	cfg := &config.Config{}
+	assert.Empty(t, enabledModules(cfg))
+
+	cfg.RateLimit.Enabled = true
+	cfg.Quota.DailyLimit = 100
+	cfg.Admin.Port = "3100"
+	cfg.Retention.Policies = []string{"platform_tick.created_at=30d"}
+	assert.Equal(t, []string{"admin", "rate_limit", "quota", "retention"}, enabledModules(cfg))
+}
+
+func TestListenPorts(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.GRPC.Port = "3000"
+	cfg.Kube.ProbePort = "8086"
+	cfg.HTTP.MetricsPort = "9090"
+
+	assert.Equal(t, map[string]interface{}{
+		"grpc":    []string{":3000"},
+		"probe":   "8086",
+		"metrics": "9090",
+	}, listenPorts(cfg))
+}
+
+func TestPoolSizesNameTheDefaults(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Postgres.MaxOpenConns = 50
+
+	pools := poolSizes(cfg)
+	assert.Equal(t, 50, pools["postgres_max_open_conns"])
+	assert.Equal(t, "default", pools["redis_pool_size"])
+	assert.Equal(t, "off", pools["postgres_max_open_tuned"])
+}
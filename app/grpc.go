@@ -0,0 +1,301 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package app
+
+import (
+	"blueprint/config"
+	"blueprint/pkg/buildinfo"
+	"blueprint/pkg/cache"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/consistency"
+	"blueprint/pkg/crash"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/i18n"
+	"blueprint/pkg/inflight"
+	"blueprint/pkg/loadshed"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/maintenance"
+	"blueprint/pkg/netacl"
+	"blueprint/pkg/payloadlog"
+	"blueprint/pkg/querybudget"
+	"blueprint/pkg/quota"
+	"blueprint/pkg/ratelimit"
+	"blueprint/pkg/specs"
+	"fmt"
+	"math"
+	"net"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
+	"github.com/grpc-ecosystem/go-grpc-prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+)
+
+// ServerDeps are the interceptors NewGRPCServer chains, nil ones are left
+// out. Crash is required, every panic becomes a crash report. Build them
+// with BuildServerDeps rather than by hand so every server runs the chain
+// cfg asks for.
+type ServerDeps struct {
+	Crash       *crash.Reporter
+	ACL         *netacl.ACL
+	RateLimits  *ratelimit.Interceptor
+	Concurrency *inflight.Interceptor
+	Quotas      *quota.Interceptor
+	Responses   *cache.ResponseCache
+	QueryBudget *querybudget.Interceptor
+	LoadShed    *loadshed.Interceptor
+	Maintenance *maintenance.Switch
+}
+
+// BuildServerDeps builds the interceptors cfg switches on, for Start and
+// the in-process test server alike. Their stores start out empty or in
+// memory and are swapped with SetStore, by Start once redis is up. clk nil
+// is the wall clock, translator nil answers maintenance in English.
+func BuildServerDeps(cfg *config.Config, log *logger.Logger, clk clock.Clock, translator i18n.Translator) (ServerDeps, error) {
+	deps := ServerDeps{
+		Crash: crash.NewReporter(cfg, log.Module("grpc"), service, buildinfo.Get().Version),
+		// switched through the AdminService and shared through redis
+		// once it is up
+		Maintenance: maintenance.New(cfg, log.Module("maintenance"), translator),
+	}
+
+	// the store is plugged in once redis is up, until then calls pass through
+	if cfg.ResponseCache.Enabled {
+		policies, err := specs.ParseAll(cfg.ResponseCache.Policies, cache.ParsePolicy)
+		if err != nil {
+			return ServerDeps{}, fmt.Errorf("invalid response cache policies: %w", err)
+		}
+		deps.Responses = cache.NewResponseCache(policies, cfg.ResponseCache.BypassHeader)
+	}
+
+	acl, err := netacl.NewACL(cfg, log.Module("netacl"))
+	if err != nil {
+		return ServerDeps{}, fmt.Errorf("invalid network ACL: %w", err)
+	}
+	deps.ACL = acl
+
+	if cfg.RateLimit.Enabled {
+		policies, err := specs.ParseAll(cfg.RateLimit.Policies, ratelimit.ParsePolicy)
+		if err != nil {
+			return ServerDeps{}, fmt.Errorf("invalid rate limit policies: %w", err)
+		}
+		deps.RateLimits = ratelimit.NewInterceptor(policies, cfg.Quota.KeyHeader, cfg.RateLimit.WarnAt, log.Module("ratelimit"), clk)
+	}
+
+	// memory until redis is up when the cap is shared
+	if cfg.Concurrency.Limit > 0 {
+		deps.Concurrency = inflight.NewInterceptor(inflight.NewMemory(), inflight.Options{
+			Limit:     cfg.Concurrency.Limit,
+			Key:       cfg.Concurrency.Key,
+			KeyHeader: cfg.Quota.KeyHeader,
+			Exempt:    cfg.Concurrency.Exempt,
+		})
+	}
+
+	if cfg.Quota.Enabled() {
+		deps.Quotas = quota.NewInterceptor(cfg.Quota.KeyHeader, clk)
+	}
+
+	if cfg.Postgres.QueryBudget > 0 || len(cfg.Postgres.QueryBudgets) > 0 {
+		policies, err := specs.ParseAll(cfg.Postgres.QueryBudgets, querybudget.ParsePolicy)
+		if err != nil {
+			return ServerDeps{}, fmt.Errorf("invalid query budgets: %w", err)
+		}
+		deps.QueryBudget = querybudget.NewInterceptor(cfg.Postgres.QueryBudget, policies, cfg.Postgres.QueryBudgetReject, log.Module("postgres"))
+	}
+
+	if cfg.LoadShed.Enabled {
+		limiter := loadshed.NewLimiter(loadshed.Options{
+			Name:    "grpc",
+			Initial: cfg.LoadShed.InitialLimit,
+			Min:     cfg.LoadShed.MinLimit,
+			Max:     cfg.LoadShed.MaxLimit,
+			Clock:   clk,
+		})
+		deps.LoadShed = loadshed.NewInterceptor(limiter, loadshed.InterceptorOptions{
+			Exempt:     cfg.LoadShed.Exempt,
+			Critical:   cfg.LoadShed.Critical,
+			Background: cfg.LoadShed.Background,
+			Header:     cfg.LoadShed.PriorityHeader,
+		})
+	}
+
+	return deps, nil
+}
+
+// Start runs what the deps do in the background, the ACL picking up rules
+// file changes while serving
+func (d ServerDeps) Start() {
+	if d.ACL != nil && d.ACL.Enabled() {
+		d.ACL.Start()
+	}
+}
+
+func (d ServerDeps) Stop() {
+	if d.ACL != nil {
+		d.ACL.Stop()
+	}
+}
+
+// NewGRPCServer is the one place the gRPC server is put together, the
+// config.Debug features are enforced here so no caller can switch them on
+// by accident
+func NewGRPCServer(cfg *config.Config, log *logger.Logger, deps ServerDeps) *grpc.Server {
+	// Recovery options for panic handling, every panic becomes a crash report
+	recoveryOpts := []recovery.Option{
+		recovery.WithRecoveryHandlerContext(deps.Crash.RecoveryHandler),
+	}
+
+	// the trusted proxies of the ACL vouch for the caller even without
+	// any rules
+	var peers ctxmeta.Peers
+	if deps.ACL != nil {
+		peers = deps.ACL
+	}
+
+	// errors are sanitized inside recovery so crash ids reach the client
+	unary := []grpc.UnaryServerInterceptor{
+		recovery.UnaryServerInterceptor(recoveryOpts...),
+		errors.UnaryServerInterceptor(cfg.Debug.VerboseErrors),
+		ctxmeta.UnaryServerInterceptor(peers),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		recovery.StreamServerInterceptor(recoveryOpts...),
+		errors.StreamServerInterceptor(cfg.Debug.VerboseErrors),
+		ctxmeta.StreamServerInterceptor(peers),
+	}
+
+	// right after ctxmeta so audit entries carry the request id
+	if deps.ACL != nil && deps.ACL.Enabled() {
+		unary = append(unary, deps.ACL.UnaryServerInterceptor())
+		stream = append(stream, deps.ACL.StreamServerInterceptor())
+	}
+
+	// before anything reading the cache, the session lives for the call
+	if cfg.Cache.ReadYourWrites {
+		unary = append(unary, consistency.UnaryServerInterceptor())
+		stream = append(stream, consistency.StreamServerInterceptor())
+	}
+
+	// opt-in, logs whole payloads so keep it to staging
+	if payloads := payloadlog.NewLogger(cfg, log.Module("payload")); payloads.Enabled() {
+		unary = append(unary, payloads.UnaryServerInterceptor())
+		stream = append(stream, payloads.StreamServerInterceptor())
+		log.Warnf("Payload logging enabled, sample rate %v, methods %v", cfg.PayloadLog.SampleRate, cfg.PayloadLog.Methods)
+	}
+
+	unary = append(unary, grpc_prometheus.UnaryServerInterceptor)
+	stream = append(stream, grpc_prometheus.StreamServerInterceptor)
+
+	// first to turn calls down, writes refused for maintenance never take
+	// a slot from the load shedder or a call from the rate limits
+	if deps.Maintenance != nil {
+		unary = append(unary, deps.Maintenance.UnaryServerInterceptor())
+		stream = append(stream, deps.Maintenance.StreamServerInterceptor())
+	}
+
+	// a shed call costs nothing downstream and still shows up in the grpc
+	// metrics
+	if deps.LoadShed != nil {
+		unary = append(unary, deps.LoadShed.UnaryServerInterceptor())
+	}
+
+	// calls turned down here never reach the quota
+	if deps.RateLimits != nil {
+		unary = append(unary, deps.RateLimits.UnaryServerInterceptor())
+	}
+
+	// after the rate limits, a call turned down there never holds a slot;
+	// streams hold theirs until they end
+	if deps.Concurrency != nil {
+		unary = append(unary, deps.Concurrency.UnaryServerInterceptor())
+		stream = append(stream, deps.Concurrency.StreamServerInterceptor())
+	}
+
+	// before the response cache so cached answers count against the quota;
+	// a stream is charged once when it opens
+	if deps.Quotas != nil {
+		unary = append(unary, deps.Quotas.UnaryServerInterceptor())
+		stream = append(stream, deps.Quotas.StreamServerInterceptor())
+	}
+
+	// last so hits still show up in the logs and grpc metrics
+	if deps.Responses != nil {
+		unary = append(unary, deps.Responses.UnaryServerInterceptor())
+	}
+
+	// after the cache, hits run no queries and would only skew the counts
+	if deps.QueryBudget != nil {
+		unary = append(unary, deps.QueryBudget.UnaryServerInterceptor())
+	}
+
+	s := grpc.NewServer(append(serverOptions(cfg),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)...)
+
+	if cfg.Debug.Reflection {
+		reflection.Register(s)
+	}
+
+	log.Infof("gRPC reflection %v, verbose errors %v, debug endpoints %v (%s)",
+		cfg.Debug.Reflection, cfg.Debug.VerboseErrors, cfg.Debug.Endpoints, cfg.Setting.Environment)
+
+	return s
+}
+
+// serverOptions turns config.GRPC into keepalive and limit options, the
+// interceptors are added by Start
+func serverOptions(cfg *config.Config) []grpc.ServerOption {
+	kaep := keepalive.EnforcementPolicy{
+		MinTime:             cfg.GRPC.KeepaliveMinTime,
+		PermitWithoutStream: cfg.GRPC.PermitWithoutStream,
+	}
+
+	kasp := keepalive.ServerParameters{
+		MaxConnectionIdle:     cfg.GRPC.MaxConnectionIdle,
+		MaxConnectionAge:      cfg.GRPC.MaxConnectionAge,
+		MaxConnectionAgeGrace: cfg.GRPC.MaxConnectionAgeGrace,
+		Time:                  cfg.GRPC.KeepaliveTime,
+		Timeout:               cfg.GRPC.Timeout,
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(kaep),
+		grpc.KeepaliveParams(kasp),
+		grpc.ConnectionTimeout(cfg.GRPC.ConnectionTimeout),
+	}
+
+	if n := cfg.GRPC.MaxConcurrentStreams; n > 0 && n <= math.MaxUint32 {
+		opts = append(opts, grpc.MaxConcurrentStreams(uint32(n)))
+	}
+
+	if cfg.GRPC.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.GRPC.MaxRecvMsgSize))
+	}
+
+	if cfg.GRPC.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(cfg.GRPC.MaxSendMsgSize))
+	}
+
+	return opts
+}
+
+// loopbackTarget is how in-process clients like the gateway reach our own
+// gRPC server, the unix socket when there is one, else the first tcp address
+// with an unspecified host swapped for loopback
+func loopbackTarget(cfg *config.Config, addr string) string {
+	if cfg.GRPC.UnixSocket != "" {
+		return "unix:" + cfg.GRPC.UnixSocket
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,173 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package client is the Go SDK for the Blueprint service. It wraps the
+// generated stubs so callers get a default deadline, retries of transient
+// failures, the bearer token and the request id of their own call on every
+// request, and errors they can switch on:
+//
+//	c, err := client.New(client.Options{Target: "dns:///blueprint:50051", Token: token})
+//	defer c.Close()
+//
+//	msg, err := c.Call(ctx, "world")
+//	if e, ok := client.AsError(err); ok && e.Code == codes.InvalidArgument {
+//		...
+//	}
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/errors"
+	pb "blueprint/proto/blueprint"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+
+	// pick_first would pin every call to one pod behind a dns name
+	serviceConfig = `{"loadBalancingConfig": [{"round_robin": {}}]}`
+)
+
+type Options struct {
+	// Target is a gRPC target, e.g. "dns:///blueprint:50051"
+	Target string
+	// Token is sent as "authorization: Bearer <token>", TokenSource wins
+	// when both are set
+	Token       string
+	TokenSource func(ctx context.Context) (string, error)
+	// Timeout is the deadline of calls whose ctx has none, 5s by default
+	Timeout time.Duration
+	// Retry of transient failures, errors.DefaultRetry when zero and
+	// Attempts 1 turns it off. Every RPC of the service is safe to repeat.
+	Retry errors.RetryOptions
+	// ClientVersion is sent as x-client-version on every call, e.g.
+	// "orders/v1.4.2", the server logs it with the call
+	ClientVersion string
+	// TLS nil means plaintext, fine inside the mesh
+	TLS         *tls.Config
+	DialOptions []grpc.DialOption
+}
+
+type Client struct {
+	conn *grpc.ClientConn
+	rpc  pb.BlueprintClient
+	opts Options
+}
+
+// New opens a connection to Target, it connects lazily on the first call
+func New(opts Options) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if opts.TLS != nil {
+		creds = credentials.NewTLS(opts.TLS)
+	}
+
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		// the server's keepalive policy allows pings every 5s
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: 30 * time.Second, Timeout: 10 * time.Second}),
+	}, opts.DialOptions...)
+
+	conn, err := grpc.NewClient(opts.Target, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewWithConn(conn, opts)
+	c.conn = conn
+	return c, nil
+}
+
+// NewWithConn uses a connection the caller owns, Close leaves it open
+func NewWithConn(conn grpc.ClientConnInterface, opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	return &Client{rpc: pb.NewBlueprintClient(conn), opts: opts}
+}
+
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *Client) Call(ctx context.Context, name string) (string, error) {
+	var resp *pb.CallResponse
+	err := c.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.rpc.Call(ctx, &pb.CallRequest{Name: name})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Msg, nil
+}
+
+// Version is the build of the server that answered
+func (c *Client) Version(ctx context.Context) (*pb.VersionResponse, error) {
+	var resp *pb.VersionResponse
+	err := c.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.rpc.Version(ctx, &pb.VersionRequest{})
+		return err
+	})
+	return resp, err
+}
+
+// invoke applies the deadline and metadata once and retries fn within them
+func (c *Client) invoke(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+
+	ctx, err := c.outgoing(ctx)
+	if err != nil {
+		return err
+	}
+
+	return asTyped(errors.Retry(ctx, c.opts.Retry, fn))
+}
+
+// outgoing adds the token and carries the caller's request and trace ids
+// on, so a chain of services logs one request id
+func (c *Client) outgoing(ctx context.Context) (context.Context, error) {
+	var pairs []string
+
+	token := c.opts.Token
+	if c.opts.TokenSource != nil {
+		var err error
+		if token, err = c.opts.TokenSource(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if token != "" {
+		pairs = append(pairs, "authorization", "Bearer "+token)
+	}
+
+	if id, ok := ctxmeta.RequestID(ctx); ok {
+		pairs = append(pairs, ctxmeta.HeaderRequestID, id)
+	}
+	if id, ok := ctxmeta.TraceID(ctx); ok {
+		pairs = append(pairs, ctxmeta.HeaderTraceID, id)
+	}
+	if c.opts.ClientVersion != "" {
+		pairs = append(pairs, ctxmeta.HeaderClientVersion, c.opts.ClientVersion)
+	}
+
+	if len(pairs) == 0 {
+		return ctx, nil
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...), nil
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blueprint/pkg/ctxmeta"
+	apperrors "blueprint/pkg/errors"
+	pb "blueprint/proto/blueprint"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeServer struct {
+	pb.UnimplementedBlueprintServer
+	calls    int32
+	failures int32
+	md       metadata.MD
+	deadline bool
+}
+
+func (s *fakeServer) Call(ctx context.Context, req *pb.CallRequest) (*pb.CallResponse, error) {
+	n := atomic.AddInt32(&s.calls, 1)
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	_, s.deadline = ctx.Deadline()
+
+	if n <= atomic.LoadInt32(&s.failures) {
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	if req.Name == "" {
+		return nil, apperrors.InvalidArgument("name is required", apperrors.FieldViolation{Field: "name", Description: "required"})
+	}
+	return &pb.CallResponse{Msg: "Hello " + req.Name}, nil
+}
+
+func newTestClient(t *testing.T, srv *fakeServer, opts Options) *Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	pb.RegisterBlueprintServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	opts.Target = "passthrough:///bufnet"
+	opts.DialOptions = append(opts.DialOptions, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	c, err := New(opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestCallSendsTokenIdsAndDeadline(t *testing.T) {
+	srv := &fakeServer{}
+	c := newTestClient(t, srv, Options{Token: "secret", ClientVersion: "orders/v1.4.2"})
+
+	ctx := ctxmeta.WithRequestID(context.Background(), "req-1")
+	ctx = ctxmeta.WithTraceID(ctx, "trace-1")
+	msg, err := c.Call(ctx, "world")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello world", msg)
+	assert.Equal(t, []string{"Bearer secret"}, srv.md.Get("authorization"))
+	assert.Equal(t, []string{"req-1"}, srv.md.Get(ctxmeta.HeaderRequestID))
+	assert.Equal(t, []string{"trace-1"}, srv.md.Get(ctxmeta.HeaderTraceID))
+	assert.Equal(t, []string{"orders/v1.4.2"}, srv.md.Get(ctxmeta.HeaderClientVersion))
+	assert.True(t, srv.deadline, "default timeout applied")
+}
+
+func TestTokenSource(t *testing.T) {
+	srv := &fakeServer{}
+	c := newTestClient(t, srv, Options{Token: "static", TokenSource: func(ctx context.Context) (string, error) {
+		return "fresh", nil
+	}})
+
+	_, err := c.Call(context.Background(), "world")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer fresh"}, srv.md.Get("authorization"))
+
+	failing := errors.New("no token")
+	c = newTestClient(t, srv, Options{TokenSource: func(ctx context.Context) (string, error) {
+		return "", failing
+	}})
+	_, err = c.Call(context.Background(), "world")
+	assert.ErrorIs(t, err, failing)
+	assert.Equal(t, codes.Unknown, Code(err))
+}
+
+func TestRetriesTransientFailures(t *testing.T) {
+	srv := &fakeServer{failures: 2}
+	c := newTestClient(t, srv, Options{Retry: apperrors.RetryOptions{Attempts: 3, BaseDelay: time.Millisecond}})
+
+	msg, err := c.Call(context.Background(), "world")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world", msg)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&srv.calls))
+
+	srv = &fakeServer{failures: 5}
+	c = newTestClient(t, srv, Options{Retry: apperrors.RetryOptions{Attempts: 1}})
+	_, err = c.Call(context.Background(), "world")
+	assert.Equal(t, codes.Unavailable, Code(err))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&srv.calls))
+}
+
+func TestTypedErrors(t *testing.T) {
+	srv := &fakeServer{}
+	c := newTestClient(t, srv, Options{})
+
+	_, err := c.Call(context.Background(), "")
+	e, ok := AsError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.InvalidArgument, e.Code)
+	assert.Equal(t, apperrors.ReasonInvalidArgument, e.Reason)
+	assert.Equal(t, []apperrors.FieldViolation{{Field: "name", Description: "required"}}, e.Violations)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&srv.calls), "not retried")
+
+	assert.Equal(t, codes.OK, Code(nil))
+}
@@ -0,0 +1,49 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package client
+
+import (
+	"errors"
+
+	apperrors "blueprint/pkg/errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error is the server's typed error. Code and Message are set for every
+// failed call, Reason, Violations and RetryAfter when the server sent them.
+type Error = apperrors.Error
+
+// asTyped turns a gRPC status into an *Error, other errors like a failing
+// TokenSource are returned as they are
+func asTyped(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); !ok {
+		return err
+	}
+	e, _ := apperrors.FromError(err)
+	return e
+}
+
+// AsError returns the typed error of a failed call
+func AsError(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// Code is codes.OK for nil and codes.Unknown for errors that did not come
+// from the server
+func Code(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if e, ok := AsError(err); ok {
+		return e.Code
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,140 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/db"
+	"blueprint/pkg/eventbus"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/redis"
+)
+
+const backfillUsage = `usage: blueprint backfill -name <name> -topic <topic> (-archive <file> | -query <sql> [-start <cursor>]) [flags]
+
+Republishes historical events on the configured event bus at -rate events
+per second. Progress is checkpointed in redis under backfill:<name>; run the
+same command again to resume after a stop, or with -reset to start over.
+-query selects cursor, id, type, version, occurred_at, key and data after the
+cursor $1, at most $2 rows, in cursor order.`
+
+// backfill runs outside the service, against the same config, so a long
+// replay never competes with a replica's own work
+func backfill(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprintln(stderr, backfillUsage); fs.PrintDefaults() }
+	name := fs.String("name", "", "checkpoint name, reuse it to resume")
+	topic := fs.String("topic", "", "topic to publish on")
+	archive := fs.String("archive", "", "file of JSON or CloudEvents JSON events, one per line, .gz allowed")
+	query := fs.String("query", "", "SQL reading the events from postgres")
+	start := fs.String("start", "", "cursor of the first -query read")
+	rate := fs.Float64("rate", 100, "events per second, 0 for no limit")
+	batch := fs.Int("batch", 100, "events per publish and checkpoint")
+	reset := fs.Bool("reset", false, "drop the checkpoint and start over")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || *topic == "" || (*archive == "") == (*query == "") || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if cfg.EventBus.Backend == "" || cfg.EventBus.Backend == eventbus.BackendMemory {
+		fmt.Fprintf(stderr, "EVENTBUS_BACKEND is %q, backfills need redis or kafka\n", cfg.EventBus.Backend)
+		return 1
+	}
+	log, err := logger.NewLogger(cfg)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer log.Close()
+
+	// interrupted runs stop between batches and resume from the checkpoint
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rdb, err := redis.NewRedisClient(cfg, log.Module("redis"))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer rdb.Close()
+	if err := rdb.Ping(ctx); err != nil {
+		fmt.Fprintf(stderr, "checkpoints need redis at %s: %v\n", cfg.Redis.RedisAddr, err)
+		return 1
+	}
+	// events without a source of their own are the service's
+	bus, err := eventbus.New(cfg, rdb.GetClient(), log.Module("eventbus"), "platform-blueprint")
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer bus.Close()
+
+	var src eventbus.Source
+	if *archive != "" {
+		a := &eventbus.ArchiveSource{Path: *archive}
+		defer a.Close()
+		src = a
+	} else {
+		sess, err := db.NewPostgresDB(cfg, log.Module("postgres"))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer sess.Close()
+		sqlDB, err := sess.DB.DB()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		src = &eventbus.SQLSource{DB: sqlDB, Query: *query, Start: *start}
+	}
+
+	checkpoints := eventbus.NewRedisCheckpoints(rdb.GetClient(), "")
+	if *reset {
+		if err := checkpoints.Reset(ctx, *name); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	began := time.Now()
+	cp, err := eventbus.Backfill(ctx, bus, src, eventbus.BackfillOptions{
+		Name:        *name,
+		Topic:       *topic,
+		Rate:        *rate,
+		Batch:       *batch,
+		Checkpoints: checkpoints,
+		Log:         log.Module("eventbus"),
+		Progress: func(cp eventbus.Checkpoint) {
+			fmt.Fprintf(stdout, "%s published %d, cursor %s\n", cp.UpdatedAt.Format(time.RFC3339), cp.Published, cp.Cursor)
+		},
+	})
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintf(stderr, "stopped at %s after %d events, run again to resume\n", cp.Cursor, cp.Published)
+		return 1
+	case err != nil:
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "done: %d events in total, cursor %s, %s this run\n", cp.Published, cp.Cursor, time.Since(began).Round(time.Second))
+	return 0
+}
@@ -0,0 +1,182 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"blueprint/config"
+	adminpb "blueprint/proto/admin"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const dlqUsage = `usage: blueprint dlq <list|show|replay|delete> [flags] [id...]
+
+  list            dead letters, oldest first
+  show <id>       one dead letter with its payload
+  replay [id...]  publish again and remove, the given ids or those matching the flags
+  delete [id...]  remove for good, the given ids or those matching the flags
+
+The admin listener is -addr (localhost:$ADMIN_GRPC_PORT), authenticated with
+-token ($ADMIN_TOKEN).`
+
+// dlq talks to the AdminService of a running instance, so ops never have
+// to edit the dead letter stream by hand
+func dlq(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, dlqUsage)
+		return 2
+	}
+	sub := args[0]
+
+	fs := flag.NewFlagSet("dlq "+sub, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", "localhost:"+os.Getenv(config.ADMIN_GRPC_PORT), "admin gRPC address")
+	token := fs.String("token", os.Getenv(config.ADMIN_TOKEN), "admin token")
+	topic := fs.String("topic", "", "only this topic")
+	group := fs.String("group", "", "only this subscriber group")
+	errorType := fs.String("error-type", "", "only this error type: panic, transient, error, schema, undecodable or a reason like UNAVAILABLE")
+	since := fs.String("since", "", "failed at or after, RFC3339 or a duration ago like 2h")
+	until := fs.String("until", "", "failed before, RFC3339 or a duration ago")
+	limit := fs.Int("limit", 100, "at most this many, up to 1000")
+	timeout := fs.Duration("timeout", 30*time.Second, "deadline of the call")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	filter := &adminpb.DeadLetterFilter{Topic: *topic, Group: *group, ErrorType: *errorType}
+	var err error
+	if filter.Since, err = parseWhen(*since); err != nil {
+		fmt.Fprintf(stderr, "-since: %v\n", err)
+		return 2
+	}
+	if filter.Until, err = parseWhen(*until); err != nil {
+		fmt.Fprintf(stderr, "-until: %v\n", err)
+		return 2
+	}
+	// replay and delete without ids act on the filter, never on everything
+	filtered := *topic != "" || *group != "" || *errorType != "" || *since != "" || *until != ""
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer conn.Close()
+	admin := adminpb.NewAdminServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+*token)
+
+	switch {
+	case sub == "list":
+		err = dlqList(ctx, admin, filter, int32(*limit), stdout)
+	case sub == "show" && fs.NArg() == 1:
+		err = dlqShow(ctx, admin, fs.Arg(0), stdout)
+	case (sub == "replay" || sub == "delete") && (fs.NArg() > 0 || filtered):
+		req := &adminpb.ReplayDeadLettersRequest{Ids: fs.Args(), Limit: int32(*limit)}
+		if fs.NArg() == 0 {
+			req.Filter = filter
+		}
+		if sub == "replay" {
+			err = dlqReplay(ctx, admin, req, stdout)
+		} else {
+			err = dlqDelete(ctx, admin, &adminpb.DeleteDeadLettersRequest{Ids: req.Ids, Filter: req.Filter, Limit: req.Limit}, stdout)
+		}
+	default:
+		fmt.Fprintln(stderr, dlqUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func dlqList(ctx context.Context, admin adminpb.AdminServiceClient, filter *adminpb.DeadLetterFilter, limit int32, out io.Writer) error {
+	resp, err := admin.ListDeadLetters(ctx, &adminpb.ListDeadLettersRequest{Filter: filter, PageSize: limit})
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFAILED AT\tTOPIC\tGROUP\tEVENT\tERROR TYPE\tATTEMPTS\tERROR")
+	for _, dl := range resp.DeadLetters {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			dl.Id, time.Unix(dl.FailedAt, 0).UTC().Format(time.RFC3339), dl.Topic, dl.Group,
+			dl.EventType, dl.ErrorType, dl.Attempts, firstLine(dl.Error))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if resp.NextPageToken != "" {
+		fmt.Fprintf(out, "more after %s, narrow the filter or raise -limit\n", resp.NextPageToken)
+	}
+	return nil
+}
+
+func dlqShow(ctx context.Context, admin adminpb.AdminServiceClient, id string, out io.Writer) error {
+	dl, err := admin.GetDeadLetter(ctx, &adminpb.GetDeadLetterRequest{Id: id})
+	if err != nil {
+		return err
+	}
+	data, err := protojson.MarshalOptions{Multiline: true}.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+func dlqReplay(ctx context.Context, admin adminpb.AdminServiceClient, req *adminpb.ReplayDeadLettersRequest, out io.Writer) error {
+	resp, err := admin.ReplayDeadLetters(ctx, req)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "replayed %d\n", resp.Replayed)
+	if resp.FailedId != "" {
+		return fmt.Errorf("stopped at %s: %s", resp.FailedId, resp.Error)
+	}
+	return nil
+}
+
+func dlqDelete(ctx context.Context, admin adminpb.AdminServiceClient, req *adminpb.DeleteDeadLettersRequest, out io.Writer) error {
+	resp, err := admin.DeleteDeadLetters(ctx, req)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "deleted %d\n", resp.Deleted)
+	return err
+}
+
+// parseWhen reads RFC3339 or a duration back from now as unix seconds,
+// 0 for empty
+func parseWhen(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d).Unix(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither RFC3339 nor a duration", s)
+	}
+	return t.Unix(), nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -3,12 +3,55 @@ package main
 
 import (
 	"blueprint/app"
+	"blueprint/config"
+	"fmt"
+	"os"
 )
 
 // Main entry point for everyting in this blueprint service
+//
+//	blueprint               run the service
+//	blueprint config print  dump the effective config, secrets masked
+//	blueprint dlq ...       list, show, replay and delete dead-lettered events
+//	blueprint backfill ...  republish historical events at a bounded rate
+//	blueprint selftest      check redis, postgres, migrations and locales, report as JSON
  
 func main() {
 
+	if len(os.Args) > 1 {
+		os.Exit(command(os.Args[1:]))
+	}
+
 	app.Start()
 
-}
\ No newline at end of file
+}
+
+func command(args []string) int {
+	switch {
+	case len(args) == 2 && args[0] == "config" && args[1] == "print":
+		return printConfig()
+	case args[0] == "dlq":
+		return dlq(args[1:], os.Stdout, os.Stderr)
+	case args[0] == "backfill":
+		return backfill(args[1:], os.Stdout, os.Stderr)
+	case args[0] == "selftest":
+		return runSelftest(args[1:], os.Stdout, os.Stderr)
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\nusage: blueprint [config print | dlq ... | backfill ... | selftest]\n", args)
+	return 2
+}
+
+// printConfig still prints when validation fails so the broken values can be seen
+func printConfig() int {
+	c, err := config.Load()
+	if perr := config.Print(os.Stdout, c); perr != nil {
+		fmt.Fprintln(os.Stderr, perr)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/cache"
+	"blueprint/pkg/compress"
+	"blueprint/pkg/db"
+	"blueprint/pkg/redis"
+	"blueprint/pkg/selftest"
+
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// selftestReport is selftest.Report with what was tested
+type selftestReport struct {
+	Version string `json:"version,omitempty"`
+	selftest.Report
+}
+
+// runSelftest checks everything the service needs, with its own config, and
+// prints the report as JSON. It exits 0 when nothing failed, so it can gate
+// a rollout from an init container.
+func runSelftest(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	timeout := fs.Duration("timeout", 10*time.Second, "deadline of each check")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// no loggers below, stdout is the report and nothing else
+	cfg, cfgErr := config.Load()
+	var (
+		rdb *redis.RedisClient
+		pg  *db.PostgresDB
+	)
+	defer func() {
+		if rdb != nil {
+			rdb.Close()
+		}
+		if pg != nil {
+			pg.Close()
+		}
+	}()
+
+	report := selftest.Run(context.Background(), *timeout,
+		selftest.Check{Name: "config", Run: func(ctx context.Context) (interface{}, error) {
+			return nil, cfgErr
+		}},
+		selftest.Check{Name: "redis", Needs: "config", Run: func(ctx context.Context) (interface{}, error) {
+			var err error
+			if rdb, err = redis.NewRedisClient(cfg, nil); err != nil {
+				return nil, err
+			}
+			return map[string]string{"addr": cfg.Redis.RedisAddr}, rdb.Ping(ctx)
+		}},
+		selftest.Check{Name: "cache", Needs: "redis", Run: func(ctx context.Context) (interface{}, error) {
+			compression, err := compress.FromConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			codec, err := compress.New(compression.Cache, compression.CacheLevel)
+			if err != nil {
+				return nil, err
+			}
+			return selftest.CacheCycle(ctx, cache.NewCacheWithOptions(rdb.GetClient(), cache.Options{
+				Compression:      codec,
+				CompressMinBytes: compression.CacheMinBytes,
+			}))
+		}},
+		selftest.Check{Name: "postgres", Needs: "config", Run: func(ctx context.Context) (interface{}, error) {
+			opts, err := db.OptionsFromConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			// gorm logs to stdout
+			opts.LogLevel = gormlogger.Silent
+			if pg, err = db.NewPostgresDBWithOptions(cfg, opts); err != nil {
+				return nil, err
+			}
+			return map[string]string{"host": cfg.Postgres.PostgresHost}, pg.Ping(ctx)
+		}},
+		selftest.Check{Name: "postgres_transaction", Needs: "postgres", Run: func(ctx context.Context) (interface{}, error) {
+			return selftest.Transaction(ctx, pg.DB)
+		}},
+		selftest.Check{Name: "migrations", Needs: "postgres", Run: func(ctx context.Context) (interface{}, error) {
+			return selftest.Migrations(ctx, pg.DB)
+		}},
+		selftest.Check{Name: "locales", Needs: "config", Run: func(ctx context.Context) (interface{}, error) {
+			return selftest.Locales(cfg.Setting.LocalPath, "en-US")
+		}},
+	)
+
+	out := selftestReport{Report: report}
+	if cfg != nil {
+		out.Version = cfg.Setting.Version
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
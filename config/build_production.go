@@ -0,0 +1,8 @@
+//go:build production
+
+// By Emran A. Hamdan, Lead Architect
+package config
+
+// ProductionBuild is set by building with -tags production, it turns every
+// Debug feature off whatever the env says
+const ProductionBuild = true
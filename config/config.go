@@ -2,7 +2,6 @@
 package config
 // Config will use .ENV for docker-compose and load into config
 import (
-	"fmt"
 	"os"
 	"time"
 )
@@ -23,19 +22,321 @@ const (
 
 )
 
+// Optional env vars, service runs with defaults when they are not set
+const (
+	DISCOVERY_BACKEND = "DISCOVERY_BACKEND"
+	DISCOVERY_ADDR    = "DISCOVERY_ADDR"
+	DISCOVERY_TTL     = "DISCOVERY_TTL"
+
+	// Kubernetes downward API and pod lifecycle
+	POD_NAME                 = "POD_NAME"
+	POD_NAMESPACE            = "POD_NAMESPACE"
+	NODE_NAME                = "NODE_NAME"
+	POD_IP                   = "POD_IP"
+	PROBE_PORT               = "PROBE_PORT"
+	PRESTOP_DELAY            = "PRESTOP_DELAY"
+	TERMINATION_GRACE_PERIOD = "TERMINATION_GRACE_PERIOD"
+
+	CRASH_GOROUTINE_DUMP = "CRASH_GOROUTINE_DUMP"
+
+	LOG_ASYNC        = "LOG_ASYNC"
+	LOG_ASYNC_BUFFER = "LOG_ASYNC_BUFFER"
+	LOG_ROTATE       = "LOG_ROTATE"
+	LOG_MAX_TOTAL_MB = "LOG_MAX_TOTAL_MB"
+	LOG_LEVELS       = "LOG_LEVELS"
+
+	APP_ENV                    = "APP_ENV"
+	// low-latency or throughput defaults, see Profiles
+	TUNING_PROFILE             = "TUNING_PROFILE"
+	SENTRY_DSN                 = "SENTRY_DSN"
+	ERROR_WEBHOOK_URL          = "ERROR_WEBHOOK_URL"
+	ERROR_TRACKING_SAMPLE_RATE = "ERROR_TRACKING_SAMPLE_RATE"
+
+	// pools and timeouts, zero keeps the package defaults
+	REDIS_DB            = "REDIS_DB"
+	REDIS_POOL_SIZE     = "REDIS_POOL_SIZE"
+	REDIS_MIN_IDLE_CONN = "REDIS_MIN_IDLE_CONN"
+	REDIS_POOL_TIMEOUT  = "REDIS_POOL_TIMEOUT"
+	REDIS_DIAL_TIMEOUT  = "REDIS_DIAL_TIMEOUT"
+	REDIS_READ_TIMEOUT  = "REDIS_READ_TIMEOUT"
+	REDIS_WRITE_TIMEOUT = "REDIS_WRITE_TIMEOUT"
+	REDIS_MAX_RETRIES   = "REDIS_MAX_RETRIES"
+
+	// sentinel mode, set the addrs to let sentinel pick the master
+	REDIS_SENTINEL_ADDRS    = "REDIS_SENTINEL_ADDRS"
+	REDIS_SENTINEL_MASTER   = "REDIS_SENTINEL_MASTER"
+	REDIS_SENTINEL_PASSWORD = "REDIS_SENTINEL_PASSWORD"
+	REDIS_SENTINEL_POLL     = "REDIS_SENTINEL_POLL"
+	REDIS_SENTINEL_MAX_LAG  = "REDIS_SENTINEL_MAX_LAG"
+
+	// commands taking at least this long are logged, 0 disables
+	REDIS_SLOW_THRESHOLD = "REDIS_SLOW_THRESHOLD"
+	// how often an idle redis connection is probed for loss
+	REDIS_HEALTH_INTERVAL = "REDIS_HEALTH_INTERVAL"
+	// how often INFO is read for the stats the client exposes, 0 disables
+	REDIS_STATS_INTERVAL = "REDIS_STATS_INTERVAL"
+	// a max above 0 lets the pool size follow load between min and max
+	REDIS_POOL_MIN_SIZE = "REDIS_POOL_MIN_SIZE"
+	REDIS_POOL_MAX_SIZE = "REDIS_POOL_MAX_SIZE"
+
+	POSTGRES_MAX_IDLE_CONNS     = "POSTGRES_MAX_IDLE_CONNS"
+	POSTGRES_MAX_OPEN_CONNS     = "POSTGRES_MAX_OPEN_CONNS"
+	POSTGRES_CONN_MAX_LIFETIME  = "POSTGRES_CONN_MAX_LIFETIME"
+	POSTGRES_CONN_MAX_IDLE_TIME = "POSTGRES_CONN_MAX_IDLE_TIME"
+	// a max above 0 lets max open conns follow load between min and max
+	POSTGRES_MIN_OPEN_CONNS_TUNED = "POSTGRES_MIN_OPEN_CONNS_TUNED"
+	POSTGRES_MAX_OPEN_CONNS_TUNED = "POSTGRES_MAX_OPEN_CONNS_TUNED"
+
+	// where postgres credentials come from, see Postgres.Credentials
+	POSTGRES_CREDENTIALS         = "POSTGRES_CREDENTIALS"
+	POSTGRES_CREDENTIALS_REFRESH = "POSTGRES_CREDENTIALS_REFRESH"
+	POSTGRES_PASSWORD_FILE       = "POSTGRES_PASSWORD_FILE"
+	POSTGRES_VAULT_PATH          = "POSTGRES_VAULT_PATH"
+	VAULT_ADDR                   = "VAULT_ADDR"
+	VAULT_TOKEN                  = "VAULT_TOKEN"
+	VAULT_TOKEN_FILE             = "VAULT_TOKEN_FILE"
+	AWS_REGION                   = "AWS_REGION"
+
+	// postgres TLS, off by default, see Postgres.SSLMode
+	POSTGRES_SSLMODE         = "POSTGRES_SSLMODE"
+	POSTGRES_SSLROOTCERT     = "POSTGRES_SSLROOTCERT"
+	POSTGRES_SSLCERT         = "POSTGRES_SSLCERT"
+	POSTGRES_SSLKEY          = "POSTGRES_SSLKEY"
+	POSTGRES_SSLKEY_PASSWORD = "POSTGRES_SSLKEY_PASSWORD"
+
+	// slow query log, optionally with the plan
+	POSTGRES_SLOW_THRESHOLD = "POSTGRES_SLOW_THRESHOLD"
+	POSTGRES_EXPLAIN_SLOW   = "POSTGRES_EXPLAIN_SLOW"
+
+	// queries per call, see Postgres.QueryBudget
+	POSTGRES_QUERY_BUDGET        = "POSTGRES_QUERY_BUDGET"
+	POSTGRES_QUERY_BUDGETS       = "POSTGRES_QUERY_BUDGETS"
+	POSTGRES_QUERY_BUDGET_REJECT = "POSTGRES_QUERY_BUDGET_REJECT"
+
+	// prepared statement cache, see Postgres.StmtCacheSize
+	POSTGRES_STMT_CACHE_SIZE = "POSTGRES_STMT_CACHE_SIZE"
+	POSTGRES_STMT_CACHE_TTL  = "POSTGRES_STMT_CACHE_TTL"
+
+	// sqlcommenter comments on every statement, see Postgres.QueryComment
+	POSTGRES_QUERY_COMMENT = "POSTGRES_QUERY_COMMENT"
+
+	GRPC_MAX_CONNECTION_IDLE = "GRPC_MAX_CONNECTION_IDLE"
+	GRPC_MAX_CONNECTION_AGE  = "GRPC_MAX_CONNECTION_AGE"
+	GRPC_KEEPALIVE_TIMEOUT   = "GRPC_KEEPALIVE_TIMEOUT"
+
+	// gRPC keepalive and server limits
+	GRPC_MAX_CONNECTION_AGE_GRACE = "GRPC_MAX_CONNECTION_AGE_GRACE"
+	GRPC_KEEPALIVE_TIME           = "GRPC_KEEPALIVE_TIME"
+	GRPC_KEEPALIVE_MIN_TIME       = "GRPC_KEEPALIVE_MIN_TIME"
+	GRPC_PERMIT_WITHOUT_STREAM    = "GRPC_PERMIT_WITHOUT_STREAM"
+	GRPC_MAX_CONCURRENT_STREAMS   = "GRPC_MAX_CONCURRENT_STREAMS"
+	GRPC_CONNECTION_TIMEOUT       = "GRPC_CONNECTION_TIMEOUT"
+	GRPC_MAX_RECV_MSG_SIZE        = "GRPC_MAX_RECV_MSG_SIZE"
+	GRPC_MAX_SEND_MSG_SIZE        = "GRPC_MAX_SEND_MSG_SIZE"
+
+	// extra gRPC listeners, e.g. for an envoy sidecar on a unix socket
+	GRPC_LISTEN_ADDRS     = "GRPC_LISTEN_ADDRS"
+	GRPC_UNIX_SOCKET      = "GRPC_UNIX_SOCKET"
+	GRPC_UNIX_SOCKET_MODE = "GRPC_UNIX_SOCKET_MODE"
+
+	// extra listeners next to gRPC, empty leaves them off
+	HTTP_PORT    = "HTTP_PORT"
+	METRICS_PORT = "METRICS_PORT"
+	DEBUG_PORT   = "DEBUG_PORT"
+
+	// opt-in request/response payload logging, meant for staging
+	PAYLOAD_LOG_SAMPLE_RATE = "PAYLOAD_LOG_SAMPLE_RATE"
+	PAYLOAD_LOG_METHODS     = "PAYLOAD_LOG_METHODS"
+	PAYLOAD_LOG_REDACT      = "PAYLOAD_LOG_REDACT"
+	PAYLOAD_LOG_MAX_BYTES   = "PAYLOAD_LOG_MAX_BYTES"
+
+	// gRPC response caching, see ResponseCache
+	RESPONSE_CACHE_ENABLED       = "RESPONSE_CACHE_ENABLED"
+	RESPONSE_CACHE_POLICIES      = "RESPONSE_CACHE_POLICIES"
+	RESPONSE_CACHE_BYPASS_HEADER = "RESPONSE_CACHE_BYPASS_HEADER"
+
+	// request values every cache key is scoped by: tenant, user, locale
+	CACHE_KEY_SCOPE = "CACHE_KEY_SCOPE"
+	// ttl of entries written without one
+	CACHE_TTL = "CACHE_TTL"
+	// how long past its ttl Fetch may serve an entry while refreshing it
+	CACHE_STALE_WINDOW = "CACHE_STALE_WINDOW"
+	// reads after a write in the same call skip the cache, see consistency
+	CACHE_READ_YOUR_WRITES = "CACHE_READ_YOUR_WRITES"
+	// serve without redis while it is unreachable, see Cache.Optional
+	CACHE_OPTIONAL = "CACHE_OPTIONAL"
+
+	// client address allow/deny lists, see NetACL
+	NETACL_ALLOW           = "NETACL_ALLOW"
+	NETACL_DENY            = "NETACL_DENY"
+	NETACL_FILE            = "NETACL_FILE"
+	NETACL_TRUSTED_PROXIES = "NETACL_TRUSTED_PROXIES"
+	NETACL_RELOAD          = "NETACL_RELOAD"
+
+	// per method rate limits in this replica, see RateLimit
+	RATE_LIMIT_ENABLED  = "RATE_LIMIT_ENABLED"
+	RATE_LIMIT_POLICIES = "RATE_LIMIT_POLICIES"
+	RATE_LIMIT_WARN_AT  = "RATE_LIMIT_WARN_AT"
+
+	// per caller cap on calls in flight, see Concurrency
+	CONCURRENCY_LIMIT     = "CONCURRENCY_LIMIT"
+	CONCURRENCY_KEY       = "CONCURRENCY_KEY"
+	CONCURRENCY_STORE     = "CONCURRENCY_STORE"
+	CONCURRENCY_LEASE_TTL = "CONCURRENCY_LEASE_TTL"
+	CONCURRENCY_EXEMPT    = "CONCURRENCY_EXEMPT"
+
+	// per API key call quotas in redis, both limits 0 disables them
+	QUOTA_DAILY_LIMIT   = "QUOTA_DAILY_LIMIT"
+	QUOTA_MONTHLY_LIMIT = "QUOTA_MONTHLY_LIMIT"
+	QUOTA_KEY_HEADER    = "QUOTA_KEY_HEADER"
+
+	// hedged reads in the handler path, 0 percentile disables them
+	HEDGE_PERCENTILE = "HEDGE_PERCENTILE"
+	HEDGE_BUDGET     = "HEDGE_BUDGET"
+	HEDGE_MAX_DELAY  = "HEDGE_MAX_DELAY"
+
+	// adaptive concurrency limit of unary calls, off by default
+	LOAD_SHED_ENABLED       = "LOAD_SHED_ENABLED"
+	LOAD_SHED_INITIAL_LIMIT = "LOAD_SHED_INITIAL_LIMIT"
+	LOAD_SHED_MIN_LIMIT     = "LOAD_SHED_MIN_LIMIT"
+	LOAD_SHED_MAX_LIMIT     = "LOAD_SHED_MAX_LIMIT"
+	LOAD_SHED_EXEMPT        = "LOAD_SHED_EXEMPT"
+
+	// which calls are shed first, see LoadShed
+	LOAD_SHED_CRITICAL        = "LOAD_SHED_CRITICAL"
+	LOAD_SHED_BACKGROUND      = "LOAD_SHED_BACKGROUND"
+	LOAD_SHED_PRIORITY_HEADER = "LOAD_SHED_PRIORITY_HEADER"
+
+	// time-series table retention, no policies disables it
+	RETENTION_POLICIES    = "RETENTION_POLICIES"
+	RETENTION_INTERVAL    = "RETENTION_INTERVAL"
+	RETENTION_BATCH_SIZE  = "RETENTION_BATCH_SIZE"
+	RETENTION_BATCH_PAUSE = "RETENTION_BATCH_PAUSE"
+
+	// time-range partitions created ahead, no policies disables it
+	PARTITION_POLICIES = "PARTITION_POLICIES"
+	PARTITION_INTERVAL = "PARTITION_INTERVAL"
+
+	// start without the cache when redis is down, see Startup
+	STARTUP_DEGRADED = "STARTUP_DEGRADED"
+
+	// connections and cache keys warmed up before readiness, see Warmup
+	WARMUP_ENABLED    = "WARMUP_ENABLED"
+	WARMUP_DB_CONNS   = "WARMUP_DB_CONNS"
+	WARMUP_CACHE_KEYS = "WARMUP_CACHE_KEYS"
+	WARMUP_TIMEOUT    = "WARMUP_TIMEOUT"
+
+	// operational notifications, each channel is on once its target is set
+	NOTIFY_SMTP_ADDR        = "NOTIFY_SMTP_ADDR"
+	NOTIFY_SMTP_USER        = "NOTIFY_SMTP_USER"
+	NOTIFY_SMTP_PASSWORD    = "NOTIFY_SMTP_PASSWORD"
+	NOTIFY_SMTP_FROM        = "NOTIFY_SMTP_FROM"
+	NOTIFY_SMTP_TO          = "NOTIFY_SMTP_TO"
+	NOTIFY_SLACK_WEBHOOK    = "NOTIFY_SLACK_WEBHOOK"
+	NOTIFY_TELEGRAM_TOKEN   = "NOTIFY_TELEGRAM_TOKEN"
+	NOTIFY_TELEGRAM_CHAT_ID = "NOTIFY_TELEGRAM_CHAT_ID"
+	NOTIFY_SMS_URL          = "NOTIFY_SMS_URL"
+	NOTIFY_SMS_TOKEN        = "NOTIFY_SMS_TOKEN"
+	NOTIFY_SMS_TO           = "NOTIFY_SMS_TO"
+	NOTIFY_RATE_LIMIT       = "NOTIFY_RATE_LIMIT"
+	NOTIFY_LOCALE           = "NOTIFY_LOCALE"
+
+	// dependency health states, see Health
+	HEALTH_CONFIRM         = "HEALTH_CONFIRM"
+	HEALTH_NOTIFY_INTERVAL = "HEALTH_NOTIFY_INTERVAL"
+
+	// maintenance mode, see Maintenance
+	MAINTENANCE_KEY           = "MAINTENANCE_KEY"
+	MAINTENANCE_POLL_INTERVAL = "MAINTENANCE_POLL_INTERVAL"
+	MAINTENANCE_RETRY_AFTER   = "MAINTENANCE_RETRY_AFTER"
+	MAINTENANCE_READ_ONLY     = "MAINTENANCE_READ_ONLY"
+
+	// event bus, an empty backend disables it
+	EVENTBUS_BACKEND              = "EVENTBUS_BACKEND"
+	EVENTBUS_KAFKA_BROKERS        = "EVENTBUS_KAFKA_BROKERS"
+	EVENTBUS_STREAM_MAXLEN        = "EVENTBUS_STREAM_MAXLEN"
+	EVENTBUS_MAX_DELIVERIES       = "EVENTBUS_MAX_DELIVERIES"
+	EVENTBUS_REDELIVERY           = "EVENTBUS_REDELIVERY"
+	EVENTBUS_FORMAT               = "EVENTBUS_FORMAT"
+	EVENTBUS_SCHEMA_COMPATIBILITY = "EVENTBUS_SCHEMA_COMPATIBILITY"
+	EVENTBUS_DEADLETTER_STORE     = "EVENTBUS_DEADLETTER_STORE"
+	EVENTBUS_DEADLETTER_MAXLEN    = "EVENTBUS_DEADLETTER_MAXLEN"
+
+	// garbage collector settings, GOGC and GOMEMLIMIT win when set
+	RUNTIME_GC_PERCENT         = "RUNTIME_GC_PERCENT"
+	RUNTIME_MEMORY_LIMIT       = "RUNTIME_MEMORY_LIMIT"
+	RUNTIME_MEMORY_LIMIT_RATIO = "RUNTIME_MEMORY_LIMIT_RATIO"
+	RUNTIME_BALLAST            = "RUNTIME_BALLAST"
+
+	// archived log and cache value compression, see Compression
+	COMPRESSION_PRESET       = "COMPRESSION_PRESET"
+	LOG_COMPRESSION          = "LOG_COMPRESSION"
+	LOG_COMPRESSION_LEVEL    = "LOG_COMPRESSION_LEVEL"
+	CACHE_COMPRESSION        = "CACHE_COMPRESSION"
+	CACHE_COMPRESSION_LEVEL  = "CACHE_COMPRESSION_LEVEL"
+	CACHE_COMPRESS_MIN_BYTES = "CACHE_COMPRESS_MIN_BYTES"
+
+	// AdminService listener, off without a port, the token is required with it
+	ADMIN_GRPC_PORT = "ADMIN_GRPC_PORT"
+	ADMIN_TOKEN     = "ADMIN_TOKEN"
+
+	// developer features, default on outside production, see Debug
+	GRPC_REFLECTION = "GRPC_REFLECTION"
+	VERBOSE_ERRORS  = "VERBOSE_ERRORS"
+	DEBUG_ENDPOINTS = "DEBUG_ENDPOINTS"
+	API_DOCS        = "API_DOCS"
+
+	// fault injection for resilience tests, see Faults
+	FAULT_INJECTION = "FAULT_INJECTION"
+	FAULT_RULES     = "FAULT_RULES"
+
+	// ENV_FILE is the dotenv file read before anything else, see LoadDotEnv
+	ENV_FILE = "ENV_FILE"
+)
+
 // Config blueprint microservice
 type Config struct {
-	Setting  Setting
-	GRPC     GRPC
-	Logger   Logger
-	Redis    Redis
-	Postgres Postgres
+	Setting   Setting
+	GRPC      GRPC
+	HTTP      HTTP
+	Logger    Logger
+	Redis     Redis
+	Postgres  Postgres
+	Discovery Discovery
+	Kube      Kube
+	Crash     Crash
+
+	ErrorTracking ErrorTracking
+	PayloadLog    PayloadLog
+	ResponseCache ResponseCache
+	Cache         Cache
+	NetACL        NetACL
+	RateLimit     RateLimit
+	Concurrency   Concurrency
+	Quota         Quota
+	Hedge         Hedge
+	LoadShed      LoadShed
+	Retention     Retention
+	Partition     Partition
+	Startup       Startup
+	Warmup        Warmup
+	Notify        Notify
+	Health        Health
+	Maintenance   Maintenance
+	EventBus      EventBus
+	Runtime       Runtime
+	Compression   Compression
+	Admin         Admin
+	Debug         Debug
+	Faults        Faults
 }
 
 type Setting struct {
 	Version string 
 	LocalPath string 
-	
+	Environment string `env:"APP_ENV" validate:"required,oneof=development staging production"`
+	// Profile names the Profiles entry the defaults came from
+	Profile string `env:"TUNING_PROFILE" validate:"oneof=low-latency throughput"`
 }
 
 // Logger config
@@ -45,18 +346,47 @@ type Logger struct {
 	Encoding          string
 	Level             string
 	LogFile           string
+	Async             bool   `env:"LOG_ASYNC"`
+	AsyncBufferSize   int    `env:"LOG_ASYNC_BUFFER" validate:"min=0"`
+	RotateInterval    string `env:"LOG_ROTATE" validate:"oneof=hourly daily"`
+	MaxTotalSize      int    `env:"LOG_MAX_TOTAL_MB" validate:"min=0"`
+	ModuleLevels      string `env:"LOG_LEVELS"`
 }
 
 // Redis config
 type Redis struct {
-	RedisAddr      string
-	RedisPassword  string
+	RedisAddr      string `env:"REDIS_URL" validate:"required,hostport"`
+	RedisPassword  string `env:"REDIS_PASSWORD" validate:"required" secret:"true"`
 	RedisDB        string
 	RedisDefaultDB string
-	MinIdleConn    int
-	PoolSize       int
-	PoolTimeout    int
-	DB             int
+	MinIdleConn    int           `env:"REDIS_MIN_IDLE_CONN" validate:"min=0"`
+	PoolSize       int           `env:"REDIS_POOL_SIZE" validate:"min=0"`
+	PoolTimeout    time.Duration `env:"REDIS_POOL_TIMEOUT" validate:"min=0s"`
+	DialTimeout    time.Duration `env:"REDIS_DIAL_TIMEOUT" validate:"min=0s"`
+	ReadTimeout    time.Duration `env:"REDIS_READ_TIMEOUT" validate:"min=0s"`
+	WriteTimeout   time.Duration `env:"REDIS_WRITE_TIMEOUT" validate:"min=0s"`
+	MaxRetries     int           `env:"REDIS_MAX_RETRIES" validate:"min=0"`
+	DB             int           `env:"REDIS_DB" validate:"min=0,max=15"`
+
+	// SentinelAddrs switches to a sentinel managed master named
+	// SentinelMaster, RedisAddr is ignored then. SentinelPoll is how often
+	// the master and replica lag are checked, SentinelMaxLag in bytes fails
+	// readiness when a replica falls further behind, 0 only reports it.
+	SentinelAddrs    []string      `env:"REDIS_SENTINEL_ADDRS" validate:"hostport"`
+	SentinelMaster   string        `env:"REDIS_SENTINEL_MASTER"`
+	SentinelPassword string        `env:"REDIS_SENTINEL_PASSWORD" secret:"true"`
+	SentinelPoll     time.Duration `env:"REDIS_SENTINEL_POLL" validate:"min=1s"`
+	SentinelMaxLag   int           `env:"REDIS_SENTINEL_MAX_LAG" validate:"min=0"`
+
+	// SlowThreshold logs commands that take at least this long, 0 disables
+	SlowThreshold time.Duration `env:"REDIS_SLOW_THRESHOLD" validate:"min=0s"`
+	// HealthInterval is how often the connection is probed while idle
+	HealthInterval time.Duration `env:"REDIS_HEALTH_INTERVAL" validate:"min=1s"`
+	// StatsInterval is how often INFO is read into GetStats, 0 disables
+	StatsInterval time.Duration `env:"REDIS_STATS_INTERVAL" validate:"min=0s"`
+	// PoolMaxSize above 0 auto tunes the pool between PoolMinSize and it
+	PoolMinSize int `env:"REDIS_POOL_MIN_SIZE" validate:"min=0"`
+	PoolMaxSize int `env:"REDIS_POOL_MAX_SIZE" validate:"min=0"`
 }
 
 // Mongo
@@ -68,78 +398,579 @@ type Mongo struct {
 
 // Postgres config
 type Postgres struct {
-	PostgresHost     string
-	PostgresPort     string
-	PostgresUser     string
-	PostgresPassword string
-	PostgresDBName   string
+	PostgresHost     string `env:"POSTGRES_HOST" validate:"required"`
+	PostgresPort     string `env:"POSTGRES_PORT" validate:"required,port"`
+	PostgresUser     string `env:"POSTGRES_USER" validate:"required"`
+	// PostgresPassword is required with static credentials only
+	PostgresPassword string `env:"POSTGRES_PASSWORD" secret:"true"`
+	PostgresDBName   string `env:"POSTGRES_DB" validate:"required"`
+
+	// Credentials is where the user and password come from: static
+	// (PostgresUser/PostgresPassword), file (PasswordFile, re-read when it
+	// changes), vault (dynamic secrets at VaultPath) or rds-iam (IAM auth
+	// tokens for PostgresUser in AWSRegion, signed with the keys of the AWS
+	// default credential chain). They are checked every
+	// CredentialsRefresh and pooled connections recycled when they change.
+	Credentials        string        `env:"POSTGRES_CREDENTIALS" validate:"oneof=static file vault rds-iam"`
+	CredentialsRefresh time.Duration `env:"POSTGRES_CREDENTIALS_REFRESH" validate:"min=1s"`
+	PasswordFile       string        `env:"POSTGRES_PASSWORD_FILE" validate:"file"`
+	VaultAddr          string        `env:"VAULT_ADDR" validate:"url"`
+	VaultToken         string        `env:"VAULT_TOKEN" secret:"true"`
+	VaultTokenFile     string        `env:"VAULT_TOKEN_FILE" validate:"file"`
+	VaultPath          string        `env:"POSTGRES_VAULT_PATH"`
+	AWSRegion          string        `env:"AWS_REGION"`
+
+	MaxIdleConns    int           `env:"POSTGRES_MAX_IDLE_CONNS" validate:"min=0"`
+	MaxOpenConns    int           `env:"POSTGRES_MAX_OPEN_CONNS" validate:"min=0"`
+	ConnMaxLifetime time.Duration `env:"POSTGRES_CONN_MAX_LIFETIME" validate:"min=0s"`
+	ConnMaxIdleTime time.Duration `env:"POSTGRES_CONN_MAX_IDLE_TIME" validate:"min=0s"`
+	// MaxOpenConnsTuned above 0 auto tunes max open conns between
+	// MinOpenConnsTuned and it, starting at MaxOpenConns
+	MinOpenConnsTuned int `env:"POSTGRES_MIN_OPEN_CONNS_TUNED" validate:"min=0"`
+	MaxOpenConnsTuned int `env:"POSTGRES_MAX_OPEN_CONNS_TUNED" validate:"min=0"`
+
+	// SSLMode as in libpq, empty is disable. require encrypts without
+	// checking the server, verify-ca checks its certificate against
+	// SSLRootCert (the system roots when empty) and verify-full its host
+	// name too. SSLCert and SSLKey are the client certificate, PEM files.
+	SSLMode        string `env:"POSTGRES_SSLMODE" validate:"oneof=disable allow prefer require verify-ca verify-full"`
+	SSLRootCert    string `env:"POSTGRES_SSLROOTCERT" validate:"file"`
+	SSLCert        string `env:"POSTGRES_SSLCERT" validate:"file"`
+	SSLKey         string `env:"POSTGRES_SSLKEY" validate:"file"`
+	SSLKeyPassword string `env:"POSTGRES_SSLKEY_PASSWORD" secret:"true"`
+
+	// SlowThreshold logs queries that take at least this long, 0 disables.
+	// ExplainSlow adds their EXPLAIN plan, fetched in the background.
+	SlowThreshold time.Duration `env:"POSTGRES_SLOW_THRESHOLD" validate:"min=0s"`
+	ExplainSlow   bool          `env:"POSTGRES_EXPLAIN_SLOW"`
+
+	// QueryBudget is how many queries one unary call may run before it is
+	// logged, 0 disables. QueryBudgets override it per method, each
+	// "method=limit" with method as in PayloadLog.Methods. QueryBudgetReject
+	// fails the queries over budget with ResourceExhausted instead.
+	QueryBudget       int      `env:"POSTGRES_QUERY_BUDGET" validate:"min=0"`
+	QueryBudgets      []string `env:"POSTGRES_QUERY_BUDGETS"`
+	QueryBudgetReject bool     `env:"POSTGRES_QUERY_BUDGET_REJECT"`
+
+	// StmtCacheSize caps the prepared statements gorm keeps, 1000 when 0;
+	// StmtCacheTTL closes those unused that long, 1h when 0
+	StmtCacheSize int           `env:"POSTGRES_STMT_CACHE_SIZE" validate:"min=0"`
+	StmtCacheTTL  time.Duration `env:"POSTGRES_STMT_CACHE_TTL" validate:"min=0s"`
+
+	// QueryComment tags every statement with a sqlcommenter comment, empty
+	// or off for none. route names the service and the RPC, the same for
+	// every call so statements are still prepared once. trace adds the
+	// request and trace id, user, tenant and client version of the call;
+	// every call's SQL is then distinct, so statements are sent unprepared.
+	QueryComment string `env:"POSTGRES_QUERY_COMMENT" validate:"oneof=off route trace"`
+}
+
+// Discovery service registry config, Backend is consul or etcd, empty disables registration
+type Discovery struct {
+	Backend string        `env:"DISCOVERY_BACKEND" validate:"oneof=consul etcd"`
+	Addr    string        `env:"DISCOVERY_ADDR"`
+	TTL     time.Duration `env:"DISCOVERY_TTL" validate:"min=1s"`
 }
 
-// GRPC gRPC service config
+// Kube pod metadata from the downward API and lifecycle timings
+type Kube struct {
+	PodName          string        `env:"POD_NAME"`
+	Namespace        string        `env:"POD_NAMESPACE"`
+	NodeName         string        `env:"NODE_NAME"`
+	PodIP            string        `env:"POD_IP"`
+	ProbePort        string        `env:"PROBE_PORT" validate:"required,port"`
+	PreStopDelay     time.Duration `env:"PRESTOP_DELAY" validate:"min=0s"`
+	TerminationGrace time.Duration `env:"TERMINATION_GRACE_PERIOD" validate:"min=0s"`
+}
+
+// Crash report config
+type Crash struct {
+	GoroutineDump bool `env:"CRASH_GOROUTINE_DUMP"`
+}
+
+// ErrorTracking sink config, SentryDSN wins over WebhookURL, both empty disables it
+type ErrorTracking struct {
+	SentryDSN  string  `env:"SENTRY_DSN" validate:"url" secret:"true"`
+	WebhookURL string  `env:"ERROR_WEBHOOK_URL" validate:"url" secret:"true"`
+	SampleRate float64 `env:"ERROR_TRACKING_SAMPLE_RATE" validate:"min=0,max=1"`
+}
+
+// GRPC gRPC service config, keepalive Timeout/Time are the server pings and
+// KeepaliveMinTime is how often clients may ping us before being cut off
 type GRPC struct {
-	Host              string
-	Port              string
-	MaxConnectionIdle time.Duration
-	Timeout           time.Duration
-	MaxConnectionAge  time.Duration
+	Host              string `env:"GPRC_HOST" validate:"required"`
+	Port              string `env:"GRPC_PORT" validate:"required,port"`
+	MaxConnectionIdle time.Duration `env:"GRPC_MAX_CONNECTION_IDLE" validate:"min=0s"`
+	Timeout           time.Duration `env:"GRPC_KEEPALIVE_TIMEOUT" validate:"required,min=1ms"`
+	MaxConnectionAge  time.Duration `env:"GRPC_MAX_CONNECTION_AGE" validate:"min=0s"`
+
+	MaxConnectionAgeGrace time.Duration `env:"GRPC_MAX_CONNECTION_AGE_GRACE" validate:"min=0s"`
+	KeepaliveTime         time.Duration `env:"GRPC_KEEPALIVE_TIME" validate:"required,min=1s"`
+	KeepaliveMinTime      time.Duration `env:"GRPC_KEEPALIVE_MIN_TIME" validate:"min=0s"`
+	PermitWithoutStream   bool          `env:"GRPC_PERMIT_WITHOUT_STREAM"`
+	// MaxConcurrentStreams per connection, 0 leaves it unlimited
+	MaxConcurrentStreams int           `env:"GRPC_MAX_CONCURRENT_STREAMS" validate:"min=0,max=4294967295"`
+	ConnectionTimeout    time.Duration `env:"GRPC_CONNECTION_TIMEOUT" validate:"required,min=1s"`
+	MaxRecvMsgSize       int           `env:"GRPC_MAX_RECV_MSG_SIZE" validate:"min=0"`
+	MaxSendMsgSize       int           `env:"GRPC_MAX_SEND_MSG_SIZE" validate:"min=0"`
+
+	// ListenAddrs replaces ":Port" with one or more tcp addresses, e.g.
+	// "0.0.0.0:3000,[::1]:3000", Port is still what discovery advertises
+	ListenAddrs    []string    `env:"GRPC_LISTEN_ADDRS" validate:"hostport"`
+	UnixSocket     string      `env:"GRPC_UNIX_SOCKET"`
+	UnixSocketMode os.FileMode `env:"GRPC_UNIX_SOCKET_MODE" validate:"max=511"`
+}
+
+// PayloadLog logs full request/response payloads of the listed methods and
+// a sampled share of all other calls, empty RedactFields keeps the defaults
+type PayloadLog struct {
+	SampleRate   float64  `env:"PAYLOAD_LOG_SAMPLE_RATE" validate:"min=0,max=1"`
+	Methods      []string `env:"PAYLOAD_LOG_METHODS"`
+	RedactFields []string `env:"PAYLOAD_LOG_REDACT"`
+	MaxBytes     int      `env:"PAYLOAD_LOG_MAX_BYTES" validate:"min=0"`
+}
+
+// ResponseCache keeps successful unary responses in redis. Each policy is
+// "method=ttl[:field|field]", method as in PayloadLog.Methods and the
+// fields of the request that make up the key, no fields keys on the whole
+// request. A call carrying BypassHeader skips the lookup but still refreshes
+// the entry.
+type ResponseCache struct {
+	Enabled      bool     `env:"RESPONSE_CACHE_ENABLED"`
+	Policies     []string `env:"RESPONSE_CACHE_POLICIES"`
+	BypassHeader string   `env:"RESPONSE_CACHE_BYPASS_HEADER"`
+}
+
+// Cache settings shared by every user of the redis cache. KeyScope adds
+// the caller's tenant (x-tenant-id), user (x-user-id) or locale
+// (accept-language) to each key so their entries never collide.
+type Cache struct {
+	KeyScope []string `env:"CACHE_KEY_SCOPE" validate:"oneof=tenant user locale"`
+	// TTL of entries written without one, 0 keeps the cache's hour
+	TTL time.Duration `env:"CACHE_TTL" validate:"min=0s"`
+	// StaleWindow serves expiring entries from Cache.Fetch while a loader
+	// refreshes them in the background, 0 disables
+	StaleWindow time.Duration `env:"CACHE_STALE_WINDOW" validate:"min=0s"`
+	// ReadYourWrites gives each call a consistency session, once it writes
+	// a row its later reads of the invalidated keys skip the cache
+	ReadYourWrites bool `env:"CACHE_READ_YOUR_WRITES"`
+	// Optional keeps the service up while redis is unreachable, at start
+	// too. Cache reads miss and writes are dropped until it is back, the
+	// handlers fall through to the database.
+	Optional bool `env:"CACHE_OPTIONAL"`
+}
+
+// NetACL turns down calls by client address. Allow and Deny are CIDRs or
+// bare addresses, deny wins and an empty allow list lets in everyone not
+// denied. File adds "allow <cidr>"/"deny <cidr>" lines and is re-read every
+// Reload when it changed. Calls from TrustedProxies, like the gateway over
+// loopback, are judged by their x-forwarded-for client instead, and only
+// they may name the user and tenant of a call.
+type NetACL struct {
+	Allow          []string      `env:"NETACL_ALLOW"`
+	Deny           []string      `env:"NETACL_DENY"`
+	File           string        `env:"NETACL_FILE"`
+	TrustedProxies []string      `env:"NETACL_TRUSTED_PROXIES"`
+	Reload         time.Duration `env:"NETACL_RELOAD" validate:"min=1s"`
+}
+
+// RateLimit limits calls per method and caller in each replica. Each
+// policy is "method=rate/period[:burst][:key]", method as in
+// PayloadLog.Methods, burst defaulting to rate and key one of user
+// (x-user-id, the default), ip or apikey (Quota.KeyHeader). Callers
+// without the key are limited by IP. Every limited call answers with
+// x-ratelimit-limit, -remaining and -reset headers; a caller down to WarnAt
+// of its burst is logged as a warning once, before it is turned down. 0
+// disables the warning.
+type RateLimit struct {
+	Enabled  bool     `env:"RATE_LIMIT_ENABLED"`
+	Policies []string `env:"RATE_LIMIT_POLICIES"`
+	WarnAt   float64  `env:"RATE_LIMIT_WARN_AT" validate:"min=0,max=1"`
+}
+
+// Concurrency caps the calls one caller has running at once, unary and
+// streams alike, so a client with slow calls can't take every handler. Key
+// is user (x-user-id from a NetACL trusted proxy), ip (the client behind
+// them) or apikey (Quota.KeyHeader), callers without it are capped by IP. Store memory counts in each replica, redis shares the
+// cap between them with slots leased for LeaseTTL and renewed while the
+// call runs. Limit 0 turns it off.
+type Concurrency struct {
+	Limit    int           `env:"CONCURRENCY_LIMIT" validate:"min=0"`
+	Key      string        `env:"CONCURRENCY_KEY" validate:"oneof=user ip apikey"`
+	Store    string        `env:"CONCURRENCY_STORE" validate:"oneof=memory redis"`
+	LeaseTTL time.Duration `env:"CONCURRENCY_LEASE_TTL" validate:"min=3s"`
+	Exempt   []string      `env:"CONCURRENCY_EXEMPT"`
+}
+
+// Quota charges every call carrying the KeyHeader API key against daily
+// and monthly limits shared by all replicas, calls over either get
+// ResourceExhausted. 0 leaves a period unlimited, both 0 turns it off.
+type Quota struct {
+	DailyLimit   int    `env:"QUOTA_DAILY_LIMIT" validate:"min=0"`
+	MonthlyLimit int    `env:"QUOTA_MONTHLY_LIMIT" validate:"min=0"`
+	KeyHeader    string `env:"QUOTA_KEY_HEADER" validate:"required"`
+}
+
+// Enabled is true when any limit is set
+func (q Quota) Enabled() bool {
+	return q.DailyLimit > 0 || q.MonthlyLimit > 0
+}
+
+// Hedge sends a second attempt of idempotent reads in the handler path
+// once one runs past the Percentile of recent latencies, at most MaxDelay.
+// Budget caps the share of calls hedged. Percentile 0 disables it.
+type Hedge struct {
+	Percentile float64       `env:"HEDGE_PERCENTILE" validate:"min=0,max=0.999"`
+	Budget     float64       `env:"HEDGE_BUDGET" validate:"min=0,max=1"`
+	MaxDelay   time.Duration `env:"HEDGE_MAX_DELAY" validate:"min=0s"`
+}
+
+// LoadShed limits how many unary calls run at once, the limit moves
+// between MinLimit and MaxLimit with their latency starting at
+// InitialLimit. Calls over it get Unavailable. Exempt methods, as in
+// PayloadLog.Methods, are never limited. Critical methods may use the
+// whole limit, Background ones half of it and the rest 90%, so background
+// work is shed first. PriorityHeader lets callers lower the priority of a
+// call, never raise it.
+type LoadShed struct {
+	Enabled        bool     `env:"LOAD_SHED_ENABLED"`
+	InitialLimit   int      `env:"LOAD_SHED_INITIAL_LIMIT" validate:"min=1"`
+	MinLimit       int      `env:"LOAD_SHED_MIN_LIMIT" validate:"min=1"`
+	MaxLimit       int      `env:"LOAD_SHED_MAX_LIMIT" validate:"min=1"`
+	Exempt         []string `env:"LOAD_SHED_EXEMPT"`
+	Critical       []string `env:"LOAD_SHED_CRITICAL"`
+	Background     []string `env:"LOAD_SHED_BACKGROUND"`
+	PriorityHeader string   `env:"LOAD_SHED_PRIORITY_HEADER"`
+}
+
+// Retention prunes old rows of time-series tables every Interval, see
+// retention.ParsePolicy for the policy format. BatchSize rows go per
+// statement with BatchPause in between.
+type Retention struct {
+	Policies   []string      `env:"RETENTION_POLICIES"`
+	Interval   time.Duration `env:"RETENTION_INTERVAL" validate:"min=1m"`
+	BatchSize  int           `env:"RETENTION_BATCH_SIZE" validate:"min=1"`
+	BatchPause time.Duration `env:"RETENTION_BATCH_PAUSE" validate:"min=0s"`
 }
 
-// NewConfig get config from env
+// Partition creates daily or monthly partitions ahead of time every
+// Interval, see partition.ParsePolicy for the policy format
+type Partition struct {
+	Policies []string      `env:"PARTITION_POLICIES"`
+	Interval time.Duration `env:"PARTITION_INTERVAL" validate:"min=1m"`
+}
+
+// Startup connects redis and postgres in parallel and reports every failed
+// dependency before exiting. With Degraded a redis outage is not one of
+// them, the service starts without the cache, response cache and quotas.
+type Startup struct {
+	Degraded bool `env:"STARTUP_DEGRADED"`
+}
+
+// Warmup opens REDIS_MIN_IDLE_CONN redis and DBConns postgres connections
+// and loads CacheKeys before the readiness probe flips, so the first calls
+// after a rollout find warm pools and a warm cache. Keys are loaded by the
+// primers modules register, see warmup. Whatever is not done by Timeout is
+// left to the first calls.
+type Warmup struct {
+	Enabled   bool          `env:"WARMUP_ENABLED"`
+	DBConns   int           `env:"WARMUP_DB_CONNS" validate:"min=0"`
+	CacheKeys []string      `env:"WARMUP_CACHE_KEYS"`
+	Timeout   time.Duration `env:"WARMUP_TIMEOUT" validate:"min=1s"`
+}
+
+// Notify sends alerts like failed health checks or margin calls by email,
+// Slack, Telegram and an SMS gateway. SMS only gets critical alerts, the
+// rest warnings and up. RateLimit caps each channel per minute, 0 is
+// unlimited.
+type Notify struct {
+	SMTPAddr       string   `env:"NOTIFY_SMTP_ADDR" validate:"hostport"`
+	SMTPUser       string   `env:"NOTIFY_SMTP_USER"`
+	SMTPPassword   string   `env:"NOTIFY_SMTP_PASSWORD" secret:"true"`
+	SMTPFrom       string   `env:"NOTIFY_SMTP_FROM"`
+	SMTPTo         []string `env:"NOTIFY_SMTP_TO"`
+	SlackWebhook   string   `env:"NOTIFY_SLACK_WEBHOOK" validate:"url" secret:"true"`
+	TelegramToken  string   `env:"NOTIFY_TELEGRAM_TOKEN" secret:"true"`
+	TelegramChatID string   `env:"NOTIFY_TELEGRAM_CHAT_ID"`
+	SMSURL         string   `env:"NOTIFY_SMS_URL" validate:"url"`
+	SMSToken       string   `env:"NOTIFY_SMS_TOKEN" secret:"true"`
+	SMSTo          []string `env:"NOTIFY_SMS_TO"`
+	RateLimit      int      `env:"NOTIFY_RATE_LIMIT" validate:"min=0"`
+	Locale         string   `env:"NOTIFY_LOCALE"`
+}
+
+// Enabled reports whether any channel is configured
+func (n Notify) Enabled() bool {
+	return n.SMTPAddr != "" || n.SlackWebhook != "" || n.TelegramToken != "" || n.SMSURL != ""
+}
+
+// Health tracks readiness checks as healthy, degraded or down per
+// dependency. A dependency changes state after Confirm results in a row
+// agree, and is notified about at most once per NotifyInterval.
+type Health struct {
+	Confirm        int           `env:"HEALTH_CONFIRM" validate:"min=1"`
+	NotifyInterval time.Duration `env:"HEALTH_NOTIFY_INTERVAL" validate:"min=0s"`
+}
+
+// Maintenance mode is switched through the AdminService and turns down
+// every call but the ReadOnly methods, method as in PayloadLog.Methods,
+// with Unavailable. The switch is kept under Key in redis for every
+// replica to pick up within PollInterval, an empty Key keeps it per
+// replica. RetryAfter is what callers are told to wait when the switch
+// names no end.
+type Maintenance struct {
+	Key          string        `env:"MAINTENANCE_KEY"`
+	PollInterval time.Duration `env:"MAINTENANCE_POLL_INTERVAL" validate:"min=1s"`
+	RetryAfter   time.Duration `env:"MAINTENANCE_RETRY_AFTER" validate:"min=1s"`
+	ReadOnly     []string      `env:"MAINTENANCE_READ_ONLY"`
+}
+
+// EventBus publishes and consumes domain events through memory (one
+// process only), redis streams or kafka. A handler failing MaxDeliveries
+// times drops the event, with Redelivery doubling between attempts.
+// Format encodes published events, consumers read all of them. Registered
+// event schemas must be SchemaCompatibility compatible version to version.
+// What subscribers give up on is kept in DeadLetterStore, by default the
+// memory bus keeps it in memory, the redis bus in redis and kafka nowhere.
+type EventBus struct {
+	Backend             string        `env:"EVENTBUS_BACKEND" validate:"oneof=memory redis kafka"`
+	KafkaBrokers        []string      `env:"EVENTBUS_KAFKA_BROKERS" validate:"hostport"`
+	StreamMaxLen        int           `env:"EVENTBUS_STREAM_MAXLEN" validate:"min=0"`
+	MaxDeliveries       int           `env:"EVENTBUS_MAX_DELIVERIES" validate:"min=1"`
+	Redelivery          time.Duration `env:"EVENTBUS_REDELIVERY" validate:"min=0s"`
+	Format              string        `env:"EVENTBUS_FORMAT" validate:"oneof=json cloudevents cloudevents-proto"`
+	SchemaCompatibility string        `env:"EVENTBUS_SCHEMA_COMPATIBILITY" validate:"oneof=none backward forward full"`
+	DeadLetterStore     string        `env:"EVENTBUS_DEADLETTER_STORE" validate:"oneof=none memory redis"`
+	DeadLetterMaxLen    int           `env:"EVENTBUS_DEADLETTER_MAXLEN" validate:"min=1"`
+}
+
+// Runtime tunes the garbage collector, see gctune. GCPercent is GOGC, 0
+// keeps the default. MemoryLimit is GOMEMLIMIT in bytes, when 0 and
+// MemoryLimitRatio is set the limit is that share of the container's
+// memory limit. Ballast bytes are allocated once to calm the GC of a small
+// heap. GOGC and GOMEMLIMIT in the environment win over all of them.
+type Runtime struct {
+	GCPercent        int     `env:"RUNTIME_GC_PERCENT" validate:"min=-1"`
+	MemoryLimit      int     `env:"RUNTIME_MEMORY_LIMIT" validate:"min=0"`
+	MemoryLimitRatio float64 `env:"RUNTIME_MEMORY_LIMIT_RATIO" validate:"min=0,max=1"`
+	Ballast          int     `env:"RUNTIME_BALLAST" validate:"min=0"`
+}
+
+// Compression of rotated log files and cache values, see compress. Preset
+// picks both, latency or storage, the other settings override it; empty
+// ones keep the preset's. Without a preset logs are gzipped and cache
+// values stored as they are. CacheMinBytes is the size a value needs to be
+// compressed at all.
+type Compression struct {
+	Preset        string `env:"COMPRESSION_PRESET" validate:"oneof=latency storage"`
+	Log           string `env:"LOG_COMPRESSION" validate:"oneof=none gzip zstd snappy"`
+	LogLevel      string `env:"LOG_COMPRESSION_LEVEL" validate:"oneof=fastest default best"`
+	Cache         string `env:"CACHE_COMPRESSION" validate:"oneof=none gzip zstd snappy"`
+	CacheLevel    string `env:"CACHE_COMPRESSION_LEVEL" validate:"oneof=fastest default best"`
+	CacheMinBytes int    `env:"CACHE_COMPRESS_MIN_BYTES" validate:"min=0"`
+}
+
+// Admin runs the AdminService on its own gRPC listener when Port is set,
+// every call must send "authorization: Bearer <Token>"
+type Admin struct {
+	Port  string `env:"ADMIN_GRPC_PORT" validate:"port"`
+	Token string `env:"ADMIN_TOKEN" secret:"true"`
+}
+
+// Debug features that leak internals. They default to on in development
+// and staging and off in production, binaries built with -tags production
+// can never turn them on.
+type Debug struct {
+	// Reflection registers the gRPC reflection service for grpcurl
+	Reflection bool `env:"GRPC_REFLECTION"`
+	// VerboseErrors sends internal error and panic messages to clients
+	VerboseErrors bool `env:"VERBOSE_ERRORS"`
+	// Endpoints allows the pprof server on DEBUG_PORT
+	Endpoints bool `env:"DEBUG_ENDPOINTS"`
+	// APIDocs serves the OpenAPI spec and Swagger UI from the gateway
+	APIDocs bool `env:"API_DOCS"`
+}
+
+// Faults injects latency and errors into redis commands, postgres
+// statements and outgoing gRPC calls so retries, breakers and degraded
+// modes can be exercised in staging. Off unless set, refused with
+// APP_ENV=production and never on in -tags production builds. Rules are in
+// fault.ParseRules syntax, the AdminService replaces them at runtime.
+type Faults struct {
+	Enabled bool   `env:"FAULT_INJECTION"`
+	Rules   string `env:"FAULT_RULES"`
+}
+
+// HTTP listeners run next to gRPC, GatewayPort serves the JSON gateway,
+// MetricsPort moves /metrics and the health endpoints off the probe port,
+// DebugPort serves pprof and should never be exposed outside the pod
+type HTTP struct {
+	GatewayPort string `env:"HTTP_PORT" validate:"port"`
+	MetricsPort string `env:"METRICS_PORT" validate:"port"`
+	DebugPort   string `env:"DEBUG_PORT" validate:"port"`
+}
+
+// NewConfig get config from env, panics with every invalid value listed
 func NewConfig() *Config {
+	c, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Load reads the env and validates the result, on error the config is
+// returned too so callers can still print what was read. The .env file
+// (or ENV_FILE) is applied first, already set env vars win over it.
+func Load() (*Config, error) {
+	// typed values, anything that does not parse is reported with the rest
+	e := &env{}
+
+	if _, err := LoadDotEnv(GetString(ENV_FILE, ".env")); err != nil {
+		e.errs = append(e.errs, FieldError{Env: ENV_FILE, Rule: "dotenv", Message: err.Error()})
+	}
 
 	// init config 
 	setting := Setting{}
 	setting.LocalPath = "./locales/*/*"
 	setting.Version = "1.0.0"
+	setting.Environment = "development"
 	logger := Logger{}
 	logger.LogFile = "blueprint.log"
 	redis := Redis{}
+	redis.SentinelPoll = 10 * time.Second
+	redis.SlowThreshold = 100 * time.Millisecond
+	redis.HealthInterval = 5 * time.Second
+	redis.StatsInterval = 30 * time.Second
 	gprc := GRPC{}
+	gprc.MaxConnectionIdle = 15 * time.Second
+	gprc.MaxConnectionAge = 30 * time.Second
+	gprc.Timeout = time.Second
+	gprc.MaxConnectionAgeGrace = 5 * time.Second
+	gprc.KeepaliveTime = 5 * time.Second
+	gprc.KeepaliveMinTime = 5 * time.Second
+	gprc.PermitWithoutStream = true
+	gprc.ConnectionTimeout = 120 * time.Second
+	gprc.MaxRecvMsgSize = 4 << 20
+	gprc.UnixSocketMode = 0o660
 	postgres := Postgres{}
+	postgres.SlowThreshold = 200 * time.Millisecond
+	postgres.QueryBudget = 100
+	discovery := Discovery{}
+	discovery.TTL = 10 * time.Second
+	kube := Kube{}
+	kube.ProbePort = "8086"
+	kube.PreStopDelay = 5 * time.Second
+
+	errorTracking := ErrorTracking{}
+	errorTracking.SampleRate = 1
+	responseCache := ResponseCache{}
+	responseCache.Enabled = true
+	responseCache.Policies = []string{"/blueprint.Blueprint/Call=5m:name"}
+	responseCache.BypassHeader = "x-cache-bypass"
+	netACL := NetACL{}
+	netACL.TrustedProxies = []string{"127.0.0.1", "::1"}
+	netACL.Reload = 10 * time.Second
+	rateLimit := RateLimit{}
+	rateLimit.Enabled = true
+	rateLimit.Policies = []string{"/blueprint.Blueprint/Call=100/1m"}
+	rateLimit.WarnAt = 0.2
+	concurrency := Concurrency{}
+	concurrency.Key = "user"
+	concurrency.Store = "memory"
+	concurrency.LeaseTTL = 30 * time.Second
+	concurrency.Exempt = []string{"grpc.health.v1.Health"}
+	quota := Quota{}
+	quota.KeyHeader = "x-api-key"
+	hedge := Hedge{}
+	hedge.Budget = 0.1
+	hedge.MaxDelay = 100 * time.Millisecond
+	loadShed := LoadShed{}
+	loadShed.InitialLimit = 20
+	loadShed.MinLimit = 5
+	loadShed.MaxLimit = 1000
+	loadShed.Exempt = []string{"grpc.health.v1.Health"}
+	loadShed.PriorityHeader = "x-priority"
+	retention := Retention{}
+	retention.Interval = time.Hour
+	retention.BatchSize = 1000
+	retention.BatchPause = 100 * time.Millisecond
+	partition := Partition{}
+	partition.Interval = time.Hour
+	warmup := Warmup{}
+	warmup.DBConns = 5
+	warmup.Timeout = 10 * time.Second
+	notify := Notify{}
+	notify.RateLimit = 30
+	notify.Locale = "en-US"
+	health := Health{}
+	health.Confirm = 2
+	health.NotifyInterval = 5 * time.Minute
+	maintenance := Maintenance{}
+	maintenance.Key = "blueprint:maintenance"
+	maintenance.PollInterval = 5 * time.Second
+	maintenance.RetryAfter = time.Minute
+	maintenance.ReadOnly = []string{"Version", "Call", "GetAccount", "grpc.health.v1.Health"}
+	eventBus := EventBus{}
+	eventBus.StreamMaxLen = 100000
+	eventBus.MaxDeliveries = 10
+	eventBus.Redelivery = time.Second
+	eventBus.Format = "json"
+	eventBus.SchemaCompatibility = "backward"
+	eventBus.DeadLetterMaxLen = 10000
 
 	c := &Config{
-		GRPC:     gprc,
-		Logger:   logger,
-		Redis:    redis,
-		Postgres: postgres,
+		Setting:   setting,
+		GRPC:      gprc,
+		Logger:    logger,
+		Redis:     redis,
+		Postgres:  postgres,
+		Discovery: discovery,
+		Kube:      kube,
+
+		ErrorTracking: errorTracking,
+		ResponseCache: responseCache,
+		NetACL:        netACL,
+		RateLimit:     rateLimit,
+		Concurrency:   concurrency,
+		Quota:         quota,
+		Hedge:         hedge,
+		LoadShed:      loadShed,
+		Retention:     retention,
+		Partition:     partition,
+		Warmup:        warmup,
+		Notify:        notify,
+		Health:        health,
+		Maintenance:   maintenance,
+		EventBus:      eventBus,
 	}
 
-	parseError := map[string]string{
-		GPRC_HOST:         "",
-		GRPC_PORT:         "",
-		REDIS_URL:         "",
-		REDIS_PASSWORD:    "",
-		POSTGRES_HOST:     "",
-		POSTGRES_PORT:     "",
-		POSTGRES_USER:     "",
-		POSTGRES_PASSWORD: "",
-		POSTGRES_DB:       "",
+	// a profile only moves the defaults, every env var read below still
+	// wins over it; an unknown one fails validation
+	c.Setting.Profile = os.Getenv(TUNING_PROFILE)
+	if apply, ok := Profiles[c.Setting.Profile]; ok {
+		apply(c)
 	}
 
 	redisURL := os.Getenv(REDIS_URL)
 
 	if redisURL != "" {
 		c.Redis.RedisAddr = redisURL
-		parseError[REDIS_URL] = redisURL		
-		//fmt.Println(parseError[redisURL] ,redisURL)
 	}
 
 	redisPassword := os.Getenv(REDIS_PASSWORD)
 	if redisPassword != "" {
 		c.Redis.RedisPassword = redisPassword
-		parseError[REDIS_PASSWORD] = redisPassword
 	}
 
 	gRPCHost := os.Getenv(GPRC_HOST)
 	if gRPCHost != "" {
 		c.GRPC.Host = gRPCHost
-		parseError[GPRC_HOST] = gRPCHost
 	}
 
 	gRPCPort := os.Getenv(GRPC_PORT)
 	if gRPCPort != "" {
 		c.GRPC.Port = gRPCPort
-		parseError[GRPC_PORT] = gRPCPort
 
 	}
  
@@ -147,44 +978,327 @@ func NewConfig() *Config {
 	postgresHost := os.Getenv(POSTGRES_HOST)
 	if postgresHost != "" {
 		c.Postgres.PostgresHost = postgresHost
-		parseError[POSTGRES_HOST] = postgresHost
 	}
 
 	postgresPort := os.Getenv(POSTGRES_PORT)
 	if postgresPort != "" {
 		c.Postgres.PostgresPort = postgresPort
-		parseError[POSTGRES_PORT] = postgresPort
 	}
 
 	postgresUser := os.Getenv(POSTGRES_USER)
 	if postgresUser != "" {
 		c.Postgres.PostgresUser = postgresUser
-		parseError[POSTGRES_USER] = postgresUser
 	}
 
 	postgresPassword := os.Getenv(POSTGRES_PASSWORD)
 	if postgresPassword != "" {
 		c.Postgres.PostgresPassword = postgresPassword
-		parseError[POSTGRES_PASSWORD] = postgresPassword
 	}
 
 	postgresDB := os.Getenv(POSTGRES_DB)
 	if postgresDB != "" {
 		c.Postgres.PostgresDBName = postgresDB
-		parseError[POSTGRES_DB] = postgresDB
 	}
 
-	exitParse :=false
-	for k, v := range parseError {
-			if v=="" {
-				exitParse=true
-				fmt.Printf("%s = %s\n",k,v)
-			}		
+	c.PayloadLog.SampleRate = e.float(PAYLOAD_LOG_SAMPLE_RATE, c.PayloadLog.SampleRate)
+	c.PayloadLog.Methods = e.list(PAYLOAD_LOG_METHODS, c.PayloadLog.Methods)
+	c.PayloadLog.RedactFields = e.list(PAYLOAD_LOG_REDACT, c.PayloadLog.RedactFields)
+	c.PayloadLog.MaxBytes = e.int(PAYLOAD_LOG_MAX_BYTES, c.PayloadLog.MaxBytes)
+
+	c.ResponseCache.Enabled = e.bool(RESPONSE_CACHE_ENABLED, c.ResponseCache.Enabled)
+	c.ResponseCache.Policies = e.list(RESPONSE_CACHE_POLICIES, c.ResponseCache.Policies)
+	c.ResponseCache.BypassHeader = GetString(RESPONSE_CACHE_BYPASS_HEADER, c.ResponseCache.BypassHeader)
+	c.Cache.KeyScope = e.list(CACHE_KEY_SCOPE, c.Cache.KeyScope)
+	c.Cache.TTL = e.duration(CACHE_TTL, c.Cache.TTL)
+	c.Cache.StaleWindow = e.duration(CACHE_STALE_WINDOW, c.Cache.StaleWindow)
+	c.Cache.ReadYourWrites = e.bool(CACHE_READ_YOUR_WRITES, c.Cache.ReadYourWrites)
+	c.Cache.Optional = e.bool(CACHE_OPTIONAL, c.Cache.Optional)
+
+	c.Quota.DailyLimit = e.int(QUOTA_DAILY_LIMIT, c.Quota.DailyLimit)
+	c.Quota.MonthlyLimit = e.int(QUOTA_MONTHLY_LIMIT, c.Quota.MonthlyLimit)
+	c.Quota.KeyHeader = GetString(QUOTA_KEY_HEADER, c.Quota.KeyHeader)
+
+	c.NetACL.Allow = e.list(NETACL_ALLOW, c.NetACL.Allow)
+	c.NetACL.Deny = e.list(NETACL_DENY, c.NetACL.Deny)
+	c.NetACL.File = os.Getenv(NETACL_FILE)
+	c.NetACL.TrustedProxies = e.list(NETACL_TRUSTED_PROXIES, c.NetACL.TrustedProxies)
+	c.NetACL.Reload = e.duration(NETACL_RELOAD, c.NetACL.Reload)
+
+	c.RateLimit.Enabled = e.bool(RATE_LIMIT_ENABLED, c.RateLimit.Enabled)
+	c.RateLimit.Policies = e.list(RATE_LIMIT_POLICIES, c.RateLimit.Policies)
+	c.RateLimit.WarnAt = e.float(RATE_LIMIT_WARN_AT, c.RateLimit.WarnAt)
+
+	c.Concurrency.Limit = e.int(CONCURRENCY_LIMIT, c.Concurrency.Limit)
+	c.Concurrency.Key = GetString(CONCURRENCY_KEY, c.Concurrency.Key)
+	c.Concurrency.Store = GetString(CONCURRENCY_STORE, c.Concurrency.Store)
+	c.Concurrency.LeaseTTL = e.duration(CONCURRENCY_LEASE_TTL, c.Concurrency.LeaseTTL)
+	c.Concurrency.Exempt = e.list(CONCURRENCY_EXEMPT, c.Concurrency.Exempt)
+
+	c.Hedge.Percentile = e.float(HEDGE_PERCENTILE, c.Hedge.Percentile)
+	c.Hedge.Budget = e.float(HEDGE_BUDGET, c.Hedge.Budget)
+	c.Hedge.MaxDelay = e.duration(HEDGE_MAX_DELAY, c.Hedge.MaxDelay)
+
+	c.LoadShed.Enabled = e.bool(LOAD_SHED_ENABLED, c.LoadShed.Enabled)
+	c.LoadShed.InitialLimit = e.int(LOAD_SHED_INITIAL_LIMIT, c.LoadShed.InitialLimit)
+	c.LoadShed.MinLimit = e.int(LOAD_SHED_MIN_LIMIT, c.LoadShed.MinLimit)
+	c.LoadShed.MaxLimit = e.int(LOAD_SHED_MAX_LIMIT, c.LoadShed.MaxLimit)
+	c.LoadShed.Exempt = e.list(LOAD_SHED_EXEMPT, c.LoadShed.Exempt)
+	c.LoadShed.Critical = e.list(LOAD_SHED_CRITICAL, c.LoadShed.Critical)
+	c.LoadShed.Background = e.list(LOAD_SHED_BACKGROUND, c.LoadShed.Background)
+	c.LoadShed.PriorityHeader = GetString(LOAD_SHED_PRIORITY_HEADER, c.LoadShed.PriorityHeader)
+	if c.LoadShed.MaxLimit < c.LoadShed.MinLimit {
+		e.errs = append(e.errs, FieldError{Env: LOAD_SHED_MAX_LIMIT, Field: "LoadShed.MaxLimit", Rule: "min", Message: "must not be below LOAD_SHED_MIN_LIMIT"})
 	}
-	
-	// one faild
-	if exitParse {
-		panic("Env vars not set see list")
+
+	c.Retention.Policies = e.list(RETENTION_POLICIES, c.Retention.Policies)
+	c.Retention.Interval = e.duration(RETENTION_INTERVAL, c.Retention.Interval)
+	c.Retention.BatchSize = e.int(RETENTION_BATCH_SIZE, c.Retention.BatchSize)
+	c.Retention.BatchPause = e.duration(RETENTION_BATCH_PAUSE, c.Retention.BatchPause)
+
+	c.Partition.Policies = e.list(PARTITION_POLICIES, c.Partition.Policies)
+	c.Partition.Interval = e.duration(PARTITION_INTERVAL, c.Partition.Interval)
+
+	c.Startup.Degraded = e.bool(STARTUP_DEGRADED, c.Startup.Degraded)
+
+	c.Warmup.Enabled = e.bool(WARMUP_ENABLED, c.Warmup.Enabled)
+	c.Warmup.DBConns = e.int(WARMUP_DB_CONNS, c.Warmup.DBConns)
+	c.Warmup.CacheKeys = e.list(WARMUP_CACHE_KEYS, c.Warmup.CacheKeys)
+	c.Warmup.Timeout = e.duration(WARMUP_TIMEOUT, c.Warmup.Timeout)
+
+	c.Notify.SMTPAddr = os.Getenv(NOTIFY_SMTP_ADDR)
+	c.Notify.SMTPUser = os.Getenv(NOTIFY_SMTP_USER)
+	c.Notify.SMTPPassword = os.Getenv(NOTIFY_SMTP_PASSWORD)
+	c.Notify.SMTPFrom = os.Getenv(NOTIFY_SMTP_FROM)
+	c.Notify.SMTPTo = e.list(NOTIFY_SMTP_TO, c.Notify.SMTPTo)
+	c.Notify.SlackWebhook = os.Getenv(NOTIFY_SLACK_WEBHOOK)
+	c.Notify.TelegramToken = os.Getenv(NOTIFY_TELEGRAM_TOKEN)
+	c.Notify.TelegramChatID = os.Getenv(NOTIFY_TELEGRAM_CHAT_ID)
+	c.Notify.SMSURL = os.Getenv(NOTIFY_SMS_URL)
+	c.Notify.SMSToken = os.Getenv(NOTIFY_SMS_TOKEN)
+	c.Notify.SMSTo = e.list(NOTIFY_SMS_TO, c.Notify.SMSTo)
+	c.Notify.RateLimit = e.int(NOTIFY_RATE_LIMIT, c.Notify.RateLimit)
+	c.Notify.Locale = GetString(NOTIFY_LOCALE, c.Notify.Locale)
+	if c.Notify.SMTPAddr != "" && (c.Notify.SMTPFrom == "" || len(c.Notify.SMTPTo) == 0) {
+		e.errs = append(e.errs, FieldError{Env: NOTIFY_SMTP_TO, Field: "Notify.SMTPTo", Rule: "required", Message: "NOTIFY_SMTP_FROM and NOTIFY_SMTP_TO are required with NOTIFY_SMTP_ADDR"})
 	}
-	return c
+	if c.Notify.TelegramToken != "" && c.Notify.TelegramChatID == "" {
+		e.errs = append(e.errs, FieldError{Env: NOTIFY_TELEGRAM_CHAT_ID, Field: "Notify.TelegramChatID", Rule: "required", Message: "is required with NOTIFY_TELEGRAM_TOKEN"})
+	}
+	if c.Notify.SMSURL != "" && len(c.Notify.SMSTo) == 0 {
+		e.errs = append(e.errs, FieldError{Env: NOTIFY_SMS_TO, Field: "Notify.SMSTo", Rule: "required", Message: "is required with NOTIFY_SMS_URL"})
+	}
+
+	c.Health.Confirm = e.int(HEALTH_CONFIRM, c.Health.Confirm)
+	c.Health.NotifyInterval = e.duration(HEALTH_NOTIFY_INTERVAL, c.Health.NotifyInterval)
+
+	// set but empty keeps the switch per replica
+	if key, ok := os.LookupEnv(MAINTENANCE_KEY); ok {
+		c.Maintenance.Key = key
+	}
+	c.Maintenance.PollInterval = e.duration(MAINTENANCE_POLL_INTERVAL, c.Maintenance.PollInterval)
+	c.Maintenance.RetryAfter = e.duration(MAINTENANCE_RETRY_AFTER, c.Maintenance.RetryAfter)
+	c.Maintenance.ReadOnly = e.list(MAINTENANCE_READ_ONLY, c.Maintenance.ReadOnly)
+
+	c.EventBus.Backend = os.Getenv(EVENTBUS_BACKEND)
+	c.EventBus.KafkaBrokers = e.list(EVENTBUS_KAFKA_BROKERS, c.EventBus.KafkaBrokers)
+	c.EventBus.StreamMaxLen = e.int(EVENTBUS_STREAM_MAXLEN, c.EventBus.StreamMaxLen)
+	c.EventBus.MaxDeliveries = e.int(EVENTBUS_MAX_DELIVERIES, c.EventBus.MaxDeliveries)
+	c.EventBus.Redelivery = e.duration(EVENTBUS_REDELIVERY, c.EventBus.Redelivery)
+	c.EventBus.Format = GetString(EVENTBUS_FORMAT, c.EventBus.Format)
+	c.EventBus.SchemaCompatibility = GetString(EVENTBUS_SCHEMA_COMPATIBILITY, c.EventBus.SchemaCompatibility)
+	c.EventBus.DeadLetterStore = os.Getenv(EVENTBUS_DEADLETTER_STORE)
+	if c.EventBus.DeadLetterStore == "" {
+		switch c.EventBus.Backend {
+		case "memory", "redis":
+			c.EventBus.DeadLetterStore = c.EventBus.Backend
+		default:
+			c.EventBus.DeadLetterStore = "none"
+		}
+	}
+	c.EventBus.DeadLetterMaxLen = e.int(EVENTBUS_DEADLETTER_MAXLEN, c.EventBus.DeadLetterMaxLen)
+	if c.EventBus.Backend == "kafka" && len(c.EventBus.KafkaBrokers) == 0 {
+		e.errs = append(e.errs, FieldError{Env: EVENTBUS_KAFKA_BROKERS, Field: "EventBus.KafkaBrokers", Rule: "required", Message: "is required with EVENTBUS_BACKEND=kafka"})
+	}
+
+	c.Runtime.GCPercent = e.int(RUNTIME_GC_PERCENT, c.Runtime.GCPercent)
+	c.Runtime.MemoryLimit = e.int(RUNTIME_MEMORY_LIMIT, c.Runtime.MemoryLimit)
+	c.Runtime.MemoryLimitRatio = e.float(RUNTIME_MEMORY_LIMIT_RATIO, c.Runtime.MemoryLimitRatio)
+	c.Runtime.Ballast = e.int(RUNTIME_BALLAST, c.Runtime.Ballast)
+
+	c.Compression.Preset = GetString(COMPRESSION_PRESET, c.Compression.Preset)
+	c.Compression.Log = os.Getenv(LOG_COMPRESSION)
+	c.Compression.LogLevel = os.Getenv(LOG_COMPRESSION_LEVEL)
+	c.Compression.Cache = os.Getenv(CACHE_COMPRESSION)
+	c.Compression.CacheLevel = os.Getenv(CACHE_COMPRESSION_LEVEL)
+	c.Compression.CacheMinBytes = e.int(CACHE_COMPRESS_MIN_BYTES, c.Compression.CacheMinBytes)
+
+	c.Admin.Port = os.Getenv(ADMIN_GRPC_PORT)
+	c.Admin.Token = os.Getenv(ADMIN_TOKEN)
+	if c.Admin.Port != "" && c.Admin.Token == "" {
+		e.errs = append(e.errs, FieldError{Env: ADMIN_TOKEN, Field: "Admin.Token", Rule: "required", Message: "is required with ADMIN_GRPC_PORT"})
+	}
+
+	c.Setting.Environment = GetString(APP_ENV, c.Setting.Environment)
+
+	debugDefault := c.Setting.Environment != "production" && !ProductionBuild
+	c.Debug.Reflection = e.bool(GRPC_REFLECTION, debugDefault)
+	c.Debug.VerboseErrors = e.bool(VERBOSE_ERRORS, debugDefault)
+	c.Debug.Endpoints = e.bool(DEBUG_ENDPOINTS, debugDefault)
+	c.Debug.APIDocs = e.bool(API_DOCS, debugDefault)
+	if ProductionBuild {
+		c.Debug = Debug{}
+	}
+
+	c.Faults.Enabled = e.bool(FAULT_INJECTION, false)
+	c.Faults.Rules = os.Getenv(FAULT_RULES)
+	if c.Faults.Enabled && c.Setting.Environment == "production" {
+		e.errs = append(e.errs, FieldError{Env: FAULT_INJECTION, Field: "Faults.Enabled", Rule: "environment", Message: "is not allowed with APP_ENV=production"})
+	}
+	if c.Faults.Rules != "" && !c.Faults.Enabled {
+		e.errs = append(e.errs, FieldError{Env: FAULT_RULES, Field: "Faults.Rules", Rule: "required", Message: "needs FAULT_INJECTION=true"})
+	}
+	if ProductionBuild {
+		c.Faults = Faults{}
+	}
+
+	c.HTTP.GatewayPort = os.Getenv(HTTP_PORT)
+	c.HTTP.MetricsPort = os.Getenv(METRICS_PORT)
+	c.HTTP.DebugPort = os.Getenv(DEBUG_PORT)
+
+	c.Discovery.Backend = GetString(DISCOVERY_BACKEND, c.Discovery.Backend)
+	c.Discovery.Addr = GetString(DISCOVERY_ADDR, c.Discovery.Addr)
+	c.Discovery.TTL = e.duration(DISCOVERY_TTL, c.Discovery.TTL)
+
+	c.Kube.PodName = os.Getenv(POD_NAME)
+	c.Kube.Namespace = os.Getenv(POD_NAMESPACE)
+	c.Kube.NodeName = os.Getenv(NODE_NAME)
+	c.Kube.PodIP = os.Getenv(POD_IP)
+	c.Kube.ProbePort = GetString(PROBE_PORT, c.Kube.ProbePort)
+	c.Kube.PreStopDelay = e.duration(PRESTOP_DELAY, c.Kube.PreStopDelay)
+	// k8s exposes terminationGracePeriodSeconds as plain seconds, e.duration takes both
+	c.Kube.TerminationGrace = e.duration(TERMINATION_GRACE_PERIOD, c.Kube.TerminationGrace)
+
+	c.Crash.GoroutineDump = e.bool(CRASH_GOROUTINE_DUMP, c.Crash.GoroutineDump)
+
+	c.ErrorTracking.SentryDSN = os.Getenv(SENTRY_DSN)
+	c.ErrorTracking.WebhookURL = os.Getenv(ERROR_WEBHOOK_URL)
+	c.ErrorTracking.SampleRate = e.float(ERROR_TRACKING_SAMPLE_RATE, c.ErrorTracking.SampleRate)
+
+	c.Logger.Async = e.bool(LOG_ASYNC, c.Logger.Async)
+	c.Logger.AsyncBufferSize = e.int(LOG_ASYNC_BUFFER, c.Logger.AsyncBufferSize)
+	c.Logger.RotateInterval = os.Getenv(LOG_ROTATE)
+	c.Logger.ModuleLevels = os.Getenv(LOG_LEVELS)
+	c.Logger.MaxTotalSize = e.int(LOG_MAX_TOTAL_MB, c.Logger.MaxTotalSize)
+
+	c.Redis.DB = e.int(REDIS_DB, c.Redis.DB)
+	c.Redis.PoolSize = e.int(REDIS_POOL_SIZE, c.Redis.PoolSize)
+	c.Redis.MinIdleConn = e.int(REDIS_MIN_IDLE_CONN, c.Redis.MinIdleConn)
+	c.Redis.PoolTimeout = e.duration(REDIS_POOL_TIMEOUT, c.Redis.PoolTimeout)
+	c.Redis.DialTimeout = e.duration(REDIS_DIAL_TIMEOUT, c.Redis.DialTimeout)
+	c.Redis.ReadTimeout = e.duration(REDIS_READ_TIMEOUT, c.Redis.ReadTimeout)
+	c.Redis.WriteTimeout = e.duration(REDIS_WRITE_TIMEOUT, c.Redis.WriteTimeout)
+	c.Redis.MaxRetries = e.int(REDIS_MAX_RETRIES, c.Redis.MaxRetries)
+	c.Redis.SentinelAddrs = e.list(REDIS_SENTINEL_ADDRS, c.Redis.SentinelAddrs)
+	c.Redis.SentinelMaster = GetString(REDIS_SENTINEL_MASTER, c.Redis.SentinelMaster)
+	c.Redis.SentinelPassword = os.Getenv(REDIS_SENTINEL_PASSWORD)
+	c.Redis.SentinelPoll = e.duration(REDIS_SENTINEL_POLL, c.Redis.SentinelPoll)
+	c.Redis.SentinelMaxLag = e.int(REDIS_SENTINEL_MAX_LAG, c.Redis.SentinelMaxLag)
+	c.Redis.SlowThreshold = e.duration(REDIS_SLOW_THRESHOLD, c.Redis.SlowThreshold)
+	c.Redis.HealthInterval = e.duration(REDIS_HEALTH_INTERVAL, c.Redis.HealthInterval)
+	c.Redis.StatsInterval = e.duration(REDIS_STATS_INTERVAL, c.Redis.StatsInterval)
+	c.Redis.PoolMinSize = e.int(REDIS_POOL_MIN_SIZE, c.Redis.PoolMinSize)
+	c.Redis.PoolMaxSize = e.int(REDIS_POOL_MAX_SIZE, c.Redis.PoolMaxSize)
+	if len(c.Redis.SentinelAddrs) > 0 && c.Redis.SentinelMaster == "" {
+		e.errs = append(e.errs, FieldError{Env: REDIS_SENTINEL_MASTER, Field: "Redis.SentinelMaster", Rule: "required", Message: "is required with REDIS_SENTINEL_ADDRS"})
+	}
+
+	c.Postgres.MaxIdleConns = e.int(POSTGRES_MAX_IDLE_CONNS, c.Postgres.MaxIdleConns)
+	c.Postgres.MaxOpenConns = e.int(POSTGRES_MAX_OPEN_CONNS, c.Postgres.MaxOpenConns)
+	c.Postgres.ConnMaxLifetime = e.duration(POSTGRES_CONN_MAX_LIFETIME, c.Postgres.ConnMaxLifetime)
+	c.Postgres.ConnMaxIdleTime = e.duration(POSTGRES_CONN_MAX_IDLE_TIME, c.Postgres.ConnMaxIdleTime)
+	c.Postgres.MinOpenConnsTuned = e.int(POSTGRES_MIN_OPEN_CONNS_TUNED, c.Postgres.MinOpenConnsTuned)
+	c.Postgres.MaxOpenConnsTuned = e.int(POSTGRES_MAX_OPEN_CONNS_TUNED, c.Postgres.MaxOpenConnsTuned)
+	c.Postgres.Credentials = GetString(POSTGRES_CREDENTIALS, "static")
+	c.Postgres.CredentialsRefresh = e.duration(POSTGRES_CREDENTIALS_REFRESH, time.Minute)
+	c.Postgres.PasswordFile = os.Getenv(POSTGRES_PASSWORD_FILE)
+	c.Postgres.VaultAddr = os.Getenv(VAULT_ADDR)
+	c.Postgres.VaultToken = os.Getenv(VAULT_TOKEN)
+	c.Postgres.VaultTokenFile = os.Getenv(VAULT_TOKEN_FILE)
+	c.Postgres.VaultPath = os.Getenv(POSTGRES_VAULT_PATH)
+	c.Postgres.AWSRegion = os.Getenv(AWS_REGION)
+	e.errs = append(e.errs, postgresCredentialsRequired(c.Postgres)...)
+	c.Postgres.SSLMode = GetString(POSTGRES_SSLMODE, c.Postgres.SSLMode)
+	c.Postgres.SSLRootCert = os.Getenv(POSTGRES_SSLROOTCERT)
+	c.Postgres.SSLCert = os.Getenv(POSTGRES_SSLCERT)
+	c.Postgres.SSLKey = os.Getenv(POSTGRES_SSLKEY)
+	c.Postgres.SSLKeyPassword = os.Getenv(POSTGRES_SSLKEY_PASSWORD)
+	c.Postgres.SlowThreshold = e.duration(POSTGRES_SLOW_THRESHOLD, c.Postgres.SlowThreshold)
+	c.Postgres.ExplainSlow = e.bool(POSTGRES_EXPLAIN_SLOW, c.Postgres.ExplainSlow)
+	c.Postgres.QueryBudget = e.int(POSTGRES_QUERY_BUDGET, c.Postgres.QueryBudget)
+	c.Postgres.QueryBudgets = e.list(POSTGRES_QUERY_BUDGETS, c.Postgres.QueryBudgets)
+	c.Postgres.QueryBudgetReject = e.bool(POSTGRES_QUERY_BUDGET_REJECT, c.Postgres.QueryBudgetReject)
+	c.Postgres.StmtCacheSize = e.int(POSTGRES_STMT_CACHE_SIZE, c.Postgres.StmtCacheSize)
+	c.Postgres.StmtCacheTTL = e.duration(POSTGRES_STMT_CACHE_TTL, c.Postgres.StmtCacheTTL)
+	c.Postgres.QueryComment = GetString(POSTGRES_QUERY_COMMENT, c.Postgres.QueryComment)
+	if (c.Postgres.SSLCert == "") != (c.Postgres.SSLKey == "") {
+		e.errs = append(e.errs, FieldError{Env: POSTGRES_SSLKEY, Field: "Postgres.SSLKey", Rule: "required", Message: "POSTGRES_SSLCERT and POSTGRES_SSLKEY go together"})
+	}
+	if c.Warmup.Enabled && c.Postgres.MaxIdleConns > 0 && c.Warmup.DBConns > c.Postgres.MaxIdleConns {
+		e.errs = append(e.errs, FieldError{Env: WARMUP_DB_CONNS, Field: "Warmup.DBConns", Rule: "max", Message: "must not exceed POSTGRES_MAX_IDLE_CONNS, the pool would close the extra connections"})
+	}
+
+	c.GRPC.MaxConnectionIdle = e.duration(GRPC_MAX_CONNECTION_IDLE, c.GRPC.MaxConnectionIdle)
+	c.GRPC.MaxConnectionAge = e.duration(GRPC_MAX_CONNECTION_AGE, c.GRPC.MaxConnectionAge)
+	c.GRPC.Timeout = e.duration(GRPC_KEEPALIVE_TIMEOUT, c.GRPC.Timeout)
+	c.GRPC.MaxConnectionAgeGrace = e.duration(GRPC_MAX_CONNECTION_AGE_GRACE, c.GRPC.MaxConnectionAgeGrace)
+	c.GRPC.KeepaliveTime = e.duration(GRPC_KEEPALIVE_TIME, c.GRPC.KeepaliveTime)
+	c.GRPC.KeepaliveMinTime = e.duration(GRPC_KEEPALIVE_MIN_TIME, c.GRPC.KeepaliveMinTime)
+	c.GRPC.PermitWithoutStream = e.bool(GRPC_PERMIT_WITHOUT_STREAM, c.GRPC.PermitWithoutStream)
+	c.GRPC.MaxConcurrentStreams = e.int(GRPC_MAX_CONCURRENT_STREAMS, c.GRPC.MaxConcurrentStreams)
+	c.GRPC.ConnectionTimeout = e.duration(GRPC_CONNECTION_TIMEOUT, c.GRPC.ConnectionTimeout)
+	c.GRPC.MaxRecvMsgSize = e.int(GRPC_MAX_RECV_MSG_SIZE, c.GRPC.MaxRecvMsgSize)
+	c.GRPC.MaxSendMsgSize = e.int(GRPC_MAX_SEND_MSG_SIZE, c.GRPC.MaxSendMsgSize)
+	c.GRPC.ListenAddrs = e.list(GRPC_LISTEN_ADDRS, c.GRPC.ListenAddrs)
+	c.GRPC.UnixSocket = os.Getenv(GRPC_UNIX_SOCKET)
+	c.GRPC.UnixSocketMode = e.fileMode(GRPC_UNIX_SOCKET_MODE, c.GRPC.UnixSocketMode)
+
+	if err := validationError(append(e.errs, validate(c)...)); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// postgresCredentialsRequired reports what the chosen credentials provider
+// is missing
+func postgresCredentialsRequired(pg Postgres) []FieldError {
+	missing := func(env, field, with string) FieldError {
+		return FieldError{Env: env, Field: "Postgres." + field, Rule: "required", Message: "is required with POSTGRES_CREDENTIALS=" + with}
+	}
+
+	var errs []FieldError
+	switch pg.Credentials {
+	case "static":
+		if pg.PostgresPassword == "" {
+			errs = append(errs, FieldError{Env: POSTGRES_PASSWORD, Field: "Postgres.PostgresPassword", Rule: "required", Message: "is required"})
+		}
+	case "file":
+		if pg.PasswordFile == "" {
+			errs = append(errs, missing(POSTGRES_PASSWORD_FILE, "PasswordFile", "file"))
+		}
+	case "vault":
+		if pg.VaultAddr == "" {
+			errs = append(errs, missing(VAULT_ADDR, "VaultAddr", "vault"))
+		}
+		if pg.VaultPath == "" {
+			errs = append(errs, missing(POSTGRES_VAULT_PATH, "VaultPath", "vault"))
+		}
+		if pg.VaultToken == "" && pg.VaultTokenFile == "" {
+			errs = append(errs, missing(VAULT_TOKEN, "VaultToken", "vault, or VAULT_TOKEN_FILE"))
+		}
+	case "rds-iam":
+		if pg.AWSRegion == "" {
+			errs = append(errs, missing(AWS_REGION, "AWSRegion", "rds-iam"))
+		}
+	}
+	return errs
 }
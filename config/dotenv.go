@@ -0,0 +1,87 @@
+// By Emran A. Hamdan, Lead Architect
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadDotEnv sets the KEY=VALUE pairs of a .env file for local development.
+//
+// Precedence, highest first:
+//
+//  1. process env (export.sh, docker, k8s)
+//  2. the .env file
+//  3. defaults in Load
+//
+// so a value that is already set, even to an empty string, is never
+// overwritten. A missing file is not an error. Returns the keys it set.
+func LoadDotEnv(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var set []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		key, value, ok, err := parseDotEnvLine(scanner.Text())
+		if err != nil {
+			return set, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if !ok {
+			continue
+		}
+		if _, exists := os.LookupEnv(key); exists {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return set, err
+		}
+		set = append(set, key)
+	}
+	return set, scanner.Err()
+}
+
+// parseDotEnvLine understands the subset docker compose env_file and
+// export.sh share: comments, an optional export prefix and quoted values
+func parseDotEnvLine(line string) (key, value string, ok bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false, nil
+	}
+	line = strings.TrimPrefix(line, "export ")
+
+	key, value, found := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" || strings.ContainsAny(key, " \t") {
+		return "", "", false, fmt.Errorf("expected KEY=VALUE, got %q", line)
+	}
+
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		quote := value[0]
+		end := strings.IndexByte(value[1:], quote)
+		if end < 0 {
+			return "", "", false, fmt.Errorf("unterminated quote in %s", key)
+		}
+		value = value[1 : end+1]
+		if quote == '"' {
+			value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value)
+		}
+		return key, value, true, nil
+	}
+
+	// unquoted values may carry a trailing " # comment"
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return key, value, true, nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeEnvFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadDotEnvProcessEnvWins(t *testing.T) {
+	path := writeEnvFile(t, `
+# comment
+export BLUEPRINT_DOTENV_A=from-file
+BLUEPRINT_DOTENV_B="quoted # not a comment"
+BLUEPRINT_DOTENV_C=plain # trailing comment
+BLUEPRINT_DOTENV_D='single'
+`)
+	t.Setenv("BLUEPRINT_DOTENV_A", "from-process")
+	for _, k := range []string{"BLUEPRINT_DOTENV_B", "BLUEPRINT_DOTENV_C", "BLUEPRINT_DOTENV_D"} {
+		k := k
+		t.Cleanup(func() { os.Unsetenv(k) })
+	}
+
+	set, err := LoadDotEnv(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"BLUEPRINT_DOTENV_B", "BLUEPRINT_DOTENV_C", "BLUEPRINT_DOTENV_D"}, set)
+	assert.Equal(t, "from-process", os.Getenv("BLUEPRINT_DOTENV_A"))
+	assert.Equal(t, "quoted # not a comment", os.Getenv("BLUEPRINT_DOTENV_B"))
+	assert.Equal(t, "plain", os.Getenv("BLUEPRINT_DOTENV_C"))
+	assert.Equal(t, "single", os.Getenv("BLUEPRINT_DOTENV_D"))
+}
+
+func TestLoadDotEnvMissingFile(t *testing.T) {
+	set, err := LoadDotEnv(filepath.Join(t.TempDir(), "nope.env"))
+	assert.NoError(t, err)
+	assert.Empty(t, set)
+}
+
+func TestLoadDotEnvBadLine(t *testing.T) {
+	path := writeEnvFile(t, "GOOD=1\nnot a pair\n")
+	t.Cleanup(func() { os.Unsetenv("GOOD") })
+
+	_, err := LoadDotEnv(path)
+	assert.ErrorContains(t, err, ":2: expected KEY=VALUE")
+}
+
+func TestPrintMasksSecrets(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv(ENV_FILE, filepath.Join(t.TempDir(), "none"))
+
+	c, err := Load()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, Print(&buf, c))
+
+	out := buf.String()
+	assert.NotContains(t, out, "secret")
+	assert.Regexp(t, `POSTGRES_PASSWORD\s+Postgres.PostgresPassword\s+\*{8}`, out)
+	assert.Regexp(t, `POSTGRES_USER\s+Postgres.PostgresUser\s+dbuser`, out)
+	assert.Regexp(t, `GRPC_MAX_CONNECTION_IDLE\s+GRPC.MaxConnectionIdle\s+15s`, out)
+}
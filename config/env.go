@@ -0,0 +1,140 @@
+// By Emran A. Hamdan, Lead Architect
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetString returns the env value or def when it is not set
+func GetString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// GetInt returns the env value as int, def when it is not set or not a number
+func GetInt(key string, def int) int {
+	return (&env{}).int(key, def)
+}
+
+// GetBool accepts everything strconv.ParseBool does (1, t, true, 0, f, false...)
+func GetBool(key string, def bool) bool {
+	return (&env{}).bool(key, def)
+}
+
+// GetFloat returns the env value as float64, def when it is not set or invalid
+func GetFloat(key string, def float64) float64 {
+	return (&env{}).float(key, def)
+}
+
+// GetDuration accepts Go durations ("1m30s") and plain numbers as seconds,
+// which is how k8s and most ops tooling write timeouts
+func GetDuration(key string, def time.Duration) time.Duration {
+	return (&env{}).duration(key, def)
+}
+
+// GetList splits a comma separated value, blanks are dropped
+func GetList(key string, def []string) []string {
+	return (&env{}).list(key, def)
+}
+
+// env reads typed values and remembers every one that did not parse so Load
+// can report them together with the validation errors
+type env struct {
+	errs []FieldError
+}
+
+func (e *env) int(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.fail(key, "int", "must be a whole number, got %q", v)
+		return def
+	}
+	return n
+}
+
+func (e *env) bool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail(key, "bool", "must be true or false, got %q", v)
+		return def
+	}
+	return b
+}
+
+func (e *env) float(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.fail(key, "float", "must be a number, got %q", v)
+		return def
+	}
+	return f
+}
+
+func (e *env) duration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	e.fail(key, "duration", "must be a duration like 30s or a number of seconds, got %q", v)
+	return def
+}
+
+func (e *env) list(key string, def []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// fileMode reads an octal permission like 0660
+func (e *env) fileMode(key string, def os.FileMode) os.FileMode {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	m, err := strconv.ParseUint(v, 8, 32)
+	if err != nil || m > 0o777 {
+		e.fail(key, "filemode", "must be an octal permission like 0660, got %q", v)
+		return def
+	}
+	return os.FileMode(m)
+}
+
+func (e *env) fail(key, rule, format string, value string) {
+	e.errs = append(e.errs, FieldError{
+		Env:     key,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, value),
+	})
+}
@@ -0,0 +1,64 @@
+// By Emran A. Hamdan, Lead Architect
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"text/tabwriter"
+)
+
+const masked = "********"
+
+// Print writes the effective config as an ENV / FIELD / VALUE table. Fields
+// tagged `secret:"true"` are masked, unset secrets stay empty so it is still
+// visible whether they were given.
+func Print(w io.Writer, c *Config) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENV\tFIELD\tVALUE")
+	visit(reflect.ValueOf(c).Elem(), "", func(env, field, value string) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", env, field, value)
+	})
+	return tw.Flush()
+}
+
+// Fields is the effective config by field path, e.g. "Redis.PoolSize",
+// masked like Print, for logging it at startup
+func Fields(c *Config) map[string]string {
+	fields := make(map[string]string)
+	visit(reflect.ValueOf(c).Elem(), "", func(env, field, value string) {
+		fields[field] = value
+	})
+	return fields
+}
+
+// visit calls fn with every leaf field, env is "-" for untagged ones
+func visit(v reflect.Value, path string, fn func(env, field, value string)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+
+		name := sf.Name
+		if path != "" {
+			name = path + "." + sf.Name
+		}
+
+		if fv.Kind() == reflect.Struct {
+			visit(fv, name, fn)
+			continue
+		}
+
+		env := sf.Tag.Get("env")
+		if env == "" {
+			env = "-"
+		}
+
+		value := fmt.Sprint(fv.Interface())
+		if sf.Tag.Get("secret") == "true" && !fv.IsZero() {
+			value = masked
+		}
+
+		fn(env, name, value)
+	}
+}
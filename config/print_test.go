@@ -0,0 +1,26 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldsMasksSecrets(t *testing.T) {
+	setRequiredEnv(t)
+	c, err := Load()
+	require.NoError(t, err)
+
+	fields := Fields(c)
+	assert.Equal(t, masked, fields["Redis.RedisPassword"])
+	assert.Equal(t, masked, fields["Postgres.PostgresPassword"])
+	assert.Equal(t, "", fields["Admin.Token"], "unset secrets stay empty")
+	assert.Equal(t, "3000", fields["GRPC.Port"])
+
+	var out bytes.Buffer
+	require.NoError(t, Print(&out, c))
+	assert.NotContains(t, out.String(), "secret")
+	assert.Contains(t, out.String(), "REDIS_PASSWORD")
+}
@@ -0,0 +1,83 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package config
+
+import "time"
+
+// Profiles for TUNING_PROFILE. Each moves the defaults of the pools,
+// keepalive, sampling, cache ttls, garbage collector and logging together,
+// so they agree with each other; any of those env vars set explicitly
+// still wins. Without a profile the package defaults apply.
+var Profiles = map[string]func(c *Config){
+	// short tail latencies over raw volume: connections are kept warm so
+	// no call waits on a dial, timeouts fail fast rather than queue, and
+	// dead peers are noticed within seconds. Stale cache entries are
+	// served while they refresh instead of making a caller wait on the
+	// loader. A higher GOGC under a memory limit means fewer collections
+	// and fewer assists on the hot path.
+	"low-latency": func(c *Config) {
+		c.Redis.PoolSize = 100
+		c.Redis.MinIdleConn = 25
+		c.Redis.PoolTimeout = 500 * time.Millisecond
+		c.Redis.ReadTimeout = 500 * time.Millisecond
+		c.Redis.WriteTimeout = 500 * time.Millisecond
+		c.Redis.MaxRetries = 1
+
+		// as many idle as open, the pool never closes one only to dial it
+		// again under the next burst
+		c.Postgres.MaxOpenConns = 50
+		c.Postgres.MaxIdleConns = 50
+		c.Postgres.ConnMaxLifetime = 30 * time.Minute
+
+		c.GRPC.KeepaliveTime = 5 * time.Second
+		c.GRPC.Timeout = time.Second
+		c.GRPC.MaxConnectionIdle = 5 * time.Minute
+		c.GRPC.MaxConnectionAge = 10 * time.Minute
+
+		c.ErrorTracking.SampleRate = 1
+
+		c.Cache.TTL = 30 * time.Minute
+		c.Cache.StaleWindow = time.Minute
+
+		c.Runtime.GCPercent = 200
+		c.Runtime.MemoryLimitRatio = 0.8
+
+		c.Compression.Preset = "latency"
+		c.Logger.Async = true
+		c.Logger.AsyncBufferSize = 4096
+	},
+	// the most calls per core: bigger pools with fewer idle connections,
+	// patient timeouts and retries so bursts queue rather than fail, and
+	// long lived connections with lazy keepalive. Errors are sampled, a
+	// burst at volume would flood the tracker. Longer cache ttls and
+	// compressed values spare redis and the network, a GOGC of 400 under
+	// a memory limit leaves the CPU to requests.
+	"throughput": func(c *Config) {
+		c.Redis.PoolSize = 200
+		c.Redis.MinIdleConn = 10
+		c.Redis.PoolTimeout = 5 * time.Second
+		c.Redis.ReadTimeout = 3 * time.Second
+		c.Redis.WriteTimeout = 3 * time.Second
+		c.Redis.MaxRetries = 3
+
+		c.Postgres.MaxOpenConns = 100
+		c.Postgres.MaxIdleConns = 20
+		c.Postgres.ConnMaxLifetime = time.Hour
+
+		c.GRPC.KeepaliveTime = 30 * time.Second
+		c.GRPC.Timeout = 10 * time.Second
+		c.GRPC.MaxConnectionIdle = 15 * time.Minute
+		c.GRPC.MaxConnectionAge = 30 * time.Minute
+
+		c.ErrorTracking.SampleRate = 0.1
+
+		c.Cache.TTL = 2 * time.Hour
+		c.Cache.StaleWindow = 5 * time.Minute
+
+		c.Runtime.GCPercent = 400
+		c.Runtime.MemoryLimitRatio = 0.9
+
+		c.Compression.Preset = "storage"
+		c.Logger.Async = true
+		c.Logger.AsyncBufferSize = 16384
+	},
+}
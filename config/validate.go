@@ -0,0 +1,221 @@
+// By Emran A. Hamdan, Lead Architect
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError is one broken config value
+type FieldError struct {
+	Env     string
+	Field   string
+	Rule    string
+	Message string
+}
+
+func (f FieldError) String() string {
+	switch {
+	case f.Env == "":
+		return fmt.Sprintf("%s: %s", f.Field, f.Message)
+	case f.Field == "":
+		return fmt.Sprintf("%s: %s", f.Env, f.Message)
+	}
+	return fmt.Sprintf("%s (%s): %s", f.Env, f.Field, f.Message)
+}
+
+// ValidationError carries every problem found, not just the first one
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid config:")
+	for _, f := range e.Errors {
+		b.WriteString("\n  ")
+		b.WriteString(f.String())
+	}
+	return b.String()
+}
+
+// Validate checks the `validate` struct tags. Rules are comma separated:
+//
+//	required        value must be set
+//	hostport        host:port with a numeric port
+//	port            number between 1 and 65535
+//	url             absolute url with scheme and host
+//	oneof=a b c     value must be one of the listed words
+//	file            path of an existing file, e.g. a certificate
+//	min=N / max=N   bound for numbers and durations (N may be "5s")
+//
+// Every rule but required is skipped for empty values, on lists the rules
+// apply to each element.
+func Validate(c *Config) error {
+	return validationError(validate(c))
+}
+
+func validate(c *Config) []FieldError {
+	var errs []FieldError
+	walk(reflect.ValueOf(c).Elem(), "", &errs)
+	return errs
+}
+
+func validationError(errs []FieldError) error {
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func walk(v reflect.Value, path string, errs *[]FieldError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+
+		name := sf.Name
+		if path != "" {
+			name = path + "." + sf.Name
+		}
+
+		if fv.Kind() == reflect.Struct {
+			walk(fv, name, errs)
+			continue
+		}
+
+		tag := sf.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		env := sf.Tag.Get("env")
+		for _, rule := range strings.Split(tag, ",") {
+			if msg := checkField(rule, fv); msg != "" {
+				*errs = append(*errs, FieldError{
+					Env:     env,
+					Field:   name,
+					Rule:    rule,
+					Message: msg,
+				})
+			}
+		}
+	}
+}
+
+// checkField applies rules other than required to every element of a list
+func checkField(rule string, v reflect.Value) string {
+	if v.Kind() != reflect.Slice || rule == "required" {
+		return check(rule, v)
+	}
+
+	var msgs []string
+	for i := 0; i < v.Len(); i++ {
+		if msg := check(rule, v.Index(i)); msg != "" {
+			msgs = append(msgs, fmt.Sprintf("%q %s", fmt.Sprint(v.Index(i).Interface()), msg))
+		}
+	}
+	return strings.Join(msgs, ", ")
+}
+
+func check(rule string, v reflect.Value) string {
+	name, arg, _ := strings.Cut(rule, "=")
+
+	if name == "required" {
+		if v.IsZero() {
+			return "is required"
+		}
+		return ""
+	}
+
+	if v.IsZero() {
+		return ""
+	}
+
+	switch name {
+	case "hostport":
+		_, port, err := net.SplitHostPort(fmt.Sprint(v.Interface()))
+		if err != nil {
+			return "must be host:port"
+		}
+		if !validPort(port) {
+			return fmt.Sprintf("has invalid port %q", port)
+		}
+	case "port":
+		if !validPort(fmt.Sprint(v.Interface())) {
+			return "must be a port between 1 and 65535"
+		}
+	case "url":
+		u, err := url.Parse(fmt.Sprint(v.Interface()))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "must be an absolute url"
+		}
+	case "oneof":
+		value := fmt.Sprint(v.Interface())
+		for _, allowed := range strings.Fields(arg) {
+			if value == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s], got %q", arg, value)
+	case "file":
+		info, err := os.Stat(fmt.Sprint(v.Interface()))
+		if err != nil || info.IsDir() {
+			return "must be an existing file"
+		}
+	case "min", "max":
+		return checkBound(name, arg, v)
+	default:
+		return fmt.Sprintf("unknown validation rule %q", name)
+	}
+
+	return ""
+}
+
+func checkBound(name, arg string, v reflect.Value) string {
+	var value, bound float64
+
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return fmt.Sprintf("bad %s bound %q", name, arg)
+		}
+		value, bound = float64(v.Int()), float64(d)
+	} else {
+		b, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf("bad %s bound %q", name, arg)
+		}
+		bound = b
+
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			value = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			value = v.Float()
+		default:
+			return fmt.Sprintf("%s does not apply to %s", name, v.Kind())
+		}
+	}
+
+	if name == "min" && value < bound {
+		return fmt.Sprintf("must be at least %s", arg)
+	}
+	if name == "max" && value > bound {
+		return fmt.Sprintf("must be at most %s", arg)
+	}
+	return ""
+}
+
+func validPort(s string) bool {
+	p, err := strconv.Atoi(s)
+	return err == nil && p > 0 && p <= 65535
+}
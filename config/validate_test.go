@@ -0,0 +1,513 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv(GPRC_HOST, "127.0.0.1")
+	t.Setenv(GRPC_PORT, "3000")
+	t.Setenv(REDIS_URL, "127.0.0.1:6379")
+	t.Setenv(REDIS_PASSWORD, "secret")
+	t.Setenv(POSTGRES_HOST, "127.0.0.1")
+	t.Setenv(POSTGRES_PORT, "5432")
+	t.Setenv(POSTGRES_USER, "dbuser")
+	t.Setenv(POSTGRES_PASSWORD, "secret")
+	t.Setenv(POSTGRES_DB, "platform_core")
+}
+
+func TestLoadValid(t *testing.T) {
+	setRequiredEnv(t)
+
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "3000", c.GRPC.Port)
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv(GRPC_PORT, "")
+	t.Setenv(POSTGRES_DB, "")
+	t.Setenv(REDIS_URL, "localhost")
+	t.Setenv(APP_ENV, "qa")
+	t.Setenv(SENTRY_DSN, "not a url")
+	t.Setenv(ERROR_TRACKING_SAMPLE_RATE, "2")
+
+	_, err := Load()
+	require.Error(t, err)
+
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+
+	envs := map[string]string{}
+	for _, f := range verr.Errors {
+		envs[f.Env] = f.Rule
+	}
+	assert.Equal(t, map[string]string{
+		GRPC_PORT:                  "required",
+		POSTGRES_DB:                "required",
+		REDIS_URL:                  "hostport",
+		APP_ENV:                    "oneof=development staging production",
+		SENTRY_DSN:                 "url",
+		ERROR_TRACKING_SAMPLE_RATE: "max=1",
+	}, envs)
+
+	assert.Contains(t, err.Error(), "GRPC_PORT (GRPC.Port): is required")
+}
+
+func TestNewConfigPanicsWithList(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv(POSTGRES_PORT, "99999")
+
+	assert.PanicsWithError(t, "invalid config:\n  POSTGRES_PORT (Postgres.PostgresPort): must be a port between 1 and 65535", func() {
+		NewConfig()
+	})
+}
+
+func TestLoadTypedValues(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv(REDIS_POOL_SIZE, "42")
+	t.Setenv(REDIS_POOL_TIMEOUT, "15")
+	t.Setenv(POSTGRES_CONN_MAX_LIFETIME, "90m")
+	t.Setenv(LOG_ASYNC, "true")
+	t.Setenv(POSTGRES_QUERY_BUDGETS, "List=500,Get=20")
+
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 100, c.Postgres.QueryBudget)
+	assert.Equal(t, []string{"List=500", "Get=20"}, c.Postgres.QueryBudgets)
+	assert.Equal(t, 42, c.Redis.PoolSize)
+	assert.Equal(t, 15*time.Second, c.Redis.PoolTimeout)
+	assert.Equal(t, 90*time.Minute, c.Postgres.ConnMaxLifetime)
+	assert.True(t, c.Logger.Async)
+	assert.Equal(t, 15*time.Second, c.GRPC.MaxConnectionIdle)
+}
+
+func TestLoadReportsUnparsableValues(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv(REDIS_POOL_SIZE, "lots")
+	t.Setenv(GRPC_MAX_CONNECTION_AGE, "soon")
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `REDIS_POOL_SIZE: must be a whole number, got "lots"`)
+	assert.Contains(t, err.Error(), `GRPC_MAX_CONNECTION_AGE: must be a duration like 30s or a number of seconds, got "soon"`)
+}
+
+func TestGetHelpersFallBack(t *testing.T) {
+	t.Setenv("BLUEPRINT_TEST_INT", "x")
+	t.Setenv("BLUEPRINT_TEST_BOOL", "1")
+
+	assert.Equal(t, 7, GetInt("BLUEPRINT_TEST_INT", 7))
+	assert.True(t, GetBool("BLUEPRINT_TEST_BOOL", false))
+	assert.Equal(t, time.Minute, GetDuration("BLUEPRINT_TEST_UNSET", time.Minute))
+	assert.Equal(t, "def", GetString("BLUEPRINT_TEST_UNSET", "def"))
+}
+
+func TestLoadGRPCServerParams(t *testing.T) {
+	setRequiredEnv(t)
+
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, c.GRPC.KeepaliveMinTime)
+	assert.True(t, c.GRPC.PermitWithoutStream)
+	assert.Equal(t, 120*time.Second, c.GRPC.ConnectionTimeout)
+	assert.Zero(t, c.GRPC.MaxConcurrentStreams)
+
+	t.Setenv(GRPC_MAX_CONCURRENT_STREAMS, "-1")
+	t.Setenv(GRPC_KEEPALIVE_TIME, "500ms")
+	t.Setenv(GRPC_PERMIT_WITHOUT_STREAM, "false")
+
+	c, err = Load()
+	require.Error(t, err)
+	assert.False(t, c.GRPC.PermitWithoutStream)
+	assert.Contains(t, err.Error(), "GRPC_MAX_CONCURRENT_STREAMS (GRPC.MaxConcurrentStreams): must be at least 0")
+	assert.Contains(t, err.Error(), "GRPC_KEEPALIVE_TIME (GRPC.KeepaliveTime): must be at least 1s")
+}
+
+func TestLoadGRPCListeners(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv(GRPC_LISTEN_ADDRS, "0.0.0.0:3000, [::1]:3000,")
+	t.Setenv(GRPC_UNIX_SOCKET_MODE, "0600")
+
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0.0.0.0:3000", "[::1]:3000"}, c.GRPC.ListenAddrs)
+	assert.Equal(t, os.FileMode(0o600), c.GRPC.UnixSocketMode)
+
+	t.Setenv(GRPC_LISTEN_ADDRS, "0.0.0.0:3000,localhost")
+	t.Setenv(GRPC_UNIX_SOCKET_MODE, "rw")
+
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `GRPC_LISTEN_ADDRS (GRPC.ListenAddrs): "localhost" must be host:port`)
+	assert.Contains(t, err.Error(), `GRPC_UNIX_SOCKET_MODE: must be an octal permission like 0660, got "rw"`)
+}
+
+func TestDebugFeaturesFollowEnvironment(t *testing.T) {
+	setRequiredEnv(t)
+
+	c, err := Load()
+	require.NoError(t, err)
+	on := !ProductionBuild
+	assert.Equal(t, Debug{Reflection: on, VerboseErrors: on, Endpoints: on, APIDocs: on}, c.Debug)
+
+	t.Setenv(APP_ENV, "production")
+	c, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, Debug{}, c.Debug)
+
+	t.Setenv(GRPC_REFLECTION, "true")
+	c, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, on, c.Debug.Reflection)
+	assert.False(t, c.Debug.VerboseErrors)
+}
+
+func TestLoadFaults(t *testing.T) {
+	setRequiredEnv(t)
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, Faults{}, c.Faults, "off by default, in development too")
+
+	t.Setenv(FAULT_RULES, "redis:error@0.1")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "FAULT_RULES")
+
+	t.Setenv(FAULT_INJECTION, "true")
+	c, err = Load()
+	require.NoError(t, err)
+	if ProductionBuild {
+		assert.Equal(t, Faults{}, c.Faults, "never on in production builds")
+	} else {
+		assert.Equal(t, Faults{Enabled: true, Rules: "redis:error@0.1"}, c.Faults)
+	}
+
+	t.Setenv(APP_ENV, "production")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "FAULT_INJECTION")
+}
+
+func TestLoadProfile(t *testing.T) {
+	setRequiredEnv(t)
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Empty(t, c.Setting.Profile)
+	assert.Zero(t, c.Cache.TTL, "the cache's default")
+
+	for name := range Profiles {
+		t.Setenv(TUNING_PROFILE, name)
+		c, err := Load()
+		require.NoError(t, err, name)
+		assert.Equal(t, name, c.Setting.Profile)
+	}
+
+	t.Setenv(TUNING_PROFILE, "throughput")
+	c, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, 200, c.Redis.PoolSize)
+	assert.Equal(t, 2*time.Hour, c.Cache.TTL)
+	assert.Equal(t, "storage", c.Compression.Preset)
+
+	// explicit settings win over the profile
+	t.Setenv(REDIS_POOL_SIZE, "50")
+	t.Setenv(COMPRESSION_PRESET, "latency")
+	c, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, 50, c.Redis.PoolSize)
+	assert.Equal(t, "latency", c.Compression.Preset)
+	assert.Equal(t, 400, c.Runtime.GCPercent)
+
+	t.Setenv(TUNING_PROFILE, "fast")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TUNING_PROFILE")
+}
+
+func TestLoadPostgresTLS(t *testing.T) {
+	setRequiredEnv(t)
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(ca, []byte("pem"), 0o600))
+
+	t.Setenv(POSTGRES_SSLMODE, "verify-full")
+	t.Setenv(POSTGRES_SSLROOTCERT, ca)
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "verify-full", c.Postgres.SSLMode)
+	assert.Equal(t, ca, c.Postgres.SSLRootCert)
+
+	t.Setenv(POSTGRES_SSLMODE, "on")
+	t.Setenv(POSTGRES_SSLROOTCERT, filepath.Join(t.TempDir(), "missing.pem"))
+	t.Setenv(POSTGRES_SSLCERT, ca)
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "POSTGRES_SSLMODE (Postgres.SSLMode): must be one of")
+	assert.Contains(t, err.Error(), "POSTGRES_SSLROOTCERT (Postgres.SSLRootCert): must be an existing file")
+	assert.Contains(t, err.Error(), "POSTGRES_SSLCERT and POSTGRES_SSLKEY go together")
+}
+
+func TestLoadPostgresCredentials(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv(POSTGRES_PASSWORD, "")
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "POSTGRES_PASSWORD (Postgres.PostgresPassword): is required")
+
+	t.Setenv(POSTGRES_CREDENTIALS, "vault")
+	t.Setenv(VAULT_ADDR, "https://vault.internal:8200")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "POSTGRES_VAULT_PATH (Postgres.VaultPath): is required with POSTGRES_CREDENTIALS=vault")
+	assert.Contains(t, err.Error(), "VAULT_TOKEN (Postgres.VaultToken): is required")
+
+	t.Setenv(POSTGRES_VAULT_PATH, "database/creds/blueprint")
+	t.Setenv(VAULT_TOKEN, "s.token")
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "vault", c.Postgres.Credentials)
+	assert.Equal(t, time.Minute, c.Postgres.CredentialsRefresh)
+}
+
+func TestLoadNotify(t *testing.T) {
+	setRequiredEnv(t)
+	c, err := Load()
+	require.NoError(t, err)
+	assert.False(t, c.Notify.Enabled())
+
+	t.Setenv(NOTIFY_SMTP_ADDR, "smtp.internal:587")
+	t.Setenv(NOTIFY_TELEGRAM_TOKEN, "bot-token")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NOTIFY_SMTP_TO (Notify.SMTPTo): NOTIFY_SMTP_FROM and NOTIFY_SMTP_TO are required with NOTIFY_SMTP_ADDR")
+	assert.Contains(t, err.Error(), "NOTIFY_TELEGRAM_CHAT_ID (Notify.TelegramChatID): is required with NOTIFY_TELEGRAM_TOKEN")
+
+	t.Setenv(NOTIFY_SMTP_FROM, "alerts@example.com")
+	t.Setenv(NOTIFY_SMTP_TO, "ops@example.com,risk@example.com")
+	t.Setenv(NOTIFY_TELEGRAM_CHAT_ID, "-100123")
+	c, err = Load()
+	require.NoError(t, err)
+	assert.True(t, c.Notify.Enabled())
+	assert.Equal(t, []string{"ops@example.com", "risk@example.com"}, c.Notify.SMTPTo)
+	assert.Equal(t, 30, c.Notify.RateLimit)
+}
+
+func TestLoadEventBus(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv(EVENTBUS_BACKEND, "kafka")
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "EVENTBUS_KAFKA_BROKERS (EventBus.KafkaBrokers): is required with EVENTBUS_BACKEND=kafka")
+
+	t.Setenv(EVENTBUS_KAFKA_BROKERS, "kafka-0:9092,kafka-1")
+	t.Setenv(EVENTBUS_MAX_DELIVERIES, "-1")
+	t.Setenv(EVENTBUS_FORMAT, "avro")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"kafka-1" must be host:port`)
+	assert.Contains(t, err.Error(), "EVENTBUS_MAX_DELIVERIES")
+	assert.Contains(t, err.Error(), "EVENTBUS_FORMAT")
+
+	t.Setenv(EVENTBUS_KAFKA_BROKERS, "kafka-0:9092,kafka-1:9092")
+	t.Setenv(EVENTBUS_MAX_DELIVERIES, "5")
+	t.Setenv(EVENTBUS_FORMAT, "cloudevents")
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kafka-0:9092", "kafka-1:9092"}, c.EventBus.KafkaBrokers)
+	assert.Equal(t, 5, c.EventBus.MaxDeliveries)
+	assert.Equal(t, time.Second, c.EventBus.Redelivery)
+	assert.Equal(t, "cloudevents", c.EventBus.Format)
+	assert.Equal(t, "backward", c.EventBus.SchemaCompatibility)
+	assert.Equal(t, "none", c.EventBus.DeadLetterStore, "kafka keeps no dead letters by default")
+
+	t.Setenv(EVENTBUS_BACKEND, "redis")
+	c, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, "redis", c.EventBus.DeadLetterStore)
+	assert.Equal(t, 10000, c.EventBus.DeadLetterMaxLen)
+
+	t.Setenv(EVENTBUS_DEADLETTER_STORE, "kafka")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "EVENTBUS_DEADLETTER_STORE")
+}
+
+func TestLoadLoadShed(t *testing.T) {
+	setRequiredEnv(t)
+	c, err := Load()
+	require.NoError(t, err)
+	assert.False(t, c.LoadShed.Enabled)
+	assert.Equal(t, []string{"grpc.health.v1.Health"}, c.LoadShed.Exempt)
+	assert.Equal(t, "x-priority", c.LoadShed.PriorityHeader)
+
+	t.Setenv(LOAD_SHED_MIN_LIMIT, "50")
+	t.Setenv(LOAD_SHED_MAX_LIMIT, "10")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must not be below LOAD_SHED_MIN_LIMIT")
+}
+
+func TestLoadRateLimit(t *testing.T) {
+	setRequiredEnv(t)
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 0.2, c.RateLimit.WarnAt)
+
+	t.Setenv(RATE_LIMIT_WARN_AT, "0")
+	c, err = Load()
+	require.NoError(t, err)
+	assert.Zero(t, c.RateLimit.WarnAt, "0 disables the warning")
+
+	t.Setenv(RATE_LIMIT_WARN_AT, "1.5")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "RATE_LIMIT_WARN_AT")
+}
+
+func TestLoadConcurrency(t *testing.T) {
+	setRequiredEnv(t)
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Zero(t, c.Concurrency.Limit, "off by default")
+	assert.Equal(t, "user", c.Concurrency.Key)
+	assert.Equal(t, "memory", c.Concurrency.Store)
+	assert.Equal(t, []string{"grpc.health.v1.Health"}, c.Concurrency.Exempt)
+
+	t.Setenv(CONCURRENCY_LIMIT, "5")
+	t.Setenv(CONCURRENCY_STORE, "redis")
+	c, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, 5, c.Concurrency.Limit)
+	assert.Equal(t, "redis", c.Concurrency.Store)
+
+	t.Setenv(CONCURRENCY_STORE, "etcd")
+	t.Setenv(CONCURRENCY_LEASE_TTL, "1s")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CONCURRENCY_STORE")
+	assert.Contains(t, err.Error(), "CONCURRENCY_LEASE_TTL")
+}
+
+func TestLoadRuntime(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv(RUNTIME_GC_PERCENT, "-1")
+	t.Setenv(RUNTIME_MEMORY_LIMIT_RATIO, "0.9")
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, -1, c.Runtime.GCPercent)
+	assert.Equal(t, 0.9, c.Runtime.MemoryLimitRatio)
+
+	t.Setenv(RUNTIME_MEMORY_LIMIT_RATIO, "1.5")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "RUNTIME_MEMORY_LIMIT_RATIO")
+}
+
+func TestLoadWarmup(t *testing.T) {
+	setRequiredEnv(t)
+	c, err := Load()
+	require.NoError(t, err)
+	assert.False(t, c.Warmup.Enabled)
+	assert.Equal(t, 5, c.Warmup.DBConns)
+	assert.Equal(t, 10*time.Second, c.Warmup.Timeout)
+
+	t.Setenv(WARMUP_ENABLED, "true")
+	t.Setenv(WARMUP_CACHE_KEYS, "config:fees,config:symbols")
+	c, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"config:fees", "config:symbols"}, c.Warmup.CacheKeys)
+
+	t.Setenv(POSTGRES_MAX_IDLE_CONNS, "2")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "WARMUP_DB_CONNS")
+}
+
+func TestLoadCompression(t *testing.T) {
+	setRequiredEnv(t)
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, Compression{}, c.Compression)
+
+	t.Setenv(COMPRESSION_PRESET, "storage")
+	t.Setenv(CACHE_COMPRESSION, "snappy")
+	t.Setenv(CACHE_COMPRESS_MIN_BYTES, "2048")
+	c, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, Compression{Preset: "storage", Cache: "snappy", CacheMinBytes: 2048}, c.Compression)
+
+	t.Setenv(COMPRESSION_PRESET, "fast")
+	t.Setenv(LOG_COMPRESSION, "lz4")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "COMPRESSION_PRESET")
+	assert.Contains(t, err.Error(), "LOG_COMPRESSION")
+}
+
+func TestLoadStmtCache(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv(POSTGRES_STMT_CACHE_SIZE, "200")
+	t.Setenv(POSTGRES_STMT_CACHE_TTL, "10m")
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 200, c.Postgres.StmtCacheSize)
+	assert.Equal(t, 10*time.Minute, c.Postgres.StmtCacheTTL)
+
+	t.Setenv(POSTGRES_STMT_CACHE_SIZE, "-1")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "POSTGRES_STMT_CACHE_SIZE")
+}
+
+func TestLoadQueryComment(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv(POSTGRES_QUERY_COMMENT, "trace")
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "trace", c.Postgres.QueryComment)
+
+	t.Setenv(POSTGRES_QUERY_COMMENT, "true")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "POSTGRES_QUERY_COMMENT")
+}
+
+func TestLoadHealth(t *testing.T) {
+	setRequiredEnv(t)
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, Health{Confirm: 2, NotifyInterval: 5 * time.Minute}, c.Health)
+
+	t.Setenv(HEALTH_NOTIFY_INTERVAL, "-1m")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "HEALTH_NOTIFY_INTERVAL")
+}
+
+func TestLoadMaintenance(t *testing.T) {
+	setRequiredEnv(t)
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "blueprint:maintenance", c.Maintenance.Key)
+	assert.Equal(t, []string{"Version", "Call", "GetAccount", "grpc.health.v1.Health"}, c.Maintenance.ReadOnly)
+
+	t.Setenv(MAINTENANCE_KEY, "")
+	t.Setenv(MAINTENANCE_READ_ONLY, "blueprint.Blueprint/Version, GetQuote")
+	c, err = Load()
+	require.NoError(t, err)
+	assert.Empty(t, c.Maintenance.Key, "set but empty is per replica")
+	assert.Equal(t, []string{"blueprint.Blueprint/Version", "GetQuote"}, c.Maintenance.ReadOnly)
+
+	t.Setenv(MAINTENANCE_RETRY_AFTER, "500ms")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "MAINTENANCE_RETRY_AFTER")
+}
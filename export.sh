@@ -15,4 +15,363 @@ export LOG_FILE=blueprint.log
 export POSTGRES_DATA=${HOME}/data/blueprint/postgres
 export REDIS_DATA=${HOME}/data/blueprint/redis
 export APP_ROOT=${HOME}/data/blueprint/app
-export APP_LOG=${HOME}/data/blueprint/logs
\ No newline at end of file
+export APP_LOG=${HOME}/data/blueprint/logs
+# optional service discovery (consul or etcd), leave empty to disable
+export DISCOVERY_BACKEND=
+export DISCOVERY_ADDR=127.0.0.1:8500
+export DISCOVERY_TTL=10s
+
+# kubernetes probe server, pod metadata comes from the downward API in k8s.yaml
+export PROBE_PORT=8086
+
+# development | staging | production
+export APP_ENV=development
+# low-latency | throughput defaults for pools, keepalive, error sampling,
+# cache ttls, GC, compression and async logging (config/profile.go). Values
+# exported in this file still win, blank the ones the profile should pick
+export TUNING_PROFILE=
+
+# optional error tracking, SENTRY_DSN wins over ERROR_WEBHOOK_URL
+export SENTRY_DSN=
+export ERROR_WEBHOOK_URL=
+export ERROR_TRACKING_SAMPLE_RATE=1
+
+# async logging drops entries instead of blocking when the buffer is full
+export LOG_ASYNC=false
+export LOG_ASYNC_BUFFER=8192
+
+# optional hourly | daily rotation and a disk budget for all log files in MB
+export LOG_ROTATE=
+export LOG_MAX_TOTAL_MB=0
+
+# per module levels, e.g. db=warn,cache=debug,grpc=info
+export LOG_LEVELS=
+
+# pools and timeouts, durations take 30s style or plain seconds, 0 keeps the default
+export REDIS_DB=0
+export REDIS_POOL_SIZE=100
+export REDIS_MIN_IDLE_CONN=10
+export REDIS_POOL_TIMEOUT=30s
+export REDIS_DIAL_TIMEOUT=5s
+export REDIS_READ_TIMEOUT=3s
+export REDIS_WRITE_TIMEOUT=3s
+export REDIS_MAX_RETRIES=3
+
+# sentinel mode: comma separated sentinel addrs and the master name, REDIS_URL
+# is ignored then. Max lag in bytes fails readiness, 0 only reports it
+export REDIS_SENTINEL_ADDRS=
+export REDIS_SENTINEL_MASTER=mymaster
+export REDIS_SENTINEL_PASSWORD=
+export REDIS_SENTINEL_POLL=10s
+export REDIS_SENTINEL_MAX_LAG=0
+
+# redis commands at least this slow are logged, 0 disables
+export REDIS_SLOW_THRESHOLD=100ms
+# idle connections are pinged this often, a lost connection fails readiness
+# until a reconnect probe succeeds
+export REDIS_HEALTH_INTERVAL=5s
+# INFO memory, clients, replication, stats and keyspace are read this often,
+# 0 disables
+export REDIS_STATS_INTERVAL=30s
+# pool auto tuning: with a max above 0 the pool starts at REDIS_POOL_SIZE and
+# grows while commands wait for a connection, shrinking back when idle
+export REDIS_POOL_MIN_SIZE=10
+export REDIS_POOL_MAX_SIZE=0
+
+export POSTGRES_MAX_IDLE_CONNS=10
+export POSTGRES_MAX_OPEN_CONNS=100
+export POSTGRES_CONN_MAX_LIFETIME=1h
+export POSTGRES_CONN_MAX_IDLE_TIME=10m
+# max open conns auto tuning, same rules as the redis pool, 0 max disables
+export POSTGRES_MIN_OPEN_CONNS_TUNED=10
+export POSTGRES_MAX_OPEN_CONNS_TUNED=0
+# TLS: disable, require (encrypt only), verify-ca (check the certificate
+# against POSTGRES_SSLROOTCERT or the system roots) or verify-full (and the
+# host name); POSTGRES_SSLCERT and POSTGRES_SSLKEY are a client certificate
+export POSTGRES_SSLMODE=disable
+export POSTGRES_SSLROOTCERT=
+export POSTGRES_SSLCERT=
+export POSTGRES_SSLKEY=
+export POSTGRES_SSLKEY_PASSWORD=
+# credentials: static (POSTGRES_USER/POSTGRES_PASSWORD), file (password read
+# from POSTGRES_PASSWORD_FILE whenever it changes), vault (dynamic secrets at
+# POSTGRES_VAULT_PATH) or rds-iam (auth tokens signed with the keys of the AWS
+# SDK default credential chain: AWS_* keys, AWS_PROFILE, EKS web identity, the
+# ECS task role or the EC2 instance role); checked every refresh, pooled
+# connections are recycled on a change
+export POSTGRES_CREDENTIALS=static
+export POSTGRES_CREDENTIALS_REFRESH=1m
+export POSTGRES_PASSWORD_FILE=
+export VAULT_ADDR=
+export VAULT_TOKEN=
+export VAULT_TOKEN_FILE=
+export POSTGRES_VAULT_PATH=
+export AWS_REGION=
+# queries at least this slow are logged (0 disables), EXPLAIN_SLOW adds the
+# EXPLAIN plan (no ANALYZE), fetched in the background
+export POSTGRES_SLOW_THRESHOLD=200ms
+export POSTGRES_EXPLAIN_SLOW=false
+# a unary call running more queries than this is logged (0 disables),
+# BUDGETS overrides it per method as method=limit, REJECT=true fails the
+# queries over budget with ResourceExhausted instead
+export POSTGRES_QUERY_BUDGET=100
+export POSTGRES_QUERY_BUDGETS=
+export POSTGRES_QUERY_BUDGET_REJECT=false
+# prepared statements kept by gorm, least recently used closed first, and
+# closed once unused for TTL; 0 keeps 1000 and 1h
+export POSTGRES_STMT_CACHE_SIZE=0
+export POSTGRES_STMT_CACHE_TTL=0
+# sqlcommenter comments on statements: off, route (service and RPC) or
+# trace (also request/trace id, user, tenant; statements go unprepared)
+export POSTGRES_QUERY_COMMENT=off
+
+export GRPC_MAX_CONNECTION_IDLE=15s
+export GRPC_MAX_CONNECTION_AGE=30s
+export GRPC_KEEPALIVE_TIMEOUT=1s
+
+# gRPC keepalive and server limits, 0 for idle/age/streams/sizes means unlimited
+export GRPC_MAX_CONNECTION_AGE_GRACE=5s
+export GRPC_KEEPALIVE_TIME=5s
+export GRPC_KEEPALIVE_MIN_TIME=5s
+export GRPC_PERMIT_WITHOUT_STREAM=true
+export GRPC_MAX_CONCURRENT_STREAMS=0
+export GRPC_CONNECTION_TIMEOUT=120s
+export GRPC_MAX_RECV_MSG_SIZE=4194304
+export GRPC_MAX_SEND_MSG_SIZE=0
+
+# extra listeners next to gRPC, leave empty to disable
+# HTTP_PORT serves the JSON gateway (POST /v1/call), METRICS_PORT moves /metrics
+# and the health endpoints off PROBE_PORT, DEBUG_PORT serves pprof (never expose it)
+export HTTP_PORT=
+export METRICS_PORT=
+export DEBUG_PORT=
+
+# extra gRPC listeners: comma separated tcp addresses replacing :GRPC_PORT, and
+# an optional unix socket for sidecars (mode is octal, 0 keeps the umask)
+export GRPC_LISTEN_ADDRS=
+export GRPC_UNIX_SOCKET=
+export GRPC_UNIX_SOCKET_MODE=0660
+
+# opt-in payload logging for staging: share of calls to log (0-1), methods that
+# are always logged (Call, blueprint.Blueprint or /blueprint.Blueprint/Call),
+# field names to redact (defaults to password,token,secret,authorization,api_key)
+export PAYLOAD_LOG_SAMPLE_RATE=0
+export PAYLOAD_LOG_METHODS=
+export PAYLOAD_LOG_REDACT=
+export PAYLOAD_LOG_MAX_BYTES=4096
+
+# gRPC response cache in redis: comma separated method=ttl[:field|field]
+# policies (empty keeps /blueprint.Blueprint/Call=5m:name), a call with the
+# bypass header set to anything but false skips the lookup
+export RESPONSE_CACHE_ENABLED=true
+export RESPONSE_CACHE_POLICIES=
+export RESPONSE_CACHE_BYPASS_HEADER=x-cache-bypass
+# scope every cache key by request values, comma separated tenant, user and
+# locale, e.g. tenant,locale for multi-tenant localized responses
+export CACHE_KEY_SCOPE=
+# ttl of cache entries written without one, empty keeps the profile's or an
+# hour
+export CACHE_TTL=
+# entries read through Cache.Fetch are served this long past their ttl while
+# the loader refreshes them in the background, 0 disables
+export CACHE_STALE_WINDOW=0
+# read-your-writes: once a call writes a row, its later reads of the cache
+# keys the write invalidated go to the database instead of the cache
+export CACHE_READ_YOUR_WRITES=false
+# cache-optional mode: start and keep serving while redis is unreachable,
+# cache reads miss and writes are dropped (blueprint_cache_degraded_operations_total)
+# until redis answers again, readiness no longer depends on redis
+export CACHE_OPTIONAL=false
+
+# compression of rotated log files and cache values: COMPRESSION_PRESET=latency
+# (zstd fastest logs, snappy cache values from 4KiB) or storage (gzip best
+# logs, zstd cache values from 256 bytes), see pkg/compress for the numbers.
+# The settings below override the preset, empty keeps it; without a preset
+# logs are gzipped and cache values stored as they are. Algorithms are none,
+# gzip, zstd or snappy, levels fastest, default or best
+export COMPRESSION_PRESET=
+export LOG_COMPRESSION=
+export LOG_COMPRESSION_LEVEL=
+export CACHE_COMPRESSION=
+export CACHE_COMPRESSION_LEVEL=
+export CACHE_COMPRESS_MIN_BYTES=0
+
+# client address ACL: comma separated CIDRs or addresses, deny wins and an
+# empty allow list lets in everyone not denied; NETACL_FILE adds
+# "allow <cidr>"/"deny <cidr>" lines and is reloaded within NETACL_RELOAD of
+# a change; calls from NETACL_TRUSTED_PROXIES (the gateway over loopback) are
+# judged by their x-forwarded-for client and are the only ones whose
+# x-user-id/x-tenant-id are believed, on the gateway too
+export NETACL_ALLOW=
+export NETACL_DENY=
+export NETACL_FILE=
+export NETACL_TRUSTED_PROXIES=127.0.0.1,::1
+export NETACL_RELOAD=10s
+
+# per method rate limits in each replica: comma separated
+# method=rate/period[:burst][:key] policies (empty keeps
+# /blueprint.Blueprint/Call=100/1m), burst defaults to rate, key is user
+# (default), ip or apikey (QUOTA_KEY_HEADER), callers without it are limited
+# by IP, e.g. Call=100/1m:20:apikey; responses carry x-ratelimit-limit,
+# -remaining and -reset (unix seconds the bucket is full again), a caller
+# down to RATE_LIMIT_WARN_AT of its burst is logged once (0 disables)
+export RATE_LIMIT_ENABLED=true
+export RATE_LIMIT_POLICIES=
+export RATE_LIMIT_WARN_AT=0.2
+
+# per caller cap on calls in flight, streams hold their slot until they end;
+# over it calls get ResourceExhausted (CONCURRENCY_LIMITED), 0 disables.
+# CONCURRENCY_KEY is user, ip or apikey like the rate limits, user only
+# when NETACL_TRUSTED_PROXIES set it and ip behind them; the memory
+# store caps each replica, redis shares the cap with slots leased for
+# CONCURRENCY_LEASE_TTL and renewed while the call runs
+export CONCURRENCY_LIMIT=20
+export CONCURRENCY_KEY=user
+export CONCURRENCY_STORE=memory
+export CONCURRENCY_LEASE_TTL=30s
+export CONCURRENCY_EXEMPT=grpc.health.v1.Health
+
+# per API key quotas shared by all replicas, counted in redis per UTC day and
+# month; calls sending QUOTA_KEY_HEADER get ResourceExhausted past a limit,
+# 0 leaves a period unlimited and both 0 disable quotas
+export QUOTA_DAILY_LIMIT=0
+export QUOTA_MONTHLY_LIMIT=0
+export QUOTA_KEY_HEADER=x-api-key
+
+# hedged reads in the handler path: once a read runs past this percentile
+# (0-0.999) of recent latencies, capped at HEDGE_MAX_DELAY, a second attempt
+# is sent and the first answer wins; HEDGE_BUDGET is the share of calls that
+# may be hedged, 0 percentile disables hedging
+export HEDGE_PERCENTILE=0
+export HEDGE_BUDGET=0.1
+export HEDGE_MAX_DELAY=100ms
+
+# adaptive concurrency limit of unary calls, moves between MIN and MAX with
+# their latency; calls over it get Unavailable. EXEMPT methods (full method,
+# service or method name) are never shed
+export LOAD_SHED_ENABLED=false
+export LOAD_SHED_INITIAL_LIMIT=20
+export LOAD_SHED_MIN_LIMIT=5
+export LOAD_SHED_MAX_LIMIT=1000
+export LOAD_SHED_EXEMPT=grpc.health.v1.Health
+# CRITICAL methods may fill the whole limit, BACKGROUND ones half of it and
+# everything else 90%, so background work is shed first; callers can lower
+# the priority of a call with the header (critical, normal, background)
+export LOAD_SHED_CRITICAL=
+export LOAD_SHED_BACKGROUND=
+export LOAD_SHED_PRIORITY_HEADER=x-priority
+
+# retention for time-series tables, comma separated table.column=age[:archive]
+# e.g. platform_tick.created_at=30d,platform_audit.created_at=90d:platform_audit_archive
+# (age in days or a Go duration, rows move to the archive table when given);
+# one replica prunes every interval, BATCH_SIZE rows per statement with
+# BATCH_PAUSE between them, expired partitions are dropped whole; empty
+# policies disables it
+export RETENTION_POLICIES=
+export RETENTION_INTERVAL=1h
+export RETENTION_BATCH_SIZE=1000
+export RETENTION_BATCH_PAUSE=100ms
+
+# time-range partitions, comma separated table=daily|monthly[:ahead], e.g.
+# platform_tick=daily:7; the parent must be PARTITION BY RANGE on a timestamp,
+# the current and next ahead (default 3) partitions are created at startup
+# and every interval, empty policies disables it
+export PARTITION_POLICIES=
+export PARTITION_INTERVAL=1h
+
+# startup: redis and postgres connect in parallel and every failure is
+# reported before exiting; true starts without the cache (response cache,
+# quotas and cache invalidation off) when redis is down instead of exiting
+export STARTUP_DEGRADED=false
+
+# warm-up before the readiness probe flips: REDIS_MIN_IDLE_CONN redis and
+# WARMUP_DB_CONNS postgres connections (at most POSTGRES_MAX_IDLE_CONNS) are
+# opened and the comma separated cache keys loaded by their registered
+# primers; whatever is not done by the timeout is left to the first calls
+export WARMUP_ENABLED=false
+export WARMUP_DB_CONNS=5
+export WARMUP_CACHE_KEYS=
+export WARMUP_TIMEOUT=10s
+
+# alerts to people (failing readiness checks, margin calls), a channel is on
+# once its target is set; SMS gets critical alerts only, the rest warnings
+# and up; NOTIFY_RATE_LIMIT is per channel and minute, 0 is unlimited
+export NOTIFY_SMTP_ADDR=
+export NOTIFY_SMTP_USER=
+export NOTIFY_SMTP_PASSWORD=
+export NOTIFY_SMTP_FROM=
+export NOTIFY_SMTP_TO=
+export NOTIFY_SLACK_WEBHOOK=
+export NOTIFY_TELEGRAM_TOKEN=
+export NOTIFY_TELEGRAM_CHAT_ID=
+export NOTIFY_SMS_URL=
+export NOTIFY_SMS_TOKEN=
+export NOTIFY_SMS_TO=
+export NOTIFY_RATE_LIMIT=30
+export NOTIFY_LOCALE=en-US
+
+# readiness checks become healthy/degraded/down after HEALTH_CONFIRM results
+# in a row agree; a dependency is notified about at most once per interval
+export HEALTH_CONFIRM=2
+export HEALTH_NOTIFY_INTERVAL=5m
+
+# maintenance mode, switched with the SetMaintenance admin RPC: every call
+# but MAINTENANCE_READ_ONLY methods gets Unavailable. The switch lives under
+# MAINTENANCE_KEY in redis, replicas pick it up within the poll interval;
+# an empty key switches each replica on its own
+export MAINTENANCE_KEY=blueprint:maintenance
+export MAINTENANCE_POLL_INTERVAL=5s
+export MAINTENANCE_RETRY_AFTER=1m
+export MAINTENANCE_READ_ONLY=Version,Call,GetAccount,grpc.health.v1.Health
+
+# domain events: memory (one process only), redis (streams on the redis
+# above, trimmed to about EVENTBUS_STREAM_MAXLEN each) or kafka; empty
+# disables it. A failing handler gets an event EVENTBUS_MAX_DELIVERIES
+# times, EVENTBUS_REDELIVERY apart and doubling, before it is dropped
+export EVENTBUS_BACKEND=
+export EVENTBUS_KAFKA_BROKERS=
+export EVENTBUS_STREAM_MAXLEN=100000
+export EVENTBUS_MAX_DELIVERIES=10
+export EVENTBUS_REDELIVERY=1s
+# Wire format of published events: json (the plain envelope), cloudevents
+# (CloudEvents 1.0 JSON) or cloudevents-proto; consumers read all three
+export EVENTBUS_FORMAT=json
+# Registered event schemas are checked version to version at startup:
+# backward (new consumers read old payloads, with upgrades), forward (old
+# consumers read new payloads), full (both) or none
+export EVENTBUS_SCHEMA_COMPATIBILITY=backward
+# Dropped events are kept for inspection and replay (blueprint dlq): memory,
+# redis (the events:deadletters stream, trimmed to about
+# EVENTBUS_DEADLETTER_MAXLEN) or none; empty uses the backend's, kafka none
+export EVENTBUS_DEADLETTER_STORE=
+export EVENTBUS_DEADLETTER_MAXLEN=10000
+
+# garbage collector: GC_PERCENT as GOGC (0 keeps 100, -1 off until the memory
+# limit), MEMORY_LIMIT as GOMEMLIMIT in bytes or, when 0, MEMORY_LIMIT_RATIO
+# of the container's memory limit (e.g. 0.9); BALLAST bytes allocated once.
+# GOGC and GOMEMLIMIT themselves win when set
+export RUNTIME_GC_PERCENT=0
+export RUNTIME_MEMORY_LIMIT=0
+export RUNTIME_MEMORY_LIMIT_RATIO=0
+export RUNTIME_BALLAST=0
+
+# AdminService (metrics, log level, cache flush, feature flags) on its own
+# gRPC port, empty disables it; callers send "authorization: Bearer $ADMIN_TOKEN"
+export ADMIN_GRPC_PORT=
+export ADMIN_TOKEN=
+
+# developer features, default on unless APP_ENV=production, images built with
+# -tags production (see Dockerfile) keep them off whatever is set here
+export GRPC_REFLECTION=
+export VERBOSE_ERRORS=
+export DEBUG_ENDPOINTS=
+# /openapi.json and the Swagger UI at /docs on the gateway (HTTP_PORT)
+export API_DOCS=
+
+# fault injection for resilience tests in staging, off unless set and
+# refused with APP_ENV=production. Rules are target[/match]:fault@rate,
+# comma separated: redis/GET:latency=200ms@0.1, postgres:error@0.05,
+# grpc/GetQuote:error=DEADLINE_EXCEEDED@0.2; the SetFaults admin RPC
+# replaces them at runtime
+export FAULT_INJECTION=
+export FAULT_RULES=
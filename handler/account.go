@@ -0,0 +1,102 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package handler
+
+import (
+	"context"
+
+	model "blueprint/model/other"
+	"blueprint/pkg/account"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/errors"
+	pb "blueprint/proto/blueprint"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errAccountsDisabled = errors.New(codes.FailedPrecondition, "ACCOUNTS_DISABLED", "accounts are not available")
+
+func (b *Blueprint) CreateAccount(ctx context.Context, req *pb.CreateAccountRequest) (*pb.Account, error) {
+	if b.Accounts == nil {
+		return nil, errAccountsDisabled
+	}
+	a, err := b.Accounts.Create(ctx, accountInput(req.GetFields()))
+	if err != nil {
+		return nil, b.accountError(ctx, "Blueprint.CreateAccount", err)
+	}
+	return accountProto(ctx, a), nil
+}
+
+func (b *Blueprint) GetAccount(ctx context.Context, req *pb.GetAccountRequest) (*pb.Account, error) {
+	if b.Accounts == nil {
+		return nil, errAccountsDisabled
+	}
+	a, err := b.Accounts.Get(ctx, req.GetAccountId())
+	if err != nil {
+		return nil, b.accountError(ctx, "Blueprint.GetAccount", err)
+	}
+	return accountProto(ctx, a), nil
+}
+
+func (b *Blueprint) UpdateAccount(ctx context.Context, req *pb.UpdateAccountRequest) (*pb.Account, error) {
+	if b.Accounts == nil {
+		return nil, errAccountsDisabled
+	}
+	a, err := b.Accounts.Update(ctx, req.GetAccountId(), int(req.GetVersion()), accountInput(req.GetFields()))
+	if err != nil {
+		return nil, b.accountError(ctx, "Blueprint.UpdateAccount", err)
+	}
+	return accountProto(ctx, a), nil
+}
+
+func (b *Blueprint) DeleteAccount(ctx context.Context, req *pb.DeleteAccountRequest) (*pb.DeleteAccountResponse, error) {
+	if b.Accounts == nil {
+		return nil, errAccountsDisabled
+	}
+	if err := b.Accounts.Delete(ctx, req.GetAccountId()); err != nil {
+		return nil, b.accountError(ctx, "Blueprint.DeleteAccount", err)
+	}
+	return &pb.DeleteAccountResponse{}, nil
+}
+
+func accountInput(f *pb.AccountFields) account.Input {
+	return account.Input{
+		NameEn:  f.GetNameEn(),
+		NameAr:  f.GetNameAr(),
+		Contact: f.GetContact(),
+		Address: f.GetAddress(),
+		Tel:     f.GetTel(),
+		Mobile:  f.GetMobile(),
+		Email:   f.GetEmail(),
+		Web:     f.GetWeb(),
+	}
+}
+
+func accountProto(ctx context.Context, a *model.Account) *pb.Account {
+	locale, _ := ctxmeta.Locale(ctx)
+	return &pb.Account{
+		AccountId: a.AccountId,
+		NameEn:    a.NameEn,
+		NameAr:    a.NameAr,
+		Name:      account.Name(a, locale),
+		Contact:   a.Contact,
+		Address:   a.Address,
+		Tel:       a.Tel,
+		Mobile:    a.Mobile,
+		Email:     a.Email,
+		Web:       a.Web,
+		CreateAt:  a.CreateAt,
+		UpdateAt:  a.UpdateAt,
+		Version:   int32(a.Version),
+	}
+}
+
+// accountError passes the Service's errors and a stale version through,
+// anything else is logged and answered as internal
+func (b *Blueprint) accountError(ctx context.Context, method string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	b.Log.Errorw("Account store failed", logFields(ctx, "method", method, "error", err.Error())...)
+	return errors.Internal("account store failed").Wrap(err)
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"blueprint/pkg/account"
+	"blueprint/pkg/ctxmeta"
+	apperrors "blueprint/pkg/errors"
+	pb "blueprint/proto/blueprint"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccounts(t *testing.T) {
+	ctx := context.Background()
+	b := NewBlueprint(nil, &MockLogger{}, nil, nil)
+
+	_, err := b.GetAccount(ctx, &pb.GetAccountRequest{AccountId: 1})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "no account service")
+
+	b.Accounts = account.New(account.NewMemoryStore(), nil, nil, account.Options{})
+	created, err := b.CreateAccount(ctx, &pb.CreateAccountRequest{Fields: &pb.AccountFields{
+		NameEn: "Acme", NameAr: "أكمي", Email: " Ops@Acme.test ",
+	}})
+	require.NoError(t, err)
+	assert.NotZero(t, created.AccountId)
+	assert.Equal(t, "ops@acme.test", created.Email)
+	assert.Equal(t, "Acme", created.Name)
+	assert.EqualValues(t, 1, created.Version)
+
+	got, err := b.GetAccount(ctxmeta.WithLocale(ctx, "ar-SA"), &pb.GetAccountRequest{AccountId: created.AccountId})
+	require.NoError(t, err)
+	assert.Equal(t, "أكمي", got.Name, "name in the caller's language")
+
+	_, err = b.CreateAccount(ctx, &pb.CreateAccountRequest{Fields: &pb.AccountFields{NameEn: "Other", Email: "OPS@acme.test"}})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	e, ok := apperrors.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, account.ReasonEmailTaken, e.Reason)
+
+	_, err = b.CreateAccount(ctx, &pb.CreateAccountRequest{Fields: &pb.AccountFields{NameAr: "Acme", Email: "nope"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	e, ok = apperrors.FromError(err)
+	require.True(t, ok)
+	var fields []string
+	for _, v := range e.Violations {
+		fields = append(fields, v.Field)
+	}
+	assert.Equal(t, []string{"name_en", "name_ar", "email"}, fields)
+
+	updated, err := b.UpdateAccount(ctx, &pb.UpdateAccountRequest{
+		AccountId: created.AccountId, Version: created.Version,
+		Fields: &pb.AccountFields{NameEn: "Acme Ltd", Email: "ops@acme.test", Web: "https://acme.test"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Acme Ltd", updated.NameEn)
+	assert.Empty(t, updated.NameAr)
+	assert.EqualValues(t, 2, updated.Version)
+
+	_, err = b.UpdateAccount(ctx, &pb.UpdateAccountRequest{
+		AccountId: created.AccountId, Version: created.Version,
+		Fields: &pb.AccountFields{NameEn: "Lost update", Email: "ops@acme.test"},
+	})
+	assert.Equal(t, codes.Aborted, status.Code(err), "stale version")
+
+	_, err = b.DeleteAccount(ctx, &pb.DeleteAccountRequest{AccountId: created.AccountId})
+	require.NoError(t, err)
+	_, err = b.GetAccount(ctx, &pb.GetAccountRequest{AccountId: created.AccountId})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = b.DeleteAccount(ctx, &pb.DeleteAccountRequest{AccountId: created.AccountId})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,579 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package handler
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"blueprint/pkg/cache"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/eventbus"
+	"blueprint/pkg/fault"
+	"blueprint/pkg/maintenance"
+	"blueprint/pkg/quota"
+	"blueprint/pkg/settings"
+	adminpb "blueprint/proto/admin"
+
+	"google.golang.org/grpc/codes"
+)
+
+//go:generate go run github.com/vektra/mockery/v2@v2.53.5 --name=^(LevelSetter|PrefixFlusher|QuotaReader|SettingsStore)$ --inpackage --testonly --output=. --with-expecter=false
+
+// LevelSetter is the part of *logger.Logger SetLogLevel uses
+type LevelSetter interface {
+	GetLevel() string
+	SetLevel(level string) error
+	ModuleLevels() map[string]string
+	SetModuleLevel(name, level string) error
+}
+
+// PrefixFlusher is the part of *cache.Cache FlushCachePrefix uses
+type PrefixFlusher interface {
+	FlushPrefix(ctx context.Context, prefix string) (int64, error)
+}
+
+// QuotaReader is the part of *quota.Tracker GetQuotaUsage uses
+type QuotaReader interface {
+	Usage(ctx context.Context, apiKey string) (quota.Usage, error)
+}
+
+// DeadLetterQueue is the part of *eventbus.DeadLetterQueue the dead-letter
+// RPCs use
+type DeadLetterQueue interface {
+	List(ctx context.Context, f eventbus.DeadLetterFilter) ([]*eventbus.DeadLetter, error)
+	Get(ctx context.Context, id string) (*eventbus.DeadLetter, error)
+	Replay(ctx context.Context, ids ...string) (int, error)
+	Delete(ctx context.Context, ids ...string) (int, error)
+}
+
+// MaintenanceSwitch is the part of *maintenance.Switch the maintenance
+// RPCs use
+type MaintenanceSwitch interface {
+	State() maintenance.State
+	Shared() bool
+	Set(ctx context.Context, enabled bool, reason string, expected time.Duration) (maintenance.State, error)
+}
+
+// FaultInjector is the part of *fault.Injector the fault RPCs use
+type FaultInjector interface {
+	Rules() ([]fault.Rule, time.Time)
+	Set(rules []fault.Rule, ttl time.Duration) error
+}
+
+// SettingsStore is the part of *settings.Store the settings RPCs use
+type SettingsStore interface {
+	List(ctx context.Context, namespace string) ([]settings.Value, error)
+	Get(ctx context.Context, namespace, key string) (settings.Value, error)
+	Set(ctx context.Context, namespace, key, value string) (settings.Value, error)
+	Reset(ctx context.Context, namespace, key string) (settings.Value, error)
+}
+
+const (
+	defaultDeadLetterPage = 100
+	maxDeadLetterPage     = 1000
+)
+
+// Admin serves the AdminService. It is only registered on the admin
+// listener, which checks the token before any of these run.
+type Admin struct {
+	adminpb.UnimplementedAdminServiceServer
+
+	Blueprint *Blueprint
+	Log       Logger
+	Levels    LevelSetter
+	Cache     PrefixFlusher
+	Flags     *Flags
+	// Quota is nil while quotas are off
+	Quota QuotaReader
+	// DeadLetters is nil without an event bus or a dead letter store
+	DeadLetters DeadLetterQueue
+	// Maintenance is nil when the public server has no maintenance switch
+	Maintenance MaintenanceSwitch
+	// Faults is nil unless FAULT_INJECTION is on
+	Faults FaultInjector
+	// Settings is nil without a database
+	Settings SettingsStore
+}
+
+func NewAdmin(b *Blueprint, l Logger, levels LevelSetter, cache PrefixFlusher) *Admin {
+	return &Admin{
+		Blueprint: b,
+		Log:       l,
+		Levels:    levels,
+		Cache:     cache,
+		Flags:     b.Flags,
+	}
+}
+
+func (a *Admin) GetMetrics(ctx context.Context, req *adminpb.GetMetricsRequest) (*adminpb.GetMetricsResponse, error) {
+	return metricsResponse(a.Blueprint.GetMetrics()), nil
+}
+
+func (a *Admin) ResetMetrics(ctx context.Context, req *adminpb.ResetMetricsRequest) (*adminpb.GetMetricsResponse, error) {
+	prev := a.Blueprint.ResetMetrics()
+	a.Log.Infow("Metrics reset", logFields(ctx)...)
+	return metricsResponse(prev), nil
+}
+
+func (a *Admin) SetLogLevel(ctx context.Context, req *adminpb.SetLogLevelRequest) (*adminpb.SetLogLevelResponse, error) {
+	level := strings.ToLower(req.GetLevel())
+	if level == "" {
+		return nil, errors.InvalidArgument("level is required", errors.FieldViolation{Field: "level", Description: "must not be empty"})
+	}
+
+	prev := a.Levels.GetLevel()
+	var err error
+	if req.GetModule() == "" {
+		err = a.Levels.SetLevel(level)
+	} else {
+		if l, ok := a.Levels.ModuleLevels()[req.GetModule()]; ok {
+			prev = l
+		}
+		err = a.Levels.SetModuleLevel(req.GetModule(), level)
+	}
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid level", errors.FieldViolation{Field: "level", Description: err.Error()})
+	}
+
+	a.Log.Warnw("Log level changed", logFields(ctx, "module", req.GetModule(), "from", prev, "to", level)...)
+	return &adminpb.SetLogLevelResponse{PreviousLevel: prev, Level: level}, nil
+}
+
+func (a *Admin) FlushCachePrefix(ctx context.Context, req *adminpb.FlushCachePrefixRequest) (*adminpb.FlushCachePrefixResponse, error) {
+	if req.GetPrefix() == "" {
+		// an empty prefix would flush the whole cache, make that explicit
+		return nil, errors.InvalidArgument("prefix is required", errors.FieldViolation{Field: "prefix", Description: "must not be empty"})
+	}
+	if a.Cache == nil {
+		return nil, errors.Unavailable("cache is not configured", 0)
+	}
+
+	deleted, err := a.Cache.FlushPrefix(ctx, req.GetPrefix())
+	if stderrors.Is(err, cache.ErrUnavailable) {
+		return nil, errors.Unavailable("cache is unavailable, try again once redis is back", 0)
+	}
+	if err != nil {
+		a.Log.Errorw("Cache flush failed", logFields(ctx, "prefix", req.GetPrefix(), "error", err.Error())...)
+		return nil, errors.Internal("cache flush failed").Wrap(err)
+	}
+
+	a.Log.Warnw("Cache prefix flushed", logFields(ctx, "prefix", req.GetPrefix(), "deleted", deleted)...)
+	return &adminpb.FlushCachePrefixResponse{Deleted: deleted}, nil
+}
+
+func (a *Admin) ToggleFeatureFlag(ctx context.Context, req *adminpb.ToggleFeatureFlagRequest) (*adminpb.ToggleFeatureFlagResponse, error) {
+	if req.GetName() == "" {
+		return nil, errors.InvalidArgument("name is required", errors.FieldViolation{Field: "name", Description: "must not be empty"})
+	}
+
+	prev := a.Flags.Set(req.GetName(), req.GetEnabled())
+	a.Log.Warnw("Feature flag toggled", logFields(ctx, "flag", req.GetName(), "enabled", req.GetEnabled())...)
+	return &adminpb.ToggleFeatureFlagResponse{Name: req.GetName(), Enabled: req.GetEnabled(), Previous: prev}, nil
+}
+
+func (a *Admin) GetQuotaUsage(ctx context.Context, req *adminpb.GetQuotaUsageRequest) (*adminpb.GetQuotaUsageResponse, error) {
+	if req.GetApiKey() == "" {
+		return nil, errors.InvalidArgument("api_key is required", errors.FieldViolation{Field: "api_key", Description: "must not be empty"})
+	}
+	if a.Quota == nil {
+		return nil, errors.New(codes.FailedPrecondition, "QUOTA_DISABLED", "quotas are not enabled")
+	}
+
+	usage, err := a.Quota.Usage(ctx, req.GetApiKey())
+	if err != nil {
+		return nil, errors.Internal("quota lookup failed").Wrap(err)
+	}
+	return &adminpb.GetQuotaUsageResponse{
+		KeyId:    quota.KeyID(req.GetApiKey()),
+		Daily:    quotaPeriod(usage.Daily),
+		Monthly:  quotaPeriod(usage.Monthly),
+		Exceeded: !usage.Allowed,
+	}, nil
+}
+
+func (a *Admin) ListDeadLetters(ctx context.Context, req *adminpb.ListDeadLettersRequest) (*adminpb.ListDeadLettersResponse, error) {
+	if a.DeadLetters == nil {
+		return nil, errDeadLettersDisabled
+	}
+	f, err := deadLetterFilter(req.GetFilter(), req.GetPageSize(), "page_size")
+	if err != nil {
+		return nil, err
+	}
+	f.After = req.GetPageToken()
+
+	letters, err := a.DeadLetters.List(ctx, f)
+	if err != nil {
+		return nil, errors.Internal("listing dead letters failed").Wrap(err)
+	}
+	resp := &adminpb.ListDeadLettersResponse{}
+	for _, dl := range letters {
+		resp.DeadLetters = append(resp.DeadLetters, deadLetterProto(dl, false))
+	}
+	if len(letters) == f.Limit {
+		resp.NextPageToken = letters[len(letters)-1].ID
+	}
+	return resp, nil
+}
+
+func (a *Admin) GetDeadLetter(ctx context.Context, req *adminpb.GetDeadLetterRequest) (*adminpb.DeadLetter, error) {
+	if req.GetId() == "" {
+		return nil, errors.InvalidArgument("id is required", errors.FieldViolation{Field: "id", Description: "must not be empty"})
+	}
+	if a.DeadLetters == nil {
+		return nil, errDeadLettersDisabled
+	}
+
+	dl, err := a.DeadLetters.Get(ctx, req.GetId())
+	if stderrors.Is(err, eventbus.ErrDeadLetterNotFound) {
+		return nil, errors.NotFound("dead letter not found").WithMetadata("id", req.GetId())
+	}
+	if err != nil {
+		return nil, errors.Internal("reading dead letter failed").Wrap(err)
+	}
+	return deadLetterProto(dl, true), nil
+}
+
+func (a *Admin) ReplayDeadLetters(ctx context.Context, req *adminpb.ReplayDeadLettersRequest) (*adminpb.ReplayDeadLettersResponse, error) {
+	ids, err := a.selectDeadLetters(ctx, req.GetIds(), req.GetFilter(), req.GetLimit())
+	if err != nil {
+		return nil, err
+	}
+
+	replayed, err := a.DeadLetters.Replay(ctx, ids...)
+	resp := &adminpb.ReplayDeadLettersResponse{Replayed: int64(replayed)}
+	if err != nil {
+		resp.FailedId = ids[replayed]
+		resp.Error = err.Error()
+	}
+	a.Log.Warnw("Dead letters replayed", logFields(ctx, "selected", len(ids), "replayed", replayed, "error", resp.Error)...)
+	return resp, nil
+}
+
+func (a *Admin) DeleteDeadLetters(ctx context.Context, req *adminpb.DeleteDeadLettersRequest) (*adminpb.DeleteDeadLettersResponse, error) {
+	ids, err := a.selectDeadLetters(ctx, req.GetIds(), req.GetFilter(), req.GetLimit())
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := a.DeadLetters.Delete(ctx, ids...)
+	if err != nil {
+		return nil, errors.Internal("deleting dead letters failed").Wrap(err)
+	}
+	a.Log.Warnw("Dead letters deleted", logFields(ctx, "selected", len(ids), "deleted", deleted)...)
+	return &adminpb.DeleteDeadLettersResponse{Deleted: int64(deleted)}, nil
+}
+
+func (a *Admin) SetMaintenance(ctx context.Context, req *adminpb.SetMaintenanceRequest) (*adminpb.SetMaintenanceResponse, error) {
+	if req.GetExpectedSeconds() < 0 {
+		return nil, errors.InvalidArgument("invalid expected duration", errors.FieldViolation{Field: "expected_seconds", Description: "must not be negative"})
+	}
+	if a.Maintenance == nil {
+		return nil, errMaintenanceDisabled
+	}
+
+	expected := time.Duration(req.GetExpectedSeconds()) * time.Second
+	prev, err := a.Maintenance.Set(ctx, req.GetEnabled(), req.GetReason(), expected)
+	if err != nil {
+		a.Log.Errorw("Maintenance switch failed", logFields(ctx, "enabled", req.GetEnabled(), "error", err.Error())...)
+		return nil, errors.Internal("switching maintenance mode failed").Wrap(err)
+	}
+
+	a.Log.Warnw("Maintenance mode switched", logFields(ctx, "enabled", req.GetEnabled(), "reason", req.GetReason(), "expected", expected.String())...)
+	return &adminpb.SetMaintenanceResponse{Status: a.maintenanceStatus(), Previous: prev.Enabled}, nil
+}
+
+func (a *Admin) GetMaintenance(ctx context.Context, req *adminpb.GetMaintenanceRequest) (*adminpb.MaintenanceStatus, error) {
+	if a.Maintenance == nil {
+		return nil, errMaintenanceDisabled
+	}
+	return a.maintenanceStatus(), nil
+}
+
+func (a *Admin) maintenanceStatus() *adminpb.MaintenanceStatus {
+	state := a.Maintenance.State()
+	out := &adminpb.MaintenanceStatus{
+		Enabled: state.Enabled,
+		Reason:  state.Reason,
+		Shared:  a.Maintenance.Shared(),
+	}
+	if state.Enabled {
+		out.Since = state.Since.Unix()
+	}
+	if !state.Until.IsZero() {
+		out.Until = state.Until.Unix()
+	}
+	return out
+}
+
+func (a *Admin) SetFaults(ctx context.Context, req *adminpb.SetFaultsRequest) (*adminpb.FaultsStatus, error) {
+	if req.GetTtlSeconds() < 0 {
+		return nil, errors.InvalidArgument("invalid ttl", errors.FieldViolation{Field: "ttl_seconds", Description: "must not be negative"})
+	}
+	if a.Faults == nil {
+		return nil, errFaultsDisabled
+	}
+
+	rules := make([]fault.Rule, 0, len(req.GetRules()))
+	for n, pr := range req.GetRules() {
+		r, err := ruleFromProto(pr)
+		if err != nil {
+			return nil, errors.InvalidArgument("invalid fault rule", errors.FieldViolation{Field: fmt.Sprintf("rules[%d]", n), Description: err.Error()})
+		}
+		rules = append(rules, r)
+	}
+	ttl := time.Duration(req.GetTtlSeconds()) * time.Second
+	if err := a.Faults.Set(rules, ttl); err != nil {
+		return nil, errors.InvalidArgument("invalid fault rules", errors.FieldViolation{Field: "rules", Description: err.Error()})
+	}
+
+	a.Log.Warnw("Fault rules set", logFields(ctx, "rules", len(rules), "ttl", ttl.String())...)
+	return a.faultsStatus(), nil
+}
+
+func (a *Admin) GetFaults(ctx context.Context, req *adminpb.GetFaultsRequest) (*adminpb.FaultsStatus, error) {
+	if a.Faults == nil {
+		return nil, errFaultsDisabled
+	}
+	return a.faultsStatus(), nil
+}
+
+func (a *Admin) faultsStatus() *adminpb.FaultsStatus {
+	rules, until := a.Faults.Rules()
+	out := &adminpb.FaultsStatus{Rules: make([]*adminpb.FaultRule, len(rules))}
+	for n, r := range rules {
+		out.Rules[n] = &adminpb.FaultRule{
+			Target:    r.Target,
+			Match:     r.Match,
+			Kind:      string(r.Kind),
+			LatencyMs: r.Latency.Milliseconds(),
+			Rate:      r.Rate,
+		}
+		if r.Code != codes.OK {
+			out.Rules[n].Code = fault.CodeName(r.Code)
+		}
+	}
+	if !until.IsZero() {
+		out.Until = until.Unix()
+	}
+	return out
+}
+
+func ruleFromProto(pr *adminpb.FaultRule) (fault.Rule, error) {
+	r := fault.Rule{
+		Target:  pr.GetTarget(),
+		Match:   pr.GetMatch(),
+		Kind:    fault.Kind(pr.GetKind()),
+		Latency: time.Duration(pr.GetLatencyMs()) * time.Millisecond,
+		Rate:    pr.GetRate(),
+	}
+	if pr.GetCode() != "" {
+		code, err := fault.ParseCode(pr.GetCode())
+		if err != nil {
+			return r, err
+		}
+		r.Code = code
+	}
+	return r, r.Validate()
+}
+
+func (a *Admin) ListSettings(ctx context.Context, req *adminpb.ListSettingsRequest) (*adminpb.ListSettingsResponse, error) {
+	if a.Settings == nil {
+		return nil, errSettingsDisabled
+	}
+	values, err := a.Settings.List(ctx, req.GetNamespace())
+	if err != nil {
+		return nil, settingsError(err)
+	}
+	out := &adminpb.ListSettingsResponse{Settings: make([]*adminpb.Setting, len(values))}
+	for n, v := range values {
+		out.Settings[n] = settingProto(v)
+	}
+	return out, nil
+}
+
+func (a *Admin) GetSetting(ctx context.Context, req *adminpb.GetSettingRequest) (*adminpb.Setting, error) {
+	if a.Settings == nil {
+		return nil, errSettingsDisabled
+	}
+	v, err := a.Settings.Get(ctx, req.GetNamespace(), req.GetKey())
+	if err != nil {
+		return nil, settingsError(err)
+	}
+	return settingProto(v), nil
+}
+
+func (a *Admin) SetSetting(ctx context.Context, req *adminpb.SetSettingRequest) (*adminpb.Setting, error) {
+	if a.Settings == nil {
+		return nil, errSettingsDisabled
+	}
+	prev, err := a.Settings.Get(ctx, req.GetNamespace(), req.GetKey())
+	if err != nil {
+		return nil, settingsError(err)
+	}
+	v, err := a.Settings.Set(ctx, req.GetNamespace(), req.GetKey(), req.GetValue())
+	if err != nil {
+		return nil, settingsError(err)
+	}
+	a.Log.Warnw("Setting changed", logFields(ctx, "setting", v.Name(), "from", prev.Value, "to", v.Value)...)
+	return settingProto(v), nil
+}
+
+func (a *Admin) ResetSetting(ctx context.Context, req *adminpb.GetSettingRequest) (*adminpb.Setting, error) {
+	if a.Settings == nil {
+		return nil, errSettingsDisabled
+	}
+	v, err := a.Settings.Reset(ctx, req.GetNamespace(), req.GetKey())
+	if err != nil {
+		return nil, settingsError(err)
+	}
+	a.Log.Warnw("Setting reset", logFields(ctx, "setting", v.Name(), "to", v.Value)...)
+	return settingProto(v), nil
+}
+
+func settingProto(v settings.Value) *adminpb.Setting {
+	out := &adminpb.Setting{
+		Namespace:    v.Namespace,
+		Key:          v.Key,
+		Type:         string(v.Type),
+		Value:        v.Value,
+		DefaultValue: v.Default,
+		Description:  v.Description,
+		Overridden:   v.Overridden,
+		UpdatedBy:    v.UpdatedBy,
+	}
+	if v.Overridden {
+		out.UpdatedAt = v.UpdatedAt.Unix()
+	}
+	return out
+}
+
+func settingsError(err error) error {
+	switch {
+	case stderrors.Is(err, settings.ErrUnknown):
+		return errors.NotFound(err.Error())
+	case stderrors.Is(err, settings.ErrInvalid):
+		return errors.InvalidArgument("invalid value", errors.FieldViolation{Field: "value", Description: err.Error()})
+	}
+	return errors.Internal("settings lookup failed").Wrap(err)
+}
+
+var errSettingsDisabled = errors.New(codes.FailedPrecondition, "SETTINGS_DISABLED", "settings are not available")
+
+var errFaultsDisabled = errors.New(codes.FailedPrecondition, "FAULTS_DISABLED", "fault injection is off, see FAULT_INJECTION")
+
+var errMaintenanceDisabled = errors.New(codes.FailedPrecondition, "MAINTENANCE_DISABLED", "maintenance mode is not available")
+
+var errDeadLettersDisabled = errors.New(codes.FailedPrecondition, "DEADLETTERS_DISABLED", "the event bus keeps no dead letters")
+
+// selectDeadLetters returns ids, or those of the dead letters matching
+// filter. One of both is required, an empty request must not replay or
+// delete the whole queue.
+func (a *Admin) selectDeadLetters(ctx context.Context, ids []string, filter *adminpb.DeadLetterFilter, limit int32) ([]string, error) {
+	if len(ids) == 0 && filter == nil {
+		return nil, errors.InvalidArgument("ids or filter is required",
+			errors.FieldViolation{Field: "ids", Description: "name dead letters or set a filter"})
+	}
+	if a.DeadLetters == nil {
+		return nil, errDeadLettersDisabled
+	}
+	if len(ids) > 0 {
+		return ids, nil
+	}
+
+	f, err := deadLetterFilter(filter, limit, "limit")
+	if err != nil {
+		return nil, err
+	}
+	letters, err := a.DeadLetters.List(ctx, f)
+	if err != nil {
+		return nil, errors.Internal("listing dead letters failed").Wrap(err)
+	}
+	for _, dl := range letters {
+		ids = append(ids, dl.ID)
+	}
+	return ids, nil
+}
+
+func deadLetterFilter(f *adminpb.DeadLetterFilter, limit int32, limitField string) (eventbus.DeadLetterFilter, error) {
+	var violations []errors.FieldViolation
+	if limit < 0 {
+		violations = append(violations, errors.FieldViolation{Field: limitField, Description: "must not be negative"})
+	}
+	if f.GetSince() < 0 || f.GetUntil() < 0 {
+		violations = append(violations, errors.FieldViolation{Field: "filter", Description: "since and until are unix seconds"})
+	} else if f.GetUntil() > 0 && f.GetUntil() <= f.GetSince() {
+		violations = append(violations, errors.FieldViolation{Field: "filter.until", Description: "must be after since"})
+	}
+	if len(violations) > 0 {
+		return eventbus.DeadLetterFilter{}, errors.InvalidArgument("invalid dead letter filter", violations...)
+	}
+
+	out := eventbus.DeadLetterFilter{
+		Topic:     f.GetTopic(),
+		Group:     f.GetGroup(),
+		ErrorType: f.GetErrorType(),
+		Limit:     int(limit),
+	}
+	if out.Limit == 0 {
+		out.Limit = defaultDeadLetterPage
+	}
+	if out.Limit > maxDeadLetterPage {
+		out.Limit = maxDeadLetterPage
+	}
+	if f.GetSince() > 0 {
+		out.Since = time.Unix(f.GetSince(), 0)
+	}
+	if f.GetUntil() > 0 {
+		out.Until = time.Unix(f.GetUntil(), 0)
+	}
+	return out, nil
+}
+
+// deadLetterProto leaves the payload out of listings
+func deadLetterProto(dl *eventbus.DeadLetter, payload bool) *adminpb.DeadLetter {
+	out := &adminpb.DeadLetter{
+		Id:          dl.ID,
+		Topic:       dl.Topic,
+		Group:       dl.Group,
+		Reason:      dl.Reason,
+		ErrorType:   dl.ErrorType,
+		Error:       dl.Error,
+		Attempts:    int32(dl.Attempts),
+		FailedAt:    dl.FailedAt.Unix(),
+		ContentType: dl.ContentType,
+	}
+	if e := dl.Event; e != nil {
+		out.EventId = e.ID
+		out.EventType = e.Type
+		out.Key = e.Key
+		out.TraceId = e.TraceID
+		if payload {
+			out.Data = string(e.Data)
+		}
+	}
+	if payload {
+		out.Raw = dl.Raw
+	}
+	return out
+}
+
+func quotaPeriod(p quota.Period) *adminpb.QuotaPeriod {
+	return &adminpb.QuotaPeriod{
+		Used:      p.Used,
+		Limit:     p.Limit,
+		Remaining: p.Remaining(),
+		ResetAt:   p.Reset.Unix(),
+	}
+}
+
+func metricsResponse(m Metrics) *adminpb.GetMetricsResponse {
+	return &adminpb.GetMetricsResponse{
+		TotalRequests:     m.TotalRequests,
+		SuccessfulCalls:   m.SuccessfulCalls,
+		FailedCalls:       m.FailedCalls,
+		AvgResponseTimeMs: m.AvgResponseTime.Milliseconds(),
+	}
+}
@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"blueprint/pkg/cache"
+	apperrors "blueprint/pkg/errors"
+	"blueprint/pkg/eventbus"
+	"blueprint/pkg/fault"
+	"blueprint/pkg/maintenance"
+	"blueprint/pkg/quota"
+	"blueprint/pkg/settings"
+	adminpb "blueprint/proto/admin"
+	pb "blueprint/proto/blueprint"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestAdmin() (*Admin, *MockLogger, *MockLevelSetter, *MockPrefixFlusher) {
+	log := &MockLogger{}
+	log.On("Infow", mock.Anything, mock.Anything).Return()
+	log.On("Warnw", mock.Anything, mock.Anything).Return()
+	log.On("Errorw", mock.Anything, mock.Anything).Return()
+	levels := &MockLevelSetter{}
+	flusher := &MockPrefixFlusher{}
+	b := NewBlueprint(nil, log, nil, nil)
+	return NewAdmin(b, log, levels, flusher), log, levels, flusher
+}
+
+func TestAdminMetrics(t *testing.T) {
+	ctx := context.Background()
+	a, _, _, _ := newTestAdmin()
+
+	_, err := a.Blueprint.Call(ctx, &pb.CallRequest{Name: "ops"})
+	require.NoError(t, err)
+
+	got, err := a.GetMetrics(ctx, &adminpb.GetMetricsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), got.TotalRequests)
+
+	prev, err := a.ResetMetrics(ctx, &adminpb.ResetMetricsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), prev.TotalRequests, "returns the counters before the reset")
+	assert.Zero(t, a.Blueprint.GetMetrics().TotalRequests)
+}
+
+func TestAdminSetLogLevel(t *testing.T) {
+	ctx := context.Background()
+	a, _, levels, _ := newTestAdmin()
+	levels.On("GetLevel").Return("info")
+	levels.On("SetLevel", "debug").Return(nil).Once()
+	levels.On("ModuleLevels").Return(map[string]string{"redis": "warn"})
+	levels.On("SetModuleLevel", "redis", "error").Return(nil).Once()
+	levels.On("SetLevel", "loud").Return(errors.New("unrecognized level")).Once()
+
+	resp, err := a.SetLogLevel(ctx, &adminpb.SetLogLevelRequest{Level: "DEBUG"})
+	require.NoError(t, err)
+	assert.Equal(t, "info", resp.PreviousLevel)
+
+	resp, err = a.SetLogLevel(ctx, &adminpb.SetLogLevelRequest{Level: "error", Module: "redis"})
+	require.NoError(t, err)
+	assert.Equal(t, "warn", resp.PreviousLevel, "the module's own level")
+
+	_, err = a.SetLogLevel(ctx, &adminpb.SetLogLevelRequest{Level: "loud"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	levels.AssertExpectations(t)
+}
+
+func TestAdminFlushCachePrefix(t *testing.T) {
+	ctx := context.Background()
+	a, _, _, flusher := newTestAdmin()
+	flusher.On("FlushPrefix", ctx, "user:").Return(int64(3), nil).Once()
+
+	resp, err := a.FlushCachePrefix(ctx, &adminpb.FlushCachePrefixRequest{Prefix: "user:"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), resp.Deleted)
+
+	flusher.On("FlushPrefix", ctx, "order:").Return(int64(0), fmt.Errorf("cache flush_prefix order:: %w", cache.ErrUnavailable)).Once()
+	_, err = a.FlushCachePrefix(ctx, &adminpb.FlushCachePrefixRequest{Prefix: "order:"})
+	assert.Equal(t, codes.Unavailable, status.Code(err), "redis is down")
+
+	_, err = a.FlushCachePrefix(ctx, &adminpb.FlushCachePrefixRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "no accidental full flush")
+	flusher.AssertExpectations(t)
+}
+
+func TestAdminToggleFeatureFlag(t *testing.T) {
+	ctx := context.Background()
+	a, _, _, _ := newTestAdmin()
+
+	resp, err := a.ToggleFeatureFlag(ctx, &adminpb.ToggleFeatureFlagRequest{Name: "beta", Enabled: true})
+	require.NoError(t, err)
+	assert.False(t, resp.Previous)
+	assert.True(t, a.Blueprint.Flags.Enabled("beta"), "shared with the Blueprint handler")
+
+	resp, err = a.ToggleFeatureFlag(ctx, &adminpb.ToggleFeatureFlagRequest{Name: "beta"})
+	require.NoError(t, err)
+	assert.True(t, resp.Previous)
+	assert.False(t, a.Blueprint.Flags.Enabled("beta"))
+}
+
+func TestAdminGetQuotaUsage(t *testing.T) {
+	ctx := context.Background()
+	a, _, _, _ := newTestAdmin()
+
+	_, err := a.GetQuotaUsage(ctx, &adminpb.GetQuotaUsageRequest{ApiKey: "k1"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "quotas off")
+
+	q := &MockQuotaReader{}
+	q.On("Usage", ctx, "k1").Return(quota.Usage{
+		Daily:   quota.Period{Used: 10, Limit: 10},
+		Monthly: quota.Period{Used: 10},
+	}, nil)
+	a.Quota = q
+
+	resp, err := a.GetQuotaUsage(ctx, &adminpb.GetQuotaUsageRequest{ApiKey: "k1"})
+	require.NoError(t, err)
+	assert.Equal(t, quota.KeyID("k1"), resp.KeyId)
+	assert.Zero(t, resp.Daily.Remaining)
+	assert.Equal(t, int64(-1), resp.Monthly.Remaining)
+	assert.True(t, resp.Exceeded)
+}
+
+func TestAdminMaintenance(t *testing.T) {
+	ctx := context.Background()
+	a, _, _, _ := newTestAdmin()
+
+	_, err := a.GetMaintenance(ctx, &adminpb.GetMaintenanceRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "no switch")
+
+	a.Maintenance = maintenance.NewWithOptions(nil, maintenance.Options{})
+	_, err = a.SetMaintenance(ctx, &adminpb.SetMaintenanceRequest{Enabled: true, ExpectedSeconds: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	resp, err := a.SetMaintenance(ctx, &adminpb.SetMaintenanceRequest{Enabled: true, Reason: "upgrade", ExpectedSeconds: 600})
+	require.NoError(t, err)
+	assert.False(t, resp.Previous)
+	assert.True(t, resp.Status.Enabled)
+	assert.Equal(t, "upgrade", resp.Status.Reason)
+	assert.Equal(t, int64(600), resp.Status.Until-resp.Status.Since)
+	assert.False(t, resp.Status.Shared, "no store")
+
+	got, err := a.GetMaintenance(ctx, &adminpb.GetMaintenanceRequest{})
+	require.NoError(t, err)
+	assert.True(t, got.Enabled)
+
+	resp, err = a.SetMaintenance(ctx, &adminpb.SetMaintenanceRequest{})
+	require.NoError(t, err)
+	assert.True(t, resp.Previous)
+	assert.False(t, resp.Status.Enabled)
+	assert.Zero(t, resp.Status.Since)
+}
+
+func TestAdminFaults(t *testing.T) {
+	ctx := context.Background()
+	a, _, _, _ := newTestAdmin()
+
+	_, err := a.GetFaults(ctx, &adminpb.GetFaultsRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "fault injection off")
+
+	a.Faults = fault.NewWithOptions(nil, fault.Options{})
+	_, err = a.SetFaults(ctx, &adminpb.SetFaultsRequest{Rules: []*adminpb.FaultRule{
+		{Target: "redis", Kind: "error", Rate: 0.1},
+		{Target: "kafka", Kind: "error", Rate: 0.1},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	e, ok := apperrors.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, "rules[1]", e.Violations[0].Field)
+
+	got, err := a.SetFaults(ctx, &adminpb.SetFaultsRequest{TtlSeconds: 300, Rules: []*adminpb.FaultRule{
+		{Target: "redis", Match: "get", Kind: "latency", LatencyMs: 250, Rate: 0.5},
+		{Target: "grpc", Kind: "error", Code: "deadline_exceeded", Rate: 1},
+	}})
+	require.NoError(t, err)
+	require.Len(t, got.Rules, 2)
+	assert.Equal(t, int64(250), got.Rules[0].LatencyMs)
+	assert.Equal(t, "DEADLINE_EXCEEDED", got.Rules[1].Code)
+	assert.InDelta(t, time.Now().Add(5*time.Minute).Unix(), got.Until, 2)
+
+	got, err = a.SetFaults(ctx, &adminpb.SetFaultsRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, got.Rules)
+	assert.Zero(t, got.Until)
+}
+
+func TestAdminSettings(t *testing.T) {
+	ctx := context.Background()
+	a, log, _, _ := newTestAdmin()
+
+	_, err := a.GetSetting(ctx, &adminpb.GetSettingRequest{Namespace: "trading", Key: "spread_bps"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "no settings store")
+
+	store := &MockSettingsStore{}
+	a.Settings = store
+	def := settings.Def{Namespace: "trading", Key: "spread_bps", Type: settings.Int, Default: "15"}
+	updated := time.Unix(1700000000, 0)
+	store.On("Get", mock.Anything, "trading", "spread_bps").Return(settings.Value{Def: def, Value: "15"}, nil)
+	store.On("Get", mock.Anything, "trading", "fee").Return(settings.Value{}, fmt.Errorf("%w trading.fee", settings.ErrUnknown))
+	store.On("Set", mock.Anything, "trading", "spread_bps", "20").Return(settings.Value{Def: def, Value: "20", Overridden: true, UpdatedAt: updated, UpdatedBy: "ops-1"}, nil)
+	store.On("Set", mock.Anything, "trading", "spread_bps", "wide").Return(settings.Value{}, fmt.Errorf("setting trading.spread_bps: %w", settings.ErrInvalid))
+
+	got, err := a.SetSetting(ctx, &adminpb.SetSettingRequest{Namespace: "trading", Key: "spread_bps", Value: "20"})
+	require.NoError(t, err)
+	assert.Equal(t, "20", got.Value)
+	assert.Equal(t, "15", got.DefaultValue)
+	assert.Equal(t, "int", got.Type)
+	assert.Equal(t, updated.Unix(), got.UpdatedAt)
+	log.AssertCalled(t, "Warnw", "Setting changed", mock.Anything)
+
+	_, err = a.SetSetting(ctx, &adminpb.SetSettingRequest{Namespace: "trading", Key: "spread_bps", Value: "wide"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	e, ok := apperrors.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, "value", e.Violations[0].Field)
+
+	_, err = a.SetSetting(ctx, &adminpb.SetSettingRequest{Namespace: "trading", Key: "fee", Value: "1"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	got, err = a.GetSetting(ctx, &adminpb.GetSettingRequest{Namespace: "trading", Key: "spread_bps"})
+	require.NoError(t, err)
+	assert.False(t, got.Overridden)
+	assert.Zero(t, got.UpdatedAt)
+}
+
+func TestAdminDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	a, _, _, _ := newTestAdmin()
+
+	_, err := a.ListDeadLetters(ctx, &adminpb.ListDeadLettersRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "no dead letter store")
+
+	store := eventbus.NewMemoryDeadLetters(0)
+	bus := eventbus.NewMemory(eventbus.Options{})
+	defer bus.Close()
+	a.DeadLetters = &eventbus.DeadLetterQueue{Store: store, Bus: bus}
+	failed := time.Now().Add(-time.Hour)
+	for _, dl := range []*eventbus.DeadLetter{
+		{Topic: "orders", Group: "risk", ErrorType: "panic", FailedAt: failed, Event: &eventbus.Event{ID: "e-1", Type: "order.placed", Data: []byte(`{"id":"o-1"}`)}},
+		{Topic: "orders", Group: "risk", ErrorType: "UNAVAILABLE", FailedAt: failed, Event: &eventbus.Event{ID: "e-2", Type: "order.placed"}},
+		{Topic: "orders", Group: "risk", ErrorType: "undecodable", FailedAt: failed, Raw: []byte("garbage")},
+	} {
+		require.NoError(t, store.Add(ctx, dl))
+	}
+
+	page, err := a.ListDeadLetters(ctx, &adminpb.ListDeadLettersRequest{PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, page.DeadLetters, 2)
+	assert.Equal(t, "e-1", page.DeadLetters[0].EventId)
+	assert.Empty(t, page.DeadLetters[0].Data, "listings leave payloads out")
+	page, err = a.ListDeadLetters(ctx, &adminpb.ListDeadLettersRequest{PageSize: 2, PageToken: page.NextPageToken})
+	require.NoError(t, err)
+	require.Len(t, page.DeadLetters, 1)
+	assert.Empty(t, page.NextPageToken)
+	undecodable := page.DeadLetters[0].Id
+
+	_, err = a.ListDeadLetters(ctx, &adminpb.ListDeadLettersRequest{Filter: &adminpb.DeadLetterFilter{Since: 10, Until: 5}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	list, err := a.ListDeadLetters(ctx, &adminpb.ListDeadLettersRequest{Filter: &adminpb.DeadLetterFilter{ErrorType: "panic"}})
+	require.NoError(t, err)
+	require.Len(t, list.DeadLetters, 1)
+	dl, err := a.GetDeadLetter(ctx, &adminpb.GetDeadLetterRequest{Id: list.DeadLetters[0].Id})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"o-1"}`, dl.Data)
+	_, err = a.GetDeadLetter(ctx, &adminpb.GetDeadLetterRequest{Id: "1-999"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// an empty request must not touch the whole queue
+	_, err = a.ReplayDeadLetters(ctx, &adminpb.ReplayDeadLettersRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = a.DeleteDeadLetters(ctx, &adminpb.DeleteDeadLettersRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	in := make(chan *eventbus.Event, 2)
+	require.NoError(t, bus.Subscribe(ctx, "orders", "risk", func(ctx context.Context, e *eventbus.Event) error {
+		in <- e
+		return nil
+	}))
+	replay, err := a.ReplayDeadLetters(ctx, &adminpb.ReplayDeadLettersRequest{Filter: &adminpb.DeadLetterFilter{Topic: "orders"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), replay.Replayed)
+	assert.Equal(t, undecodable, replay.FailedId, "stops at what it cannot publish")
+	assert.NotEmpty(t, replay.Error)
+	for _, id := range []string{"e-1", "e-2"} {
+		select {
+		case e := <-in:
+			assert.Equal(t, id, e.ID)
+		case <-time.After(time.Second):
+			t.Fatalf("%s not replayed", id)
+		}
+	}
+
+	deleted, err := a.DeleteDeadLetters(ctx, &adminpb.DeleteDeadLettersRequest{Ids: []string{undecodable}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted.Deleted)
+	left, err := store.List(ctx, eventbus.DeadLetterFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, left)
+}
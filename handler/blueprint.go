@@ -8,11 +8,16 @@ import (
 	"time"
 
 	pb "blueprint/proto/blueprint"
-	"blueprint/pkg/cache"
-	"blueprint/pkg/logger"
+	"blueprint/pkg/account"
+	"blueprint/pkg/buildinfo"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/dispatch"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/hedge"
 	"blueprint/pkg/i18n"
+	"blueprint/pkg/settings"
 	
-	"gorm.io/gorm"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -25,104 +30,106 @@ const (
 type Blueprint struct {
 	pb.UnimplementedBlueprintServer
 	
+	// Service is the name Version reports
+	Service     string
 	Local       *i18n.Lang
-	Log         *logger.Logger
-	Cache       *cache.Cache
-	DB          *gorm.DB
+	Log         Logger
+	Cache       Cache
+	// CacheOptional keeps HealthCheck green while the cache is down, see
+	// config.Cache.Optional
+	CacheOptional bool
+	Store       Store
+	// Clock drives the call timings, clock.Real when nil
+	Clock       clock.Clock
+	// Flags are toggled through the AdminService
+	Flags       *Flags
+	// Hedge sends a second attempt of slow Store reads, nil disables it
+	Hedge       *hedge.Hedger
+	// Events hands domain events to the other modules of the process
+	Events      *dispatch.Dispatcher
+	// Settings are the SettingDefs, nil without a database
+	Settings    *settings.Store
+	// Accounts serves the account RPCs, nil without a database
+	Accounts    *account.Service
 	
 	mu          sync.RWMutex
 	metrics     Metrics
-	rateLimiter *RateLimiter
 }
 
 type Metrics struct {
 	TotalRequests   uint64
 	SuccessfulCalls uint64
 	FailedCalls     uint64
-	CacheHits       uint64
-	CacheMisses     uint64
 	AvgResponseTime time.Duration
 }
 
-type RateLimiter struct {
-	requests map[string][]time.Time
-	mu       sync.Mutex
-	limit    int
-	window   time.Duration
-}
-
-func NewBlueprint(local *i18n.Lang, l *logger.Logger, c *cache.Cache, db *gorm.DB) *Blueprint {
+func NewBlueprint(local *i18n.Lang, l Logger, c Cache, store Store) *Blueprint {
 	return &Blueprint{
 		Local: local,
 		Log:   l,
 		Cache: c,
-		DB:    db,
-		rateLimiter: &RateLimiter{
-			requests: make(map[string][]time.Time),
-			limit:    100,
-			window:   time.Minute,
-		},
+		Store: store,
+		Clock: clock.Real,
+		Flags: NewFlags(),
 	}
 }
 
 func (b *Blueprint) Call(ctx context.Context, req *pb.CallRequest) (*pb.CallResponse, error) {
-	start := time.Now()
+	clk := clock.Or(b.Clock)
+	start := clk.Now()
 	defer func() {
-		b.recordMetrics(time.Since(start), nil)
+		b.recordMetrics(clk.Since(start), nil)
 	}()
 
 	if err := b.validateRequest(req); err != nil {
-		b.Log.WithError(err).Error("Invalid request")
-		return nil, status.Error(codes.InvalidArgument, err.Error())
+		b.Log.Errorw("Invalid request", logFields(ctx, "error", err.Error())...)
+		return nil, err
 	}
 
-	if !b.checkRateLimit(ctx, req.Name) {
-		return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
-	}
+	// rate limits are applied before the call gets here, see
+	// config.RateLimit
 
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	b.Log.WithFields(map[string]interface{}{
-		"method": "Blueprint.Call",
-		"name":   req.Name,
-	}).Info("Processing request")
-
-	cacheKey := fmt.Sprintf("call:%s", req.Name)
-	
-	var cachedResponse pb.CallResponse
-	if err := b.Cache.Get(ctx, cacheKey, &cachedResponse); err == nil {
-		b.incrementCacheHit()
-		b.Log.Debug("Cache hit for key: " + cacheKey)
-		return &cachedResponse, nil
-	}
-	b.incrementCacheMiss()
+	b.Log.Infow("Processing request", logFields(ctx, "method", "Blueprint.Call", "name", req.Name)...)
 
+	// repeated calls are answered by the response cache interceptor, see
+	// config.ResponseCache
 	response := &pb.CallResponse{
 		Msg: fmt.Sprintf("Hello %s from Platform", req.Name),
 	}
 
 	if err := b.processBusinessLogic(ctx, req, response); err != nil {
-		b.Log.WithError(err).Error("Failed to process business logic")
+		b.Log.Errorw("Failed to process business logic", logFields(ctx, "error", err.Error())...)
 		return nil, status.Error(codes.Internal, "internal server error")
 	}
 
-	if err := b.Cache.SetWithTTL(ctx, cacheKey, response, 5*time.Minute); err != nil {
-		b.Log.WithError(err).Warn("Failed to cache response")
-	}
-
 	return response, nil
 }
 
+// Version reports the build of this binary, see buildinfo
+func (b *Blueprint) Version(ctx context.Context, req *pb.VersionRequest) (*pb.VersionResponse, error) {
+	info := buildinfo.Get()
+	return &pb.VersionResponse{
+		Service:   b.Service,
+		Version:   info.Version,
+		Commit:    info.Commit,
+		BuildTime: info.BuildTime,
+		GoVersion: info.GoVersion,
+		Modified:  info.Modified,
+	}, nil
+}
+
 func (b *Blueprint) validateRequest(req *pb.CallRequest) error {
 	if req == nil {
-		return fmt.Errorf("request is nil")
+		return errors.InvalidArgument("request is nil")
 	}
 	if req.Name == "" {
-		return fmt.Errorf("name is required")
+		return errors.InvalidArgument("name is required", errors.FieldViolation{Field: "name", Description: "must not be empty"})
 	}
 	if len(req.Name) > 100 {
-		return fmt.Errorf("name is too long")
+		return errors.InvalidArgument("name is too long", errors.FieldViolation{Field: "name", Description: "must be at most 100 characters"})
 	}
 	return nil
 }
@@ -134,48 +141,23 @@ func (b *Blueprint) processBusinessLogic(ctx context.Context, req *pb.CallReques
 	default:
 	}
 
-	if b.DB != nil {
-		tx := b.DB.WithContext(ctx)
-		
-		var count int64
-		if err := tx.Raw("SELECT COUNT(*) FROM information_schema.tables").Count(&count).Error; err != nil {
-			b.Log.WithError(err).Warn("Database query failed")
+	if b.Store != nil {
+		// deadlocks and dropped connections get another go, anything else fails fast
+		// a read, so slow attempts may be hedged too
+		err := errors.Retry(ctx, errors.RetryOptions{Attempts: maxRetries}, func(ctx context.Context) error {
+			_, err := b.Hedge.Do(ctx, func(ctx context.Context) (interface{}, error) {
+				return b.Store.CountTables(ctx)
+			})
+			return err
+		})
+		if err != nil {
+			b.Log.Warnw("Database query failed", logFields(ctx, "error", err.Error())...)
 		}
 	}
 
 	return nil
 }
 
-func (b *Blueprint) checkRateLimit(ctx context.Context, identifier string) bool {
-	b.rateLimiter.mu.Lock()
-	defer b.rateLimiter.mu.Unlock()
-
-	now := time.Now()
-	windowStart := now.Add(-b.rateLimiter.window)
-
-	requests, exists := b.rateLimiter.requests[identifier]
-	if !exists {
-		b.rateLimiter.requests[identifier] = []time.Time{now}
-		return true
-	}
-
-	var validRequests []time.Time
-	for _, t := range requests {
-		if t.After(windowStart) {
-			validRequests = append(validRequests, t)
-		}
-	}
-
-	if len(validRequests) >= b.rateLimiter.limit {
-		return false
-	}
-
-	validRequests = append(validRequests, now)
-	b.rateLimiter.requests[identifier] = validRequests
-
-	return true
-}
-
 func (b *Blueprint) recordMetrics(duration time.Duration, err error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -194,42 +176,49 @@ func (b *Blueprint) recordMetrics(duration time.Duration, err error) {
 	}
 }
 
-func (b *Blueprint) incrementCacheHit() {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	b.metrics.CacheHits++
-}
-
-func (b *Blueprint) incrementCacheMiss() {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	b.metrics.CacheMisses++
-}
-
 func (b *Blueprint) GetMetrics() Metrics {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	return b.metrics
 }
 
-func (b *Blueprint) ResetMetrics() {
+// ResetMetrics zeroes the counters and returns what they were
+func (b *Blueprint) ResetMetrics() Metrics {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	prev := b.metrics
 	b.metrics = Metrics{}
+	return prev
 }
 
 func (b *Blueprint) HealthCheck(ctx context.Context) error {
-	if b.DB != nil {
-		if err := b.DB.WithContext(ctx).Exec("SELECT 1").Error; err != nil {
+	if b.Store != nil {
+		if err := b.Store.Ping(ctx); err != nil {
 			return fmt.Errorf("database connection failed: %w", err)
 		}
 	}
 
 	if b.Cache != nil {
 		if err := b.Cache.Ping(ctx); err != nil {
+			if b.CacheOptional {
+				// calls are served from the database until redis is back
+				b.Log.Warnw("Cache unavailable, serving without it", logFields(ctx, "error", err.Error())...)
+				return nil
+			}
 			return fmt.Errorf("cache connection failed: %w", err)
 		}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// logFields puts the request and trace ids from ctx in front of kv, what
+// logger.WithContext does for *logger.Logger
+func logFields(ctx context.Context, kv ...interface{}) []interface{} {
+	fields := ctxmeta.FromContext(ctx).Fields()
+	out := make([]interface{}, 0, len(fields)*2+len(kv))
+	for k, v := range fields {
+		out = append(out, k, v)
+	}
+	return append(out, kv...)
+}
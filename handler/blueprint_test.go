@@ -2,14 +2,23 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"runtime"
 
 	"blueprint/config"
+	"blueprint/pkg/buildinfo"
+	"blueprint/pkg/cache"
 	"blueprint/pkg/logger"
 	pb "blueprint/proto/blueprint"
 	"testing"
 
 	. "github.com/modern-go/test"
 	. "github.com/modern-go/test/must"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	 
 )
 
@@ -44,3 +53,96 @@ func TestCall(t *testing.T) {
 	}
 
 }
+
+func TestHealthCheck(t *testing.T) {
+	h := Blueprint{Cache: cache.NewMemory()}
+	if err := h.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.HealthCheck(ctx); err == nil {
+		t.Fatal("HealthCheck should fail when the cache is unreachable")
+	}
+}
+
+func TestCallWithMocks(t *testing.T) {
+	log := &MockLogger{}
+	log.On("Infow", "Processing request", mock.Anything).Return()
+	store := &MockStore{}
+	store.On("CountTables", mock.Anything).Return(int64(42), nil).Once()
+
+	h := NewBlueprint(nil, log, &MockCache{}, store)
+	rsp, err := h.Call(context.Background(), &pb.CallRequest{Name: "value"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello value from Platform", rsp.Msg)
+
+	log.AssertExpectations(t)
+	store.AssertExpectations(t)
+}
+
+func TestCallStoreFailureIsLogged(t *testing.T) {
+	log := &MockLogger{}
+	log.On("Infow", "Processing request", mock.Anything).Return()
+	log.On("Warnw", "Database query failed", mock.Anything).Return().Once()
+	store := &MockStore{}
+	// not retryable, so exactly one attempt
+	store.On("CountTables", mock.Anything).Return(int64(0), errors.New("syntax error")).Once()
+
+	h := NewBlueprint(nil, log, &MockCache{}, store)
+	_, err := h.Call(context.Background(), &pb.CallRequest{Name: "value"})
+	require.NoError(t, err, "the database query is best effort")
+
+	log.AssertExpectations(t)
+	store.AssertExpectations(t)
+}
+
+func TestCallInvalidRequest(t *testing.T) {
+	log := &MockLogger{}
+	log.On("Errorw", "Invalid request", mock.Anything).Return().Once()
+
+	h := NewBlueprint(nil, log, nil, nil)
+	_, err := h.Call(context.Background(), &pb.CallRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	log.AssertExpectations(t)
+}
+
+func TestHealthCheckWithMocks(t *testing.T) {
+	ctx := context.Background()
+
+	store := &MockStore{}
+	store.On("Ping", ctx).Return(errors.New("connection refused"))
+	h := NewBlueprint(nil, &MockLogger{}, nil, store)
+	assert.ErrorContains(t, h.HealthCheck(ctx), "database connection failed")
+
+	store = &MockStore{}
+	store.On("Ping", ctx).Return(nil)
+	c := &MockCache{}
+	c.On("Ping", ctx).Return(errors.New("connection refused"))
+	h = NewBlueprint(nil, &MockLogger{}, c, store)
+	assert.ErrorContains(t, h.HealthCheck(ctx), "cache connection failed")
+
+	log := &MockLogger{}
+	log.On("Warnw", "Cache unavailable, serving without it", mock.Anything).Return().Once()
+	h = NewBlueprint(nil, log, c, store)
+	h.CacheOptional = true
+	assert.NoError(t, h.HealthCheck(ctx), "an optional cache being down is not unhealthy")
+	log.AssertExpectations(t)
+
+	c = &MockCache{}
+	c.On("Ping", ctx).Return(nil)
+	h = NewBlueprint(nil, &MockLogger{}, c, store)
+	assert.NoError(t, h.HealthCheck(ctx))
+}
+
+func TestVersion(t *testing.T) {
+	h := NewBlueprint(nil, &MockLogger{}, nil, nil)
+	h.Service = "platform-blueprint"
+
+	resp, err := h.Version(context.Background(), &pb.VersionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "platform-blueprint", resp.Service)
+	assert.Equal(t, buildinfo.Get().Version, resp.Version)
+	assert.Equal(t, runtime.Version(), resp.GoVersion)
+}
@@ -0,0 +1,54 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package handler
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+//go:generate go run github.com/vektra/mockery/v2@v2.53.5 --name=^(Logger|Cache|Store)$ --inpackage --testonly --output=. --unroll-variadic=false --with-expecter=false
+
+// Logger is the part of *logger.Logger the handlers use, context fields
+// are passed along with the key/value pairs, see logFields
+type Logger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// Cache is the part of cache.Store the handlers use, responses themselves
+// are cached by the interceptor
+type Cache interface {
+	Ping(ctx context.Context) error
+}
+
+// Store is the database as the handlers see it
+type Store interface {
+	CountTables(ctx context.Context) (int64, error)
+	Ping(ctx context.Context) error
+}
+
+// GormStore runs the Store queries on db, nil gives a nil Store so the
+// handlers skip the database
+func GormStore(db *gorm.DB) Store {
+	if db == nil {
+		return nil
+	}
+	return &gormStore{db: db}
+}
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+func (s *gormStore) CountTables(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Raw("SELECT COUNT(*) FROM information_schema.tables").Count(&count).Error
+	return count, err
+}
+
+func (s *gormStore) Ping(ctx context.Context) error {
+	return s.db.WithContext(ctx).Exec("SELECT 1").Error
+}
@@ -0,0 +1,40 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package handler
+
+import "sync"
+
+// Flags are runtime feature switches, off until turned on through the
+// AdminService. They live in the process, every replica is toggled on its
+// own and a restart turns them all off again.
+type Flags struct {
+	mu sync.RWMutex
+	on map[string]bool
+}
+
+func NewFlags() *Flags {
+	return &Flags{on: make(map[string]bool)}
+}
+
+// Enabled is false for unknown flags and on a nil Flags
+func (f *Flags) Enabled(name string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.on[name]
+}
+
+// Set switches name and returns its previous state
+func (f *Flags) Set(name string, enabled bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prev := f.on[name]
+	if enabled {
+		f.on[name] = true
+	} else {
+		delete(f.on, name)
+	}
+	return prev
+}
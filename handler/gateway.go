@@ -0,0 +1,233 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package handler
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/errors"
+	pb "blueprint/proto/blueprint"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const maxGatewayBody = 1 << 20
+
+// headers copied from the HTTP request into the outgoing gRPC metadata
+var gatewayHeaders = []string{
+	ctxmeta.HeaderRequestID,
+	ctxmeta.HeaderTraceID,
+	ctxmeta.HeaderTraceParent,
+	ctxmeta.HeaderUserID,
+	ctxmeta.HeaderForwarded,
+	ctxmeta.HeaderTenantID,
+	ctxmeta.HeaderLocale,
+	ctxmeta.HeaderClientVersion,
+}
+
+// response headers copied from the gRPC header or trailer onto the HTTP
+// response, a refused call only has a trailer
+var gatewayResponseHeaders = []string{
+	"x-ratelimit-limit",
+	"x-ratelimit-remaining",
+	"x-ratelimit-reset",
+}
+
+// gatewayRoute is one REST route and the RPC behind it. ServeHTTP
+// dispatches on them and the OpenAPI spec takes its schemas from the RPC's
+// request and response messages, so a route can't be served without being
+// documented.
+type gatewayRoute struct {
+	Path   string
+	Method string
+	RPC    protoreflect.Name
+	serve  func(g *Gateway, w http.ResponseWriter, r *http.Request)
+}
+
+var gatewayRoutes = []gatewayRoute{
+	{Path: "/v1/call", Method: http.MethodPost, RPC: "Call", serve: (*Gateway).call},
+}
+
+func findGatewayRoute(path string) (gatewayRoute, bool) {
+	for _, route := range gatewayRoutes {
+		if route.Path == path {
+			return route, true
+		}
+	}
+	return gatewayRoute{}, false
+}
+
+// Gateway exposes the Blueprint service as JSON over HTTP. It calls the gRPC
+// server through conn so REST requests go through the same interceptors.
+//
+//	POST /v1/call  {"name": "..."}
+//
+// With Docs set it also serves the OpenAPI spec at /openapi.json and the
+// Swagger UI at /docs.
+type Gateway struct {
+	client pb.BlueprintClient
+	Docs   bool
+}
+
+func NewGateway(conn grpc.ClientConnInterface) *Gateway {
+	return &Gateway{client: pb.NewBlueprintClient(conn)}
+}
+
+// Route names the request for metrics, unknown paths share one name
+func (g *Gateway) Route(r *http.Request) string {
+	path := r.URL.Path
+	switch _, ok := findGatewayRoute(path); {
+	case ok, g.Docs && path == openAPIPath:
+		return path
+	case g.Docs && isDocsPath(path):
+		return docsPath
+	}
+	return "unmatched"
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if route, ok := findGatewayRoute(r.URL.Path); ok {
+		if r.Method != route.Method {
+			w.Header().Set("Allow", route.Method)
+			st := status.New(codes.Unimplemented, "method not allowed")
+			writeGatewayJSON(w, http.StatusMethodNotAllowed, st.Proto())
+			return
+		}
+		route.serve(g, w, r)
+		return
+	}
+
+	switch path := r.URL.Path; {
+	case g.Docs && path == openAPIPath:
+		g.openAPI(w, r)
+	case g.Docs && isDocsPath(path):
+		g.docs(w, r)
+	default:
+		writeGatewayError(w, status.Error(codes.NotFound, "no route for "+r.URL.Path))
+	}
+}
+
+func (g *Gateway) call(w http.ResponseWriter, r *http.Request) {
+	req := &pb.CallRequest{}
+	if err := readGatewayBody(r, req); err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+
+	var header, trailer metadata.MD
+	resp, err := g.client.Call(outgoingContext(r), req, grpc.Header(&header), grpc.Trailer(&trailer))
+	if ids := header.Get(ctxmeta.HeaderRequestID); len(ids) > 0 {
+		w.Header().Set("X-Request-Id", ids[0])
+	}
+	for _, h := range gatewayResponseHeaders {
+		for _, md := range []metadata.MD{header, trailer} {
+			if v := md.Get(h); len(v) > 0 {
+				w.Header().Set(h, v[0])
+			}
+		}
+	}
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+
+	writeGatewayJSON(w, http.StatusOK, resp)
+}
+
+func outgoingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	for _, h := range gatewayHeaders {
+		if v := r.Header.Get(h); v != "" {
+			md.Set(h, v)
+		}
+	}
+	// the gRPC peer is the gateway itself, pass the real client on behind
+	// any proxies it came through, the network ACL trusts the last hop
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Get(ctxmeta.HeaderForwarded); prior != "" {
+			host = prior + ", " + host
+		}
+		md.Set(ctxmeta.HeaderForwarded, host)
+	}
+	return metadata.NewOutgoingContext(r.Context(), md)
+}
+
+func readGatewayBody(r *http.Request, msg proto.Message) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxGatewayBody+1))
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "failed to read body")
+	}
+	if len(body) > maxGatewayBody {
+		return status.Error(codes.InvalidArgument, "body too large")
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	if err := protojson.Unmarshal(body, msg); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid json: %v", err)
+	}
+	return nil
+}
+
+func writeGatewayJSON(w http.ResponseWriter, code int, msg proto.Message) {
+	body, err := protojson.Marshal(msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// writeGatewayError turns the RetryInfo of rate limits, load shedding or
+// maintenance into a Retry-After header, in whole seconds rounded up
+func writeGatewayError(w http.ResponseWriter, err error) {
+	if e, ok := errors.FromError(err); ok && e.RetryAfter > 0 {
+		seconds := int64((e.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+	st := status.Convert(err)
+	writeGatewayJSON(w, HTTPStatusFromCode(st.Code()), st.Proto())
+}
+
+// HTTPStatusFromCode maps gRPC codes the same way grpc-gateway does
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
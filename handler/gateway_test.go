@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/ratelimit"
+	"blueprint/pkg/specs"
+	pb "blueprint/proto/blueprint"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type echoServer struct {
+	pb.UnimplementedBlueprintServer
+}
+
+func (echoServer) Call(ctx context.Context, req *pb.CallRequest) (*pb.CallResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if req.Name == "busy" {
+		return nil, errors.Unavailable("under maintenance", 90*time.Second+time.Millisecond)
+	}
+	ip, _ := ctxmeta.ClientIP(ctx)
+	return &pb.CallResponse{Msg: "Hello " + req.Name + " from " + ip}, nil
+}
+
+// gatewayPeers trusts the bufconn peer like the network ACL trusts the
+// gateway over loopback, the client is the last forwarded hop
+type gatewayPeers struct{}
+
+func (gatewayPeers) Trusted(ctx context.Context) bool { return true }
+
+func (gatewayPeers) ClientIP(ctx context.Context) net.IP {
+	md, _ := metadata.FromIncomingContext(ctx)
+	hops := strings.Split(strings.Join(md.Get(ctxmeta.HeaderForwarded), ","), ",")
+	return net.ParseIP(strings.TrimSpace(hops[len(hops)-1]))
+}
+
+func newTestGateway(t *testing.T, interceptors ...grpc.UnaryServerInterceptor) *Gateway {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(append([]grpc.UnaryServerInterceptor{ctxmeta.UnaryServerInterceptor(gatewayPeers{})}, interceptors...)...))
+	pb.RegisterBlueprintServer(s, echoServer{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return NewGateway(conn)
+}
+
+func TestGatewayCall(t *testing.T) {
+	gw := newTestGateway(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/call", strings.NewReader(`{"name":"value"}`))
+	req.RemoteAddr = "10.1.2.3:5555"
+	req.Header.Set(ctxmeta.HeaderRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"msg":"Hello value from 10.1.2.3"}`, rec.Body.String())
+	assert.Equal(t, "req-1", rec.Header().Get("X-Request-Id"))
+}
+
+func TestGatewayErrors(t *testing.T) {
+	gw := newTestGateway(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"grpc status", http.MethodPost, "/v1/call", `{}`, http.StatusBadRequest},
+		{"bad json", http.MethodPost, "/v1/call", `{`, http.StatusBadRequest},
+		{"wrong method", http.MethodGet, "/v1/call", ``, http.StatusMethodNotAllowed},
+		{"unknown route", http.MethodPost, "/v1/nope", ``, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.code, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"code"`)
+		})
+	}
+}
+
+func TestGatewayRetryAfter(t *testing.T) {
+	gw := newTestGateway(t)
+
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/call", strings.NewReader(`{"name":"busy"}`)))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "91", rec.Header().Get("Retry-After"), "rounded up")
+
+	rec = httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/call", strings.NewReader(`{}`)))
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+}
+
+func TestGatewayRateLimitHeaders(t *testing.T) {
+	policies, err := specs.ParseAll([]string{"Call=2/1m:ip"}, ratelimit.ParsePolicy)
+	require.NoError(t, err)
+	clk := clock.NewFake(time.Unix(1000, 0))
+	gw := newTestGateway(t, ratelimit.NewInterceptor(policies, "x-api-key", 0, nil, clk).UnaryServerInterceptor())
+
+	call := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/call", strings.NewReader(`{"name":"value"}`)))
+		return rec
+	}
+
+	rec := call()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-Ratelimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("X-Ratelimit-Remaining"))
+	assert.Equal(t, "1030", rec.Header().Get("X-Ratelimit-Reset"))
+
+	call()
+	rec = call()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("X-Ratelimit-Remaining"), "refused calls have them too")
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+}
+
+func TestGatewayRoute(t *testing.T) {
+	g := NewGateway(nil)
+	assert.Equal(t, "/v1/call", g.Route(httptest.NewRequest(http.MethodPost, "/v1/call", nil)))
+	assert.Equal(t, "unmatched", g.Route(httptest.NewRequest(http.MethodGet, "/wp-admin", nil)))
+}
+
+func TestGatewayRoutesDocumented(t *testing.T) {
+	paths := OpenAPI()["paths"].(map[string]interface{})
+	require.Len(t, paths, len(gatewayRoutes))
+	for _, route := range gatewayRoutes {
+		assert.Contains(t, paths[route.Path], strings.ToLower(route.Method), route.Path)
+		assert.Equal(t, route.Path, NewGateway(nil).Route(httptest.NewRequest(route.Method, route.Path, nil)))
+	}
+}
+
+func TestGatewayDocs(t *testing.T) {
+	g := NewGateway(nil)
+	rec := httptest.NewRecorder()
+	g.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "off unless Docs is set")
+
+	g.Docs = true
+	rec = httptest.NewRecorder()
+	g.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Type   string
+					Format string
+				}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &spec))
+	assert.Equal(t, "blueprint.Blueprint.Call", spec.Paths["/v1/call"]["post"].OperationID)
+	assert.Equal(t, "string", spec.Components.Schemas["blueprint.CallRequest"].Properties["name"].Type)
+	assert.Contains(t, spec.Components.Schemas, "google.rpc.Status")
+	assert.Equal(t, "int32", spec.Components.Schemas["google.rpc.Status"].Properties["code"].Format)
+
+	rec = httptest.NewRecorder()
+	g.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "/openapi.json")
+	assert.NotContains(t, rec.Body.String(), "https://", "the UI is served by the gateway")
+	assert.Equal(t, "/docs", g.Route(httptest.NewRequest(http.MethodGet, "/docs", nil)))
+
+	for _, asset := range []string{"/docs/swagger-ui.css", "/docs/swagger-ui-bundle.js"} {
+		rec = httptest.NewRecorder()
+		g.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, asset, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, asset)
+		assert.NotEmpty(t, rec.Body.Bytes(), asset)
+		assert.Equal(t, "/docs", g.Route(httptest.NewRequest(http.MethodGet, asset, nil)))
+	}
+}
@@ -0,0 +1,98 @@
+// Code generated by mockery v2.53.5. DO NOT EDIT.
+
+package handler
+
+import mock "github.com/stretchr/testify/mock"
+
+// MockLevelSetter is an autogenerated mock type for the LevelSetter type
+type MockLevelSetter struct {
+	mock.Mock
+}
+
+// GetLevel provides a mock function with no fields
+func (_m *MockLevelSetter) GetLevel() string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetLevel")
+	}
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// ModuleLevels provides a mock function with no fields
+func (_m *MockLevelSetter) ModuleLevels() map[string]string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for ModuleLevels")
+	}
+
+	var r0 map[string]string
+	if rf, ok := ret.Get(0).(func() map[string]string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]string)
+		}
+	}
+
+	return r0
+}
+
+// SetLevel provides a mock function with given fields: level
+func (_m *MockLevelSetter) SetLevel(level string) error {
+	ret := _m.Called(level)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetLevel")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(level)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetModuleLevel provides a mock function with given fields: name, level
+func (_m *MockLevelSetter) SetModuleLevel(name string, level string) error {
+	ret := _m.Called(name, level)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetModuleLevel")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(name, level)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewMockLevelSetter creates a new instance of MockLevelSetter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockLevelSetter(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockLevelSetter {
+	mock := &MockLevelSetter{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,44 @@
+// Code generated by mockery v2.53.5. DO NOT EDIT.
+
+package handler
+
+import mock "github.com/stretchr/testify/mock"
+
+// MockLogger is an autogenerated mock type for the Logger type
+type MockLogger struct {
+	mock.Mock
+}
+
+// Debugw provides a mock function with given fields: msg, keysAndValues
+func (_m *MockLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	_m.Called(msg, keysAndValues)
+}
+
+// Errorw provides a mock function with given fields: msg, keysAndValues
+func (_m *MockLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	_m.Called(msg, keysAndValues)
+}
+
+// Infow provides a mock function with given fields: msg, keysAndValues
+func (_m *MockLogger) Infow(msg string, keysAndValues ...interface{}) {
+	_m.Called(msg, keysAndValues)
+}
+
+// Warnw provides a mock function with given fields: msg, keysAndValues
+func (_m *MockLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	_m.Called(msg, keysAndValues)
+}
+
+// NewMockLogger creates a new instance of MockLogger. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockLogger(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockLogger {
+	mock := &MockLogger{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
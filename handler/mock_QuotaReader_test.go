@@ -0,0 +1,57 @@
+// Code generated by mockery v2.53.5. DO NOT EDIT.
+
+package handler
+
+import (
+	quota "blueprint/pkg/quota"
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockQuotaReader is an autogenerated mock type for the QuotaReader type
+type MockQuotaReader struct {
+	mock.Mock
+}
+
+// Usage provides a mock function with given fields: ctx, apiKey
+func (_m *MockQuotaReader) Usage(ctx context.Context, apiKey string) (quota.Usage, error) {
+	ret := _m.Called(ctx, apiKey)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Usage")
+	}
+
+	var r0 quota.Usage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (quota.Usage, error)); ok {
+		return rf(ctx, apiKey)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) quota.Usage); ok {
+		r0 = rf(ctx, apiKey)
+	} else {
+		r0 = ret.Get(0).(quota.Usage)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, apiKey)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewMockQuotaReader creates a new instance of MockQuotaReader. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockQuotaReader(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockQuotaReader {
+	mock := &MockQuotaReader{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,143 @@
+// Code generated by mockery v2.53.5. DO NOT EDIT.
+
+package handler
+
+import (
+	settings "blueprint/pkg/settings"
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockSettingsStore is an autogenerated mock type for the SettingsStore type
+type MockSettingsStore struct {
+	mock.Mock
+}
+
+// Get provides a mock function with given fields: ctx, namespace, key
+func (_m *MockSettingsStore) Get(ctx context.Context, namespace string, key string) (settings.Value, error) {
+	ret := _m.Called(ctx, namespace, key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Get")
+	}
+
+	var r0 settings.Value
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (settings.Value, error)); ok {
+		return rf(ctx, namespace, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) settings.Value); ok {
+		r0 = rf(ctx, namespace, key)
+	} else {
+		r0 = ret.Get(0).(settings.Value)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, namespace, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// List provides a mock function with given fields: ctx, namespace
+func (_m *MockSettingsStore) List(ctx context.Context, namespace string) ([]settings.Value, error) {
+	ret := _m.Called(ctx, namespace)
+
+	if len(ret) == 0 {
+		panic("no return value specified for List")
+	}
+
+	var r0 []settings.Value
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]settings.Value, error)); ok {
+		return rf(ctx, namespace)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []settings.Value); ok {
+		r0 = rf(ctx, namespace)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]settings.Value)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, namespace)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Reset provides a mock function with given fields: ctx, namespace, key
+func (_m *MockSettingsStore) Reset(ctx context.Context, namespace string, key string) (settings.Value, error) {
+	ret := _m.Called(ctx, namespace, key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Reset")
+	}
+
+	var r0 settings.Value
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (settings.Value, error)); ok {
+		return rf(ctx, namespace, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) settings.Value); ok {
+		r0 = rf(ctx, namespace, key)
+	} else {
+		r0 = ret.Get(0).(settings.Value)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, namespace, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Set provides a mock function with given fields: ctx, namespace, key, value
+func (_m *MockSettingsStore) Set(ctx context.Context, namespace string, key string, value string) (settings.Value, error) {
+	ret := _m.Called(ctx, namespace, key, value)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Set")
+	}
+
+	var r0 settings.Value
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) (settings.Value, error)); ok {
+		return rf(ctx, namespace, key, value)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) settings.Value); ok {
+		r0 = rf(ctx, namespace, key, value)
+	} else {
+		r0 = ret.Get(0).(settings.Value)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, namespace, key, value)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewMockSettingsStore creates a new instance of MockSettingsStore. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockSettingsStore(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockSettingsStore {
+	mock := &MockSettingsStore{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,187 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"blueprint/pkg/buildinfo"
+	pb "blueprint/proto/blueprint"
+
+	swaggerFiles "github.com/swaggo/files/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	openAPIPath = "/openapi.json"
+	docsPath    = "/docs"
+)
+
+// OpenAPI builds the OpenAPI 3 document of the gateway from gatewayRoutes
+// and the proto descriptors, field names are the protojson ones the gateway
+// speaks
+func OpenAPI() map[string]interface{} {
+	svc := pb.File_proto_blueprint_blueprint_proto.Services().ByName("Blueprint")
+	schemas := map[string]interface{}{}
+	errorRef := messageSchema(status.New(codes.OK, "").Proto().ProtoReflect().Descriptor(), schemas)
+
+	paths := map[string]interface{}{}
+	for _, route := range gatewayRoutes {
+		rpc := svc.Methods().ByName(route.RPC)
+		paths[route.Path] = map[string]interface{}{
+			strings.ToLower(route.Method): map[string]interface{}{
+				"operationId": string(rpc.FullName()),
+				"requestBody": map[string]interface{}{
+					"content": jsonContent(messageSchema(rpc.Input(), schemas)),
+				},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "OK",
+						"content":     jsonContent(messageSchema(rpc.Output(), schemas)),
+					},
+					"default": map[string]interface{}{
+						"description": "gRPC status, the HTTP code follows HTTPStatusFromCode",
+						"content":     jsonContent(errorRef),
+					},
+				},
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   string(svc.FullName()),
+			"version": buildinfo.Get().Version,
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// messageSchema adds md and the messages it uses to schemas and returns a
+// reference to it
+func messageSchema(md protoreflect.MessageDescriptor, schemas map[string]interface{}) map[string]interface{} {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration":
+		return map[string]interface{}{"type": "string", "example": "1.5s"}
+	case "google.protobuf.Any":
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           map[string]interface{}{"@type": map[string]interface{}{"type": "string"}},
+			"additionalProperties": true,
+		}
+	}
+
+	name := string(md.FullName())
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	if _, ok := schemas[name]; ok {
+		return ref
+	}
+	// placeholder first, recursive messages end at the reference
+	schemas[name] = nil
+
+	props := map[string]interface{}{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		props[fd.JSONName()] = fieldSchema(fd, schemas)
+	}
+	schemas[name] = map[string]interface{}{"type": "object", "properties": props}
+	return ref
+}
+
+func fieldSchema(fd protoreflect.FieldDescriptor, schemas map[string]interface{}) map[string]interface{} {
+	if fd.IsMap() {
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": singularSchema(fd.MapValue(), schemas),
+		}
+	}
+	if fd.IsList() {
+		return map[string]interface{}{"type": "array", "items": singularSchema(fd, schemas)}
+	}
+	return singularSchema(fd, schemas)
+}
+
+// singularSchema follows protojson, 64-bit integers are strings
+func singularSchema(fd protoreflect.FieldDescriptor, schemas map[string]interface{}) map[string]interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]interface{}{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]interface{}{"type": "integer", "format": "int64", "minimum": 0}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return map[string]interface{}{"type": "string", "format": "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]interface{}{"type": "string", "format": "uint64"}
+	case protoreflect.FloatKind:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case protoreflect.BytesKind:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		names := make([]string, values.Len())
+		for i := range names {
+			names[i] = string(values.Get(i).Name())
+		}
+		return map[string]interface{}{"type": "string", "enum": names}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageSchema(fd.Message(), schemas)
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
+
+func (g *Gateway) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(OpenAPI())
+}
+
+// the UI is the swagger-ui-dist copy embedded by swaggo/files, pinned in
+// go.mod, so the page loads nothing from outside the gateway; only
+// non-production gateways serve it
+const swaggerUI = `<!DOCTYPE html>
+<html>
+<head>
+<title>Blueprint API</title>
+<link rel="stylesheet" href="` + docsPath + `/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="` + docsPath + `/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "` + openAPIPath + `", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// isDocsPath is the UI page and its assets
+func isDocsPath(path string) bool {
+	return path == docsPath || strings.HasPrefix(path, docsPath+"/")
+}
+
+var swaggerAssets = http.StripPrefix(docsPath+"/", http.FileServer(http.FS(swaggerFiles.FS)))
+
+func (g *Gateway) docs(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != docsPath {
+		swaggerAssets.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUI))
+}
@@ -0,0 +1,13 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package handler
+
+import "blueprint/pkg/settings"
+
+// SettingDefs are the runtime settings of the service, tuned through the
+// AdminService without a deploy. Unlike Flags they are kept in the
+// database, shared by every replica and survive restarts. Add a service's
+// business parameters here, the app registers them on start.
+var SettingDefs = []settings.Def{
+	{Namespace: "trading", Key: "spread_bps", Type: settings.Int, Default: "15", Description: "Spread added to quoted prices, in basis points"},
+	{Namespace: "trading", Key: "commission_rate", Type: settings.Float, Default: "0.001", Description: "Commission charged on a trade's notional"},
+}
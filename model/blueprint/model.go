@@ -1,9 +1,67 @@
 // By Emran A. Hamdan, Lead Architect
 package model
 
+import "time"
+
 // only strong model mapped to database or API call such as http, tcp/ip , cache is defined
 
 type MyModel struct {
 	Id        string
 	SomeField int
 }
+
+// SagaInstance is the saved progress of one saga run, pkg/saga owns it
+type SagaInstance struct {
+	ID     string `gorm:"primaryKey"`
+	Saga   string `gorm:"not null;index:idx_saga_instances_claim,priority:1"`
+	Status string `gorm:"not null;index:idx_saga_instances_claim,priority:2"`
+	// Step is the running step, or the last completed one while compensating
+	Step  int    `gorm:"not null"`
+	Data  []byte // JSON of the saga data
+	Error string
+	// Owner is the coordinator running the saga until LeaseUntil
+	Owner      string
+	LeaseUntil time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// ProjectionPosition is the last event a projection applied from a topic,
+// pkg/projection owns it
+type ProjectionPosition struct {
+	Projection string `gorm:"primaryKey"`
+	Topic      string `gorm:"primaryKey"`
+	EventID    string `gorm:"not null"`
+	OccurredAt time.Time
+	// Applied counts the events applied from the topic
+	Applied   int64 `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// ProjectionEvent marks an event as applied so redeliveries skip it,
+// pruned after a while by pkg/projection
+type ProjectionEvent struct {
+	Projection string    `gorm:"primaryKey"`
+	EventID    string    `gorm:"primaryKey"`
+	AppliedAt  time.Time `gorm:"not null;index"`
+}
+
+// Setting overrides the default of a runtime setting, pkg/settings owns
+// it. Without a row the default defined in code applies.
+type Setting struct {
+	Namespace string `gorm:"primaryKey"`
+	Key       string `gorm:"primaryKey"`
+	Value     string `gorm:"not null"`
+	UpdatedAt time.Time
+	RequestStamp
+}
+
+// RequestStamp records the call that last wrote a row, embed it in models
+// that need an audit trail of who changed them. pkg/db fills it from the
+// request context on every create and update.
+type RequestStamp struct {
+	RequestID            string
+	RequestUserID        string
+	RequestTenantID      string
+	RequestClientVersion string
+}
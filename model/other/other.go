@@ -4,14 +4,16 @@ package model
 // Example Model
 type Account struct {
 	AccountId int64  `gorm:"primaryKey;autoIncrement:true" json:"account_id"`
-	NameEn    string `json:"name_en"`
+	NameEn    string `gorm:"not null" json:"name_en"`
 	NameAr    string `json:"name_ar"`
 	Contact   string `json:"contact"`
 	Address   string `json:"address"`
 	Tel       string `json:"tel"`
 	Mobile    string `json:"mobile"`
-	Email     string `json:"email"`
+	Email     string `gorm:"not null;uniqueIndex" json:"email"`
 	Web       string `json:"web"`
-	CreateAt  int64  `gorm:"autoUpdateTime:milli," json:"create_at"`
+	CreateAt  int64  `gorm:"autoCreateTime:milli" json:"create_at"`
 	UpdateAt  int64  `gorm:"autoUpdateTime:milli," json:"update_at"`
+	// optimistic locking, only db.UpdateWithVersion changes it
+	Version int `gorm:"not null;default:1" json:"version"`
 }
\ No newline at end of file
@@ -0,0 +1,305 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package account is the CRUD of model.Account and the pattern for
+// multilingual models: the name is kept per language (name_en, name_ar)
+// and read back in the caller's, and validation errors come in the
+// caller's locale with the offending proto fields named.
+//
+//	accounts := account.New(account.NewGormStore(pg.DB), cacheClient, lang, account.Options{})
+//	inv.Register(&model.Account{}, account.Invalidation)
+//	a, err := accounts.Create(ctx, account.Input{NameEn: "Acme", Email: "ops@acme.test"})
+//
+// Reads are cache-aside under Key(id), one entry for every tenant, user and
+// locale. The writes do not touch the cache, db.CacheInvalidator flushes the
+// key after they commit, so a write made anywhere else invalidates the same
+// way.
+package account
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	model "blueprint/model/other"
+	"blueprint/pkg/cache"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/db"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/i18n"
+
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	maxNameLen    = 100
+	defaultLocale = "en-US"
+)
+
+// ReasonEmailTaken is the ErrorInfo reason of a duplicate email
+const ReasonEmailTaken = "EMAIL_TAKEN"
+
+// Message keys in the locale files, with the English used when a locale
+// lacks one
+var fallbackMessages = map[string]string{
+	"account_invalid":          "The account is invalid",
+	"account_not_found":        "Account %d was not found",
+	"account_email_taken":      "An account with this email already exists",
+	"account_name_en_required": "must not be empty",
+	"account_name_ar_script":   "must be written in Arabic script",
+	"account_too_long":         "must be at most %d characters",
+	"account_email_invalid":    "must be a valid email address",
+	"account_web_invalid":      "must be an http or https address",
+	"account_version_required": "must be the version the account was read at",
+}
+
+type Options struct {
+	// TTL of cached accounts, 0 uses the cache's default
+	TTL time.Duration
+	// Locale of messages for callers without one, en-US by default
+	Locale string
+}
+
+// Input is what a caller sets on an account, the id and version are the
+// Service's
+type Input struct {
+	NameEn  string
+	NameAr  string
+	Contact string
+	Address string
+	Tel     string
+	Mobile  string
+	Email   string
+	Web     string
+}
+
+// Service validates and stores accounts, its errors go to gRPC clients as
+// they are
+type Service struct {
+	store Store
+	cache cache.Store
+	tr    i18n.Translator
+	opts  Options
+}
+
+// New reads through c when it is not nil, tr may be nil too
+func New(store Store, c cache.Store, tr i18n.Translator, opts Options) *Service {
+	if opts.Locale == "" {
+		opts.Locale = defaultLocale
+	}
+	return &Service{store: store, cache: c, tr: tr, opts: opts}
+}
+
+// Key is the cache key of an account
+func Key(id int64) string {
+	return fmt.Sprintf("account:%d", id)
+}
+
+// Invalidation is the db.InvalidationRule of model.Account, the one
+// unscoped entry Get reads
+func Invalidation(m interface{}) db.Invalidation {
+	a := m.(*model.Account)
+	if a.AccountId == 0 {
+		return db.Invalidation{}
+	}
+	return db.Invalidation{Shared: []string{Key(a.AccountId)}}
+}
+
+// Name is the account's name in locale: the Arabic one for ar locales
+// when there is one, the English one otherwise
+func Name(a *model.Account, locale string) string {
+	if a.NameAr != "" && (locale == "ar" || strings.HasPrefix(locale, "ar-")) {
+		return a.NameAr
+	}
+	return a.NameEn
+}
+
+func (s *Service) Create(ctx context.Context, in Input) (*model.Account, error) {
+	in = normalize(in)
+	if err := s.validate(ctx, in); err != nil {
+		return nil, err
+	}
+	// the unique index decides, this only spares the insert
+	if _, err := s.store.FindByEmail(ctx, in.Email); err == nil {
+		return nil, s.emailTaken(ctx)
+	} else if !stderrors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	a := &model.Account{}
+	apply(a, in)
+	if err := s.store.Create(ctx, a); err != nil {
+		return nil, s.storeError(ctx, 0, err)
+	}
+	return a, nil
+}
+
+// Get reads the cache first and fills it on a miss. There is one entry
+// per account whoever asks, Name picks the language after the cache.
+func (s *Service) Get(ctx context.Context, id int64) (*model.Account, error) {
+	if s.cache != nil {
+		var a model.Account
+		if err := s.cache.Get(cache.Unscoped(ctx), Key(id), &a); err == nil {
+			return &a, nil
+		}
+	}
+
+	a, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, s.storeError(ctx, id, err)
+	}
+	if s.cache != nil {
+		// a failed write only costs the next read a query
+		s.cache.SetWithTTL(cache.Unscoped(ctx), Key(id), a, s.opts.TTL)
+	}
+	return a, nil
+}
+
+// Update replaces the fields of the account at version, an Aborted
+// db.StaleObjectError when it changed since
+func (s *Service) Update(ctx context.Context, id int64, version int, in Input) (*model.Account, error) {
+	in = normalize(in)
+	if version < 1 {
+		return nil, errors.InvalidArgument(s.message(ctx, "account_invalid"),
+			errors.FieldViolation{Field: "version", Description: s.message(ctx, "account_version_required")})
+	}
+	if err := s.validate(ctx, in); err != nil {
+		return nil, err
+	}
+	if other, err := s.store.FindByEmail(ctx, in.Email); err == nil && other.AccountId != id {
+		return nil, s.emailTaken(ctx)
+	} else if err != nil && !stderrors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	a, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, s.storeError(ctx, id, err)
+	}
+	a.Version = version
+	apply(a, in)
+	err = s.store.Update(ctx, a, map[string]interface{}{
+		"name_en": in.NameEn,
+		"name_ar": in.NameAr,
+		"contact": in.Contact,
+		"address": in.Address,
+		"tel":     in.Tel,
+		"mobile":  in.Mobile,
+		"email":   in.Email,
+		"web":     in.Web,
+	})
+	if err != nil {
+		return nil, s.storeError(ctx, id, err)
+	}
+	return a, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id int64) error {
+	if err := s.store.Delete(ctx, id); err != nil {
+		return s.storeError(ctx, id, err)
+	}
+	return nil
+}
+
+func apply(a *model.Account, in Input) {
+	a.NameEn, a.NameAr = in.NameEn, in.NameAr
+	a.Contact, a.Address = in.Contact, in.Address
+	a.Tel, a.Mobile = in.Tel, in.Mobile
+	a.Email, a.Web = in.Email, in.Web
+}
+
+func normalize(in Input) Input {
+	for _, f := range []*string{&in.NameEn, &in.NameAr, &in.Contact, &in.Address, &in.Tel, &in.Mobile, &in.Email, &in.Web} {
+		*f = strings.TrimSpace(*f)
+	}
+	in.Email = strings.ToLower(in.Email)
+	return in
+}
+
+// validate reports every invalid field at once, by proto field name
+func (s *Service) validate(ctx context.Context, in Input) error {
+	var violations []errors.FieldViolation
+	add := func(field, key string, args ...interface{}) {
+		violations = append(violations, errors.FieldViolation{Field: field, Description: s.message(ctx, key, args...)})
+	}
+
+	switch {
+	case in.NameEn == "":
+		add("name_en", "account_name_en_required")
+	case utf8.RuneCountInString(in.NameEn) > maxNameLen:
+		add("name_en", "account_too_long", maxNameLen)
+	}
+	switch {
+	case in.NameAr == "":
+	case utf8.RuneCountInString(in.NameAr) > maxNameLen:
+		add("name_ar", "account_too_long", maxNameLen)
+	case !arabic(in.NameAr):
+		add("name_ar", "account_name_ar_script")
+	}
+	if addr, err := mail.ParseAddress(in.Email); err != nil || addr.Address != in.Email {
+		add("email", "account_email_invalid")
+	}
+	if in.Web != "" {
+		u, err := url.Parse(in.Web)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("web", "account_web_invalid")
+		}
+	}
+
+	if len(violations) > 0 {
+		return errors.InvalidArgument(s.message(ctx, "account_invalid"), violations...)
+	}
+	return nil
+}
+
+// arabic is true when every letter of s is in the Arabic script, digits,
+// spaces and punctuation aside
+func arabic(s string) bool {
+	letters := 0
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if !unicode.Is(unicode.Arabic, r) {
+			return false
+		}
+		letters++
+	}
+	return letters > 0
+}
+
+func (s *Service) emailTaken(ctx context.Context) error {
+	return errors.New(codes.AlreadyExists, ReasonEmailTaken, s.message(ctx, "account_email_taken")).
+		WithField("email", s.message(ctx, "account_email_taken"))
+}
+
+// storeError makes the store's errors the client's, anything else stays an
+// internal error
+func (s *Service) storeError(ctx context.Context, id int64, err error) error {
+	switch {
+	case stderrors.Is(err, ErrNotFound):
+		return errors.NotFound(s.message(ctx, "account_not_found", id))
+	case stderrors.Is(err, ErrEmailTaken):
+		return s.emailTaken(ctx)
+	}
+	return err
+}
+
+// message is key in the caller's locale, English without a translation
+func (s *Service) message(ctx context.Context, key string, args ...interface{}) string {
+	if s.tr != nil {
+		locale, ok := ctxmeta.Locale(ctx)
+		if !ok {
+			locale = s.opts.Locale
+		}
+		if msg := s.tr.Tr(locale, key, args...); msg != "" && msg != key {
+			return msg
+		}
+	}
+	return fmt.Sprintf(fallbackMessages[key], args...)
+}
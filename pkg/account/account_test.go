@@ -0,0 +1,131 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	model "blueprint/model/other"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/db"
+	"blueprint/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// arabicTr translates two keys for ar-SA, the rest fall back to English
+type arabicTr struct{}
+
+func (arabicTr) Tr(lang, key string, args ...interface{}) string {
+	if lang != "ar-SA" {
+		return ""
+	}
+	switch key {
+	case "account_invalid":
+		return "الحساب غير صالح"
+	case "account_too_long":
+		return fmt.Sprintf("يجب ألا يتجاوز %d حرفاً", args...)
+	}
+	return key
+}
+
+func TestValidate(t *testing.T) {
+	s := New(NewMemoryStore(), nil, nil, Options{})
+	ctx := context.Background()
+
+	for name, in := range map[string]Input{
+		"plain":        {NameEn: "Acme", Email: "ops@acme.test"},
+		"arabic name":  {NameEn: "Acme", NameAr: "شركة أكمي ١", Email: "ops@acme.test"},
+		"website":      {NameEn: "Acme", Email: "ops@acme.test", Web: "https://acme.test/about"},
+		"max name len": {NameEn: string(make([]rune, maxNameLen)), Email: "ops@acme.test"},
+	} {
+		assert.NoError(t, s.validate(ctx, normalize(in)), name)
+	}
+
+	for field, in := range map[string]Input{
+		"name_en": {NameEn: " ", Email: "ops@acme.test"},
+		"name_ar": {NameEn: "Acme", NameAr: "Acme", Email: "ops@acme.test"},
+		"email":   {NameEn: "Acme", Email: "Acme <ops@acme.test>"},
+		"web":     {NameEn: "Acme", Email: "ops@acme.test", Web: "ftp://acme.test"},
+	} {
+		e, ok := errors.FromError(s.validate(ctx, normalize(in)))
+		require.True(t, ok, field)
+		assert.Equal(t, codes.InvalidArgument, e.Code)
+		require.Len(t, e.Violations, 1, field)
+		assert.Equal(t, field, e.Violations[0].Field)
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	s := New(NewMemoryStore(), nil, arabicTr{}, Options{})
+	long := Input{NameEn: string(make([]rune, maxNameLen+1)), Email: "bad"}
+
+	e, _ := errors.FromError(s.validate(ctxmeta.WithLocale(context.Background(), "ar-SA"), long))
+	assert.Equal(t, "الحساب غير صالح", e.Message)
+	assert.Equal(t, []errors.FieldViolation{
+		{Field: "name_en", Description: "يجب ألا يتجاوز 100 حرفاً"},
+		{Field: "email", Description: "must be a valid email address"},
+	}, e.Violations, "untranslated keys fall back to English")
+
+	e, _ = errors.FromError(s.validate(context.Background(), long))
+	assert.Equal(t, "The account is invalid", e.Message, "en-US without a locale")
+	assert.Equal(t, "must be at most 100 characters", e.Violations[0].Description)
+}
+
+func TestService(t *testing.T) {
+	s := New(NewMemoryStore(), nil, nil, Options{})
+	ctx := context.Background()
+
+	a, err := s.Create(ctx, Input{NameEn: " Acme ", Email: "Ops@Acme.test"})
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", a.NameEn)
+	assert.Equal(t, "ops@acme.test", a.Email)
+
+	_, err = s.Create(ctx, Input{NameEn: "Copy", Email: "OPS@acme.test"})
+	e, ok := errors.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.AlreadyExists, e.Code)
+	assert.Equal(t, ReasonEmailTaken, e.Reason)
+
+	b, err := s.Create(ctx, Input{NameEn: "Beta", Email: "ops@beta.test"})
+	require.NoError(t, err)
+	_, err = s.Update(ctx, b.AccountId, b.Version, Input{NameEn: "Beta", Email: "ops@acme.test"})
+	e, _ = errors.FromError(err)
+	assert.Equal(t, ReasonEmailTaken, e.Reason, "taken by another account")
+
+	a, err = s.Update(ctx, a.AccountId, a.Version, Input{NameEn: "Acme", NameAr: "أكمي", Email: "ops@acme.test"})
+	require.NoError(t, err, "keeps its own email")
+	assert.Equal(t, 2, a.Version)
+
+	_, err = s.Update(ctx, a.AccountId, 1, Input{NameEn: "Lost", Email: "ops@acme.test"})
+	assert.ErrorIs(t, err, db.ErrStaleObject)
+	_, err = s.Update(ctx, a.AccountId, 0, Input{NameEn: "Acme", Email: "ops@acme.test"})
+	e, _ = errors.FromError(err)
+	assert.Equal(t, "version", e.Violations[0].Field)
+
+	got, err := s.Get(ctx, a.AccountId)
+	require.NoError(t, err)
+	assert.Equal(t, "أكمي", got.NameAr)
+
+	require.NoError(t, s.Delete(ctx, a.AccountId))
+	_, err = s.Get(ctx, a.AccountId)
+	e, _ = errors.FromError(err)
+	assert.Equal(t, codes.NotFound, e.Code)
+	assert.Equal(t, fmt.Sprintf("Account %d was not found", a.AccountId), e.Message)
+}
+
+func TestName(t *testing.T) {
+	a := &model.Account{NameEn: "Acme", NameAr: "أكمي"}
+	assert.Equal(t, "أكمي", Name(a, "ar-SA"))
+	assert.Equal(t, "أكمي", Name(a, "ar"))
+	assert.Equal(t, "Acme", Name(a, "en-US"))
+	assert.Equal(t, "Acme", Name(a, "arn"))
+	assert.Equal(t, "Acme", Name(&model.Account{NameEn: "Acme"}, "ar-SA"), "no Arabic name")
+}
+
+func TestInvalidation(t *testing.T) {
+	assert.Equal(t, db.Invalidation{Shared: []string{"account:7"}}, Invalidation(&model.Account{AccountId: 7}))
+	assert.Empty(t, Invalidation(&model.Account{}), "batch writes without an id")
+}
@@ -0,0 +1,12 @@
+package account
+
+import (
+	"testing"
+
+	"blueprint/pkg/testsupport"
+)
+
+// one postgres container for the whole package
+func TestMain(m *testing.M) {
+	testsupport.Main(m)
+}
@@ -0,0 +1,116 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package account
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	model "blueprint/model/other"
+	"blueprint/pkg/db"
+)
+
+// MemoryStore is an in-process Store for tests, with the unique emails and
+// versions of GormStore. It has no cache invalidation, use it without a
+// cache.
+type MemoryStore struct {
+	mu       sync.Mutex
+	seq      int64
+	accounts map[int64]model.Account
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{accounts: make(map[int64]model.Account)}
+}
+
+func (m *MemoryStore) Create(ctx context.Context, a *model.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.taken(a.Email, 0) {
+		return ErrEmailTaken
+	}
+	m.seq++
+	now := time.Now().UnixMilli()
+	a.AccountId, a.CreateAt, a.UpdateAt, a.Version = m.seq, now, now, 1
+	m.accounts[a.AccountId] = *a
+	return nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, id int64) (*model.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &a, nil
+}
+
+func (m *MemoryStore) FindByEmail(ctx context.Context, email string) (*model.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range m.accounts {
+		if a.Email == email {
+			return &a, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Update takes the values Service.Update writes, by column name
+func (m *MemoryStore) Update(ctx context.Context, a *model.Account, values map[string]interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.accounts[a.AccountId]
+	if !ok || cur.Version != a.Version {
+		return &db.StaleObjectError{Table: "platform_account", Version: a.Version}
+	}
+	if email, ok := values["email"].(string); ok && m.taken(email, a.AccountId) {
+		return ErrEmailTaken
+	}
+	for col, v := range values {
+		s, _ := v.(string)
+		switch col {
+		case "name_en":
+			cur.NameEn = s
+		case "name_ar":
+			cur.NameAr = s
+		case "contact":
+			cur.Contact = s
+		case "address":
+			cur.Address = s
+		case "tel":
+			cur.Tel = s
+		case "mobile":
+			cur.Mobile = s
+		case "email":
+			cur.Email = s
+		case "web":
+			cur.Web = s
+		}
+	}
+	cur.Version++
+	cur.UpdateAt = time.Now().UnixMilli()
+	m.accounts[cur.AccountId] = cur
+	*a = cur
+	return nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.accounts[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.accounts, id)
+	return nil
+}
+
+func (m *MemoryStore) taken(email string, except int64) bool {
+	for id, a := range m.accounts {
+		if a.Email == email && id != except {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	model "blueprint/model/other"
+	"blueprint/pkg/db"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is returned for account ids and emails nobody has
+	ErrNotFound = errors.New("account not found")
+	// ErrEmailTaken is returned when another account has the email
+	ErrEmailTaken = errors.New("email already in use")
+)
+
+// Store persists accounts. Emails come normalized, lower case, and are
+// unique.
+type Store interface {
+	// Create inserts a and sets its id, ErrEmailTaken when the email is
+	// used
+	Create(ctx context.Context, a *model.Account) error
+	Get(ctx context.Context, id int64) (*model.Account, error)
+	FindByEmail(ctx context.Context, email string) (*model.Account, error)
+	// Update writes values to a if it is still at a.Version, see
+	// db.UpdateWithVersion; a holds the new version after
+	Update(ctx context.Context, a *model.Account, values map[string]interface{}) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// GormStore keeps accounts in platform_account, db.Migrate creates it
+// with the unique index on email
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Create(ctx context.Context, a *model.Account) error {
+	if err := s.db.WithContext(ctx).Create(a).Error; err != nil {
+		return writeError(a.Email, err)
+	}
+	return nil
+}
+
+func (s *GormStore) Get(ctx context.Context, id int64) (*model.Account, error) {
+	var a model.Account
+	if err := s.db.WithContext(ctx).Take(&a, id).Error; err != nil {
+		return nil, readError(fmt.Sprintf("account %d", id), err)
+	}
+	return &a, nil
+}
+
+func (s *GormStore) FindByEmail(ctx context.Context, email string) (*model.Account, error) {
+	var a model.Account
+	if err := s.db.WithContext(ctx).Where("email = ?", email).Take(&a).Error; err != nil {
+		return nil, readError("account "+email, err)
+	}
+	return &a, nil
+}
+
+func (s *GormStore) Update(ctx context.Context, a *model.Account, values map[string]interface{}) error {
+	if err := db.UpdateWithVersion(ctx, s.db, a, values); err != nil {
+		var stale *db.StaleObjectError
+		if errors.As(err, &stale) {
+			return err
+		}
+		return writeError(fmt.Sprint(values["email"]), err)
+	}
+	return nil
+}
+
+func (s *GormStore) Delete(ctx context.Context, id int64) error {
+	// the id in the model lets the cache invalidation rule see it
+	res := s.db.WithContext(ctx).Delete(&model.Account{AccountId: id})
+	if res.Error != nil {
+		return fmt.Errorf("account %d: delete: %w", id, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func readError(what string, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return fmt.Errorf("%s: %w", what, err)
+}
+
+// writeError is ErrEmailTaken for a unique violation, the only unique key
+// besides the generated id is the email
+func writeError(email string, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrEmailTaken
+	}
+	return fmt.Errorf("account %s: %w", email, err)
+}
@@ -0,0 +1,98 @@
+package account
+
+import (
+	"context"
+	"testing"
+
+	"blueprint/config"
+	model "blueprint/model/other"
+	"blueprint/pkg/cache"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/db"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newGormStore(t *testing.T, store *cache.Memory) (*GormStore, *gorm.DB) {
+	cfg := &config.Config{Postgres: testsupport.Postgres(t)}
+	pg, err := db.NewPostgresDB(cfg, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { pg.Close() })
+	require.NoError(t, db.Migrate(cfg))
+	require.NoError(t, pg.DB.Exec("DELETE FROM platform_account").Error)
+
+	if store != nil {
+		inv := db.NewCacheInvalidator(store, nil, db.InvalidatorOptions{RepeatAfter: -1})
+		inv.Register(&model.Account{}, Invalidation)
+		require.NoError(t, pg.DB.Use(inv))
+	}
+	return NewGormStore(pg.DB), pg.DB
+}
+
+func TestGormStore(t *testing.T) {
+	s, _ := newGormStore(t, nil)
+	ctx := context.Background()
+
+	a := &model.Account{NameEn: "Acme", Email: "ops@acme.test"}
+	require.NoError(t, s.Create(ctx, a))
+	assert.NotZero(t, a.AccountId)
+	assert.NotZero(t, a.CreateAt)
+	assert.Equal(t, 1, a.Version)
+
+	assert.ErrorIs(t, s.Create(ctx, &model.Account{NameEn: "Copy", Email: "ops@acme.test"}), ErrEmailTaken)
+
+	got, err := s.FindByEmail(ctx, "ops@acme.test")
+	require.NoError(t, err)
+	assert.Equal(t, a.AccountId, got.AccountId)
+	_, err = s.FindByEmail(ctx, "nobody@acme.test")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	b := &model.Account{NameEn: "Beta", Email: "ops@beta.test"}
+	require.NoError(t, s.Create(ctx, b))
+	assert.ErrorIs(t, s.Update(ctx, b, map[string]interface{}{"email": "ops@acme.test"}), ErrEmailTaken)
+
+	require.NoError(t, s.Update(ctx, a, map[string]interface{}{"name_en": "Acme Ltd"}))
+	assert.Equal(t, 2, a.Version)
+	stale := &model.Account{AccountId: a.AccountId, Version: 1}
+	assert.ErrorIs(t, s.Update(ctx, stale, map[string]interface{}{"name_en": "Lost"}), db.ErrStaleObject)
+
+	got, err = s.Get(ctx, a.AccountId)
+	require.NoError(t, err)
+	assert.Equal(t, "Acme Ltd", got.NameEn)
+
+	require.NoError(t, s.Delete(ctx, a.AccountId))
+	_, err = s.Get(ctx, a.AccountId)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, s.Delete(ctx, a.AccountId), ErrNotFound)
+}
+
+func TestServiceCache(t *testing.T) {
+	store := cache.NewMemory()
+	gs, gdb := newGormStore(t, store)
+	s := New(gs, store, nil, Options{})
+	ctx := context.Background()
+
+	a, err := s.Create(ctx, Input{NameEn: "Acme", Email: "ops@acme.test"})
+	require.NoError(t, err)
+	_, err = s.Get(ctxmeta.WithLocale(ctx, "ar-SA"), a.AccountId)
+	require.NoError(t, err)
+
+	// written behind the service's back with gorm, the plugin still flushes
+	require.NoError(t, gdb.Model(&model.Account{AccountId: a.AccountId}).Update("contact", "Sam").Error)
+	got, err := s.Get(ctxmeta.WithTenantID(ctx, "acme"), a.AccountId)
+	require.NoError(t, err)
+	assert.Equal(t, "Sam", got.Contact)
+
+	// skipping the hooks leaves the cached entry, one for every caller
+	require.NoError(t, gdb.Exec("UPDATE platform_account SET contact = 'Kim'").Error)
+	got, err = s.Get(ctx, a.AccountId)
+	require.NoError(t, err)
+	assert.Equal(t, "Sam", got.Contact)
+
+	require.NoError(t, s.Delete(ctx, a.AccountId))
+	_, err = s.Get(ctx, a.AccountId)
+	assert.Error(t, err, "deleted and flushed")
+}
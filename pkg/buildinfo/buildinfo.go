@@ -0,0 +1,99 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package buildinfo is what the running binary was built from. Release
+// builds stamp it through the linker:
+//
+//	go build -ldflags "-X blueprint/pkg/buildinfo.Version=v2.1.0 \
+//		-X blueprint/pkg/buildinfo.Commit=$(git rev-parse HEAD) \
+//		-X blueprint/pkg/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them the commit and time come from the VCS stamp the go tool
+// embeds, and the version is "dev".
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// set with -ldflags "-X blueprint/pkg/buildinfo.Version=..."
+var (
+	Version   string
+	Commit    string
+	BuildTime string
+)
+
+const devVersion = "dev"
+
+type Info struct {
+	Version   string
+	Commit    string
+	BuildTime string
+	GoVersion string
+	// Modified is true when the VCS stamp says the tree had local changes
+	Modified bool
+}
+
+var current = read(Version, Commit, BuildTime, debug.ReadBuildInfo)
+
+func init() {
+	info := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "blueprint_build_info",
+		Help: "Always 1, labelled with the version, commit, build time and Go version of the binary.",
+		ConstLabels: prometheus.Labels{
+			"version":    current.Version,
+			"commit":     current.Commit,
+			"build_time": current.BuildTime,
+			"go_version": current.GoVersion,
+		},
+	})
+	info.Set(1)
+	prometheus.MustRegister(info)
+}
+
+func Get() Info {
+	return current
+}
+
+// Fields returns the info as logger fields
+func (i Info) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"version":    i.Version,
+		"commit":     i.Commit,
+		"build_time": i.BuildTime,
+		"go_version": i.GoVersion,
+		"modified":   i.Modified,
+	}
+}
+
+// read prefers the linker values and falls back to the embedded build info
+func read(version, commit, buildTime string, embedded func() (*debug.BuildInfo, bool)) Info {
+	i := Info{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+
+	if bi, ok := embedded(); ok {
+		if i.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			i.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if i.Commit == "" {
+					i.Commit = s.Value
+				}
+			case "vcs.time":
+				if i.BuildTime == "" {
+					i.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				i.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	if i.Version == "" {
+		i.Version = devVersion
+	}
+	return i
+}
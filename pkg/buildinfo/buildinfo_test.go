@@ -0,0 +1,46 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func embedded(version string, settings ...debug.BuildSetting) func() (*debug.BuildInfo, bool) {
+	return func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{Main: debug.Module{Version: version}, Settings: settings}, true
+	}
+}
+
+func TestReadPrefersLinkerValues(t *testing.T) {
+	i := read("v2.1.0", "abc123", "2024-03-01T10:00:00Z", embedded("v0.0.1",
+		debug.BuildSetting{Key: "vcs.revision", Value: "def456"},
+		debug.BuildSetting{Key: "vcs.time", Value: "2024-02-01T00:00:00Z"},
+	))
+	assert.Equal(t, Info{
+		Version:   "v2.1.0",
+		Commit:    "abc123",
+		BuildTime: "2024-03-01T10:00:00Z",
+		GoVersion: runtime.Version(),
+	}, i)
+}
+
+func TestReadFallsBackToVCSStamp(t *testing.T) {
+	i := read("", "", "", embedded("(devel)",
+		debug.BuildSetting{Key: "vcs.revision", Value: "def456"},
+		debug.BuildSetting{Key: "vcs.time", Value: "2024-02-01T00:00:00Z"},
+		debug.BuildSetting{Key: "vcs.modified", Value: "true"},
+	))
+	assert.Equal(t, "dev", i.Version, "(devel) is not a version")
+	assert.Equal(t, "def456", i.Commit)
+	assert.Equal(t, "2024-02-01T00:00:00Z", i.BuildTime)
+	assert.True(t, i.Modified)
+}
+
+func TestReadWithoutBuildInfo(t *testing.T) {
+	i := read("", "", "", func() (*debug.BuildInfo, bool) { return nil, false })
+	assert.Equal(t, "dev", i.Version)
+	assert.Empty(t, i.Commit)
+}
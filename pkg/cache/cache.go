@@ -5,11 +5,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
+	"blueprint/pkg/compress"
+	"blueprint/pkg/consistency"
+	apperrors "blueprint/pkg/errors"
+
 	"github.com/redis/go-redis/v9"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -23,6 +29,47 @@ type Options struct {
 	Prefix     string
 	Expiration time.Duration
 	MaxRetries int
+	// Scope adds these request values from ctxmeta to every key, so one
+	// tenant, user or locale never reads another's entry
+	Scope []Scope
+	// StaleWindow lets Fetch serve an expiring entry while it refreshes it,
+	// 0 turns that off
+	StaleWindow time.Duration
+	// Available is asked before each get, set, delete and fetch, false
+	// leaves redis alone: reads miss, writes are dropped and Fetch calls
+	// the loader. Delete and FlushPrefix fail with ErrUnavailable, entries
+	// they would remove outlive the outage. Flush, Ping and TTL always go
+	// to redis. nil means always available.
+	Available func() bool
+	// Compression, a codec from compress.New, compresses JSON values of at
+	// least CompressMinBytes before they go to redis, nil stores them as
+	// they are. Compressed values are read back whatever the cache is set
+	// to now.
+	Compression      compress.Codec
+	CompressMinBytes int
+}
+
+// Scope is a ctxmeta value keys can be scoped by
+type Scope string
+
+const (
+	ScopeTenant Scope = "tenant"
+	ScopeUser   Scope = "user"
+	ScopeLocale Scope = "locale"
+)
+
+// ParseScopes reads scope names such as CACHE_KEY_SCOPE
+func ParseScopes(names []string) ([]Scope, error) {
+	scopes := make([]Scope, 0, len(names))
+	for _, name := range names {
+		switch s := Scope(name); s {
+		case ScopeTenant, ScopeUser, ScopeLocale:
+			scopes = append(scopes, s)
+		default:
+			return nil, fmt.Errorf("unknown cache key scope %q", name)
+		}
+	}
+	return scopes, nil
 }
 
 type Cache struct {
@@ -30,8 +77,18 @@ type Cache struct {
 	prefix     string
 	expiration time.Duration
 	maxRetries int
+	scope      []Scope
 	mu         sync.RWMutex
 	stats      CacheStats
+
+	staleWindow time.Duration
+	refreshing  sync.Map // full key -> struct{}, refreshes in flight
+
+	available func() bool
+
+	codec       compress.Codec
+	codecID     byte
+	compressMin int
 }
 
 type CacheStats struct {
@@ -39,6 +96,8 @@ type CacheStats struct {
 	Misses uint64
 	Sets   uint64
 	Deletes uint64
+	// Stale counts Fetch hits served while a refresh runs
+	Stale uint64
 }
 
 func NewCache(redis *redis.Client) *Cache {
@@ -60,115 +119,183 @@ func NewCacheWithOptions(redis *redis.Client, opts Options) *Cache {
 		opts.MaxRetries = maxRetries
 	}
 
-	return &Cache{
+	c := &Cache{
 		redis:      redis,
 		prefix:     opts.Prefix,
 		expiration: opts.Expiration,
 		maxRetries: opts.MaxRetries,
+		scope:      opts.Scope,
+
+		staleWindow: opts.StaleWindow,
+		available:   opts.Available,
 	}
+	if opts.Compression != nil {
+		c.codec, c.codecID = opts.Compression, algorithmIDs[opts.Compression.Name()]
+		c.compressMin = opts.CompressMinBytes
+	}
+	return c
 }
 
-func (c *Cache) Set(ctx context.Context, key string, value interface{}) error {
-	data, err := json.Marshal(value)
+// Set stores value under key for the default expiration, see CallOption
+// for per call changes
+func (c *Cache) Set(ctx context.Context, key string, value interface{}, opts ...CallOption) (err error) {
+	o := newCallOptions(opts)
+	ctx, span := startSpan(ctx, "set", key)
+	var data []byte
+	defer func() { endSpan(span, err, len(data)) }()
+
+	fullKey := c.createKey(ctx, key)
+	data, err = o.encode(value)
+	if err == nil && !o.skipSerialize {
+		data, err = c.compressValue(data)
+	}
 	if err != nil {
-		return errors.Wrap(err, "failed to marshal value")
+		return serializationError("set", fullKey, err)
 	}
 
-	fullKey := c.createKey(key)
-	
-	var lastErr error
-	for i := 0; i < c.maxRetries; i++ {
-		if err := c.redis.SetEx(ctx, fullKey, data, c.expiration).Err(); err == nil {
-			c.incrementStats("sets")
-			return nil
-		} else {
-			lastErr = err
-			if i < c.maxRetries-1 {
-				time.Sleep(retryDelay * time.Duration(i+1))
-			}
-		}
+	ttl := c.expiration
+	if o.ttl > 0 {
+		ttl = o.ttl
 	}
-	
-	return errors.Wrapf(lastErr, "failed to set cache key %s after %d retries", fullKey, c.maxRetries)
-}
-
-func (c *Cache) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
-	data, err := json.Marshal(value)
-	if err != nil {
-		return errors.Wrap(err, "failed to marshal value")
+	if c.skip("set") {
+		return nil
 	}
 
-	fullKey := c.createKey(key)
-	if err := c.redis.SetEx(ctx, fullKey, data, ttl).Err(); err != nil {
+	retry := apperrors.RetryOptions{Attempts: c.maxRetries, BaseDelay: retryDelay}
+	err = apperrors.Retry(ctx, retry, func(ctx context.Context) error {
+		return c.redis.SetEx(ctx, fullKey, data, ttl).Err()
+	})
+	if err != nil {
 		return errors.Wrapf(err, "failed to set cache key %s", fullKey)
 	}
-	
-	c.incrementStats("sets")
+
+	c.incrementCallStats(o, "sets")
 	return nil
 }
 
-func (c *Cache) Get(ctx context.Context, key string, dest interface{}) error {
-	fullKey := c.createKey(key)
-	
-	data, err := c.redis.Get(ctx, fullKey).Bytes()
+func (c *Cache) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return c.Set(ctx, key, value, WithTTL(ttl))
+}
+
+func (c *Cache) Get(ctx context.Context, key string, dest interface{}, opts ...CallOption) (err error) {
+	o := newCallOptions(opts)
+	ctx, span := startSpan(ctx, "get", key)
+	var data []byte
+	defer func() { endReadSpan(span, err, len(data)) }()
+
+	data, err = c.read(ctx, o, key)
 	if err != nil {
-		if err == redis.Nil {
-			c.incrementStats("misses")
-			return errors.Wrapf(err, "key %s not found", fullKey)
+		return err
+	}
+	value := data
+	if !o.skipSerialize {
+		if value, err = decompressValue(data); err != nil {
+			return serializationError("get", c.createKey(ctx, key), err)
 		}
-		return errors.Wrapf(err, "failed to get cache key %s", fullKey)
 	}
-
-	if err := json.Unmarshal(data, dest); err != nil {
-		return errors.Wrap(err, "failed to unmarshal cached value")
+	if err := o.decode(value, dest); err != nil {
+		return serializationError("get", c.createKey(ctx, key), err)
 	}
-
-	c.incrementStats("hits")
 	return nil
 }
 
-func (c *Cache) GetRaw(ctx context.Context, key string) ([]byte, error) {
-	fullKey := c.createKey(key)
-	
+// GetRaw returns the JSON stored under key, decompressed if it was
+func (c *Cache) GetRaw(ctx context.Context, key string) (data []byte, err error) {
+	ctx, span := startSpan(ctx, "get_raw", key)
+	defer func() { endReadSpan(span, err, len(data)) }()
+
+	data, err = c.read(ctx, callOptions{}, key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decompressValue(data)
+	if err != nil {
+		return nil, serializationError("get_raw", c.createKey(ctx, key), err)
+	}
+	return value, nil
+}
+
+// read fetches the stored bytes and counts the hit or miss
+func (c *Cache) read(ctx context.Context, o callOptions, key string) ([]byte, error) {
+	fullKey := c.createKey(ctx, key)
+	if consistency.Stale(ctx, key) {
+		consistency.Bypassed("cache")
+		c.incrementCallStats(o, "misses")
+		return nil, notFound("get", fullKey)
+	}
+	if c.skip("get") {
+		c.incrementCallStats(o, "misses")
+		return nil, notFound("get", fullKey)
+	}
+
 	data, err := c.redis.Get(ctx, fullKey).Bytes()
 	if err != nil {
 		if err == redis.Nil {
-			c.incrementStats("misses")
-			return nil, errors.Wrapf(err, "key %s not found", fullKey)
+			c.incrementCallStats(o, "misses")
+			return nil, notFound("get", fullKey)
 		}
 		return nil, errors.Wrapf(err, "failed to get cache key %s", fullKey)
 	}
 
-	c.incrementStats("hits")
+	c.incrementCallStats(o, "hits")
 	return data, nil
 }
 
-func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+// Delete removes keys and returns how many existed, missing keys are not an
+// error so cleanup can be repeated
+func (c *Cache) Delete(ctx context.Context, keys ...string) (deleted int64, err error) {
 	if len(keys) == 0 {
-		return nil
+		return 0, nil
 	}
+	ctx, span := startSpan(ctx, "delete", keys[0])
+	defer func() { endSpan(span, err, 0) }()
 
 	fullKeys := make([]string, len(keys))
 	for i, key := range keys {
-		fullKeys[i] = c.createKey(key)
+		fullKeys[i] = c.createKey(ctx, key)
+	}
+	// a dropped delete would leave stale entries once redis is back, the
+	// caller has to know
+	if c.skip("delete") {
+		return 0, unavailable("delete", fullKeys[0])
 	}
 
-	deleted, err := c.redis.Del(ctx, fullKeys...).Result()
+	deleted, err = c.redis.Del(ctx, fullKeys...).Result()
 	if err != nil {
-		return errors.Wrapf(err, "failed to delete cache keys")
+		return 0, errors.Wrapf(err, "failed to delete cache keys")
 	}
 
 	c.incrementStats("deletes")
+	return deleted, nil
+}
+
+// DeleteStrict is Delete that fails unless every key existed
+func (c *Cache) DeleteStrict(ctx context.Context, keys ...string) error {
+	deleted, err := c.Delete(ctx, keys...)
+	if err != nil {
+		return err
+	}
 	if deleted != int64(len(keys)) {
 		return errors.Errorf("expected to delete %d keys, but deleted %d", len(keys), deleted)
 	}
-
 	return nil
 }
 
-func (c *Cache) Exists(ctx context.Context, key string) (bool, error) {
-	fullKey := c.createKey(key)
-	
+// DeleteIfExists removes key and reports whether it was there
+func (c *Cache) DeleteIfExists(ctx context.Context, key string) (bool, error) {
+	deleted, err := c.Delete(ctx, key)
+	return deleted > 0, err
+}
+
+func (c *Cache) Exists(ctx context.Context, key string) (ok bool, err error) {
+	ctx, span := startSpan(ctx, "exists", key)
+	defer func() { endSpan(span, err, 0) }()
+
+	fullKey := c.createKey(ctx, key)
+	if c.skip("exists") {
+		return false, nil
+	}
+
 	exists, err := c.redis.Exists(ctx, fullKey).Result()
 	if err != nil {
 		return false, errors.Wrapf(err, "failed to check existence of key %s", fullKey)
@@ -178,7 +305,7 @@ func (c *Cache) Exists(ctx context.Context, key string) (bool, error) {
 }
 
 func (c *Cache) Expire(ctx context.Context, key string, expiration time.Duration) error {
-	fullKey := c.createKey(key)
+	fullKey := c.createKey(ctx, key)
 	
 	if err := c.redis.Expire(ctx, fullKey, expiration).Err(); err != nil {
 		return errors.Wrapf(err, "failed to set expiration for key %s", fullKey)
@@ -210,20 +337,80 @@ func (c *Cache) Flush(ctx context.Context) error {
 	return nil
 }
 
+// FlushPrefix deletes every key starting with prefix, in all scopes, and
+// returns how many were removed
+func (c *Cache) FlushPrefix(ctx context.Context, prefix string) (deleted int64, err error) {
+	ctx, span := startSpan(ctx, "flush_prefix", prefix)
+	defer func() { endSpan(span, err, 0) }()
+	if c.skip("flush_prefix") {
+		return 0, unavailable("flush_prefix", prefix)
+	}
+
+	pattern := c.prefix + ":"
+	for _, s := range c.scope {
+		pattern += string(s) + "=*:"
+	}
+	pattern += globEscaper.Replace(prefix) + "*"
+
+	iter := c.redis.Scan(ctx, 0, pattern, flushBatch).Iterator()
+	keys := make([]string, 0, flushBatch)
+	flush := func() error {
+		n, err := c.redis.Unlink(ctx, keys...).Result()
+		deleted += n
+		keys = keys[:0]
+		return err
+	}
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == flushBatch {
+			if err := flush(); err != nil {
+				return deleted, errors.Wrap(err, "failed to delete keys")
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, errors.Wrap(err, "failed to scan keys")
+	}
+	if len(keys) > 0 {
+		if err := flush(); err != nil {
+			return deleted, errors.Wrap(err, "failed to delete keys")
+		}
+	}
+
+	c.incrementStats("deletes")
+	return deleted, nil
+}
+
+// flushBatch is the SCAN count and the most keys unlinked at once
+const flushBatch = 500
+
+// globEscaper quotes what SCAN MATCH would read as a pattern
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
 // Pipeline operations for batch processing
-func (c *Cache) SetBatch(ctx context.Context, items map[string]interface{}, ttl time.Duration) error {
+func (c *Cache) SetBatch(ctx context.Context, items map[string]interface{}, ttl time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "set_batch", "")
+	span.SetAttributes(attribute.Int("cache.keys", len(items)))
+	defer func() { endSpan(span, err, 0) }()
+	if c.skip("set_batch") {
+		return nil
+	}
+
 	pipe := c.redis.Pipeline()
 	
 	for key, value := range items {
+		fullKey := c.createKey(ctx, key)
 		data, err := json.Marshal(value)
+		if err == nil {
+			data, err = c.compressValue(data)
+		}
 		if err != nil {
-			return errors.Wrapf(err, "failed to marshal value for key %s", key)
+			return serializationError("set_batch", fullKey, err)
 		}
-		fullKey := c.createKey(key)
 		pipe.SetEx(ctx, fullKey, data, ttl)
 	}
 	
-	_, err := pipe.Exec(ctx)
+	_, err = pipe.Exec(ctx)
 	if err != nil {
 		return errors.Wrap(err, "failed to execute pipeline")
 	}
@@ -232,13 +419,33 @@ func (c *Cache) SetBatch(ctx context.Context, items map[string]interface{}, ttl
 	return nil
 }
 
-func (c *Cache) GetBatch(ctx context.Context, keys []string, dest map[string]interface{}) error {
+func (c *Cache) GetBatch(ctx context.Context, keys []string, dest map[string]interface{}) (err error) {
+	ctx, span := startSpan(ctx, "get_batch", "")
+	span.SetAttributes(attribute.Int("cache.keys", len(keys)))
+	defer func() { endSpan(span, err, 0) }()
+	if c.skip("get_batch") {
+		c.incrementStatsBy("misses", uint64(len(keys)))
+		return nil
+	}
+
 	pipe := c.redis.Pipeline()
 	
-	fullKeys := make([]string, len(keys))
-	for i, key := range keys {
-		fullKeys[i] = c.createKey(key)
-		pipe.Get(ctx, fullKeys[i])
+	// keys this request wrote are left out like misses
+	fresh := make([]string, 0, len(keys))
+	misses := uint64(0)
+	for _, key := range keys {
+		if consistency.Stale(ctx, key) {
+			consistency.Bypassed("cache")
+			misses++
+			continue
+		}
+		fresh = append(fresh, key)
+		pipe.Get(ctx, c.createKey(ctx, key))
+	}
+	keys = fresh
+	if len(keys) == 0 {
+		c.incrementStatsBy("misses", misses)
+		return nil
 	}
 	
 	cmds, err := pipe.Exec(ctx)
@@ -247,11 +454,13 @@ func (c *Cache) GetBatch(ctx context.Context, keys []string, dest map[string]int
 	}
 	
 	hits := uint64(0)
-	misses := uint64(0)
 	
 	for i, cmd := range cmds {
 		if stringCmd, ok := cmd.(*redis.StringCmd); ok {
 			data, err := stringCmd.Bytes()
+			if err == nil {
+				data, err = decompressValue(data)
+			}
 			if err == nil {
 				var value interface{}
 				if err := json.Unmarshal(data, &value); err == nil {
@@ -282,8 +491,11 @@ func (c *Cache) ResetStats() {
 	c.stats = CacheStats{}
 }
 
-func (c *Cache) createKey(key string) string {
-	return fmt.Sprintf("%s:%s", c.prefix, key)
+// incrementCallStats counts unless the call asked for WithNoStats
+func (c *Cache) incrementCallStats(o callOptions, statType string) {
+	if !o.noStats {
+		c.incrementStats(statType)
+	}
 }
 
 func (c *Cache) incrementStats(statType string) {
@@ -291,6 +503,11 @@ func (c *Cache) incrementStats(statType string) {
 }
 
 func (c *Cache) incrementStatsBy(statType string, count uint64) {
+	if count == 0 {
+		return
+	}
+	observe(c.prefix, statType, count)
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	
@@ -303,6 +520,8 @@ func (c *Cache) incrementStatsBy(statType string, count uint64) {
 		c.stats.Sets += count
 	case "deletes":
 		c.stats.Deletes += count
+	case "stale":
+		c.stats.Stale += count
 	}
 }
 
@@ -312,6 +531,6 @@ func (c *Cache) Ping(ctx context.Context) error {
 
 // TTL returns the remaining time to live of a key
 func (c *Cache) TTL(ctx context.Context, key string) (time.Duration, error) {
-	fullKey := c.createKey(key)
+	fullKey := c.createKey(ctx, key)
 	return c.redis.TTL(ctx, fullKey).Result()
 }
\ No newline at end of file
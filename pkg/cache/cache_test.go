@@ -5,24 +5,16 @@ import (
 	"testing"
 	"time"
 
-	"blueprint/config"
-	"blueprint/pkg/redis"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/testsupport"
 	
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestConnect(t *testing.T) {
-	cfg := config.NewConfig()
-
-	redisClient, err := redis.NewRedisClient(cfg)
-	if err != nil {
-		t.Skipf("Skipping test - Redis not available: %v", err)
-		return
-	}
-	defer redisClient.Close()
-
-	c := NewCache(redisClient.GetClient())
+	c := NewCache(testsupport.Redis(t))
+	var err error
 
 	ctx := context.Background()
 	
@@ -43,21 +35,13 @@ func TestConnect(t *testing.T) {
 	t.Logf("Successfully stored and retrieved: %v", retrievedValue)
 	
 	// Cleanup
-	err = c.Delete(ctx, testKey)
+	_, err = c.Delete(ctx, testKey)
 	assert.NoError(t, err, "Failed to delete test key")
 }
 
 func TestCacheWithTTL(t *testing.T) {
-	cfg := config.NewConfig()
-
-	redisClient, err := redis.NewRedisClient(cfg)
-	if err != nil {
-		t.Skipf("Skipping test - Redis not available: %v", err)
-		return
-	}
-	defer redisClient.Close()
-
-	c := NewCache(redisClient.GetClient())
+	c := NewCache(testsupport.Redis(t))
+	var err error
 	ctx := context.Background()
 	
 	testKey := "test:ttl:key"
@@ -85,16 +69,8 @@ func TestCacheWithTTL(t *testing.T) {
 }
 
 func TestCacheStats(t *testing.T) {
-	cfg := config.NewConfig()
-
-	redisClient, err := redis.NewRedisClient(cfg)
-	if err != nil {
-		t.Skipf("Skipping test - Redis not available: %v", err)
-		return
-	}
-	defer redisClient.Close()
-
-	c := NewCache(redisClient.GetClient())
+	c := NewCache(testsupport.Redis(t))
+	var err error
 	ctx := context.Background()
 	
 	// Reset stats
@@ -118,7 +94,7 @@ func TestCacheStats(t *testing.T) {
 	assert.Error(t, err)
 	
 	// This should increment deletes
-	err = c.Delete(ctx, testKey)
+	_, err = c.Delete(ctx, testKey)
 	require.NoError(t, err)
 	
 	// Check stats
@@ -133,16 +109,8 @@ func TestCacheStats(t *testing.T) {
 }
 
 func TestCacheBatchDelete(t *testing.T) {
-	cfg := config.NewConfig()
-
-	redisClient, err := redis.NewRedisClient(cfg)
-	if err != nil {
-		t.Skipf("Skipping test - Redis not available: %v", err)
-		return
-	}
-	defer redisClient.Close()
-
-	c := NewCache(redisClient.GetClient())
+	c := NewCache(testsupport.Redis(t))
+	var err error
 	ctx := context.Background()
 	
 	// Set multiple keys
@@ -153,7 +121,7 @@ func TestCacheBatchDelete(t *testing.T) {
 	}
 	
 	// Delete all at once
-	err = c.Delete(ctx, keys...)
+	err = c.DeleteStrict(ctx, keys...)
 	require.NoError(t, err)
 	
 	// Verify all are deleted
@@ -162,4 +130,68 @@ func TestCacheBatchDelete(t *testing.T) {
 		require.NoError(t, err)
 		assert.False(t, exists, "Key %s should be deleted", key)
 	}
-}
\ No newline at end of file
+}
+
+func TestDeleteMissingKeys(t *testing.T) {
+	c := NewCache(testsupport.Redis(t))
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "test:del:1", 1))
+	deleted, err := c.Delete(ctx, "test:del:1", "test:del:missing")
+	require.NoError(t, err, "missing keys are not an error")
+	assert.Equal(t, int64(1), deleted)
+
+	deleted, err = c.Delete(ctx, "test:del:1")
+	require.NoError(t, err, "deleting twice is fine")
+	assert.Zero(t, deleted)
+
+	require.NoError(t, c.Set(ctx, "test:del:2", 2))
+	assert.Error(t, c.DeleteStrict(ctx, "test:del:2", "test:del:missing"))
+
+	existed, err := c.DeleteIfExists(ctx, "test:del:2")
+	require.NoError(t, err)
+	assert.False(t, existed, "DeleteStrict still removed the keys that were there")
+}
+
+func TestFlushPrefix(t *testing.T) {
+	ctx := context.Background()
+	scopes, err := ParseScopes([]string{"tenant"})
+	require.NoError(t, err)
+	c := NewCacheWithOptions(testsupport.Redis(t), Options{Scope: scopes})
+
+	acme := ctxmeta.WithTenantID(ctx, "acme")
+	require.NoError(t, c.Set(ctx, "flush:user:1", 1))
+	require.NoError(t, c.Set(acme, "flush:user:2", 2))
+	require.NoError(t, c.Set(ctx, "flush:order:1", 3))
+	require.NoError(t, c.Set(ctx, "flush:user*", 4))
+
+	deleted, err := c.FlushPrefix(ctx, "flush:user*")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted, "* in the prefix is literal")
+
+	deleted, err = c.FlushPrefix(ctx, "flush:user:")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted, "every scope")
+
+	exists, err := c.Exists(ctx, "flush:order:1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestScopedKeys(t *testing.T) {
+	scopes, err := ParseScopes([]string{"tenant", "locale"})
+	require.NoError(t, err)
+	c := NewCacheWithOptions(nil, Options{Scope: scopes})
+
+	ctx := ctxmeta.WithLocale(ctxmeta.WithTenantID(context.Background(), "acme"), "en-US")
+	assert.Equal(t, "blueprint:tenant=acme:locale=en-US:resp:x", c.createKey(ctx, "resp:x"))
+	assert.Equal(t, "blueprint:tenant=:locale=:resp:x", c.createKey(context.Background(), "resp:x"))
+
+	other := ctxmeta.WithTenantID(context.Background(), "a:b")
+	assert.Equal(t, "blueprint:tenant=a%3Ab:locale=:k", c.createKey(other, "k"), "values cannot forge a key segment")
+
+	assert.Equal(t, "blueprint:k", NewCache(nil).createKey(ctx, "k"), "unscoped by default")
+
+	_, err = ParseScopes([]string{"region"})
+	assert.Error(t, err)
+}
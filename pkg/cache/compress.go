@@ -0,0 +1,89 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	"fmt"
+	"sync"
+
+	"blueprint/pkg/compress"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Compressed values are framed as
+//
+//	magic(1) algorithm(1) compressed-bytes
+//
+// JSON never starts with the magic byte, so entries written before
+// compression was turned on, or values too small for it, read as they
+// are. The algorithm travels with the value: a cache switched to another
+// codec, or none, still reads what the old one wrote until it expires.
+// Raw (WithSkipSerialize) and proto values are never compressed.
+const compressedMagic byte = 0xC5
+
+var algorithmIDs = map[string]byte{
+	compress.Gzip:   1,
+	compress.Zstd:   2,
+	compress.Snappy: 3,
+}
+
+var compressionBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_cache_compression_bytes_total",
+	Help: "Bytes of cache values before (raw) and after (stored) compression, values left as they are not counted.",
+}, []string{"stage"})
+
+func init() {
+	prometheus.MustRegister(compressionBytes)
+}
+
+var decoders struct {
+	once sync.Once
+	byID map[byte]compress.Codec
+}
+
+// decoder is the codec for an algorithm id, decoding does not depend on
+// the level a value was encoded at
+func decoder(id byte) compress.Codec {
+	decoders.once.Do(func() {
+		decoders.byID = make(map[byte]compress.Codec, len(algorithmIDs))
+		for name, id := range algorithmIDs {
+			if codec, err := compress.New(name, compress.LevelDefault); err == nil {
+				decoders.byID[id] = codec
+			}
+		}
+	})
+	return decoders.byID[id]
+}
+
+// compressValue frames data compressed by the cache's codec, unless it is
+// below the minimum size or would not get any smaller
+func (c *Cache) compressValue(data []byte) ([]byte, error) {
+	if c.codec == nil || len(data) < c.compressMin {
+		return data, nil
+	}
+	out := make([]byte, 2, 2+len(data)/2)
+	out[0], out[1] = compressedMagic, c.codecID
+	out, err := c.codec.Encode(out, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) >= len(data) {
+		return data, nil
+	}
+	compressionBytes.WithLabelValues("raw").Add(float64(len(data)))
+	compressionBytes.WithLabelValues("stored").Add(float64(len(out)))
+	return out, nil
+}
+
+// decompressValue returns the value data holds, decompressing it when it
+// is framed
+func decompressValue(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != compressedMagic {
+		return data, nil
+	}
+	codec := decoder(data[1])
+	if codec == nil {
+		return nil, fmt.Errorf("unknown cache compression %d", data[1])
+	}
+	return codec.Decode(nil, data[2:])
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"blueprint/pkg/compress"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compressed(t testing.TB, algorithm string, min int) Options {
+	codec, err := compress.New(algorithm, compress.LevelDefault)
+	require.NoError(t, err)
+	return Options{Prefix: "compress", Compression: codec, CompressMinBytes: min}
+}
+
+func TestCompressValue(t *testing.T) {
+	large := []byte(`{"orders":"` + strings.Repeat("BTC-USD buy 0.5 ", 100) + `"}`)
+	for _, algorithm := range []string{compress.Gzip, compress.Zstd, compress.Snappy} {
+		c := NewCacheWithOptions(nil, compressed(t, algorithm, 64))
+
+		stored, err := c.compressValue(large)
+		require.NoError(t, err)
+		assert.Equal(t, compressedMagic, stored[0], algorithm)
+		assert.Less(t, len(stored), len(large), algorithm)
+		value, err := decompressValue(stored)
+		require.NoError(t, err)
+		assert.Equal(t, large, value, algorithm)
+
+		small := []byte(`{"id":1}`)
+		stored, err = c.compressValue(small)
+		require.NoError(t, err)
+		assert.Equal(t, small, stored, "below the minimum")
+	}
+
+	plain := NewCacheWithOptions(nil, Options{})
+	stored, err := plain.compressValue(large)
+	require.NoError(t, err)
+	assert.Equal(t, large, stored, "no codec")
+}
+
+func TestDecompressValue(t *testing.T) {
+	value, err := decompressValue([]byte(`"plain"`))
+	require.NoError(t, err)
+	assert.Equal(t, `"plain"`, string(value))
+
+	_, err = decompressValue([]byte{compressedMagic, 9, 1, 2})
+	assert.EqualError(t, err, "unknown cache compression 9")
+	_, err = decompressValue([]byte{compressedMagic, algorithmIDs[compress.Zstd], 1, 2})
+	assert.Error(t, err)
+}
+
+func TestCompressedRoundTrip(t *testing.T) {
+	client := testsupport.Redis(t)
+	ctx := context.Background()
+	value := map[string]string{"symbol": "BTC-USD", "notes": strings.Repeat("filled at market ", 50)}
+
+	zstd := NewCacheWithOptions(client, compressed(t, compress.Zstd, 64))
+	require.NoError(t, zstd.Set(ctx, "order", value))
+	stored, err := client.Get(ctx, "compress:order").Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, compressedMagic, stored[0])
+
+	var got map[string]string
+	require.NoError(t, zstd.Get(ctx, "order", &got))
+	assert.Equal(t, value, got)
+	raw, err := zstd.GetRaw(ctx, "order")
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), "BTC-USD")
+
+	// a cache switched to snappy or none reads what zstd wrote
+	for _, other := range []*Cache{
+		NewCacheWithOptions(client, compressed(t, compress.Snappy, 64)),
+		NewCacheWithOptions(client, Options{Prefix: "compress"}),
+	} {
+		got = nil
+		require.NoError(t, other.Get(ctx, "order", &got))
+		assert.Equal(t, value, got)
+	}
+
+	require.NoError(t, zstd.SetBatch(ctx, map[string]interface{}{"a": value, "b": "small"}, time.Minute))
+	batch := map[string]interface{}{}
+	require.NoError(t, zstd.GetBatch(ctx, []string{"a", "b"}, batch))
+	assert.Equal(t, value["symbol"], batch["a"].(map[string]interface{})["symbol"])
+	assert.Equal(t, "small", batch["b"])
+
+	loads := 0
+	load := func(ctx context.Context) (interface{}, error) { loads++; return value, nil }
+	for i := 0; i < 2; i++ {
+		got = nil
+		require.NoError(t, zstd.Fetch(ctx, "fetched", &got, time.Minute, load))
+		assert.Equal(t, value, got)
+	}
+	assert.Equal(t, 1, loads)
+
+	_, err = zstd.Delete(ctx, "order", "a", "b", "fetched")
+	require.NoError(t, err)
+}
@@ -0,0 +1,48 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var degradedOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_cache_degraded_operations_total",
+	Help: "Cache operations skipped while redis was unavailable, by operation. Reads count as misses.",
+}, []string{"op"})
+
+func init() {
+	prometheus.MustRegister(degradedOperations)
+}
+
+// skip reports whether op should leave redis alone because Options.Available
+// says it is down, counting it when so
+func (c *Cache) skip(op string) bool {
+	if c.available == nil || c.available() {
+		return false
+	}
+	degradedOperations.WithLabelValues(op).Inc()
+	return true
+}
+
+// loadOnly is Fetch without redis, the value goes to dest but is not stored
+func loadOnly(ctx context.Context, key string, dest interface{}, load Loader) error {
+	value, err := load(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load cache key %s", key)
+	}
+	if dest == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return serializationError("fetch", key, err)
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		return serializationError("fetch", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnavailableCacheSkipsRedis(t *testing.T) {
+	// no redis at all, any command would panic on the nil client
+	c := NewCacheWithOptions(nil, Options{Available: func() bool { return false }})
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "account:1", "cached"))
+	var v string
+	assert.True(t, IsMiss(c.Get(ctx, "account:1", &v)))
+	n, err := c.Delete(ctx, "account:1")
+	assert.ErrorIs(t, err, ErrUnavailable, "the entry outlives the outage")
+	assert.Zero(t, n)
+	_, err = c.FlushPrefix(ctx, "account:")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	ok, err := c.Exists(ctx, "account:1")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	dest := map[string]interface{}{}
+	assert.NoError(t, c.GetBatch(ctx, []string{"a", "b"}, dest))
+	assert.Empty(t, dest)
+	assert.Equal(t, uint64(3), c.GetStats().Misses, "skipped reads are misses")
+}
+
+func TestUnavailableFetchLoadsWithoutStoring(t *testing.T) {
+	c := NewCacheWithOptions(nil, Options{Available: func() bool { return false }})
+
+	var got map[string]int
+	err := c.Fetch(context.Background(), "fetch:down", &got, time.Minute, func(ctx context.Context) (interface{}, error) {
+		return map[string]int{"v": 1}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, got["v"])
+}
+
+func TestCacheResumesWhenAvailable(t *testing.T) {
+	var up atomic.Bool
+	c := NewCacheWithOptions(testsupport.Redis(t), Options{Available: up.Load})
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "degraded:resume", "dropped"))
+	up.Store(true)
+	var v string
+	assert.True(t, IsMiss(c.Get(ctx, "degraded:resume", &v)), "writes while down were dropped")
+
+	require.NoError(t, c.Set(ctx, "degraded:resume", "kept"))
+	require.NoError(t, c.Get(ctx, "degraded:resume", &v))
+	assert.Equal(t, "kept", v)
+}
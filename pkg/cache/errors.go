@@ -0,0 +1,62 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	stderrors "errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrNotFound means the key is not in the cache, check with errors.Is
+	ErrNotFound = stderrors.New("cache key not found")
+	// ErrSerialization means a value could not be encoded for or decoded
+	// from the cache, the cause is kept so errors.As still finds e.g. a
+	// *json.UnmarshalTypeError
+	ErrSerialization = stderrors.New("cache value serialization failed")
+	// ErrUnavailable means a delete was not done because redis is down,
+	// the entries stay until their TTL
+	ErrUnavailable = stderrors.New("cache unavailable")
+)
+
+// Error is what Get, Set and friends return for a miss or a bad value.
+// errors.Is matches its Kind and its cause.
+type Error struct {
+	Op   string // get, set, fetch ...
+	Key  string // the full key, prefix and scope included
+	Kind error  // ErrNotFound, ErrSerialization or ErrUnavailable
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("cache %s %s: %v", e.Op, e.Key, e.Kind)
+	}
+	return fmt.Sprintf("cache %s %s: %v: %v", e.Op, e.Key, e.Kind, e.Err)
+}
+
+// Unwrap keeps errors.Is(err, redis.Nil) working for callers written
+// before ErrNotFound
+func (e *Error) Unwrap() []error {
+	errs := []error{e.Kind}
+	if e.Kind == ErrNotFound {
+		errs = append(errs, redis.Nil)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+func notFound(op, key string) error {
+	return &Error{Op: op, Key: key, Kind: ErrNotFound}
+}
+
+func unavailable(op, key string) error {
+	return &Error{Op: op, Key: key, Kind: ErrUnavailable}
+}
+
+func serializationError(op, key string, err error) error {
+	return &Error{Op: op, Key: key, Kind: ErrSerialization, Err: err}
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	var n int
+	err := m.Get(ctx, "missing", &n)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, err, redis.Nil, "callers matching redis.Nil keep working")
+	assert.NotErrorIs(t, err, ErrSerialization)
+	var cacheErr *Error
+	require.ErrorAs(t, err, &cacheErr)
+	assert.Equal(t, "missing", cacheErr.Key)
+	assert.Equal(t, "cache get missing: cache key not found", err.Error())
+
+	require.NoError(t, m.Set(ctx, "text", "not a number"))
+	err = m.Get(ctx, "text", &n)
+	assert.ErrorIs(t, err, ErrSerialization)
+	assert.False(t, IsMiss(err))
+	var typeErr *json.UnmarshalTypeError
+	assert.True(t, errors.As(err, &typeErr), "the cause is kept")
+
+	assert.ErrorIs(t, m.Set(ctx, "bad", func() {}), ErrSerialization)
+}
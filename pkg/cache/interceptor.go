@@ -0,0 +1,212 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"blueprint/pkg/grpcmethod"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const responseKeyPrefix = "resp"
+
+var responseCacheResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_response_cache_total",
+	Help: "gRPC calls seen by the response cache by result: hit, miss, bypass or error.",
+}, []string{"grpc_method", "result"})
+
+func init() {
+	prometheus.MustRegister(responseCacheResults)
+}
+
+// ProtoStore is the part of Cache the response cache needs
+type ProtoStore interface {
+	GetProto(ctx context.Context, key string, msg proto.Message) error
+	SetProto(ctx context.Context, key string, msg proto.Message, ttl time.Duration) error
+}
+
+// Policy caches the responses of one method. Method is the full method
+// "/pkg.Service/Method", the service "pkg.Service" or the bare method name.
+// KeyFields are the request fields the key is built from, empty uses the
+// whole request.
+type Policy struct {
+	Method    string
+	TTL       time.Duration
+	KeyFields []string
+}
+
+// ParsePolicy reads "method=ttl[:field|field]", e.g. "Call=5m:name"
+func ParsePolicy(spec string) (Policy, error) {
+	method, rest, ok := strings.Cut(spec, "=")
+	if !ok || method == "" {
+		return Policy{}, fmt.Errorf("cache policy %q: want method=ttl[:field|field]", spec)
+	}
+
+	ttlSpec, fields, _ := strings.Cut(rest, ":")
+	ttl, err := time.ParseDuration(ttlSpec)
+	if err != nil || ttl <= 0 {
+		return Policy{}, fmt.Errorf("cache policy %q: invalid ttl %q", spec, ttlSpec)
+	}
+
+	p := Policy{Method: strings.TrimSpace(method), TTL: ttl}
+	if fields != "" {
+		p.KeyFields = strings.Split(fields, "|")
+	}
+	return p, nil
+}
+
+func (p Policy) matches(fullMethod string) bool {
+	return grpcmethod.Match(p.Method, fullMethod)
+}
+
+// ResponseCache is a unary interceptor serving repeated calls from the
+// store. Only successful responses are kept. It runs last in the chain, so
+// a hit skips whatever the handler itself checks but not the rate limits
+// and quotas in front of it.
+type ResponseCache struct {
+	store        ProtoStore
+	policies     []Policy
+	bypassHeader string
+}
+
+// NewResponseCache passes every call through until SetStore is called
+func NewResponseCache(policies []Policy, bypassHeader string) *ResponseCache {
+	return &ResponseCache{
+		policies:     policies,
+		bypassHeader: strings.ToLower(bypassHeader),
+	}
+}
+
+// SetStore plugs in the store once redis is up, call it before serving
+func (rc *ResponseCache) SetStore(store ProtoStore) {
+	rc.store = store
+}
+
+func (rc *ResponseCache) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if rc.store == nil {
+			return handler(ctx, req)
+		}
+
+		policy, ok := rc.policy(info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		reqMsg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		key, err := responseKey(info.FullMethod, reqMsg, policy.KeyFields)
+		if err != nil {
+			responseCacheResults.WithLabelValues(info.FullMethod, "error").Inc()
+			return handler(ctx, req)
+		}
+
+		if rc.bypass(ctx) {
+			responseCacheResults.WithLabelValues(info.FullMethod, "bypass").Inc()
+		} else if cached, err := rc.lookup(ctx, info.FullMethod, key); err == nil {
+			responseCacheResults.WithLabelValues(info.FullMethod, "hit").Inc()
+			return cached, nil
+		} else if IsMiss(err) {
+			responseCacheResults.WithLabelValues(info.FullMethod, "miss").Inc()
+		} else {
+			responseCacheResults.WithLabelValues(info.FullMethod, "error").Inc()
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+
+		if msg, ok := resp.(proto.Message); ok {
+			if err := rc.store.SetProto(ctx, key, msg, policy.TTL); err != nil {
+				responseCacheResults.WithLabelValues(info.FullMethod, "error").Inc()
+			}
+		}
+		return resp, nil
+	}
+}
+
+func (rc *ResponseCache) policy(fullMethod string) (Policy, bool) {
+	for _, p := range rc.policies {
+		if p.matches(fullMethod) {
+			return p, true
+		}
+	}
+	return Policy{}, false
+}
+
+func (rc *ResponseCache) bypass(ctx context.Context) bool {
+	if rc.bypassHeader == "" {
+		return false
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	vals := md.Get(rc.bypassHeader)
+	return len(vals) > 0 && vals[0] != "" && !strings.EqualFold(vals[0], "false")
+}
+
+// lookup decodes into a fresh message of the method's output type, looked
+// up in the proto registry so no policy has to name it
+func (rc *ResponseCache) lookup(ctx context.Context, fullMethod, key string) (proto.Message, error) {
+	mt, err := outputType(fullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := mt.New().Interface()
+	if err := rc.store.GetProto(ctx, key, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func outputType(fullMethod string) (protoreflect.MessageType, error) {
+	name := protoreflect.FullName(strings.ReplaceAll(strings.TrimPrefix(fullMethod, "/"), "/", "."))
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return nil, err
+	}
+	md, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a method", name)
+	}
+	return protoregistry.GlobalTypes.FindMessageByName(md.Output().FullName())
+}
+
+// responseKey is "resp:<method>:<field>=<value>&..." for key fields, or a
+// hash of the deterministic encoding of the whole request
+func responseKey(fullMethod string, req proto.Message, fields []string) (string, error) {
+	if len(fields) == 0 {
+		raw, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(raw)
+		return responseKeyPrefix + ":" + fullMethod + ":" + hex.EncodeToString(sum[:]), nil
+	}
+
+	m := req.ProtoReflect()
+	values := url.Values{}
+	for _, name := range fields {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return "", fmt.Errorf("%s has no field %q", m.Descriptor().FullName(), name)
+		}
+		values.Set(name, m.Get(fd).String())
+	}
+	return responseKeyPrefix + ":" + fullMethod + ":" + values.Encode(), nil
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "blueprint/proto/blueprint"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const callMethod = "/blueprint.Blueprint/Call"
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("Call=5m:name|lang")
+	require.NoError(t, err)
+	assert.Equal(t, Policy{Method: "Call", TTL: 5 * time.Minute, KeyFields: []string{"name", "lang"}}, p)
+
+	p, err = ParsePolicy("/blueprint.Blueprint/Call=30s")
+	require.NoError(t, err)
+	assert.Equal(t, callMethod, p.Method)
+	assert.Nil(t, p.KeyFields)
+
+	for _, bad := range []string{"Call", "=5m", "Call=soon", "Call=0s"} {
+		_, err := ParsePolicy(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestResponseCacheInterceptor(t *testing.T) {
+	store := NewMemory()
+	rc := NewResponseCache([]Policy{{Method: "Call", TTL: time.Minute, KeyFields: []string{"name"}}}, "x-cache-bypass")
+	rc.SetStore(store)
+	intercept := rc.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: callMethod}
+
+	calls := 0
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		if req.(*pb.CallRequest).Name == "fail" {
+			return nil, status.Error(codes.Internal, "boom")
+		}
+		return &pb.CallResponse{Msg: "hello " + req.(*pb.CallRequest).Name}, nil
+	}
+
+	call := func(ctx context.Context, name string) (*pb.CallResponse, error) {
+		resp, err := intercept(ctx, &pb.CallRequest{Name: name}, info, handler)
+		if err != nil {
+			return nil, err
+		}
+		return resp.(*pb.CallResponse), nil
+	}
+
+	ctx := context.Background()
+	resp, err := call(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "hello alice", resp.Msg)
+	exists, err := store.Exists(ctx, "resp:"+callMethod+":name=alice")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	resp, err = call(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "hello alice", resp.Msg)
+	assert.Equal(t, 1, calls, "second call should be a hit")
+
+	bypass := metadata.NewIncomingContext(ctx, metadata.Pairs("x-cache-bypass", "1"))
+	_, err = call(bypass, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls, "bypass should reach the handler")
+
+	_, err = call(ctx, "fail")
+	assert.Equal(t, codes.Internal, status.Code(err))
+	_, err = call(ctx, "fail")
+	assert.Error(t, err)
+	assert.Equal(t, 4, calls, "errors are not cached")
+
+	other := &grpc.UnaryServerInfo{FullMethod: "/blueprint.Blueprint/Other"}
+	_, err = intercept(ctx, &pb.CallRequest{Name: "alice"}, other, handler)
+	require.NoError(t, err)
+	assert.Equal(t, 5, calls, "methods without a policy pass through")
+}
+
+func TestResponseKeyWholeRequest(t *testing.T) {
+	a, err := responseKey(callMethod, &pb.CallRequest{Name: "a"}, nil)
+	require.NoError(t, err)
+	b, err := responseKey(callMethod, &pb.CallRequest{Name: "b"}, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+
+	_, err = responseKey(callMethod, &pb.CallRequest{}, []string{"missing"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,71 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"blueprint/pkg/ctxmeta"
+)
+
+// most caches scope by a few values, more than this spill to the heap
+const maxInlineScopes = 4
+
+// createKey is "prefix:key", or with a scope "prefix:tenant=acme:locale=en:key".
+// A value missing from ctx stays empty ("user="), anonymous callers share
+// one scope that no real value collides with.
+//
+// It runs on every call and allocates only the returned string: a scoped
+// key is written into a builder grown to its exact length up front. The
+// builder hands its buffer over to the string, so there is nothing a pool
+// could reuse.
+func (c *Cache) createKey(ctx context.Context, key string) string {
+	if len(c.scope) == 0 {
+		return c.prefix + ":" + key
+	}
+
+	var inline [maxInlineScopes]string
+	values := inline[:0]
+	n := len(c.prefix) + 1 + len(key)
+	for _, s := range c.scope {
+		// QueryEscape returns v itself when there is nothing to escape
+		v := url.QueryEscape(c.scopeValue(ctx, s))
+		values = append(values, v)
+		n += 1 + len(s) + 1 + len(v)
+	}
+
+	var b strings.Builder
+	b.Grow(n)
+	b.WriteString(c.prefix)
+	for i, s := range c.scope {
+		b.WriteByte(':')
+		b.WriteString(string(s))
+		b.WriteByte('=')
+		b.WriteString(values[i])
+	}
+	b.WriteByte(':')
+	b.WriteString(key)
+	return b.String()
+}
+
+// Unscoped is ctx without the values keys are scoped by, for entries every
+// caller shares like settings and accounts
+func Unscoped(ctx context.Context) context.Context {
+	ctx = ctxmeta.WithTenantID(ctx, "")
+	ctx = ctxmeta.WithUserID(ctx, "")
+	return ctxmeta.WithLocale(ctx, "")
+}
+
+func (c *Cache) scopeValue(ctx context.Context, s Scope) string {
+	var v string
+	switch s {
+	case ScopeTenant:
+		v, _ = ctxmeta.TenantID(ctx)
+	case ScopeUser:
+		v, _ = ctxmeta.UserID(ctx)
+	case ScopeLocale:
+		v, _ = ctxmeta.Locale(ctx)
+	}
+	return v
+}
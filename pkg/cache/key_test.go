@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scopedCache(t testing.TB) *Cache {
+	scopes, err := ParseScopes([]string{"tenant", "user", "locale"})
+	require.NoError(t, err)
+	return NewCacheWithOptions(nil, Options{Scope: scopes})
+}
+
+func scopedContext() context.Context {
+	ctx := ctxmeta.WithTenantID(context.Background(), "acme")
+	ctx = ctxmeta.WithUserID(ctx, "u-42")
+	return ctxmeta.WithLocale(ctx, "en-US")
+}
+
+func TestCreateKeyAllocs(t *testing.T) {
+	ctx := scopedContext()
+	unscoped, scoped := NewCache(nil), scopedCache(t)
+
+	assert.Equal(t, 1.0, testing.AllocsPerRun(100, func() { unscoped.createKey(ctx, "order:1") }))
+	assert.Equal(t, 1.0, testing.AllocsPerRun(100, func() { scoped.createKey(ctx, "order:1") }))
+	assert.Equal(t, "blueprint:tenant=acme:user=u-42:locale=en-US:order:1", scoped.createKey(ctx, "order:1"))
+}
+
+func BenchmarkCreateKey(b *testing.B) {
+	ctx := scopedContext()
+	b.Run("unscoped", func(b *testing.B) {
+		c := NewCache(nil)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			c.createKey(ctx, "order:1")
+		}
+	})
+	b.Run("scoped", func(b *testing.B) {
+		c := scopedCache(b)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			c.createKey(ctx, "order:1")
+		}
+	})
+}
+
+func BenchmarkSetGetDelete(b *testing.B) {
+	scopes, err := ParseScopes([]string{"tenant", "user", "locale"})
+	require.NoError(b, err)
+	c := NewCacheWithOptions(testsupport.Redis(b), Options{Scope: scopes})
+	ctx := scopedContext()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var v string
+		if err := c.Set(ctx, "bench:key", "value"); err != nil {
+			b.Fatal(err)
+		}
+		if err := c.Get(ctx, "bench:key", &v); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := c.Delete(ctx, "bench:key"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
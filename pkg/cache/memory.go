@@ -0,0 +1,191 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/consistency"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Memory is an in-process Store for tests. Values are encoded like the
+// redis cache so a test sees the same errors, ErrNotFound and
+// ErrSerialization included.
+type Memory struct {
+	expiration time.Duration
+	clock      clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	stats   CacheStats
+}
+
+type memoryEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		expiration: defaultExpiration,
+		clock:      clock.Real,
+		entries:    make(map[string]memoryEntry),
+	}
+}
+
+// SetClock lets tests expire entries with a clock.Fake instead of sleeping
+func (m *Memory) SetClock(c clock.Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = clock.Or(c)
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value interface{}, opts ...CallOption) error {
+	o := newCallOptions(opts)
+	data, err := o.encode(value)
+	if err != nil {
+		return serializationError("set", key, err)
+	}
+	ttl := m.expiration
+	if o.ttl > 0 {
+		ttl = o.ttl
+	}
+	m.put(key, data, ttl, o.noStats)
+	return nil
+}
+
+func (m *Memory) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return m.Set(ctx, key, value, WithTTL(ttl))
+}
+
+func (m *Memory) Get(ctx context.Context, key string, dest interface{}, opts ...CallOption) error {
+	o := newCallOptions(opts)
+	data, err := m.get(ctx, key, o.noStats)
+	if err != nil {
+		return err
+	}
+	if err := o.decode(data, dest); err != nil {
+		return serializationError("get", key, err)
+	}
+	return nil
+}
+
+func (m *Memory) SetProto(ctx context.Context, key string, msg proto.Message, ttl time.Duration) error {
+	data, err := EncodeProto(msg)
+	if err != nil {
+		return serializationError("set_proto", key, err)
+	}
+	if ttl == 0 {
+		ttl = m.expiration
+	}
+	m.put(key, data, ttl, false)
+	return nil
+}
+
+func (m *Memory) GetProto(ctx context.Context, key string, msg proto.Message) error {
+	data, err := m.get(ctx, key, false)
+	if err != nil {
+		return err
+	}
+	if err := DecodeProto(data, msg); err != nil {
+		return serializationError("get_proto", key, err)
+	}
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, keys ...string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for _, key := range keys {
+		if _, ok := m.live(key); ok {
+			deleted++
+		}
+		delete(m.entries, key)
+	}
+	m.stats.Deletes++
+	return deleted, nil
+}
+
+// FlushPrefix deletes every key starting with prefix, like Cache.FlushPrefix
+func (m *Memory) FlushPrefix(ctx context.Context, prefix string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for key := range m.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if _, ok := m.live(key); ok {
+			deleted++
+		}
+		delete(m.entries, key)
+	}
+	m.stats.Deletes++
+	return deleted, nil
+}
+
+func (m *Memory) Exists(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.live(key)
+	return ok, nil
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (m *Memory) GetStats() CacheStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+func (m *Memory) put(key string, data []byte, ttl time.Duration, noStats bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[key] = memoryEntry{data: data, expiresAt: m.clock.Now().Add(ttl)}
+	if !noStats {
+		m.stats.Sets++
+	}
+}
+
+func (m *Memory) get(ctx context.Context, key string, noStats bool) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.live(key)
+	if !ok || consistency.Stale(ctx, key) {
+		if !noStats {
+			m.stats.Misses++
+		}
+		return nil, notFound("get", key)
+	}
+	if !noStats {
+		m.stats.Hits++
+	}
+	return e.data, nil
+}
+
+// live drops the entry when it has expired, callers hold mu
+func (m *Memory) live(key string) (memoryEntry, bool) {
+	e, ok := m.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	if !m.clock.Now().Before(e.expiresAt) {
+		delete(m.entries, key)
+		return memoryEntry{}, false
+	}
+	return e, true
+}
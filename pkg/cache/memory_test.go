@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+	pb "blueprint/proto/blueprint"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	m := NewMemory()
+	m.SetClock(clk)
+
+	require.NoError(t, m.SetWithTTL(ctx, "k", map[string]int{"a": 1}, time.Minute))
+	var got map[string]int
+	require.NoError(t, m.Get(ctx, "k", &got))
+	assert.Equal(t, 1, got["a"])
+
+	require.NoError(t, m.SetProto(ctx, "p", &pb.CallResponse{Msg: "hi"}, time.Second))
+	resp := &pb.CallResponse{}
+	require.NoError(t, m.GetProto(ctx, "p", resp))
+	assert.Equal(t, "hi", resp.Msg)
+
+	clk.Advance(2 * time.Second)
+	assert.True(t, IsMiss(m.GetProto(ctx, "p", resp)), "expired entries are misses")
+	exists, err := m.Exists(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	deleted, err := m.Delete(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.True(t, IsMiss(m.Get(ctx, "k", &got)))
+
+	stats := m.GetStats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, uint64(2), stats.Sets)
+}
+
+func TestMemoryFlushPrefix(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	for _, key := range []string{"accounts:1", "accounts:2", "account:1"} {
+		require.NoError(t, m.Set(ctx, key, "v"))
+	}
+
+	deleted, err := m.FlushPrefix(ctx, "accounts:")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	exists, _ := m.Exists(ctx, "account:1")
+	assert.True(t, exists)
+}
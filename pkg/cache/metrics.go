@@ -0,0 +1,66 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_cache_operations_total",
+		Help: "Cache operations by key prefix and result: hit, miss, set, delete or stale.",
+	}, []string{"prefix", "result"})
+	cacheHitRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_cache_hit_ratio",
+		Help: "Hits over hits plus misses since start, per key prefix.",
+	}, []string{"prefix"})
+)
+
+func init() {
+	prometheus.MustRegister(cacheOperations, cacheHitRatio)
+}
+
+// prefixReads totals hits and misses per prefix, caches sharing a prefix
+// report one ratio
+var prefixReads = struct {
+	sync.Mutex
+	m map[string]*[2]uint64 // hits, misses
+}{m: map[string]*[2]uint64{}}
+
+// observe exports count operations of statType for prefix. ResetStats does
+// not touch these, they are process totals like any Prometheus counter.
+func observe(prefix, statType string, count uint64) {
+	result := statType
+	switch statType {
+	case "hits":
+		result = "hit"
+	case "misses":
+		result = "miss"
+	case "sets":
+		result = "set"
+	case "deletes":
+		result = "delete"
+	}
+	cacheOperations.WithLabelValues(prefix, result).Add(float64(count))
+
+	if result != "hit" && result != "miss" {
+		return
+	}
+	prefixReads.Lock()
+	defer prefixReads.Unlock()
+	reads, ok := prefixReads.m[prefix]
+	if !ok {
+		reads = new([2]uint64)
+		prefixReads.m[prefix] = reads
+	}
+	if result == "hit" {
+		reads[0] += count
+	} else {
+		reads[1] += count
+	}
+	if total := reads[0] + reads[1]; total > 0 {
+		cacheHitRatio.WithLabelValues(prefix).Set(float64(reads[0]) / float64(total))
+	}
+}
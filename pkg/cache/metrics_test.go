@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsByPrefix(t *testing.T) {
+	users := NewCacheWithOptions(nil, Options{Prefix: "metrics-users"})
+	shared := NewCacheWithOptions(nil, Options{Prefix: "metrics-users"})
+	orders := NewCacheWithOptions(nil, Options{Prefix: "metrics-orders"})
+
+	users.incrementStatsBy("hits", 3)
+	shared.incrementStats("misses")
+	orders.incrementStats("misses")
+	orders.incrementStats("sets")
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(cacheOperations.WithLabelValues("metrics-users", "hit")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(cacheOperations.WithLabelValues("metrics-orders", "set")))
+	assert.Equal(t, 0.75, testutil.ToFloat64(cacheHitRatio.WithLabelValues("metrics-users")), "caches sharing a prefix share a ratio")
+	assert.Equal(t, 0.0, testutil.ToFloat64(cacheHitRatio.WithLabelValues("metrics-orders")))
+
+	users.ResetStats()
+	assert.Equal(t, 0.75, testutil.ToFloat64(cacheHitRatio.WithLabelValues("metrics-users")), "ResetStats only clears GetStats")
+}
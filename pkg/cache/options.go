@@ -0,0 +1,69 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CallOption changes a single Get or Set
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	ttl           time.Duration
+	skipSerialize bool
+	noStats       bool
+}
+
+// WithTTL overrides the default expiration for one Set
+func WithTTL(ttl time.Duration) CallOption {
+	return func(o *callOptions) { o.ttl = ttl }
+}
+
+// WithSkipSerialize stores and reads bytes as they are instead of JSON. Set
+// takes a []byte or string, Get a *[]byte or *string.
+func WithSkipSerialize() CallOption {
+	return func(o *callOptions) { o.skipSerialize = true }
+}
+
+// WithNoStats leaves the call out of GetStats, e.g. for warmup or probes
+func WithNoStats() CallOption {
+	return func(o *callOptions) { o.noStats = true }
+}
+
+func newCallOptions(opts []CallOption) callOptions {
+	var o callOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o callOptions) encode(value interface{}) ([]byte, error) {
+	if !o.skipSerialize {
+		return json.Marshal(value)
+	}
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("skip serialize needs []byte or string, got %T", value)
+}
+
+func (o callOptions) decode(data []byte, dest interface{}) error {
+	if !o.skipSerialize {
+		return json.Unmarshal(data, dest)
+	}
+	switch d := dest.(type) {
+	case *[]byte:
+		*d = data
+		return nil
+	case *string:
+		*d = string(data)
+		return nil
+	}
+	return fmt.Errorf("skip serialize needs *[]byte or *string, got %T", dest)
+}
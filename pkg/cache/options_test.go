@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallOptions(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	m := NewMemory()
+	m.SetClock(clk)
+
+	require.NoError(t, m.Set(ctx, "raw", []byte("<p>hi</p>"), WithSkipSerialize(), WithTTL(time.Second)))
+	var page string
+	require.NoError(t, m.Get(ctx, "raw", &page, WithSkipSerialize()))
+	assert.Equal(t, "<p>hi</p>", page, "stored as is, not as a JSON string")
+
+	var got map[string]int
+	assert.Error(t, m.Set(ctx, "raw", got, WithSkipSerialize()), "skip serialize needs bytes")
+	assert.Error(t, m.Get(ctx, "raw", &got, WithSkipSerialize()), "skip serialize needs a byte destination")
+
+	clk.Advance(2 * time.Second)
+	assert.True(t, IsMiss(m.Get(ctx, "raw", &page, WithSkipSerialize())), "expired after the per call ttl")
+
+	before := m.GetStats()
+	require.NoError(t, m.Set(ctx, "probe", 1, WithNoStats()))
+	var v int
+	require.NoError(t, m.Get(ctx, "probe", &v, WithNoStats()))
+	assert.True(t, IsMiss(m.Get(ctx, "gone", &v, WithNoStats())))
+	assert.Equal(t, before, m.GetStats(), "WithNoStats calls are not counted")
+}
@@ -0,0 +1,128 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	stderrors "errors"
+	"time"
+
+	"blueprint/pkg/consistency"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/proto"
+)
+
+// Proto entries are framed so a format change or a different message type
+// under the same key reads as a miss instead of garbage:
+//
+//	magic(1) version(1) uvarint(len(name)) name proto-bytes
+const (
+	protoMagic   byte = 0xB1
+	protoVersion byte = 1
+)
+
+// ErrFormatMismatch means the stored value was written in another format,
+// version or for another message type. Callers treat it like a miss.
+var ErrFormatMismatch = stderrors.New("cache entry format mismatch")
+
+// IsMiss is true for missing keys and entries that can't be read back
+func IsMiss(err error) bool {
+	return stderrors.Is(err, ErrNotFound) || stderrors.Is(err, redis.Nil) || stderrors.Is(err, ErrFormatMismatch)
+}
+
+// EncodeProto frames msg in the versioned cache wire format
+func EncodeProto(msg proto.Message) ([]byte, error) {
+	payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	name := string(msg.ProtoReflect().Descriptor().FullName())
+	buf := make([]byte, 0, 2+binary.MaxVarintLen64+len(name)+len(payload))
+	buf = append(buf, protoMagic, protoVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(name)))
+	buf = append(buf, name...)
+	return append(buf, payload...), nil
+}
+
+// DecodeProto reads data written by EncodeProto into msg
+func DecodeProto(data []byte, msg proto.Message) error {
+	if len(data) < 2 || data[0] != protoMagic || data[1] != protoVersion {
+		return ErrFormatMismatch
+	}
+	data = data[2:]
+
+	n, size := binary.Uvarint(data)
+	if size <= 0 || uint64(len(data)-size) < n {
+		return ErrFormatMismatch
+	}
+	name := string(data[size : size+int(n)])
+	if name != string(msg.ProtoReflect().Descriptor().FullName()) {
+		return ErrFormatMismatch
+	}
+
+	return proto.Unmarshal(data[size+int(n):], msg)
+}
+
+// SetProto stores msg in the binary proto format, ttl 0 uses the default expiration
+func (c *Cache) SetProto(ctx context.Context, key string, msg proto.Message, ttl time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "set_proto", key)
+	var data []byte
+	defer func() { endSpan(span, err, len(data)) }()
+
+	fullKey := c.createKey(ctx, key)
+	data, err = EncodeProto(msg)
+	if err != nil {
+		return serializationError("set_proto", fullKey, err)
+	}
+	if ttl == 0 {
+		ttl = c.expiration
+	}
+	if c.skip("set_proto") {
+		return nil
+	}
+
+	if err := c.redis.SetEx(ctx, fullKey, data, ttl).Err(); err != nil {
+		return errors.Wrapf(err, "failed to set cache key %s", fullKey)
+	}
+
+	c.incrementStats("sets")
+	return nil
+}
+
+// GetProto reads a value stored by SetProto, check the error with IsMiss
+func (c *Cache) GetProto(ctx context.Context, key string, msg proto.Message) (err error) {
+	ctx, span := startSpan(ctx, "get_proto", key)
+	var data []byte
+	defer func() { endReadSpan(span, err, len(data)) }()
+
+	fullKey := c.createKey(ctx, key)
+	if consistency.Stale(ctx, key) {
+		consistency.Bypassed("cache")
+		c.incrementStats("misses")
+		return notFound("get_proto", fullKey)
+	}
+	if c.skip("get_proto") {
+		c.incrementStats("misses")
+		return notFound("get_proto", fullKey)
+	}
+
+	data, err = c.redis.Get(ctx, fullKey).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			c.incrementStats("misses")
+			return notFound("get_proto", fullKey)
+		}
+		return errors.Wrapf(err, "failed to get cache key %s", fullKey)
+	}
+
+	if err := DecodeProto(data, msg); err != nil {
+		c.incrementStats("misses")
+		return serializationError("get_proto", fullKey, err)
+	}
+
+	c.incrementStats("hits")
+	return nil
+}
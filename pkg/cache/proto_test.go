@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"testing"
+
+	pb "blueprint/proto/blueprint"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	in := &pb.CallResponse{Msg: "Hello value from Platform"}
+
+	data, err := EncodeProto(in)
+	require.NoError(t, err)
+
+	out := &pb.CallResponse{}
+	require.NoError(t, DecodeProto(data, out))
+	assert.True(t, proto.Equal(in, out))
+}
+
+func TestProtoFormatMismatch(t *testing.T) {
+	data, err := EncodeProto(&pb.CallResponse{Msg: "hi"})
+	require.NoError(t, err)
+
+	tests := map[string][]byte{
+		"old json entry": []byte(`{"msg":"hi"}`),
+		"future version": append([]byte{protoMagic, protoVersion + 1}, data[2:]...),
+		"truncated":      data[:3],
+		"empty":          nil,
+	}
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := DecodeProto(raw, &pb.CallResponse{})
+			assert.ErrorIs(t, err, ErrFormatMismatch)
+			assert.True(t, IsMiss(errors.Wrap(err, "get")))
+		})
+	}
+
+	t.Run("other message type", func(t *testing.T) {
+		assert.ErrorIs(t, DecodeProto(data, &pb.CallRequest{}), ErrFormatMismatch)
+	})
+}
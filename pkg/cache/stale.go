@@ -0,0 +1,142 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"blueprint/pkg/consistency"
+	"blueprint/pkg/run"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// refreshTimeout bounds a background refresh, the caller that triggered it
+// has long returned
+const refreshTimeout = 10 * time.Second
+
+var staleRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_cache_stale_refresh_total",
+	Help: "Background refreshes of stale cache entries by result: ok or error.",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(staleRefreshes)
+}
+
+// Loader produces the value of a key for Fetch
+type Loader func(ctx context.Context) (interface{}, error)
+
+// Fetch reads key into dest and calls load on a miss, storing its value for
+// ttl (0 uses the default expiration).
+//
+// With Options.StaleWindow entries are kept that much longer than ttl. A
+// read in that window is stale: Fetch returns the stale value right away
+// and refreshes the entry in the background, one refresh per key at a
+// time, so a hot key expiring never makes callers wait on the loader. The
+// refresh keeps ctx's values, e.g. the key scope, but not its deadline.
+func (c *Cache) Fetch(ctx context.Context, key string, dest interface{}, ttl time.Duration, load Loader) (err error) {
+	ctx, span := startSpan(ctx, "fetch", key)
+	hit, size := false, 0
+	defer func() {
+		span.SetAttributes(attribute.Bool("cache.hit", hit))
+		endSpan(span, err, size)
+	}()
+
+	if ttl <= 0 {
+		ttl = c.expiration
+	}
+	fullKey := c.createKey(ctx, key)
+	if consistency.Stale(ctx, key) {
+		consistency.Bypassed("cache")
+		c.incrementStats("misses")
+		return c.load(ctx, fullKey, dest, ttl, load)
+	}
+	if c.skip("fetch") {
+		c.incrementStats("misses")
+		return loadOnly(ctx, fullKey, dest, load)
+	}
+
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err = c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, fullKey)
+		pttl = pipe.PTTL(ctx, fullKey)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return errors.Wrapf(err, "failed to get cache key %s", fullKey)
+	}
+
+	data, getErr := get.Bytes()
+	if getErr == redis.Nil {
+		c.incrementStats("misses")
+		return c.load(ctx, fullKey, dest, ttl, load)
+	}
+	value, err := decompressValue(data)
+	if err != nil {
+		return serializationError("fetch", fullKey, err)
+	}
+	if err := json.Unmarshal(value, dest); err != nil {
+		return serializationError("fetch", fullKey, err)
+	}
+	c.incrementStats("hits")
+	hit, size = true, len(data)
+
+	if c.staleWindow > 0 && pttl.Val() > 0 && pttl.Val() <= c.staleWindow {
+		c.incrementStats("stale")
+		c.refresh(ctx, fullKey, ttl, load)
+	}
+	return nil
+}
+
+// load stores the loader's value for ttl plus the stale window and decodes
+// it into dest unless dest is nil
+func (c *Cache) load(ctx context.Context, fullKey string, dest interface{}, ttl time.Duration, load Loader) error {
+	value, err := load(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load cache key %s", fullKey)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return serializationError("fetch", fullKey, err)
+	}
+	stored, err := c.compressValue(data)
+	if err != nil {
+		return serializationError("fetch", fullKey, err)
+	}
+	if err := c.redis.SetEx(ctx, fullKey, stored, ttl+c.staleWindow).Err(); err != nil {
+		return errors.Wrapf(err, "failed to set cache key %s", fullKey)
+	}
+	c.incrementStats("sets")
+
+	if dest == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		return serializationError("fetch", fullKey, err)
+	}
+	return nil
+}
+
+func (c *Cache) refresh(ctx context.Context, fullKey string, ttl time.Duration, load Loader) {
+	if _, busy := c.refreshing.LoadOrStore(fullKey, struct{}{}); busy {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+	run.Go(nil, "cache_refresh", func() {
+		defer cancel()
+		defer c.refreshing.Delete(fullKey)
+
+		result := "ok"
+		if err := c.load(ctx, fullKey, nil, ttl, load); err != nil {
+			result = "error"
+		}
+		staleRefreshes.WithLabelValues(result).Inc()
+	})
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchLoadsOnMiss(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(testsupport.Redis(t))
+
+	calls := 0
+	load := func(ctx context.Context) (interface{}, error) {
+		calls++
+		return map[string]int{"v": calls}, nil
+	}
+
+	var got map[string]int
+	require.NoError(t, c.Fetch(ctx, "fetch:miss", &got, time.Minute, load))
+	assert.Equal(t, 1, got["v"])
+
+	require.NoError(t, c.Fetch(ctx, "fetch:miss", &got, time.Minute, load))
+	assert.Equal(t, 1, calls, "a hit does not load")
+
+	failing := func(ctx context.Context) (interface{}, error) { return nil, errors.New("db down") }
+	assert.ErrorContains(t, c.Fetch(ctx, "fetch:fail", &got, time.Minute, failing), "db down")
+}
+
+func TestFetchServesStaleWhileRefreshing(t *testing.T) {
+	ctx := context.Background()
+	client := testsupport.Redis(t)
+	c := NewCacheWithOptions(client, Options{StaleWindow: time.Minute})
+
+	// one second left, inside the stale window
+	require.NoError(t, client.SetEx(ctx, c.createKey(ctx, "fetch:hot"), `"old"`, time.Second).Err())
+
+	release := make(chan struct{})
+	loads := make(chan struct{}, 2)
+	load := func(ctx context.Context) (interface{}, error) {
+		loads <- struct{}{}
+		<-release
+		return "new", nil
+	}
+
+	var got string
+	require.NoError(t, c.Fetch(ctx, "fetch:hot", &got, time.Hour, load))
+	assert.Equal(t, "old", got, "served without waiting on the loader")
+	<-loads
+
+	require.NoError(t, c.Fetch(ctx, "fetch:hot", &got, time.Hour, load))
+	assert.Empty(t, loads, "one refresh per key at a time")
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		var v string
+		return c.Get(ctx, "fetch:hot", &v) == nil && v == "new"
+	}, 2*time.Second, 10*time.Millisecond)
+
+	ttl, err := c.TTL(ctx, "fetch:hot")
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Hour, "kept for ttl plus the stale window")
+	assert.Equal(t, uint64(2), c.GetStats().Stale)
+}
@@ -0,0 +1,25 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Store is what callers of the cache depend on, *Cache is the redis
+// implementation and Memory the in-process one for tests
+type Store interface {
+	ProtoStore
+
+	Set(ctx context.Context, key string, value interface{}, opts ...CallOption) error
+	SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	Get(ctx context.Context, key string, dest interface{}, opts ...CallOption) error
+	Delete(ctx context.Context, keys ...string) (int64, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Ping(ctx context.Context) error
+}
+
+var (
+	_ Store = (*Cache)(nil)
+	_ Store = (*Memory)(nil)
+)
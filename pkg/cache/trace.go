@@ -0,0 +1,50 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package cache
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "blueprint/pkg/cache"
+
+// startSpan opens a span for one cache operation on the global tracer
+// provider, a no-op until the service installs one. Only the key's first
+// segment is recorded, full keys carry ids and would blow up cardinality.
+func startSpan(ctx context.Context, op, key string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "cache."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("cache.operation", op),
+			attribute.String("cache.key_prefix", keyPrefix(key)),
+		))
+}
+
+// endSpan records the outcome, a miss is not an error
+func endSpan(span trace.Span, err error, size int) {
+	if size > 0 {
+		span.SetAttributes(attribute.Int("cache.payload_size", size))
+	}
+	if err != nil && !IsMiss(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// endReadSpan also records whether the read hit
+func endReadSpan(span trace.Span, err error, size int) {
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	endSpan(span, err, size)
+}
+
+func keyPrefix(key string) string {
+	prefix, _, _ := strings.Cut(key, ":")
+	return prefix
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"blueprint/pkg/testsupport"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func spanAttrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestSpanOnError(t *testing.T) {
+	rec := recordSpans(t)
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+	c := NewCacheWithOptions(client, Options{MaxRetries: 1})
+
+	var v string
+	require.Error(t, c.Get(context.Background(), "user:42", &v))
+
+	spans := rec.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "cache.get", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	attrs := spanAttrs(spans[0])
+	assert.Equal(t, "user", attrs["cache.key_prefix"].AsString(), "only the first key segment")
+	assert.False(t, attrs["cache.hit"].AsBool())
+}
+
+func TestSpanHitAndMiss(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(testsupport.Redis(t))
+	rec := recordSpans(t)
+
+	require.NoError(t, c.Set(ctx, "user:1", "alice"))
+	var v string
+	require.NoError(t, c.Get(ctx, "user:1", &v))
+	require.True(t, IsMiss(c.Get(ctx, "user:2", &v)))
+
+	spans := rec.Ended()
+	require.Len(t, spans, 3)
+	set, hit, miss := spanAttrs(spans[0]), spanAttrs(spans[1]), spanAttrs(spans[2])
+	assert.Equal(t, int64(len(`"alice"`)), set["cache.payload_size"].AsInt64())
+	assert.True(t, hit["cache.hit"].AsBool())
+	assert.Equal(t, int64(len(`"alice"`)), hit["cache.payload_size"].AsInt64())
+	assert.False(t, miss["cache.hit"].AsBool())
+	assert.Equal(t, codes.Unset, spans[2].Status().Code, "a miss is not an error")
+}
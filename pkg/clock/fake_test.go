@@ -0,0 +1,77 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func fired(c <-chan time.Time) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	f := NewFake(epoch)
+	timer := f.NewTimer(time.Second)
+
+	f.Advance(999 * time.Millisecond)
+	assert.False(t, fired(timer.C()))
+
+	f.Advance(time.Millisecond)
+	assert.True(t, fired(timer.C()))
+	assert.Equal(t, epoch.Add(time.Second), f.Now())
+
+	assert.False(t, timer.Reset(time.Minute), "fired timers are no longer active")
+	assert.True(t, timer.Stop())
+	f.Advance(time.Hour)
+	assert.False(t, fired(timer.C()))
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(10 * time.Second)
+
+	f.Advance(10 * time.Second)
+	assert.Equal(t, epoch.Add(10*time.Second), <-ticker.C())
+
+	// missed ticks are dropped like with time.Ticker
+	f.Advance(time.Minute)
+	assert.True(t, fired(ticker.C()))
+	assert.False(t, fired(ticker.C()))
+
+	ticker.Stop()
+	f.Advance(time.Minute)
+	assert.False(t, fired(ticker.C()))
+}
+
+func TestFakeAfterOrder(t *testing.T) {
+	f := NewFake(epoch)
+	late := f.After(2 * time.Second)
+	early := f.After(time.Second)
+
+	f.Advance(5 * time.Second)
+	assert.Equal(t, epoch.Add(time.Second), <-early)
+	assert.Equal(t, epoch.Add(2*time.Second), <-late)
+	assert.Equal(t, 4*time.Second, f.Since(epoch.Add(time.Second)))
+}
+
+func TestBlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	done := make(chan struct{})
+	go func() {
+		<-f.After(time.Minute)
+		close(done)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Minute)
+	<-done
+}
@@ -0,0 +1,262 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package coalesce turns many small writes into a few batches. Items are
+// buffered until MaxItems are waiting or MaxDelay passed since the first
+// of them, then handed to the flush function in one go, e.g. one redis
+// pipeline or one multi-row insert instead of a round trip each:
+//
+//	ticks := coalesce.New(func(ctx context.Context, items []interface{}) error {
+//		return db.WithContext(ctx).Create(toRows(items)).Error
+//	}, coalesce.Options{Name: "ticks", MaxItems: 500, MaxDelay: 20 * time.Millisecond, Log: log})
+//	defer ticks.Close(ctx)
+//
+//	err := ticks.Add(tick)
+//
+// Batches are flushed one at a time in the order their items were added.
+// Close flushes what is still buffered, nothing added before it is lost
+// unless the flush itself fails.
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMaxItems     = 100
+	defaultMaxDelay     = 10 * time.Millisecond
+	defaultFlushTimeout = 5 * time.Second
+)
+
+var (
+	// ErrClosed is returned by Add after Close
+	ErrClosed = errors.New("coalescer closed")
+	// ErrFull is returned by Add while MaxPending items wait for a slow
+	// flush
+	ErrFull = errors.New("coalescer full")
+)
+
+var (
+	flushes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_coalesce_flushes_total",
+		Help: "Batches flushed by coalescer, trigger (size, delay, manual or close) and result.",
+	}, []string{"coalescer", "trigger", "result"})
+	batchItems = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blueprint_coalesce_batch_items",
+		Help:    "Items per flushed batch by coalescer.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"coalescer"})
+	dropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_coalesce_dropped_total",
+		Help: "Items refused because the coalescer was full, by coalescer.",
+	}, []string{"coalescer"})
+)
+
+func init() {
+	prometheus.MustRegister(flushes, batchItems, dropped)
+}
+
+// Flush writes one batch, items in the order they were added. It owns the
+// slice.
+type Flush func(ctx context.Context, items []interface{}) error
+
+type Options struct {
+	// Name labels the metrics and logs
+	Name string
+	// MaxItems flushes as soon as this many are buffered, 100 by default;
+	// a batch never holds more
+	MaxItems int
+	// MaxDelay is the longest the first item of a batch waits, 10ms by
+	// default
+	MaxDelay time.Duration
+	// MaxPending bounds the items buffered while a flush is slow, Add
+	// fails with ErrFull beyond it; 10 times MaxItems by default
+	MaxPending int
+	// FlushTimeout bounds each flush the coalescer starts on its own, 5s
+	// by default
+	FlushTimeout time.Duration
+	Clock        clock.Clock
+	Log          *logger.Logger
+}
+
+// Coalescer buffers items for a Flush, safe for concurrent use. The zero
+// value is not usable, see New.
+type Coalescer struct {
+	flush Flush
+	opts  Options
+
+	mu      sync.Mutex
+	pending []interface{}
+	closed  bool
+	// first wakes the loop for a new batch, full cuts its wait short
+	first chan struct{}
+	full  chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+
+	// one flush at a time keeps the batches in order
+	flushMu sync.Mutex
+}
+
+func New(flush Flush, opts Options) *Coalescer {
+	if opts.MaxItems <= 0 {
+		opts.MaxItems = defaultMaxItems
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaultMaxDelay
+	}
+	if opts.MaxPending < opts.MaxItems {
+		opts.MaxPending = 10 * opts.MaxItems
+	}
+	if opts.FlushTimeout <= 0 {
+		opts.FlushTimeout = defaultFlushTimeout
+	}
+	opts.Clock = clock.Or(opts.Clock)
+
+	c := &Coalescer{
+		flush: flush,
+		opts:  opts,
+		first: make(chan struct{}, 1),
+		full:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	run.Go(opts.Log, "coalesce_"+opts.Name, c.loop)
+	return c
+}
+
+// Add buffers item for the next batch
+func (c *Coalescer) Add(item interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if len(c.pending) >= c.opts.MaxPending {
+		dropped.WithLabelValues(c.opts.Name).Inc()
+		return ErrFull
+	}
+	c.pending = append(c.pending, item)
+	switch len(c.pending) {
+	case 1:
+		signal(c.first)
+	case c.opts.MaxItems:
+		signal(c.full)
+	}
+	return nil
+}
+
+// Pending is how many items wait for a flush
+func (c *Coalescer) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// Flush writes everything added so far now and returns the first error
+func (c *Coalescer) Flush(ctx context.Context) error {
+	return c.flushPending(ctx, "manual")
+}
+
+// Close refuses new items and flushes the buffered ones with ctx. A flush
+// the coalescer started on its own is waited for first.
+func (c *Coalescer) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.stop)
+	c.mu.Unlock()
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return c.flushPending(ctx, "close")
+}
+
+func (c *Coalescer) loop() {
+	defer close(c.done)
+	for {
+		select {
+		case <-c.first:
+		case <-c.stop:
+			return
+		}
+
+		trigger := "delay"
+		timer := c.opts.Clock.NewTimer(c.opts.MaxDelay)
+		select {
+		case <-timer.C():
+		case <-c.full:
+			trigger = "size"
+		case <-c.stop:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.opts.FlushTimeout)
+		if err := c.flushPending(ctx, trigger); err != nil && c.opts.Log != nil {
+			c.opts.Log.Errorw("Coalesced batch failed", "coalescer", c.opts.Name, "error", err.Error())
+		}
+		cancel()
+	}
+}
+
+// flushPending takes the buffered items and flushes them in batches of
+// at most MaxItems
+func (c *Coalescer) flushPending(ctx context.Context, trigger string) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	items := c.pending
+	c.pending = nil
+	// a size signal for the items taken here is spent, one for items
+	// added from now on is not
+	select {
+	case <-c.full:
+	default:
+	}
+	c.mu.Unlock()
+
+	var first error
+	for len(items) > 0 {
+		n := len(items)
+		if n > c.opts.MaxItems {
+			n = c.opts.MaxItems
+		}
+		batch := items[:n:n]
+		items = items[n:]
+
+		result := "ok"
+		if err := c.flush(ctx, batch); err != nil {
+			result = "error"
+			if first == nil {
+				first = err
+			}
+		}
+		flushes.WithLabelValues(c.opts.Name, trigger, result).Inc()
+		batchItems.WithLabelValues(c.opts.Name).Observe(float64(n))
+	}
+	return first
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,114 @@
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is a Flush keeping every batch
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]interface{}
+	err     error
+}
+
+func (r *recorder) flush(ctx context.Context, items []interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, items)
+	return r.err
+}
+
+func (r *recorder) get() [][]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]interface{}(nil), r.batches...)
+}
+
+func TestFlushOnSize(t *testing.T) {
+	r := &recorder{}
+	before := testutil.ToFloat64(flushes.WithLabelValues("size", "size", "ok"))
+	c := New(r.flush, Options{Name: "size", MaxItems: 3, MaxDelay: time.Hour})
+	defer c.Close(context.Background())
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, c.Add(i))
+	}
+	require.Eventually(t, func() bool { return len(r.get()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []interface{}{1, 2, 3}, r.get()[0])
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(flushes.WithLabelValues("size", "size", "ok")) == before+1
+	}, time.Second, time.Millisecond)
+}
+
+func TestFlushOnDelay(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	r := &recorder{}
+	c := New(r.flush, Options{Name: "delay", MaxItems: 100, MaxDelay: 20 * time.Millisecond, Clock: fake})
+	defer c.Close(context.Background())
+
+	require.NoError(t, c.Add("a"))
+	require.NoError(t, c.Add("b"))
+	fake.BlockUntil(1)
+	fake.Advance(19 * time.Millisecond)
+	assert.Empty(t, r.get())
+
+	fake.Advance(time.Millisecond)
+	require.Eventually(t, func() bool { return len(r.get()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []interface{}{"a", "b"}, r.get()[0])
+	assert.Equal(t, 0, c.Pending())
+}
+
+func TestFlushSplitsAndKeepsOrder(t *testing.T) {
+	r := &recorder{}
+	c := New(r.flush, Options{Name: "split", MaxItems: 2, MaxPending: 10, MaxDelay: time.Hour})
+	defer c.Close(context.Background())
+
+	// the first two may already be on their way as a size flush
+	for _, item := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, c.Add(item))
+	}
+	require.NoError(t, c.Flush(context.Background()))
+
+	var all []interface{}
+	for _, batch := range r.get() {
+		assert.LessOrEqual(t, len(batch), 2)
+		all = append(all, batch...)
+	}
+	assert.Equal(t, []interface{}{"a", "b", "c", "d", "e"}, all)
+}
+
+func TestCloseFlushesTheRest(t *testing.T) {
+	r := &recorder{}
+	c := New(r.flush, Options{Name: "close", MaxDelay: time.Hour})
+	require.NoError(t, c.Add(1))
+	require.NoError(t, c.Add(2))
+
+	require.NoError(t, c.Close(context.Background()))
+	assert.Equal(t, [][]interface{}{{1, 2}}, r.get())
+	assert.Equal(t, ErrClosed, c.Add(3))
+	assert.NoError(t, c.Close(context.Background()), "closing twice")
+}
+
+func TestFlushErrorsAndFull(t *testing.T) {
+	r := &recorder{err: errors.New("db down")}
+	before := testutil.ToFloat64(dropped.WithLabelValues("full"))
+	c := New(r.flush, Options{Name: "full", MaxItems: 1, MaxPending: 1, MaxDelay: time.Hour})
+	// filled by hand, adding it would start a size flush racing the next Add
+	c.mu.Lock()
+	c.pending = []interface{}{"queued"}
+	c.mu.Unlock()
+
+	assert.Equal(t, ErrFull, c.Add("x"))
+	assert.Equal(t, before+1, testutil.ToFloat64(dropped.WithLabelValues("full")))
+	assert.EqualError(t, c.Close(context.Background()), "db down")
+}
@@ -0,0 +1,186 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logArchive is a rotated log file, JSON lines as the logger writes them
+func logArchive(size int) []byte {
+	r := rand.New(rand.NewSource(1))
+	levels := []string{"info", "info", "info", "debug", "warn", "error"}
+	msgs := []string{"Request completed", "Order placed", "Cache miss", "Price updated", "Slow query"}
+	at := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		at = at.Add(time.Duration(r.Intn(5000)) * time.Microsecond)
+		fmt.Fprintf(&buf, `{"level":%q,"ts":%q,"caller":"handler/blueprint.go:%d","msg":%q,"request_id":"%016x","user_id":%d,"latency_ms":%.3f,"status":%d}`+"\n",
+			levels[r.Intn(len(levels))], at.Format(time.RFC3339Nano), 100+r.Intn(400),
+			msgs[r.Intn(len(msgs))], r.Uint64(), r.Intn(100000), r.Float64()*50, []int{200, 200, 201, 404, 500}[r.Intn(5)])
+	}
+	return buf.Bytes()
+}
+
+// cacheValue is a JSON value as the cache stores them, a list of orders
+// grown to about size
+func cacheValue(size int) []byte {
+	type order struct {
+		ID       string  `json:"id"`
+		Symbol   string  `json:"symbol"`
+		Side     string  `json:"side"`
+		Price    float64 `json:"price"`
+		Quantity float64 `json:"quantity"`
+		Status   string  `json:"status"`
+		Created  string  `json:"created_at"`
+	}
+	r := rand.New(rand.NewSource(2))
+	symbols := []string{"BTC-USD", "ETH-USD", "SOL-USD", "EUR-USD"}
+	var orders []order
+	for {
+		orders = append(orders, order{
+			ID:       fmt.Sprintf("ord_%012x", r.Int63()),
+			Symbol:   symbols[r.Intn(len(symbols))],
+			Side:     []string{"buy", "sell"}[r.Intn(2)],
+			Price:    float64(r.Intn(7000000)) / 100,
+			Quantity: float64(r.Intn(100000)) / 1000,
+			Status:   []string{"open", "filled", "cancelled"}[r.Intn(3)],
+			Created:  time.Unix(1700000000+r.Int63n(1e6), 0).UTC().Format(time.RFC3339),
+		})
+		data, _ := json.Marshal(orders)
+		if len(data) >= size {
+			return data
+		}
+	}
+}
+
+var payloads = []struct {
+	name string
+	data []byte
+}{
+	{"log/1MiB", logArchive(1 << 20)},
+	{"cache/256B", cacheValue(256)},
+	{"cache/1KiB", cacheValue(1 << 10)},
+	{"cache/16KiB", cacheValue(16 << 10)},
+	{"cache/256KiB", cacheValue(256 << 10)},
+}
+
+type setting struct {
+	algorithm string
+	level     Level
+}
+
+func (s setting) String() string { return s.algorithm + "-" + s.level.String() }
+
+var settings = []setting{
+	{Gzip, LevelFastest}, {Gzip, LevelDefault}, {Gzip, LevelBest},
+	{Zstd, LevelFastest}, {Zstd, LevelDefault}, {Zstd, LevelBest},
+	{Snappy, LevelDefault},
+}
+
+func codecs(t testing.TB) map[string]Codec {
+	out := make(map[string]Codec, len(settings))
+	for _, s := range settings {
+		c, err := New(s.algorithm, s.level)
+		require.NoError(t, err)
+		out[s.String()] = c
+	}
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, c := range codecs(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, p := range payloads {
+				packed, err := c.Encode([]byte("x"), p.data)
+				require.NoError(t, err)
+				require.Equal(t, byte('x'), packed[0], "appends to dst")
+				assert.Less(t, len(packed), len(p.data), p.name)
+
+				got, err := c.Decode([]byte("y"), packed[1:])
+				require.NoError(t, err)
+				assert.Equal(t, p.data, got[1:], p.name)
+			}
+		})
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	data := logArchive(64 << 10)
+	for name, c := range codecs(t) {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := c.NewWriter(&buf)
+			require.NoError(t, err)
+			_, err = w.Write(data)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			r, err := c.NewReader(&buf)
+			require.NoError(t, err)
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			assert.Equal(t, data, got)
+		})
+	}
+}
+
+func TestDecodeRejectsGarbage(t *testing.T) {
+	for name, c := range codecs(t) {
+		_, err := c.Decode(nil, []byte("not compressed at all"))
+		assert.Error(t, err, name)
+	}
+}
+
+// BenchmarkEncode and BenchmarkDecode report the compression ratio next
+// to the throughput, the presets are read off them:
+//
+//	go test -run - -bench . -benchmem ./pkg/compress
+func BenchmarkEncode(b *testing.B) {
+	for _, p := range payloads {
+		for _, s := range settings {
+			c, err := New(s.algorithm, s.level)
+			require.NoError(b, err)
+			b.Run(p.name+"/"+s.String(), func(b *testing.B) {
+				var out []byte
+				b.SetBytes(int64(len(p.data)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if out, err = c.Encode(out[:0], p.data); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(p.data))/float64(len(out)), "ratio")
+			})
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, p := range payloads {
+		for _, s := range settings {
+			c, err := New(s.algorithm, s.level)
+			require.NoError(b, err)
+			packed, err := c.Encode(nil, p.data)
+			require.NoError(b, err)
+			b.Run(p.name+"/"+s.String(), func(b *testing.B) {
+				var out []byte
+				b.SetBytes(int64(len(p.data)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if out, err = c.Decode(out[:0], packed); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
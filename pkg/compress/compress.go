@@ -0,0 +1,339 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package compress gives the log archiver and the cache the same codecs,
+// gzip, zstd and snappy, behind one interface:
+//
+//	codec, err := compress.New(compress.Zstd, compress.LevelFastest)
+//	packed, err := codec.Encode(nil, value)
+//
+// Which one to use is a trade between CPU on the hot path and bytes on
+// disk or in redis. The Presets capture the two ends of it, chosen from
+// the benchmarks in bench_test.go (go test -bench . ./pkg/compress).
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"blueprint/config"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algorithms
+const (
+	None   = "none"
+	Gzip   = "gzip"
+	Zstd   = "zstd"
+	Snappy = "snappy"
+)
+
+// MaxDecoded bounds what Decode inflates a value to, a corrupt or hostile
+// value must not take the process' memory
+const MaxDecoded = 64 << 20
+
+// Level trades speed for size, snappy has a single one
+type Level int
+
+const (
+	LevelDefault Level = iota
+	LevelFastest
+	LevelBest
+)
+
+// ParseLevel reads fastest, default or best
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "", "default":
+		return LevelDefault, nil
+	case "fastest":
+		return LevelFastest, nil
+	case "best":
+		return LevelBest, nil
+	}
+	return LevelDefault, fmt.Errorf("unknown compression level %q, want fastest, default or best", s)
+}
+
+func (l Level) String() string {
+	switch l {
+	case LevelFastest:
+		return "fastest"
+	case LevelBest:
+		return "best"
+	default:
+		return "default"
+	}
+}
+
+// Codec compresses whole values with Encode and Decode, safe for
+// concurrent use, and files through NewWriter and NewReader
+type Codec interface {
+	Name() string
+	// Suffix is the file extension of its archives, e.g. ".gz"
+	Suffix() string
+	// Encode appends src compressed to dst
+	Encode(dst, src []byte) ([]byte, error)
+	// Decode appends src decompressed to dst, failing past MaxDecoded
+	Decode(dst, src []byte) ([]byte, error)
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// New returns the codec of algorithm at level, nil for None
+func New(algorithm string, level Level) (Codec, error) {
+	switch algorithm {
+	case None, "":
+		return nil, nil
+	case Gzip:
+		return newGzip(level), nil
+	case Zstd:
+		return newZstd(level)
+	case Snappy:
+		return snappyCodec{}, nil
+	}
+	return nil, fmt.Errorf("unknown compression %q, want none, gzip, zstd or snappy", algorithm)
+}
+
+// Suffixes are the file extensions of every codec's archives
+func Suffixes() []string {
+	return []string{gzipSuffix, zstdSuffix, snappySuffix}
+}
+
+// Preset is a set of defaults for the log archive and the cache
+type Preset struct {
+	Log      string
+	LogLevel Level
+	Cache    string
+	// CacheLevel is the level of Cache, CacheMinBytes the size a value
+	// needs before it is compressed at all
+	CacheLevel    Level
+	CacheMinBytes int
+}
+
+// Presets for COMPRESSION_PRESET. Without one logs are gzipped and cache
+// values stored as they are.
+var Presets = map[string]Preset{
+	// fastest zstd archives logs as small as default gzip at twice its
+	// speed. snappy encodes and decodes cache values several times faster
+	// than anything else and still shrinks JSON to a third; values below
+	// 4KiB gain too little on the wire to be worth it.
+	"latency": {Log: Zstd, LogLevel: LevelFastest, Cache: Snappy, CacheMinBytes: 4 << 10},
+	// best gzip archives are the smallest, rotation is off the hot path.
+	// Default zstd values are two thirds the size of snappy's at a fifth
+	// of best gzip's encode cost, and a few hundred bytes of JSON already
+	// lose a third.
+	"storage": {Log: Gzip, LogLevel: LevelBest, Cache: Zstd, CacheLevel: LevelDefault, CacheMinBytes: 256},
+}
+
+// Default is what is used without a preset, the behaviour from before
+// compression was configurable
+var Default = Preset{Log: Gzip}
+
+// FromConfig is the preset of COMPRESSION_PRESET, or Default, with the
+// settings cfg overrides
+func FromConfig(cfg *config.Config) (Preset, error) {
+	c := cfg.Compression
+	p := Default
+	if c.Preset != "" {
+		preset, ok := Presets[c.Preset]
+		if !ok {
+			return p, fmt.Errorf("unknown compression preset %q", c.Preset)
+		}
+		p = preset
+	}
+
+	var err error
+	if c.Log != "" {
+		p.Log, p.LogLevel = c.Log, LevelDefault
+	}
+	if c.LogLevel != "" {
+		if p.LogLevel, err = ParseLevel(c.LogLevel); err != nil {
+			return p, err
+		}
+	}
+	if c.Cache != "" {
+		p.Cache, p.CacheLevel = c.Cache, LevelDefault
+	}
+	if c.CacheLevel != "" {
+		if p.CacheLevel, err = ParseLevel(c.CacheLevel); err != nil {
+			return p, err
+		}
+	}
+	if c.CacheMinBytes > 0 {
+		p.CacheMinBytes = c.CacheMinBytes
+	}
+	return p, nil
+}
+
+const (
+	gzipSuffix   = ".gz"
+	zstdSuffix   = ".zst"
+	snappySuffix = ".sz"
+)
+
+type gzipCodec struct {
+	level   int
+	writers sync.Pool
+}
+
+func newGzip(level Level) *gzipCodec {
+	c := &gzipCodec{level: gzip.DefaultCompression}
+	switch level {
+	case LevelFastest:
+		c.level = gzip.BestSpeed
+	case LevelBest:
+		c.level = gzip.BestCompression
+	}
+	c.writers.New = func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, c.level)
+		return w
+	}
+	return c
+}
+
+func (c *gzipCodec) Name() string   { return Gzip }
+func (c *gzipCodec) Suffix() string { return gzipSuffix }
+
+func (c *gzipCodec) Encode(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w := c.writers.Get().(*gzip.Writer)
+	defer c.writers.Put(w)
+	w.Reset(buf)
+	if _, err := w.Write(src); err != nil {
+		return dst, err
+	}
+	if err := w.Close(); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gzipCodec) Decode(dst, src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return dst, err
+	}
+	defer r.Close()
+	return readLimited(dst, r)
+}
+
+func (c *gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.level)
+}
+
+func (c *gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zstdCodec struct {
+	level zstd.EncoderLevel
+	// EncodeAll and DecodeAll are safe for concurrent use
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+func newZstd(level Level) (*zstdCodec, error) {
+	c := &zstdCodec{level: zstd.SpeedDefault}
+	switch level {
+	case LevelFastest:
+		c.level = zstd.SpeedFastest
+	case LevelBest:
+		c.level = zstd.SpeedBestCompression
+	}
+	var err error
+	if c.enc, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(c.level)); err != nil {
+		return nil, err
+	}
+	if c.dec, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(MaxDecoded)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *zstdCodec) Name() string   { return Zstd }
+func (c *zstdCodec) Suffix() string { return zstdSuffix }
+
+func (c *zstdCodec) Encode(dst, src []byte) ([]byte, error) {
+	return c.enc.EncodeAll(src, dst), nil
+}
+
+func (c *zstdCodec) Decode(dst, src []byte) ([]byte, error) {
+	return c.dec.DecodeAll(src, dst)
+}
+
+func (c *zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(c.level))
+}
+
+func (c *zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// snappyCodec uses the block format for values and the framing format for
+// files
+type snappyCodec struct{}
+
+func (snappyCodec) Name() string   { return Snappy }
+func (snappyCodec) Suffix() string { return snappySuffix }
+
+func (snappyCodec) Encode(dst, src []byte) ([]byte, error) {
+	n := len(dst)
+	dst = grow(dst, snappy.MaxEncodedLen(len(src)))
+	out := snappy.Encode(dst[n:cap(dst)], src)
+	return dst[:n+len(out)], nil
+}
+
+func (snappyCodec) Decode(dst, src []byte) ([]byte, error) {
+	size, err := snappy.DecodedLen(src)
+	if err != nil {
+		return dst, err
+	}
+	if size > MaxDecoded {
+		return dst, fmt.Errorf("snappy: decoded size %d exceeds %d", size, MaxDecoded)
+	}
+	n := len(dst)
+	dst = grow(dst, size)
+	out, err := snappy.Decode(dst[n:n+size], src)
+	if err != nil {
+		return dst[:n], err
+	}
+	return dst[:n+len(out)], nil
+}
+
+func (snappyCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (snappyCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(snappy.NewReader(r)), nil
+}
+
+// grow makes room for n more bytes after len(b)
+func grow(b []byte, n int) []byte {
+	if cap(b)-len(b) >= n {
+		return b
+	}
+	out := make([]byte, len(b), len(b)+n)
+	copy(out, b)
+	return out
+}
+
+func readLimited(dst []byte, r io.Reader) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	n, err := buf.ReadFrom(io.LimitReader(r, MaxDecoded+1))
+	if err != nil {
+		return dst, err
+	}
+	if n > MaxDecoded {
+		return dst, fmt.Errorf("decoded size exceeds %d", MaxDecoded)
+	}
+	return buf.Bytes(), nil
+}
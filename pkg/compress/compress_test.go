@@ -0,0 +1,48 @@
+package compress
+
+import (
+	"testing"
+
+	"blueprint/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	c, err := New(None, LevelBest)
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+
+	_, err = New("lz4", LevelDefault)
+	assert.EqualError(t, err, `unknown compression "lz4", want none, gzip, zstd or snappy`)
+
+	for _, p := range Presets {
+		for _, alg := range []string{p.Log, p.Cache} {
+			_, err := New(alg, LevelDefault)
+			assert.NoError(t, err, alg)
+		}
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	cfg := &config.Config{}
+	p, err := FromConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, Default, p)
+
+	cfg.Compression = config.Compression{Preset: "latency"}
+	p, err = FromConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, Presets["latency"], p)
+
+	// a new algorithm starts from its default level, not the preset's
+	cfg.Compression = config.Compression{Preset: "storage", Log: Zstd, CacheLevel: "fastest", CacheMinBytes: 4096}
+	p, err = FromConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, Preset{Log: Zstd, Cache: Zstd, CacheLevel: LevelFastest, CacheMinBytes: 4096}, p)
+
+	cfg.Compression = config.Compression{Preset: "tiny"}
+	_, err = FromConfig(cfg)
+	assert.EqualError(t, err, `unknown compression preset "tiny"`)
+}
@@ -0,0 +1,111 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package consistency gives a request read-your-writes consistency. The
+// interceptor starts a Session per call, writes record what they made
+// stale, e.g. the db.CacheInvalidator records the keys it deletes, and
+// reads later in the same call skip the cache for those keys instead of
+// racing the invalidation.
+//
+//	if consistency.Stale(ctx, key) {
+//		// read the database instead
+//	}
+//
+// There are no read replicas yet, a router sending reads to one should
+// keep them on the primary once Primary(ctx) is true.
+package consistency
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var bypasses = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_read_your_writes_bypass_total",
+	Help: "Reads that skipped a cache or replica because the same request wrote the data, by source.",
+}, []string{"source"})
+
+func init() {
+	prometheus.MustRegister(bypasses)
+}
+
+type key struct{}
+
+// Session is what one request wrote, safe for the goroutines of a request
+type Session struct {
+	mu       sync.RWMutex
+	wrote    bool
+	keys     map[string]struct{}
+	prefixes []string
+}
+
+// WithSession starts a session unless ctx already has one, nested calls
+// share the outer session
+func WithSession(ctx context.Context) context.Context {
+	if _, ok := FromContext(ctx); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, key{}, &Session{keys: make(map[string]struct{})})
+}
+
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(key{}).(*Session)
+	return s, ok
+}
+
+// Wrote records a write making keys and every key under prefixes stale.
+// Without a session it does nothing, so writers can always call it.
+func Wrote(ctx context.Context, keys, prefixes []string) {
+	s, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wrote = true
+	for _, k := range keys {
+		s.keys[k] = struct{}{}
+	}
+	s.prefixes = append(s.prefixes, prefixes...)
+}
+
+// Stale reports whether the request wrote cacheKey, keys are unscoped as
+// the caller passes them to the cache
+func Stale(ctx context.Context, cacheKey string) bool {
+	s, ok := FromContext(ctx)
+	if !ok {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.keys[cacheKey]; ok {
+		return true
+	}
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(cacheKey, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Primary reports whether the request wrote anything, its reads should go
+// to the primary
+func Primary(ctx context.Context) bool {
+	s, ok := FromContext(ctx)
+	if !ok {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.wrote
+}
+
+// Bypassed counts a read that skipped source, e.g. "cache"
+func Bypassed(source string) {
+	bypasses.WithLabelValues(source).Inc()
+}
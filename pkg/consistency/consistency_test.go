@@ -0,0 +1,49 @@
+package consistency
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func TestWroteWithoutSession(t *testing.T) {
+	ctx := context.Background()
+	Wrote(ctx, []string{"account:1"}, nil)
+	assert.False(t, Stale(ctx, "account:1"))
+	assert.False(t, Primary(ctx))
+}
+
+func TestStaleKeysAndPrefixes(t *testing.T) {
+	ctx := WithSession(context.Background())
+	assert.False(t, Primary(ctx))
+
+	Wrote(ctx, []string{"account:1"}, []string{"accounts:"})
+	assert.True(t, Primary(ctx))
+	assert.True(t, Stale(ctx, "account:1"))
+	assert.True(t, Stale(ctx, "accounts:page=2"))
+	assert.False(t, Stale(ctx, "account:2"))
+}
+
+func TestNestedSessionsShare(t *testing.T) {
+	ctx := WithSession(context.Background())
+	inner := WithSession(ctx)
+	Wrote(inner, nil, nil)
+	assert.True(t, Primary(ctx), "the outer request wrote too")
+}
+
+func TestUnaryServerInterceptorStartsASessionPerCall(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		stale := Stale(ctx, "account:1")
+		Wrote(ctx, []string{"account:1"}, nil)
+		return stale, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		stale, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+		assert.NoError(t, err)
+		assert.Equal(t, false, stale, "call %d starts clean", i)
+	}
+}
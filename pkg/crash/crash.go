@@ -0,0 +1,202 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package crash
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/logger"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultMaxGoroutineDump = 64 * 1024
+	redacted                = "[REDACTED]"
+)
+
+var defaultRedactKeys = []string{"authorization", "cookie", "x-api-key"}
+
+// Report is the structured crash report built for every recovered panic
+type Report struct {
+	ID         string              `json:"id"`
+	Time       time.Time           `json:"time"`
+	Service    string              `json:"service"`
+	Version    string              `json:"version"`
+	Method     string              `json:"method,omitempty"`
+	Peer       string              `json:"peer,omitempty"`
+	Panic      string              `json:"panic"`
+	Stack      string              `json:"stack"`
+	Metadata   map[string][]string `json:"metadata,omitempty"`
+	Goroutines string              `json:"goroutines,omitempty"`
+}
+
+// Sink receives crash reports, e.g. an error tracker
+type Sink interface {
+	Send(ctx context.Context, report *Report) error
+}
+
+type Options struct {
+	Service string
+	Version string
+	// CaptureGoroutines adds a dump of all goroutines, it stops the world so keep it off on hot services
+	CaptureGoroutines bool
+	MaxGoroutineDump  int
+	RedactKeys        []string
+	// Verbose adds the panic value to the status message sent to the client
+	Verbose bool
+}
+
+type Reporter struct {
+	log  *logger.Logger
+	opts Options
+
+	mu    sync.RWMutex
+	sinks []Sink
+}
+
+func NewReporter(cfg *config.Config, log *logger.Logger, service, version string) *Reporter {
+	return NewReporterWithOptions(log, Options{
+		Service:           service,
+		Version:           version,
+		CaptureGoroutines: cfg.Crash.GoroutineDump,
+		Verbose:           cfg.Debug.VerboseErrors,
+	})
+}
+
+func NewReporterWithOptions(log *logger.Logger, opts Options) *Reporter {
+	if opts.MaxGoroutineDump == 0 {
+		opts.MaxGoroutineDump = defaultMaxGoroutineDump
+	}
+	if opts.RedactKeys == nil {
+		opts.RedactKeys = defaultRedactKeys
+	}
+
+	return &Reporter{
+		log:  log,
+		opts: opts,
+	}
+}
+
+func (r *Reporter) AddSink(s Sink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sinks = append(r.sinks, s)
+}
+
+// Capture builds the report for p, logs it and forwards it to the sinks.
+// It must be called from the deferred recover so the stack still points at the panic
+func (r *Reporter) Capture(ctx context.Context, p interface{}) *Report {
+	report := &Report{
+		ID:      newID(),
+		Time:    time.Now().UTC(),
+		Service: r.opts.Service,
+		Version: r.opts.Version,
+		Panic:   fmt.Sprintf("%v", p),
+		Stack:   string(debug.Stack()),
+	}
+
+	if method, ok := grpc.Method(ctx); ok {
+		report.Method = method
+	} else if method, ok := ctxmeta.Method(ctx); ok {
+		// HTTP requests, see httpmw.RequestID
+		report.Method = method
+	}
+
+	if pr, ok := peer.FromContext(ctx); ok && pr.Addr != nil {
+		report.Peer = pr.Addr.String()
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		report.Metadata = r.redact(md)
+	}
+
+	if r.opts.CaptureGoroutines {
+		report.Goroutines = goroutineDump(r.opts.MaxGoroutineDump)
+	}
+
+	r.log.WithFields(map[string]interface{}{
+		"crash_id":   report.ID,
+		"method":     report.Method,
+		"peer":       report.Peer,
+		"panic":      report.Panic,
+		"stack":      report.Stack,
+		"metadata":   report.Metadata,
+		"goroutines": report.Goroutines,
+	}).Error("panic recovered")
+
+	r.mu.RLock()
+	sinks := r.sinks
+	r.mu.RUnlock()
+
+	for _, s := range sinks {
+		if err := s.Send(ctx, report); err != nil {
+			r.log.WithError(err).Warnf("failed to send crash report %s", report.ID)
+		}
+	}
+
+	return report
+}
+
+// RecoveryHandler plugs into the recovery interceptor, the client only gets
+// the crash id so the report can be found in the logs, plus the panic value
+// when Verbose is set
+func (r *Reporter) RecoveryHandler(ctx context.Context, p interface{}) error {
+	report := r.Capture(ctx, p)
+	if r.opts.Verbose {
+		return status.Errorf(codes.Internal, "internal server error (crash id %s): %s", report.ID, report.Panic)
+	}
+	return status.Errorf(codes.Internal, "internal server error (crash id %s)", report.ID)
+}
+
+func (r *Reporter) redact(md metadata.MD) map[string][]string {
+	out := make(map[string][]string, len(md))
+	for k, v := range md {
+		if r.isSecret(k) {
+			out[k] = []string{redacted}
+			continue
+		}
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
+
+func (r *Reporter) isSecret(key string) bool {
+	for _, k := range r.opts.RedactKeys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func goroutineDump(max int) string {
+	buf := make([]byte, max)
+	n := runtime.Stack(buf, true)
+	dump := string(buf[:n])
+	if n == max {
+		dump += "\n... truncated"
+	}
+	return dump
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
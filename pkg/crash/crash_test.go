@@ -0,0 +1,106 @@
+package crash
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type recorder struct{ reports []*Report }
+
+func (r *recorder) Send(ctx context.Context, report *Report) error {
+	r.reports = append(r.reports, report)
+	return nil
+}
+
+// capture panics and recovers into r the way the recovery interceptor does
+func capture(r *Reporter, ctx context.Context, p interface{}) (report *Report) {
+	defer func() { report = r.Capture(ctx, recover()) }()
+	panic(p)
+}
+
+func TestCaptureRedactsSecrets(t *testing.T) {
+	log, logs := testsupport.Logger(t)
+	sink := &recorder{}
+	r := NewReporterWithOptions(log, Options{Service: "blueprint", Version: "v1"})
+	r.AddSink(sink)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "Bearer token",
+		"X-Api-Key", "key",
+		"x-request-id", "req-1",
+	))
+	report := capture(r, ctx, "boom")
+
+	assert.Equal(t, "boom", report.Panic)
+	assert.Equal(t, "blueprint", report.Service)
+	assert.Len(t, report.ID, 16)
+	assert.Contains(t, report.Stack, "crash.capture", "the stack still points at the panic")
+	assert.Equal(t, map[string][]string{
+		"authorization": {redacted},
+		"x-api-key":     {redacted},
+		"x-request-id":  {"req-1"},
+	}, report.Metadata)
+	assert.Empty(t, report.Goroutines, "off by default")
+	assert.Equal(t, []*Report{report}, sink.reports)
+
+	entries := logs.Entries(t)
+	require.Len(t, entries, 1)
+	assert.Equal(t, report.ID, entries[0]["crash_id"])
+	assert.NotContains(t, entries[0]["metadata"], "Bearer token")
+}
+
+func TestCaptureCustomRedactKeys(t *testing.T) {
+	log, _ := testsupport.Logger(t)
+	r := NewReporterWithOptions(log, Options{RedactKeys: []string{"x-tenant"}})
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant", "acme", "authorization", "Bearer token"))
+	report := capture(r, ctx, "boom")
+	assert.Equal(t, []string{redacted}, report.Metadata["x-tenant"])
+	assert.Equal(t, []string{"Bearer token"}, report.Metadata["authorization"], "the keys replace the defaults")
+}
+
+func TestGoroutineDumpTruncated(t *testing.T) {
+	log, _ := testsupport.Logger(t)
+	r := NewReporterWithOptions(log, Options{CaptureGoroutines: true, MaxGoroutineDump: 256})
+
+	report := capture(r, context.Background(), "boom")
+	assert.True(t, strings.HasSuffix(report.Goroutines, "\n... truncated"))
+	assert.Len(t, report.Goroutines, 256+len("\n... truncated"))
+
+	dump := goroutineDump(1 << 20)
+	assert.Contains(t, dump, "goroutine ")
+	assert.NotContains(t, dump, "... truncated", "fits the buffer")
+}
+
+func TestRecoveryHandler(t *testing.T) {
+	log, _ := testsupport.Logger(t)
+
+	for _, verbose := range []bool{false, true} {
+		sink := &recorder{}
+		r := NewReporterWithOptions(log, Options{Verbose: verbose})
+		r.AddSink(sink)
+
+		err := r.RecoveryHandler(context.Background(), errors.New("nil map"))
+		require.Len(t, sink.reports, 1)
+		id := sink.reports[0].ID
+
+		st, ok := status.FromError(err)
+		require.True(t, ok)
+		assert.Equal(t, codes.Internal, st.Code())
+		if verbose {
+			assert.Equal(t, "internal server error (crash id "+id+"): nil map", st.Message())
+		} else {
+			assert.Equal(t, "internal server error (crash id "+id+")", st.Message(), "the panic stays out of the response")
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package ctxmeta
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// key is unexported so no other package can collide with our context values
+type key int
+
+const (
+	traceIDKey key = iota
+	requestIDKey
+	userIDKey
+	methodKey
+	clientIPKey
+	tenantIDKey
+	localeKey
+	clientVersionKey
+)
+
+// gRPC metadata / HTTP header names the interceptors read
+const (
+	HeaderRequestID   = "x-request-id"
+	HeaderTraceID     = "x-trace-id"
+	HeaderTraceParent = "traceparent"
+	HeaderUserID      = "x-user-id"
+	HeaderForwarded   = "x-forwarded-for"
+	HeaderTenantID    = "x-tenant-id"
+	HeaderLocale      = "accept-language"
+	// HeaderClientVersion is the build of the calling app, e.g.
+	// "ios/5.2.0" or "orders/v1.4.2"
+	HeaderClientVersion = "x-client-version"
+)
+
+// Metadata is a snapshot of every request value we carry in the context.
+// The interceptors fill it in once per call and everything downstream reads
+// it from there: log fields (Fields), metric exemplars (Exemplar), the
+// request stamp and SQL comment pkg/db adds to what the call writes.
+type Metadata struct {
+	TraceID   string
+	RequestID string
+	UserID    string
+	Method    string
+	ClientIP  string
+	TenantID  string
+	// Locale is the preferred language tag, e.g. "en-US"
+	Locale        string
+	ClientVersion string
+}
+
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey, id)
+}
+
+func TraceID(ctx context.Context) (string, bool) {
+	return value(ctx, traceIDKey)
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+func RequestID(ctx context.Context) (string, bool) {
+	return value(ctx, requestIDKey)
+}
+
+func WithUserID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userIDKey, id)
+}
+
+func UserID(ctx context.Context) (string, bool) {
+	return value(ctx, userIDKey)
+}
+
+func WithMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, methodKey, method)
+}
+
+func Method(ctx context.Context) (string, bool) {
+	return value(ctx, methodKey)
+}
+
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+func ClientIP(ctx context.Context) (string, bool) {
+	return value(ctx, clientIPKey)
+}
+
+func WithTenantID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantIDKey, id)
+}
+
+func TenantID(ctx context.Context) (string, bool) {
+	return value(ctx, tenantIDKey)
+}
+
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey, locale)
+}
+
+func Locale(ctx context.Context) (string, bool) {
+	return value(ctx, localeKey)
+}
+
+func WithClientVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, clientVersionKey, version)
+}
+
+func ClientVersion(ctx context.Context) (string, bool) {
+	return value(ctx, clientVersionKey)
+}
+
+func FromContext(ctx context.Context) Metadata {
+	var m Metadata
+	m.TraceID, _ = TraceID(ctx)
+	m.RequestID, _ = RequestID(ctx)
+	m.UserID, _ = UserID(ctx)
+	m.Method, _ = Method(ctx)
+	m.ClientIP, _ = ClientIP(ctx)
+	m.TenantID, _ = TenantID(ctx)
+	m.Locale, _ = Locale(ctx)
+	m.ClientVersion, _ = ClientVersion(ctx)
+	return m
+}
+
+// Fields returns the non empty values with the key names used in logs
+func (m Metadata) Fields() map[string]interface{} {
+	fields := make(map[string]interface{}, 8)
+	add := func(k, v string) {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	add("trace_id", m.TraceID)
+	add("request_id", m.RequestID)
+	add("user_id", m.UserID)
+	add("grpc_method", m.Method)
+	add("client_ip", m.ClientIP)
+	add("tenant_id", m.TenantID)
+	add("locale", m.Locale)
+	add("client_version", m.ClientVersion)
+	return fields
+}
+
+// NewID returns a random 16 byte hex id for request and trace ids
+func NewID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// TraceIDFromTraceParent extracts the trace id of a W3C traceparent header
+// (version-traceid-parentid-flags)
+func TraceIDFromTraceParent(header string) string {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
+
+// LocaleFromAcceptLanguage returns the first tag of an Accept-Language
+// header, "de-CH,de;q=0.9" gives "de-CH". Tags are not sorted by q, clients
+// list their preference first.
+func LocaleFromAcceptLanguage(header string) string {
+	tag, _, _ := strings.Cut(header, ",")
+	tag, _, _ = strings.Cut(tag, ";")
+	tag = strings.TrimSpace(tag)
+	if tag == "*" {
+		return ""
+	}
+	return tag
+}
+
+func value(ctx context.Context, k key) (string, bool) {
+	v, ok := ctx.Value(k).(string)
+	return v, ok && v != ""
+}
@@ -0,0 +1,121 @@
+package ctxmeta
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// trustAll vouches for every peer, like the gateway over loopback, and
+// takes the last x-forwarded-for hop
+type trustAll bool
+
+func (t trustAll) Trusted(ctx context.Context) bool { return bool(t) }
+
+func (t trustAll) ClientIP(ctx context.Context) net.IP {
+	md, _ := metadata.FromIncomingContext(ctx)
+	hops := strings.Split(first(md, HeaderForwarded), ",")
+	return net.ParseIP(strings.TrimSpace(hops[len(hops)-1]))
+}
+
+func TestUnaryInterceptorPopulatesContext(t *testing.T) {
+	md := metadata.Pairs(
+		HeaderRequestID, "req-1",
+		HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		HeaderUserID, "42",
+		HeaderForwarded, "10.1.1.1, 10.0.0.1",
+		HeaderClientVersion, "ios/5.2.0",
+	)
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+
+	var got Metadata
+	_, err := UnaryServerInterceptor(trustAll(true))(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/blueprint.Blueprint/Call"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			got = FromContext(ctx)
+			return nil, nil
+		})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Metadata{
+		TraceID:       "4bf92f3577b34da6a3ce929d0e0e4736",
+		RequestID:     "req-1",
+		UserID:        "42",
+		Method:        "/blueprint.Blueprint/Call",
+		ClientIP:      "10.0.0.1",
+		ClientVersion: "ios/5.2.0",
+	}, got)
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	ctx := populate(context.Background(), "/m", nil)
+
+	id, ok := RequestID(ctx)
+	assert.True(t, ok)
+	assert.Len(t, id, 32)
+
+	// without any trace header the request id doubles as trace id
+	traceID, _ := TraceID(ctx)
+	assert.Equal(t, id, traceID)
+
+	_, ok = UserID(ctx)
+	assert.False(t, ok)
+}
+
+func TestStringKeysDoNotMatch(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "trace_id", "raw")
+	_, ok := TraceID(ctx)
+	assert.False(t, ok)
+}
+
+func TestTenantAndLocale(t *testing.T) {
+	md := metadata.Pairs(
+		HeaderTenantID, "acme",
+		HeaderLocale, "de-CH,de;q=0.9,en;q=0.8",
+	)
+	ctx := populate(metadata.NewIncomingContext(context.Background(), md), "/m", trustAll(true))
+
+	m := FromContext(ctx)
+	assert.Equal(t, "acme", m.TenantID)
+	assert.Equal(t, "de-CH", m.Locale)
+	assert.Equal(t, "acme", m.Fields()["tenant_id"])
+	assert.NotContains(t, m.Fields(), "client_version")
+
+	assert.Equal(t, "en", LocaleFromAcceptLanguage("en;q=0.5"))
+	assert.Empty(t, LocaleFromAcceptLanguage("*"))
+	assert.Empty(t, LocaleFromAcceptLanguage(""))
+}
+
+func TestIdentityFromTrustedPeersOnly(t *testing.T) {
+	md := metadata.Pairs(
+		HeaderUserID, "42",
+		HeaderTenantID, "acme",
+		HeaderLocale, "de-CH",
+	)
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+
+	for name, peers := range map[string]Peers{"untrusted": trustAll(false), "nil": nil} {
+		m := FromContext(populate(ctx, "/m", peers))
+		assert.Empty(t, m.UserID, name)
+		assert.Empty(t, m.TenantID, name)
+		assert.Equal(t, "de-CH", m.Locale, name)
+	}
+
+	m := FromContext(populate(ctx, "/m", trustAll(true)))
+	assert.Equal(t, "42", m.UserID)
+	assert.Equal(t, "acme", m.TenantID)
+}
+
+func TestClientIPNotForged(t *testing.T) {
+	md := metadata.Pairs(HeaderForwarded, "10.1.1.1")
+	ctx := peer.NewContext(metadata.NewIncomingContext(context.Background(), md),
+		&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 4000}})
+
+	ip, _ := ClientIP(populate(ctx, "/m", nil))
+	assert.Equal(t, "203.0.113.5", ip, "without peers x-forwarded-for is ignored")
+}
@@ -0,0 +1,61 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package ctxmeta
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Exemplar is the trace and request id of ctx as exemplar labels, so a
+// latency spike on a dashboard links to the call behind it. Nil outside a
+// request, or when the ids would not fit the 128 runes an exemplar may
+// hold.
+func Exemplar(ctx context.Context) prometheus.Labels {
+	traceID, _ := TraceID(ctx)
+	requestID, _ := RequestID(ctx)
+
+	labels := prometheus.Labels{}
+	runes := 0
+	add := func(k, v string) {
+		n := utf8.RuneCountInString(k) + utf8.RuneCountInString(v)
+		if v == "" || !utf8.ValidString(v) || runes+n > prometheus.ExemplarMaxRunes {
+			return
+		}
+		labels[k] = v
+		runes += n
+	}
+	add("trace_id", traceID)
+	// the request id doubles as trace id without a trace header
+	if requestID != traceID {
+		add("request_id", requestID)
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// Observe records v on o with the exemplar of ctx when o keeps them
+func Observe(ctx context.Context, o prometheus.Observer, v float64) {
+	if e, ok := o.(prometheus.ExemplarObserver); ok {
+		if labels := Exemplar(ctx); labels != nil {
+			e.ObserveWithExemplar(v, labels)
+			return
+		}
+	}
+	o.Observe(v)
+}
+
+// Inc is Observe for counters
+func Inc(ctx context.Context, c prometheus.Counter) {
+	if e, ok := c.(prometheus.ExemplarAdder); ok {
+		if labels := Exemplar(ctx); labels != nil {
+			e.AddWithExemplar(1, labels)
+			return
+		}
+	}
+	c.Inc()
+}
@@ -0,0 +1,55 @@
+package ctxmeta
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExemplar(t *testing.T) {
+	assert.Nil(t, Exemplar(context.Background()))
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	ctx = WithTraceID(ctx, "req-1")
+	assert.Equal(t, prometheus.Labels{"trace_id": "req-1"}, Exemplar(ctx))
+
+	ctx = WithTraceID(ctx, "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal(t, prometheus.Labels{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "request_id": "req-1"}, Exemplar(ctx))
+
+	// a client's request id too long to fit is left out
+	ctx = WithRequestID(ctx, strings.Repeat("r", 100))
+	assert.Equal(t, prometheus.Labels{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"}, Exemplar(ctx))
+}
+
+func TestObserveWithExemplar(t *testing.T) {
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "exemplar_test_seconds"})
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "exemplar_test_total"})
+	ctx := WithTraceID(context.Background(), "trace-1")
+
+	Observe(ctx, h, 0.2)
+	Inc(ctx, c)
+	Observe(context.Background(), h, 0.3)
+	Inc(context.Background(), c)
+
+	var m dto.Metric
+	require.NoError(t, h.Write(&m))
+	assert.Equal(t, uint64(2), m.GetHistogram().GetSampleCount())
+	var exemplars int
+	for _, b := range m.GetHistogram().GetBucket() {
+		if e := b.GetExemplar(); e != nil {
+			exemplars++
+			assert.Equal(t, "trace-1", e.GetLabel()[0].GetValue())
+		}
+	}
+	assert.Equal(t, 1, exemplars)
+
+	m.Reset()
+	require.NoError(t, c.Write(&m))
+	assert.Equal(t, 2.0, m.GetCounter().GetValue())
+	assert.Equal(t, "trace-1", m.GetCounter().GetExemplar().GetLabel()[0].GetValue())
+}
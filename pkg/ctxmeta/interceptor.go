@@ -0,0 +1,125 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package ctxmeta
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Peers tells how far the transport peer of a call is believed, the
+// netacl.ACL with its trusted proxies is one
+type Peers interface {
+	// Trusted is true for a proxy that authenticated the caller, like the
+	// gateway, only its x-user-id and x-tenant-id are taken
+	Trusted(ctx context.Context) bool
+	// ClientIP is the caller behind any trusted proxies, nil when it can't
+	// be told
+	ClientIP(ctx context.Context) net.IP
+}
+
+// UnaryServerInterceptor fills the context from the incoming metadata and
+// echoes the request id back so clients can quote it. User and tenant are
+// left empty unless peers trusts the peer and the client IP is the one
+// peers resolves; nil trusts no one and takes the transport peer.
+func UnaryServerInterceptor(peers Peers) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = populate(ctx, info.FullMethod, peers)
+		if id, ok := RequestID(ctx); ok {
+			_ = grpc.SetHeader(ctx, metadata.Pairs(HeaderRequestID, id))
+		}
+		return handler(ctx, req)
+	}
+}
+
+func StreamServerInterceptor(peers Peers) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := populate(ss.Context(), info.FullMethod, peers)
+		if id, ok := RequestID(ctx); ok {
+			_ = ss.SetHeader(metadata.Pairs(HeaderRequestID, id))
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func populate(ctx context.Context, method string, peers Peers) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	requestID := first(md, HeaderRequestID)
+	if requestID == "" {
+		requestID = NewID()
+	}
+	ctx = WithRequestID(ctx, requestID)
+
+	traceID := first(md, HeaderTraceID)
+	if traceID == "" {
+		traceID = TraceIDFromTraceParent(first(md, HeaderTraceParent))
+	}
+	if traceID == "" {
+		traceID = requestID
+	}
+	ctx = WithTraceID(ctx, traceID)
+
+	// set by the gateway once the caller is authenticated, anyone else
+	// could claim to be anybody. Tenant and locale scope cached responses,
+	// see cache.Options.Scope.
+	if peers != nil && peers.Trusted(ctx) {
+		if userID := first(md, HeaderUserID); userID != "" {
+			ctx = WithUserID(ctx, userID)
+		}
+		if tenantID := first(md, HeaderTenantID); tenantID != "" {
+			ctx = WithTenantID(ctx, tenantID)
+		}
+	}
+	if locale := LocaleFromAcceptLanguage(first(md, HeaderLocale)); locale != "" {
+		ctx = WithLocale(ctx, locale)
+	}
+	if version := first(md, HeaderClientVersion); version != "" {
+		ctx = WithClientVersion(ctx, version)
+	}
+
+	if ip := clientIP(ctx, peers); ip != "" {
+		ctx = WithClientIP(ctx, ip)
+	}
+
+	return WithMethod(ctx, method)
+}
+
+// clientIP never reads x-forwarded-for itself, the client sets whatever
+// it likes in there; which hops to believe is up to peers
+func clientIP(ctx context.Context, peers Peers) string {
+	if peers != nil {
+		if ip := peers.ClientIP(ctx); ip != nil {
+			return ip.String()
+		}
+		return ""
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+
+	return ""
+}
+
+func first(md metadata.MD, k string) string {
+	if vals := md.Get(k); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
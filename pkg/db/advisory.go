@@ -0,0 +1,126 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+
+	"gorm.io/gorm"
+)
+
+// Postgres advisory locks, a cluster wide mutex for instances that share
+// the database and nothing else. Locks are named, the name is hashed to the
+// 64 bit key postgres wants so every instance agrees on it.
+//
+// Session locks (AcquireAdvisoryLock) pin a pooled connection until
+// Unlock, if the process dies the server drops the connection and the lock
+// with it. Transaction locks (AdvisoryXactLock) need no unlock, they end
+// with the transaction.
+
+// AdvisoryLock is a held session lock
+type AdvisoryLock struct {
+	name string
+	key  int64
+	conn *sql.Conn
+}
+
+// AdvisoryKey is the postgres lock key for name
+func AdvisoryKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// AcquireAdvisoryLock waits for the lock until ctx is done, give ctx a
+// deadline to bound the wait
+func AcquireAdvisoryLock(ctx context.Context, db *sql.DB, name string) (*AdvisoryLock, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("advisory lock %q: %w", name, err)
+	}
+
+	key := AdvisoryKey(name)
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		// the lock may have been granted as the wait was cancelled, only
+		// dropping the connection is sure to let go of it
+		discard(conn)
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("advisory lock %q: %w", name, err)
+	}
+	return &AdvisoryLock{name: name, key: key, conn: conn}, nil
+}
+
+// TryAdvisoryLock takes the lock if it is free, ok is false when someone
+// else holds it
+func TryAdvisoryLock(ctx context.Context, db *sql.DB, name string) (lock *AdvisoryLock, ok bool, err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("advisory lock %q: %w", name, err)
+	}
+
+	key := AdvisoryKey(name)
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil {
+		discard(conn)
+		return nil, false, fmt.Errorf("advisory lock %q: %w", name, err)
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+	return &AdvisoryLock{name: name, key: key, conn: conn}, true, nil
+}
+
+// Unlock releases the lock and returns the connection to the pool. When
+// the unlock fails the connection is closed instead, which releases it too.
+func (l *AdvisoryLock) Unlock(ctx context.Context) error {
+	var released bool
+	err := l.conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", l.key).Scan(&released)
+	if err != nil {
+		discard(l.conn)
+		return fmt.Errorf("advisory unlock %q: %w", l.name, err)
+	}
+	if !released {
+		discard(l.conn)
+		return fmt.Errorf("advisory unlock %q: lock was not held", l.name)
+	}
+	return l.conn.Close()
+}
+
+// discard closes conn for good instead of pooling it
+func discard(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
+
+// AdvisoryXactLock waits for the lock inside tx, it is released when tx
+// commits or rolls back. The wait ends with the tx context.
+func AdvisoryXactLock(tx *gorm.DB, name string) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", AdvisoryKey(name)).Error; err != nil {
+		return fmt.Errorf("advisory lock %q: %w", name, err)
+	}
+	return nil
+}
+
+// TryAdvisoryXactLock takes the lock inside tx if it is free
+func TryAdvisoryXactLock(tx *gorm.DB, name string) (bool, error) {
+	var ok bool
+	if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", AdvisoryKey(name)).Scan(&ok).Error; err != nil {
+		return false, fmt.Errorf("advisory lock %q: %w", name, err)
+	}
+	return ok, nil
+}
+
+// AdvisoryLock takes a session lock on the pool, see AcquireAdvisoryLock
+func (m *PostgresDB) AdvisoryLock(ctx context.Context, name string) (*AdvisoryLock, error) {
+	return AcquireAdvisoryLock(ctx, m.sqlDB, name)
+}
+
+// TryAdvisoryLock takes a session lock on the pool if it is free
+func (m *PostgresDB) TryAdvisoryLock(ctx context.Context, name string) (*AdvisoryLock, bool, error) {
+	return TryAdvisoryLock(ctx, m.sqlDB, name)
+}
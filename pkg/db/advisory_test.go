@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestAdvisoryKey(t *testing.T) {
+	assert.Equal(t, AdvisoryKey("jobs:archive"), AdvisoryKey("jobs:archive"), "every instance agrees on the key")
+	assert.NotEqual(t, AdvisoryKey("jobs:archive"), AdvisoryKey("jobs:retention"))
+}
+
+func TestAdvisoryLock(t *testing.T) {
+	cfg := &config.Config{Postgres: testsupport.Postgres(t)}
+	pg, err := NewPostgresDB(cfg, nil)
+	require.NoError(t, err)
+	defer pg.Close()
+	ctx := context.Background()
+
+	lock, err := pg.AdvisoryLock(ctx, "jobs:archive")
+	require.NoError(t, err)
+
+	_, ok, err := pg.TryAdvisoryLock(ctx, "jobs:archive")
+	require.NoError(t, err)
+	assert.False(t, ok, "held by the first session")
+
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = pg.AdvisoryLock(waitCtx, "jobs:archive")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	other, ok, err := pg.TryAdvisoryLock(ctx, "jobs:retention")
+	require.NoError(t, err)
+	require.True(t, ok, "names lock independently")
+	require.NoError(t, other.Unlock(ctx))
+
+	require.NoError(t, lock.Unlock(ctx))
+	again, ok, err := pg.TryAdvisoryLock(ctx, "jobs:archive")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, again.Unlock(ctx))
+}
+
+func TestAdvisoryXactLock(t *testing.T) {
+	cfg := &config.Config{Postgres: testsupport.Postgres(t)}
+	pg, err := NewPostgresDB(cfg, nil)
+	require.NoError(t, err)
+	defer pg.Close()
+	ctx := context.Background()
+
+	err = pg.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		require.NoError(t, AdvisoryXactLock(tx, "orders:match"))
+
+		_, ok, err := pg.TryAdvisoryLock(ctx, "orders:match")
+		require.NoError(t, err)
+		assert.False(t, ok, "held until the transaction ends")
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = pg.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ok, err := TryAdvisoryXactLock(tx, "orders:match")
+		require.NoError(t, err)
+		assert.True(t, ok, "released on commit")
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,51 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"blueprint/pkg/querybudget"
+
+	"gorm.io/gorm"
+)
+
+const queryCounterName = "blueprint:query_budget"
+
+// QueryCounter is a gorm plugin counting every statement against the
+// querybudget.Counter of its context. A statement over a rejecting budget
+// fails before it reaches the database. NewPostgresDB installs it, outside
+// a call it does nothing.
+type QueryCounter struct{}
+
+func (QueryCounter) Name() string {
+	return queryCounterName
+}
+
+// Initialize hooks in first, ahead of gorm's own transaction, so a
+// rejected write does not even begin one
+func (QueryCounter) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("*").Register(queryCounterName+":create", countQuery); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("*").Register(queryCounterName+":query", countQuery); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("*").Register(queryCounterName+":update", countQuery); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("*").Register(queryCounterName+":delete", countQuery); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("*").Register(queryCounterName+":row", countQuery); err != nil {
+		return err
+	}
+	return cb.Raw().Before("*").Register(queryCounterName+":raw", countQuery)
+}
+
+func countQuery(db *gorm.DB) {
+	if db.Error != nil || db.DryRun {
+		return
+	}
+	if err := querybudget.Count(db.Statement.Context, db.Statement.Table); err != nil {
+		db.AddError(err)
+	}
+}
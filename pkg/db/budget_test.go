@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"blueprint/pkg/querybudget"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryCounter(t *testing.T) {
+	pool := &execPool{rows: 1}
+	db := openExecPool(t, pool)
+	require.NoError(t, db.Use(QueryCounter{}))
+
+	require.NoError(t, db.Create(&cachedAccount{ID: "a0"}).Error, "no budget outside a call")
+
+	ctx, c := querybudget.With(context.Background(), 2, true)
+	require.NoError(t, db.WithContext(ctx).Create(&cachedAccount{ID: "a1"}).Error)
+	require.NoError(t, db.WithContext(ctx).Exec("SELECT 1").Error)
+	pool.query = ""
+
+	err := db.WithContext(ctx).Model(&cachedAccount{}).Where("id = ?", "a1").Update("name", "x").Error
+	assert.ErrorIs(t, err, querybudget.ErrExceeded)
+	assert.Empty(t, pool.query, "rejected before reaching the database")
+	assert.Equal(t, map[string]int{"cached_accounts": 2, "raw": 1}, c.Tables())
+
+	ctx, c = querybudget.With(context.Background(), 1, false)
+	require.NoError(t, db.WithContext(ctx).Create(&cachedAccount{ID: "a2"}).Error)
+	require.NoError(t, db.WithContext(ctx).Create(&cachedAccount{ID: "a3"}).Error, "only logged by the interceptor")
+	assert.True(t, c.Exceeded())
+}
@@ -0,0 +1,103 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/config"
+)
+
+// Credentials a new connection logs in with, ExpiresAt is zero when they
+// don't expire
+type Credentials struct {
+	User      string
+	Password  string
+	ExpiresAt time.Time
+}
+
+// CredentialProvider is asked for credentials before every new connection
+// and by the rotation check, so implementations cache what is expensive
+// to fetch
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// LoginTokens is implemented by providers whose password is a short lived
+// token the server only checks at login, RDS IAM's. A new token leaves the
+// logged in connections valid, the rotator recycles the pool only when the
+// user changes.
+type LoginTokens interface {
+	LoginTokens() bool
+}
+
+// StaticCredentials never change, the POSTGRES_USER/POSTGRES_PASSWORD default
+type StaticCredentials Credentials
+
+func (s StaticCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	return Credentials(s), nil
+}
+
+// NewCredentialProvider picks the provider named by Postgres.Credentials
+func NewCredentialProvider(cfg *config.Config) (CredentialProvider, error) {
+	pg := cfg.Postgres
+	switch pg.Credentials {
+	case "", "static":
+		return StaticCredentials{User: pg.PostgresUser, Password: pg.PostgresPassword}, nil
+	case "file":
+		return NewFileCredentials(pg.PostgresUser, pg.PasswordFile), nil
+	case "vault":
+		return NewVaultCredentials(VaultOptions{
+			Addr:      pg.VaultAddr,
+			Token:     pg.VaultToken,
+			TokenFile: pg.VaultTokenFile,
+			Path:      pg.VaultPath,
+		}), nil
+	case "rds-iam":
+		return NewRDSIAMCredentials(RDSIAMOptions{
+			Endpoint: pg.PostgresHost + ":" + pg.PostgresPort,
+			Region:   pg.AWSRegion,
+			User:     pg.PostgresUser,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown postgres credentials provider %q", pg.Credentials)
+}
+
+// FileCredentials reads the password from a file, e.g. a mounted
+// kubernetes secret or one rendered by a vault agent, again whenever the
+// file changes
+type FileCredentials struct {
+	user string
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	creds   Credentials
+}
+
+func NewFileCredentials(user, path string) *FileCredentials {
+	return &FileCredentials{user: user, path: path}
+}
+
+func (f *FileCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("postgres password file: %w", err)
+	}
+	if !info.ModTime().Equal(f.modTime) {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("postgres password file: %w", err)
+		}
+		f.creds = Credentials{User: f.user, Password: strings.TrimRight(string(data), "\r\n")}
+		f.modTime = info.ModTime()
+	}
+	return f.creds, nil
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCredentialProvider(t *testing.T) {
+	cfg := &config.Config{Postgres: config.Postgres{PostgresUser: "app", PostgresPassword: "secret"}}
+	p, err := NewCredentialProvider(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, StaticCredentials{User: "app", Password: "secret"}, p)
+
+	for name, want := range map[string]interface{}{
+		"file":    &FileCredentials{},
+		"vault":   &VaultCredentials{},
+		"rds-iam": &RDSIAMCredentials{},
+	} {
+		cfg.Postgres.Credentials = name
+		p, err := NewCredentialProvider(cfg)
+		require.NoError(t, err)
+		assert.IsType(t, want, p, name)
+	}
+
+	cfg.Postgres.Credentials = "ldap"
+	_, err = NewCredentialProvider(cfg)
+	assert.Error(t, err)
+}
+
+func TestFileCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(path, []byte("first\n"), 0o600))
+
+	f := NewFileCredentials("app", path)
+	creds, err := f.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{User: "app", Password: "first"}, creds)
+
+	require.NoError(t, os.WriteFile(path, []byte("second"), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	creds, err = f.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "second", creds.Password, "re-read once the file changed")
+
+	require.NoError(t, os.Remove(path))
+	_, err = f.Credentials(context.Background())
+	assert.Error(t, err)
+}
+
+func TestVaultCredentials(t *testing.T) {
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		assert.Equal(t, "/v1/database/creds/blueprint", r.URL.Path)
+		fetches++
+		fmt.Fprintf(w, `{"lease_duration":100,"data":{"username":"v-app-%d","password":"pw-%d"}}`, fetches, fetches)
+	}))
+	defer srv.Close()
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	v := NewVaultCredentials(VaultOptions{Addr: srv.URL, Token: "s.token", Path: "database/creds/blueprint", Clock: clk})
+	ctx := context.Background()
+
+	creds, err := v.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{User: "v-app-1", Password: "pw-1", ExpiresAt: time.Unix(100, 0)}, creds)
+
+	clk.Advance(79 * time.Second)
+	creds, err = v.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v-app-1", creds.User, "cached for most of the lease")
+
+	clk.Advance(time.Second)
+	creds, err = v.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v-app-2", creds.User, "renewed before the lease ends")
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("wrong\n"), 0o600))
+	_, err = NewVaultCredentials(VaultOptions{Addr: srv.URL, TokenFile: tokenFile, Path: "database/creds/blueprint"}).Credentials(ctx)
+	assert.ErrorContains(t, err, "permission denied")
+}
+
+func TestRDSIAMCredentials(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	keys := 0
+	r := NewRDSIAMCredentials(RDSIAMOptions{
+		Endpoint: "db.abc.eu-west-1.rds.amazonaws.com:5432",
+		Region:   "eu-west-1",
+		User:     "app",
+		Clock:    clk,
+		AWS: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			keys++
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}, nil
+		}),
+	})
+	ctx := context.Background()
+
+	creds, err := r.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "app", creds.User)
+	assert.Equal(t, clk.Now().Add(15*time.Minute), creds.ExpiresAt)
+
+	// the token is the presigned url without its scheme
+	u, err := url.Parse("https://" + creds.Password)
+	require.NoError(t, err)
+	assert.Equal(t, "db.abc.eu-west-1.rds.amazonaws.com:5432", u.Host)
+	q := u.Query()
+	assert.Equal(t, "connect", q.Get("Action"))
+	assert.Equal(t, "app", q.Get("DBUser"))
+	assert.Regexp(t, `^AKID/\d{8}/eu-west-1/rds-db/aws4_request$`, q.Get("X-Amz-Credential"))
+	assert.Equal(t, "900", q.Get("X-Amz-Expires"))
+	assert.Equal(t, "session", q.Get("X-Amz-Security-Token"))
+	assert.Len(t, q.Get("X-Amz-Signature"), 64)
+
+	clk.Advance(9 * time.Minute)
+	again, err := r.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, creds, again, "tokens are reused for a while")
+	clk.Advance(time.Minute)
+	again, err = r.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, clk.Now().Add(15*time.Minute), again.ExpiresAt, "a new token")
+	assert.Equal(t, 2, keys)
+}
+
+func TestRDSIAMCredentialsDefaultChain(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-east-2")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	r := NewRDSIAMCredentials(RDSIAMOptions{Endpoint: "db:5432", User: "app"})
+	creds, err := r.Credentials(context.Background())
+	require.NoError(t, err)
+
+	u, err := url.Parse("https://" + creds.Password)
+	require.NoError(t, err)
+	assert.Regexp(t, `^AKENV/\d{8}/us-east-2/rds-db/aws4_request$`, u.Query().Get("X-Amz-Credential"), "keys and region from the SDK")
+}
@@ -0,0 +1,244 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"blueprint/pkg/cache"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/consistency"
+	applog "blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+const (
+	invalidatorName    = "blueprint:cache_invalidation"
+	invalidateTimeout  = time.Second
+	defaultRepeatAfter = 500 * time.Millisecond
+)
+
+var cacheInvalidations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_cache_invalidations_total",
+	Help: "Cache invalidations after writes by table and result, ok or error.",
+}, []string{"table", "result"})
+
+func init() {
+	prometheus.MustRegister(cacheInvalidations)
+}
+
+// Invalidation is what a write makes stale. Keys are deleted as they are,
+// in the writer's key scope. Shared keys are deleted outside any scope,
+// for entries every caller reads through cache.Unscoped. Prefixes are
+// flushed in every scope, use them for lists and for keys scoped by tenant
+// or user; each is a SCAN of the keyspace.
+type Invalidation struct {
+	Keys     []string
+	Shared   []string
+	Prefixes []string
+}
+
+// InvalidationRule maps a written model to its cache entries. model is a
+// pointer to the struct that was written, for batch writes like
+// Where(...).Delete(&Account{}) it only has what the caller set.
+type InvalidationRule func(model interface{}) Invalidation
+
+// CacheStore is the part of cache.Store the invalidator uses, *cache.Cache
+// and cache.Memory both have it
+type CacheStore interface {
+	Delete(ctx context.Context, keys ...string) (int64, error)
+	FlushPrefix(ctx context.Context, prefix string) (int64, error)
+}
+
+type InvalidatorOptions struct {
+	// RepeatAfter invalidates writes made in the caller's transaction a
+	// second time, a reader may have cached the old row between the first
+	// invalidation and the commit. 0 uses 500ms, below 0 disables it.
+	RepeatAfter time.Duration
+	Clock       clock.Clock
+}
+
+// CacheInvalidator is a gorm plugin deleting the cache entries of
+// registered models after each Create, Update and Delete. Failures are
+// logged and counted but never fail the write, entries still expire by TTL.
+// Inside a consistency session the keys are recorded too, reads later in
+// the request skip the cache for them.
+//
+//	inv := db.NewCacheInvalidator(cacheClient, log, db.InvalidatorOptions{})
+//	inv.Register(&model.Account{}, func(m interface{}) db.Invalidation {
+//		a := m.(*model.Account)
+//		return db.Invalidation{Keys: []string{fmt.Sprintf("account:%d", a.AccountId)}, Prefixes: []string{"accounts:"}}
+//	})
+//	pg.DB.Use(inv)
+type CacheInvalidator struct {
+	store CacheStore
+	log   *applog.Logger
+	opts  InvalidatorOptions
+
+	mu    sync.RWMutex
+	rules map[reflect.Type]InvalidationRule
+
+	wg sync.WaitGroup
+}
+
+func NewCacheInvalidator(store CacheStore, log *applog.Logger, opts InvalidatorOptions) *CacheInvalidator {
+	if opts.RepeatAfter == 0 {
+		opts.RepeatAfter = defaultRepeatAfter
+	}
+	opts.Clock = clock.Or(opts.Clock)
+	return &CacheInvalidator{
+		store: store,
+		log:   log,
+		opts:  opts,
+		rules: make(map[reflect.Type]InvalidationRule),
+	}
+}
+
+// Register sets the rule for model's type, model is a struct or a
+// pointer to one
+func (c *CacheInvalidator) Register(model interface{}, rule InvalidationRule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules[structType(model)] = rule
+}
+
+func (c *CacheInvalidator) Name() string {
+	return invalidatorName
+}
+
+// Initialize hooks in after gorm commits its default transaction, so a
+// single write is invalidated once it is visible
+func (c *CacheInvalidator) Initialize(db *gorm.DB) error {
+	const after = "gorm:commit_or_rollback_transaction"
+	cb := db.Callback()
+	if err := cb.Create().After(after).Register(invalidatorName+":create", c.afterWrite); err != nil {
+		return err
+	}
+	if err := cb.Update().After(after).Register(invalidatorName+":update", c.afterWrite); err != nil {
+		return err
+	}
+	return cb.Delete().After(after).Register(invalidatorName+":delete", c.afterWrite)
+}
+
+// Wait blocks until the repeated invalidations have run, for shutdown
+func (c *CacheInvalidator) Wait() {
+	c.wg.Wait()
+}
+
+func (c *CacheInvalidator) afterWrite(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil || db.DryRun {
+		return
+	}
+	// the rest of the request reads from the primary, see consistency
+	consistency.Wrote(stmt.Context, nil, nil)
+
+	c.mu.RLock()
+	rule, ok := c.rules[stmt.Schema.ModelType]
+	c.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	var inv Invalidation
+	for _, model := range models(stmt.ReflectValue, stmt.Schema.ModelType) {
+		i := rule(model)
+		inv.Keys = append(inv.Keys, i.Keys...)
+		inv.Shared = append(inv.Shared, i.Shared...)
+		inv.Prefixes = append(inv.Prefixes, i.Prefixes...)
+	}
+	if len(inv.Keys) == 0 && len(inv.Shared) == 0 && len(inv.Prefixes) == 0 {
+		return
+	}
+
+	// the request may be over by the time the write returns, the cache
+	// entries are stale either way
+	consistency.Wrote(stmt.Context, append(inv.Keys[:len(inv.Keys):len(inv.Keys)], inv.Shared...), inv.Prefixes)
+
+	ctx := context.WithoutCancel(stmt.Context)
+	table := stmt.Schema.Table
+	c.invalidate(ctx, table, inv)
+
+	// still in a transaction means the caller's, it commits later
+	if _, inTx := stmt.ConnPool.(gorm.TxCommitter); inTx && c.opts.RepeatAfter > 0 {
+		c.wg.Add(1)
+		run.Go(c.log, "cache_invalidate_repeat", func() {
+			defer c.wg.Done()
+			<-c.opts.Clock.After(c.opts.RepeatAfter)
+			c.invalidate(ctx, table, inv)
+		})
+	}
+}
+
+func (c *CacheInvalidator) invalidate(ctx context.Context, table string, inv Invalidation) {
+	ctx, cancel := context.WithTimeout(ctx, invalidateTimeout)
+	defer cancel()
+
+	var err error
+	if len(inv.Keys) > 0 {
+		_, err = c.store.Delete(ctx, inv.Keys...)
+	}
+	if len(inv.Shared) > 0 {
+		if _, serr := c.store.Delete(cache.Unscoped(ctx), inv.Shared...); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	for _, prefix := range inv.Prefixes {
+		if _, perr := c.store.FlushPrefix(ctx, prefix); perr != nil && err == nil {
+			err = perr
+		}
+	}
+
+	if err != nil {
+		cacheInvalidations.WithLabelValues(table, "error").Inc()
+		if c.log != nil {
+			c.log.Warnw("Cache invalidation failed, entries expire by TTL", "table", table, "keys", inv.Keys, "shared", inv.Shared, "prefixes", inv.Prefixes, "error", err.Error())
+		}
+		return
+	}
+	cacheInvalidations.WithLabelValues(table, "ok").Inc()
+}
+
+// models are pointers to the structs in v, a struct or a slice of structs
+// or pointers
+func models(v reflect.Value, t reflect.Type) []interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() != t {
+			return nil
+		}
+		if v.CanAddr() {
+			return []interface{}{v.Addr().Interface()}
+		}
+		p := reflect.New(t)
+		p.Elem().Set(v)
+		return []interface{}{p.Interface()}
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out = append(out, models(v.Index(i), t)...)
+		}
+		return out
+	}
+	return nil
+}
+
+func structType(model interface{}) reflect.Type {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"blueprint/pkg/cache"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/consistency"
+	"blueprint/pkg/ctxmeta"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type cachedAccount struct {
+	ID   string
+	Name string
+}
+
+// txPool adds transactions to execPool, gorm begins them through
+// ConnPoolBeginner
+type txPool struct {
+	*execPool
+}
+
+func (p txPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return &execTx{p.execPool}, nil
+}
+
+type execTx struct {
+	*execPool
+}
+
+func (*execTx) Commit() error   { return nil }
+func (*execTx) Rollback() error { return nil }
+
+func openInvalidated(t *testing.T, store CacheStore, opts InvalidatorOptions) (*gorm.DB, *CacheInvalidator) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: txPool{&execPool{rows: 1}}}), &gorm.Config{})
+	require.NoError(t, err)
+
+	inv := NewCacheInvalidator(store, nil, opts)
+	inv.Register(cachedAccount{}, func(m interface{}) Invalidation {
+		a := m.(*cachedAccount)
+		return Invalidation{Keys: []string{"account:" + a.ID}, Prefixes: []string{"accounts:"}}
+	})
+	require.NoError(t, db.Use(inv))
+	return db, inv
+}
+
+func seed(t *testing.T, store *cache.Memory, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		require.NoError(t, store.Set(context.Background(), key, "cached"))
+	}
+}
+
+func cached(store *cache.Memory, key string) bool {
+	ok, _ := store.Exists(context.Background(), key)
+	return ok
+}
+
+func TestCacheInvalidatorAfterWrites(t *testing.T) {
+	store := cache.NewMemory()
+	db, _ := openInvalidated(t, store, InvalidatorOptions{RepeatAfter: -1})
+	ctx := context.Background()
+
+	seed(t, store, "account:a1", "account:a2", "accounts:page=1", "other:a1")
+	require.NoError(t, db.WithContext(ctx).Create(&cachedAccount{ID: "a1", Name: "first"}).Error)
+	assert.False(t, cached(store, "account:a1"))
+	assert.False(t, cached(store, "accounts:page=1"), "lists are flushed by prefix")
+	assert.True(t, cached(store, "account:a2"))
+	assert.True(t, cached(store, "other:a1"))
+
+	seed(t, store, "account:a2")
+	require.NoError(t, db.WithContext(ctx).Model(&cachedAccount{ID: "a2"}).Update("name", "second").Error)
+	assert.False(t, cached(store, "account:a2"), "update")
+
+	seed(t, store, "account:a1", "account:a2")
+	require.NoError(t, db.WithContext(ctx).Delete(&[]cachedAccount{{ID: "a1"}, {ID: "a2"}}).Error)
+	assert.False(t, cached(store, "account:a1"), "every row of a batch")
+	assert.False(t, cached(store, "account:a2"))
+}
+
+func TestCacheInvalidatorIgnoresOtherModels(t *testing.T) {
+	store := cache.NewMemory()
+	db, _ := openInvalidated(t, store, InvalidatorOptions{RepeatAfter: -1})
+
+	seed(t, store, "account:7", "accounts:page=1")
+	require.NoError(t, db.Model(&versionedAccount{ID: 7}).Update("name", "x").Error)
+	assert.True(t, cached(store, "account:7"))
+	assert.True(t, cached(store, "accounts:page=1"))
+}
+
+func TestCacheInvalidatorRepeatsAfterTransactions(t *testing.T) {
+	store := cache.NewMemory()
+	clk := clock.NewFake(time.Now())
+	db, inv := openInvalidated(t, store, InvalidatorOptions{RepeatAfter: time.Second, Clock: clk})
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&cachedAccount{ID: "a1"}).Error
+	})
+	require.NoError(t, err)
+
+	// a reader caches the row again before the commit is visible
+	seed(t, store, "account:a1")
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	inv.Wait()
+	assert.False(t, cached(store, "account:a1"), "invalidated again after the commit")
+}
+
+type failingStore struct{}
+
+func (failingStore) Delete(ctx context.Context, keys ...string) (int64, error) {
+	return 0, errors.New("redis down")
+}
+
+func (failingStore) FlushPrefix(ctx context.Context, prefix string) (int64, error) {
+	return 0, errors.New("redis down")
+}
+
+func TestCacheInvalidatorNeverFailsTheWrite(t *testing.T) {
+	db, _ := openInvalidated(t, failingStore{}, InvalidatorOptions{RepeatAfter: -1})
+	assert.NoError(t, db.Create(&cachedAccount{ID: "a1"}).Error)
+}
+
+func TestCacheInvalidatorRecordsWritesInTheSession(t *testing.T) {
+	store := cache.NewMemory()
+	db, _ := openInvalidated(t, store, InvalidatorOptions{RepeatAfter: -1})
+	ctx := consistency.WithSession(context.Background())
+
+	require.NoError(t, db.WithContext(ctx).Create(&cachedAccount{ID: "a1"}).Error)
+
+	// another reader caches the old row before the write is visible to it
+	seed(t, store, "account:a1", "accounts:page=1")
+	var v string
+	assert.True(t, cache.IsMiss(store.Get(ctx, "account:a1", &v)), "the writing request skips the cache")
+	assert.True(t, cache.IsMiss(store.Get(ctx, "accounts:page=1", &v)))
+	assert.NoError(t, store.Get(context.Background(), "account:a1", &v), "other requests still hit")
+	assert.True(t, consistency.Primary(ctx))
+}
+
+// scopeStore records the tenant each key was deleted for
+type scopeStore struct {
+	deleted map[string]string
+	flushed []string
+}
+
+func (s *scopeStore) Delete(ctx context.Context, keys ...string) (int64, error) {
+	tenant, _ := ctxmeta.TenantID(ctx)
+	for _, k := range keys {
+		s.deleted[k] = tenant
+	}
+	return int64(len(keys)), nil
+}
+
+func (s *scopeStore) FlushPrefix(ctx context.Context, prefix string) (int64, error) {
+	s.flushed = append(s.flushed, prefix)
+	return 0, nil
+}
+
+func TestCacheInvalidatorSharedKeys(t *testing.T) {
+	store := &scopeStore{deleted: map[string]string{}}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: &execPool{rows: 1}}), &gorm.Config{})
+	require.NoError(t, err)
+	inv := NewCacheInvalidator(store, nil, InvalidatorOptions{RepeatAfter: -1})
+	inv.Register(cachedAccount{}, func(m interface{}) Invalidation {
+		a := m.(*cachedAccount)
+		return Invalidation{Keys: []string{"mine:" + a.ID}, Shared: []string{"account:" + a.ID}}
+	})
+	require.NoError(t, db.Use(inv))
+
+	ctx := ctxmeta.WithTenantID(consistency.WithSession(context.Background()), "acme")
+	require.NoError(t, db.WithContext(ctx).Create(&cachedAccount{ID: "a1"}).Error)
+	assert.Equal(t, map[string]string{"mine:a1": "acme", "account:a1": ""}, store.deleted,
+		"shared keys outside the writer's scope")
+	assert.Empty(t, store.flushed, "no keyspace scan")
+	assert.True(t, consistency.Stale(ctx, "account:a1"))
+}
@@ -0,0 +1,70 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Row locking scopes, use them inside a transaction where the lock is held
+// until commit:
+//
+//	tx.Scopes(db.ForUpdate).First(&order, id)
+//
+// NOWAIT fails with lock_not_available instead of waiting, errors.Retry
+// counts that as a conflict worth another attempt.
+
+// ForUpdate locks the selected rows against updates and other FOR UPDATE
+func ForUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate})
+}
+
+// ForUpdateNoWait is ForUpdate failing right away on a locked row
+func ForUpdateNoWait(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsNoWait})
+}
+
+// ForUpdateSkipLocked is ForUpdate leaving out rows someone else holds,
+// so concurrent workers each get different rows
+func ForUpdateSkipLocked(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked})
+}
+
+// ForShare lets other readers lock the rows too but blocks their updates
+func ForShare(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: clause.LockingStrengthShare})
+}
+
+// ClaimNext locks up to n rows matched by scope into dest, a pointer to a
+// slice of models, and calls claim in the same transaction to mark them
+// taken, e.g. set a status or owner. Rows locked by another claimer are
+// skipped, so workers polling the same table never get the same row. claim
+// is not called when nothing is left, dest is empty then.
+//
+//	var jobs []Job
+//	err := db.ClaimNext(ctx, pg.DB, &jobs, 10,
+//		func(q *gorm.DB) *gorm.DB { return q.Where("status = ?", "pending").Order("id") },
+//		func(tx *gorm.DB) error { return tx.Model(&jobs).Update("status", "running").Error })
+func ClaimNext(ctx context.Context, db *gorm.DB, dest interface{}, n int, scope func(*gorm.DB) *gorm.DB, claim func(tx *gorm.DB) error) error {
+	if n <= 0 {
+		return fmt.Errorf("claim next: n must be positive, got %d", n)
+	}
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		q := tx.Scopes(ForUpdateSkipLocked).Limit(n)
+		if scope != nil {
+			q = q.Scopes(scope)
+		}
+		res := q.Find(dest)
+		if res.Error != nil {
+			return fmt.Errorf("claim next: %w", res.Error)
+		}
+		if res.RowsAffected == 0 || claim == nil {
+			return nil
+		}
+		return claim(tx)
+	})
+}
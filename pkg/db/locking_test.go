@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"blueprint/config"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type claimJob struct {
+	ID     int64
+	Status string
+	Worker int
+}
+
+func TestLockingScopes(t *testing.T) {
+	db := openExecPool(t, &execPool{}).Session(&gorm.Session{DryRun: true})
+	const query = `SELECT * FROM "claim_jobs" WHERE "claim_jobs"."id" = $1 ORDER BY "claim_jobs"."id" LIMIT $2 `
+
+	for _, tt := range []struct {
+		scope func(*gorm.DB) *gorm.DB
+		lock  string
+	}{
+		{ForUpdate, "FOR UPDATE"},
+		{ForUpdateNoWait, "FOR UPDATE NOWAIT"},
+		{ForUpdateSkipLocked, "FOR UPDATE SKIP LOCKED"},
+		{ForShare, "FOR SHARE"},
+	} {
+		var job claimJob
+		stmt := db.Scopes(tt.scope).First(&job, 7).Statement
+		assert.Equal(t, query+tt.lock, stmt.SQL.String())
+	}
+}
+
+func TestClaimNextNeedsPositiveN(t *testing.T) {
+	var jobs []claimJob
+	assert.Error(t, ClaimNext(context.Background(), openExecPool(t, &execPool{}), &jobs, 0, nil, nil))
+}
+
+func TestClaimNextConcurrentWorkers(t *testing.T) {
+	cfg := &config.Config{Postgres: testsupport.Postgres(t)}
+	pg, err := NewPostgresDB(cfg, nil)
+	require.NoError(t, err)
+	defer pg.Close()
+
+	ctx := context.Background()
+	require.NoError(t, pg.DB.Migrator().DropTable(&claimJob{}))
+	require.NoError(t, pg.DB.AutoMigrate(&claimJob{}))
+	for i := 1; i <= 20; i++ {
+		require.NoError(t, pg.DB.Create(&claimJob{ID: int64(i), Status: "pending"}).Error)
+	}
+
+	pending := func(q *gorm.DB) *gorm.DB { return q.Where("status = ?", "pending").Order("id") }
+
+	var wg sync.WaitGroup
+	for worker := 1; worker <= 4; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for {
+				var jobs []claimJob
+				err := ClaimNext(ctx, pg.DB, &jobs, 3, pending, func(tx *gorm.DB) error {
+					return tx.Model(&jobs).Updates(map[string]interface{}{"status": "running", "worker": worker}).Error
+				})
+				if !assert.NoError(t, err) || len(jobs) == 0 {
+					return
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	var jobs []claimJob
+	require.NoError(t, pg.DB.Order("id").Find(&jobs).Error)
+	require.Len(t, jobs, 20)
+	for _, job := range jobs {
+		assert.Equal(t, "running", job.Status, "job %d claimed once", job.ID)
+		assert.NotZero(t, job.Worker)
+	}
+
+	var none []claimJob
+	called := false
+	require.NoError(t, ClaimNext(ctx, pg.DB, &none, 3, pending, func(tx *gorm.DB) error {
+		called = true
+		return nil
+	}))
+	assert.Empty(t, none)
+	assert.False(t, called, "claim only runs when rows were found")
+}
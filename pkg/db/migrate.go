@@ -0,0 +1,61 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"fmt"
+
+	model "blueprint/model/blueprint"
+	other "blueprint/model/other"
+
+	"gorm.io/gorm"
+)
+
+// Models are the tables Migrate creates and MigrationStatus checks, a new
+// model goes here
+var Models = []interface{}{
+	&model.MyModel{},
+	&model.SagaInstance{},
+	&model.ProjectionPosition{},
+	&model.ProjectionEvent{},
+	&model.Setting{},
+	&other.Account{},
+}
+
+// TableStatus is how far the table of one model is migrated
+type TableStatus struct {
+	Table          string   `json:"table"`
+	Exists         bool     `json:"exists"`
+	MissingColumns []string `json:"missing_columns,omitempty"`
+}
+
+// Migrated reports whether the table has every column of its model
+func (t TableStatus) Migrated() bool {
+	return t.Exists && len(t.MissingColumns) == 0
+}
+
+// MigrationStatus compares Models with the database without changing it.
+// gorm's migrator takes a failed lookup for a missing table, check the
+// connection first.
+func MigrationStatus(ctx context.Context, db *gorm.DB) ([]TableStatus, error) {
+	db = db.WithContext(ctx)
+	migrator := db.Migrator()
+
+	out := make([]TableStatus, 0, len(Models))
+	for _, m := range Models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return nil, fmt.Errorf("parsing %T: %w", m, err)
+		}
+		status := TableStatus{Table: stmt.Schema.Table, Exists: migrator.HasTable(m)}
+		if status.Exists {
+			for _, f := range stmt.Schema.Fields {
+				if f.DBName != "" && !migrator.HasColumn(m, f.DBName) {
+					status.MissingColumns = append(status.MissingColumns, f.DBName)
+				}
+			}
+		}
+		out = append(out, status)
+	}
+	return out, nil
+}
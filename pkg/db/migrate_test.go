@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"blueprint/config"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationStatus(t *testing.T) {
+	cfg := &config.Config{Postgres: testsupport.Postgres(t)}
+	pg, err := NewPostgresDB(cfg, nil)
+	require.NoError(t, err)
+	defer pg.Close()
+	ctx := context.Background()
+
+	require.NoError(t, Migrate(cfg))
+	status, err := MigrationStatus(ctx, pg.DB)
+	require.NoError(t, err)
+	require.Len(t, status, len(Models))
+	for _, s := range status {
+		assert.True(t, s.Migrated(), s.Table)
+	}
+
+	require.NoError(t, pg.DB.Exec("ALTER TABLE platform_saga_instance DROP COLUMN lease_until").Error)
+	require.NoError(t, pg.DB.Exec("DROP TABLE platform_projection_event").Error)
+	t.Cleanup(func() { Migrate(cfg) })
+
+	status, err = MigrationStatus(ctx, pg.DB)
+	require.NoError(t, err)
+	byTable := map[string]TableStatus{}
+	for _, s := range status {
+		byTable[s.Table] = s
+	}
+	assert.Equal(t, []string{"lease_until"}, byTable["platform_saga_instance"].MissingColumns)
+	assert.False(t, byTable["platform_projection_event"].Exists)
+	assert.False(t, byTable["platform_projection_event"].Migrated())
+}
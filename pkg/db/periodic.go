@@ -0,0 +1,110 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+)
+
+// LockFunc takes a run lock, ok false when another replica has it
+type LockFunc func(ctx context.Context) (unlock func(), ok bool, err error)
+
+// AdvisoryLocker is a LockFunc taking the session advisory lock name, the
+// lock of jobs that only one replica may run at a time
+func AdvisoryLocker(sqlDB *sql.DB, name string) LockFunc {
+	return func(ctx context.Context) (func(), bool, error) {
+		l, ok, err := TryAdvisoryLock(ctx, sqlDB, name)
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		return func() { l.Unlock(context.Background()) }, true, nil
+	}
+}
+
+type PeriodicOptions struct {
+	// Name labels the supervised loop and its failures in the log
+	Name     string
+	Interval time.Duration
+	// Lock is taken around every run, nil runs without one
+	Lock  LockFunc
+	Clock clock.Clock
+}
+
+// Periodic runs work every Interval until Stop, under Lock so only one
+// replica does at a time; the others skip the run. A failed run is logged
+// and tried again on the next tick.
+type Periodic struct {
+	log  *logger.Logger
+	opts PeriodicOptions
+	work func(ctx context.Context) error
+
+	cancel context.CancelFunc
+	group  *run.Group
+}
+
+// NewPeriodic needs opts.Interval above 0
+func NewPeriodic(log *logger.Logger, opts PeriodicOptions, work func(ctx context.Context) error) *Periodic {
+	opts.Clock = clock.Or(opts.Clock)
+	return &Periodic{log: log, opts: opts, work: work}
+}
+
+// Start runs the work every Interval in the background until Stop
+func (p *Periodic) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	p.group = run.NewGroup(ctx, p.log)
+	p.group.Supervise(p.opts.Name, p.loop, run.Options{Clock: p.opts.Clock})
+}
+
+// Stop cancels a running work and waits for it
+func (p *Periodic) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	if p.group != nil {
+		p.group.Wait()
+	}
+}
+
+func (p *Periodic) loop(ctx context.Context) error {
+	ticker := p.opts.Clock.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			p.Run(ctx)
+		}
+	}
+}
+
+// Run is RunOnce logging the failure instead of returning it
+func (p *Periodic) Run(ctx context.Context) {
+	if err := p.RunOnce(ctx); err != nil && ctx.Err() == nil && p.log != nil {
+		p.log.Warnf("%s run failed: %v", p.opts.Name, err)
+	}
+}
+
+// RunOnce takes the lock and runs the work, a run skipped for another
+// replica holding the lock is no error
+func (p *Periodic) RunOnce(ctx context.Context) error {
+	if p.opts.Lock != nil {
+		unlock, ok, err := p.opts.Lock(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		defer unlock()
+	}
+	return p.work(ctx)
+}
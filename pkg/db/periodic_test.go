@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriodicRunOnceTakesLock(t *testing.T) {
+	var runs, unlocks int
+	held := true
+	p := NewPeriodic(nil, PeriodicOptions{Name: "test", Interval: time.Minute, Lock: func(ctx context.Context) (func(), bool, error) {
+		if held {
+			return nil, false, nil
+		}
+		return func() { unlocks++ }, true, nil
+	}}, func(ctx context.Context) error {
+		runs++
+		return errors.New("boom")
+	})
+
+	require.NoError(t, p.RunOnce(context.Background()), "another replica holds the lock")
+	assert.Zero(t, runs)
+
+	held = false
+	assert.EqualError(t, p.RunOnce(context.Background()), "boom")
+	assert.Equal(t, 1, runs)
+	assert.Equal(t, 1, unlocks, "released after a failed run too")
+}
+
+func TestPeriodicStartRunsEveryInterval(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	var runs atomic.Int32
+	p := NewPeriodic(nil, PeriodicOptions{Name: "test", Interval: time.Minute, Clock: clk}, func(ctx context.Context) error {
+		runs.Add(1)
+		return errors.New("failed runs keep the loop going")
+	})
+	p.Start()
+	defer p.Stop()
+
+	for want := int32(1); want <= 2; want++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+		assert.Eventually(t, func() bool { return runs.Load() == want }, time.Second, time.Millisecond)
+	}
+}
@@ -3,12 +3,16 @@ package db
 
 import (
 	"blueprint/config"
-	model "blueprint/model/blueprint"
+	applog "blueprint/pkg/logger"
+	"blueprint/pkg/pooltune"
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -20,12 +24,23 @@ const (
 	maxOpenConns    = 100
 	connMaxLifetime = time.Hour
 	connMaxIdleTime = time.Minute * 10
+
+	credentialsRefresh = time.Minute
+
+	stmtCacheSize = 1000
+	stmtCacheTTL  = time.Hour
 )
 
 type PostgresDB struct {
-	DB     *gorm.DB
-	sqlDB  *sql.DB
-	config *config.Config
+	DB      *gorm.DB
+	sqlDB   *sql.DB
+	config  *config.Config
+	tuner   *pooltune.Tuner
+	rotator *rotator
+	slowLog *slowQueryLogger
+	stmts   *stmtCache
+	log     *applog.Logger
+	explain bool
 }
 
 type DBOptions struct {
@@ -34,29 +49,112 @@ type DBOptions struct {
 	ConnMaxLifetime time.Duration
 	ConnMaxIdleTime time.Duration
 	LogLevel        logger.LogLevel
+	// MaxOpenConnsTuned above 0 moves MaxOpenConns between
+	// MinOpenConnsTuned and it, growing while queries wait for a connection
+	MinOpenConnsTuned int
+	MaxOpenConnsTuned int
+	// Credentials log in every new connection, nil uses the static
+	// PostgresUser/PostgresPassword. Any other provider is checked every
+	// CredentialsRefresh and the pool recycled when they change.
+	Credentials        CredentialProvider
+	CredentialsRefresh time.Duration
+	// SlowThreshold logs queries that take at least this long to Logger,
+	// with their plan when ExplainSlow is set. 0 disables.
+	SlowThreshold time.Duration
+	ExplainSlow   bool
+	// StmtCacheSize caps the prepared statements kept, the least recently
+	// used is closed for a new one. Statements unused for StmtCacheTTL are
+	// closed too.
+	StmtCacheSize int
+	StmtCacheTTL  time.Duration
+	// QueryComment is CommentRoute or CommentTrace to tag every statement
+	// with the call that ran it, see RequestTags. CommentTrace turns the
+	// statement cache off, every call's SQL is distinct.
+	QueryComment string
+	// Logger receives pool size changes and credential rotations
+	Logger *applog.Logger
+}
+
+func NewPostgresDB(cfg *config.Config, log *applog.Logger) (*PostgresDB, error) {
+	opts, err := OptionsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts.Logger = log
+	return NewPostgresDBWithOptions(cfg, opts)
+}
+
+// OptionsFromConfig is what NewPostgresDB connects with, for callers that
+// change some of it
+func OptionsFromConfig(cfg *config.Config) (DBOptions, error) {
+	opts := buildOptions(cfg)
+	creds, err := NewCredentialProvider(cfg)
+	if err != nil {
+		return DBOptions{}, err
+	}
+	opts.Credentials = creds
+	return opts, nil
 }
 
-func NewPostgresDB(cfg *config.Config) (*PostgresDB, error) {
-	return NewPostgresDBWithOptions(cfg, DBOptions{
-		MaxIdleConns:    maxIdleConns,
-		MaxOpenConns:    maxOpenConns,
-		ConnMaxLifetime: connMaxLifetime,
-		ConnMaxIdleTime: connMaxIdleTime,
+// buildOptions takes the pool settings from config, zero keeps the defaults
+func buildOptions(cfg *config.Config) DBOptions {
+	opts := DBOptions{
+		MaxIdleConns:    cfg.Postgres.MaxIdleConns,
+		MaxOpenConns:    cfg.Postgres.MaxOpenConns,
+		ConnMaxLifetime: cfg.Postgres.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.Postgres.ConnMaxIdleTime,
 		LogLevel:        logger.Error,
-	})
+
+		MinOpenConnsTuned: cfg.Postgres.MinOpenConnsTuned,
+		MaxOpenConnsTuned: cfg.Postgres.MaxOpenConnsTuned,
+
+		CredentialsRefresh: cfg.Postgres.CredentialsRefresh,
+
+		SlowThreshold: cfg.Postgres.SlowThreshold,
+		ExplainSlow:   cfg.Postgres.ExplainSlow,
+
+		StmtCacheSize: cfg.Postgres.StmtCacheSize,
+		StmtCacheTTL:  cfg.Postgres.StmtCacheTTL,
+
+		QueryComment: cfg.Postgres.QueryComment,
+	}
+
+	if opts.MaxIdleConns == 0 {
+		opts.MaxIdleConns = maxIdleConns
+	}
+
+	if opts.MaxOpenConns == 0 {
+		opts.MaxOpenConns = maxOpenConns
+	}
+
+	if opts.ConnMaxLifetime == 0 {
+		opts.ConnMaxLifetime = connMaxLifetime
+	}
+
+	if opts.ConnMaxIdleTime == 0 {
+		opts.ConnMaxIdleTime = connMaxIdleTime
+	}
+
+	if opts.CredentialsRefresh == 0 {
+		opts.CredentialsRefresh = credentialsRefresh
+	}
+
+	if opts.StmtCacheSize == 0 {
+		opts.StmtCacheSize = stmtCacheSize
+	}
+
+	if opts.StmtCacheTTL == 0 {
+		opts.StmtCacheTTL = stmtCacheTTL
+	}
+
+	return opts
 }
 
 func NewPostgresDBWithOptions(cfg *config.Config, opts DBOptions) (*PostgresDB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=UTC",
-		cfg.Postgres.PostgresHost,
-		cfg.Postgres.PostgresUser,
-		cfg.Postgres.PostgresPassword,
-		cfg.Postgres.PostgresDBName,
-		cfg.Postgres.PostgresPort,
-	)
-
 	gormConfig := &gorm.Config{
 		PrepareStmt:                              true,
+		PrepareStmtMaxSize:                       opts.StmtCacheSize,
+		PrepareStmtTTL:                           opts.StmtCacheTTL,
 		DisableForeignKeyConstraintWhenMigrating: true,
 		QueryFields:                              true,
 		Logger:                                   logger.Default.LogMode(opts.LogLevel),
@@ -70,14 +168,59 @@ func NewPostgresDBWithOptions(cfg *config.Config, opts DBOptions) (*PostgresDB,
 		},
 	}
 
-	db, err := gorm.Open(postgres.Open(dsn), gormConfig)
+	provider := opts.Credentials
+	if provider == nil {
+		provider = StaticCredentials{User: cfg.Postgres.PostgresUser, Password: cfg.Postgres.PostgresPassword}
+	}
+
+	connConfig, err := pgx.ParseConfig(dsn(cfg.Postgres))
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+		return nil, fmt.Errorf("invalid database settings: %w", err)
+	}
+	connConfig.RuntimeParams["application_name"] = applicationName(cfg)
+	if opts.QueryComment == CommentTrace {
+		// SQL seen once is not worth preparing, send it in one round trip
+		gormConfig.PrepareStmt = false
+		connConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	}
+	// every new connection logs in with whatever the provider has now
+	sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(ctx context.Context, cc *pgx.ConnConfig) error {
+		creds, err := provider.Credentials(ctx)
+		if err != nil {
+			return fmt.Errorf("database credentials: %w", err)
+		}
+		cc.User, cc.Password = creds.User, creds.Password
+		return nil
+	}))
+
+	var slowLog *slowQueryLogger
+	if opts.SlowThreshold > 0 && opts.Logger != nil {
+		var explain explainFunc
+		if opts.ExplainSlow {
+			explain = explainDB(sqlDB)
+		}
+		slowLog = newSlowQueryLogger(gormConfig.Logger, opts.Logger, opts.SlowThreshold, explain)
+		gormConfig.Logger = slowLog
 	}
 
-	sqlDB, err := db.DB()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), gormConfig)
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	// per call query budgets, a no-op for queries outside a call
+	if err := db.Use(QueryCounter{}); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("installing query counter: %w", err)
+	}
+	if err := db.Use(RequestTags{Comment: opts.QueryComment}); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("installing request tags: %w", err)
+	}
+	stmts, err := newStmtCache(db, opts.StmtCacheSize)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get underlying SQL database: %w", err)
+		sqlDB.Close()
+		return nil, fmt.Errorf("installing statement cache stats: %w", err)
 	}
 
 	sqlDB.SetMaxIdleConns(opts.MaxIdleConns)
@@ -86,18 +229,97 @@ func NewPostgresDBWithOptions(cfg *config.Config, opts DBOptions) (*PostgresDB,
 	sqlDB.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
 
 	postgresDB := &PostgresDB{
-		DB:     db,
-		sqlDB:  sqlDB,
-		config: cfg,
+		DB:      db,
+		sqlDB:   sqlDB,
+		config:  cfg,
+		slowLog: slowLog,
+		stmts:   stmts,
+		log:     opts.Logger,
+		explain: opts.ExplainSlow,
 	}
 
 	if err := postgresDB.Ping(context.Background()); err != nil {
+		sqlDB.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
+	if _, static := provider.(StaticCredentials); !static {
+		postgresDB.rotator = newRotator(provider, sqlDB, opts.MaxIdleConns, opts.CredentialsRefresh, opts.Logger)
+		if err := postgresDB.rotator.Start(context.Background()); err != nil {
+			sqlDB.Close()
+			return nil, fmt.Errorf("database credentials: %w", err)
+		}
+	}
+
+	if opts.MaxOpenConnsTuned > 0 {
+		postgresDB.tuner = pooltune.New(sqlPool{sqlDB}, pooltune.Options{
+			Name:   "postgres",
+			Min:    opts.MinOpenConnsTuned,
+			Max:    opts.MaxOpenConnsTuned,
+			Logger: opts.Logger,
+		})
+		postgresDB.tuner.Start()
+	}
+
 	return postgresDB, nil
 }
 
+// dsn is the key=value connection string for pg, TLS off unless SSLMode
+// says otherwise
+func dsn(pg config.Postgres) string {
+	sslMode := pg.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	params := [][2]string{
+		{"host", pg.PostgresHost},
+		{"user", pg.PostgresUser},
+		{"password", pg.PostgresPassword},
+		{"dbname", pg.PostgresDBName},
+		{"port", pg.PostgresPort},
+		{"sslmode", sslMode},
+		{"sslrootcert", pg.SSLRootCert},
+		{"sslcert", pg.SSLCert},
+		{"sslkey", pg.SSLKey},
+		{"sslpassword", pg.SSLKeyPassword},
+		{"TimeZone", "UTC"},
+	}
+
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		if p[1] == "" && strings.HasPrefix(p[0], "ssl") {
+			continue
+		}
+		parts = append(parts, p[0]+"="+quoteDSN(p[1]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSN quotes values libpq would otherwise split, like a password
+// with a space or a quote in it
+func quoteDSN(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\n'\\") {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// sqlPool lets the tuner move max open conns, database/sql applies it to
+// the live pool and closes surplus connections as they are released
+type sqlPool struct {
+	db *sql.DB
+}
+
+func (p sqlPool) Stats() pooltune.Stats {
+	s := p.db.Stats()
+	return pooltune.Stats{Size: s.MaxOpenConnections, InUse: s.InUse, WaitCount: s.WaitCount}
+}
+
+func (p sqlPool) Resize(size int) {
+	p.db.SetMaxOpenConns(size)
+}
+
 func (m *PostgresDB) Ping(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
@@ -106,6 +328,15 @@ func (m *PostgresDB) Ping(ctx context.Context) error {
 }
 
 func (m *PostgresDB) Close() error {
+	if m.tuner != nil {
+		m.tuner.Stop()
+	}
+	if m.rotator != nil {
+		m.rotator.Stop()
+	}
+	if m.slowLog != nil {
+		m.slowLog.wait()
+	}
 	if m.sqlDB != nil {
 		return m.sqlDB.Close()
 	}
@@ -119,6 +350,23 @@ func (m *PostgresDB) Stats() sql.DBStats {
 	return sql.DBStats{}
 }
 
+// StmtCacheStats reports on gorm's prepared statement cache
+func (m *PostgresDB) StmtCacheStats() StmtCacheStats {
+	if m.stmts == nil {
+		return StmtCacheStats{}
+	}
+	return m.stmts.Stats()
+}
+
+// FlushStmtCache closes all cached prepared statements and returns how
+// many there were, e.g. after a migration changed the tables they use
+func (m *PostgresDB) FlushStmtCache() int {
+	if m.stmts == nil {
+		return 0
+	}
+	return m.stmts.Flush()
+}
+
 func (m *PostgresDB) BeginTx(ctx context.Context, opts *sql.TxOptions) *gorm.DB {
 	return m.DB.WithContext(ctx).Begin(opts)
 }
@@ -144,22 +392,34 @@ func (m *PostgresDB) HealthCheck(ctx context.Context) error {
 }
 
 func Migrate(cfg *config.Config) error {
-	db, err := NewPostgresDB(cfg)
+	db, err := NewPostgresDB(cfg, nil)
 	if err != nil {
 		return fmt.Errorf("failed to connect for migration: %w", err)
 	}
 	defer db.Close()
 
-	if err := db.DB.AutoMigrate(&model.MyModel{}); err != nil {
+	if err := db.DB.AutoMigrate(Models...); err != nil {
 		return fmt.Errorf("failed to auto-migrate: %w", err)
 	}
 
 	return nil
 }
 
+// EnableSlowQueryLog logs queries slower than threshold, with their plan
+// when the DB was opened with ExplainSlow. It needs a logger.
 func (m *PostgresDB) EnableSlowQueryLog(threshold time.Duration) {
-	m.DB.Config.Logger = m.DB.Config.Logger.LogMode(logger.Info)
+	var explain explainFunc
+	if m.explain {
+		explain = explainDB(m.sqlDB)
+	}
+
+	slowLog := newSlowQueryLogger(m.DB.Config.Logger, m.log, threshold, explain)
+	if m.slowLog != nil {
+		slowLog.Interface = m.slowLog.Interface
+		slowLog.slots, slowLog.wg = m.slowLog.slots, m.slowLog.wg
+	}
+	m.slowLog = slowLog
 	m.DB = m.DB.Session(&gorm.Session{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: slowLog,
 	})
 }
\ No newline at end of file
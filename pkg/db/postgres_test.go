@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/testsupport"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresConnect(t *testing.T) {
+	cfg := &config.Config{Postgres: testsupport.Postgres(t)}
+
+	pg, err := NewPostgresDB(cfg, nil)
+	require.NoError(t, err)
+	defer pg.Close()
+
+	ctx := context.Background()
+	require.NoError(t, pg.Ping(ctx))
+
+	var one int
+	require.NoError(t, pg.WithContext(ctx).Raw("SELECT 1").Scan(&one).Error)
+	assert.Equal(t, 1, one)
+}
+
+func TestDSN(t *testing.T) {
+	pg := config.Postgres{
+		PostgresHost:     "db",
+		PostgresPort:     "5432",
+		PostgresUser:     "app",
+		PostgresPassword: `it's a "secret"`,
+		PostgresDBName:   "platform",
+	}
+	assert.Equal(t, `host=db user=app password='it\'s a "secret"' dbname=platform port=5432 sslmode=disable TimeZone=UTC`, dsn(pg))
+
+	parsed, err := pgconn.ParseConfig(dsn(pg))
+	require.NoError(t, err)
+	assert.Equal(t, pg.PostgresPassword, parsed.Password)
+	assert.Nil(t, parsed.TLSConfig, "no TLS by default")
+}
+
+func TestDSNTLS(t *testing.T) {
+	ca := writeCA(t)
+	pg := config.Postgres{
+		PostgresHost:     "db.internal",
+		PostgresPort:     "5432",
+		PostgresUser:     "app",
+		PostgresPassword: "secret",
+		PostgresDBName:   "platform",
+		SSLMode:          "require",
+	}
+
+	parsed, err := pgconn.ParseConfig(dsn(pg))
+	require.NoError(t, err)
+	require.NotNil(t, parsed.TLSConfig)
+	assert.True(t, parsed.TLSConfig.InsecureSkipVerify, "require encrypts without verifying")
+
+	pg.SSLMode = "verify-full"
+	pg.SSLRootCert = ca
+	parsed, err = pgconn.ParseConfig(dsn(pg))
+	require.NoError(t, err)
+	require.NotNil(t, parsed.TLSConfig)
+	assert.False(t, parsed.TLSConfig.InsecureSkipVerify)
+	assert.Equal(t, "db.internal", parsed.TLSConfig.ServerName)
+	assert.NotNil(t, parsed.TLSConfig.RootCAs)
+
+	pg.SSLRootCert = filepath.Join(t.TempDir(), "missing.pem")
+	_, err = pgconn.ParseConfig(dsn(pg))
+	assert.Error(t, err, "a missing CA bundle fails before connecting")
+}
+
+func TestPostgresRequireTLS(t *testing.T) {
+	pg := testsupport.Postgres(t)
+	if pg.SSLMode != "" && pg.SSLMode != "disable" {
+		t.Skip("test database already uses TLS")
+	}
+
+	// the test container does not offer TLS, so insisting on it must fail
+	pg.SSLMode = "require"
+	_, err := NewPostgresDB(&config.Config{Postgres: pg}, nil)
+	assert.Error(t, err)
+}
+
+// writeCA writes a self-signed CA certificate and returns its path
+func writeCA(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return path
+}
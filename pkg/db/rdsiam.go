@@ -0,0 +1,90 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+)
+
+// RDS accepts an auth token for 15 minutes, it is only checked when a
+// connection logs in
+const (
+	rdsTokenExpiry = 15 * time.Minute
+	rdsTokenReuse  = 10 * time.Minute
+)
+
+// RDSIAMOptions for IAM database authentication. Endpoint is the instance
+// "host:port", User a database user granted rds_iam. AWS signs the tokens,
+// nil loads the AWS SDK default credential chain on the first token, with
+// Region from the SDK's config when empty.
+type RDSIAMOptions struct {
+	Endpoint string
+	Region   string
+	User     string
+	AWS      aws.CredentialsProvider
+	Clock    clock.Clock
+}
+
+// RDSIAMCredentials use short lived IAM auth tokens as the password, RDS
+// only takes them over TLS so set Postgres.SSLMode as well
+type RDSIAMCredentials struct {
+	opts RDSIAMOptions
+
+	mu      sync.Mutex
+	creds   Credentials
+	created time.Time
+}
+
+func NewRDSIAMCredentials(opts RDSIAMOptions) *RDSIAMCredentials {
+	opts.Clock = clock.Or(opts.Clock)
+	return &RDSIAMCredentials{opts: opts}
+}
+
+// LoginTokens is true, RDS checks the token when a connection logs in and
+// never after
+func (r *RDSIAMCredentials) LoginTokens() bool {
+	return true
+}
+
+func (r *RDSIAMCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.opts.Clock.Now()
+	if r.creds.Password != "" && now.Sub(r.created) < rdsTokenReuse {
+		return r.creds, nil
+	}
+
+	if r.opts.AWS == nil {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(r.opts.Region))
+		if err != nil {
+			return Credentials{}, fmt.Errorf("loading AWS config: %w", err)
+		}
+		r.opts.AWS = cfg.Credentials
+		r.opts.Region = cfg.Region
+	}
+	if r.opts.Region == "" {
+		return Credentials{}, fmt.Errorf("RDS IAM auth needs a region")
+	}
+
+	token, err := auth.BuildAuthToken(ctx, r.opts.Endpoint, r.opts.Region, r.opts.User, r.opts.AWS)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("RDS auth token: %w", err)
+	}
+
+	r.creds = Credentials{
+		User:      r.opts.User,
+		Password:  token,
+		ExpiresAt: now.Add(rdsTokenExpiry),
+	}
+	r.created = now
+	return r.creds, nil
+}
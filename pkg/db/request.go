@@ -0,0 +1,219 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"blueprint/config"
+	model "blueprint/model/blueprint"
+	"blueprint/pkg/buildinfo"
+	"blueprint/pkg/ctxmeta"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const requestTagsName = "blueprint:request_tags"
+
+// Query comment modes, see RequestTags
+const (
+	CommentOff   = "off"
+	CommentRoute = "route"
+	CommentTrace = "trace"
+)
+
+var requestStampType = reflect.TypeOf(model.RequestStamp{})
+
+// RequestTags is a gorm plugin writing the ctxmeta of a statement's
+// context into the database. Models embedding model.RequestStamp get it
+// set on create and update.
+//
+// With a Comment mode every statement carries a sqlcommenter comment, so
+// pg_stat_activity, the slow query log and auto_explain tie a query to
+// the RPC and trace that ran it:
+//
+//	/*application='blueprint',route='%2Fblueprint.Blueprint%2FCall'*/ SELECT ...
+//
+// CommentRoute stops there, the text is the same for every call of a
+// method and pg_stat_statements, which keeps the first text it saw of a
+// query, shows which RPC runs it. CommentTrace adds request_id, trace_id
+// (traceparent inside an OpenTelemetry span), tenant_id, user_id and
+// client_version. The comment leads the statement like gorm's
+// hints.CommentBefore, gorm builds and runs SQL in one step.
+//
+// NewPostgresDB installs it, outside a call it does nothing.
+type RequestTags struct {
+	Comment string
+}
+
+func (RequestTags) Name() string {
+	return requestTagsName
+}
+
+func (t RequestTags) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register(requestTagsName+":stamp_create", stampRequest); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register(requestTagsName+":stamp_update", stampRequest); err != nil {
+		return err
+	}
+	if t.Comment != CommentRoute && t.Comment != CommentTrace {
+		return nil
+	}
+
+	if err := cb.Create().Before("*").Register(requestTagsName+":create", t.commentStatement("INSERT")); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("*").Register(requestTagsName+":query", t.commentStatement("SELECT")); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("*").Register(requestTagsName+":update", t.commentStatement("UPDATE")); err != nil {
+		return err
+	}
+	// a soft delete is built as an UPDATE
+	if err := cb.Delete().Before("*").Register(requestTagsName+":delete", t.commentStatement("DELETE", "UPDATE")); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("*").Register(requestTagsName+":row", t.commentStatement("SELECT")); err != nil {
+		return err
+	}
+	return cb.Raw().Before("*").Register(requestTagsName+":raw", t.commentStatement())
+}
+
+// stampRequest sets the RequestStamp of the rows written, every row of a
+// batch
+func stampRequest(db *gorm.DB) {
+	if db.Error != nil || !stamped(db.Statement.Schema) {
+		return
+	}
+	m := ctxmeta.FromContext(db.Statement.Context)
+	for _, f := range [...]struct{ name, value string }{
+		{"RequestID", m.RequestID},
+		{"RequestUserID", m.UserID},
+		{"RequestTenantID", m.TenantID},
+		{"RequestClientVersion", m.ClientVersion},
+	} {
+		if f.value != "" {
+			db.Statement.SetColumn(f.name, f.value, true)
+		}
+	}
+}
+
+func stamped(s *schema.Schema) bool {
+	if s == nil {
+		return false
+	}
+	f, ok := s.ModelType.FieldByName("RequestStamp")
+	return ok && f.Anonymous && f.Type == requestStampType
+}
+
+// commentStatement prefixes the SQL with the request comment, the clauses
+// named are where gorm will build it, raw SQL is already written
+func (t RequestTags) commentStatement(clauses ...string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil {
+			return
+		}
+		comment := requestComment(db.Statement.Context, t.Comment == CommentTrace)
+		if comment == "" {
+			return
+		}
+
+		if db.Statement.SQL.Len() > 0 {
+			sql := db.Statement.SQL.String()
+			db.Statement.SQL.Reset()
+			db.Statement.SQL.WriteString(string(comment))
+			db.Statement.SQL.WriteByte(' ')
+			db.Statement.SQL.WriteString(sql)
+			return
+		}
+		for _, name := range clauses {
+			c := db.Statement.Clauses[name]
+			c.BeforeExpression = comment
+			db.Statement.Clauses[name] = c
+		}
+	}
+}
+
+// sqlComment is written as it is, requestComment escapes the values so it
+// holds no placeholder and cannot end early
+type sqlComment string
+
+func (c sqlComment) Build(b clause.Builder) {
+	b.WriteString(string(c))
+}
+
+// requestComment is the sqlcommenter comment of the call in ctx, the
+// per call values only with trace. Empty outside a call.
+func requestComment(ctx context.Context, trace bool) sqlComment {
+	m := ctxmeta.FromContext(ctx)
+	if m.Method == "" && m.RequestID == "" {
+		return ""
+	}
+
+	tags := map[string]string{
+		"application": "blueprint",
+		"route":       m.Method,
+	}
+	if trace {
+		tags["request_id"] = m.RequestID
+		tags["tenant_id"] = m.TenantID
+		tags["user_id"] = m.UserID
+		tags["client_version"] = m.ClientVersion
+		if span := oteltrace.SpanContextFromContext(ctx); span.IsValid() {
+			tags["traceparent"] = traceParent(span)
+		} else if m.TraceID != m.RequestID {
+			tags["trace_id"] = m.TraceID
+		}
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("/*")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString("='")
+		b.WriteString(commentEscape(tags[k]))
+		b.WriteByte('\'')
+	}
+	b.WriteString("*/")
+	return sqlComment(b.String())
+}
+
+// commentEscape URL encodes v as sqlcommenter wants it, spaces as %20
+func commentEscape(v string) string {
+	return strings.ReplaceAll(url.QueryEscape(v), "+", "%20")
+}
+
+// traceParent is the W3C traceparent header of span
+func traceParent(span oteltrace.SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-%s", span.TraceID(), span.SpanID(), span.TraceFlags())
+}
+
+// applicationName tags every connection in pg_stat_activity with the
+// service, its version and the pod holding it
+func applicationName(cfg *config.Config) string {
+	name := fmt.Sprintf("blueprint/%s", buildinfo.Get().Version)
+	if cfg.Kube.PodName != "" {
+		name += " " + cfg.Kube.PodName
+	}
+	return name
+}
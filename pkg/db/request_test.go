@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"blueprint/config"
+	model "blueprint/model/blueprint"
+	"blueprint/pkg/ctxmeta"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+type stampedOrder struct {
+	ID     string `gorm:"primaryKey"`
+	Status string
+	model.RequestStamp
+}
+
+func requestContext() context.Context {
+	ctx := ctxmeta.WithRequestID(context.Background(), "req-1")
+	ctx = ctxmeta.WithUserID(ctx, "42")
+	ctx = ctxmeta.WithTenantID(ctx, "acme")
+	ctx = ctxmeta.WithMethod(ctx, "/blueprint.Blueprint/Call")
+	return ctxmeta.WithClientVersion(ctx, "ios/5.2.0")
+}
+
+func openRequestTags(t *testing.T, pool *execPool, comment string) *gorm.DB {
+	t.Helper()
+	db := openExecPool(t, pool)
+	require.NoError(t, db.Use(RequestTags{Comment: comment}))
+	return db
+}
+
+func TestRequestStamp(t *testing.T) {
+	pool := &execPool{rows: 1}
+	db := openRequestTags(t, pool, CommentOff).WithContext(requestContext())
+
+	order := &stampedOrder{ID: "o-1", Status: "open"}
+	require.NoError(t, db.Create(order).Error)
+	assert.Equal(t, model.RequestStamp{RequestID: "req-1", RequestUserID: "42", RequestTenantID: "acme", RequestClientVersion: "ios/5.2.0"}, order.RequestStamp)
+	assert.Contains(t, pool.args, "req-1")
+
+	require.NoError(t, db.Create(&[]stampedOrder{{ID: "o-2"}, {ID: "o-3"}}).Error)
+	assert.Equal(t, []interface{}{"o-2", "", "req-1", "42", "acme", "ios/5.2.0", "o-3", "", "req-1", "42", "acme", "ios/5.2.0"}, pool.args, "every row of a batch")
+
+	require.NoError(t, db.Model(&stampedOrder{ID: "o-1"}).Updates(map[string]interface{}{"status": "filled"}).Error)
+	assert.Contains(t, pool.query, `"request_id"=$`)
+	assert.Contains(t, pool.args, "req-1")
+
+	// outside a call, and models without the stamp, are left alone
+	pool.args = nil
+	require.NoError(t, db.WithContext(context.Background()).Create(&stampedOrder{ID: "o-4"}).Error)
+	assert.Equal(t, []interface{}{"o-4", "", "", "", "", ""}, pool.args)
+	require.NoError(t, db.Model(&versionedAccount{ID: 1}).Update("name", "a").Error)
+	assert.NotContains(t, pool.query, "request_id")
+}
+
+func TestRequestComment(t *testing.T) {
+	pool := &execPool{rows: 1}
+	db := openRequestTags(t, pool, CommentTrace)
+	ctx := requestContext()
+	comment := `/*application='blueprint',client_version='ios%2F5.2.0',request_id='req-1',route='%2Fblueprint.Blueprint%2FCall',tenant_id='acme',user_id='42'*/ `
+
+	require.NoError(t, db.WithContext(ctx).Exec("DELETE FROM a WHERE id = ?", 1).Error)
+	assert.Equal(t, comment+"DELETE FROM a WHERE id = $1", pool.query)
+
+	dry := db.Session(&gorm.Session{DryRun: true}).WithContext(ctx)
+	var orders []stampedOrder
+	stmt := dry.Where("status = ?", "open").Find(&orders).Statement
+	assert.Equal(t, comment+`SELECT * FROM "stamped_orders" WHERE status = $1`, stmt.SQL.String())
+
+	stmt = dry.Delete(&stampedOrder{ID: "o-1"}).Statement
+	assert.Equal(t, comment+`DELETE FROM "stamped_orders" WHERE "stamped_orders"."id" = $1`, stmt.SQL.String())
+
+	require.NoError(t, db.Exec("DELETE FROM a").Error)
+	assert.Equal(t, "DELETE FROM a", pool.query, "outside a call")
+}
+
+func TestRequestCommentRoute(t *testing.T) {
+	pool := &execPool{rows: 1}
+	db := openRequestTags(t, pool, CommentRoute)
+
+	require.NoError(t, db.WithContext(requestContext()).Exec("DELETE FROM a").Error)
+	assert.Equal(t, `/*application='blueprint',route='%2Fblueprint.Blueprint%2FCall'*/ DELETE FROM a`, pool.query)
+}
+
+func TestRequestCommentTrace(t *testing.T) {
+	ctx := ctxmeta.WithTraceID(requestContext(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Contains(t, string(requestComment(ctx, true)), `trace_id='4bf92f3577b34da6a3ce929d0e0e4736'`)
+
+	span := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    oteltrace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     oteltrace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: oteltrace.FlagsSampled,
+	})
+	comment := string(requestComment(oteltrace.ContextWithSpanContext(ctx, span), true))
+	assert.Contains(t, comment, `traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'`)
+	assert.NotContains(t, comment, "trace_id")
+}
+
+func TestRequestCommentEscapes(t *testing.T) {
+	ctx := ctxmeta.WithRequestID(context.Background(), "x*/ DROP TABLE a; /*")
+	ctx = ctxmeta.WithUserID(ctx, "o'brien ?")
+	assert.Equal(t, sqlComment(`/*application='blueprint',request_id='x%2A%2F%20DROP%20TABLE%20a%3B%20%2F%2A',user_id='o%27brien%20%3F'*/`), requestComment(ctx, true))
+	assert.Empty(t, requestComment(context.Background(), true))
+}
+
+func TestApplicationName(t *testing.T) {
+	cfg := &config.Config{}
+	assert.Equal(t, "blueprint/dev", applicationName(cfg))
+	cfg.Kube.PodName = "blueprint-7d9f-x2"
+	assert.Equal(t, "blueprint/dev blueprint-7d9f-x2", applicationName(cfg))
+}
@@ -0,0 +1,139 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"time"
+
+	"blueprint/pkg/clock"
+	applog "blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var credentialChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_db_credential_checks_total",
+	Help: "Checks of the database credential provider by result: unchanged, rotated or error.",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(credentialChecks)
+}
+
+// idlePool is the part of *sql.DB the rotator needs
+type idlePool interface {
+	SetMaxIdleConns(n int)
+}
+
+// rotator asks the provider for credentials every interval. New
+// connections always log in with the provider's current credentials, when
+// they change the pool is recycled: idle connections are closed right
+// away and busy ones as they are released, so no query is cut off. The
+// idle limit is put back on the next check. A new login token of the same
+// user (LoginTokens) does not recycle the pool.
+type rotator struct {
+	provider CredentialProvider
+	pool     idlePool
+	maxIdle  int
+	interval time.Duration
+	clock    clock.Clock
+	log      *applog.Logger
+
+	last      Credentials
+	recycling bool
+
+	cancel context.CancelFunc
+	group  *run.Group
+}
+
+func newRotator(provider CredentialProvider, pool idlePool, maxIdle int, interval time.Duration, log *applog.Logger) *rotator {
+	return &rotator{
+		provider: provider,
+		pool:     pool,
+		maxIdle:  maxIdle,
+		interval: interval,
+		clock:    clock.Real,
+		log:      log,
+	}
+}
+
+func (r *rotator) Start(ctx context.Context) error {
+	creds, err := r.provider.Credentials(ctx)
+	if err != nil {
+		return err
+	}
+	r.last = creds
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	r.group = run.NewGroup(watchCtx, r.log)
+	r.group.Supervise("postgres_credentials", r.run, run.Options{Clock: r.clock})
+	return nil
+}
+
+func (r *rotator) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	if r.group != nil {
+		r.group.Wait()
+	}
+}
+
+func (r *rotator) run(ctx context.Context) error {
+	ticker := r.clock.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			r.check(ctx)
+		}
+	}
+}
+
+func (r *rotator) check(ctx context.Context) {
+	if r.recycling {
+		r.pool.SetMaxIdleConns(r.maxIdle)
+		r.recycling = false
+	}
+
+	creds, err := r.provider.Credentials(ctx)
+	if err != nil {
+		credentialChecks.WithLabelValues("error").Inc()
+		if r.log != nil {
+			r.log.Warnf("Postgres credential refresh failed, keeping the current connections: %v", err)
+		}
+		return
+	}
+	if !r.changed(creds) {
+		credentialChecks.WithLabelValues("unchanged").Inc()
+		r.last = creds
+		return
+	}
+
+	credentialChecks.WithLabelValues("rotated").Inc()
+	r.last = creds
+	r.pool.SetMaxIdleConns(0)
+	r.recycling = true
+	if r.log != nil {
+		r.log.Infof("Postgres credentials rotated, user %s, expires %v, recycling pooled connections", creds.User, creds.ExpiresAt)
+	}
+}
+
+// changed reports whether creds log in as someone else than the pooled
+// connections did. A refreshed login token is not a change, the
+// connections it replaces stay valid.
+func (r *rotator) changed(creds Credentials) bool {
+	if creds.User != r.last.User {
+		return true
+	}
+	if t, ok := r.provider.(LoginTokens); ok && t.LoginTokens() {
+		return false
+	}
+	return creds.Password != r.last.Password
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePool struct {
+	idle []int
+}
+
+func (p *fakePool) SetMaxIdleConns(n int) {
+	p.idle = append(p.idle, n)
+}
+
+type fakeProvider struct {
+	creds Credentials
+	err   error
+}
+
+func (p *fakeProvider) Credentials(ctx context.Context) (Credentials, error) {
+	return p.creds, p.err
+}
+
+func TestRotatorRecyclesOnChange(t *testing.T) {
+	ctx := context.Background()
+	provider := &fakeProvider{creds: Credentials{User: "v-app-1", Password: "one"}}
+	pool := &fakePool{}
+	r := newRotator(provider, pool, 10, 0, nil)
+	r.last = provider.creds
+
+	r.check(ctx)
+	assert.Empty(t, pool.idle, "unchanged credentials leave the pool alone")
+
+	provider.creds = Credentials{User: "v-app-2", Password: "two"}
+	r.check(ctx)
+	assert.Equal(t, []int{0}, pool.idle, "idle connections are dropped")
+
+	r.check(ctx)
+	assert.Equal(t, []int{0, 10}, pool.idle, "and the idle limit put back on the next check")
+
+	provider.err = errors.New("vault sealed")
+	r.check(ctx)
+	assert.Equal(t, []int{0, 10}, pool.idle, "errors keep the current connections")
+	assert.Equal(t, "v-app-2", r.last.User)
+}
+
+type tokenProvider struct{ fakeProvider }
+
+func (p *tokenProvider) LoginTokens() bool { return true }
+
+func TestRotatorKeepsPoolOnNewLoginToken(t *testing.T) {
+	ctx := context.Background()
+	provider := &tokenProvider{fakeProvider{creds: Credentials{User: "app", Password: "token-1"}}}
+	pool := &fakePool{}
+	r := newRotator(provider, pool, 10, 0, nil)
+	r.last = provider.creds
+
+	provider.creds.Password = "token-2"
+	r.check(ctx)
+	assert.Empty(t, pool.idle, "connections logged in with the old token stay valid")
+	assert.Equal(t, "token-2", r.last.Password)
+
+	provider.creds = Credentials{User: "app-ro", Password: "token-3"}
+	r.check(ctx)
+	assert.Equal(t, []int{0}, pool.idle, "another user recycles the pool")
+}
+
+func TestRotatorStart(t *testing.T) {
+	provider := &fakeProvider{err: errors.New("no token")}
+	r := newRotator(provider, &fakePool{}, 10, 1, nil)
+	require.Error(t, r.Start(context.Background()), "fails when there are no credentials to start with")
+	r.Stop()
+}
@@ -0,0 +1,154 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	applog "blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	// explains run outside the request, each gets its own timeout and only
+	// a couple run at once so a burst of slow queries cannot add load
+	explainTimeout = 5 * time.Second
+	maxExplains    = 2
+)
+
+var slowQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_db_slow_queries_total",
+	Help: "Queries over the slow threshold by what happened to their plan: off, ok, error or skipped.",
+}, []string{"explain"})
+
+func init() {
+	prometheus.MustRegister(slowQueries)
+}
+
+// explainFunc returns the plan for a statement without running it
+type explainFunc func(ctx context.Context, query string) (string, error)
+
+// slowQueryLogger wraps the gorm logger and logs statements slower than
+// threshold. With explain set the plan is fetched in the background and
+// the entry written once it is there, the query itself is never delayed.
+type slowQueryLogger struct {
+	logger.Interface
+	log       *applog.Logger
+	threshold time.Duration
+	explain   explainFunc
+
+	// shared with the copies LogMode makes
+	slots chan struct{}
+	wg    *sync.WaitGroup
+}
+
+func newSlowQueryLogger(base logger.Interface, log *applog.Logger, threshold time.Duration, explain explainFunc) *slowQueryLogger {
+	return &slowQueryLogger{
+		Interface: base,
+		log:       log,
+		threshold: threshold,
+		explain:   explain,
+		slots:     make(chan struct{}, maxExplains),
+		wg:        &sync.WaitGroup{},
+	}
+}
+
+// explainDB plans the query on db, EXPLAIN without ANALYZE so nothing is
+// executed
+func explainDB(db *sql.DB) explainFunc {
+	return func(ctx context.Context, query string) (string, error) {
+		rows, err := db.QueryContext(ctx, "EXPLAIN "+query)
+		if err != nil {
+			return "", err
+		}
+		defer rows.Close()
+
+		var lines []string
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				return "", err
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n"), rows.Err()
+	}
+}
+
+func (l *slowQueryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	c := *l
+	c.Interface = l.Interface.LogMode(level)
+	return &c
+}
+
+func (l *slowQueryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	l.Interface.Trace(ctx, begin, fc, err)
+
+	elapsed := time.Since(begin)
+	if l.log == nil || l.threshold <= 0 || elapsed < l.threshold {
+		return
+	}
+
+	query, rows := fc()
+	fields := []interface{}{"sql", query, "rows", rows, "duration", elapsed, "threshold", l.threshold}
+	if err != nil {
+		fields = append(fields, "error", err.Error())
+	}
+
+	if l.explain == nil || !explainable(query) {
+		slowQueries.WithLabelValues("off").Inc()
+		l.log.Warnw("Slow database query", fields...)
+		return
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		slowQueries.WithLabelValues("skipped").Inc()
+		l.log.Warnw("Slow database query", append(fields, "explain_error", "too many explains running")...)
+		return
+	}
+
+	l.wg.Add(1)
+	run.Go(l.log, "slow_query_explain", func() {
+		defer l.wg.Done()
+		defer func() { <-l.slots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+		defer cancel()
+
+		plan, err := l.explain(ctx, query)
+		if err != nil {
+			slowQueries.WithLabelValues("error").Inc()
+			l.log.Warnw("Slow database query", append(fields, "explain_error", err.Error())...)
+			return
+		}
+		slowQueries.WithLabelValues("ok").Inc()
+		l.log.Warnw("Slow database query", append(fields, "plan", plan)...)
+	})
+}
+
+// wait blocks until the running explains are logged
+func (l *slowQueryLogger) wait() {
+	l.wg.Wait()
+}
+
+// explainable is true for the statements EXPLAIN takes, DDL and session
+// commands are only logged
+func explainable(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "WITH", "INSERT", "UPDATE", "DELETE", "VALUES", "TABLE":
+		return true
+	}
+	return false
+}
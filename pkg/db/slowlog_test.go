@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/logger"
+)
+
+func trace(l logger.Interface, query string, took time.Duration, err error) {
+	l.Trace(context.Background(), time.Now().Add(-took), func() (string, int64) { return query, 3 }, err)
+}
+
+func TestSlowQueryLogExplains(t *testing.T) {
+	log, logs := testsupport.Logger(t)
+	var explained []string
+	explain := func(ctx context.Context, query string) (string, error) {
+		explained = append(explained, query)
+		if query == "SELECT broken" {
+			return "", errors.New("syntax error")
+		}
+		return "Seq Scan on platform_my_model", nil
+	}
+	l := newSlowQueryLogger(logger.Discard, log, 100*time.Millisecond, explain)
+
+	trace(l, "SELECT fast", time.Millisecond, nil)
+	trace(l, "SELECT * FROM platform_my_model", time.Second, nil)
+	l.wait()
+	trace(l, "SELECT broken", time.Second, errors.New("timeout"))
+	l.wait()
+	trace(l, "CREATE INDEX idx ON platform_my_model (name)", time.Second, nil)
+	l.wait()
+
+	assert.Equal(t, []string{"SELECT * FROM platform_my_model", "SELECT broken"}, explained, "only slow statements EXPLAIN takes")
+
+	entries := logs.Entries(t)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "Slow database query", entries[0]["message"])
+	assert.Equal(t, "SELECT * FROM platform_my_model", entries[0]["sql"])
+	assert.Equal(t, float64(3), entries[0]["rows"])
+	assert.Equal(t, "Seq Scan on platform_my_model", entries[0]["plan"])
+
+	assert.Equal(t, "timeout", entries[1]["error"])
+	assert.Equal(t, "syntax error", entries[1]["explain_error"])
+	assert.NotContains(t, entries[1], "plan")
+
+	assert.NotContains(t, entries[2], "plan")
+	assert.NotContains(t, entries[2], "explain_error")
+}
+
+func TestSlowQueryLogLimitsExplains(t *testing.T) {
+	log, logs := testsupport.Logger(t)
+	release := make(chan struct{})
+	explain := func(ctx context.Context, query string) (string, error) {
+		<-release
+		return "plan", nil
+	}
+	l := newSlowQueryLogger(logger.Discard, log, time.Millisecond, explain)
+	// gorm hands out copies with a different level, they share the limit
+	copied := l.LogMode(logger.Info)
+
+	for i := 0; i < maxExplains+1; i++ {
+		trace(copied, "SELECT 1", time.Second, nil)
+	}
+	close(release)
+	l.wait()
+
+	entries := logs.Entries(t)
+	require.Len(t, entries, maxExplains+1)
+	assert.Equal(t, "too many explains running", entries[0]["explain_error"])
+	assert.Equal(t, "plan", entries[1]["plan"])
+}
+
+func TestSlowQueryLogOff(t *testing.T) {
+	log, logs := testsupport.Logger(t)
+	log.Info("start")
+	trace(newSlowQueryLogger(logger.Discard, log, 0, nil), "SELECT 1", time.Second, nil)
+	trace(newSlowQueryLogger(logger.Discard, nil, time.Millisecond, nil), "SELECT 1", time.Second, nil)
+	assert.Len(t, logs.Entries(t), 1, "nothing logged after start")
+}
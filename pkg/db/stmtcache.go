@@ -0,0 +1,189 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// gorm prepares every distinct SQL string once and keeps the statement,
+// with PrepareStmt on that is every query the service runs. Queries built
+// with varying IN lists or column sets each add an entry, so the cache is
+// capped (POSTGRES_STMT_CACHE_SIZE, least recently used go first), entries
+// unused for POSTGRES_STMT_CACHE_TTL are closed, and its size and hit rate
+// exported to tell when the cap is too small.
+
+const stmtCacheName = "blueprint:stmt_cache"
+
+var (
+	stmtCacheStatements = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blueprint_db_stmt_cache_statements_total",
+		Help: "Statements run through the prepared statement cache.",
+	})
+	stmtCachePrepares = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blueprint_db_stmt_cache_prepares_total",
+		Help: "Statements prepared because the cache did not hold them, misses.",
+	})
+	stmtCacheEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "blueprint_db_stmt_cache_size",
+		Help: "Prepared statements cached, as of the last prepare or flush.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(stmtCacheStatements, stmtCachePrepares, stmtCacheEntries)
+}
+
+// StmtCacheStats describes the prepared statement cache. Hits are the
+// statements that found theirs prepared, Statements minus Prepares.
+type StmtCacheStats struct {
+	Size       int
+	MaxSize    int
+	Statements uint64
+	Prepares   uint64
+	Hits       uint64
+	HitRatio   float64
+}
+
+// stmtCache counts the lookups and prepares of gorm's prepared statement
+// cache. Every statement is counted by a callback, prepares where gorm
+// prepares them: outside a transaction on the pool it wraps, inside one on
+// the transaction the pool began.
+type stmtCache struct {
+	stmts      *gorm.PreparedStmtDB
+	maxSize    int
+	statements atomic.Uint64
+	prepares   atomic.Uint64
+}
+
+// newStmtCache hooks into db, opened with PrepareStmt, and returns nil
+// when it has no statement cache
+func newStmtCache(db *gorm.DB, maxSize int) (*stmtCache, error) {
+	stmts, ok := db.ConnPool.(*gorm.PreparedStmtDB)
+	if !ok {
+		return nil, nil
+	}
+	c := &stmtCache{stmts: stmts, maxSize: maxSize}
+	stmts.ConnPool = &countingPool{ConnPool: stmts.ConnPool, cache: c}
+	if err := db.Use(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *stmtCache) Name() string {
+	return stmtCacheName
+}
+
+func (c *stmtCache) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("*").Register(stmtCacheName+":create", c.count); err != nil {
+		return err
+	}
+	if err := cb.Query().After("*").Register(stmtCacheName+":query", c.count); err != nil {
+		return err
+	}
+	if err := cb.Update().After("*").Register(stmtCacheName+":update", c.count); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("*").Register(stmtCacheName+":delete", c.count); err != nil {
+		return err
+	}
+	if err := cb.Row().After("*").Register(stmtCacheName+":row", c.count); err != nil {
+		return err
+	}
+	return cb.Raw().After("*").Register(stmtCacheName+":raw", c.count)
+}
+
+// count takes every statement that reached the database as a lookup
+func (c *stmtCache) count(db *gorm.DB) {
+	if db.DryRun || db.Statement.SQL.Len() == 0 {
+		return
+	}
+	c.statements.Add(1)
+	stmtCacheStatements.Inc()
+}
+
+func (c *stmtCache) prepared() {
+	c.prepares.Add(1)
+	stmtCachePrepares.Inc()
+	stmtCacheEntries.Set(float64(c.size()))
+}
+
+func (c *stmtCache) size() int {
+	return len(c.stmts.Stmts.Keys())
+}
+
+func (c *stmtCache) Stats() StmtCacheStats {
+	s := StmtCacheStats{
+		Size:       c.size(),
+		MaxSize:    c.maxSize,
+		Statements: c.statements.Load(),
+		Prepares:   c.prepares.Load(),
+	}
+	// a statement is counted after it ran, its prepare before
+	if s.Statements > s.Prepares {
+		s.Hits = s.Statements - s.Prepares
+		s.HitRatio = float64(s.Hits) / float64(s.Statements)
+	}
+	stmtCacheEntries.Set(float64(s.Size))
+	return s
+}
+
+// Flush closes every cached statement, queries running on one finish first
+func (c *stmtCache) Flush() int {
+	n := c.size()
+	c.stmts.Close()
+	stmtCacheEntries.Set(0)
+	return n
+}
+
+// countingPool is the connection pool under gorm's statement cache, every
+// PrepareContext through it is a miss
+type countingPool struct {
+	gorm.ConnPool
+	cache *stmtCache
+}
+
+func (p *countingPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	p.cache.prepared()
+	return p.ConnPool.PrepareContext(ctx, query)
+}
+
+// GetDBConn keeps db.DB() working through the wrapper
+func (p *countingPool) GetDBConn() (*sql.DB, error) {
+	if sqlDB, ok := p.ConnPool.(*sql.DB); ok {
+		return sqlDB, nil
+	}
+	if connector, ok := p.ConnPool.(gorm.GetDBConnector); ok {
+		return connector.GetDBConn()
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// BeginTx hands gorm a transaction whose prepares are counted too
+func (p *countingPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	beginner, ok := p.ConnPool.(gorm.TxBeginner)
+	if !ok {
+		return nil, gorm.ErrInvalidTransaction
+	}
+	tx, err := beginner.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &countingTx{Tx: tx, cache: p.cache}, nil
+}
+
+type countingTx struct {
+	*sql.Tx
+	cache *stmtCache
+}
+
+func (t *countingTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	t.cache.prepared()
+	return t.Tx.PrepareContext(ctx, query)
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// stmtDriver prepares statements that affect one row and return none
+type stmtDriver struct{ prepared atomic.Int32 }
+
+func (d *stmtDriver) Open(string) (driver.Conn, error) { return stmtConn{d}, nil }
+
+type stmtConn struct{ d *stmtDriver }
+
+func (c stmtConn) Prepare(string) (driver.Stmt, error) {
+	c.d.prepared.Add(1)
+	return stmtStmt{}, nil
+}
+func (stmtConn) Close() error              { return nil }
+func (stmtConn) Begin() (driver.Tx, error) { return stmtTx{}, nil }
+
+type stmtStmt struct{}
+
+func (stmtStmt) Close() error  { return nil }
+func (stmtStmt) NumInput() int { return -1 }
+func (stmtStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (stmtStmt) Query([]driver.Value) (driver.Rows, error) { return stmtRows{}, nil }
+
+type stmtRows struct{}
+
+func (stmtRows) Columns() []string         { return nil }
+func (stmtRows) Close() error              { return nil }
+func (stmtRows) Next([]driver.Value) error { return io.EOF }
+
+type stmtTx struct{}
+
+func (stmtTx) Commit() error   { return nil }
+func (stmtTx) Rollback() error { return nil }
+
+var stmts = &stmtDriver{}
+
+func init() {
+	sql.Register("db-stmt-cache", stmts)
+}
+
+func openStmtCache(t *testing.T, maxSize int) (*gorm.DB, *stmtCache) {
+	t.Helper()
+	sqlDB, err := sql.Open("db-stmt-cache", "")
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		PrepareStmt:        true,
+		PrepareStmtMaxSize: maxSize,
+	})
+	require.NoError(t, err)
+	cache, err := newStmtCache(db, maxSize)
+	require.NoError(t, err)
+	require.NotNil(t, cache)
+	return db, cache
+}
+
+func TestStmtCacheStats(t *testing.T) {
+	db, cache := openStmtCache(t, 10)
+	before := stmts.prepared.Load()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Exec("UPDATE accounts SET name = ? WHERE id = ?", "a", i).Error)
+	}
+	require.NoError(t, db.Exec("DELETE FROM accounts WHERE id = ?", 1).Error)
+
+	s := cache.Stats()
+	assert.Equal(t, StmtCacheStats{Size: 2, MaxSize: 10, Statements: 4, Prepares: 2, Hits: 2, HitRatio: 0.5}, s)
+	assert.Equal(t, int32(2), stmts.prepared.Load()-before)
+
+	// a transaction reuses what is prepared and prepares the rest on itself
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM accounts WHERE id = ?", 2).Error; err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM orders WHERE account_id = ?", 2).Error
+	}))
+	s = cache.Stats()
+	assert.Equal(t, uint64(6), s.Statements)
+	assert.Equal(t, uint64(3), s.Prepares)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err, "DB() through the counting pool")
+	assert.NotNil(t, sqlDB)
+}
+
+func TestStmtCacheMaxSize(t *testing.T) {
+	db, cache := openStmtCache(t, 2)
+	for _, table := range []string{"a", "b", "c"} {
+		require.NoError(t, db.Exec("DELETE FROM "+table).Error)
+	}
+	assert.Equal(t, 2, cache.Stats().Size)
+}
+
+func TestFlushStmtCache(t *testing.T) {
+	db, cache := openStmtCache(t, 10)
+	require.NoError(t, db.Exec("DELETE FROM a").Error)
+	require.NoError(t, db.Exec("DELETE FROM b").Error)
+
+	p := &PostgresDB{stmts: cache}
+	assert.Equal(t, 2, p.FlushStmtCache())
+	assert.Equal(t, 0, p.StmtCacheStats().Size)
+
+	// the next run prepares again
+	require.NoError(t, db.Exec("DELETE FROM a").Error)
+	assert.Equal(t, uint64(3), cache.Stats().Prepares)
+
+	assert.Zero(t, (&PostgresDB{}).FlushStmtCache(), "without a statement cache")
+	assert.Equal(t, StmtCacheStats{}, (&PostgresDB{}).StmtCacheStats())
+}
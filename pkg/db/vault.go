@@ -0,0 +1,120 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+)
+
+// vaultRenewAt is the share of the lease after which new credentials are
+// fetched, so pooled connections are recycled while the old ones still work
+const vaultRenewAt = 0.8
+
+// VaultOptions point at a Vault database secrets engine role, e.g. Path
+// "database/creds/blueprint"
+type VaultOptions struct {
+	Addr  string
+	Token string
+	// TokenFile is read on every fetch when Token is empty, e.g. one kept
+	// fresh by a vault agent
+	TokenFile string
+	Path      string
+	Client    *http.Client
+	Clock     clock.Clock
+}
+
+// VaultCredentials hands out dynamic credentials from Vault, fetching a new
+// pair once 80% of the lease has passed. Credentials without a lease are
+// kept.
+type VaultCredentials struct {
+	opts VaultOptions
+
+	mu    sync.Mutex
+	creds Credentials
+	renew time.Time
+}
+
+func NewVaultCredentials(opts VaultOptions) *VaultCredentials {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	opts.Clock = clock.Or(opts.Clock)
+	return &VaultCredentials{opts: opts}
+}
+
+type vaultSecret struct {
+	LeaseDuration int `json:"lease_duration"`
+	Data          struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func (v *VaultCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.opts.Clock.Now()
+	if v.creds.User != "" && (v.renew.IsZero() || now.Before(v.renew)) {
+		return v.creds, nil
+	}
+
+	secret, err := v.read(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	lease := time.Duration(secret.LeaseDuration) * time.Second
+	v.creds = Credentials{User: secret.Data.Username, Password: secret.Data.Password}
+	v.renew = time.Time{}
+	if lease > 0 {
+		v.creds.ExpiresAt = now.Add(lease)
+		v.renew = now.Add(time.Duration(float64(lease) * vaultRenewAt))
+	}
+	return v.creds, nil
+}
+
+func (v *VaultCredentials) read(ctx context.Context) (*vaultSecret, error) {
+	token := v.opts.Token
+	if token == "" && v.opts.TokenFile != "" {
+		data, err := os.ReadFile(v.opts.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("vault token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	url := strings.TrimRight(v.opts.Addr, "/") + "/v1/" + strings.TrimLeft(v.opts.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	resp, err := v.opts.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault %s: %w", v.opts.Path, err)
+	}
+	defer resp.Body.Close()
+
+	var secret vaultSecret
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("vault %s: %s: %w", v.opts.Path, resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault %s: %s: %s", v.opts.Path, resp.Status, strings.Join(secret.Errors, "; "))
+	}
+	if secret.Data.Username == "" {
+		return nil, fmt.Errorf("vault %s: no username in the secret", v.opts.Path)
+	}
+	return &secret, nil
+}
@@ -0,0 +1,101 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	apperrors "blueprint/pkg/errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// versionField is the model convention for optimistic locking: an int
+// field named Version, starting at 0 or 1, that only UpdateWithVersion moves
+const versionField = "Version"
+
+// ReasonStaleObject is the ErrorInfo reason of a StaleObjectError
+const ReasonStaleObject = "STALE_OBJECT"
+
+// ErrStaleObject matches any StaleObjectError with errors.Is
+var ErrStaleObject = errors.New("stale object")
+
+// StaleObjectError is returned by UpdateWithVersion when the row was
+// changed or deleted since it was read. Handlers re-read and try again, or
+// return it as is: it goes out as Aborted, which errors.Retry also retries.
+type StaleObjectError struct {
+	Table   string
+	Version int
+}
+
+func (e *StaleObjectError) Error() string {
+	return fmt.Sprintf("stale object: %s at version %d was changed by someone else", e.Table, e.Version)
+}
+
+func (e *StaleObjectError) Is(target error) bool {
+	return target == ErrStaleObject
+}
+
+func (e *StaleObjectError) GRPCStatus() *status.Status {
+	return apperrors.New(codes.Aborted, ReasonStaleObject, "the record was changed by someone else, reload it and try again").
+		WithMetadata("version", strconv.Itoa(e.Version)).
+		GRPCStatus()
+}
+
+// UpdateWithVersion applies values to the row of model, a pointer to a
+// struct with its primary key and Version as they were read. The UPDATE only
+// matches that version and bumps it, so of two concurrent writers the
+// second gets a StaleObjectError instead of overwriting the first. On
+// success model.Version holds the new version.
+func UpdateWithVersion(ctx context.Context, db *gorm.DB, model interface{}, values map[string]interface{}) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return fmt.Errorf("update with version: %w", err)
+	}
+
+	field := stmt.Schema.LookUpField(versionField)
+	if field == nil || field.FieldType.Kind() != reflect.Int {
+		return fmt.Errorf("update with version: %s has no %s int field", stmt.Schema.Name, versionField)
+	}
+
+	rv := reflect.ValueOf(model)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("update with version: %T is not a pointer to a struct", model)
+	}
+	// without a key the version check alone would hit every row at it
+	for _, pk := range stmt.Schema.PrimaryFields {
+		if _, zero := pk.ValueOf(ctx, rv.Elem()); zero {
+			return fmt.Errorf("update with version: %s has no %s set", stmt.Schema.Name, pk.Name)
+		}
+	}
+
+	value, _ := field.ValueOf(ctx, rv.Elem())
+	version := value.(int)
+
+	updates := make(map[string]interface{}, len(values)+1)
+	for k, v := range values {
+		updates[k] = v
+	}
+	updates[field.DBName] = version + 1
+
+	res := db.WithContext(ctx).Model(model).
+		Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: version}).
+		Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		// Updates already wrote the new version into model, put it back
+		if err := field.Set(ctx, rv.Elem(), version); err != nil {
+			return err
+		}
+		return &StaleObjectError{Table: stmt.Schema.Table, Version: version}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"blueprint/config"
+	apperrors "blueprint/pkg/errors"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type versionedAccount struct {
+	ID      int64
+	Name    string
+	Version int
+}
+
+// execPool records the statements gorm sends and reports rows updated
+type execPool struct {
+	rows  int64
+	query string
+	args  []interface{}
+}
+
+func (p *execPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *execPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	p.query, p.args = query, args
+	return driver.RowsAffected(p.rows), nil
+}
+
+func (p *execPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *execPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func openExecPool(t *testing.T, pool *execPool) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: pool}), &gorm.Config{})
+	require.NoError(t, err)
+	return db
+}
+
+func TestUpdateWithVersion(t *testing.T) {
+	pool := &execPool{rows: 1}
+	db := openExecPool(t, pool)
+	account := &versionedAccount{ID: 7, Name: "old", Version: 3}
+
+	require.NoError(t, UpdateWithVersion(context.Background(), db, account, map[string]interface{}{"name": "new"}))
+	assert.Equal(t, `UPDATE "versioned_accounts" SET "name"=$1,"version"=$2 WHERE "versioned_accounts"."version" = $3 AND "id" = $4`, pool.query)
+	assert.Equal(t, []interface{}{"new", 4, 3, int64(7)}, pool.args)
+	assert.Equal(t, 4, account.Version)
+	assert.Equal(t, "new", account.Name)
+}
+
+func TestUpdateWithVersionStale(t *testing.T) {
+	db := openExecPool(t, &execPool{rows: 0})
+	account := &versionedAccount{ID: 7, Version: 3}
+
+	err := UpdateWithVersion(context.Background(), db, account, map[string]interface{}{"name": "new"})
+	require.ErrorIs(t, err, ErrStaleObject)
+	var stale *StaleObjectError
+	require.ErrorAs(t, err, &stale)
+	assert.Equal(t, &StaleObjectError{Table: "versioned_accounts", Version: 3}, stale)
+	assert.Equal(t, 3, account.Version, "the version read is kept")
+
+	st := status.Convert(apperrors.Sanitize(err))
+	assert.Equal(t, codes.Aborted, st.Code())
+	assert.True(t, apperrors.IsRetryable(err))
+}
+
+func TestUpdateWithVersionNeedsKeyAndVersion(t *testing.T) {
+	pool := &execPool{rows: 1}
+	db := openExecPool(t, pool)
+
+	err := UpdateWithVersion(context.Background(), db, &versionedAccount{Version: 1}, map[string]interface{}{"name": "x"})
+	assert.ErrorContains(t, err, "no ID set")
+
+	type unversioned struct {
+		ID   int64
+		Name string
+	}
+	err = UpdateWithVersion(context.Background(), db, &unversioned{ID: 1}, map[string]interface{}{"name": "x"})
+	assert.ErrorContains(t, err, "no Version int field")
+	assert.Empty(t, pool.query, "nothing reached the database")
+}
+
+func TestUpdateWithVersionConcurrentWriters(t *testing.T) {
+	cfg := &config.Config{Postgres: testsupport.Postgres(t)}
+	pg, err := NewPostgresDB(cfg, nil)
+	require.NoError(t, err)
+	defer pg.Close()
+
+	ctx := context.Background()
+	require.NoError(t, pg.DB.Migrator().DropTable(&versionedAccount{}))
+	require.NoError(t, pg.DB.AutoMigrate(&versionedAccount{}))
+	require.NoError(t, pg.DB.Create(&versionedAccount{ID: 1, Name: "start", Version: 1}).Error)
+
+	var first, second versionedAccount
+	require.NoError(t, pg.DB.First(&first, 1).Error)
+	require.NoError(t, pg.DB.First(&second, 1).Error)
+
+	require.NoError(t, UpdateWithVersion(ctx, pg.DB, &first, map[string]interface{}{"name": "first"}))
+	assert.ErrorIs(t, UpdateWithVersion(ctx, pg.DB, &second, map[string]interface{}{"name": "second"}), ErrStaleObject)
+
+	var stored versionedAccount
+	require.NoError(t, pg.DB.First(&stored, 1).Error)
+	assert.Equal(t, versionedAccount{ID: 1, Name: "first", Version: 2}, stored)
+}
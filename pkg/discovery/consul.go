@@ -0,0 +1,115 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ConsulRegistry talks to the local consul agent HTTP API
+type ConsulRegistry struct {
+	addr   string
+	client *http.Client
+}
+
+type consulCheck struct {
+	CheckID                        string `json:"CheckID"`
+	TTL                            string `json:"TTL"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter"`
+}
+
+type consulService struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   consulCheck       `json:"Check"`
+}
+
+func NewConsulRegistry(addr string) *ConsulRegistry {
+	if addr == "" {
+		addr = "127.0.0.1:8500"
+	}
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		addr = "http://" + addr
+	}
+
+	return &ConsulRegistry{
+		addr:   strings.TrimRight(addr, "/"),
+		client: &http.Client{Timeout: defaultHTTPTimeout},
+	}
+}
+
+func (c *ConsulRegistry) Register(ctx context.Context, svc Service, ttl time.Duration) error {
+	body := consulService{
+		ID:      svc.ID,
+		Name:    svc.Name,
+		Tags:    svc.Tags,
+		Address: svc.Host,
+		Port:    svc.Port,
+		Meta:    map[string]string{"version": svc.Version},
+		Check: consulCheck{
+			CheckID:                        checkID(svc),
+			TTL:                            ttl.String(),
+			DeregisterCriticalServiceAfter: (ttl * 6).String(),
+		},
+	}
+
+	if err := c.put(ctx, "/v1/agent/service/register", body); err != nil {
+		return err
+	}
+
+	// a fresh TTL check starts critical, mark it passing right away
+	return c.Heartbeat(ctx, svc)
+}
+
+func (c *ConsulRegistry) Heartbeat(ctx context.Context, svc Service) error {
+	return c.put(ctx, "/v1/agent/check/pass/"+url.PathEscape(checkID(svc)), nil)
+}
+
+func (c *ConsulRegistry) Deregister(ctx context.Context, svc Service) error {
+	return c.put(ctx, "/v1/agent/service/deregister/"+url.PathEscape(svc.ID), nil)
+}
+
+func (c *ConsulRegistry) put(ctx context.Context, path string, body interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal consul request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.addr+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build consul request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("consul request %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("consul request %s returned %d: %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+func checkID(svc Service) string {
+	return "service:" + svc.ID
+}
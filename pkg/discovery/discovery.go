@@ -0,0 +1,204 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/run"
+)
+
+const (
+	BackendConsul = "consul"
+	BackendEtcd   = "etcd"
+
+	defaultTTL         = 10 * time.Second
+	defaultHTTPTimeout = 5 * time.Second
+)
+
+// Service is the instance we announce to the registry
+type Service struct {
+	ID      string
+	Name    string
+	Version string
+	Host    string
+	Port    int
+	Tags    []string
+}
+
+// Registry is implemented by every discovery backend
+type Registry interface {
+	Register(ctx context.Context, svc Service, ttl time.Duration) error
+	Heartbeat(ctx context.Context, svc Service) error
+	Deregister(ctx context.Context, svc Service) error
+}
+
+type Options struct {
+	Backend string
+	Addr    string
+	TTL     time.Duration
+	// Clock schedules the heartbeats, clock.Real by default
+	Clock clock.Clock
+}
+
+// Discovery registers the service on Start, keeps the TTL alive in the
+// background and removes the registration on Stop
+type Discovery struct {
+	registry Registry
+	service  Service
+	ttl      time.Duration
+	clock    clock.Clock
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	group   *run.Group
+	lastErr error
+}
+
+func NewDiscovery(cfg *config.Config, svc Service) (*Discovery, error) {
+	return NewDiscoveryWithOptions(svc, Options{
+		Backend: cfg.Discovery.Backend,
+		Addr:    cfg.Discovery.Addr,
+		TTL:     cfg.Discovery.TTL,
+	})
+}
+
+func NewDiscoveryWithOptions(svc Service, opts Options) (*Discovery, error) {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultTTL
+	}
+
+	var registry Registry
+	switch opts.Backend {
+	case BackendConsul:
+		registry = NewConsulRegistry(opts.Addr)
+	case BackendEtcd:
+		registry = NewEtcdRegistry(opts.Addr)
+	default:
+		return nil, fmt.Errorf("unknown discovery backend %q", opts.Backend)
+	}
+
+	d := NewDiscoveryWithRegistry(registry, svc, opts.TTL)
+	d.clock = clock.Or(opts.Clock)
+	return d, nil
+}
+
+// NewDiscoveryWithRegistry wires a custom backend, mostly useful for tests
+func NewDiscoveryWithRegistry(registry Registry, svc Service, ttl time.Duration) *Discovery {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	if svc.ID == "" {
+		svc.ID = defaultServiceID(svc)
+	}
+
+	return &Discovery{
+		registry: registry,
+		service:  svc,
+		ttl:      ttl,
+		clock:    clock.Real,
+	}
+}
+
+func (d *Discovery) Start(ctx context.Context) error {
+	if err := d.registry.Register(ctx, d.service, d.ttl); err != nil {
+		return fmt.Errorf("failed to register service %s: %w", d.service.ID, err)
+	}
+
+	hbCtx, cancel := context.WithCancel(context.Background())
+
+	group := run.NewGroup(hbCtx, nil)
+	d.mu.Lock()
+	d.cancel = cancel
+	d.group = group
+	d.mu.Unlock()
+
+	group.Supervise("discovery_heartbeat", d.heartbeat, run.Options{Clock: d.clock})
+
+	return nil
+}
+
+func (d *Discovery) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	cancel, group := d.cancel, d.group
+	d.cancel = nil
+	d.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	group.Wait()
+
+	if err := d.registry.Deregister(ctx, d.service); err != nil {
+		return fmt.Errorf("failed to deregister service %s: %w", d.service.ID, err)
+	}
+
+	return nil
+}
+
+// LastError returns the last heartbeat error, nil while the registration is healthy
+func (d *Discovery) LastError() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lastErr
+}
+
+func (d *Discovery) Service() Service {
+	return d.service
+}
+
+func (d *Discovery) heartbeat(ctx context.Context) error {
+	// beat twice per TTL so a single slow call does not expire the registration
+	ticker := d.clock.NewTicker(d.ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			callCtx, cancel := context.WithTimeout(ctx, defaultHTTPTimeout)
+			err := d.registry.Heartbeat(callCtx, d.service)
+			cancel()
+
+			// registry lost us (agent restart, lease expired), register again
+			if err != nil && ctx.Err() == nil {
+				callCtx, cancel = context.WithTimeout(ctx, defaultHTTPTimeout)
+				err = d.registry.Register(callCtx, d.service, d.ttl)
+				cancel()
+			}
+
+			d.mu.Lock()
+			d.lastErr = err
+			d.mu.Unlock()
+		}
+	}
+}
+
+// AdvertiseHost picks the address other services should dial
+func AdvertiseHost(host string) string {
+	if host != "" && host != "0.0.0.0" && host != "::" {
+		return host
+	}
+
+	if name, err := os.Hostname(); err == nil {
+		if addrs, err := net.LookupHost(name); err == nil && len(addrs) > 0 {
+			return addrs[0]
+		}
+	}
+
+	return "127.0.0.1"
+}
+
+func defaultServiceID(svc Service) string {
+	return svc.Name + "-" + svc.Host + "-" + strconv.Itoa(svc.Port)
+}
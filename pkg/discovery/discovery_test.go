@@ -0,0 +1,119 @@
+package discovery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsulLifecycle(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		mu.Unlock()
+		assert.Equal(t, http.MethodPut, r.Method)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	d, err := NewDiscoveryWithOptions(Service{Name: "blueprint", Host: "10.0.0.1", Port: 3000}, Options{
+		Backend: BackendConsul,
+		Addr:    srv.URL,
+		TTL:     100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, d.Start(ctx))
+
+	// let a few heartbeats go through
+	time.Sleep(180 * time.Millisecond)
+	require.NoError(t, d.Stop(ctx))
+	assert.NoError(t, d.LastError())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, calls["/v1/agent/service/register"])
+	assert.GreaterOrEqual(t, calls["/v1/agent/check/pass/service:blueprint-10.0.0.1-3000"], 2)
+	assert.Equal(t, 1, calls["/v1/agent/service/deregister/blueprint-10.0.0.1-3000"])
+}
+
+func TestEtcdRegisterIPv6(t *testing.T) {
+	var endpoint etcdEndpoint
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/lease/grant":
+			w.Write([]byte(`{"ID":"7"}`))
+		case "/v3/kv/put":
+			var put struct{ Value string }
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&put))
+			value, err := base64.StdEncoding.DecodeString(put.Value)
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(value, &endpoint))
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	svc := Service{ID: "blueprint-1", Name: "blueprint", Host: "fd00::1", Port: 3000}
+	require.NoError(t, NewEtcdRegistry(srv.URL).Register(context.Background(), svc, time.Minute))
+	assert.Equal(t, "[fd00::1]:3000", endpoint.Address)
+}
+
+func TestUnknownBackend(t *testing.T) {
+	_, err := NewDiscoveryWithOptions(Service{Name: "blueprint"}, Options{Backend: "zookeeper"})
+	assert.Error(t, err)
+}
+
+func TestHeartbeatFollowsClock(t *testing.T) {
+	var mu sync.Mutex
+	beats := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/agent/check/pass/service:blueprint-10.0.0.1-3000" {
+			mu.Lock()
+			beats++
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	d, err := NewDiscoveryWithOptions(Service{Name: "blueprint", Host: "10.0.0.1", Port: 3000}, Options{
+		Backend: BackendConsul,
+		Addr:    srv.URL,
+		TTL:     time.Minute,
+		Clock:   clk,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, d.Start(ctx))
+	defer d.Stop(ctx)
+
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return beats
+	}
+
+	// Register passes the check once itself
+	clk.BlockUntil(1)
+	assert.Equal(t, 1, count(), "no heartbeat before half the TTL")
+
+	clk.Advance(30 * time.Second)
+	assert.Eventually(t, func() bool { return count() == 2 }, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,175 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const etcdKeyPrefix = "/services/"
+
+// EtcdRegistry uses the etcd v3 JSON gateway, the instance key is attached
+// to a lease so it disappears when heartbeats stop
+type EtcdRegistry struct {
+	addr   string
+	client *http.Client
+
+	mu    sync.Mutex
+	lease string
+}
+
+type etcdEndpoint struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Address string `json:"address"`
+}
+
+func NewEtcdRegistry(addr string) *EtcdRegistry {
+	if addr == "" {
+		addr = "127.0.0.1:2379"
+	}
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		addr = "http://" + addr
+	}
+
+	return &EtcdRegistry{
+		addr:   strings.TrimRight(addr, "/"),
+		client: &http.Client{Timeout: defaultHTTPTimeout},
+	}
+}
+
+func (e *EtcdRegistry) Register(ctx context.Context, svc Service, ttl time.Duration) error {
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	if err := e.post(ctx, "/v3/lease/grant", map[string]interface{}{"TTL": seconds}, &grant); err != nil {
+		return err
+	}
+	if grant.ID == "" {
+		return fmt.Errorf("etcd lease grant returned no lease id")
+	}
+
+	value, err := json.Marshal(etcdEndpoint{
+		ID:      svc.ID,
+		Name:    svc.Name,
+		Version: svc.Version,
+		Address: net.JoinHostPort(svc.Host, strconv.Itoa(svc.Port)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal etcd endpoint: %w", err)
+	}
+
+	put := map[string]interface{}{
+		"key":   base64.StdEncoding.EncodeToString([]byte(etcdKey(svc))),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": grant.ID,
+	}
+	if err := e.post(ctx, "/v3/kv/put", put, nil); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.lease = grant.ID
+	e.mu.Unlock()
+
+	return nil
+}
+
+func (e *EtcdRegistry) Heartbeat(ctx context.Context, svc Service) error {
+	lease := e.currentLease()
+	if lease == "" {
+		return fmt.Errorf("service %s has no etcd lease", svc.ID)
+	}
+
+	var resp struct {
+		Result struct {
+			TTL string `json:"TTL"`
+		} `json:"result"`
+	}
+	if err := e.post(ctx, "/v3/lease/keepalive", map[string]interface{}{"ID": lease}, &resp); err != nil {
+		return err
+	}
+
+	// etcd answers keepalive on an expired lease with TTL 0 (omitted in JSON)
+	if resp.Result.TTL == "" || resp.Result.TTL == "0" {
+		return fmt.Errorf("etcd lease %s expired", lease)
+	}
+
+	return nil
+}
+
+func (e *EtcdRegistry) Deregister(ctx context.Context, svc Service) error {
+	lease := e.currentLease()
+	if lease == "" {
+		return nil
+	}
+
+	// revoking the lease drops every key attached to it
+	if err := e.post(ctx, "/v3/lease/revoke", map[string]interface{}{"ID": lease}, nil); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.lease = ""
+	e.mu.Unlock()
+
+	return nil
+}
+
+func (e *EtcdRegistry) currentLease() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lease
+}
+
+func (e *EtcdRegistry) post(ctx context.Context, path string, body interface{}, dest interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal etcd request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.addr+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build etcd request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("etcd request %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("etcd request %s returned %d: %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if dest != nil {
+		if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+			return fmt.Errorf("failed to decode etcd response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func etcdKey(svc Service) string {
+	return etcdKeyPrefix + svc.Name + "/" + svc.ID
+}
@@ -0,0 +1,249 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package dispatch hands domain events to the modules of this process
+// that care about them, so the publisher does not depend on its
+// listeners. Handlers subscribe to an event type and assert it back:
+//
+//	d.Subscribe(&OrderPlaced{}, "cache", dispatch.Sync, func(ctx context.Context, e interface{}) error {
+//		return cache.FlushPrefix(ctx, "orders:"+e.(*OrderPlaced).AccountID)
+//	})
+//	d.Subscribe(&OrderPlaced{}, "audit", dispatch.Async, auditOrder)
+//
+//	err := d.Publish(ctx, &OrderPlaced{AccountID: "A1"})
+//
+// Sync handlers run in Publish, one after the other, and their errors are
+// returned to the publisher. Async handlers run later on a queue of their
+// own and only log their errors. Events leave the process through
+// pkg/eventbus, not here.
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultQueue = 1024
+
+// Mode is how a handler is called
+type Mode int
+
+const (
+	// Sync runs the handler in Publish, its error fails the publish
+	Sync Mode = iota
+	// Async queues the event for the handler and returns at once; a full
+	// queue drops it
+	Async
+)
+
+// ErrClosed is returned by Publish after Close
+var ErrClosed = errors.New("dispatcher closed")
+
+var (
+	handled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_dispatch_handled_total",
+		Help: "In-process events handled by event type, handler and result: ok, error, panic or dropped.",
+	}, []string{"event", "handler", "result"})
+	handleDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blueprint_dispatch_handle_duration_seconds",
+		Help:    "Time in in-process event handlers by event type and handler.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 4, 8),
+	}, []string{"event", "handler"})
+)
+
+func init() {
+	prometheus.MustRegister(handled, handleDuration)
+}
+
+// Handler gets the event as it was published
+type Handler func(ctx context.Context, event interface{}) error
+
+type Options struct {
+	// Queue is the buffer of each async handler, 1024 by default
+	Queue int
+}
+
+type subscription struct {
+	name  string
+	mode  Mode
+	h     Handler
+	queue chan queued
+}
+
+type queued struct {
+	ctx   context.Context
+	event interface{}
+	label string
+}
+
+// Dispatcher delivers events by their type. The zero value is not usable,
+// see New.
+type Dispatcher struct {
+	log  *logger.Logger
+	opts Options
+
+	mu     sync.RWMutex
+	subs   map[reflect.Type][]*subscription
+	closed bool
+
+	wg sync.WaitGroup
+}
+
+func New(log *logger.Logger, opts Options) *Dispatcher {
+	if opts.Queue <= 0 {
+		opts.Queue = defaultQueue
+	}
+	return &Dispatcher{log: log, opts: opts, subs: make(map[reflect.Type][]*subscription)}
+}
+
+// Subscribe calls h for every published event of event's type, a struct
+// or a pointer to one; both reach the same handlers, which get whatever
+// was published. name labels the handler in logs and metrics. Subscribe
+// while wiring the process up, there is no unsubscribe.
+func (d *Dispatcher) Subscribe(event interface{}, name string, mode Mode, h Handler) error {
+	t := eventType(event)
+	if t == nil || name == "" || h == nil {
+		return fmt.Errorf("dispatch: subscribe needs an event, a name and a handler")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	for _, sub := range d.subs[t] {
+		if sub.name == name {
+			return fmt.Errorf("dispatch: %s already subscribed to %s", name, t)
+		}
+	}
+
+	sub := &subscription{name: name, mode: mode, h: h}
+	if mode == Async {
+		sub.queue = make(chan queued, d.opts.Queue)
+		d.wg.Add(1)
+		run.Go(d.log, "dispatch "+name, func() {
+			defer d.wg.Done()
+			for q := range sub.queue {
+				d.call(q.ctx, q.label, sub, q.event)
+			}
+		})
+	}
+	d.subs[t] = append(d.subs[t], sub)
+	return nil
+}
+
+// Publish runs the sync handlers of event's type in the order they
+// subscribed and queues it for the async ones. Every sync handler runs
+// even when one fails, their errors are joined.
+func (d *Dispatcher) Publish(ctx context.Context, event interface{}) error {
+	t := eventType(event)
+	if t == nil {
+		return fmt.Errorf("dispatch: %T is no event", event)
+	}
+	label := t.String()
+
+	d.mu.RLock()
+	if d.closed {
+		d.mu.RUnlock()
+		return ErrClosed
+	}
+	subs := d.subs[t]
+	// queued under the read lock so Close never closes a queue in use
+	for _, sub := range subs {
+		if sub.mode != Async {
+			continue
+		}
+		select {
+		case sub.queue <- queued{ctx: context.WithoutCancel(ctx), event: event, label: label}:
+		default:
+			handled.WithLabelValues(label, sub.name, "dropped").Inc()
+			if d.log != nil {
+				d.log.WithContext(ctx).Warnf("Dropping %s for %s, its queue is full", label, sub.name)
+			}
+		}
+	}
+	d.mu.RUnlock()
+
+	var errs []error
+	for _, sub := range subs {
+		if sub.mode == Sync {
+			if err := d.call(ctx, label, sub, event); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", sub.name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// call runs one handler, a panic is its error
+func (d *Dispatcher) call(ctx context.Context, label string, sub *subscription, event interface{}) error {
+	start := time.Now()
+	err := run.Safe(d.log, "dispatch "+sub.name, func() error { return sub.h(ctx, event) })
+	handleDuration.WithLabelValues(label, sub.name).Observe(time.Since(start).Seconds())
+
+	var panicErr *run.PanicError
+	switch {
+	case errors.As(err, &panicErr):
+		handled.WithLabelValues(label, sub.name, "panic").Inc()
+	case err != nil:
+		handled.WithLabelValues(label, sub.name, "error").Inc()
+	default:
+		handled.WithLabelValues(label, sub.name, "ok").Inc()
+		return nil
+	}
+	// the publisher of a sync event gets the error, async ones only show
+	// up here
+	if sub.mode == Async && d.log != nil {
+		d.log.WithContext(ctx).Errorf("Handling %s in %s failed: %v", label, sub.name, err)
+	}
+	return err
+}
+
+// Close refuses new events and waits until the async handlers worked off
+// their queues, or ctx ends
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, subs := range d.subs {
+			for _, sub := range subs {
+				if sub.queue != nil {
+					close(sub.queue)
+				}
+			}
+		}
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	run.Go(d.log, "dispatch_close", func() {
+		d.wg.Wait()
+		close(done)
+	})
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// eventType is the struct type of a struct or a pointer to one, nil for
+// anything else
+func eventType(event interface{}) reflect.Type {
+	t := reflect.TypeOf(event)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,99 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"blueprint/pkg/ctxmeta"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderPlaced struct {
+	AccountID string
+}
+
+type orderCancelled struct {
+	AccountID string
+}
+
+func TestSync(t *testing.T) {
+	d := New(nil, Options{})
+	ctx := context.Background()
+
+	var calls []string
+	require.NoError(t, d.Subscribe(&orderPlaced{}, "cache", Sync, func(ctx context.Context, e interface{}) error {
+		calls = append(calls, "cache "+e.(*orderPlaced).AccountID)
+		return errors.New("redis down")
+	}))
+	require.NoError(t, d.Subscribe(orderPlaced{}, "panics", Sync, func(ctx context.Context, e interface{}) error {
+		calls = append(calls, "panics")
+		panic("boom")
+	}))
+	require.NoError(t, d.Subscribe(&orderCancelled{}, "other", Sync, func(ctx context.Context, e interface{}) error {
+		calls = append(calls, "other")
+		return nil
+	}))
+
+	panics := testutil.ToFloat64(handled.WithLabelValues("dispatch.orderPlaced", "panics", "panic"))
+	err := d.Publish(ctx, &orderPlaced{AccountID: "A1"})
+	assert.ErrorContains(t, err, "cache: redis down")
+	assert.ErrorContains(t, err, "panics: ")
+	assert.Equal(t, []string{"cache A1", "panics"}, calls, "in order, all of them, only this type")
+	assert.Equal(t, panics+1, testutil.ToFloat64(handled.WithLabelValues("dispatch.orderPlaced", "panics", "panic")))
+
+	assert.NoError(t, d.Publish(ctx, &struct{ Unheard bool }{}), "no subscribers")
+	assert.Error(t, d.Publish(ctx, "not a struct"))
+	assert.Error(t, d.Subscribe(&orderPlaced{}, "cache", Sync, func(context.Context, interface{}) error { return nil }), "twice")
+	assert.Error(t, d.Subscribe(7, "ints", Sync, func(context.Context, interface{}) error { return nil }))
+}
+
+func TestAsync(t *testing.T) {
+	d := New(nil, Options{Queue: 1})
+	ctx := ctxmeta.WithRequestID(context.Background(), "req-1")
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var got []string
+	require.NoError(t, d.Subscribe(&orderPlaced{}, "audit", Async, func(ctx context.Context, e interface{}) error {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		id, _ := ctxmeta.RequestID(ctx)
+		got = append(got, e.(*orderPlaced).AccountID+" "+id)
+		return errors.New("only logged")
+	}))
+
+	// one in the handler, one queued, the third has no room
+	dropped := testutil.ToFloat64(handled.WithLabelValues("dispatch.orderPlaced", "audit", "dropped"))
+	require.NoError(t, d.Publish(ctx, &orderPlaced{AccountID: "A1"}))
+	require.Eventually(t, func() bool { return len(d.subs[eventType(orderPlaced{})][0].queue) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, d.Publish(ctx, &orderPlaced{AccountID: "A2"}))
+	require.NoError(t, d.Publish(ctx, &orderPlaced{AccountID: "A3"}), "async errors never reach the publisher")
+	assert.Equal(t, dropped+1, testutil.ToFloat64(handled.WithLabelValues("dispatch.orderPlaced", "audit", "dropped")))
+
+	close(release)
+	require.NoError(t, d.Close(context.Background()), "waits for the queue")
+	assert.Equal(t, []string{"A1 req-1", "A2 req-1"}, got)
+	assert.ErrorIs(t, d.Publish(ctx, &orderPlaced{}), ErrClosed)
+}
+
+func TestCloseTimeout(t *testing.T) {
+	d := New(nil, Options{})
+	release := make(chan struct{})
+	defer close(release)
+	require.NoError(t, d.Subscribe(&orderPlaced{}, "slow", Async, func(context.Context, interface{}) error {
+		<-release
+		return nil
+	}))
+	require.NoError(t, d.Publish(context.Background(), &orderPlaced{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.Close(ctx), context.DeadlineExceeded)
+}
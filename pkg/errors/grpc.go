@@ -0,0 +1,69 @@
+// By Emran A. Hamdan, Lead Architect
+package errors
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const internalMessage = "internal error"
+
+// Sanitize hides the message of errors that may carry internals (sql,
+// hostnames, stack bits). Statuses with client facing codes like
+// InvalidArgument or NotFound pass unchanged, plain Go errors become Internal.
+func Sanitize(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// the wrapping text of a context error is ours, not the client's business
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, context.Canceled.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, context.DeadlineExceeded.Error())
+	}
+
+	// a wrapped typed error still answers with its own message and details
+	var typed *Error
+	if errors.As(err, &typed) {
+		err = typed
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return status.Error(codes.Internal, internalMessage)
+	}
+
+	switch st.Code() {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		return status.Error(st.Code(), internalMessage)
+	}
+	return err
+}
+
+// UnaryServerInterceptor sanitizes handler errors unless verbose. Put it
+// inside the recovery interceptor, crash ids added by recovery must survive.
+func UnaryServerInterceptor(verbose bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if verbose {
+			return resp, err
+		}
+		return resp, Sanitize(err)
+	}
+}
+
+func StreamServerInterceptor(verbose bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		if verbose {
+			return err
+		}
+		return Sanitize(err)
+	}
+}
@@ -0,0 +1,50 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+		msg  string
+	}{
+		{"nil", nil, codes.OK, ""},
+		{"plain error", errors.New("dial tcp 10.0.0.5:5432: refused"), codes.Internal, internalMessage},
+		{"internal", status.Error(codes.Internal, "pq: relation missing"), codes.Internal, internalMessage},
+		{"unknown", status.Error(codes.Unknown, "boom"), codes.Unknown, internalMessage},
+		{"client facing", status.Error(codes.InvalidArgument, "name is required"), codes.InvalidArgument, "name is required"},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), codes.DeadlineExceeded, context.DeadlineExceeded.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(Sanitize(tt.err))
+			assert.Equal(t, tt.code, st.Code())
+			assert.Equal(t, tt.msg, st.Message())
+		})
+	}
+}
+
+func TestUnaryServerInterceptorVerbose(t *testing.T) {
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("secret detail")
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/blueprint.Blueprint/Call"}
+
+	_, err := UnaryServerInterceptor(true)(context.Background(), nil, info, handler)
+	assert.EqualError(t, err, "secret detail")
+
+	_, err = UnaryServerInterceptor(false)(context.Background(), nil, info, handler)
+	assert.Equal(t, internalMessage, status.Convert(err).Message())
+}
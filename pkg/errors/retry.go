@@ -0,0 +1,192 @@
+// By Emran A. Hamdan, Lead Architect
+package errors
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// postgres SQLSTATEs worth another attempt
+var (
+	// the transaction lost a race, running it again usually succeeds
+	pgConflictCodes = map[string]bool{
+		"40001": true, // serialization_failure
+		"40P01": true, // deadlock_detected
+		"55P03": true, // lock_not_available
+	}
+	// the server or connection is going away
+	pgTransientCodes = map[string]bool{
+		"57P01": true, // admin_shutdown
+		"57P02": true, // crash_shutdown
+		"57P03": true, // cannot_connect_now
+		"53300": true, // too_many_connections
+	}
+)
+
+// redis replies that clear up on their own
+var redisTransientPrefixes = []string{"LOADING", "READONLY", "MASTERDOWN", "CLUSTERDOWN", "TRYAGAIN"}
+
+// IsTransient reports failures of the infrastructure that should go away by
+// themselves: network timeouts and resets, gRPC Unavailable, a redis replica
+// still loading, postgres restarting or out of connections. Cancelled
+// contexts are never transient, the caller gave up.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgTransientCodes[pgErr.Code] || strings.HasPrefix(pgErr.Code, "08") // connection_exception
+	}
+
+	for _, prefix := range redisTransientPrefixes {
+		if redis.HasErrorPrefix(err, prefix) {
+			return true
+		}
+	}
+
+	if st, ok := status.FromError(err); ok && st.Code() != codes.Unknown {
+		return st.Code() == codes.Unavailable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	// go-redis keeps its pool errors internal
+	return strings.Contains(err.Error(), "connection pool timeout")
+}
+
+// IsRetryable is IsTransient plus conflicts where running the same operation
+// again is safe and likely to work: postgres deadlocks and serialization
+// failures, gRPC Aborted and ResourceExhausted
+func IsRetryable(err error) bool {
+	if IsTransient(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgConflictCodes[pgErr.Code]
+	}
+
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.Aborted, codes.ResourceExhausted:
+			return true
+		}
+	}
+	return false
+}
+
+// Permanent stops Retry right away, for errors the caller knows are final
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string { return p.err.Error() }
+func (p *permanentError) Unwrap() error { return p.err }
+
+// RetryOptions zero values fall back to DefaultRetry
+type RetryOptions struct {
+	// Attempts including the first call
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Retryable decides which errors get another attempt, IsRetryable by default
+	Retryable func(error) bool
+	// Clock waits between attempts, clock.Real by default
+	Clock clock.Clock
+}
+
+var DefaultRetry = RetryOptions{
+	Attempts:  3,
+	BaseDelay: 100 * time.Millisecond,
+	MaxDelay:  2 * time.Second,
+	Retryable: IsRetryable,
+}
+
+// Retry calls fn until it succeeds, returns a non retryable error or the
+// attempts run out. Delays grow exponentially from BaseDelay with full
+// jitter and never outlive ctx. The last error is returned unwrapped.
+func Retry(ctx context.Context, opts RetryOptions, fn func(ctx context.Context) error) error {
+	opts = opts.withDefaults()
+
+	var err error
+	for attempt := 0; attempt < opts.Attempts; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if !opts.Retryable(err) || attempt == opts.Attempts-1 {
+			return err
+		}
+
+		timer := opts.Clock.NewTimer(opts.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C():
+		}
+	}
+	return err
+}
+
+func (o RetryOptions) withDefaults() RetryOptions {
+	if o.Attempts <= 0 {
+		o.Attempts = DefaultRetry.Attempts
+	}
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = DefaultRetry.BaseDelay
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = DefaultRetry.MaxDelay
+	}
+	if o.Retryable == nil {
+		o.Retryable = DefaultRetry.Retryable
+	}
+	o.Clock = clock.Or(o.Clock)
+	return o
+}
+
+func (o RetryOptions) backoff(attempt int) time.Duration {
+	d := o.BaseDelay << attempt
+	if d <= 0 || d > o.MaxDelay {
+		d = o.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
@@ -0,0 +1,144 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+func (redisError) RedisError()     {}
+
+var _ redis.Error = redisError("")
+
+func TestClassification(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+		retryable bool
+	}{
+		{"nil", nil, false, false},
+		{"cancelled", context.Canceled, false, false},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), false, false},
+		{"pg deadlock", &pgconn.PgError{Code: "40P01"}, false, true},
+		{"pg serialization", fmt.Errorf("tx: %w", &pgconn.PgError{Code: "40001"}), false, true},
+		{"pg connection", &pgconn.PgError{Code: "08006"}, true, true},
+		{"pg unique violation", &pgconn.PgError{Code: "23505"}, false, false},
+		{"redis loading", redisError("LOADING Redis is loading the dataset in memory"), true, true},
+		{"redis wrong type", redisError("WRONGTYPE Operation against a key"), false, false},
+		{"redis pool", errors.New("redis: connection pool timeout"), true, true},
+		{"grpc unavailable", status.Error(codes.Unavailable, "down"), true, true},
+		{"grpc aborted", status.Error(codes.Aborted, "conflict"), false, true},
+		{"grpc invalid", status.Error(codes.InvalidArgument, "bad"), false, false},
+		{"net timeout", &net.OpError{Op: "read", Err: timeoutErr{}}, true, true},
+		{"conn reset", fmt.Errorf("write: %w", syscall.ECONNRESET), true, true},
+		{"plain", errors.New("boom"), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.transient, IsTransient(tt.err), "IsTransient")
+			assert.Equal(t, tt.retryable, IsRetryable(tt.err), "IsRetryable")
+		})
+	}
+}
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+var fast = RetryOptions{Attempts: 4, BaseDelay: time.Microsecond, MaxDelay: time.Millisecond}
+
+func TestRetryUntilSuccess(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), fast, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return status.Error(codes.Unavailable, "down")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetryStopsOnPermanentErrors(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), fast, func(context.Context) error {
+		calls++
+		return status.Error(codes.InvalidArgument, "bad")
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	boom := errors.New("boom")
+	err = Retry(context.Background(), RetryOptions{Attempts: 4, Retryable: func(error) bool { return true }}, func(context.Context) error {
+		calls++
+		return Permanent(boom)
+	})
+	assert.Same(t, boom, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), fast, func(context.Context) error {
+		calls++
+		return syscall.ECONNREFUSED
+	})
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	assert.Equal(t, 4, calls)
+}
+
+func TestRetryRespectsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Retry(ctx, RetryOptions{Attempts: 10, BaseDelay: time.Hour, MaxDelay: time.Hour}, func(context.Context) error {
+		calls++
+		cancel()
+		return status.Error(codes.Unavailable, "down")
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryWaitsOnClock(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	opts := RetryOptions{Attempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour, Clock: clk}
+
+	calls := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- Retry(context.Background(), opts, func(context.Context) error {
+			calls++
+			return status.Error(codes.Unavailable, "down")
+		})
+	}()
+
+	// each backoff is at most MaxDelay, one hour per wait is always enough
+	for i := 0; i < 2; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Hour)
+	}
+
+	assert.Equal(t, codes.Unavailable, status.Code(<-done))
+	assert.Equal(t, 3, calls)
+}
@@ -0,0 +1,195 @@
+// By Emran A. Hamdan, Lead Architect
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Domain goes into every google.rpc.ErrorInfo, set it to the service name
+var Domain = "platform-blueprint"
+
+// Reasons are UPPER_SNAKE_CASE as google.rpc.ErrorInfo asks, clients switch
+// on them instead of parsing messages
+const (
+	ReasonInvalidArgument = "INVALID_ARGUMENT"
+	ReasonNotFound        = "NOT_FOUND"
+	ReasonAlreadyExists   = "ALREADY_EXISTS"
+	ReasonRateLimited     = "RATE_LIMITED"
+	ReasonUnavailable     = "UNAVAILABLE"
+	ReasonInternal        = "INTERNAL"
+)
+
+// FieldViolation becomes a google.rpc.BadRequest entry
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// Error is a gRPC error with machine readable details. Return it from a
+// handler as is, grpc picks up GRPCStatus and sends ErrorInfo, BadRequest
+// and RetryInfo along with the code. The builder methods return copies so
+// package level errors can be shared.
+type Error struct {
+	Code       codes.Code
+	Reason     string
+	Message    string
+	Metadata   map[string]string
+	Violations []FieldViolation
+	RetryAfter time.Duration
+
+	cause error
+}
+
+func New(code codes.Code, reason, message string) *Error {
+	return &Error{Code: code, Reason: reason, Message: message}
+}
+
+func InvalidArgument(message string, violations ...FieldViolation) *Error {
+	e := New(codes.InvalidArgument, ReasonInvalidArgument, message)
+	e.Violations = violations
+	return e
+}
+
+func NotFound(message string) *Error {
+	return New(codes.NotFound, ReasonNotFound, message)
+}
+
+func AlreadyExists(message string) *Error {
+	return New(codes.AlreadyExists, ReasonAlreadyExists, message)
+}
+
+func RateLimited(message string, retryAfter time.Duration) *Error {
+	e := New(codes.ResourceExhausted, ReasonRateLimited, message)
+	e.RetryAfter = retryAfter
+	return e
+}
+
+func Unavailable(message string, retryAfter time.Duration) *Error {
+	e := New(codes.Unavailable, ReasonUnavailable, message)
+	e.RetryAfter = retryAfter
+	return e
+}
+
+func Internal(message string) *Error {
+	return New(codes.Internal, ReasonInternal, message)
+}
+
+// Error includes the cause for logs, clients only ever see Message
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.cause)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Wrap keeps err as the cause for errors.Is/As and logs
+func (e *Error) Wrap(err error) *Error {
+	c := e.clone()
+	c.cause = err
+	return c
+}
+
+func (e *Error) WithMetadata(key, value string) *Error {
+	c := e.clone()
+	c.Metadata = make(map[string]string, len(e.Metadata)+1)
+	for k, v := range e.Metadata {
+		c.Metadata[k] = v
+	}
+	c.Metadata[key] = value
+	return c
+}
+
+func (e *Error) WithField(field, description string) *Error {
+	c := e.clone()
+	c.Violations = append(append([]FieldViolation(nil), e.Violations...), FieldViolation{field, description})
+	return c
+}
+
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	c := e.clone()
+	c.RetryAfter = d
+	return c
+}
+
+func (e *Error) clone() *Error {
+	c := *e
+	return &c
+}
+
+// GRPCStatus is what grpc and status.FromError use to build the response
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.Code, e.Message)
+
+	msgs := []protoadapt.MessageV1{
+		&errdetails.ErrorInfo{
+			Reason:   e.Reason,
+			Domain:   Domain,
+			Metadata: e.Metadata,
+		},
+	}
+
+	if len(e.Violations) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, v := range e.Violations {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			})
+		}
+		msgs = append(msgs, br)
+	}
+
+	if e.RetryAfter > 0 {
+		msgs = append(msgs, &errdetails.RetryInfo{RetryDelay: durationpb.New(e.RetryAfter)})
+	}
+
+	withDetails, err := st.WithDetails(msgs...)
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+// FromError rebuilds an Error from a gRPC error received by a client, ok is
+// false when err carries no ErrorInfo
+func FromError(err error) (*Error, bool) {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed, true
+	}
+
+	st, isStatus := status.FromError(err)
+	if !isStatus {
+		return nil, false
+	}
+
+	e := &Error{Code: st.Code(), Message: st.Message()}
+	found := false
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			e.Reason = d.Reason
+			e.Metadata = d.Metadata
+			found = true
+		case *errdetails.BadRequest:
+			for _, v := range d.FieldViolations {
+				e.Violations = append(e.Violations, FieldViolation{v.Field, v.Description})
+			}
+		case *errdetails.RetryInfo:
+			e.RetryAfter = d.RetryDelay.AsDuration()
+		}
+	}
+	return e, found
+}
@@ -0,0 +1,78 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorDetails(t *testing.T) {
+	err := InvalidArgument("name is required").
+		WithField("name", "must not be empty").
+		WithMetadata("hint", "send a name").
+		WithRetryAfter(time.Second)
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, "name is required", st.Message())
+
+	details := st.Details()
+	require.Len(t, details, 3)
+
+	info := details[0].(*errdetails.ErrorInfo)
+	assert.Equal(t, ReasonInvalidArgument, info.Reason)
+	assert.Equal(t, Domain, info.Domain)
+	assert.Equal(t, map[string]string{"hint": "send a name"}, info.Metadata)
+
+	br := details[1].(*errdetails.BadRequest)
+	assert.Equal(t, "name", br.FieldViolations[0].Field)
+
+	assert.Equal(t, time.Second, details[2].(*errdetails.RetryInfo).RetryDelay.AsDuration())
+}
+
+func TestFromErrorRoundTrip(t *testing.T) {
+	sent := RateLimited("slow down", time.Minute).WithMetadata("limit", "100")
+
+	// what a client gets after the wire
+	received := sent.GRPCStatus().Err()
+
+	got, ok := FromError(received)
+	require.True(t, ok)
+	assert.Equal(t, codes.ResourceExhausted, got.Code)
+	assert.Equal(t, ReasonRateLimited, got.Reason)
+	assert.Equal(t, time.Minute, got.RetryAfter)
+	assert.Equal(t, "100", got.Metadata["limit"])
+
+	_, ok = FromError(status.Error(codes.NotFound, "plain"))
+	assert.False(t, ok)
+}
+
+func TestBuildersDoNotMutate(t *testing.T) {
+	base := NotFound("missing")
+	_ = base.WithMetadata("id", "1").WithField("id", "unknown")
+
+	assert.Nil(t, base.Metadata)
+	assert.Nil(t, base.Violations)
+}
+
+func TestWrapKeepsCauseOutOfStatus(t *testing.T) {
+	cause := errors.New("pq: connection refused to 10.0.0.5")
+	err := Unavailable("database unavailable", time.Second).Wrap(cause)
+
+	assert.ErrorIs(t, err, cause)
+	assert.Contains(t, err.Error(), "10.0.0.5")
+	assert.Equal(t, "database unavailable", status.Convert(err).Message())
+
+	// wrapping again must not leak the cause either
+	st := status.Convert(Sanitize(fmt.Errorf("handler: %w", err)))
+	assert.Equal(t, "database unavailable", st.Message())
+	assert.Len(t, st.Details(), 2)
+}
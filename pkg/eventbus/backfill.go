@@ -0,0 +1,394 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package eventbus
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultBackfillBatch    = 100
+	defaultCheckpointPrefix = "backfill:"
+
+	// BackfillExtension names the backfill on every event it publishes, so
+	// consumers can skip side effects like notifications
+	BackfillExtension = "backfill"
+)
+
+var backfilled = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_eventbus_backfilled_total",
+	Help: "Historical events published by backfills, by backfill name.",
+}, []string{"name"})
+
+func init() {
+	prometheus.MustRegister(backfilled)
+}
+
+// Source reads historical events in order. Read returns up to limit events
+// after cursor, "" being the start, and the cursor after the last of them;
+// no events means the source is exhausted.
+type Source interface {
+	Read(ctx context.Context, cursor string, limit int) ([]*Event, string, error)
+}
+
+// Checkpoint is how far a backfill got
+type Checkpoint struct {
+	Cursor    string
+	Published int64
+	UpdatedAt time.Time
+	// Done is set once the source had nothing more to read
+	Done bool
+}
+
+// Checkpoints keeps the progress of backfills by name so a stopped one
+// resumes where it left off. Load returns a zero Checkpoint for names never
+// saved.
+type Checkpoints interface {
+	Load(ctx context.Context, name string) (Checkpoint, error)
+	Save(ctx context.Context, name string, cp Checkpoint) error
+	Reset(ctx context.Context, name string) error
+}
+
+type BackfillOptions struct {
+	// Name keys the checkpoint and labels the metric
+	Name  string
+	Topic string
+	// Rate caps published events per second, 0 publishes as fast as the bus
+	// takes them
+	Rate float64
+	// Batch is the events read, published and checkpointed at once, 100 by
+	// default
+	Batch int
+	// Checkpoints nil starts over on every run
+	Checkpoints Checkpoints
+	// Progress is called after every checkpoint
+	Progress func(Checkpoint)
+	Clock    clock.Clock
+	Log      *logger.Logger
+}
+
+// Backfill republishes the events of src on a topic at a bounded rate,
+// to rebuild caches and projections from history. The checkpoint is saved
+// after each published batch; a crash in between publishes that batch
+// again. Events keep their ids, so Idempotent consumers skip what they
+// already handled; rebuild a projection under a new scope.
+func Backfill(ctx context.Context, bus Bus, src Source, opts BackfillOptions) (Checkpoint, error) {
+	if opts.Name == "" || opts.Topic == "" {
+		return Checkpoint{}, errors.New("backfill: name and topic are required")
+	}
+	if opts.Batch <= 0 {
+		opts.Batch = defaultBackfillBatch
+	}
+	clk := clock.Or(opts.Clock)
+
+	var cp Checkpoint
+	if opts.Checkpoints != nil {
+		var err error
+		if cp, err = opts.Checkpoints.Load(ctx, opts.Name); err != nil {
+			return cp, fmt.Errorf("backfill %s: loading checkpoint: %w", opts.Name, err)
+		}
+		// a finished backfill runs again from its end, picking up what the
+		// source gained since
+		cp.Done = false
+		if cp.Cursor != "" && opts.Log != nil {
+			opts.Log.Infof("Backfill %s resumes after %s, %d published", opts.Name, cp.Cursor, cp.Published)
+		}
+	}
+
+	// the rate is kept over the whole run, not per batch, so slow reads
+	// are made up for
+	start, sent := clk.Now(), int64(0)
+	for {
+		batch := opts.Batch
+		if opts.Rate > 0 && float64(batch) > opts.Rate {
+			batch = int(opts.Rate)
+			if batch < 1 {
+				batch = 1
+			}
+		}
+		events, next, err := src.Read(ctx, cp.Cursor, batch)
+		if err != nil {
+			return cp, fmt.Errorf("backfill %s: reading after %q: %w", opts.Name, cp.Cursor, err)
+		}
+		if len(events) == 0 {
+			cp.Done = true
+			return cp, saveCheckpoint(ctx, clk, opts, &cp)
+		}
+
+		if opts.Rate > 0 {
+			due := start.Add(time.Duration(float64(sent) / opts.Rate * float64(time.Second)))
+			if wait := due.Sub(clk.Now()); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return cp, ctx.Err()
+				case <-clk.After(wait):
+				}
+			}
+		}
+
+		for _, e := range events {
+			if e.Extensions == nil {
+				e.Extensions = make(map[string]string)
+			}
+			e.Extensions[BackfillExtension] = opts.Name
+		}
+		if err := bus.Publish(ctx, opts.Topic, events...); err != nil {
+			return cp, fmt.Errorf("backfill %s: publishing after %q: %w", opts.Name, cp.Cursor, err)
+		}
+		backfilled.WithLabelValues(opts.Name).Add(float64(len(events)))
+		sent += int64(len(events))
+		cp.Cursor = next
+		cp.Published += int64(len(events))
+		if err := saveCheckpoint(ctx, clk, opts, &cp); err != nil {
+			return cp, err
+		}
+	}
+}
+
+func saveCheckpoint(ctx context.Context, clk clock.Clock, opts BackfillOptions, cp *Checkpoint) error {
+	cp.UpdatedAt = clk.Now().UTC()
+	if opts.Checkpoints != nil {
+		// a checkpoint lost to cancellation repeats a batch, keep it
+		if err := opts.Checkpoints.Save(context.WithoutCancel(ctx), opts.Name, *cp); err != nil {
+			return fmt.Errorf("backfill %s: saving checkpoint: %w", opts.Name, err)
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(*cp)
+	}
+	return nil
+}
+
+// querier is the part of *sql.DB an SQLSource needs
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// SQLSource reads events from the database. Query takes the cursor as $1
+// and the limit as $2 and selects, in order, a text cursor, id, type,
+// version (0 for the latest), occurred_at, key and the JSON data, e.g.
+//
+//	SELECT id::text, 'order-' || id, 'order.placed', 1, created_at, account_id, to_jsonb(o)
+//	FROM orders o WHERE id > $1::bigint ORDER BY id LIMIT $2
+//
+// Start is the cursor of the first read, "0" in the example.
+type SQLSource struct {
+	DB    querier
+	Query string
+	Start string
+}
+
+func (s *SQLSource) Read(ctx context.Context, cursor string, limit int) ([]*Event, string, error) {
+	if cursor == "" {
+		cursor = s.Start
+	}
+	rows, err := s.DB.QueryContext(ctx, s.Query, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		var (
+			e    Event
+			key  sql.NullString
+			data []byte
+		)
+		if err := rows.Scan(&cursor, &e.ID, &e.Type, &e.Version, &e.OccurredAt, &key, &data); err != nil {
+			return nil, "", err
+		}
+		e.Key, e.Data = key.String, data
+		e.OccurredAt = e.OccurredAt.UTC()
+		events = append(events, &e)
+	}
+	return events, cursor, rows.Err()
+}
+
+// ArchiveSource reads an archive file with one event per line as the JSON
+// or CloudEvents JSON codec writes them, gzipped when Path ends in .gz. The
+// cursor is the number of lines read.
+type ArchiveSource struct {
+	Path string
+
+	file  *os.File
+	lines *bufio.Reader
+	line  int
+}
+
+func (s *ArchiveSource) Read(ctx context.Context, cursor string, limit int) ([]*Event, string, error) {
+	from := 0
+	if cursor != "" {
+		n, err := strconv.Atoi(cursor)
+		if err != nil || n < 0 {
+			return nil, "", fmt.Errorf("archive cursor %q is no line number", cursor)
+		}
+		from = n
+	}
+	// resuming elsewhere than where the last read ended reopens the file
+	if s.lines == nil || s.line != from {
+		if err := s.open(from); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var events []*Event
+	for len(events) < limit {
+		raw, err := s.lines.ReadBytes('\n')
+		if len(bytes.TrimSpace(raw)) > 0 {
+			s.line++
+			e, derr := decodeArchived(raw)
+			if derr != nil {
+				return nil, "", fmt.Errorf("%s line %d: %w", s.Path, s.line, derr)
+			}
+			events = append(events, e)
+		} else if len(raw) > 0 {
+			s.line++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return events, strconv.Itoa(s.line), nil
+}
+
+// Close releases the file
+func (s *ArchiveSource) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file, s.lines = nil, nil
+	return err
+}
+
+func (s *ArchiveSource) open(skip int) error {
+	s.Close()
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	var r io.Reader = f
+	if strings.HasSuffix(s.Path, ".gz") {
+		if r, err = gzip.NewReader(f); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	s.file, s.lines, s.line = f, bufio.NewReaderSize(r, 64<<10), 0
+	for s.line < skip {
+		raw, err := s.lines.ReadBytes('\n')
+		if len(raw) > 0 {
+			s.line++
+		}
+		if err == io.EOF && s.line < skip {
+			return fmt.Errorf("%s has %d lines, cursor is %d", s.Path, s.line, skip)
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeArchived tells CloudEvents from the plain envelope by specversion
+func decodeArchived(raw []byte) (*Event, error) {
+	if bytes.Contains(raw, []byte(`"specversion"`)) {
+		return CloudEventsJSON.Unmarshal(raw)
+	}
+	return JSON.Unmarshal(raw)
+}
+
+// RedisCheckpoints keeps checkpoints as hashes under prefix
+type RedisCheckpoints struct {
+	rdb    *goredis.Client
+	prefix string
+}
+
+// NewRedisCheckpoints keeps checkpoints under prefix, "backfill:" when empty
+func NewRedisCheckpoints(rdb *goredis.Client, prefix string) *RedisCheckpoints {
+	if prefix == "" {
+		prefix = defaultCheckpointPrefix
+	}
+	return &RedisCheckpoints{rdb: rdb, prefix: prefix}
+}
+
+func (c *RedisCheckpoints) Load(ctx context.Context, name string) (Checkpoint, error) {
+	fields, err := c.rdb.HGetAll(ctx, c.prefix+name).Result()
+	if err != nil || len(fields) == 0 {
+		return Checkpoint{}, err
+	}
+	cp := Checkpoint{Cursor: fields["cursor"], Done: fields["done"] == "1"}
+	cp.Published, _ = strconv.ParseInt(fields["published"], 10, 64)
+	if ms, err := strconv.ParseInt(fields["updated_at"], 10, 64); err == nil {
+		cp.UpdatedAt = time.UnixMilli(ms).UTC()
+	}
+	return cp, nil
+}
+
+func (c *RedisCheckpoints) Save(ctx context.Context, name string, cp Checkpoint) error {
+	done := "0"
+	if cp.Done {
+		done = "1"
+	}
+	return c.rdb.HSet(ctx, c.prefix+name,
+		"cursor", cp.Cursor,
+		"published", cp.Published,
+		"updated_at", cp.UpdatedAt.UnixMilli(),
+		"done", done,
+	).Err()
+}
+
+func (c *RedisCheckpoints) Reset(ctx context.Context, name string) error {
+	return c.rdb.Del(ctx, c.prefix+name).Err()
+}
+
+// MemoryCheckpoints is Checkpoints for one process and tests
+type MemoryCheckpoints struct {
+	mu  sync.Mutex
+	cps map[string]Checkpoint
+}
+
+func NewMemoryCheckpoints() *MemoryCheckpoints {
+	return &MemoryCheckpoints{cps: make(map[string]Checkpoint)}
+}
+
+func (c *MemoryCheckpoints) Load(ctx context.Context, name string) (Checkpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cps[name], nil
+}
+
+func (c *MemoryCheckpoints) Save(ctx context.Context, name string, cp Checkpoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cps[name] = cp
+	return nil
+}
+
+func (c *MemoryCheckpoints) Reset(ctx context.Context, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.cps, name)
+	return nil
+}
@@ -0,0 +1,253 @@
+package eventbus
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/db"
+	"blueprint/pkg/testsupport"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceSource reads events from memory, failing once at failAt when set
+type sliceSource struct {
+	events []*Event
+	failAt int
+}
+
+func (s *sliceSource) Read(ctx context.Context, cursor string, limit int) ([]*Event, string, error) {
+	from := 0
+	if cursor != "" {
+		from, _ = strconv.Atoi(cursor)
+	}
+	if s.failAt > 0 && from >= s.failAt {
+		s.failAt = 0
+		return nil, "", errors.New("connection reset")
+	}
+	to := from + limit
+	if to > len(s.events) {
+		to = len(s.events)
+	}
+	var out []*Event
+	for _, e := range s.events[from:to] {
+		c := *e
+		out = append(out, &c)
+	}
+	return out, strconv.Itoa(to), nil
+}
+
+func historicEvents(n int) []*Event {
+	events := make([]*Event, n)
+	for i := range events {
+		events[i] = &Event{ID: fmt.Sprintf("e-%d", i), Type: "order.placed", Data: []byte(`{}`)}
+	}
+	return events
+}
+
+func TestBackfillResumes(t *testing.T) {
+	bus := NewMemory(Options{})
+	defer bus.Close()
+	ctx := context.Background()
+	in := &inbox{}
+	require.NoError(t, bus.Subscribe(ctx, "orders", "projection", in.handle))
+
+	src := &sliceSource{events: historicEvents(7), failAt: 4}
+	checkpoints := NewMemoryCheckpoints()
+	opts := BackfillOptions{Name: "orders-v2", Topic: "orders", Batch: 2, Checkpoints: checkpoints}
+	before := testutil.ToFloat64(backfilled.WithLabelValues("orders-v2"))
+
+	cp, err := Backfill(ctx, bus, src, opts)
+	assert.ErrorContains(t, err, "connection reset")
+	assert.Equal(t, Checkpoint{Cursor: "4", Published: 4, UpdatedAt: cp.UpdatedAt}, cp)
+
+	var progress []int64
+	opts.Progress = func(cp Checkpoint) { progress = append(progress, cp.Published) }
+	cp, err = Backfill(ctx, bus, src, opts)
+	require.NoError(t, err)
+	assert.True(t, cp.Done)
+	assert.Equal(t, int64(7), cp.Published)
+	assert.Equal(t, []int64{6, 7, 7}, progress)
+	saved, err := checkpoints.Load(ctx, "orders-v2")
+	require.NoError(t, err)
+	assert.Equal(t, cp, saved)
+
+	got := in.waitFor(t, 7)
+	for i, e := range got {
+		assert.Equal(t, fmt.Sprintf("e-%d", i), e.ID, "in order, once each")
+		assert.Equal(t, "orders-v2", e.Extensions[BackfillExtension])
+	}
+	assert.Equal(t, before+7, testutil.ToFloat64(backfilled.WithLabelValues("orders-v2")))
+
+	// a finished backfill picks up what was added since
+	src.events = historicEvents(8)
+	cp, err = Backfill(ctx, bus, src, opts)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), cp.Published)
+	assert.Equal(t, "e-7", in.waitFor(t, 8)[7].ID)
+}
+
+func TestBackfillRate(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	bus := NewMemory(Options{})
+	defer bus.Close()
+	ctx := context.Background()
+
+	var published []int64
+	done := make(chan error, 1)
+	go func() {
+		_, err := Backfill(ctx, bus, &sliceSource{events: historicEvents(25)}, BackfillOptions{
+			Name: "rate", Topic: "orders", Rate: 10, Clock: fake,
+			Progress: func(cp Checkpoint) { published = append(published, cp.Published) },
+		})
+		done <- err
+	}()
+
+	// batches shrink to a second of events, the first goes out at once
+	fake.BlockUntil(1)
+	fake.Advance(999 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("finished early")
+	default:
+	}
+	fake.Advance(time.Millisecond)
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	require.NoError(t, <-done)
+	assert.Equal(t, []int64{10, 20, 25, 25}, published)
+}
+
+func TestBackfillCancel(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	bus := NewMemory(Options{})
+	defer bus.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	checkpoints := NewMemoryCheckpoints()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Backfill(ctx, bus, &sliceSource{events: historicEvents(5)}, BackfillOptions{
+			Name: "cancel", Topic: "orders", Rate: 2, Clock: fake, Checkpoints: checkpoints,
+		})
+		done <- err
+	}()
+	fake.BlockUntil(1)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	cp, err := checkpoints.Load(context.Background(), "cancel")
+	require.NoError(t, err)
+	assert.Equal(t, "2", cp.Cursor, "the first batch is kept")
+}
+
+func writeArchive(t *testing.T, name string, lines ...string) string {
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	if filepath.Ext(name) == ".gz" {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		for _, line := range lines {
+			_, err = gz.Write([]byte(line + "\n"))
+			require.NoError(t, err)
+		}
+		return path
+	}
+	for _, line := range lines {
+		_, err = f.WriteString(line + "\n")
+		require.NoError(t, err)
+	}
+	return path
+}
+
+func TestArchiveSource(t *testing.T) {
+	ce, err := CloudEventsJSON.Marshal(&Event{ID: "e-3", Type: "order.placed", Source: "blueprint", Data: []byte(`{}`)})
+	require.NoError(t, err)
+	lines := []string{
+		`{"id":"e-1","type":"order.placed","data":{}}`,
+		``,
+		`{"id":"e-2","type":"order.placed","data":{}}`,
+		string(ce),
+	}
+	for _, name := range []string{"orders.jsonl", "orders.jsonl.gz"} {
+		t.Run(name, func(t *testing.T) {
+			src := &ArchiveSource{Path: writeArchive(t, name, lines...)}
+			defer src.Close()
+			ctx := context.Background()
+
+			events, cursor, err := src.Read(ctx, "", 2)
+			require.NoError(t, err)
+			require.Len(t, events, 2)
+			assert.Equal(t, "e-2", events[1].ID)
+			assert.Equal(t, "3", cursor, "blank lines count")
+
+			// a new process resumes at the cursor
+			again := &ArchiveSource{Path: src.Path}
+			defer again.Close()
+			events, cursor, err = again.Read(ctx, cursor, 2)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, "e-3", events[0].ID)
+			assert.Equal(t, "blueprint", events[0].Source)
+			events, _, err = again.Read(ctx, cursor, 2)
+			require.NoError(t, err)
+			assert.Empty(t, events)
+
+			_, _, err = again.Read(ctx, "9", 2)
+			assert.ErrorContains(t, err, "has 4 lines")
+		})
+	}
+
+	src := &ArchiveSource{Path: writeArchive(t, "bad.jsonl", `{"id":"e-1"}`, `not json`)}
+	defer src.Close()
+	_, _, err = src.Read(context.Background(), "", 10)
+	assert.ErrorContains(t, err, "bad.jsonl line 2")
+}
+
+func TestSQLSource(t *testing.T) {
+	pg, err := db.NewPostgresDB(&config.Config{Postgres: testsupport.Postgres(t)}, nil)
+	require.NoError(t, err)
+	defer pg.Close()
+	sqlDB, err := pg.DB.DB()
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// no temp table, the pool may run each query on another connection
+	_, err = sqlDB.ExecContext(ctx, `CREATE TABLE backfill_orders (id bigint PRIMARY KEY, account text, created_at timestamptz, amount int)`)
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.ExecContext(ctx, `DROP TABLE backfill_orders`) })
+	_, err = sqlDB.ExecContext(ctx, `INSERT INTO backfill_orders VALUES (1, 'A1', '2024-03-01T12:00:00Z', 5), (2, NULL, '2024-03-02T12:00:00Z', 7), (3, 'A1', '2024-03-03T12:00:00Z', 9)`)
+	require.NoError(t, err)
+
+	src := &SQLSource{DB: sqlDB, Start: "0", Query: `
+		SELECT id::text, 'order-' || id, 'order.placed', 0, created_at, account, jsonb_build_object('amount', amount)
+		FROM backfill_orders WHERE id > $1::bigint ORDER BY id LIMIT $2`}
+	events, cursor, err := src.Read(ctx, "", 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "2", cursor)
+	assert.Equal(t, "order-1", events[0].ID)
+	assert.Equal(t, "A1", events[0].Key)
+	assert.Equal(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), events[0].OccurredAt)
+	assert.JSONEq(t, `{"amount":5}`, string(events[0].Data))
+	assert.Empty(t, events[1].Key)
+
+	events, cursor, err = src.Read(ctx, cursor, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	events, _, err = src.Read(ctx, cursor, 2)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
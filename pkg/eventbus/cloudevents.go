@@ -0,0 +1,309 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package eventbus
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"blueprint/pkg/ctxmeta"
+	cepb "blueprint/proto/cloudevents"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// CloudEvents 1.0 (https://github.com/cloudevents/spec) in structured
+// mode. Event fields map to the context attributes id, source, type and
+// time, Data is "data" with datacontenttype application/json, and the rest
+// travels as extension attributes:
+//
+//	traceparent   W3C trace context of TraceID, traceid when TraceID is
+//	              no W3C trace id
+//	requestid     RequestID
+//	tenantid      TenantID
+//	partitionkey  Key, the partitioning extension
+//	dataversion   Version, the schema version of data
+//
+// Other attributes, like subject or a producer's own extensions, end up
+// in Event.Extensions and are written back as they came.
+
+const ceSpecVersion = "1.0"
+
+// attributes this package maps to Event fields
+const (
+	ceTraceParent  = "traceparent"
+	ceTraceID      = "traceid"
+	ceRequestID    = "requestid"
+	ceTenantID     = "tenantid"
+	cePartitionKey = "partitionkey"
+	ceDataVersion  = "dataversion"
+)
+
+var errSpecVersion = errors.New("cloudevent: specversion must be " + ceSpecVersion)
+
+// ceExtensions are the extension attributes of e
+func ceExtensions(e *Event) map[string]string {
+	ext := make(map[string]string, len(e.Extensions)+4)
+	for name, value := range e.Extensions {
+		ext[name] = value
+	}
+	if isW3CTraceID(e.TraceID) {
+		ext[ceTraceParent] = "00-" + e.TraceID + "-" + parentID(e.ID) + "-01"
+	} else if e.TraceID != "" {
+		ext[ceTraceID] = e.TraceID
+	}
+	set := func(name, value string) {
+		if value != "" {
+			ext[name] = value
+		}
+	}
+	set(ceRequestID, e.RequestID)
+	set(ceTenantID, e.TenantID)
+	set(cePartitionKey, e.Key)
+	if e.Version > 0 {
+		ext[ceDataVersion] = strconv.Itoa(e.Version)
+	}
+	return ext
+}
+
+// setCEExtension stores a received extension attribute on e
+func setCEExtension(e *Event, name, value string) {
+	switch name {
+	case ceTraceParent:
+		if e.TraceID == "" {
+			e.TraceID = ctxmeta.TraceIDFromTraceParent(value)
+		}
+	case ceTraceID:
+		e.TraceID = value
+	case ceRequestID:
+		e.RequestID = value
+	case ceTenantID:
+		e.TenantID = value
+	case cePartitionKey:
+		e.Key = value
+	case ceDataVersion:
+		if v, err := strconv.Atoi(value); err == nil {
+			e.Version = v
+			return
+		}
+		fallthrough
+	default:
+		if e.Extensions == nil {
+			e.Extensions = make(map[string]string)
+		}
+		e.Extensions[name] = value
+	}
+}
+
+func isW3CTraceID(id string) bool {
+	if len(id) != 32 || strings.Trim(id, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
+
+// parentID is the span id of a traceparent, the event stands for the span
+// that published it
+func parentID(eventID string) string {
+	if len(eventID) >= 16 {
+		if _, err := hex.DecodeString(eventID[:16]); err == nil && strings.Trim(eventID[:16], "0") != "" {
+			return strings.ToLower(eventID[:16])
+		}
+	}
+	return ctxmeta.NewID()[:16]
+}
+
+func checkRequired(e *Event) error {
+	if e.ID == "" || e.Source == "" || e.Type == "" {
+		return fmt.Errorf("cloudevent: id, source and type are required")
+	}
+	return nil
+}
+
+type cloudEventsJSON struct{}
+
+func (cloudEventsJSON) ContentType() string { return ContentTypeCloudEventsJSON }
+
+func (cloudEventsJSON) Marshal(e *Event) ([]byte, error) {
+	if err := checkRequired(e); err != nil {
+		return nil, err
+	}
+	return json.Marshal(ceDocument(e))
+}
+
+func (cloudEventsJSON) MarshalAppend(buf []byte, e *Event) ([]byte, error) {
+	if err := checkRequired(e); err != nil {
+		return buf, err
+	}
+	return appendJSON(buf, ceDocument(e))
+}
+
+// ceDocument is e in the JSON format
+func ceDocument(e *Event) map[string]interface{} {
+	doc := map[string]interface{}{
+		"specversion": ceSpecVersion,
+		"id":          e.ID,
+		"source":      e.Source,
+		"type":        e.Type,
+	}
+	if !e.OccurredAt.IsZero() {
+		doc["time"] = e.OccurredAt.UTC().Format(time.RFC3339Nano)
+	}
+	if len(e.Data) > 0 {
+		doc["datacontenttype"] = ContentTypeJSON
+		doc["data"] = e.Data
+	}
+	for name, value := range ceExtensions(e) {
+		doc[name] = value
+	}
+	return doc
+}
+
+func (cloudEventsJSON) Unmarshal(data []byte) (*Event, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("cloudevent: %w", err)
+	}
+
+	attr := func(name string) string {
+		var s string
+		if raw, ok := doc[name]; ok && json.Unmarshal(raw, &s) != nil {
+			// extensions may be numbers or booleans, keep their text
+			s = string(raw)
+		}
+		return s
+	}
+	if attr("specversion") != ceSpecVersion {
+		return nil, errSpecVersion
+	}
+
+	e := &Event{ID: attr("id"), Source: attr("source"), Type: attr("type")}
+	if err := checkRequired(e); err != nil {
+		return nil, err
+	}
+	if t := attr("time"); t != "" {
+		at, err := time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return nil, fmt.Errorf("cloudevent %s: time: %w", e.ID, err)
+		}
+		e.OccurredAt = at
+	}
+	// data is JSON whatever its content type, binary data comes base64
+	// encoded, a JSON string Decode turns back into []byte
+	if raw, ok := doc["data"]; ok {
+		e.Data = raw
+	} else if raw, ok := doc["data_base64"]; ok {
+		e.Data = raw
+	}
+
+	for name := range doc {
+		switch name {
+		case "specversion", "id", "source", "type", "time", "datacontenttype", "data", "data_base64":
+			continue
+		}
+		setCEExtension(e, name, attr(name))
+	}
+	return e, nil
+}
+
+type cloudEventsProto struct{}
+
+func (cloudEventsProto) ContentType() string { return ContentTypeCloudEventsProto }
+
+func (cloudEventsProto) Marshal(e *Event) ([]byte, error) {
+	if err := checkRequired(e); err != nil {
+		return nil, err
+	}
+	m := getCEMessage()
+	defer putCEMessage(m)
+	return proto.Marshal(m.fill(e))
+}
+
+func (cloudEventsProto) Unmarshal(data []byte) (*Event, error) {
+	var pe cepb.CloudEvent
+	if err := proto.Unmarshal(data, &pe); err != nil {
+		return nil, fmt.Errorf("cloudevent: %w", err)
+	}
+	if pe.GetSpecVersion() != ceSpecVersion {
+		return nil, errSpecVersion
+	}
+
+	e := &Event{ID: pe.GetId(), Source: pe.GetSource(), Type: pe.GetType()}
+	if err := checkRequired(e); err != nil {
+		return nil, err
+	}
+
+	var contentType string
+	for name, value := range pe.GetAttributes() {
+		switch name {
+		case "time":
+			if ts := value.GetCeTimestamp(); ts != nil {
+				e.OccurredAt = ts.AsTime()
+			} else if at, err := time.Parse(time.RFC3339Nano, ceAttrString(value)); err == nil {
+				e.OccurredAt = at
+			}
+		case "datacontenttype":
+			contentType = ceAttrString(value)
+		default:
+			setCEExtension(e, name, ceAttrString(value))
+		}
+	}
+
+	var err error
+	switch d := pe.GetData().(type) {
+	case *cepb.CloudEvent_TextData:
+		if contentType == "" || isJSONContentType(contentType) {
+			e.Data = json.RawMessage(d.TextData)
+		} else {
+			e.Data, err = json.Marshal(d.TextData)
+		}
+	case *cepb.CloudEvent_BinaryData:
+		e.Data, err = json.Marshal(d.BinaryData)
+	case *cepb.CloudEvent_ProtoData:
+		e.Data, err = protojson.Marshal(d.ProtoData)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cloudevent %s: data: %w", e.ID, err)
+	}
+	return e, nil
+}
+
+func ceString(s string) *cepb.CloudEvent_CloudEventAttributeValue {
+	return &cepb.CloudEvent_CloudEventAttributeValue{
+		Attr: &cepb.CloudEvent_CloudEventAttributeValue_CeString{CeString: s},
+	}
+}
+
+// ceAttrString is the canonical string form of an attribute value
+func ceAttrString(v *cepb.CloudEvent_CloudEventAttributeValue) string {
+	switch a := v.GetAttr().(type) {
+	case *cepb.CloudEvent_CloudEventAttributeValue_CeBoolean:
+		return strconv.FormatBool(a.CeBoolean)
+	case *cepb.CloudEvent_CloudEventAttributeValue_CeInteger:
+		return strconv.Itoa(int(a.CeInteger))
+	case *cepb.CloudEvent_CloudEventAttributeValue_CeString:
+		return a.CeString
+	case *cepb.CloudEvent_CloudEventAttributeValue_CeBytes:
+		b, _ := json.Marshal(a.CeBytes)
+		return strings.Trim(string(b), `"`)
+	case *cepb.CloudEvent_CloudEventAttributeValue_CeUri:
+		return a.CeUri
+	case *cepb.CloudEvent_CloudEventAttributeValue_CeUriRef:
+		return a.CeUriRef
+	case *cepb.CloudEvent_CloudEventAttributeValue_CeTimestamp:
+		return a.CeTimestamp.AsTime().Format(time.RFC3339Nano)
+	}
+	return ""
+}
+
+func isJSONContentType(ct string) bool {
+	ct, _, _ = strings.Cut(ct, ";")
+	ct = strings.TrimSpace(ct)
+	return ct == "application/json" || ct == "text/json" || strings.HasSuffix(ct, "+json")
+}
@@ -0,0 +1,136 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	cepb "blueprint/proto/cloudevents"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func sampleEvent() *Event {
+	return &Event{
+		ID:         "0af7651916cd43dd8448eb211c80319c",
+		Type:       "order.placed",
+		Version:    2,
+		Source:     "blueprint",
+		OccurredAt: time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC),
+		Key:        "A1",
+		TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		RequestID:  "req-1",
+		TenantID:   "acme",
+		Extensions: map[string]string{"subject": "o-1"},
+		Data:       []byte(`{"id":"o-1","amount":5}`),
+	}
+}
+
+func TestCloudEventsRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{JSON, CloudEventsJSON, CloudEventsProto} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			e := sampleEvent()
+			data, err := codec.Marshal(e)
+			require.NoError(t, err)
+
+			got, err := decode(codec.ContentType(), data)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(e.Data), string(got.Data))
+			got.Data = e.Data
+			assert.True(t, e.OccurredAt.Equal(got.OccurredAt))
+			got.OccurredAt = e.OccurredAt
+			assert.Equal(t, e, got)
+		})
+	}
+}
+
+func TestCloudEventsJSONAttributes(t *testing.T) {
+	data, err := CloudEventsJSON.Marshal(sampleEvent())
+	require.NoError(t, err)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, "1.0", doc["specversion"])
+	assert.Equal(t, "application/json", doc["datacontenttype"])
+	assert.Equal(t, "2024-03-01T12:00:00.0000005Z", doc["time"])
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-0af7651916cd43dd-01", doc["traceparent"])
+	assert.Equal(t, "acme", doc["tenantid"])
+	assert.Equal(t, "A1", doc["partitionkey"])
+	assert.Equal(t, "2", doc["dataversion"])
+	assert.Equal(t, map[string]interface{}{"id": "o-1", "amount": float64(5)}, doc["data"])
+
+	// trace ids that are no W3C trace id travel as they are
+	e := sampleEvent()
+	e.TraceID = "trace-1"
+	data, err = CloudEventsJSON.Marshal(e)
+	require.NoError(t, err)
+	got, err := CloudEventsJSON.Unmarshal(data)
+	require.NoError(t, err)
+	assert.Equal(t, "trace-1", got.TraceID)
+}
+
+func TestCloudEventsJSONFromOtherProducers(t *testing.T) {
+	got, err := CloudEventsJSON.Unmarshal([]byte(`{
+		"specversion": "1.0",
+		"id": "A234-1234-1234",
+		"source": "https://github.com/cloudevents/spec/pull",
+		"type": "com.github.pull_request.opened",
+		"time": "2018-04-05T17:31:00Z",
+		"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"comexampleextension": 5,
+		"datacontenttype": "application/octet-stream",
+		"data_base64": "aGVsbG8="
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "com.github.pull_request.opened", got.Type)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", got.TraceID)
+	assert.Equal(t, map[string]string{"comexampleextension": "5"}, got.Extensions)
+	assert.Equal(t, time.Date(2018, 4, 5, 17, 31, 0, 0, time.UTC), got.OccurredAt)
+
+	var payload []byte
+	require.NoError(t, got.Decode(&payload))
+	assert.Equal(t, "hello", string(payload))
+
+	_, err = CloudEventsJSON.Unmarshal([]byte(`{"specversion":"0.3","id":"1","source":"s","type":"t"}`))
+	assert.ErrorIs(t, err, errSpecVersion)
+	_, err = CloudEventsJSON.Unmarshal([]byte(`{"specversion":"1.0","id":"1","type":"t"}`))
+	assert.Error(t, err)
+}
+
+func TestCloudEventsProtoData(t *testing.T) {
+	pe := &cepb.CloudEvent{
+		Id: "1", Source: "s", SpecVersion: "1.0", Type: "t",
+		Attributes: map[string]*cepb.CloudEvent_CloudEventAttributeValue{
+			"datacontenttype": ceString("text/plain"),
+			"retries":         {Attr: &cepb.CloudEvent_CloudEventAttributeValue_CeInteger{CeInteger: 3}},
+		},
+		Data: &cepb.CloudEvent_TextData{TextData: "hello"},
+	}
+	data, err := proto.Marshal(pe)
+	require.NoError(t, err)
+
+	got, err := CloudEventsProto.Unmarshal(data)
+	require.NoError(t, err)
+	var text string
+	require.NoError(t, got.Decode(&text))
+	assert.Equal(t, "hello", text)
+	assert.Equal(t, "3", got.Extensions["retries"])
+}
+
+func TestDecodeContentType(t *testing.T) {
+	_, err := decode("application/avro", []byte(`{}`))
+	assert.Error(t, err)
+
+	// entries written before content types were recorded are plain JSON
+	got, err := decode("", []byte(`{"id":"e-1","type":"order.placed"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "e-1", got.ID)
+
+	_, err = CodecFor("avro")
+	assert.Error(t, err)
+	codec, err := CodecFor(FormatCloudEventsProto)
+	require.NoError(t, err)
+	assert.Equal(t, CloudEventsProto, codec)
+}
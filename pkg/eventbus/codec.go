@@ -0,0 +1,91 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package eventbus
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Formats for EVENTBUS_FORMAT
+const (
+	FormatJSON             = "json"
+	FormatCloudEvents      = "cloudevents"
+	FormatCloudEventsProto = "cloudevents-proto"
+)
+
+// Content types the backends record next to every encoded event, so a
+// consumer reads any of them whatever it publishes itself
+const (
+	ContentTypeJSON             = "application/json"
+	ContentTypeCloudEventsJSON  = "application/cloudevents+json"
+	ContentTypeCloudEventsProto = "application/cloudevents+protobuf"
+)
+
+// Codec turns events into bytes on the wire and back
+type Codec interface {
+	ContentType() string
+	Marshal(e *Event) ([]byte, error)
+	Unmarshal(data []byte) (*Event, error)
+}
+
+var (
+	// JSON is the plain envelope, the Event struct as JSON
+	JSON Codec = jsonCodec{}
+	// CloudEventsJSON is the CloudEvents 1.0 JSON format
+	CloudEventsJSON Codec = cloudEventsJSON{}
+	// CloudEventsProto is the CloudEvents 1.0 protobuf format
+	CloudEventsProto Codec = cloudEventsProto{}
+)
+
+// CodecFor returns the codec of a format name
+func CodecFor(format string) (Codec, error) {
+	switch format {
+	case "", FormatJSON:
+		return JSON, nil
+	case FormatCloudEvents:
+		return CloudEventsJSON, nil
+	case FormatCloudEventsProto:
+		return CloudEventsProto, nil
+	default:
+		return nil, fmt.Errorf("event bus: unknown format %q", format)
+	}
+}
+
+// decoderFor returns the codec of a recorded content type, entries without
+// one are plain JSON
+func decoderFor(contentType string) (Codec, error) {
+	switch contentType {
+	case "", ContentTypeJSON:
+		return JSON, nil
+	case ContentTypeCloudEventsJSON:
+		return CloudEventsJSON, nil
+	case ContentTypeCloudEventsProto:
+		return CloudEventsProto, nil
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+func decode(contentType string, data []byte) (*Event, error) {
+	codec, err := decoderFor(contentType)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Unmarshal(data)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Marshal(e *Event) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (jsonCodec) Unmarshal(data []byte) (*Event, error) {
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
@@ -0,0 +1,383 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+	apperrors "blueprint/pkg/errors"
+	"blueprint/pkg/run"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultDeadLetterKey    = "events:deadletters"
+	defaultDeadLetterMaxLen = 10000
+	defaultDeadLetterLimit  = 100
+
+	// dead letter stores for EVENTBUS_DEADLETTER_STORE
+	DeadLetterNone   = "none"
+	DeadLetterMemory = "memory"
+	DeadLetterRedis  = "redis"
+
+	// deadLetterField holds the JSON dead letter in each stream entry
+	deadLetterField = "letter"
+)
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	// ErrNotReplayable is returned for dead letters whose event could not
+	// be decoded, there is nothing to publish again
+	ErrNotReplayable = errors.New("dead letter has no decodable event")
+)
+
+// DeadLetter is an event a subscriber group gave up on, kept for ops to
+// look at and replay
+type DeadLetter struct {
+	ID    string `json:"id"`
+	Topic string `json:"topic"`
+	Group string `json:"group"`
+	// Reason is max_deliveries, schema or undecodable, like the dropped
+	// metric
+	Reason string `json:"reason"`
+	// ErrorType classifies the last error: panic, the reason of a typed
+	// error (UNAVAILABLE, INVALID_ARGUMENT...), transient, error, or the
+	// Reason when the handler never ran
+	ErrorType string    `json:"error_type"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	FailedAt  time.Time `json:"failed_at"`
+	// Event is nil for undecodable entries, Raw and ContentType keep what
+	// was read instead
+	Event       *Event `json:"event,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Raw         []byte `json:"raw,omitempty"`
+}
+
+// DeadLetterFilter selects dead letters, zero fields match everything
+type DeadLetterFilter struct {
+	Topic     string
+	Group     string
+	ErrorType string
+	// Since and Until bound FailedAt, Until exclusive
+	Since time.Time
+	Until time.Time
+	// After continues a listing past the dead letter with this id
+	After string
+	// Limit is 100 by default
+	Limit int
+}
+
+func (f DeadLetterFilter) matches(dl *DeadLetter) bool {
+	return (f.Topic == "" || dl.Topic == f.Topic) &&
+		(f.Group == "" || dl.Group == f.Group) &&
+		(f.ErrorType == "" || dl.ErrorType == f.ErrorType) &&
+		(f.Since.IsZero() || !dl.FailedAt.Before(f.Since)) &&
+		(f.Until.IsZero() || dl.FailedAt.Before(f.Until))
+}
+
+func (f DeadLetterFilter) limit() int {
+	if f.Limit <= 0 {
+		return defaultDeadLetterLimit
+	}
+	return f.Limit
+}
+
+// DeadLetterStore keeps dead letters oldest first. Add sets ID.
+type DeadLetterStore interface {
+	Add(ctx context.Context, dl *DeadLetter) error
+	List(ctx context.Context, f DeadLetterFilter) ([]*DeadLetter, error)
+	Get(ctx context.Context, id string) (*DeadLetter, error)
+	Delete(ctx context.Context, ids ...string) (int, error)
+}
+
+// DeadLetters returns the store bus dead-letters to, nil when it has none
+func DeadLetters(bus Bus) DeadLetterStore {
+	if b, ok := bus.(interface{ deadLetters() DeadLetterStore }); ok {
+		return b.deadLetters()
+	}
+	return nil
+}
+
+func (m *Memory) deadLetters() DeadLetterStore { return m.opts.DeadLetters }
+func (r *Redis) deadLetters() DeadLetterStore  { return r.opts.DeadLetters }
+func (k *Kafka) deadLetters() DeadLetterStore  { return k.opts.DeadLetters }
+
+// DeadLetterQueue is what the admin RPCs work on, the store and the bus to
+// replay into
+type DeadLetterQueue struct {
+	Store DeadLetterStore
+	Bus   Bus
+}
+
+func (q *DeadLetterQueue) List(ctx context.Context, f DeadLetterFilter) ([]*DeadLetter, error) {
+	return q.Store.List(ctx, f)
+}
+
+func (q *DeadLetterQueue) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	return q.Store.Get(ctx, id)
+}
+
+func (q *DeadLetterQueue) Delete(ctx context.Context, ids ...string) (int, error) {
+	return q.Store.Delete(ctx, ids...)
+}
+
+// Replay publishes the events of ids to their topics again and deletes
+// their dead letters, stopping at the first failure. Every group of the
+// topic gets the event again under its old id, groups that handled it
+// already skip it with Idempotent.
+func (q *DeadLetterQueue) Replay(ctx context.Context, ids ...string) (int, error) {
+	replayed := 0
+	for _, id := range ids {
+		dl, err := q.Store.Get(ctx, id)
+		if err != nil {
+			return replayed, fmt.Errorf("replay %s: %w", id, err)
+		}
+		if dl.Event == nil {
+			return replayed, fmt.Errorf("replay %s: %w", id, ErrNotReplayable)
+		}
+		e := *dl.Event
+		e.Attempt = 0
+		if err := q.Bus.Publish(ctx, dl.Topic, &e); err != nil {
+			return replayed, fmt.Errorf("replay %s: %w", id, err)
+		}
+		if _, err := q.Store.Delete(ctx, id); err != nil {
+			return replayed, fmt.Errorf("replay %s: published but not deleted: %w", id, err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// errorType classifies a handler error for DeadLetter.ErrorType
+func errorType(err error) string {
+	var panicErr *run.PanicError
+	if errors.As(err, &panicErr) {
+		return "panic"
+	}
+	if typed, ok := apperrors.FromError(err); ok && typed.Reason != "" {
+		return typed.Reason
+	}
+	if apperrors.IsTransient(err) {
+		return "transient"
+	}
+	return "error"
+}
+
+// deadLetter records what deliver gave up on, a failing store only costs
+// the dead letter
+func (o Options) deadLetter(ctx context.Context, dl *DeadLetter) {
+	if o.DeadLetters == nil {
+		return
+	}
+	dl.FailedAt = o.Clock.Now().UTC()
+	if err := o.DeadLetters.Add(context.WithoutCancel(ctx), dl); err != nil && o.Log != nil {
+		o.Log.Errorf("Dead-lettering event on %s/%s failed: %v", dl.Topic, dl.Group, err)
+	}
+}
+
+// RedisDeadLetters keeps dead letters in one stream, its entry ids are the
+// dead letter ids and time ranges map onto XRANGE
+type RedisDeadLetters struct {
+	rdb    *goredis.Client
+	key    string
+	maxLen int64
+}
+
+// NewRedisDeadLetters keeps about maxLen dead letters under key,
+// "events:deadletters" when empty
+func NewRedisDeadLetters(rdb *goredis.Client, key string, maxLen int64) *RedisDeadLetters {
+	if key == "" {
+		key = defaultDeadLetterKey
+	}
+	if maxLen <= 0 {
+		maxLen = defaultDeadLetterMaxLen
+	}
+	return &RedisDeadLetters{rdb: rdb, key: key, maxLen: maxLen}
+}
+
+func (s *RedisDeadLetters) Add(ctx context.Context, dl *DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	id, err := s.rdb.XAdd(ctx, &goredis.XAddArgs{
+		Stream: s.key,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{deadLetterField: data},
+	}).Result()
+	if err != nil {
+		return err
+	}
+	dl.ID = id
+	return nil
+}
+
+func (s *RedisDeadLetters) List(ctx context.Context, f DeadLetterFilter) ([]*DeadLetter, error) {
+	// entries are added after they failed, so their id is never older than
+	// FailedAt and Since can skip ahead. Until has no such bound, matches
+	// checks it.
+	start, end := "-", "+"
+	if !f.Since.IsZero() {
+		start = strconv.FormatInt(f.Since.UnixMilli(), 10)
+	}
+	if f.After != "" {
+		start = "(" + f.After
+	}
+
+	var out []*DeadLetter
+	for len(out) < f.limit() {
+		msgs, err := s.rdb.XRangeN(ctx, s.key, start, end, int64(f.limit())).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			dl, err := decodeDeadLetter(msg)
+			if err != nil {
+				return nil, err
+			}
+			if f.matches(dl) {
+				out = append(out, dl)
+				if len(out) == f.limit() {
+					break
+				}
+			}
+		}
+		if len(msgs) < f.limit() {
+			break
+		}
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+	return out, nil
+}
+
+func (s *RedisDeadLetters) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	msgs, err := s.rdb.XRange(ctx, s.key, id, id).Result()
+	if err != nil {
+		// malformed ids are no dead letters either
+		if goredis.HasErrorPrefix(err, "ERR Invalid stream ID") {
+			return nil, ErrDeadLetterNotFound
+		}
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, ErrDeadLetterNotFound
+	}
+	return decodeDeadLetter(msgs[0])
+}
+
+func (s *RedisDeadLetters) Delete(ctx context.Context, ids ...string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	n, err := s.rdb.XDel(ctx, s.key, ids...).Result()
+	return int(n), err
+}
+
+func decodeDeadLetter(msg goredis.XMessage) (*DeadLetter, error) {
+	raw, ok := msg.Values[deadLetterField].(string)
+	if !ok {
+		return nil, fmt.Errorf("dead letter %s: no %q field", msg.ID, deadLetterField)
+	}
+	var dl DeadLetter
+	if err := json.Unmarshal([]byte(raw), &dl); err != nil {
+		return nil, fmt.Errorf("dead letter %s: %w", msg.ID, err)
+	}
+	dl.ID = msg.ID
+	return &dl, nil
+}
+
+// MemoryDeadLetters keeps the last maxLen dead letters of one process, for
+// the memory bus and tests
+type MemoryDeadLetters struct {
+	maxLen int
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	seq     int
+	letters []*DeadLetter
+}
+
+func NewMemoryDeadLetters(maxLen int) *MemoryDeadLetters {
+	if maxLen <= 0 {
+		maxLen = defaultDeadLetterMaxLen
+	}
+	return &MemoryDeadLetters{maxLen: maxLen, clock: clock.Real}
+}
+
+func (s *MemoryDeadLetters) Add(ctx context.Context, dl *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	// ordered like redis stream ids
+	dl.ID = fmt.Sprintf("%d-%d", s.clock.Now().UnixMilli(), s.seq)
+	c := *dl
+	s.letters = append(s.letters, &c)
+	if over := len(s.letters) - s.maxLen; over > 0 {
+		s.letters = append([]*DeadLetter(nil), s.letters[over:]...)
+	}
+	return nil
+}
+
+func (s *MemoryDeadLetters) List(ctx context.Context, f DeadLetterFilter) ([]*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*DeadLetter
+	for _, dl := range s.letters {
+		if f.After != "" && memorySeq(dl.ID) <= memorySeq(f.After) {
+			continue
+		}
+		if f.matches(dl) {
+			c := *dl
+			out = append(out, &c)
+			if len(out) == f.limit() {
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryDeadLetters) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, dl := range s.letters {
+		if dl.ID == id {
+			c := *dl
+			return &c, nil
+		}
+	}
+	return nil, ErrDeadLetterNotFound
+}
+
+func (s *MemoryDeadLetters) Delete(ctx context.Context, ids ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	kept := s.letters[:0]
+	for _, dl := range s.letters {
+		if contains(ids, dl.ID) {
+			deleted++
+			continue
+		}
+		kept = append(kept, dl)
+	}
+	s.letters = kept
+	return deleted, nil
+}
+
+// memorySeq is the sequence number of a MemoryDeadLetters id
+func memorySeq(id string) int {
+	_, seq, _ := strings.Cut(id, "-")
+	n, _ := strconv.Atoi(seq)
+	return n
+}
@@ -0,0 +1,172 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+	apperrors "blueprint/pkg/errors"
+	"blueprint/pkg/run"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorType(t *testing.T) {
+	assert.Equal(t, "UNAVAILABLE", errorType(apperrors.Unavailable("risk down", 0)))
+	assert.Equal(t, "panic", errorType(fmt.Errorf("handler: %w", &run.PanicError{Value: "boom"})))
+	assert.Equal(t, "error", errorType(errors.New("boom")))
+}
+
+// deadLetterStoreContract runs against every DeadLetterStore
+func deadLetterStoreContract(t *testing.T, store DeadLetterStore) {
+	ctx := context.Background()
+	// failed before they were added, as on a bus
+	base := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	add := func(topic, errType string, at time.Time) string {
+		dl := &DeadLetter{Topic: topic, Group: "risk", ErrorType: errType, FailedAt: at, Event: &Event{ID: "e-" + topic, Type: "order.placed"}}
+		require.NoError(t, store.Add(ctx, dl))
+		require.NotEmpty(t, dl.ID)
+		return dl.ID
+	}
+	first := add("orders", "panic", base)
+	second := add("orders", "UNAVAILABLE", base.Add(time.Second))
+	third := add("trades", "panic", base.Add(2*time.Second))
+
+	all, err := store.List(ctx, DeadLetterFilter{})
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assert.Equal(t, []string{first, second, third}, []string{all[0].ID, all[1].ID, all[2].ID}, "oldest first")
+	assert.Equal(t, "e-orders", all[0].Event.ID)
+
+	got, err := store.List(ctx, DeadLetterFilter{ErrorType: "panic"})
+	require.NoError(t, err)
+	assert.Len(t, got, 2)
+	got, err = store.List(ctx, DeadLetterFilter{Topic: "orders", Since: base.Add(time.Second)})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, second, got[0].ID)
+	got, err = store.List(ctx, DeadLetterFilter{Until: base.Add(time.Second)})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, first, got[0].ID)
+
+	// pages
+	got, err = store.List(ctx, DeadLetterFilter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	got, err = store.List(ctx, DeadLetterFilter{Limit: 2, After: got[1].ID})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, third, got[0].ID)
+
+	dl, err := store.Get(ctx, second)
+	require.NoError(t, err)
+	assert.Equal(t, "UNAVAILABLE", dl.ErrorType)
+	_, err = store.Get(ctx, "1-999")
+	assert.ErrorIs(t, err, ErrDeadLetterNotFound)
+
+	n, err := store.Delete(ctx, first, "1-999")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, err = store.List(ctx, DeadLetterFilter{After: first})
+	require.NoError(t, err)
+	assert.Len(t, got, 2, "a deleted id still works as a page token")
+}
+
+func TestMemoryDeadLetters(t *testing.T) {
+	deadLetterStoreContract(t, NewMemoryDeadLetters(0))
+
+	store := NewMemoryDeadLetters(2)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.Add(context.Background(), &DeadLetter{Topic: "orders"}))
+	}
+	got, err := store.List(context.Background(), DeadLetterFilter{})
+	require.NoError(t, err)
+	assert.Len(t, got, 2, "capped at maxLen")
+}
+
+func TestDeadLetterAndReplay(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	store := NewMemoryDeadLetters(0)
+	bus := NewMemory(Options{MaxDeliveries: 1, DeadLetters: store, Clock: fake})
+	defer bus.Close()
+	ctx := context.Background()
+	assert.Equal(t, store, DeadLetters(bus))
+
+	var healthy atomic.Bool
+	in := &inbox{}
+	require.NoError(t, bus.Subscribe(ctx, "orders", "risk", func(ctx context.Context, e *Event) error {
+		switch {
+		case healthy.Load():
+			return in.handle(ctx, e)
+		case e.Type == "panics":
+			panic("bad handler")
+		}
+		return apperrors.Unavailable("risk service down", 0)
+	}))
+
+	require.NoError(t, bus.Publish(ctx, "orders", &Event{ID: "e-1", Type: "order.placed"}, &Event{ID: "e-2", Type: "panics"}))
+	var letters []*DeadLetter
+	require.Eventually(t, func() bool {
+		letters, _ = store.List(ctx, DeadLetterFilter{})
+		return len(letters) == 2
+	}, time.Second, time.Millisecond)
+
+	dl := letters[0]
+	assert.Equal(t, "orders", dl.Topic)
+	assert.Equal(t, "risk", dl.Group)
+	assert.Equal(t, "max_deliveries", dl.Reason)
+	assert.Equal(t, "UNAVAILABLE", dl.ErrorType)
+	assert.Equal(t, 1, dl.Attempts)
+	assert.Equal(t, time.Unix(1000, 0).UTC(), dl.FailedAt)
+	assert.Equal(t, "e-1", dl.Event.ID)
+	assert.Equal(t, "panic", letters[1].ErrorType)
+
+	// fixed, the events go through again
+	healthy.Store(true)
+	q := &DeadLetterQueue{Store: store, Bus: bus}
+	n, err := q.Replay(ctx, letters[0].ID, letters[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	got := in.waitFor(t, 2)
+	assert.Equal(t, "e-1", got[0].ID, "replayed under its old id")
+	left, err := store.List(ctx, DeadLetterFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, left)
+
+	// undecodable entries have nothing to publish
+	undecodable := &DeadLetter{Topic: "orders", Reason: "undecodable", Raw: []byte("garbage")}
+	require.NoError(t, store.Add(ctx, undecodable))
+	n, err = q.Replay(ctx, undecodable.ID)
+	assert.ErrorIs(t, err, ErrNotReplayable)
+	assert.Zero(t, n)
+	_, err = q.Replay(ctx, "1-999")
+	assert.ErrorIs(t, err, ErrDeadLetterNotFound)
+}
+
+func TestDeadLetterSchemaFailure(t *testing.T) {
+	store := NewMemoryDeadLetters(0)
+	schemas := NewRegistry()
+	schemas.MustRegister(
+		Schema{Type: "order.placed", Version: 1, JSONSchema: []byte(`{}`)},
+		Schema{Type: "order.placed", Version: 2, JSONSchema: []byte(`{}`), Upgrade: func(data json.RawMessage) (json.RawMessage, error) {
+			return nil, errors.New("no amount")
+		}},
+	)
+	bus := NewMemory(Options{DeadLetters: store, Schemas: schemas})
+	defer bus.Close()
+	ctx := context.Background()
+	require.NoError(t, bus.Subscribe(ctx, "orders", "risk", (&inbox{}).handle))
+	require.NoError(t, bus.Publish(ctx, "orders", &Event{Type: "order.placed", Version: 1, Data: []byte(`{}`)}))
+
+	require.Eventually(t, func() bool {
+		letters, _ := store.List(ctx, DeadLetterFilter{ErrorType: "schema"})
+		return len(letters) == 1
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,211 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
+
+	"github.com/prometheus/client_golang/prometheus"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultDedupTTL    = 24 * time.Hour
+	defaultDedupLease  = time.Minute
+	defaultDedupPrefix = "dedup:"
+
+	dedupDone = "done"
+)
+
+var (
+	// ErrDuplicate is returned by DedupStore.Begin for events already
+	// processed
+	ErrDuplicate = errors.New("event already processed")
+	// ErrInProgress is returned by DedupStore.Begin while another consumer
+	// processes the event, the bus delivers it again later
+	ErrInProgress = errors.New("event in progress on another consumer")
+)
+
+var duplicates = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_eventbus_duplicates_total",
+	Help: "Deliveries of already processed events skipped by Idempotent, by topic and scope.",
+}, []string{"topic", "scope"})
+
+func init() {
+	prometheus.MustRegister(duplicates)
+}
+
+// DedupStore remembers processed event ids. Begin claims a key for the
+// lease, Commit marks it processed for ttl and Abort gives the claim up so
+// a redelivery can take it.
+type DedupStore interface {
+	Begin(ctx context.Context, key string, lease time.Duration) (token string, err error)
+	Commit(ctx context.Context, key string, ttl time.Duration) error
+	Abort(ctx context.Context, key, token string) error
+}
+
+type IdempotentOptions struct {
+	// Scope names the consumer, usually its group, so every group handles
+	// an event once
+	Scope string
+	// TTL is how long processed ids are remembered, 24h by default. It has
+	// to outlast redeliveries and replays of the stream.
+	TTL time.Duration
+	// Lease bounds a claim of a consumer that dies mid event, 1m by default
+	Lease time.Duration
+}
+
+// Idempotent skips events the scope already handled, across restarts and
+// rebalances when store is shared, as in RedisDedup. An event another
+// consumer is handling right now fails with ErrInProgress and comes back
+// after it finished.
+func Idempotent(store DedupStore, opts IdempotentOptions) Middleware {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultDedupTTL
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = defaultDedupLease
+	}
+	return func(next Handler) Handler {
+		return func(ctx context.Context, e *Event) error {
+			key := opts.Scope + ":" + e.ID
+			token, err := store.Begin(ctx, key, opts.Lease)
+			if errors.Is(err, ErrDuplicate) {
+				duplicates.WithLabelValues(e.Topic, opts.Scope).Inc()
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := next(ctx, e); err != nil {
+				// keep the handler's error, a lost abort only delays the
+				// redelivery until the lease ends
+				store.Abort(context.WithoutCancel(ctx), key, token)
+				return err
+			}
+			return store.Commit(context.WithoutCancel(ctx), key, opts.TTL)
+		}
+	}
+}
+
+// abortClaim deletes a claim only while it is still ours, the lease may have
+// passed to another consumer
+var abortClaim = goredis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisDedup keeps processed ids as redis keys with a TTL
+type RedisDedup struct {
+	rdb    *goredis.Client
+	prefix string
+}
+
+// NewRedisDedup keeps ids under prefix, "dedup:" when empty
+func NewRedisDedup(rdb *goredis.Client, prefix string) *RedisDedup {
+	if prefix == "" {
+		prefix = defaultDedupPrefix
+	}
+	return &RedisDedup{rdb: rdb, prefix: prefix}
+}
+
+func (d *RedisDedup) Begin(ctx context.Context, key string, lease time.Duration) (string, error) {
+	token := ctxmeta.NewID()
+	ok, err := d.rdb.SetNX(ctx, d.prefix+key, token, lease).Result()
+	if err != nil || ok {
+		return token, err
+	}
+
+	state, err := d.rdb.Get(ctx, d.prefix+key).Result()
+	switch {
+	case state == dedupDone:
+		return "", ErrDuplicate
+	case err != nil && err != goredis.Nil:
+		return "", err
+	}
+	// claimed by someone else, or the claim ended between both calls
+	return "", ErrInProgress
+}
+
+func (d *RedisDedup) Commit(ctx context.Context, key string, ttl time.Duration) error {
+	return d.rdb.Set(ctx, d.prefix+key, dedupDone, ttl).Err()
+}
+
+func (d *RedisDedup) Abort(ctx context.Context, key, token string) error {
+	return abortClaim.Run(ctx, d.rdb, []string{d.prefix + key}, token).Err()
+}
+
+// MemoryDedup is a DedupStore for one process, with the memory bus and in
+// tests
+type MemoryDedup struct {
+	clock clock.Clock
+
+	mu    sync.Mutex
+	keys  map[string]dedupEntry
+	swept time.Time
+}
+
+type dedupEntry struct {
+	value   string
+	expires time.Time
+}
+
+func NewMemoryDedup() *MemoryDedup {
+	return &MemoryDedup{clock: clock.Real, keys: make(map[string]dedupEntry)}
+}
+
+// SetClock lets tests expire ids with a clock.Fake instead of sleeping
+func (d *MemoryDedup) SetClock(c clock.Clock) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clock = clock.Or(c)
+}
+
+func (d *MemoryDedup) Begin(ctx context.Context, key string, lease time.Duration) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.clock.Now()
+	if entry, ok := d.keys[key]; ok && now.Before(entry.expires) {
+		if entry.value == dedupDone {
+			return "", ErrDuplicate
+		}
+		return "", ErrInProgress
+	}
+	token := ctxmeta.NewID()
+	d.keys[key] = dedupEntry{value: token, expires: now.Add(lease)}
+	return token, nil
+}
+
+func (d *MemoryDedup) Commit(ctx context.Context, key string, ttl time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.clock.Now()
+	d.keys[key] = dedupEntry{value: dedupDone, expires: now.Add(ttl)}
+	// processed ids pile up otherwise, drop the expired ones now and then
+	if now.Sub(d.swept) >= time.Minute {
+		d.swept = now
+		for k, entry := range d.keys {
+			if !now.Before(entry.expires) {
+				delete(d.keys, k)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *MemoryDedup) Abort(ctx context.Context, key, token string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.keys[key].value == token {
+		delete(d.keys, key)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dedupStoreContract runs against every DedupStore
+func dedupStoreContract(t *testing.T, store DedupStore, expire func(time.Duration)) {
+	ctx := context.Background()
+
+	token, err := store.Begin(ctx, "risk:e-1", time.Minute)
+	require.NoError(t, err)
+	_, err = store.Begin(ctx, "risk:e-1", time.Minute)
+	assert.ErrorIs(t, err, ErrInProgress)
+
+	// an abort with a stale token leaves the claim alone
+	require.NoError(t, store.Abort(ctx, "risk:e-1", "stale"))
+	_, err = store.Begin(ctx, "risk:e-1", time.Minute)
+	assert.ErrorIs(t, err, ErrInProgress)
+	require.NoError(t, store.Abort(ctx, "risk:e-1", token))
+
+	_, err = store.Begin(ctx, "risk:e-1", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, store.Commit(ctx, "risk:e-1", time.Hour))
+	_, err = store.Begin(ctx, "risk:e-1", time.Minute)
+	assert.ErrorIs(t, err, ErrDuplicate)
+	_, err = store.Begin(ctx, "audit:e-1", time.Minute)
+	assert.NoError(t, err, "scopes are separate")
+
+	expire(time.Hour)
+	_, err = store.Begin(ctx, "risk:e-1", time.Minute)
+	assert.NoError(t, err, "forgotten after the ttl")
+}
+
+func TestMemoryDedup(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	store := NewMemoryDedup()
+	store.SetClock(fake)
+	dedupStoreContract(t, store, fake.Advance)
+}
+
+func TestIdempotent(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryDedup()
+	calls := 0
+	fail := true
+	h := Idempotent(store, IdempotentOptions{Scope: "risk"})(func(ctx context.Context, e *Event) error {
+		calls++
+		if fail {
+			return errors.New("risk service down")
+		}
+		return nil
+	})
+
+	e := &Event{ID: "e-1", Topic: "orders"}
+	before := testutil.ToFloat64(duplicates.WithLabelValues("orders", "risk"))
+
+	// a failure releases the claim for the redelivery
+	assert.Error(t, h(ctx, e))
+	fail = false
+	require.NoError(t, h(ctx, e))
+	require.NoError(t, h(ctx, e))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, before+1, testutil.ToFloat64(duplicates.WithLabelValues("orders", "risk")))
+
+	// held by another consumer
+	_, err := store.Begin(ctx, "risk:e-2", time.Minute)
+	require.NoError(t, err)
+	assert.ErrorIs(t, h(ctx, &Event{ID: "e-2", Topic: "orders"}), ErrInProgress)
+	assert.Equal(t, 2, calls)
+}
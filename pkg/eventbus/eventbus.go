@@ -0,0 +1,330 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package eventbus publishes domain events to topics and hands them to
+// subscribers, through memory, redis streams or kafka:
+//
+//	e, err := eventbus.NewEvent(ctx, "order.placed", order)
+//	err = bus.Publish(ctx, "orders", e)
+//
+//	bus.Subscribe(ctx, "orders", "risk", eventbus.Chain(
+//		eventbus.Logging(log), eventbus.Metrics(),
+//	)(func(ctx context.Context, e *eventbus.Event) error {
+//		var order Order
+//		return e.Decode(&order)
+//	}))
+//
+// Every subscriber group gets every event of the topic, subscribers of the
+// same group share them. Delivery is at least once: a handler error or
+// panic delivers the event again, up to MaxDeliveries times, and a
+// consumer that dies before acking leaves it to the rest of its group.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+	BackendKafka  = "kafka"
+
+	defaultMaxDeliveries = 10
+	defaultRedelivery    = time.Second
+	maxRedelivery        = 30 * time.Second
+)
+
+// ErrClosed is returned by Publish and Subscribe after Close
+var ErrClosed = errors.New("event bus closed")
+
+var (
+	published = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_eventbus_published_total",
+		Help: "Events published by topic and result, ok or error.",
+	}, []string{"topic", "result"})
+
+	dropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_eventbus_dropped_total",
+		Help: "Events given up on by topic and reason: max_deliveries, undecodable or schema.",
+	}, []string{"topic", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(published, dropped)
+}
+
+// Event is the envelope every backend carries, Data is the JSON payload
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Version is the schema version of Data, set on publish for types in
+	// the schema registry
+	Version int `json:"version,omitempty"`
+	// Source is the publishing service, set by the bus when empty
+	Source     string    `json:"source,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Key keeps events in order, kafka partitions by it
+	Key string `json:"key,omitempty"`
+	// TraceID and RequestID carry the publisher's ctxmeta to handlers
+	TraceID   string `json:"trace_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	TenantID  string `json:"tenant_id,omitempty"`
+	// Extensions keeps CloudEvents attributes the envelope has no field for
+	Extensions map[string]string `json:"extensions,omitempty"`
+	Data       json.RawMessage   `json:"data,omitempty"`
+
+	// Topic and Attempt are set on delivery, Attempt counts from 1
+	Topic   string `json:"-"`
+	Attempt int    `json:"-"`
+}
+
+// NewEvent wraps payload, marshalled to JSON, in an envelope with a new id
+// and the trace, request and tenant ids of ctx
+func NewEvent(ctx context.Context, typ string, payload interface{}) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("event %s: %w", typ, err)
+	}
+	md := ctxmeta.FromContext(ctx)
+	return &Event{
+		ID:         ctxmeta.NewID(),
+		Type:       typ,
+		OccurredAt: time.Now().UTC(),
+		TraceID:    md.TraceID,
+		RequestID:  md.RequestID,
+		TenantID:   md.TenantID,
+		Data:       data,
+	}, nil
+}
+
+// Decode unmarshals the payload into v
+func (e *Event) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("event %s %s: %w", e.Type, e.ID, err)
+	}
+	return nil
+}
+
+// Context continues the publisher's trace in ctx
+func (e *Event) Context(ctx context.Context) context.Context {
+	if e.TraceID != "" {
+		ctx = ctxmeta.WithTraceID(ctx, e.TraceID)
+	}
+	if e.RequestID != "" {
+		ctx = ctxmeta.WithRequestID(ctx, e.RequestID)
+	}
+	if e.TenantID != "" {
+		ctx = ctxmeta.WithTenantID(ctx, e.TenantID)
+	}
+	return ctx
+}
+
+// Handler processes one event, an error has it delivered again
+type Handler func(ctx context.Context, e *Event) error
+
+// Bus is implemented by every backend
+type Bus interface {
+	Publish(ctx context.Context, topic string, events ...*Event) error
+	// Subscribe delivers the events of topic to h in the background until
+	// Close, ctx only bounds setting the subscription up
+	Subscribe(ctx context.Context, topic, group string, h Handler) error
+	// Close stops the subscriptions, waiting for the handlers running
+	Close() error
+}
+
+type Options struct {
+	// Source is set on published events that have none
+	Source string
+	// MaxDeliveries is how often a failing event is handed to the handler
+	// before it is dropped
+	MaxDeliveries int
+	// Redelivery is the wait before the second delivery, doubling after
+	// each failure up to 30s
+	Redelivery time.Duration
+	// Codec encodes published events, JSON when nil. Consumers decode
+	// every format whatever the codec.
+	Codec Codec
+	// Schemas validates published payloads and upgrades consumed ones,
+	// nothing is checked when nil
+	Schemas *Registry
+	// DeadLetters keeps what subscribers gave up on, dropped when nil
+	DeadLetters DeadLetterStore
+	Log         *logger.Logger
+	Clock       clock.Clock
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxDeliveries <= 0 {
+		o.MaxDeliveries = defaultMaxDeliveries
+	}
+	if o.Redelivery <= 0 {
+		o.Redelivery = defaultRedelivery
+	}
+	if o.Codec == nil {
+		o.Codec = JSON
+	}
+	o.Clock = clock.Or(o.Clock)
+	return o
+}
+
+// New opens the backend of cfg.EventBus, nil when none is configured.
+// The redis backend and redis dead letters use rdb.
+func New(cfg *config.Config, rdb *goredis.Client, log *logger.Logger, source string) (Bus, error) {
+	ec := cfg.EventBus
+	if ec.Backend == "" {
+		return nil, nil
+	}
+	codec, err := CodecFor(ec.Format)
+	if err != nil {
+		return nil, err
+	}
+	if err := DefaultSchemas.Check(ec.SchemaCompatibility); err != nil {
+		return nil, err
+	}
+	opts := Options{
+		Source:        source,
+		MaxDeliveries: ec.MaxDeliveries,
+		Redelivery:    ec.Redelivery,
+		Codec:         codec,
+		Schemas:       DefaultSchemas,
+		Log:           log,
+	}
+	switch ec.DeadLetterStore {
+	case DeadLetterMemory:
+		opts.DeadLetters = NewMemoryDeadLetters(ec.DeadLetterMaxLen)
+	case DeadLetterRedis:
+		if rdb == nil {
+			return nil, fmt.Errorf("event bus: redis dead letters without a redis client")
+		}
+		opts.DeadLetters = NewRedisDeadLetters(rdb, "", int64(ec.DeadLetterMaxLen))
+	}
+
+	switch ec.Backend {
+	case BackendMemory:
+		return NewMemory(opts), nil
+	case BackendRedis:
+		if rdb == nil {
+			return nil, fmt.Errorf("event bus: redis backend without a redis client")
+		}
+		return NewRedis(rdb, RedisOptions{Options: opts, MaxLen: int64(ec.StreamMaxLen)}), nil
+	case BackendKafka:
+		return NewKafka(KafkaOptions{Options: opts, Brokers: ec.KafkaBrokers})
+	default:
+		return nil, fmt.Errorf("event bus: unknown backend %q", ec.Backend)
+	}
+}
+
+// prepare fills what the publisher left out and validates the payload
+func (o Options) prepare(e *Event) error {
+	if e.ID == "" {
+		e.ID = ctxmeta.NewID()
+	}
+	if e.Source == "" {
+		e.Source = o.Source
+	}
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = o.Clock.Now().UTC()
+	}
+	if e.Version == 0 {
+		e.Version = o.Schemas.Latest(e.Type)
+	}
+	return o.Schemas.Validate(e)
+}
+
+// deliver hands e to h until it succeeds or MaxDeliveries failed, the
+// backend acks it either way. false means ctx ended first and e must stay
+// unacked for the next consumer.
+func (o Options) deliver(ctx context.Context, group string, h Handler, e *Event) bool {
+	if err := o.Schemas.Upgrade(e); err != nil {
+		dropped.WithLabelValues(e.Topic, "schema").Inc()
+		if o.Log != nil {
+			o.Log.WithContext(e.Context(ctx)).Errorf("Dropping event on %s: %v", e.Topic, err)
+		}
+		o.deadLetter(ctx, &DeadLetter{Topic: e.Topic, Group: group, Reason: "schema", ErrorType: "schema", Error: err.Error(), Event: e})
+		return true
+	}
+
+	delay := o.Redelivery
+	for e.Attempt = 1; ; e.Attempt++ {
+		err := run.Safe(o.Log, "eventbus "+e.Topic, func() error {
+			return h(e.Context(ctx), e)
+		})
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		if e.Attempt >= o.MaxDeliveries {
+			dropped.WithLabelValues(e.Topic, "max_deliveries").Inc()
+			if o.Log != nil {
+				o.Log.WithContext(e.Context(ctx)).Errorf("Dropping event %s %s on %s after %d deliveries: %v", e.Type, e.ID, e.Topic, e.Attempt, err)
+			}
+			o.deadLetter(ctx, &DeadLetter{
+				Topic:     e.Topic,
+				Group:     group,
+				Reason:    "max_deliveries",
+				ErrorType: errorType(err),
+				Error:     err.Error(),
+				Attempts:  e.Attempt,
+				Event:     e,
+			})
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-o.Clock.After(delay):
+		}
+		if delay *= 2; delay > maxRedelivery {
+			delay = maxRedelivery
+		}
+	}
+}
+
+// undecodable acks what no handler could read instead of redelivering it
+// forever
+func (o Options) undecodable(ctx context.Context, topic, group, id, contentType string, raw []byte, err error) {
+	dropped.WithLabelValues(topic, "undecodable").Inc()
+	if o.Log != nil {
+		o.Log.Errorf("Dropping undecodable event %s on %s: %v", id, topic, err)
+	}
+	o.deadLetter(ctx, &DeadLetter{
+		Topic:       topic,
+		Group:       group,
+		Reason:      "undecodable",
+		ErrorType:   "undecodable",
+		Error:       err.Error(),
+		ContentType: contentType,
+		Raw:         raw,
+	})
+}
+
+func countPublish(topic string, n int, err error) error {
+	if err != nil {
+		published.WithLabelValues(topic, "error").Add(float64(n))
+		return fmt.Errorf("publish to %s: %w", topic, err)
+	}
+	published.WithLabelValues(topic, "ok").Add(float64(n))
+	return nil
+}
+
+// consumerName identifies this process in redis consumer groups
+func consumerName() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
@@ -0,0 +1,236 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
+	apperrors "blueprint/pkg/errors"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type order struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+// inbox collects delivered events for assertions
+type inbox struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+func (in *inbox) handle(ctx context.Context, e *Event) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.events = append(in.events, e)
+	return nil
+}
+
+func (in *inbox) len() int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return len(in.events)
+}
+
+func (in *inbox) waitFor(t *testing.T, n int) []*Event {
+	t.Helper()
+	require.Eventually(t, func() bool { return in.len() >= n }, 2*time.Second, time.Millisecond)
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return append([]*Event(nil), in.events...)
+}
+
+func TestNewEventCarriesTrace(t *testing.T) {
+	ctx := ctxmeta.WithRequestID(ctxmeta.WithTraceID(context.Background(), "trace-1"), "req-1")
+	e, err := NewEvent(ctx, "order.placed", order{ID: "o-1", Amount: 5})
+	require.NoError(t, err)
+	assert.NotEmpty(t, e.ID)
+	assert.Equal(t, "trace-1", e.TraceID)
+	assert.Equal(t, "req-1", e.RequestID)
+	assert.JSONEq(t, `{"id":"o-1","amount":5}`, string(e.Data))
+
+	var got order
+	require.NoError(t, e.Decode(&got))
+	assert.Equal(t, order{ID: "o-1", Amount: 5}, got)
+
+	handlerCtx := e.Context(context.Background())
+	trace, _ := ctxmeta.TraceID(handlerCtx)
+	assert.Equal(t, "trace-1", trace)
+}
+
+func TestMemoryGroups(t *testing.T) {
+	bus := NewMemory(Options{Source: "blueprint"})
+	ctx := context.Background()
+
+	risk, audit := &inbox{}, &inbox{}
+	require.NoError(t, bus.Subscribe(ctx, "orders", "risk", risk.handle))
+	// two subscribers of one group share its events
+	require.NoError(t, bus.Subscribe(ctx, "orders", "audit", audit.handle))
+	require.NoError(t, bus.Subscribe(ctx, "orders", "audit", audit.handle))
+	require.NoError(t, bus.Subscribe(ctx, "trades", "risk", (&inbox{}).handle))
+
+	for i := 0; i < 10; i++ {
+		e, err := NewEvent(ctx, "order.placed", order{Amount: i})
+		require.NoError(t, err)
+		require.NoError(t, bus.Publish(ctx, "orders", e))
+	}
+
+	got := risk.waitFor(t, 10)
+	audit.waitFor(t, 10)
+	require.NoError(t, bus.Close())
+	assert.Equal(t, 10, audit.len(), "each event once per group")
+	assert.Equal(t, "orders", got[0].Topic)
+	assert.Equal(t, "blueprint", got[0].Source)
+	assert.Equal(t, 1, got[0].Attempt)
+
+	e, _ := NewEvent(ctx, "order.placed", nil)
+	assert.ErrorIs(t, bus.Publish(ctx, "orders", e), ErrClosed)
+	assert.ErrorIs(t, bus.Subscribe(ctx, "orders", "risk", risk.handle), ErrClosed)
+}
+
+func TestRedeliveryThenDrop(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	bus := NewMemory(Options{MaxDeliveries: 3, Redelivery: time.Second, Clock: fake})
+	defer bus.Close()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var attempts []int
+	require.NoError(t, bus.Subscribe(ctx, "orders", "risk", func(ctx context.Context, e *Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, e.Attempt)
+		if e.Type == "panics" {
+			panic("bad handler")
+		}
+		return errors.New("risk service down")
+	}))
+
+	before := testutil.ToFloat64(dropped.WithLabelValues("orders", "max_deliveries"))
+	require.NoError(t, bus.Publish(ctx, "orders", &Event{Type: "fails"}))
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	fake.BlockUntil(1)
+	fake.Advance(2 * time.Second)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(dropped.WithLabelValues("orders", "max_deliveries")) == before+1
+	}, time.Second, time.Millisecond)
+
+	// a panic is a failed delivery too
+	require.NoError(t, bus.Publish(ctx, "orders", &Event{Type: "panics"}))
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	fake.BlockUntil(1)
+	fake.Advance(2 * time.Second)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(dropped.WithLabelValues("orders", "max_deliveries")) == before+2
+	}, time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{1, 2, 3, 1, 2, 3}, attempts)
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, e *Event) error {
+				calls = append(calls, name)
+				return next(ctx, e)
+			}
+		}
+	}
+	h := Chain(mw("outer"), mw("inner"))(func(ctx context.Context, e *Event) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	require.NoError(t, h(context.Background(), &Event{}))
+	assert.Equal(t, []string{"outer", "inner", "handler"}, calls)
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	h := Metrics()(func(ctx context.Context, e *Event) error {
+		if e.Type == "bad" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	ok := testutil.ToFloat64(handled.WithLabelValues("metrics_test", "good", "ok"))
+	failed := testutil.ToFloat64(handled.WithLabelValues("metrics_test", "bad", "error"))
+	h(context.Background(), &Event{Topic: "metrics_test", Type: "good", Attempt: 1, OccurredAt: time.Now()})
+	h(context.Background(), &Event{Topic: "metrics_test", Type: "bad", Attempt: 1})
+
+	assert.Equal(t, ok+1, testutil.ToFloat64(handled.WithLabelValues("metrics_test", "good", "ok")))
+	assert.Equal(t, failed+1, testutil.ToFloat64(handled.WithLabelValues("metrics_test", "bad", "error")))
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	calls := 0
+	h := Retry(apperrors.RetryOptions{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})(
+		func(ctx context.Context, e *Event) error {
+			if calls++; calls < 3 {
+				return syscall.ECONNRESET
+			}
+			return nil
+		})
+	require.NoError(t, h(context.Background(), &Event{}))
+	assert.Equal(t, 3, calls)
+}
+
+func TestNewFromConfig(t *testing.T) {
+	bus, err := New(&config.Config{}, nil, nil, "blueprint")
+	require.NoError(t, err)
+	assert.Nil(t, bus)
+
+	bus, err = New(&config.Config{EventBus: config.EventBus{Backend: BackendMemory}}, nil, nil, "blueprint")
+	require.NoError(t, err)
+	assert.IsType(t, &Memory{}, bus)
+	bus.Close()
+
+	_, err = New(&config.Config{EventBus: config.EventBus{Backend: BackendRedis}}, nil, nil, "blueprint")
+	assert.Error(t, err)
+
+	bus, err = New(&config.Config{EventBus: config.EventBus{Backend: BackendKafka, KafkaBrokers: []string{"127.0.0.1:9092"}}}, nil, nil, "blueprint")
+	require.NoError(t, err)
+	assert.IsType(t, &Kafka{}, bus)
+	bus.Close()
+}
+
+func TestKafkaMessageRoundTrip(t *testing.T) {
+	e := &Event{ID: "e-1", Type: "order.placed", Source: "blueprint", Key: "A1", OccurredAt: time.Unix(100, 0).UTC(), TraceID: "trace-1", Data: []byte(`{"id":"o-1"}`)}
+	msg, err := toMessage("orders", e, JSON)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("A1"), msg.Key)
+	assert.Equal(t, "type", msg.Headers[0].Key)
+	assert.Equal(t, kafka.Header{Key: "content-type", Value: []byte("application/json")}, msg.Headers[1])
+
+	got, err := fromMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, "orders", got.Topic)
+	assert.Equal(t, e.TraceID, got.TraceID)
+	assert.JSONEq(t, string(e.Data), string(got.Data))
+
+	_, err = fromMessage(kafka.Message{Value: []byte("not json")})
+	assert.Error(t, err)
+
+	msg, err = toMessage("orders", e, CloudEventsProto)
+	require.NoError(t, err)
+	got, err = fromMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, "A1", got.Key)
+	assert.JSONEq(t, string(e.Data), string(got.Data))
+}
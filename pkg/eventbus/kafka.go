@@ -0,0 +1,210 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"blueprint/pkg/run"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const kafkaMaxBytes = 10 << 20
+
+type KafkaOptions struct {
+	Options
+	Brokers []string
+	// Dialer sets TLS and SASL, kafka.DefaultDialer when nil
+	Dialer *kafka.Dialer
+}
+
+// Kafka is a Bus on kafka topics, a subscriber group is a consumer group.
+// Events are partitioned by Key, so events with the same key stay in
+// order. A failing event holds up its partition until it is handled or
+// dropped, offsets are committed only past handled events.
+type Kafka struct {
+	opts   KafkaOptions
+	writer *kafka.Writer
+
+	mu      sync.Mutex
+	closed  bool
+	readers []*kafka.Reader
+	cancel  context.CancelFunc
+	group   *run.Group
+}
+
+func NewKafka(opts KafkaOptions) (*Kafka, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, fmt.Errorf("event bus: kafka needs brokers")
+	}
+	opts.Options = opts.Options.withDefaults()
+
+	transport := kafka.DefaultTransport
+	if opts.Dialer != nil {
+		transport = &kafka.Transport{
+			TLS:  opts.Dialer.TLS,
+			SASL: opts.Dialer.SASLMechanism,
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Kafka{
+		opts: opts,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(opts.Brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+			Transport:    transport,
+		},
+		cancel: cancel,
+		group:  run.NewGroup(ctx, opts.Log),
+	}, nil
+}
+
+func (k *Kafka) Publish(ctx context.Context, topic string, events ...*Event) error {
+	if k.isClosed() {
+		return ErrClosed
+	}
+
+	msgs := make([]kafka.Message, 0, len(events))
+	for _, e := range events {
+		if err := k.opts.prepare(e); err != nil {
+			return countPublish(topic, len(events), err)
+		}
+		msg, err := toMessage(topic, e, k.opts.Codec)
+		if err != nil {
+			return countPublish(topic, len(events), err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return countPublish(topic, len(events), k.writer.WriteMessages(ctx, msgs...))
+}
+
+func (k *Kafka) Subscribe(ctx context.Context, topic, group string, h Handler) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return ErrClosed
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  k.opts.Brokers,
+		GroupID:  group,
+		Topic:    topic,
+		Dialer:   k.opts.Dialer,
+		MinBytes: 1,
+		MaxBytes: kafkaMaxBytes,
+		// a new group starts at the end like on redis
+		StartOffset: kafka.LastOffset,
+	})
+	k.readers = append(k.readers, reader)
+
+	k.group.Supervise("eventbus "+topic+"/"+group, func(ctx context.Context) error {
+		return k.consume(ctx, reader, topic, group, h)
+	}, run.Options{Clock: k.opts.Clock})
+	return nil
+}
+
+func (k *Kafka) consume(ctx context.Context, reader *kafka.Reader, topic, group string, h Handler) error {
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		e, err := fromMessage(msg)
+		if err != nil {
+			k.opts.undecodable(ctx, topic, group, fmt.Sprintf("%d@%d", msg.Offset, msg.Partition), contentTypeOf(msg), msg.Value, err)
+		} else if !k.opts.deliver(ctx, group, h, e) {
+			return nil
+		}
+
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// message headers, content-type is the CloudEvents structured mode header
+const (
+	headerType        = "type"
+	headerContentType = "content-type"
+)
+
+func toMessage(topic string, e *Event, codec Codec) (kafka.Message, error) {
+	payload, err := codec.Marshal(e)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return kafka.Message{
+		Topic: topic,
+		Key:   []byte(e.Key),
+		Value: payload,
+		Time:  e.OccurredAt,
+		// consumers can route on the type without decoding the value
+		Headers: []kafka.Header{
+			{Key: headerType, Value: []byte(e.Type)},
+			{Key: headerContentType, Value: []byte(codec.ContentType())},
+		},
+	}, nil
+}
+
+func fromMessage(msg kafka.Message) (*Event, error) {
+	e, err := decode(contentTypeOf(msg), msg.Value)
+	if err != nil {
+		return nil, err
+	}
+	e.Topic = msg.Topic
+	return e, nil
+}
+
+func contentTypeOf(msg kafka.Message) string {
+	for _, h := range msg.Headers {
+		if h.Key == headerContentType {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (k *Kafka) isClosed() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.closed
+}
+
+// Close stops the consumers and flushes the writer
+func (k *Kafka) Close() error {
+	k.mu.Lock()
+	if k.closed {
+		k.mu.Unlock()
+		return nil
+	}
+	k.closed = true
+	readers := k.readers
+	k.mu.Unlock()
+
+	k.cancel()
+	k.group.Wait()
+
+	var firstErr error
+	for _, r := range readers {
+		if err := r.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := k.writer.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
@@ -0,0 +1,119 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package eventbus
+
+import (
+	"context"
+	"sync"
+
+	"blueprint/pkg/run"
+)
+
+const memoryBuffer = 1024
+
+// Memory is a Bus inside one process, for tests and single replica
+// tools. Events published before a group subscribes are not kept for it,
+// and a full group buffer blocks Publish.
+type Memory struct {
+	opts Options
+
+	mu     sync.Mutex
+	closed bool
+	// topics maps topic and group to the queue its subscribers share
+	topics map[string]map[string]chan *Event
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewMemory(opts Options) *Memory {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Memory{
+		opts:   opts.withDefaults(),
+		topics: make(map[string]map[string]chan *Event),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (m *Memory) Publish(ctx context.Context, topic string, events ...*Event) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrClosed
+	}
+	queues := make([]chan *Event, 0, len(m.topics[topic]))
+	for _, q := range m.topics[topic] {
+		queues = append(queues, q)
+	}
+	m.mu.Unlock()
+
+	for _, e := range events {
+		if err := m.opts.prepare(e); err != nil {
+			return countPublish(topic, len(events), err)
+		}
+	}
+	for _, e := range events {
+		for _, q := range queues {
+			// each group gets its own copy, delivery sets Topic and Attempt
+			c := *e
+			c.Topic = topic
+			select {
+			case q <- &c:
+			case <-ctx.Done():
+				return countPublish(topic, len(events), ctx.Err())
+			case <-m.ctx.Done():
+				return countPublish(topic, len(events), ErrClosed)
+			}
+		}
+	}
+	return countPublish(topic, len(events), nil)
+}
+
+func (m *Memory) Subscribe(ctx context.Context, topic, group string, h Handler) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	groups := m.topics[topic]
+	if groups == nil {
+		groups = make(map[string]chan *Event)
+		m.topics[topic] = groups
+	}
+	q := groups[group]
+	if q == nil {
+		q = make(chan *Event, memoryBuffer)
+		groups[group] = q
+	}
+
+	m.wg.Add(1)
+	run.Go(m.opts.Log, "eventbus "+topic, func() {
+		defer m.wg.Done()
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case e := <-q:
+				m.opts.deliver(m.ctx, group, h, e)
+			}
+		}
+	})
+	return nil
+}
+
+// Close stops the subscribers, events still queued are lost
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	m.mu.Unlock()
+
+	m.cancel()
+	m.wg.Wait()
+	return nil
+}
@@ -0,0 +1,106 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package eventbus
+
+import (
+	"context"
+	"time"
+
+	"blueprint/pkg/errors"
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	handled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_eventbus_handled_total",
+		Help: "Event deliveries by topic, event type and result, ok or error.",
+	}, []string{"topic", "type", "result"})
+
+	handleDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blueprint_eventbus_handle_duration_seconds",
+		Help:    "Time handlers took per delivery.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic"})
+
+	handleLag = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blueprint_eventbus_lag_seconds",
+		Help:    "Time from an event occurring to its first delivery.",
+		Buckets: []float64{.01, .05, .1, .5, 1, 5, 30, 60, 300},
+	}, []string{"topic"})
+)
+
+func init() {
+	prometheus.MustRegister(handled, handleDuration, handleLag)
+}
+
+// Middleware wraps a Handler, like a gRPC interceptor
+type Middleware func(Handler) Handler
+
+// Chain applies mws to a handler, the first one outermost
+func Chain(mws ...Middleware) Middleware {
+	return func(h Handler) Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+		return h
+	}
+}
+
+// Logging logs every delivery at debug and failures at warn, with the
+// publisher's trace id
+func Logging(log *logger.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, e *Event) error {
+			start := time.Now()
+			err := next(ctx, e)
+
+			l := log.WithContext(ctx).WithFields(map[string]interface{}{
+				"topic":    e.Topic,
+				"event":    e.Type,
+				"event_id": e.ID,
+				"attempt":  e.Attempt,
+				"duration": time.Since(start).String(),
+			})
+			if err != nil {
+				l.WithError(err).Warn("Event handler failed")
+			} else {
+				l.Debug("Event handled")
+			}
+			return err
+		}
+	}
+}
+
+// Metrics counts deliveries and times handlers
+func Metrics() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, e *Event) error {
+			start := time.Now()
+			if e.Attempt <= 1 && !e.OccurredAt.IsZero() {
+				handleLag.WithLabelValues(e.Topic).Observe(start.Sub(e.OccurredAt).Seconds())
+			}
+
+			err := next(ctx, e)
+			handleDuration.WithLabelValues(e.Topic).Observe(time.Since(start).Seconds())
+			result := "ok"
+			if err != nil {
+				result = "error"
+			}
+			handled.WithLabelValues(e.Topic, e.Type, result).Inc()
+			return err
+		}
+	}
+}
+
+// Retry runs the handler again right away on retryable errors, per
+// opts, before the bus redelivers the event later
+func Retry(opts errors.RetryOptions) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, e *Event) error {
+			return errors.Retry(ctx, opts, func(ctx context.Context) error {
+				return next(ctx, e)
+			})
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package eventbus
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	cepb "blueprint/proto/cloudevents"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Publishing at tick rates encodes an event per price update. The redis
+// backend encodes into pooled buffers it takes back once the pipeline
+// wrote them, and the protobuf codec reuses its CloudEvent messages, so
+// the encode side of a publish leaves next to nothing for the GC.
+
+const (
+	initialBuffer = 1024
+	// buffers grown past this are dropped, one large event must not pin
+	// its memory in the pool
+	maxPooledBuffer = 64 << 10
+)
+
+var bufferPool = sync.Pool{New: func() interface{} {
+	b := make([]byte, 0, initialBuffer)
+	return &b
+}}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+// putBuffer returns b to the pool, nothing may hold on to its bytes
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+// appendMarshaler is implemented by codecs that can encode into a buffer
+// they are given
+type appendMarshaler interface {
+	MarshalAppend(buf []byte, e *Event) ([]byte, error)
+}
+
+// marshalAppend appends e encoded by codec to buf, through Marshal for
+// codecs that cannot append
+func marshalAppend(codec Codec, buf []byte, e *Event) ([]byte, error) {
+	if m, ok := codec.(appendMarshaler); ok {
+		return m.MarshalAppend(buf, e)
+	}
+	data, err := codec.Marshal(e)
+	if err != nil {
+		return buf, err
+	}
+	return append(buf, data...), nil
+}
+
+// appendJSON is json.Marshal appending to buf
+func appendJSON(buf []byte, v interface{}) ([]byte, error) {
+	w := bytes.NewBuffer(buf)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		return buf, err
+	}
+	// Encode ends every value with a newline Marshal does not write
+	out := w.Bytes()
+	return out[:len(out)-1], nil
+}
+
+func (jsonCodec) MarshalAppend(buf []byte, e *Event) ([]byte, error) {
+	return appendJSON(buf, e)
+}
+
+// ceMessage is a CloudEvent with the attribute values it was filled with,
+// pooled together so a message is built without allocating once warm
+type ceMessage struct {
+	pe     cepb.CloudEvent
+	text   cepb.CloudEvent_TextData
+	time   cepb.CloudEvent_CloudEventAttributeValue
+	ts     cepb.CloudEvent_CloudEventAttributeValue_CeTimestamp
+	stamp  timestamppb.Timestamp
+	values []*cepb.CloudEvent_CloudEventAttributeValue
+	strs   []*cepb.CloudEvent_CloudEventAttributeValue_CeString
+	used   int
+}
+
+var ceMessagePool = sync.Pool{New: func() interface{} {
+	m := &ceMessage{}
+	m.pe.Attributes = make(map[string]*cepb.CloudEvent_CloudEventAttributeValue)
+	return m
+}}
+
+func getCEMessage() *ceMessage {
+	return ceMessagePool.Get().(*ceMessage)
+}
+
+// putCEMessage clears m for the next event and pools it. Reset alone
+// would drop the attribute map and the values it points to, they are
+// emptied and kept instead; nothing of one event, its strings and data
+// included, may be left for the next to see or keep alive.
+func putCEMessage(m *ceMessage) {
+	attrs := m.pe.Attributes
+	for name := range attrs {
+		delete(attrs, name)
+	}
+	m.pe.Reset()
+	m.pe.Attributes = attrs
+	m.text.TextData = ""
+	for _, s := range m.strs[:m.used] {
+		s.CeString = ""
+	}
+	m.used = 0
+	ceMessagePool.Put(m)
+}
+
+// fill sets e on m's message and returns it
+func (m *ceMessage) fill(e *Event) *cepb.CloudEvent {
+	pe := &m.pe
+	pe.Id = e.ID
+	pe.Source = e.Source
+	pe.SpecVersion = ceSpecVersion
+	pe.Type = e.Type
+	if !e.OccurredAt.IsZero() {
+		m.stamp.Seconds = e.OccurredAt.Unix()
+		m.stamp.Nanos = int32(e.OccurredAt.Nanosecond())
+		m.ts.CeTimestamp = &m.stamp
+		m.time.Attr = &m.ts
+		pe.Attributes["time"] = &m.time
+	}
+	if len(e.Data) > 0 {
+		pe.Attributes["datacontenttype"] = m.str(ContentTypeJSON)
+		m.text.TextData = string(e.Data)
+		pe.Data = &m.text
+	}
+	for name, value := range ceExtensions(e) {
+		pe.Attributes[name] = m.str(value)
+	}
+	return pe
+}
+
+// str is a string attribute value, the next free one of m
+func (m *ceMessage) str(s string) *cepb.CloudEvent_CloudEventAttributeValue {
+	if m.used == len(m.values) {
+		str := &cepb.CloudEvent_CloudEventAttributeValue_CeString{}
+		m.strs = append(m.strs, str)
+		m.values = append(m.values, &cepb.CloudEvent_CloudEventAttributeValue{Attr: str})
+	}
+	v := m.values[m.used]
+	m.strs[m.used].CeString = s
+	m.used++
+	return v
+}
+
+func (cloudEventsProto) MarshalAppend(buf []byte, e *Event) ([]byte, error) {
+	if err := checkRequired(e); err != nil {
+		return buf, err
+	}
+	m := getCEMessage()
+	defer putCEMessage(m)
+	return proto.MarshalOptions{}.MarshalAppend(buf, m.fill(e))
+}
@@ -0,0 +1,88 @@
+package eventbus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalAppend(t *testing.T) {
+	for _, codec := range []Codec{JSON, CloudEventsJSON, CloudEventsProto} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			e := sampleEvent()
+			buf, err := marshalAppend(codec, []byte("prefix"), e)
+			require.NoError(t, err)
+			require.Equal(t, "prefix", string(buf[:6]), "appends to what is there")
+
+			got, err := decode(codec.ContentType(), buf[6:])
+			require.NoError(t, err)
+			want, err := codec.Marshal(e)
+			require.NoError(t, err)
+			same, err := decode(codec.ContentType(), want)
+			require.NoError(t, err)
+			assert.Equal(t, same, got)
+		})
+	}
+}
+
+func TestPooledCloudEventIsReset(t *testing.T) {
+	// the second event reuses the message of the first, none of its
+	// attributes or data may come along
+	_, err := CloudEventsProto.Marshal(sampleEvent())
+	require.NoError(t, err)
+
+	bare := &Event{ID: "e-2", Source: "blueprint", Type: "order.cancelled"}
+	data, err := CloudEventsProto.Marshal(bare)
+	require.NoError(t, err)
+	got, err := CloudEventsProto.Unmarshal(data)
+	require.NoError(t, err)
+	assert.Equal(t, bare, got)
+
+	m := getCEMessage()
+	assert.Empty(t, m.pe.Attributes)
+	assert.NotNil(t, m.pe.Attributes, "the map is kept")
+	assert.Nil(t, m.pe.Data)
+	assert.Empty(t, m.text.TextData)
+	for _, s := range m.strs {
+		assert.Empty(t, s.CeString)
+	}
+	putCEMessage(m)
+}
+
+func TestPutBufferDropsLarge(t *testing.T) {
+	b := getBuffer()
+	*b = append(*b, "event"...)
+	putBuffer(b)
+	assert.Empty(t, *b, "truncated for the next user")
+
+	large := make([]byte, 0, maxPooledBuffer+1)
+	putBuffer(&large)
+	assert.Equal(t, maxPooledBuffer+1, cap(large))
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	e := sampleEvent()
+	for _, codec := range []Codec{JSON, CloudEventsJSON, CloudEventsProto} {
+		b.Run(codec.ContentType()+"/marshal", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := codec.Marshal(e); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(codec.ContentType()+"/pooled", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf := getBuffer()
+				out, err := marshalAppend(codec, *buf, e)
+				if err != nil {
+					b.Fatal(err)
+				}
+				*buf = out
+				putBuffer(buf)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/pkg/run"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultStreamPrefix = "events:"
+	defaultBlock        = 5 * time.Second
+	defaultBatch        = 10
+	defaultClaimIdle    = time.Minute
+
+	// streamField holds the encoded envelope in each stream entry,
+	// contentTypeField its codec, entries without one are plain JSON
+	streamField      = "event"
+	contentTypeField = "content_type"
+)
+
+type RedisOptions struct {
+	Options
+	// Prefix of the stream keys, the topic follows it
+	Prefix string
+	// MaxLen trims every stream to about this many entries, 0 keeps all
+	MaxLen int64
+	// Block is how long a consumer waits for new entries per read
+	Block time.Duration
+	Batch int64
+	// ClaimIdle hands entries a consumer read but did not ack for this
+	// long, because it died, to another consumer of the group
+	ClaimIdle time.Duration
+	// Consumer names this process in the groups, host and pid by default
+	Consumer string
+}
+
+// Redis is a Bus on redis streams, one stream per topic and a consumer
+// group per subscriber group. A new group starts with the entries added
+// after it was created.
+type Redis struct {
+	rdb  *goredis.Client
+	opts RedisOptions
+
+	mu     sync.Mutex
+	closed bool
+	cancel context.CancelFunc
+	group  *run.Group
+}
+
+func NewRedis(rdb *goredis.Client, opts RedisOptions) *Redis {
+	opts.Options = opts.Options.withDefaults()
+	if opts.Prefix == "" {
+		opts.Prefix = defaultStreamPrefix
+	}
+	if opts.Block <= 0 {
+		opts.Block = defaultBlock
+	}
+	if opts.Batch <= 0 {
+		opts.Batch = defaultBatch
+	}
+	if opts.ClaimIdle <= 0 {
+		opts.ClaimIdle = defaultClaimIdle
+	}
+	if opts.Consumer == "" {
+		opts.Consumer = consumerName()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Redis{
+		rdb:    rdb,
+		opts:   opts,
+		cancel: cancel,
+		group:  run.NewGroup(ctx, opts.Log),
+	}
+}
+
+func (r *Redis) stream(topic string) string {
+	return r.opts.Prefix + topic
+}
+
+func (r *Redis) Publish(ctx context.Context, topic string, events ...*Event) error {
+	if r.isClosed() {
+		return ErrClosed
+	}
+
+	// the payloads are encoded into pooled buffers, the pipeline has
+	// written them once Exec returns
+	buffers := make([]*[]byte, 0, len(events))
+	defer func() {
+		for _, b := range buffers {
+			putBuffer(b)
+		}
+	}()
+
+	pipe := r.rdb.Pipeline()
+	for _, e := range events {
+		if err := r.opts.prepare(e); err != nil {
+			return countPublish(topic, len(events), err)
+		}
+		buf := getBuffer()
+		buffers = append(buffers, buf)
+		payload, err := marshalAppend(r.opts.Codec, *buf, e)
+		*buf = payload
+		if err != nil {
+			return countPublish(topic, len(events), err)
+		}
+		pipe.XAdd(ctx, &goredis.XAddArgs{
+			Stream: r.stream(topic),
+			MaxLen: r.opts.MaxLen,
+			Approx: true,
+			Values: map[string]interface{}{
+				streamField:      payload,
+				contentTypeField: r.opts.Codec.ContentType(),
+			},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return countPublish(topic, len(events), err)
+}
+
+func (r *Redis) Subscribe(ctx context.Context, topic, group string, h Handler) error {
+	if r.isClosed() {
+		return ErrClosed
+	}
+
+	err := r.rdb.XGroupCreateMkStream(ctx, r.stream(topic), group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("subscribe %s/%s: %w", topic, group, err)
+	}
+
+	r.group.Supervise("eventbus "+topic+"/"+group, func(ctx context.Context) error {
+		return r.consume(ctx, topic, group, h)
+	}, run.Options{Clock: r.opts.Clock})
+	return nil
+}
+
+// consume first takes over entries abandoned by dead consumers, then reads
+// new ones, until ctx ends
+func (r *Redis) consume(ctx context.Context, topic, group string, h Handler) error {
+	stream := r.stream(topic)
+	for ctx.Err() == nil {
+		claimed, _, err := r.rdb.XAutoClaim(ctx, &goredis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    group,
+			Consumer: r.opts.Consumer,
+			MinIdle:  r.opts.ClaimIdle,
+			Start:    "0-0",
+			Count:    r.opts.Batch,
+		}).Result()
+		if err != nil {
+			return r.readErr(ctx, err)
+		}
+		if !r.handle(ctx, topic, group, h, claimed) {
+			return nil
+		}
+
+		streams, err := r.rdb.XReadGroup(ctx, &goredis.XReadGroupArgs{
+			Group:    group,
+			Consumer: r.opts.Consumer,
+			Streams:  []string{stream, ">"},
+			Count:    r.opts.Batch,
+			Block:    r.opts.Block,
+		}).Result()
+		if errors.Is(err, goredis.Nil) {
+			continue
+		}
+		if err != nil {
+			return r.readErr(ctx, err)
+		}
+		for _, s := range streams {
+			if !r.handle(ctx, topic, group, h, s.Messages) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// readErr has the supervisor restart the consumer with backoff, a closed
+// bus is no error
+func (r *Redis) readErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// handle delivers and acks msgs in order, false when ctx ended
+func (r *Redis) handle(ctx context.Context, topic, group string, h Handler, msgs []goredis.XMessage) bool {
+	for _, msg := range msgs {
+		e, err := decodeStreamEntry(msg)
+		if err != nil {
+			raw, _ := msg.Values[streamField].(string)
+			contentType, _ := msg.Values[contentTypeField].(string)
+			r.opts.undecodable(ctx, topic, group, msg.ID, contentType, []byte(raw), err)
+		} else {
+			e.Topic = topic
+			if !r.opts.deliver(ctx, group, h, e) {
+				return false
+			}
+		}
+
+		if err := r.rdb.XAck(ctx, r.stream(topic), group, msg.ID).Err(); err != nil && ctx.Err() == nil && r.opts.Log != nil {
+			// redelivered to the group after ClaimIdle
+			r.opts.Log.Warnf("Acking event %s on %s failed: %v", msg.ID, topic, err)
+		}
+	}
+	return true
+}
+
+func decodeStreamEntry(msg goredis.XMessage) (*Event, error) {
+	raw, ok := msg.Values[streamField].(string)
+	if !ok {
+		return nil, fmt.Errorf("no %q field", streamField)
+	}
+	contentType, _ := msg.Values[contentTypeField].(string)
+	return decode(contentType, []byte(raw))
+}
+
+func (r *Redis) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// Close stops the consumers, the redis client stays open
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.mu.Unlock()
+
+	r.cancel()
+	return r.group.Wait()
+}
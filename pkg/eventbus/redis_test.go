@@ -0,0 +1,136 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"blueprint/pkg/testsupport"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedis(t *testing.T, rdb *goredis.Client, consumer string) *Redis {
+	bus := NewRedis(rdb, RedisOptions{
+		Options:   Options{Redelivery: time.Millisecond},
+		Prefix:    "test:" + t.Name() + ":",
+		Block:     50 * time.Millisecond,
+		ClaimIdle: 100 * time.Millisecond,
+		Consumer:  consumer,
+	})
+	t.Cleanup(func() { bus.Close() })
+	return bus
+}
+
+func TestRedisPublishSubscribe(t *testing.T) {
+	rdb := testsupport.Redis(t)
+	bus := newTestRedis(t, rdb, "c1")
+	ctx := context.Background()
+
+	risk, audit := &inbox{}, &inbox{}
+	require.NoError(t, bus.Subscribe(ctx, "orders", "risk", risk.handle))
+	require.NoError(t, bus.Subscribe(ctx, "orders", "audit", audit.handle))
+
+	e, err := NewEvent(ctx, "order.placed", order{ID: "o-1"})
+	require.NoError(t, err)
+	e.TraceID = "trace-1"
+	require.NoError(t, bus.Publish(ctx, "orders", e, &Event{Type: "order.cancelled"}))
+
+	got := risk.waitFor(t, 2)
+	audit.waitFor(t, 2)
+	assert.Equal(t, "order.placed", got[0].Type)
+	assert.Equal(t, "trace-1", got[0].TraceID)
+	assert.Equal(t, "orders", got[0].Topic)
+	assert.Equal(t, "order.cancelled", got[1].Type)
+
+	pending, err := rdb.XPending(ctx, "test:"+t.Name()+":orders", "risk").Result()
+	require.NoError(t, err)
+	assert.Zero(t, pending.Count, "handled events are acked")
+}
+
+func TestRedisRedeliversFailures(t *testing.T) {
+	rdb := testsupport.Redis(t)
+	bus := newTestRedis(t, rdb, "c1")
+	ctx := context.Background()
+
+	calls := &inbox{}
+	require.NoError(t, bus.Subscribe(ctx, "orders", "risk", func(ctx context.Context, e *Event) error {
+		calls.handle(ctx, e)
+		if e.Attempt < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}))
+	require.NoError(t, bus.Publish(ctx, "orders", &Event{Type: "order.placed"}))
+
+	got := calls.waitFor(t, 3)
+	assert.Equal(t, 3, got[2].Attempt)
+}
+
+func TestRedisClaimsFromDeadConsumer(t *testing.T) {
+	rdb := testsupport.Redis(t)
+	ctx := context.Background()
+	stream := "test:" + t.Name() + ":orders"
+
+	// a consumer read the event and died without acking it
+	require.NoError(t, rdb.XGroupCreateMkStream(ctx, stream, "risk", "$").Err())
+	bus := newTestRedis(t, rdb, "c2")
+	require.NoError(t, bus.Publish(ctx, "orders", &Event{Type: "order.placed"}))
+	_, err := rdb.XReadGroup(ctx, &goredis.XReadGroupArgs{Group: "risk", Consumer: "dead", Streams: []string{stream, ">"}}).Result()
+	require.NoError(t, err)
+
+	got := &inbox{}
+	require.NoError(t, bus.Subscribe(ctx, "orders", "risk", got.handle))
+	events := got.waitFor(t, 1)
+	assert.Equal(t, "order.placed", events[0].Type)
+}
+
+func TestRedisDedup(t *testing.T) {
+	rdb := testsupport.Redis(t)
+	store := NewRedisDedup(rdb, "test:"+t.Name()+":")
+	// redis expires the keys itself, check the ttl is set and drop them
+	dedupStoreContract(t, store, func(d time.Duration) {
+		ctx := context.Background()
+		ttl, err := rdb.TTL(ctx, "test:"+t.Name()+":risk:e-1").Result()
+		require.NoError(t, err)
+		assert.InDelta(t, d.Seconds(), ttl.Seconds(), 5)
+		keys, err := rdb.Keys(ctx, "test:"+t.Name()+":*").Result()
+		require.NoError(t, err)
+		require.NoError(t, rdb.Del(ctx, keys...).Err())
+	})
+}
+
+func TestRedisDeadLetters(t *testing.T) {
+	rdb := testsupport.Redis(t)
+	key := "test:" + t.Name()
+	t.Cleanup(func() { rdb.Del(context.Background(), key) })
+	deadLetterStoreContract(t, NewRedisDeadLetters(rdb, key, 0))
+
+	_, err := NewRedisDeadLetters(rdb, key, 0).Get(context.Background(), "not-an-id")
+	assert.ErrorIs(t, err, ErrDeadLetterNotFound)
+}
+
+func TestRedisCheckpoints(t *testing.T) {
+	rdb := testsupport.Redis(t)
+	ctx := context.Background()
+	checkpoints := NewRedisCheckpoints(rdb, "test:"+t.Name()+":")
+	t.Cleanup(func() { checkpoints.Reset(ctx, "orders") })
+
+	cp, err := checkpoints.Load(ctx, "orders")
+	require.NoError(t, err)
+	assert.Zero(t, cp)
+
+	want := Checkpoint{Cursor: "42", Published: 42, UpdatedAt: time.UnixMilli(1700000000123).UTC(), Done: true}
+	require.NoError(t, checkpoints.Save(ctx, "orders", want))
+	cp, err = checkpoints.Load(ctx, "orders")
+	require.NoError(t, err)
+	assert.Equal(t, want, cp)
+
+	require.NoError(t, checkpoints.Reset(ctx, "orders"))
+	cp, err = checkpoints.Load(ctx, "orders")
+	require.NoError(t, err)
+	assert.Zero(t, cp)
+}
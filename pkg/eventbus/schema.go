@@ -0,0 +1,444 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package eventbus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Compatibility modes for EVENTBUS_SCHEMA_COMPATIBILITY, checked between
+// consecutive versions of an event type
+const (
+	// CompatBackward: consumers of the new version read old payloads,
+	// directly or through the new version's Upgrade
+	CompatBackward = "backward"
+	// CompatForward: consumers of the old version read new payloads, so
+	// publishers can upgrade before their consumers
+	CompatForward = "forward"
+	CompatFull    = "full"
+	CompatNone    = "none"
+)
+
+var upgraded = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_eventbus_upgraded_total",
+	Help: "Consumed events whose payload was upgraded, by type and the version it came in.",
+}, []string{"type", "from"})
+
+func init() {
+	prometheus.MustRegister(upgraded)
+}
+
+// Schema describes the payload of one version of an event type, as a JSON
+// Schema document or a protobuf message. Data is JSON either way, proto
+// payloads are the protojson of the message.
+type Schema struct {
+	Type    string
+	Version int
+	// JSONSchema is understood as far as type, properties, required and
+	// items go, other keywords are ignored
+	JSONSchema []byte
+	Proto      proto.Message
+	// Upgrade converts a payload of Version-1 to this version, nil when the
+	// old payload is valid as it is
+	Upgrade func(data json.RawMessage) (json.RawMessage, error)
+
+	json *jsonSchema
+}
+
+func (s *Schema) name() string {
+	return s.Type + " v" + strconv.Itoa(s.Version)
+}
+
+// DefaultSchemas is the registry New hands to the bus, event types
+// register their versions on it from init
+var DefaultSchemas = NewRegistry()
+
+// Registry keeps the schema versions of event types. Publish stamps events
+// of a registered type with the latest version and rejects payloads that
+// do not match it, consumers upgrade older payloads to the latest version
+// before the handler sees them. Types never registered pass unchecked.
+type Registry struct {
+	mu    sync.RWMutex
+	types map[string][]*Schema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{types: make(map[string][]*Schema)}
+}
+
+// Register adds a version of an event type
+func (r *Registry) Register(s Schema) error {
+	if s.Type == "" || s.Version < 1 {
+		return fmt.Errorf("schema %s: type and a version from 1 are required", s.name())
+	}
+	if (s.JSONSchema == nil) == (s.Proto == nil) {
+		return fmt.Errorf("schema %s: needs either a JSON Schema or a proto message", s.name())
+	}
+	if s.JSONSchema != nil {
+		s.json = &jsonSchema{}
+		if err := json.Unmarshal(s.JSONSchema, s.json); err != nil {
+			return fmt.Errorf("schema %s: %w", s.name(), err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range r.types[s.Type] {
+		if v.Version == s.Version {
+			return fmt.Errorf("schema %s: already registered", s.name())
+		}
+	}
+	// a new slice, Upgrade walks the old one without the lock
+	versions := append(append([]*Schema(nil), r.types[s.Type]...), &s)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	r.types[s.Type] = versions
+	return nil
+}
+
+// MustRegister registers schemas and panics on the first error
+func (r *Registry) MustRegister(schemas ...Schema) {
+	for _, s := range schemas {
+		if err := r.Register(s); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Check verifies that the versions of every type follow each other from
+// the first and that consecutive versions are compatible in mode. The bus
+// runs it at startup, so a breaking schema change fails the deploy
+// instead of downstream consumers.
+func (r *Registry) Check(mode string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var problems []string
+	types := make([]string, 0, len(r.types))
+	for typ := range r.types {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	for _, typ := range types {
+		versions := r.types[typ]
+		for i := 1; i < len(versions); i++ {
+			prev, next := versions[i-1], versions[i]
+			if next.Version != prev.Version+1 {
+				problems = append(problems, fmt.Sprintf("%s: version %d is missing", typ, prev.Version+1))
+				continue
+			}
+			if (prev.Proto == nil) != (next.Proto == nil) {
+				problems = append(problems, fmt.Sprintf("%s: mixes JSON Schema and proto versions", next.name()))
+				continue
+			}
+			for _, p := range compatibility(mode, prev, next) {
+				problems = append(problems, next.name()+": "+p)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("incompatible event schemas (%s): %s", mode, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// compatibility lists what breaks between consecutive versions in mode
+func compatibility(mode string, prev, next *Schema) []string {
+	var problems []string
+	if prev.Proto != nil {
+		// proto3 has no required fields, a JSON field only breaks by
+		// changing its kind
+		seen := make(map[protoreflect.FullName]bool)
+		compareMessages(prev.Proto.ProtoReflect().Descriptor(), next.Proto.ProtoReflect().Descriptor(), "", seen, &problems)
+		return problems
+	}
+	// an Upgrade takes care of old payloads for new consumers
+	if (mode == CompatBackward || mode == CompatFull) && next.Upgrade == nil {
+		compareJSON(next.json, prev.json, "", &problems)
+	}
+	if mode == CompatForward || mode == CompatFull {
+		compareJSON(prev.json, next.json, "", &problems)
+	}
+	return problems
+}
+
+// Validate checks the payload of e against the schema of its version
+func (r *Registry) Validate(e *Event) error {
+	s, err := r.schema(e.Type, e.Version)
+	if s == nil || err != nil {
+		return err
+	}
+	if s.Proto != nil {
+		msg := s.Proto.ProtoReflect().New().Interface()
+		if err := protojson.Unmarshal(e.Data, msg); err != nil {
+			return fmt.Errorf("event %s %s does not match %s: %w", e.Type, e.ID, s.name(), err)
+		}
+		return nil
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(e.Data, &payload); err != nil {
+		return fmt.Errorf("event %s %s: %w", e.Type, e.ID, err)
+	}
+	if err := s.json.validate(payload, ""); err != nil {
+		return fmt.Errorf("event %s %s does not match %s: %w", e.Type, e.ID, s.name(), err)
+	}
+	return nil
+}
+
+// Latest is the newest version of typ, 0 for types never registered
+func (r *Registry) Latest(typ string) int {
+	if r == nil {
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := r.types[typ]
+	if len(versions) == 0 {
+		return 0
+	}
+	return versions[len(versions)-1].Version
+}
+
+// Upgrade converts the payload of e up to the latest version of its type.
+// Events without a version predate versioning and count as the first.
+// Newer versions than this process knows pass as they are.
+func (r *Registry) Upgrade(e *Event) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	versions := r.types[e.Type]
+	r.mu.RUnlock()
+	if len(versions) == 0 {
+		return nil
+	}
+	if e.Version == 0 {
+		e.Version = versions[0].Version
+	}
+
+	from := e.Version
+	for _, s := range versions {
+		if s.Version <= e.Version {
+			continue
+		}
+		if s.Upgrade != nil {
+			data, err := s.Upgrade(e.Data)
+			if err != nil {
+				return fmt.Errorf("upgrade event %s %s to %s: %w", e.Type, e.ID, s.name(), err)
+			}
+			e.Data = data
+		}
+		e.Version = s.Version
+	}
+	if e.Version != from {
+		upgraded.WithLabelValues(e.Type, strconv.Itoa(from)).Inc()
+	}
+	return nil
+}
+
+// schema returns the schema of a version, nil for types never registered
+func (r *Registry) schema(typ string, version int) (*Schema, error) {
+	if r == nil {
+		return nil, nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := r.types[typ]
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	for _, s := range versions {
+		if s.Version == version {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("event %s: unknown schema version %d", typ, version)
+}
+
+// jsonSchema is the part of JSON Schema the registry validates and
+// compares
+type jsonSchema struct {
+	Type       jsonTypes              `json:"type"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Required   []string               `json:"required"`
+	Items      *jsonSchema            `json:"items"`
+}
+
+// jsonTypes is "type", a name or a list of them
+type jsonTypes []string
+
+func (t *jsonTypes) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = jsonTypes{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New(`"type" must be a string or a list of strings`)
+	}
+	*t = many
+	return nil
+}
+
+// allows reports whether a value of JSON type typ is valid, an integer is
+// a number too
+func (t jsonTypes) allows(typ string) bool {
+	if len(t) == 0 {
+		return true
+	}
+	for _, want := range t {
+		if want == typ || (want == "number" && typ == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *jsonSchema) validate(v interface{}, path string) error {
+	if s == nil {
+		return nil
+	}
+	if typ := jsonTypeOf(v); !s.Type.allows(typ) {
+		return fmt.Errorf("%s is %s, want %s", pathOr(path), typ, strings.Join(s.Type, " or "))
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s is required", join(path, name))
+			}
+		}
+		for name, value := range v {
+			if err := s.Properties[name].validate(value, join(path, name)); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if err := s.Items.validate(item, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compareJSON lists what a reader schema rejects of payloads valid under
+// the writer schema
+func compareJSON(reader, writer *jsonSchema, path string, problems *[]string) {
+	if reader == nil || writer == nil {
+		return
+	}
+	if len(reader.Type) > 0 {
+		if len(writer.Type) == 0 {
+			*problems = append(*problems, fmt.Sprintf("%s became typed", pathOr(path)))
+		}
+		for _, typ := range writer.Type {
+			if !reader.Type.allows(typ) {
+				*problems = append(*problems, fmt.Sprintf("%s of type %s does not accept %s", pathOr(path), strings.Join(reader.Type, " or "), typ))
+				break
+			}
+		}
+	}
+	for _, name := range reader.Required {
+		if !contains(writer.Required, name) {
+			*problems = append(*problems, fmt.Sprintf("%s is required", join(path, name)))
+		}
+	}
+	for name, r := range reader.Properties {
+		compareJSON(r, writer.Properties[name], join(path, name), problems)
+	}
+	compareJSON(reader.Items, writer.Items, path+"[]", problems)
+}
+
+// compareMessages lists fields present in both messages, by JSON name,
+// whose kind changed
+func compareMessages(prev, next protoreflect.MessageDescriptor, path string, seen map[protoreflect.FullName]bool, problems *[]string) {
+	if seen[prev.FullName()] {
+		return
+	}
+	seen[prev.FullName()] = true
+	fields := next.Fields()
+	for i := 0; i < prev.Fields().Len(); i++ {
+		old := prev.Fields().Get(i)
+		f := fields.ByJSONName(old.JSONName())
+		if f == nil {
+			continue
+		}
+		name := join(path, old.JSONName())
+		if f.Kind() != old.Kind() || f.IsList() != old.IsList() || f.IsMap() != old.IsMap() {
+			*problems = append(*problems, fmt.Sprintf("%s changed from %s to %s", name, describe(old), describe(f)))
+			continue
+		}
+		if old.Message() != nil && !old.IsMap() {
+			compareMessages(old.Message(), f.Message(), name, seen, problems)
+		}
+	}
+}
+
+func describe(f protoreflect.FieldDescriptor) string {
+	switch {
+	case f.IsMap():
+		return "map"
+	case f.IsList():
+		return "repeated " + f.Kind().String()
+	}
+	return f.Kind().String()
+}
+
+func jsonTypeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func pathOr(path string) string {
+	if path == "" {
+		return "payload"
+	}
+	return path
+}
@@ -0,0 +1,197 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	orderV1 = `{"type":"object","required":["id","amount"],"properties":{
+		"id":{"type":"string"},"amount":{"type":"integer"},
+		"tags":{"type":"array","items":{"type":"string"}}}}`
+	// v2 renames amount to amount_cents, old payloads need an upgrade
+	orderV2 = `{"type":"object","required":["id","amount_cents"],"properties":{
+		"id":{"type":"string"},"amount_cents":{"type":"integer"}}}`
+)
+
+func upgradeOrderV2(data json.RawMessage) (json.RawMessage, error) {
+	var v1 struct {
+		ID     string `json:"id"`
+		Amount int    `json:"amount"`
+	}
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return nil, err
+	}
+	if v1.Amount < 0 {
+		return nil, errors.New("negative amount")
+	}
+	return json.Marshal(map[string]interface{}{"id": v1.ID, "amount_cents": v1.Amount * 100})
+}
+
+func orderSchemas(t *testing.T) *Registry {
+	r := NewRegistry()
+	require.NoError(t, r.Register(Schema{Type: "order.placed", Version: 1, JSONSchema: []byte(orderV1)}))
+	require.NoError(t, r.Register(Schema{Type: "order.placed", Version: 2, JSONSchema: []byte(orderV2), Upgrade: upgradeOrderV2}))
+	return r
+}
+
+func TestSchemaValidateOnPublish(t *testing.T) {
+	bus := NewMemory(Options{Schemas: orderSchemas(t)})
+	defer bus.Close()
+	ctx := context.Background()
+	in := &inbox{}
+	require.NoError(t, bus.Subscribe(ctx, "orders", "risk", in.handle))
+
+	e := &Event{Type: "order.placed", Data: []byte(`{"id":"o-1","amount_cents":500}`)}
+	require.NoError(t, bus.Publish(ctx, "orders", e))
+	assert.Equal(t, 2, e.Version, "stamped with the latest version")
+
+	err := bus.Publish(ctx, "orders", &Event{Type: "order.placed", Data: []byte(`{"id":"o-2","amount_cents":"5"}`)})
+	assert.ErrorContains(t, err, "amount_cents is string, want integer")
+	err = bus.Publish(ctx, "orders", &Event{Type: "order.placed", Version: 1, Data: []byte(`{"id":"o-3","amount":1,"tags":[1]}`)})
+	assert.ErrorContains(t, err, "tags[0] is integer, want string")
+	err = bus.Publish(ctx, "orders", &Event{Type: "order.placed", Version: 3, Data: []byte(`{}`)})
+	assert.ErrorContains(t, err, "unknown schema version 3")
+
+	// types never registered are not checked
+	require.NoError(t, bus.Publish(ctx, "orders", &Event{Type: "order.cancelled", Data: []byte(`"anything"`)}))
+	in.waitFor(t, 2)
+}
+
+func TestSchemaUpgradeOnConsume(t *testing.T) {
+	schemas := orderSchemas(t)
+	bus := NewMemory(Options{Schemas: schemas, MaxDeliveries: 1})
+	defer bus.Close()
+	ctx := context.Background()
+	in := &inbox{}
+	require.NoError(t, bus.Subscribe(ctx, "orders", "risk", in.handle))
+
+	before := testutil.ToFloat64(upgraded.WithLabelValues("order.placed", "1"))
+	droppedBefore := testutil.ToFloat64(dropped.WithLabelValues("orders", "schema"))
+	require.NoError(t, bus.Publish(ctx, "orders",
+		&Event{Type: "order.placed", Version: 1, Data: []byte(`{"id":"o-1","amount":5}`)},
+		&Event{Type: "order.placed", Version: 1, Data: []byte(`{"id":"o-2","amount":-1}`)},
+	))
+
+	got := in.waitFor(t, 1)
+	assert.Equal(t, 2, got[0].Version)
+	assert.JSONEq(t, `{"id":"o-1","amount_cents":500}`, string(got[0].Data))
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(dropped.WithLabelValues("orders", "schema")) == droppedBefore+1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, before+1, testutil.ToFloat64(upgraded.WithLabelValues("order.placed", "1")), "the failed upgrade is not counted")
+}
+
+func TestSchemaUpgradeUnversioned(t *testing.T) {
+	schemas := orderSchemas(t)
+	// published before versioning, counts as v1
+	e := &Event{Type: "order.placed", Data: []byte(`{"id":"o-1","amount":2}`)}
+	require.NoError(t, schemas.Upgrade(e))
+	assert.Equal(t, 2, e.Version)
+	assert.JSONEq(t, `{"id":"o-1","amount_cents":200}`, string(e.Data))
+
+	// newer than this process knows, passes as it is
+	e = &Event{Type: "order.placed", Version: 3, Data: []byte(`{"total":1}`)}
+	require.NoError(t, schemas.Upgrade(e))
+	assert.Equal(t, 3, e.Version)
+	assert.JSONEq(t, `{"total":1}`, string(e.Data))
+}
+
+func TestSchemaCheck(t *testing.T) {
+	assert.NoError(t, orderSchemas(t).Check(CompatBackward))
+
+	// a new required field without an upgrade breaks new consumers
+	r := NewRegistry()
+	r.MustRegister(
+		Schema{Type: "order.placed", Version: 1, JSONSchema: []byte(orderV1)},
+		Schema{Type: "order.placed", Version: 2, JSONSchema: []byte(orderV2)},
+	)
+	err := r.Check(CompatBackward)
+	assert.ErrorContains(t, err, "order.placed v2: amount_cents is required")
+	assert.NoError(t, r.Check(CompatNone))
+
+	// dropping a required field or changing a type breaks old consumers,
+	// upgrades do not help them
+	r = NewRegistry()
+	r.MustRegister(
+		Schema{Type: "order.placed", Version: 1, JSONSchema: []byte(orderV1)},
+		Schema{Type: "order.placed", Version: 2, Upgrade: upgradeOrderV2, JSONSchema: []byte(
+			`{"type":"object","required":["id"],"properties":{"id":{"type":"integer"},"amount":{"type":"integer"}}}`)},
+	)
+	assert.NoError(t, r.Check(CompatBackward))
+	err = r.Check(CompatForward)
+	assert.ErrorContains(t, err, "amount is required")
+	assert.ErrorContains(t, err, "id of type string does not accept integer")
+
+	// versions have to follow each other
+	r = NewRegistry()
+	r.MustRegister(
+		Schema{Type: "order.placed", Version: 1, JSONSchema: []byte(orderV1)},
+		Schema{Type: "order.placed", Version: 3, JSONSchema: []byte(orderV1)},
+	)
+	assert.ErrorContains(t, r.Check(CompatNone), "version 2 is missing")
+
+	assert.Error(t, r.Register(Schema{Type: "order.placed", Version: 1, JSONSchema: []byte(orderV1)}), "duplicate")
+	assert.Error(t, r.Register(Schema{Type: "order.placed", Version: 4}), "no schema")
+	assert.Error(t, r.Register(Schema{Type: "order.placed", Version: 4, JSONSchema: []byte(`{"type":1}`)}))
+}
+
+// message builds a proto message type with the given fields
+func message(t *testing.T, name string, fields ...*descriptorpb.FieldDescriptorProto) proto.Message {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String(name + ".proto"),
+		Package:     proto.String("test"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String(name), Field: fields}},
+	}, nil)
+	require.NoError(t, err)
+	return dynamicpb.NewMessage(fd.Messages().Get(0))
+}
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Type:     typ.Enum(),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+}
+
+func TestSchemaProto(t *testing.T) {
+	v1 := message(t, "OrderV1",
+		field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+		field("amount", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64))
+	v2 := message(t, "OrderV2",
+		field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+		field("note", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING))
+	v3 := message(t, "OrderV3",
+		field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64))
+
+	r := NewRegistry()
+	r.MustRegister(
+		Schema{Type: "order.placed", Version: 1, Proto: v1},
+		Schema{Type: "order.placed", Version: 2, Proto: v2},
+	)
+	assert.NoError(t, r.Check(CompatFull))
+
+	require.NoError(t, r.Validate(&Event{Type: "order.placed", Version: 2, Data: []byte(`{"id":"o-1","note":"rush"}`)}))
+	assert.Error(t, r.Validate(&Event{Type: "order.placed", Version: 2, Data: []byte(`{"id":"o-1","amount":"5"}`)}))
+
+	r.MustRegister(Schema{Type: "order.placed", Version: 3, Proto: v3})
+	assert.ErrorContains(t, r.Check(CompatNone), "order.placed v3: id changed from string to int64")
+
+	r.MustRegister(Schema{Type: "order.placed", Version: 4, JSONSchema: []byte(orderV1)})
+	assert.ErrorContains(t, r.Check(CompatNone), "mixes JSON Schema and proto versions")
+}
@@ -0,0 +1,391 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package fault injects latency and errors into redis commands, postgres
+// statements and outgoing gRPC calls, so retries, breakers and degraded
+// modes can be exercised in staging rather than first met in an outage.
+//
+//	faults, err := fault.New(cfg, log)
+//	rdb.AddHook(faults.RedisHook())
+//	gdb.Use(faults.Plugin())
+//	grpc.NewClient(target, grpc.WithChainUnaryInterceptor(faults.UnaryClientInterceptor()))
+//
+// New is nil unless FAULT_INJECTION is on, a nil Injector and everything
+// it returns does nothing. Injected errors look like the real failures:
+// a reset connection for redis, a postgres connection_failure and a gRPC
+// status, so errors.IsTransient and the retries behind it treat them the
+// same; errors.Is(err, fault.ErrInjected) tells them apart.
+package fault
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/logger"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// Targets a Rule applies to
+const (
+	Redis    = "redis"
+	Postgres = "postgres"
+	GRPC     = "grpc"
+)
+
+type Kind string
+
+const (
+	Latency Kind = "latency"
+	Error   Kind = "error"
+)
+
+// ReasonInjected is the ErrorInfo reason of injected gRPC errors
+const ReasonInjected = "FAULT_INJECTED"
+
+// ErrInjected is in the chain of every injected error
+var ErrInjected = stderrors.New("fault injected")
+
+var injected = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_fault_injected_total",
+	Help: "Faults injected by target (redis, postgres, grpc) and kind (latency, error).",
+}, []string{"target", "kind"})
+
+func init() {
+	prometheus.MustRegister(injected)
+}
+
+// Rule hits Rate of the calls to Target with Latency or an error
+type Rule struct {
+	Target string
+	// Match narrows the rule to one redis command (get), postgres table or
+	// gRPC method (full, Service/Method, the service or the method name),
+	// empty matches every call
+	Match   string
+	Kind    Kind
+	Latency time.Duration
+	// Code of injected gRPC errors, Unavailable when unset
+	Code codes.Code
+	// Rate is the share of calls hit, above 0 and up to 1
+	Rate float64
+}
+
+func (r Rule) Validate() error {
+	switch r.Target {
+	case Redis, Postgres, GRPC:
+	default:
+		return fmt.Errorf("unknown target %q, want redis, postgres or grpc", r.Target)
+	}
+	if r.Rate <= 0 || r.Rate > 1 {
+		return fmt.Errorf("%s: rate %v is not above 0 and up to 1", r.Target, r.Rate)
+	}
+	switch r.Kind {
+	case Latency:
+		if r.Latency <= 0 {
+			return fmt.Errorf("%s: latency must be above 0", r.Target)
+		}
+	case Error:
+		if r.Code != codes.OK && r.Target != GRPC {
+			return fmt.Errorf("%s: only grpc errors take a code", r.Target)
+		}
+	default:
+		return fmt.Errorf("%s: unknown fault %q, want latency or error", r.Target, r.Kind)
+	}
+	return nil
+}
+
+// String is the rule in ParseRules syntax
+func (r Rule) String() string {
+	var b strings.Builder
+	b.WriteString(r.Target)
+	if r.Match != "" {
+		b.WriteString("/" + r.Match)
+	}
+	b.WriteString(":" + string(r.Kind))
+	switch {
+	case r.Kind == Latency:
+		b.WriteString("=" + r.Latency.String())
+	case r.Code != codes.OK:
+		b.WriteString("=" + CodeName(r.Code))
+	}
+	b.WriteString("@" + strconv.FormatFloat(r.Rate, 'g', -1, 64))
+	return b.String()
+}
+
+// ParseRules reads comma separated rules, target[/match]:fault[@rate]
+// with fault latency=<duration>, error or, for grpc, error=<CODE>. The
+// rate defaults to 1.
+//
+//	redis/get:latency=200ms@0.1, postgres:error@0.05, grpc/GetQuote:error=DEADLINE_EXCEEDED@0.2
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		r, err := parseRule(part)
+		if err != nil {
+			return nil, fmt.Errorf("fault rule %q: %w", part, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func parseRule(s string) (Rule, error) {
+	r := Rule{Rate: 1}
+	if head, rate, ok := strings.Cut(s, "@"); ok {
+		f, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			return r, fmt.Errorf("rate: %w", err)
+		}
+		s, r.Rate = head, f
+	}
+	where, fault, ok := strings.Cut(s, ":")
+	if !ok {
+		return r, stderrors.New("want target[/match]:fault[@rate]")
+	}
+	r.Target, r.Match, _ = strings.Cut(where, "/")
+
+	kind, value, _ := strings.Cut(fault, "=")
+	r.Kind = Kind(kind)
+	switch {
+	case r.Kind == Latency:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return r, fmt.Errorf("latency: %w", err)
+		}
+		r.Latency = d
+	case r.Kind == Error && value != "":
+		code, err := ParseCode(value)
+		if err != nil {
+			return r, err
+		}
+		r.Code = code
+	}
+	return r, r.Validate()
+}
+
+// ParseCode reads a gRPC code name like UNAVAILABLE
+func ParseCode(name string) (codes.Code, error) {
+	var c codes.Code
+	if err := c.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(name)))); err != nil {
+		return c, fmt.Errorf("unknown gRPC code %q", name)
+	}
+	return c, nil
+}
+
+// CodeName is the name ParseCode reads, UNAVAILABLE, where codes.Code
+// prints Unavailable
+func CodeName(c codes.Code) string {
+	var b strings.Builder
+	for i, r := range c.String() {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
+
+type Options struct {
+	// Rand picks the calls hit, a number in [0, 1), math/rand by default
+	Rand  func() float64
+	Clock clock.Clock
+}
+
+// Injector holds the rules in force, it is safe for concurrent use
+type Injector struct {
+	log  *logger.Logger
+	opts Options
+
+	mu    sync.RWMutex
+	rules []Rule
+	until time.Time
+}
+
+// New is nil with fault injection off, otherwise an Injector with the
+// FAULT_RULES in force
+func New(cfg *config.Config, log *logger.Logger) (*Injector, error) {
+	if !cfg.Faults.Enabled {
+		return nil, nil
+	}
+	rules, err := ParseRules(cfg.Faults.Rules)
+	if err != nil {
+		return nil, err
+	}
+	i := NewWithOptions(log, Options{})
+	if len(rules) > 0 {
+		i.Set(rules, 0)
+	}
+	return i, nil
+}
+
+func NewWithOptions(log *logger.Logger, opts Options) *Injector {
+	if opts.Rand == nil {
+		opts.Rand = rand.Float64
+	}
+	opts.Clock = clock.Or(opts.Clock)
+	return &Injector{log: log, opts: opts}
+}
+
+// Set replaces the rules, none turns injection off. With ttl above 0 they
+// are dropped after it, a forgotten experiment ends by itself.
+func (i *Injector) Set(rules []Rule, ttl time.Duration) error {
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	var until time.Time
+	if ttl > 0 && len(rules) > 0 {
+		until = i.opts.Clock.Now().Add(ttl)
+	}
+
+	i.mu.Lock()
+	i.rules = append([]Rule(nil), rules...)
+	i.until = until
+	i.mu.Unlock()
+
+	if i.log == nil {
+		return nil
+	}
+	if len(rules) == 0 {
+		i.log.Warnf("Fault injection cleared")
+		return nil
+	}
+	i.log.WithFields(map[string]interface{}{"until": until}).Warnf("Injecting faults: %s", joinRules(rules))
+	return nil
+}
+
+// Rules are those in force and when they expire, zero for never
+func (i *Injector) Rules() ([]Rule, time.Time) {
+	if i == nil {
+		return nil, time.Time{}
+	}
+	rules := i.current()
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return append([]Rule(nil), rules...), i.until
+}
+
+// current is the rules slice in force, Set replaces it and never changes
+// one handed out
+func (i *Injector) current() []Rule {
+	i.expire()
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.rules
+}
+
+// expire drops rules whose ttl ran out
+func (i *Injector) expire() {
+	i.mu.RLock()
+	expired := !i.until.IsZero() && !i.opts.Clock.Now().Before(i.until)
+	i.mu.RUnlock()
+	if !expired {
+		return
+	}
+
+	i.mu.Lock()
+	// another call may have dropped or replaced them meanwhile
+	expired = !i.until.IsZero() && !i.opts.Clock.Now().Before(i.until)
+	if expired {
+		i.rules, i.until = nil, time.Time{}
+	}
+	i.mu.Unlock()
+	if expired && i.log != nil {
+		i.log.Warnf("Fault rules expired, fault injection cleared")
+	}
+}
+
+// Inject applies the rules matching a call, name being the redis command,
+// postgres table or gRPC method: it waits out injected latency and returns
+// an injected error. A nil Injector injects nothing.
+func (i *Injector) Inject(ctx context.Context, target, name string) error {
+	if i == nil {
+		return nil
+	}
+	for _, r := range i.current() {
+		if r.Target != target || !matches(r.Match, name) || i.opts.Rand() >= r.Rate {
+			continue
+		}
+		injected.WithLabelValues(target, string(r.Kind)).Inc()
+		if r.Kind == Latency {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-i.opts.Clock.After(r.Latency):
+			}
+			continue
+		}
+		return newError(r, name)
+	}
+	return nil
+}
+
+// InjectedError is what Inject fails with, its chain holds ErrInjected and
+// the failure it stands for
+type InjectedError struct {
+	Target string
+	Name   string
+	cause  error
+}
+
+func (e *InjectedError) Error() string {
+	return fmt.Sprintf("injected %s fault on %q: %v", e.Target, e.Name, e.cause)
+}
+
+func (e *InjectedError) Unwrap() []error {
+	return []error{ErrInjected, e.cause}
+}
+
+func newError(r Rule, name string) error {
+	switch r.Target {
+	case Redis:
+		return &InjectedError{Target: r.Target, Name: name, cause: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}
+	case Postgres:
+		return &InjectedError{Target: r.Target, Name: name, cause: &pgconn.PgError{Severity: "FATAL", Code: "08006", Message: "fault injected"}}
+	}
+	// a status error as it comes off the wire, the gRPC stack reads it
+	// from the error itself
+	code := r.Code
+	if code == codes.OK {
+		code = codes.Unavailable
+	}
+	return errors.New(code, ReasonInjected, name).Wrap(ErrInjected)
+}
+
+// matches takes a gRPC method as "/pkg.Service/Method" or any part of it
+func matches(match, name string) bool {
+	if match == "" || strings.EqualFold(match, name) {
+		return true
+	}
+	full := strings.TrimPrefix(name, "/")
+	if !strings.Contains(full, "/") {
+		return false
+	}
+	service, method, _ := strings.Cut(full, "/")
+	return match == full || match == service || match == method
+}
+
+func joinRules(rules []Rule) string {
+	out := make([]string, len(rules))
+	for n, r := range rules {
+		out[n] = r.String()
+	}
+	return strings.Join(out, ", ")
+}
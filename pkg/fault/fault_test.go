@@ -0,0 +1,212 @@
+package fault
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/db"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/testsupport"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fixed always rolls v
+func fixed(v float64) func() float64 {
+	return func() float64 { return v }
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("redis/get:latency=200ms@0.1, postgres:error@0.05,grpc/GetQuote:error=deadline_exceeded,")
+	require.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Target: Redis, Match: "get", Kind: Latency, Latency: 200 * time.Millisecond, Rate: 0.1},
+		{Target: Postgres, Kind: Error, Rate: 0.05},
+		{Target: GRPC, Match: "GetQuote", Kind: Error, Code: codes.DeadlineExceeded, Rate: 1},
+	}, rules)
+	assert.Equal(t, "grpc/GetQuote:error=DEADLINE_EXCEEDED@1", rules[2].String())
+
+	again, err := ParseRules(joinRules(rules))
+	require.NoError(t, err)
+	assert.Equal(t, rules, again)
+
+	rules, err = ParseRules("grpc/blueprint.Blueprint/Call:error")
+	require.NoError(t, err)
+	assert.Equal(t, "blueprint.Blueprint/Call", rules[0].Match)
+
+	for _, bad := range []string{
+		"kafka:error",
+		"redis",
+		"redis:latency",
+		"redis:latency=-1s",
+		"redis:timeout",
+		"redis:error@0",
+		"redis:error@1.5",
+		"redis:error=UNAVAILABLE",
+		"grpc:error=NOPE",
+	} {
+		_, err := ParseRules(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestInject(t *testing.T) {
+	ctx := context.Background()
+	var off *Injector
+	assert.NoError(t, off.Inject(ctx, Redis, "get"), "a nil injector does nothing")
+
+	i := NewWithOptions(nil, Options{Rand: fixed(0.5)})
+	assert.NoError(t, i.Inject(ctx, Redis, "get"), "no rules")
+
+	require.NoError(t, i.Set([]Rule{
+		{Target: Redis, Match: "GET", Kind: Error, Rate: 0.6},
+		{Target: Postgres, Match: "orders", Kind: Error, Rate: 0.4},
+		{Target: GRPC, Match: "blueprint.Blueprint", Kind: Error, Code: codes.ResourceExhausted, Rate: 1},
+	}, 0))
+
+	err := i.Inject(ctx, Redis, "get")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.True(t, errors.IsTransient(err), "looks like a reset connection")
+	assert.NoError(t, i.Inject(ctx, Redis, "set"), "other commands")
+	assert.NoError(t, i.Inject(ctx, Postgres, "orders"), "rolled above the rate")
+
+	err = i.Inject(ctx, GRPC, "/blueprint.Blueprint/Call")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.NoError(t, i.Inject(ctx, GRPC, "/grpc.health.v1.Health/Check"))
+
+	require.NoError(t, i.Set([]Rule{{Target: Postgres, Kind: Error, Rate: 1}}, 0))
+	err = i.Inject(ctx, Postgres, "")
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "08006", pgErr.Code)
+	assert.True(t, errors.IsTransient(err))
+
+	assert.Error(t, i.Set([]Rule{{Target: Redis, Kind: Error}}, 0), "rate 0")
+}
+
+func TestInjectLatency(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	i := NewWithOptions(nil, Options{Rand: fixed(0), Clock: fake})
+	require.NoError(t, i.Set([]Rule{{Target: Redis, Kind: Latency, Latency: time.Second, Rate: 1}}, 0))
+
+	done := make(chan error, 1)
+	go func() { done <- i.Inject(context.Background(), Redis, "get") }()
+	fake.BlockUntil(1)
+	select {
+	case <-done:
+		t.Fatal("returned before the latency passed")
+	default:
+	}
+	fake.Advance(time.Second)
+	assert.NoError(t, <-done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- i.Inject(ctx, Redis, "get") }()
+	fake.BlockUntil(1)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestRulesExpire(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	i := NewWithOptions(nil, Options{Rand: fixed(0), Clock: fake})
+	require.NoError(t, i.Set([]Rule{{Target: Redis, Kind: Error, Rate: 1}}, time.Minute))
+
+	rules, until := i.Rules()
+	assert.Len(t, rules, 1)
+	assert.Equal(t, fake.Now().Add(time.Minute), until)
+	assert.Error(t, i.Inject(context.Background(), Redis, "get"))
+
+	fake.Advance(time.Minute)
+	rules, until = i.Rules()
+	assert.Empty(t, rules)
+	assert.True(t, until.IsZero())
+	assert.NoError(t, i.Inject(context.Background(), Redis, "get"))
+}
+
+func TestNew(t *testing.T) {
+	i, err := New(&config.Config{}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, i, "off")
+
+	i, err = New(&config.Config{Faults: config.Faults{Enabled: true, Rules: "redis:error@0.5"}}, nil)
+	require.NoError(t, err)
+	rules, _ := i.Rules()
+	assert.Len(t, rules, 1)
+
+	_, err = New(&config.Config{Faults: config.Faults{Enabled: true, Rules: "redis:boom"}}, nil)
+	assert.Error(t, err)
+}
+
+func TestRedisHook(t *testing.T) {
+	i := NewWithOptions(nil, Options{Rand: fixed(0.5)})
+	require.NoError(t, i.Set([]Rule{{Target: Redis, Match: "get", Kind: Error, Rate: 0.6}}, 0))
+	// nothing listens here, only an injected error comes back without
+	// dialing
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+	client.AddHook(i.RedisHook())
+	ctx := context.Background()
+
+	err := client.Get(ctx, "k").Err()
+	assert.ErrorIs(t, err, ErrInjected)
+
+	err = client.Set(ctx, "k", "v", 0).Err()
+	require.Error(t, err)
+	assert.False(t, stderrors.Is(err, ErrInjected), "not matched, dialed")
+
+	require.NoError(t, i.Set([]Rule{{Target: Redis, Match: "pipeline", Kind: Error, Rate: 1}}, 0))
+	pipe := client.Pipeline()
+	get := pipe.Get(ctx, "k")
+	_, err = pipe.Exec(ctx)
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.ErrorIs(t, get.Err(), ErrInjected)
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	i := NewWithOptions(nil, Options{Rand: fixed(0)})
+	require.NoError(t, i.Set([]Rule{{Target: GRPC, Match: "GetQuote", Kind: Error, Rate: 1}}, 0))
+	intercept := i.UnaryClientInterceptor()
+	calls := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return nil
+	}
+
+	err := intercept(context.Background(), "/quotes.Quotes/GetQuote", nil, nil, nil, invoker)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Zero(t, calls, "never sent")
+
+	require.NoError(t, intercept(context.Background(), "/quotes.Quotes/ListQuotes", nil, nil, nil, invoker))
+	assert.Equal(t, 1, calls)
+}
+
+func TestPlugin(t *testing.T) {
+	cfg := &config.Config{Postgres: testsupport.Postgres(t)}
+	pg, err := db.NewPostgresDB(cfg, nil)
+	require.NoError(t, err)
+	defer pg.Close()
+	require.NoError(t, db.Migrate(cfg))
+
+	i := NewWithOptions(nil, Options{Rand: fixed(0)})
+	require.NoError(t, pg.DB.Use(i.Plugin()))
+	require.NoError(t, i.Set([]Rule{{Target: Postgres, Match: "platform_saga_instance", Kind: Error, Rate: 1}}, 0))
+
+	var n int64
+	err = pg.DB.Table("platform_saga_instance").Count(&n).Error
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.True(t, errors.IsTransient(err))
+	assert.NoError(t, pg.DB.Table("platform_projection_event").Count(&n).Error)
+}
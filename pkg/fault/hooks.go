@@ -0,0 +1,116 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package fault
+
+import (
+	"context"
+	"net"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
+)
+
+const pluginName = "blueprint:fault"
+
+// RedisHook injects into every command by its name (get, hset), a pipeline
+// as a whole under the name pipeline
+func (i *Injector) RedisHook() redis.Hook {
+	return redisHook{i: i}
+}
+
+type redisHook struct {
+	i *Injector
+}
+
+func (h redisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.i.Inject(ctx, Redis, cmd.Name()); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := h.i.Inject(ctx, Redis, "pipeline"); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// Plugin injects into postgres statements by their table, ahead of every
+// other callback so an injected error never begins a transaction. Raw SQL
+// has no table, only rules without a match hit it.
+func (i *Injector) Plugin() gorm.Plugin {
+	return gormPlugin{i: i}
+}
+
+type gormPlugin struct {
+	i *Injector
+}
+
+func (gormPlugin) Name() string {
+	return pluginName
+}
+
+func (p gormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("*").Register(pluginName+":create", p.inject); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("*").Register(pluginName+":query", p.inject); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("*").Register(pluginName+":update", p.inject); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("*").Register(pluginName+":delete", p.inject); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("*").Register(pluginName+":row", p.inject); err != nil {
+		return err
+	}
+	return cb.Raw().Before("*").Register(pluginName+":raw", p.inject)
+}
+
+func (p gormPlugin) inject(db *gorm.DB) {
+	if db.Error != nil || db.DryRun {
+		return
+	}
+	if err := p.i.Inject(db.Statement.Context, Postgres, db.Statement.Table); err != nil {
+		db.AddError(err)
+	}
+}
+
+// UnaryClientInterceptor injects into outgoing calls by method, before
+// they leave the process
+func (i *Injector) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := i.Inject(ctx, GRPC, method); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor injects when a stream opens
+func (i *Injector) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := i.Inject(ctx, GRPC, method); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,164 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package gctune sets the garbage collector up for steady latency. A
+// memory limit, given or taken as a share of the container's cgroup
+// limit, lets the heap grow close to what the pod may use before the GC
+// works harder, a higher GC percent collects less often and an optional
+// ballast keeps a small heap from being collected on every burst:
+//
+//	settings := gctune.Apply(gctune.Options{MemoryLimitRatio: 0.9, Log: log})
+//
+// GOGC and GOMEMLIMIT set in the environment are read by the Go runtime
+// itself and always win. The runtime metrics of the default registry are
+// extended with GC pauses, heap classes and scheduler latencies.
+package gctune
+
+import (
+	"math"
+	"os"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// cgroup v2 first, then v1
+var cgroupLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+var ballastBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "blueprint_runtime_ballast_bytes",
+	Help: "Size of the heap ballast, 0 without one.",
+})
+
+// ballast is never touched, its pages stay unmapped and it only moves the
+// GC target
+var ballast []byte
+
+func init() {
+	// swap the default Go collector for one with the runtime/metrics GC,
+	// memory and scheduler series: go_gc_*, go_memory_classes_* and
+	// go_sched_* including pause and latency histograms
+	prometheus.Unregister(collectors.NewGoCollector())
+	prometheus.MustRegister(
+		collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(
+			collectors.MetricsGC, collectors.MetricsMemory, collectors.MetricsScheduler,
+		)),
+		ballastBytes,
+	)
+}
+
+type Options struct {
+	// GCPercent as GOGC, 0 leaves the runtime default and -1 turns the
+	// collector off until the memory limit
+	GCPercent int
+	// MemoryLimit in bytes as GOMEMLIMIT, 0 leaves it unless
+	// MemoryLimitRatio is set
+	MemoryLimit int64
+	// MemoryLimitRatio sets the limit to this share of the cgroup memory
+	// limit when MemoryLimit is 0, e.g. 0.9. Outside a container with a
+	// limit nothing changes.
+	MemoryLimitRatio float64
+	// Ballast allocates this many bytes once and keeps them, 0 for none
+	Ballast int64
+	Log     *logger.Logger
+}
+
+// Settings is what Apply left the runtime with
+type Settings struct {
+	GCPercent   int
+	MemoryLimit int64
+	Ballast     int64
+}
+
+// Apply sets the runtime up from opts, call it once at startup
+func Apply(opts Options) Settings {
+	if opts.GCPercent != 0 {
+		if os.Getenv("GOGC") != "" {
+			opts.warn("GOGC is set, ignoring the configured GC percent")
+		} else {
+			debug.SetGCPercent(opts.GCPercent)
+		}
+	}
+
+	limit := opts.MemoryLimit
+	if limit == 0 && opts.MemoryLimitRatio > 0 {
+		if cgroup, ok := cgroupLimit(cgroupLimitFiles); ok {
+			limit = int64(float64(cgroup) * opts.MemoryLimitRatio)
+		}
+	}
+	if limit > 0 {
+		if os.Getenv("GOMEMLIMIT") != "" {
+			opts.warn("GOMEMLIMIT is set, ignoring the configured memory limit")
+		} else {
+			debug.SetMemoryLimit(limit)
+		}
+	}
+
+	if opts.Ballast > 0 && ballast == nil {
+		ballast = make([]byte, opts.Ballast)
+		ballastBytes.Set(float64(opts.Ballast))
+	}
+
+	return Current()
+}
+
+// Current reads the settings back from the runtime
+func Current() Settings {
+	samples := []metrics.Sample{{Name: "/gc/gogc:percent"}, {Name: "/gc/gomemlimit:bytes"}}
+	metrics.Read(samples)
+	s := Settings{
+		GCPercent:   int(int64(samples[0].Value.Uint64())),
+		MemoryLimit: int64(samples[1].Value.Uint64()),
+		Ballast:     int64(len(ballast)),
+	}
+	// an unset limit is MaxInt64, GC off reads as MaxUint64, i.e. -1
+	if s.MemoryLimit == math.MaxInt64 {
+		s.MemoryLimit = 0
+	}
+	return s
+}
+
+// Fields returns the settings as logger fields
+func (s Settings) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"gc_percent":   s.GCPercent,
+		"memory_limit": s.MemoryLimit,
+		"ballast":      s.Ballast,
+	}
+}
+
+func (o Options) warn(msg string) {
+	if o.Log != nil {
+		o.Log.Warn(msg)
+	}
+}
+
+// cgroupLimit is the memory limit of the first readable file, false when
+// there is none or it is "max"
+func cgroupLimit(files []string) (int64, bool) {
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "max" {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		// cgroup v1 reports no limit as a number near MaxInt64
+		if err != nil || n <= 0 || n >= math.MaxInt64/2 {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,90 @@
+package gctune
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// restore puts the runtime back as the test found it
+func restore(t *testing.T) {
+	percent := debug.SetGCPercent(-1)
+	debug.SetGCPercent(percent)
+	limit := debug.SetMemoryLimit(-1)
+	t.Cleanup(func() {
+		debug.SetGCPercent(percent)
+		debug.SetMemoryLimit(limit)
+	})
+}
+
+func writeLimit(t *testing.T, value string) string {
+	path := filepath.Join(t.TempDir(), "memory.max")
+	require.NoError(t, os.WriteFile(path, []byte(value+"\n"), 0o644))
+	return path
+}
+
+func TestApply(t *testing.T) {
+	restore(t)
+	t.Setenv("GOGC", "")
+	t.Setenv("GOMEMLIMIT", "")
+
+	s := Apply(Options{GCPercent: 200, MemoryLimit: 512 << 20, Ballast: 1 << 20})
+	assert.Equal(t, Settings{GCPercent: 200, MemoryLimit: 512 << 20, Ballast: 1 << 20}, s)
+	assert.Equal(t, float64(1<<20), testutil.ToFloat64(ballastBytes))
+
+	s = Apply(Options{GCPercent: -1, Ballast: 4 << 20})
+	assert.Equal(t, -1, s.GCPercent)
+	assert.Equal(t, int64(1<<20), s.Ballast, "the ballast is allocated once")
+
+	// the environment was read by the runtime already and wins
+	t.Setenv("GOGC", "100")
+	t.Setenv("GOMEMLIMIT", "1GiB")
+	s = Apply(Options{GCPercent: 50, MemoryLimit: 64 << 20})
+	assert.Equal(t, -1, s.GCPercent)
+	assert.Equal(t, int64(512<<20), s.MemoryLimit)
+}
+
+func TestApplyRatio(t *testing.T) {
+	restore(t)
+	t.Setenv("GOMEMLIMIT", "")
+	files := cgroupLimitFiles
+	t.Cleanup(func() { cgroupLimitFiles = files })
+
+	cgroupLimitFiles = []string{filepath.Join(t.TempDir(), "missing"), writeLimit(t, "1073741824")}
+	s := Apply(Options{MemoryLimitRatio: 0.5})
+	assert.Equal(t, int64(512<<20), s.MemoryLimit)
+
+	s = Apply(Options{MemoryLimit: 256 << 20, MemoryLimitRatio: 0.5})
+	assert.Equal(t, int64(256<<20), s.MemoryLimit, "an explicit limit wins")
+}
+
+func TestCgroupLimit(t *testing.T) {
+	n, ok := cgroupLimit([]string{writeLimit(t, "2147483648")})
+	assert.True(t, ok)
+	assert.Equal(t, int64(2<<30), n)
+
+	_, ok = cgroupLimit([]string{writeLimit(t, "max")})
+	assert.False(t, ok, "cgroup v2 without a limit")
+	_, ok = cgroupLimit([]string{writeLimit(t, "9223372036854771712")})
+	assert.False(t, ok, "cgroup v1 without a limit")
+	_, ok = cgroupLimit([]string{filepath.Join(t.TempDir(), "missing")})
+	assert.False(t, ok)
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	names := map[string]bool{}
+	for _, f := range families {
+		names[f.GetName()] = true
+	}
+	for _, name := range []string{"go_gc_duration_seconds", "go_gc_gogc_percent", "go_memory_classes_heap_objects_bytes", "go_sched_latencies_seconds"} {
+		assert.True(t, names[name], name)
+	}
+}
@@ -0,0 +1,24 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package grpcmethod matches gRPC methods against the names used in
+// config: a full method ("/blueprint.Blueprint/Call"), a service
+// ("blueprint.Blueprint") or a bare method name ("Call").
+package grpcmethod
+
+import "strings"
+
+// Match tells whether name picks out fullMethod
+func Match(name, fullMethod string) bool {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return name == fullMethod || name == service || name == method
+}
+
+// MatchAny tells whether any of names picks out fullMethod
+func MatchAny(names []string, fullMethod string) bool {
+	for _, name := range names {
+		if Match(name, fullMethod) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package grpcmethod
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	const full = "/blueprint.Blueprint/Call"
+	for _, name := range []string{full, "blueprint.Blueprint", "Call"} {
+		assert.True(t, Match(name, full), name)
+	}
+	for _, name := range []string{"", "blueprint", "Cal", "blueprint.Blueprint/Call", "/blueprint.Blueprint/Version"} {
+		assert.False(t, Match(name, full), name)
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	assert.True(t, MatchAny([]string{"Version", "grpc.health.v1.Health"}, "/grpc.health.v1.Health/Check"))
+	assert.False(t, MatchAny([]string{"Version"}, "/blueprint.Blueprint/Call"))
+	assert.False(t, MatchAny(nil, "/blueprint.Blueprint/Call"))
+}
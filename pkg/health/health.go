@@ -0,0 +1,274 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package health turns readiness check results into a state per
+// dependency, healthy, degraded or down, and reports every change: a log
+// entry, the blueprint_health_state gauge and, with a Notifier, an alert.
+//
+//	tracker := health.NewTracker(health.FromConfig(cfg, log, notifier))
+//	lc.SetCheckObserver(tracker.Observe)
+//
+// A check that returns Degrade(err) is degraded rather than down, the pod
+// stays in rotation. Flapping checks are held back twice: a new state only
+// counts once Confirm results in a row agree, and a dependency is notified
+// about at most once per NotifyInterval, about the state it settled in.
+package health
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/notify"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type State int
+
+const (
+	Healthy State = iota
+	Degraded
+	Down
+)
+
+var states = []State{Healthy, Degraded, Down}
+
+func (s State) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Degraded:
+		return "degraded"
+	default:
+		return "down"
+	}
+}
+
+var (
+	stateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_health_state",
+		Help: "1 for the state each dependency is in, healthy, degraded or down, 0 for the others.",
+	}, []string{"dependency", "state"})
+
+	transitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_health_transitions_total",
+		Help: "Dependency state changes by dependency and the state changed to.",
+	}, []string{"dependency", "state"})
+
+	held = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_health_notifications_held_total",
+		Help: "State changes not notified because the dependency was notified about within HEALTH_NOTIFY_INTERVAL.",
+	}, []string{"dependency"})
+)
+
+func init() {
+	prometheus.MustRegister(stateGauge, transitions, held)
+}
+
+// degradedError marks a check result as degraded
+type degradedError struct {
+	err error
+}
+
+func (e *degradedError) Error() string { return e.err.Error() }
+func (e *degradedError) Unwrap() error { return e.err }
+
+// Degrade makes a failing check degraded instead of down, nil stays nil
+func Degrade(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &degradedError{err: err}
+}
+
+// IsDegraded reports whether err came from Degrade
+func IsDegraded(err error) bool {
+	var d *degradedError
+	return errors.As(err, &d)
+}
+
+// StateOf is the state a check result puts its dependency in
+func StateOf(err error) State {
+	switch {
+	case err == nil:
+		return Healthy
+	case IsDegraded(err):
+		return Degraded
+	default:
+		return Down
+	}
+}
+
+// Notifier is where alerts go, *notify.Notifier is one
+type Notifier interface {
+	Send(msg notify.Message) bool
+}
+
+type Options struct {
+	// Confirm is how many results in a row a new state needs, 1 switches
+	// on the first
+	Confirm int
+	// NotifyInterval is the least time between two notifications about one
+	// dependency, changes in between are only logged
+	NotifyInterval time.Duration
+	Logger         *logger.Logger
+	// Notifier nil only logs and exports the state
+	Notifier Notifier
+	Clock    clock.Clock
+}
+
+// FromConfig is Options from cfg.Health, notifier may be nil
+func FromConfig(cfg *config.Config, log *logger.Logger, notifier *notify.Notifier) Options {
+	opts := Options{
+		Confirm:        cfg.Health.Confirm,
+		NotifyInterval: cfg.Health.NotifyInterval,
+		Logger:         log,
+	}
+	// a nil *notify.Notifier in the interface would not compare to nil
+	if notifier != nil {
+		opts.Notifier = notifier
+	}
+	return opts
+}
+
+type dependency struct {
+	state State
+	err   string
+	// candidate is the state the last results agree on, seen how many
+	candidate State
+	seen      int
+	// notified is the state last notified about, every dependency starts
+	// healthy
+	notified   State
+	notifiedAt time.Time
+	held       int
+}
+
+// Tracker keeps the state of every dependency it has seen a result of
+type Tracker struct {
+	opts Options
+
+	mu   sync.Mutex
+	deps map[string]*dependency
+}
+
+func NewTracker(opts Options) *Tracker {
+	if opts.Confirm < 1 {
+		opts.Confirm = 1
+	}
+	opts.Clock = clock.Or(opts.Clock)
+	return &Tracker{opts: opts, deps: make(map[string]*dependency)}
+}
+
+// Observe takes the result of one check, it fits
+// lifecycle.SetCheckObserver and does not block
+func (t *Tracker) Observe(name string, err error) {
+	state := StateOf(err)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.deps[name]
+	if !ok {
+		d = &dependency{}
+		t.deps[name] = d
+		setGauge(name, Healthy)
+	}
+	if err != nil {
+		d.err = err.Error()
+	}
+
+	changed := false
+	if state == d.state {
+		d.candidate, d.seen = state, 0
+	} else {
+		if state != d.candidate {
+			d.candidate, d.seen = state, 0
+		}
+		d.seen++
+		if d.seen >= t.opts.Confirm {
+			t.transition(name, d, state)
+			changed = true
+		}
+	}
+
+	t.notify(name, d, changed)
+}
+
+// States is the current state of every dependency seen
+func (t *Tracker) States() map[string]State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]State, len(t.deps))
+	for name, d := range t.deps {
+		out[name] = d.state
+	}
+	return out
+}
+
+func (t *Tracker) transition(name string, d *dependency, state State) {
+	from := d.state
+	d.state, d.seen = state, 0
+	transitions.WithLabelValues(name, state.String()).Inc()
+	setGauge(name, state)
+
+	if t.opts.Logger == nil {
+		return
+	}
+	log := t.opts.Logger.WithFields(map[string]interface{}{
+		"dependency": name,
+		"from":       from.String(),
+		"to":         state.String(),
+	})
+	switch state {
+	case Down:
+		log.Errorf("Dependency %s is down: %s", name, d.err)
+	case Degraded:
+		log.Warnf("Dependency %s is degraded: %s", name, d.err)
+	default:
+		log.Infof("Dependency %s is healthy again", name)
+	}
+}
+
+// notify sends the state d is in unless it was notified about already or
+// too recently, a held back change goes out once the interval is over
+func (t *Tracker) notify(name string, d *dependency, changed bool) {
+	if t.opts.Notifier == nil || d.state == d.notified {
+		return
+	}
+	now := t.opts.Clock.Now()
+	if !d.notifiedAt.IsZero() && now.Sub(d.notifiedAt) < t.opts.NotifyInterval {
+		if changed {
+			d.held++
+			held.WithLabelValues(name).Inc()
+		}
+		return
+	}
+
+	msg := notify.Message{Severity: notify.Warning, Key: "health_check_recovered", Args: []interface{}{name}}
+	switch d.state {
+	case Down:
+		msg = notify.Message{Severity: notify.Critical, Key: "health_check_failed", Args: []interface{}{name, d.err}}
+	case Degraded:
+		msg = notify.Message{Severity: notify.Warning, Key: "health_check_degraded", Args: []interface{}{name, d.err}}
+	}
+	if d.held > 0 {
+		msg.Fields = map[string]string{"changes_held_back": strconv.Itoa(d.held)}
+	}
+	t.opts.Notifier.Send(msg)
+	d.notified, d.notifiedAt, d.held = d.state, now, 0
+}
+
+func setGauge(name string, current State) {
+	for _, s := range states {
+		v := 0.0
+		if s == current {
+			v = 1
+		}
+		stateGauge.WithLabelValues(name, s.String()).Set(v)
+	}
+}
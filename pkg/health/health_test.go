@@ -0,0 +1,103 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/notify"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct{ sent []notify.Message }
+
+func (r *recorder) Send(msg notify.Message) bool {
+	r.sent = append(r.sent, msg)
+	return true
+}
+
+func TestStateOf(t *testing.T) {
+	refused := errors.New("dial tcp: refused")
+	assert.Equal(t, Healthy, StateOf(nil))
+	assert.Equal(t, Down, StateOf(refused))
+	assert.Equal(t, Degraded, StateOf(Degrade(refused)))
+	assert.Equal(t, Degraded, StateOf(fmt.Errorf("redis: %w", Degrade(refused))))
+	assert.ErrorIs(t, Degrade(refused), refused)
+	assert.Nil(t, Degrade(nil))
+}
+
+func TestTrackerConfirmsTransitions(t *testing.T) {
+	rec := &recorder{}
+	tr := NewTracker(Options{Confirm: 2, Notifier: rec, Clock: clock.NewFake(time.Unix(0, 0))})
+	refused := errors.New("dial tcp: refused")
+
+	tr.Observe("tracker-redis", nil)
+	assert.Equal(t, 1.0, testutil.ToFloat64(stateGauge.WithLabelValues("tracker-redis", "healthy")))
+
+	// one failed probe is a blip
+	tr.Observe("tracker-redis", refused)
+	tr.Observe("tracker-redis", nil)
+	tr.Observe("tracker-redis", refused)
+	assert.Equal(t, Healthy, tr.States()["tracker-redis"])
+	assert.Empty(t, rec.sent)
+
+	tr.Observe("tracker-redis", refused)
+	assert.Equal(t, Down, tr.States()["tracker-redis"])
+	assert.Equal(t, 1.0, testutil.ToFloat64(stateGauge.WithLabelValues("tracker-redis", "down")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(stateGauge.WithLabelValues("tracker-redis", "healthy")))
+	assert.Equal(t, []notify.Message{{
+		Severity: notify.Critical,
+		Key:      "health_check_failed",
+		Args:     []interface{}{"tracker-redis", "dial tcp: refused"},
+	}}, rec.sent)
+
+	// degraded in between down and healthy takes its own confirmations
+	tr.Observe("tracker-redis", Degrade(refused))
+	tr.Observe("tracker-redis", nil)
+	assert.Equal(t, Down, tr.States()["tracker-redis"])
+}
+
+func TestTrackerHoldsBackFlapping(t *testing.T) {
+	rec := &recorder{}
+	fake := clock.NewFake(time.Unix(0, 0))
+	tr := NewTracker(Options{Confirm: 1, NotifyInterval: 5 * time.Minute, Notifier: rec, Clock: fake})
+	refused := errors.New("dial tcp: refused")
+
+	tr.Observe("flappy", refused)
+	assert.Len(t, rec.sent, 1)
+
+	for i := 0; i < 3; i++ {
+		fake.Advance(10 * time.Second)
+		tr.Observe("flappy", nil)
+		fake.Advance(10 * time.Second)
+		tr.Observe("flappy", Degrade(refused))
+	}
+	assert.Len(t, rec.sent, 1, "changes within the interval are held back")
+	assert.Equal(t, Degraded, tr.States()["flappy"])
+
+	fake.Advance(5 * time.Minute)
+	tr.Observe("flappy", Degrade(refused))
+	assert.Len(t, rec.sent, 2, "the settled state goes out after the interval")
+	assert.Equal(t, "health_check_degraded", rec.sent[1].Key)
+	assert.Equal(t, map[string]string{"changes_held_back": "6"}, rec.sent[1].Fields)
+
+	// back to the state last notified, nothing new to tell
+	fake.Advance(time.Minute)
+	tr.Observe("flappy", refused)
+	fake.Advance(5 * time.Minute)
+	tr.Observe("flappy", Degrade(refused))
+	assert.Len(t, rec.sent, 2)
+}
+
+func TestTrackerWithoutNotifier(t *testing.T) {
+	tr := NewTracker(FromConfig(&config.Config{Health: config.Health{Confirm: 1}}, nil, nil))
+	assert.Nil(t, tr.opts.Notifier)
+	tr.Observe("quiet", errors.New("down"))
+	assert.Equal(t, Down, tr.States()["quiet"])
+	assert.Equal(t, 1.0, testutil.ToFloat64(transitions.WithLabelValues("quiet", "down")))
+}
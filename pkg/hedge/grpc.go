@@ -0,0 +1,38 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package hedge
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// UnaryClientInterceptor hedges calls to the listed methods
+// ("/pkg.Service/Method"), list only idempotent reads. Other methods go
+// straight through.
+func UnaryClientInterceptor(h *Hedger, methods ...string) grpc.UnaryClientInterceptor {
+	hedged := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		hedged[m] = true
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		out, ok := reply.(proto.Message)
+		if !hedged[method] || !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		// every attempt decodes into its own message, the winner is copied
+		v, err := h.Do(ctx, func(ctx context.Context) (interface{}, error) {
+			attempt := out.ProtoReflect().New().Interface()
+			return attempt, invoker(ctx, method, req, attempt, cc, opts...)
+		})
+		if err != nil {
+			return err
+		}
+		proto.Reset(out)
+		proto.Merge(out, v.(proto.Message))
+		return nil
+	}
+}
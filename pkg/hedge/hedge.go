@@ -0,0 +1,233 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package hedge cuts tail latency of idempotent reads: when an attempt is
+// slower than the recent pXX latency a second one is sent and whichever
+// answers first wins. A budget keeps hedges to a share of all calls, so a
+// slow dependency never sees its load double.
+package hedge
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultPercentile = 0.95
+	defaultBudget     = 0.1
+	defaultMaxDelay   = 100 * time.Millisecond
+	defaultWindow     = 1000
+	// below this many samples the hedge waits MaxDelay
+	minSamples = 20
+	// at most this many unspent hedges pile up while calls are fast
+	maxTokens = 10
+	// the percentile is taken again after this many new latencies
+	refreshEvery = 10
+)
+
+var (
+	hedgesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_hedge_sent_total",
+		Help: "Hedged attempts sent after the primary ran past the hedge delay.",
+	}, []string{"name"})
+	hedgeWins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_hedge_wins_total",
+		Help: "Hedged calls by the attempt that answered first: primary or hedge.",
+	}, []string{"name", "winner"})
+	hedgesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_hedge_budget_exhausted_total",
+		Help: "Hedges not sent because the budget was spent.",
+	}, []string{"name"})
+)
+
+func init() {
+	prometheus.MustRegister(hedgesSent, hedgeWins, hedgesSkipped)
+}
+
+// Options zero values fall back to the defaults
+type Options struct {
+	// Name labels the metrics, e.g. "postgres" or "redis"
+	Name string
+	// Percentile of recent latencies after which the hedge is sent, 0.95
+	Percentile float64
+	// MinDelay and MaxDelay bound the hedge delay, MaxDelay (100ms) is also
+	// used until enough latencies were seen
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// Budget is the share of calls that may be hedged, 0.1
+	Budget float64
+	// Window is how many recent latencies the percentile is taken over
+	Window int
+	Clock  clock.Clock
+}
+
+// Hedger runs calls with at most one hedge each, it is safe for
+// concurrent use and meant to be shared per dependency
+type Hedger struct {
+	opts Options
+
+	mu      sync.Mutex
+	samples []time.Duration // ring of recent latencies
+	next    int
+	fresh   int // latencies since delay was taken
+	delay   time.Duration
+	tokens  float64
+}
+
+func New(opts Options) *Hedger {
+	if opts.Percentile <= 0 || opts.Percentile >= 1 {
+		opts.Percentile = defaultPercentile
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaultMaxDelay
+	}
+	if opts.MinDelay > opts.MaxDelay {
+		opts.MinDelay = opts.MaxDelay
+	}
+	if opts.Budget <= 0 {
+		opts.Budget = defaultBudget
+	}
+	if opts.Window <= 0 {
+		opts.Window = defaultWindow
+	}
+	opts.Clock = clock.Or(opts.Clock)
+
+	return &Hedger{
+		opts:    opts,
+		samples: make([]time.Duration, 0, opts.Window),
+		delay:   opts.MaxDelay,
+	}
+}
+
+type result struct {
+	value interface{}
+	err   error
+	hedge bool
+	took  time.Duration
+}
+
+// Do runs fn and, if it has not returned after Delay, runs it a second
+// time. The first success wins and the other attempt's ctx is cancelled.
+// fn must be idempotent and must honour ctx. An error is only returned once
+// every attempt sent has failed, a nil Hedger just calls fn.
+func (h *Hedger) Do(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if h == nil {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// buffered so the loser never blocks after we returned
+	results := make(chan result, 2)
+	run := func(hedge bool) {
+		start := h.opts.Clock.Now()
+		v, err := fn(ctx)
+		results <- result{value: v, err: err, hedge: hedge, took: h.opts.Clock.Since(start)}
+	}
+
+	h.earn()
+	go run(false)
+	pending, hedged := 1, false
+
+	timer := h.opts.Clock.NewTimer(h.Delay())
+	defer timer.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case <-timer.C():
+			if !h.spend() {
+				hedgesSkipped.WithLabelValues(h.opts.Name).Inc()
+				continue
+			}
+			hedgesSent.WithLabelValues(h.opts.Name).Inc()
+			hedged = true
+			pending++
+			go run(true)
+
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				h.observe(r.took)
+				if hedged {
+					winner := "primary"
+					if r.hedge {
+						winner = "hedge"
+					}
+					hedgeWins.WithLabelValues(h.opts.Name, winner).Inc()
+				}
+				return r.value, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			// hedging is not retrying, a fast failure is returned as is
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// Delay is the current hedge delay, the Percentile of recent latencies
+// within MinDelay and MaxDelay
+func (h *Hedger) Delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay
+}
+
+func (h *Hedger) observe(took time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) < h.opts.Window {
+		h.samples = append(h.samples, took)
+	} else {
+		h.samples[h.next] = took
+		h.next = (h.next + 1) % h.opts.Window
+	}
+
+	h.fresh++
+	if len(h.samples) < minSamples || h.fresh < refreshEvery {
+		return
+	}
+	h.fresh = 0
+
+	sorted := append([]time.Duration(nil), h.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	d := sorted[int(float64(len(sorted)-1)*h.opts.Percentile)]
+	if d < h.opts.MinDelay {
+		d = h.opts.MinDelay
+	}
+	if d > h.opts.MaxDelay {
+		d = h.opts.MaxDelay
+	}
+	h.delay = d
+}
+
+// earn adds the budget share of one call
+func (h *Hedger) earn() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokens += h.opts.Budget
+	if h.tokens > maxTokens {
+		h.tokens = maxTokens
+	}
+}
+
+func (h *Hedger) spend() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
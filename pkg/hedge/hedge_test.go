@@ -0,0 +1,145 @@
+package hedge
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+	pb "blueprint/proto/blueprint"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// waitCalls makes sure the primary is running before the hedge can start
+func waitCalls(t *testing.T, calls *int32, n int32) {
+	require.Eventually(t, func() bool { return atomic.LoadInt32(calls) == n }, time.Second, time.Millisecond)
+}
+
+// slowFirst blocks the first attempt until it is cancelled, later ones
+// answer with their attempt number
+func slowFirst(calls *int32) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		n := atomic.AddInt32(calls, 1)
+		if n == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return int(n), nil
+	}
+}
+
+func TestHedgeWins(t *testing.T) {
+	hedgeWins.Reset()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	h := New(Options{Name: "test", Budget: 1, MaxDelay: 50 * time.Millisecond, Clock: clk})
+
+	var calls int32
+	done := make(chan interface{})
+	go func() {
+		v, err := h.Do(context.Background(), slowFirst(&calls))
+		assert.NoError(t, err)
+		done <- v
+	}()
+
+	clk.BlockUntil(1)
+	waitCalls(t, &calls, 1)
+	clk.Advance(50 * time.Millisecond)
+	assert.Equal(t, 2, <-done, "the hedge answered")
+	assert.Equal(t, 1.0, testutil.ToFloat64(hedgeWins.WithLabelValues("test", "hedge")))
+}
+
+func TestNoHedgeWhenFast(t *testing.T) {
+	h := New(Options{Name: "fast", Budget: 1})
+
+	var calls int32
+	v, err := h.Do(context.Background(), func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return "ok", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", v)
+	assert.Equal(t, int32(1), calls)
+
+	fail := errors.New("not found")
+	_, err = h.Do(context.Background(), func(ctx context.Context) (interface{}, error) { return nil, fail })
+	assert.Equal(t, fail, err, "a fast failure is not retried")
+}
+
+func TestBudget(t *testing.T) {
+	hedgesSkipped.Reset()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	h := New(Options{Name: "budget", Budget: 0.5, MaxDelay: 10 * time.Millisecond, Clock: clk})
+
+	release := make(chan struct{})
+	var calls int32
+	done := make(chan struct{})
+	go func() {
+		h.Do(context.Background(), func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return nil, nil
+		})
+		close(done)
+	}()
+
+	clk.BlockUntil(1)
+	clk.Advance(10 * time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(hedgesSkipped.WithLabelValues("budget")) == 1
+	}, time.Second, time.Millisecond, "half a token is not enough")
+	close(release)
+	<-done
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestDelayFollowsLatency(t *testing.T) {
+	h := New(Options{Percentile: 0.9, MinDelay: 2 * time.Millisecond, MaxDelay: time.Second})
+	assert.Equal(t, time.Second, h.Delay(), "MaxDelay until enough samples")
+
+	for i := 1; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, 90*time.Millisecond, h.Delay())
+
+	for i := 0; i < 1000; i++ {
+		h.observe(time.Microsecond)
+	}
+	assert.Equal(t, 2*time.Millisecond, h.Delay(), "clamped to MinDelay")
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	h := New(Options{Name: "grpc", Budget: 1, MaxDelay: 20 * time.Millisecond, Clock: clk})
+	intercept := UnaryClientInterceptor(h, "/blueprint.Blueprint/Call")
+
+	var calls int32
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		reply.(*pb.CallResponse).Msg = "from hedge"
+		return nil
+	}
+
+	reply := &pb.CallResponse{}
+	done := make(chan error)
+	go func() {
+		done <- intercept(context.Background(), "/blueprint.Blueprint/Call", &pb.CallRequest{}, reply, nil, invoker)
+	}()
+	clk.BlockUntil(1)
+	waitCalls(t, &calls, 1)
+	clk.Advance(20 * time.Millisecond)
+	require.NoError(t, <-done)
+	assert.Equal(t, "from hedge", reply.Msg)
+
+	atomic.StoreInt32(&calls, 1) // every later call is fast
+	require.NoError(t, intercept(context.Background(), "/blueprint.Blueprint/Other", &pb.CallRequest{}, reply, nil, invoker))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "unlisted methods are not hedged")
+}
@@ -0,0 +1,244 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package httpmw is the HTTP side of the gRPC interceptor chain, wrapped
+// around the JSON gateway so REST calls get the same request ids, access
+// logs, metrics and crash reports:
+//
+//	h := httpmw.Chain(gateway,
+//		httpmw.RequestID(trustedProxies),
+//		httpmw.AccessLog(log),
+//		httpmw.Metrics(gateway.Route),
+//		httpmw.Gzip(),
+//		httpmw.Recovery(crashReporter),
+//	)
+//
+// The first middleware is the outermost one.
+package httpmw
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"blueprint/pkg/crash"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_http_requests_total",
+		Help: "HTTP requests served by the gateway, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	requestSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blueprint_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests served by the gateway, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	responseBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blueprint_http_response_size_bytes",
+		Help:    "Size of HTTP response bodies as sent, compressed or not, by route and method.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+	}, []string{"route", "method"})
+)
+
+func init() {
+	prometheus.MustRegister(requests, requestSeconds, responseBytes)
+}
+
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h so the first middleware sees the request first
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// RequestID fills the ctxmeta of the request like the gRPC interceptor:
+// the caller's X-Request-Id or a new one, echoed back in the response and
+// forwarded to the gRPC call through the request headers. X-User-Id and
+// X-Tenant-Id are only believed from the trusted proxies, an authenticating
+// proxy in front of the gateway; from anyone else they are dropped and
+// never reach the gRPC call.
+func RequestID(trusted []*net.IPNet) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !trustedPeer(r, trusted) {
+				r.Header.Del(ctxmeta.HeaderUserID)
+				r.Header.Del(ctxmeta.HeaderTenantID)
+			}
+
+			id := r.Header.Get(ctxmeta.HeaderRequestID)
+			if id == "" {
+				id = ctxmeta.NewID()
+				r.Header.Set(ctxmeta.HeaderRequestID, id)
+			}
+
+			traceID := r.Header.Get(ctxmeta.HeaderTraceID)
+			if traceID == "" {
+				traceID = ctxmeta.TraceIDFromTraceParent(r.Header.Get(ctxmeta.HeaderTraceParent))
+			}
+			if traceID == "" {
+				traceID = id
+			}
+
+			ctx := ctxmeta.WithRequestID(r.Context(), id)
+			ctx = ctxmeta.WithTraceID(ctx, traceID)
+			ctx = ctxmeta.WithMethod(ctx, r.Method+" "+r.URL.Path)
+			if v := r.Header.Get(ctxmeta.HeaderUserID); v != "" {
+				ctx = ctxmeta.WithUserID(ctx, v)
+			}
+			if v := r.Header.Get(ctxmeta.HeaderTenantID); v != "" {
+				ctx = ctxmeta.WithTenantID(ctx, v)
+			}
+			if v := ctxmeta.LocaleFromAcceptLanguage(r.Header.Get(ctxmeta.HeaderLocale)); v != "" {
+				ctx = ctxmeta.WithLocale(ctx, v)
+			}
+			if v := r.Header.Get(ctxmeta.HeaderClientVersion); v != "" {
+				ctx = ctxmeta.WithClientVersion(ctx, v)
+			}
+
+			w.Header().Set(ctxmeta.HeaderRequestID, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func trustedPeer(r *http.Request, trusted []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessLog logs every request once it is served, with the ctxmeta fields
+// RequestID put in the context
+func AccessLog(log *logger.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := newRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			log.WithContext(r.Context()).Infow("HTTP Request",
+				"http_method", r.Method,
+				"path", r.URL.Path,
+				"status_code", rec.status,
+				"bytes", rec.bytes,
+				"duration_ms", time.Since(start).Milliseconds(),
+				"user_agent", r.UserAgent(),
+			)
+		})
+	}
+}
+
+// Metrics counts requests by status and observes latency and response
+// size, with the request's trace as exemplar when RequestID runs first. route names the request for the labels, it must map unknown paths
+// to one value or every scanner probe becomes a new series.
+func Metrics(route func(r *http.Request) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := newRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			name := route(r)
+			ctx := r.Context()
+			ctxmeta.Inc(ctx, requests.WithLabelValues(name, r.Method, strconv.Itoa(rec.status)))
+			ctxmeta.Observe(ctx, requestSeconds.WithLabelValues(name, r.Method), time.Since(start).Seconds())
+			responseBytes.WithLabelValues(name, r.Method).Observe(float64(rec.bytes))
+		})
+	}
+}
+
+// Recovery turns a panic into a crash report and a 500 carrying the crash
+// id, the same answer the gRPC recovery interceptor gives
+func Recovery(reporter *crash.Reporter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := newRecorder(w)
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				// net/http's way to abort a response, not a crash
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				err := status.Error(codes.Internal, "internal server error")
+				if reporter != nil {
+					err = reporter.RecoveryHandler(r.Context(), p)
+				}
+				// too late for a status once the body started
+				if rec.wroteHeader {
+					return
+				}
+				body, _ := protojson.Marshal(status.Convert(err).Proto())
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write(body)
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// recorder remembers the status and body size written through it
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func newRecorder(w http.ResponseWriter) *recorder {
+	return &recorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,214 @@
+package httpmw
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"blueprint/pkg/crash"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/netacl"
+	"blueprint/pkg/testsupport"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), mw("outer"), mw("inner"))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, []string{"outer", "inner", "handler"}, order)
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := RequestID(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = ctxmeta.RequestID(r.Context())
+		assert.Equal(t, seen, r.Header.Get(ctxmeta.HeaderRequestID), "forwarded to the gRPC call")
+		method, _ := ctxmeta.Method(r.Context())
+		assert.Equal(t, "POST /v1/call", method)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/call", nil))
+	assert.NotEmpty(t, seen)
+	assert.Equal(t, seen, rec.Header().Get(ctxmeta.HeaderRequestID))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/call", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, "req-1", seen)
+	assert.Equal(t, "req-1", rec.Header().Get(ctxmeta.HeaderRequestID))
+}
+
+func TestRequestIDFillsRequestContext(t *testing.T) {
+	// httptest requests come from 192.0.2.1
+	trusted, err := netacl.ParseCIDRs([]string{"192.0.2.1"})
+	require.NoError(t, err)
+
+	var got ctxmeta.Metadata
+	h := RequestID(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ctxmeta.FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/call", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("X-User-Id", "42")
+	req.Header.Set("X-Tenant-Id", "acme")
+	req.Header.Set("Accept-Language", "de-CH,de;q=0.9")
+	req.Header.Set("X-Client-Version", "web/3.1.0")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, ctxmeta.Metadata{
+		TraceID:       "req-1",
+		RequestID:     "req-1",
+		UserID:        "42",
+		Method:        "POST /v1/call",
+		TenantID:      "acme",
+		Locale:        "de-CH",
+		ClientVersion: "web/3.1.0",
+	}, got)
+}
+
+func TestRequestIDDropsUntrustedIdentity(t *testing.T) {
+	var got ctxmeta.Metadata
+	var forwarded http.Header
+	h := RequestID(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ctxmeta.FromContext(r.Context())
+		forwarded = r.Header
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/call", nil)
+	req.Header.Set("X-User-Id", "42")
+	req.Header.Set("X-Tenant-Id", "acme")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Empty(t, got.UserID)
+	assert.Empty(t, got.TenantID)
+	assert.Empty(t, forwarded.Get("X-User-Id"), "not passed on to the gRPC call")
+	assert.Empty(t, forwarded.Get("X-Tenant-Id"))
+}
+
+func TestAccessLog(t *testing.T) {
+	log, logs := testsupport.Logger(t)
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}), RequestID(nil), AccessLog(log))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/call", nil)
+	req.Header.Set("X-Request-Id", "req-log")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.Entries(t)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "HTTP Request", entries[0]["message"])
+	assert.Equal(t, "req-log", entries[0]["request_id"])
+	assert.Equal(t, float64(201), entries[0]["status_code"])
+	assert.Equal(t, float64(5), entries[0]["bytes"])
+}
+
+func TestMetrics(t *testing.T) {
+	h := Metrics(func(r *http.Request) string { return "metrics-test" })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	before := testutil.ToFloat64(requests.WithLabelValues("metrics-test", http.MethodGet, "404"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+	assert.Equal(t, before+1, testutil.ToFloat64(requests.WithLabelValues("metrics-test", http.MethodGet, "404")))
+}
+
+func TestRecovery(t *testing.T) {
+	log, _ := testsupport.Logger(t)
+	reporter := crash.NewReporterWithOptions(log, crash.Options{Service: "test"})
+	h := Recovery(reporter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/call", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "crash id")
+	assert.NotContains(t, rec.Body.String(), "boom", "only verbose errors carry the panic")
+}
+
+func TestRecoveryAfterBodyStarted(t *testing.T) {
+	h := Recovery(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "partial", rec.Body.String())
+}
+
+func TestGzip(t *testing.T) {
+	body := strings.Repeat(`{"message":"hello"}`, 100)
+	h := Gzip()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "br, gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+	assert.Less(t, rec.Body.Len(), len(body))
+	zr, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	plain, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(plain))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, rec.Body.String())
+}
+
+func TestGzipSkipsEncodedAndEmpty(t *testing.T) {
+	h := Gzip()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte("already"))
+	}))
+
+	for _, path := range []string{"/empty", "/encoded"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.NotEqual(t, "gzip", rec.Header().Get("Content-Encoding"), path)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0")
+	assert.False(t, acceptsGzip(req))
+}
@@ -0,0 +1,91 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/kataras/i18n"
+	"gopkg.in/yaml.v3"
+)
+
+// LocaleReport is what Check found for one locale
+type LocaleReport struct {
+	Locale string   `json:"locale"`
+	Files  []string `json:"files"`
+	Keys   int      `json:"keys"`
+	// Missing are the keys of the base locale this one has no translation
+	// for, they fall back to the base
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Check loads the locale files matching pattern, as New does but failing
+// where New carries on without translations: no files, a file that does
+// not parse or a base locale that is not among them. A locale is the name
+// of the directory its files are in.
+func Check(pattern, base string) ([]LocaleReport, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no locale files match %s", pattern)
+	}
+	if _, err := i18n.New(i18n.Glob(pattern)); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]map[string]bool{}
+	byLocale := map[string][]string{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]interface{}
+		if err := yaml.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		locale := filepath.Base(filepath.Dir(file))
+		if keys[locale] == nil {
+			keys[locale] = map[string]bool{}
+		}
+		flatten("", messages, keys[locale])
+		byLocale[locale] = append(byLocale[locale], file)
+	}
+	if _, ok := keys[base]; !ok {
+		return nil, fmt.Errorf("base locale %s has no files under %s", base, pattern)
+	}
+
+	locales := make([]string, 0, len(keys))
+	for locale := range keys {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	out := make([]LocaleReport, 0, len(locales))
+	for _, locale := range locales {
+		r := LocaleReport{Locale: locale, Files: byLocale[locale], Keys: len(keys[locale])}
+		for key := range keys[base] {
+			if !keys[locale][key] {
+				r.Missing = append(r.Missing, key)
+			}
+		}
+		sort.Strings(r.Missing)
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// flatten collects the keys of nested sections as "section.key"
+func flatten(prefix string, messages map[string]interface{}, into map[string]bool) {
+	for k, v := range messages {
+		if nested, ok := v.(map[string]interface{}); ok {
+			flatten(prefix+k+".", nested, into)
+			continue
+		}
+		into[prefix+k] = true
+	}
+}
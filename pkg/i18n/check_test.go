@@ -0,0 +1,50 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeLocale(t *testing.T, dir, locale, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, locale), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, locale, "messages.yml"), []byte(content), 0o644))
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	writeLocale(t, dir, "en-US", "hi: \"Hi %s\"\nbye: \"Bye\"\norder:\n  placed: \"Order placed\"\n")
+	writeLocale(t, dir, "el-GR", "hi: \"Γεια %s\"\n")
+
+	reports, err := Check(filepath.Join(dir, "*", "*"), "en-US")
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "el-GR", reports[0].Locale)
+	assert.Equal(t, []string{"bye", "order.placed"}, reports[0].Missing)
+	assert.Equal(t, 3, reports[1].Keys)
+	assert.Empty(t, reports[1].Missing)
+}
+
+func TestCheckFails(t *testing.T) {
+	_, err := Check(filepath.Join(t.TempDir(), "*", "*"), "en-US")
+	assert.ErrorContains(t, err, "no locale files")
+
+	dir := t.TempDir()
+	writeLocale(t, dir, "el-GR", "hi: \"Γεια %s\"\n")
+	_, err = Check(filepath.Join(dir, "*", "*"), "en-US")
+	assert.ErrorContains(t, err, "base locale en-US")
+
+	writeLocale(t, dir, "en-US", "hi: [unclosed\n")
+	_, err = Check(filepath.Join(dir, "*", "*"), "en-US")
+	assert.Error(t, err)
+}
+
+func TestCheckShippedLocales(t *testing.T) {
+	reports, err := Check("locales/*/*", "en-US")
+	require.NoError(t, err)
+	assert.NotEmpty(t, reports)
+}
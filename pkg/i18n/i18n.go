@@ -6,6 +6,12 @@ import (
  
 )
 
+// Translator renders message keys, *Lang is one. Packages take it instead
+// of *Lang so they run without locales, nil answering in English.
+type Translator interface {
+	Tr(lang, key string, args ...interface{}) string
+}
+
 type Lang struct {
 	I18n *i18n.I18n
 }
@@ -24,8 +30,13 @@ func New(cfg *config.Config, languages ... string) (*Lang, error) {
 	//return i18n.New(glob,languages...)
 }
 
-func (t *Lang) Tr(lang string,format string) string {
-	return i18n.Tr(lang,format)
+// Tr translates the key for lang from the locales of t, args fill the
+// message like fmt
+func (t *Lang) Tr(lang string, format string, args ...interface{}) string {
+	if t.I18n != nil {
+		return t.I18n.Tr(lang, format, args...)
+	}
+	return i18n.Tr(lang, format, args...)
 }
 
 
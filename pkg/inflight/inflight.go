@@ -0,0 +1,58 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package inflight caps the calls one caller has running at once. Rate
+// limits count calls as they start, a client holding a few slow streams
+// open stays under any rate while it keeps handlers, connections and
+// memory busy; a concurrency cap holds a slot for as long as the call
+// runs.
+package inflight
+
+import (
+	"context"
+	"sync"
+)
+
+// Semaphore hands out slots per caller key. Acquire returns ok false when
+// key already holds limit slots; release gives an acquired slot back and
+// is safe to call more than once.
+type Semaphore interface {
+	Acquire(ctx context.Context, key string, limit int) (release func(), ok bool, err error)
+}
+
+// Memory counts the slots of this replica, each replica grants limit
+type Memory struct {
+	mu    sync.Mutex
+	inUse map[string]int
+}
+
+func NewMemory() *Memory {
+	return &Memory{inUse: make(map[string]int)}
+}
+
+func (m *Memory) Acquire(ctx context.Context, key string, limit int) (func(), bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.inUse[key] >= limit {
+		return nil, false, nil
+	}
+	m.inUse[key]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			// callers with nothing in flight cost nothing
+			if m.inUse[key]--; m.inUse[key] <= 0 {
+				delete(m.inUse, key)
+			}
+		})
+	}, true, nil
+}
+
+// InUse is how many slots key holds
+func (m *Memory) InUse(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.inUse[key]
+}
@@ -0,0 +1,41 @@
+package inflight
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	release1, ok, err := m.Acquire(ctx, "user:alice", 2)
+	require.NoError(t, err)
+	require.True(t, ok)
+	release2, ok, _ := m.Acquire(ctx, "user:alice", 2)
+	require.True(t, ok)
+	_, ok, _ = m.Acquire(ctx, "user:alice", 2)
+	assert.False(t, ok, "both slots taken")
+
+	_, ok, _ = m.Acquire(ctx, "user:bob", 2)
+	assert.True(t, ok, "slots are per key")
+
+	release1()
+	release1()
+	assert.Equal(t, 1, m.InUse("user:alice"), "released once")
+	_, ok, _ = m.Acquire(ctx, "user:alice", 2)
+	assert.True(t, ok)
+
+	release2()
+	assert.Equal(t, 1, m.InUse("user:alice"))
+}
+
+func TestMemoryDropsIdleKeys(t *testing.T) {
+	m := NewMemory()
+	release, _, _ := m.Acquire(context.Background(), "ip:10.0.0.1", 1)
+	release()
+	assert.NotContains(t, m.inUse, "ip:10.0.0.1")
+}
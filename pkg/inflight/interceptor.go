@@ -0,0 +1,121 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package inflight
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/pkg/errors"
+	"blueprint/pkg/grpcmethod"
+	"blueprint/pkg/ratelimit"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// ReasonConcurrencyLimited is the ErrorInfo reason of a call turned down
+// for the calls its caller already has running
+const ReasonConcurrencyLimited = "CONCURRENCY_LIMITED"
+
+// clients back off at least this long, a slot frees up when any of their
+// calls ends
+const limitedRetryAfter = time.Second
+
+var inflightResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_inflight_total",
+	Help: "Calls checked against the per caller concurrency cap by result: allowed, limited or error.",
+}, []string{"grpc_method", "result"})
+
+func init() {
+	prometheus.MustRegister(inflightResults)
+}
+
+type Options struct {
+	// Limit is the calls one caller may have running, unary and streams
+	// alike
+	Limit int
+	// Key is who a slot belongs to, ratelimit.KeyUser, KeyIP or KeyAPIKey;
+	// callers without it are capped by IP. See ratelimit.CallerKey, a
+	// client can't name itself a user or address to get fresh slots.
+	Key string
+	// KeyHeader carries the API key
+	KeyHeader string
+	// Exempt methods are not capped, full methods, services or bare
+	// method names
+	Exempt []string
+}
+
+// Interceptor turns down calls of a caller already running Limit of them
+// with ResourceExhausted. The slot is held until the handler returns, for
+// streams until they end. When the Semaphore fails the call runs uncapped
+// and is counted as an error, a broken redis must not take the service
+// down with it.
+type Interceptor struct {
+	mu   sync.RWMutex
+	sem  Semaphore
+	opts Options
+}
+
+func NewInterceptor(sem Semaphore, opts Options) *Interceptor {
+	opts.KeyHeader = strings.ToLower(opts.KeyHeader)
+	return &Interceptor{sem: sem, opts: opts}
+}
+
+// SetSemaphore swaps the Semaphore, e.g. for Redis once it is up. Calls
+// running keep their slot in the old one.
+func (i *Interceptor) SetSemaphore(sem Semaphore) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.sem = sem
+}
+
+func (i *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		release, err := i.acquire(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+func (i *Interceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		release, err := i.acquire(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return handler(srv, ss)
+	}
+}
+
+// acquire takes a slot for the call, release is never nil without an error
+func (i *Interceptor) acquire(ctx context.Context, fullMethod string) (func(), error) {
+	if i.opts.Limit <= 0 || grpcmethod.MatchAny(i.opts.Exempt, fullMethod) {
+		return func() {}, nil
+	}
+
+	i.mu.RLock()
+	sem := i.sem
+	i.mu.RUnlock()
+
+	release, ok, err := sem.Acquire(ctx, ratelimit.CallerKey(ctx, i.opts.Key, i.opts.KeyHeader), i.opts.Limit)
+	switch {
+	case err != nil:
+		inflightResults.WithLabelValues(fullMethod, "error").Inc()
+		return func() {}, nil
+	case !ok:
+		inflightResults.WithLabelValues(fullMethod, "limited").Inc()
+		return nil, errors.New(codes.ResourceExhausted, ReasonConcurrencyLimited, "too many calls in flight").
+			WithRetryAfter(limitedRetryAfter).
+			WithMetadata("limit", strconv.Itoa(i.opts.Limit))
+	}
+	inflightResults.WithLabelValues(fullMethod, "allowed").Inc()
+	return release, nil
+}
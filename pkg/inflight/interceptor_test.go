@@ -0,0 +1,109 @@
+package inflight
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"blueprint/pkg/ctxmeta"
+	apperrors "blueprint/pkg/errors"
+	"blueprint/pkg/netacl"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type failingSemaphore struct{}
+
+func (failingSemaphore) Acquire(ctx context.Context, key string, limit int) (func(), bool, error) {
+	return nil, false, errors.New("redis down")
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s fakeStream) Context() context.Context { return s.ctx }
+
+func TestInterceptor(t *testing.T) {
+	sem := NewMemory()
+	i := NewInterceptor(sem, Options{Limit: 1, Key: "user", Exempt: []string{"grpc.health.v1.Health"}})
+	unary := i.UnaryServerInterceptor()
+	stream := i.StreamServerInterceptor()
+
+	alice := ctxmeta.WithUserID(ctxmeta.WithClientIP(context.Background(), "10.0.0.1"), "alice")
+	call := func(ctx context.Context, method string) error {
+		_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil })
+		return err
+	}
+
+	// a stream holds alice's only slot until it ends
+	var inStream error
+	err := stream(nil, fakeStream{ctx: alice}, &grpc.StreamServerInfo{FullMethod: "/blueprint.Blueprint/Watch"},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			assert.Equal(t, 1, sem.InUse("user:alice"))
+			inStream = call(alice, "/blueprint.Blueprint/Call")
+			assert.NoError(t, call(alice, "/grpc.health.v1.Health/Check"), "exempt")
+			assert.NoError(t, call(ctxmeta.WithUserID(alice, "bob"), "/blueprint.Blueprint/Call"), "another caller")
+			return nil
+		})
+	require.NoError(t, err)
+
+	require.Equal(t, codes.ResourceExhausted, status.Code(inStream))
+	e, ok := apperrors.FromError(inStream)
+	require.True(t, ok)
+	assert.Equal(t, ReasonConcurrencyLimited, e.Reason)
+	assert.Equal(t, "1", e.Metadata["limit"])
+	assert.Positive(t, e.RetryAfter)
+
+	assert.NoError(t, call(alice, "/blueprint.Blueprint/Call"), "freed when the stream ended")
+	assert.Zero(t, sem.InUse("user:alice"), "and when the call returned")
+
+	i.SetSemaphore(failingSemaphore{})
+	assert.NoError(t, call(alice, "/blueprint.Blueprint/Call"), "runs uncapped without a semaphore")
+
+	off := NewInterceptor(failingSemaphore{}, Options{Limit: 0}).UnaryServerInterceptor()
+	_, err = off(alice, nil, &grpc.UnaryServerInfo{FullMethod: "/blueprint.Blueprint/Call"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil })
+	assert.NoError(t, err, "limit 0 is off")
+}
+
+func TestInterceptorKeyNotForged(t *testing.T) {
+	acl, err := netacl.NewACLWithOptions(nil, netacl.Options{TrustedProxies: []string{"127.0.0.1"}})
+	require.NoError(t, err)
+	sem := NewMemory()
+	capped := NewInterceptor(sem, Options{Limit: 1, Key: "user"}).UnaryServerInterceptor()
+
+	from := func(addr string, kv ...string) context.Context {
+		return peer.NewContext(metadata.NewIncomingContext(context.Background(), metadata.Pairs(kv...)),
+			&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 4000}})
+	}
+	call := func(ctx context.Context, inside func()) error {
+		info := &grpc.UnaryServerInfo{FullMethod: "/blueprint.Blueprint/Call"}
+		_, err := ctxmeta.UnaryServerInterceptor(acl)(ctx, nil, info,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return capped(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					inside()
+					return "ok", nil
+				})
+			})
+		return err
+	}
+
+	err = call(from("203.0.113.5"), func() {
+		forged := from("203.0.113.5", ctxmeta.HeaderUserID, "someone-else", ctxmeta.HeaderForwarded, "10.0.0.9")
+		assert.Equal(t, codes.ResourceExhausted, status.Code(call(forged, func() {})),
+			"forged user and address share the peer's slot")
+		assert.NoError(t, call(from("127.0.0.1", ctxmeta.HeaderUserID, "alice"), func() {}), "the gateway's user has its own")
+	})
+	assert.NoError(t, err)
+	assert.Zero(t, sem.InUse("ip:203.0.113.5"))
+}
@@ -0,0 +1,133 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package inflight
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultPrefix   = "inflight"
+	defaultLeaseTTL = 30 * time.Second
+	releaseTimeout  = time.Second
+)
+
+// acquire adds a lease to the caller's sorted set, scored by its expiry,
+// unless the live ones are at the limit. Expired leases, left by a replica
+// that died mid call, are dropped first. The time is redis', replicas'
+// clocks may disagree.
+var acquire = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[1]) then
+	return 0
+end
+local expiry = now + tonumber(ARGV[2])
+redis.call('ZADD', KEYS[1], expiry, ARGV[3])
+redis.call('PEXPIREAT', KEYS[1], expiry)
+return 1
+`)
+
+// refresh moves a held lease's expiry on, XX so a released one stays gone
+var refresh = redis.NewScript(`
+local t = redis.call('TIME')
+local expiry = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000) + tonumber(ARGV[1])
+if redis.call('ZADD', KEYS[1], 'XX', 'CH', expiry, ARGV[2]) == 1 then
+	redis.call('PEXPIREAT', KEYS[1], expiry)
+end
+return 1
+`)
+
+// Redis shares the slots between every replica. Each slot is a lease that
+// expires after LeaseTTL and is renewed while the call runs, so a replica
+// that dies only holds its slots until then.
+type Redis struct {
+	client   *redis.Client
+	prefix   string
+	leaseTTL time.Duration
+}
+
+// NewRedis uses a 30s lease when leaseTTL is 0
+func NewRedis(client *redis.Client, leaseTTL time.Duration) *Redis {
+	if leaseTTL <= 0 {
+		leaseTTL = defaultLeaseTTL
+	}
+	return &Redis{client: client, prefix: defaultPrefix, leaseTTL: leaseTTL}
+}
+
+func (r *Redis) Acquire(ctx context.Context, key string, limit int) (func(), bool, error) {
+	setKey := r.key(key)
+	lease, err := leaseID()
+	if err != nil {
+		return nil, false, err
+	}
+
+	ok, err := acquire.Run(ctx, r.client, []string{setKey}, limit, r.leaseTTL.Milliseconds(), lease).Int()
+	if err != nil {
+		return nil, false, fmt.Errorf("inflight acquire: %w", err)
+	}
+	if ok == 0 {
+		return nil, false, nil
+	}
+
+	var (
+		mu       sync.Mutex
+		renew    *time.Timer
+		released bool
+	)
+	var schedule func()
+	schedule = func() {
+		renew = time.AfterFunc(r.leaseTTL/3, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+			defer cancel()
+			// a failed renewal is tried again, the lease has two more
+			// thirds of its ttl
+			refresh.Run(ctx, r.client, []string{setKey}, r.leaseTTL.Milliseconds(), lease)
+			mu.Lock()
+			defer mu.Unlock()
+			if !released {
+				schedule()
+			}
+		})
+	}
+	schedule()
+
+	return func() {
+		mu.Lock()
+		if released {
+			mu.Unlock()
+			return
+		}
+		released = true
+		renew.Stop()
+		mu.Unlock()
+
+		// the caller's context may be over, the slot is freed regardless;
+		// a failed delete leaves it to expire
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+		defer cancel()
+		r.client.ZRem(ctx, setKey, lease)
+	}, true, nil
+}
+
+// key hashes the caller, API keys are secrets and never stored
+func (r *Redis) key(caller string) string {
+	sum := sha256.Sum256([]byte(caller))
+	return r.prefix + ":" + hex.EncodeToString(sum[:8])
+}
+
+func leaseID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("inflight lease id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
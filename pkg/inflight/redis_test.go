@@ -0,0 +1,61 @@
+package inflight
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blueprint/pkg/testsupport"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	client := testsupport.Redis(t)
+	// two replicas share the cap
+	a, b := NewRedis(client, time.Minute), NewRedis(client, time.Minute)
+	a.prefix, b.prefix = "inflight-test", "inflight-test"
+
+	release1, ok, err := a.Acquire(ctx, "user:alice", 2)
+	require.NoError(t, err)
+	require.True(t, ok)
+	release2, ok, err := b.Acquire(ctx, "user:alice", 2)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = a.Acquire(ctx, "user:alice", 2)
+	require.NoError(t, err)
+	assert.False(t, ok, "both slots taken across replicas")
+
+	release1()
+	release1()
+	_, ok, _ = b.Acquire(ctx, "user:alice", 2)
+	assert.True(t, ok, "freed for every replica")
+	release2()
+
+	assert.NotContains(t, a.key("apikey:secret"), "secret", "callers are hashed")
+}
+
+func TestRedisLeases(t *testing.T) {
+	ctx := context.Background()
+	client := testsupport.Redis(t)
+	r := NewRedis(client, 300*time.Millisecond)
+	r.prefix = "inflight-lease-test"
+
+	// a replica that died mid call
+	require.NoError(t, client.ZAdd(ctx, r.key("user:alice"), redis.Z{Score: float64(time.Now().Add(-time.Second).UnixMilli()), Member: "dead"}).Err())
+	release, ok, err := r.Acquire(ctx, "user:alice", 1)
+	require.NoError(t, err)
+	assert.True(t, ok, "expired leases are dropped")
+
+	time.Sleep(time.Second)
+	n, err := client.ZCard(ctx, r.key("user:alice")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "renewed while held")
+
+	release()
+	n, _ = client.ZCard(ctx, r.key("user:alice")).Result()
+	assert.Zero(t, n)
+}
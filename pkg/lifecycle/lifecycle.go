@@ -0,0 +1,309 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/buildinfo"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/health"
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	defaultShutdownTimeout = 10 * time.Second
+	// time kept back from the grace period for closing clients after the gRPC drain
+	shutdownMargin = 2 * time.Second
+	checkTimeout   = 2 * time.Second
+)
+
+// Metadata is the pod identity exposed through the downward API
+type Metadata struct {
+	PodName   string
+	Namespace string
+	NodeName  string
+	PodIP     string
+}
+
+// CheckFunc reports whether a dependency is usable
+type CheckFunc func(ctx context.Context) error
+
+// Lifecycle serves the kubelet probes and tracks startup, readiness and draining
+type Lifecycle struct {
+	log              *logger.Logger
+	meta             Metadata
+	probePort        string
+	preStopDelay     time.Duration
+	terminationGrace time.Duration
+	clock            clock.Clock
+
+	started  atomic.Bool
+	ready    atomic.Bool
+	draining chan struct{}
+	drain    sync.Once
+
+	mu       sync.RWMutex
+	checks   map[string]CheckFunc
+	observer func(name string, err error)
+	server   *http.Server
+}
+
+func MetadataFromConfig(cfg *config.Config) Metadata {
+	return Metadata{
+		PodName:   cfg.Kube.PodName,
+		Namespace: cfg.Kube.Namespace,
+		NodeName:  cfg.Kube.NodeName,
+		PodIP:     cfg.Kube.PodIP,
+	}
+}
+
+// InKubernetes is true when the downward API env vars are wired in the pod spec
+func (m Metadata) InKubernetes() bool {
+	return m.PodName != "" && m.Namespace != ""
+}
+
+// Fields returns the metadata as logger fields
+func (m Metadata) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"pod":       m.PodName,
+		"namespace": m.Namespace,
+		"node":      m.NodeName,
+		"pod_ip":    m.PodIP,
+	}
+}
+
+// Labels returns the metadata as prometheus labels
+func (m Metadata) Labels() prometheus.Labels {
+	return prometheus.Labels{
+		"pod":       m.PodName,
+		"namespace": m.Namespace,
+		"node":      m.NodeName,
+	}
+}
+
+func NewLifecycle(cfg *config.Config, log *logger.Logger) *Lifecycle {
+	return &Lifecycle{
+		log:              log,
+		meta:             MetadataFromConfig(cfg),
+		probePort:        cfg.Kube.ProbePort,
+		preStopDelay:     cfg.Kube.PreStopDelay,
+		terminationGrace: cfg.Kube.TerminationGrace,
+		clock:            clock.Real,
+		draining:         make(chan struct{}),
+		checks:           make(map[string]CheckFunc),
+	}
+}
+
+func (l *Lifecycle) Metadata() Metadata {
+	return l.meta
+}
+
+// RegisterPodInfo publishes a constant blueprint_pod_info gauge carrying the
+// pod labels so every series can be joined to the pod that produced it
+func (l *Lifecycle) RegisterPodInfo(reg prometheus.Registerer, service, version string) error {
+	labels := l.meta.Labels()
+	labels["service"] = service
+	labels["version"] = version
+
+	info := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "blueprint_pod_info",
+		Help:        "Pod metadata of the running service instance.",
+		ConstLabels: labels,
+	})
+	info.Set(1)
+
+	return reg.Register(info)
+}
+
+func (l *Lifecycle) AddReadinessCheck(name string, check CheckFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.checks[name] = check
+}
+
+// SetCheckObserver gets the result of every readiness check the probe runs,
+// e.g. notify.Notifier.ObserveCheck. It must not block, probes time out.
+func (l *Lifecycle) SetCheckObserver(fn func(name string, err error)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.observer = fn
+}
+
+// MarkStarted flips the startup probe, call it once all dependencies are up
+func (l *Lifecycle) MarkStarted() {
+	l.started.Store(true)
+}
+
+func (l *Lifecycle) SetReady(ready bool) {
+	l.ready.Store(ready)
+}
+
+// Drain marks the pod as not ready, it is safe to call more than once
+func (l *Lifecycle) Drain() {
+	l.drain.Do(func() {
+		l.ready.Store(false)
+		close(l.draining)
+	})
+}
+
+// Draining is closed once preStop ran or shutdown began
+func (l *Lifecycle) Draining() <-chan struct{} {
+	return l.draining
+}
+
+// ShutdownTimeout is how long the gRPC drain may take without the kubelet
+// sending SIGKILL, the preStop delay was already spent out of the same budget
+func (l *Lifecycle) ShutdownTimeout() time.Duration {
+	if l.terminationGrace <= 0 {
+		return defaultShutdownTimeout
+	}
+
+	timeout := l.terminationGrace - l.preStopDelay - shutdownMargin
+	if timeout < time.Second {
+		timeout = time.Second
+	}
+	return timeout
+}
+
+func (l *Lifecycle) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", l.handleHealth)
+	mux.HandleFunc("/startupz", l.handleStartup)
+	mux.HandleFunc("/livez", l.handleLive)
+	mux.HandleFunc("/readyz", l.handleReady)
+	mux.HandleFunc("/prestop", l.handlePreStop)
+	// OpenMetrics when the scraper asks for it, the text format drops exemplars
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	return mux
+}
+
+// Start serves the probe endpoints in the background
+func (l *Lifecycle) Start() error {
+	lis, err := net.Listen("tcp", ":"+l.probePort)
+	if err != nil {
+		return fmt.Errorf("failed to listen on probe port %s: %w", l.probePort, err)
+	}
+
+	srv := &http.Server{
+		Handler:           l.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	l.mu.Lock()
+	l.server = srv
+	l.mu.Unlock()
+
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.log.Errorf("Probe server stopped: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+func (l *Lifecycle) Shutdown(ctx context.Context) error {
+	l.mu.RLock()
+	srv := l.server
+	l.mu.RUnlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+// handleHealth is liveness plus the build, for humans and deploy checks
+// comparing what runs to what was shipped
+func (l *Lifecycle) handleHealth(w http.ResponseWriter, r *http.Request) {
+	info := buildinfo.Get()
+	writeStatus(w, http.StatusOK, map[string]interface{}{
+		"status":     "ok",
+		"started":    l.started.Load(),
+		"ready":      l.ready.Load(),
+		"version":    info.Version,
+		"commit":     info.Commit,
+		"build_time": info.BuildTime,
+		"go_version": info.GoVersion,
+		"modified":   info.Modified,
+	})
+}
+
+func (l *Lifecycle) handleStartup(w http.ResponseWriter, r *http.Request) {
+	if !l.started.Load() {
+		writeStatus(w, http.StatusServiceUnavailable, map[string]string{"status": "starting"})
+		return
+	}
+	writeStatus(w, http.StatusOK, map[string]string{"status": "started"})
+}
+
+func (l *Lifecycle) handleLive(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+func (l *Lifecycle) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !l.ready.Load() {
+		writeStatus(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	result := map[string]string{"status": "ready"}
+	code := http.StatusOK
+	for name, check := range l.checks {
+		err := check(ctx)
+		if l.observer != nil {
+			l.observer(name, err)
+		}
+		switch {
+		case health.IsDegraded(err):
+			// the pod serves without it, keep it in rotation
+			result[name] = "degraded: " + err.Error()
+		case err != nil:
+			result[name] = err.Error()
+			result["status"] = "not ready"
+			code = http.StatusServiceUnavailable
+		default:
+			result[name] = "ok"
+		}
+	}
+
+	writeStatus(w, code, result)
+}
+
+// handlePreStop is wired as the container preStop httpGet hook. The kubelet
+// waits for it before sending SIGTERM, which gives endpoints time to drop us
+func (l *Lifecycle) handlePreStop(w http.ResponseWriter, r *http.Request) {
+	l.Drain()
+
+	select {
+	case <-l.clock.After(l.preStopDelay):
+	case <-r.Context().Done():
+	}
+
+	writeStatus(w, http.StatusOK, map[string]string{"status": "draining"})
+}
+
+func writeStatus(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
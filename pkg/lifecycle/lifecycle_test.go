@@ -0,0 +1,144 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/health"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLifecycle(kube config.Kube) *Lifecycle {
+	return NewLifecycle(&config.Config{Kube: kube}, nil)
+}
+
+// get serves path and decodes the JSON body
+func get(t *testing.T, h http.Handler, path string) (int, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), path)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	return rec.Code, body
+}
+
+func TestLiveness(t *testing.T) {
+	l := newTestLifecycle(config.Kube{})
+	h := l.Handler()
+
+	code, body := get(t, h, "/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "alive", body["status"])
+
+	code, body = get(t, h, "/startupz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "starting", body["status"])
+
+	l.MarkStarted()
+	code, _ = get(t, h, "/startupz")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, body = get(t, h, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, body["started"])
+	assert.Equal(t, false, body["ready"])
+	assert.Contains(t, body, "version")
+}
+
+func TestReadiness(t *testing.T) {
+	l := newTestLifecycle(config.Kube{})
+	h := l.Handler()
+
+	code, body := get(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "not ready until SetReady")
+	assert.Equal(t, "not ready", body["status"])
+
+	var redisErr error
+	observed := map[string]error{}
+	l.AddReadinessCheck("postgres", func(ctx context.Context) error { return nil })
+	l.AddReadinessCheck("redis", func(ctx context.Context) error { return redisErr })
+	l.SetCheckObserver(func(name string, err error) { observed[name] = err })
+	l.SetReady(true)
+
+	code, body = get(t, h, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"status": "ready", "postgres": "ok", "redis": "ok"}, body)
+
+	redisErr = health.Degrade(errors.New("refused"))
+	code, body = get(t, h, "/readyz")
+	assert.Equal(t, http.StatusOK, code, "a degraded dependency keeps the pod in rotation")
+	assert.Equal(t, "degraded: refused", body["redis"])
+
+	redisErr = errors.New("refused")
+	code, body = get(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not ready", body["status"])
+	assert.Equal(t, "refused", body["redis"])
+	assert.Equal(t, "ok", body["postgres"])
+	assert.Equal(t, map[string]error{"postgres": nil, "redis": redisErr}, observed)
+}
+
+func TestPreStopDrainsBeforeTheDelay(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	l := newTestLifecycle(config.Kube{PreStopDelay: 5 * time.Second})
+	l.clock = fake
+	l.SetReady(true)
+	h := l.Handler()
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/prestop", nil))
+		done <- rec
+	}()
+
+	// the pod leaves rotation first, then waits out the delay
+	fake.BlockUntil(1)
+	select {
+	case <-l.Draining():
+	default:
+		t.Fatal("preStop should drain before waiting")
+	}
+	code, _ := get(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	select {
+	case <-done:
+		t.Fatal("preStop returned before the delay")
+	default:
+	}
+
+	fake.Advance(5 * time.Second)
+	rec := <-done
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"draining"}`, rec.Body.String())
+
+	l.Drain()
+	l.SetReady(true)
+	l.Drain()
+	assert.True(t, l.ready.Load(), "draining happens once")
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	for name, tc := range map[string]struct {
+		kube config.Kube
+		want time.Duration
+	}{
+		"no grace period":   {config.Kube{}, defaultShutdownTimeout},
+		"after the preStop": {config.Kube{TerminationGrace: 30 * time.Second, PreStopDelay: 5 * time.Second}, 23 * time.Second},
+		"no preStop":        {config.Kube{TerminationGrace: 30 * time.Second}, 28 * time.Second},
+		"at least a second": {config.Kube{TerminationGrace: 5 * time.Second, PreStopDelay: 5 * time.Second}, time.Second},
+	} {
+		assert.Equal(t, tc.want, newTestLifecycle(tc.kube).ShutdownTimeout(), name)
+	}
+}
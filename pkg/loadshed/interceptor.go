@@ -0,0 +1,96 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package loadshed
+
+import (
+	"context"
+	stderrors "errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"blueprint/pkg/errors"
+	"blueprint/pkg/grpcmethod"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// clients back off at least this long before trying a shed call again
+const shedRetryAfter = time.Second
+
+// InterceptorOptions classify calls. Methods are full methods, services or
+// bare method names, the first list naming a method wins.
+type InterceptorOptions struct {
+	// Exempt methods always run and are not measured, keep health checks
+	// here
+	Exempt []string
+	// Critical methods may use the whole limit, Background ones only its
+	// BackgroundShare. Everything else is Normal.
+	Critical   []string
+	Background []string
+	// Header lets callers lower the priority of their call, e.g. a batch
+	// job sending "background". It never raises it, clients cannot claim
+	// the headroom kept for critical calls. Empty ignores the header.
+	Header string
+}
+
+// Interceptor runs unary calls under a Limiter and turns the ones over
+// their priority's share of the limit down with Unavailable, which clients
+// retry with backoff. Streams are not limited, they hold a slot for as
+// long as they are open.
+type Interceptor struct {
+	limiter *Limiter
+	opts    InterceptorOptions
+}
+
+func NewInterceptor(limiter *Limiter, opts InterceptorOptions) *Interceptor {
+	opts.Header = strings.ToLower(opts.Header)
+	return &Interceptor{limiter: limiter, opts: opts}
+}
+
+func (i *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if grpcmethod.MatchAny(i.opts.Exempt, info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		p := i.Priority(ctx, info.FullMethod)
+		done, ok := i.limiter.Acquire(p)
+		if !ok {
+			return nil, errors.Unavailable("server overloaded", shedRetryAfter).
+				WithMetadata("limit", strconv.Itoa(i.limiter.Limit())).
+				WithMetadata("priority", p.String())
+		}
+		resp, err := handler(ctx, req)
+		done(overloaded(err))
+		return resp, err
+	}
+}
+
+// Priority is what the call to fullMethod runs at, from the method lists
+// and lowered by the caller's header
+func (i *Interceptor) Priority(ctx context.Context, fullMethod string) Priority {
+	p := Normal
+	switch {
+	case grpcmethod.MatchAny(i.opts.Critical, fullMethod):
+		p = Critical
+	case grpcmethod.MatchAny(i.opts.Background, fullMethod):
+		p = Background
+	}
+	if i.opts.Header == "" {
+		return p
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(i.opts.Header); len(values) > 0 {
+		if asked, err := ParsePriority(strings.ToLower(strings.TrimSpace(values[0]))); err == nil && asked < p {
+			p = asked
+		}
+	}
+	return p
+}
+
+// overloaded tells calls that failed from a struggling dependency, timing
+// out or finding it unavailable. Client cancellations are not.
+func overloaded(err error) bool {
+	return stderrors.Is(err, context.DeadlineExceeded) || errors.IsTransient(err)
+}
@@ -0,0 +1,265 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package loadshed limits how many calls run at once and finds the limit
+// on its own from their latency, so an overloaded database or redis does
+// not pull the service into a spiral of ever slower calls piling up. The
+// limit follows the gradient algorithm: while latency stays near its long
+// term average the limit grows by its square root, once calls get slower
+// it shrinks by the ratio of the two. Calls over the limit are turned down
+// with Unavailable at once instead of queueing. Lower priorities only get
+// a share of the limit, so background work is shed first and critical
+// calls keep the headroom:
+//
+//	limiter := loadshed.NewLimiter(loadshed.Options{Name: "grpc", Initial: 20, Min: 5, Max: 1000})
+//	shed := loadshed.NewInterceptor(limiter, loadshed.InterceptorOptions{
+//		Exempt:   []string{"grpc.health.v1.Health"},
+//		Critical: []string{"/blueprint.Trading/PlaceOrder"},
+//		Header:   "x-priority",
+//	})
+package loadshed
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultInitial   = 20
+	defaultMin       = 5
+	defaultMax       = 1000
+	defaultSmoothing = 0.2
+	defaultWindow    = 600
+
+	defaultNormalShare     = 0.9
+	defaultBackgroundShare = 0.5
+
+	// the short average spans about this many calls, enough to ride out a
+	// single slow one
+	shortWindow = 10
+	// a dropped call, e.g. a timeout, cuts the limit by this factor
+	dropBackoff = 0.9
+)
+
+var (
+	limitGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_concurrency_limit",
+		Help: "Calls the adaptive limiter lets run at once.",
+	}, []string{"limiter"})
+	inflightGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_concurrency_inflight",
+		Help: "Calls running under the adaptive limiter.",
+	}, []string{"limiter"})
+	shedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_concurrency_shed_total",
+		Help: "Calls turned down by the adaptive limiter by priority.",
+	}, []string{"limiter", "priority"})
+)
+
+func init() {
+	prometheus.MustRegister(limitGauge, inflightGauge, shedTotal)
+}
+
+// Priority decides which calls are shed first, the zero value is Normal
+type Priority int
+
+const (
+	// Background calls only get BackgroundShare of the limit, they are
+	// the first to go
+	Background Priority = iota - 1
+	Normal
+	// Critical calls may use all of the limit
+	Critical
+)
+
+func (p Priority) String() string {
+	switch p {
+	case Critical:
+		return "critical"
+	case Background:
+		return "background"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority reads critical, normal or background
+func ParsePriority(s string) (Priority, error) {
+	switch s {
+	case "critical":
+		return Critical, nil
+	case "normal":
+		return Normal, nil
+	case "background":
+		return Background, nil
+	}
+	return Normal, fmt.Errorf("unknown priority %q, want critical, normal or background", s)
+}
+
+type Options struct {
+	// Name labels the metrics, e.g. grpc
+	Name string
+	// Initial is the limit before the first calls finished, 20 by default.
+	// Min and Max bound it, 5 and 1000 by default.
+	Initial int
+	Min     int
+	Max     int
+	// Smoothing is how far the limit moves towards each new estimate, 0.2
+	// by default
+	Smoothing float64
+	// Window is about how many calls the long term latency spans, 600 by
+	// default
+	Window int
+	// NormalShare and BackgroundShare are the parts of the limit Normal
+	// and Background calls may fill, 0.9 and 0.5 by default. The rest is
+	// kept for the priorities above them.
+	NormalShare     float64
+	BackgroundShare float64
+	Clock           clock.Clock
+}
+
+// Limiter is an adaptive concurrency limit, safe for concurrent use
+type Limiter struct {
+	opts Options
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	longRTT  float64
+	shortRTT float64
+}
+
+func NewLimiter(opts Options) *Limiter {
+	if opts.Min < 1 {
+		opts.Min = defaultMin
+	}
+	if opts.Max <= 0 {
+		opts.Max = defaultMax
+	}
+	if opts.Max < opts.Min {
+		opts.Max = opts.Min
+	}
+	if opts.Initial <= 0 {
+		opts.Initial = defaultInitial
+	}
+	if opts.Smoothing <= 0 || opts.Smoothing > 1 {
+		opts.Smoothing = defaultSmoothing
+	}
+	if opts.Window <= 0 {
+		opts.Window = defaultWindow
+	}
+	if opts.NormalShare <= 0 || opts.NormalShare > 1 {
+		opts.NormalShare = defaultNormalShare
+	}
+	if opts.BackgroundShare <= 0 || opts.BackgroundShare > opts.NormalShare {
+		opts.BackgroundShare = math.Min(defaultBackgroundShare, opts.NormalShare)
+	}
+	opts.Clock = clock.Or(opts.Clock)
+
+	l := &Limiter{opts: opts}
+	l.limit = l.clamp(float64(opts.Initial))
+	limitGauge.WithLabelValues(opts.Name).Set(l.limit)
+	return l
+}
+
+// Acquire takes a slot if one is free within p's share of the limit. done
+// gives it back once the call finished, dropped tells a call that failed
+// from overload, e.g. a timeout, its latency says nothing then.
+func (l *Limiter) Acquire(p Priority) (done func(dropped bool), ok bool) {
+	l.mu.Lock()
+	if l.inflight >= l.capacity(p) {
+		l.mu.Unlock()
+		shedTotal.WithLabelValues(l.opts.Name, p.String()).Inc()
+		return nil, false
+	}
+	l.inflight++
+	inflightGauge.WithLabelValues(l.opts.Name).Set(float64(l.inflight))
+	l.mu.Unlock()
+
+	start := l.opts.Clock.Now()
+	var once sync.Once
+	return func(dropped bool) {
+		once.Do(func() { l.release(l.opts.Clock.Since(start), dropped) })
+	}, true
+}
+
+// capacity is how many calls may run once p's call is admitted, at least
+// one so a small limit never locks a priority out entirely
+func (l *Limiter) capacity(p Priority) int {
+	share := 1.0
+	switch p {
+	case Normal:
+		share = l.opts.NormalShare
+	case Background:
+		share = l.opts.BackgroundShare
+	}
+	return int(math.Max(1, math.Floor(l.limit*share)))
+}
+
+// Limit is the current limit
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// Inflight is how many calls hold a slot
+func (l *Limiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+func (l *Limiter) release(rtt time.Duration, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inflight := l.inflight
+	l.inflight--
+	inflightGauge.WithLabelValues(l.opts.Name).Set(float64(l.inflight))
+
+	if dropped {
+		l.setLimit(l.limit * dropBackoff)
+		return
+	}
+
+	sample := float64(rtt)
+	if sample <= 0 {
+		sample = 1
+	}
+	if l.longRTT == 0 {
+		l.longRTT, l.shortRTT = sample, sample
+	} else {
+		l.longRTT += (sample - l.longRTT) * 2 / float64(l.opts.Window+1)
+		l.shortRTT += (sample - l.shortRTT) * 2 / float64(shortWindow+1)
+	}
+
+	// recovering from a slow spell the long average lags behind and would
+	// hold the limit down, let it catch up faster
+	if l.longRTT/l.shortRTT > 2 {
+		l.longRTT *= 0.95
+	}
+
+	// a mostly idle limiter learns nothing about how far the limit can go
+	if float64(inflight)*2 < l.limit {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1, l.longRTT/l.shortRTT))
+	estimate := l.limit*gradient + math.Sqrt(l.limit)
+	l.setLimit(l.limit*(1-l.opts.Smoothing) + estimate*l.opts.Smoothing)
+}
+
+func (l *Limiter) setLimit(limit float64) {
+	l.limit = l.clamp(limit)
+	limitGauge.WithLabelValues(l.opts.Name).Set(l.limit)
+}
+
+func (l *Limiter) clamp(limit float64) float64 {
+	return math.Max(float64(l.opts.Min), math.Min(float64(l.opts.Max), limit))
+}
@@ -0,0 +1,186 @@
+package loadshed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+	apperrors "blueprint/pkg/errors"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// round runs as many calls as the limit allows at once, each taking rtt
+func round(t *testing.T, l *Limiter, fake *clock.Fake, rtt time.Duration) {
+	t.Helper()
+	var dones []func(bool)
+	for {
+		done, ok := l.Acquire(Critical)
+		if !ok {
+			break
+		}
+		dones = append(dones, done)
+	}
+	require.NotEmpty(t, dones)
+	fake.Advance(rtt)
+	for _, done := range dones {
+		done(false)
+	}
+}
+
+func TestLimiterSheds(t *testing.T) {
+	l := NewLimiter(Options{Name: "sheds", Initial: 2, Min: 1, Max: 10})
+	shed := testutil.ToFloat64(shedTotal.WithLabelValues("sheds", "critical"))
+
+	first, ok := l.Acquire(Critical)
+	require.True(t, ok)
+	_, ok = l.Acquire(Critical)
+	require.True(t, ok)
+	_, ok = l.Acquire(Critical)
+	assert.False(t, ok)
+	assert.Equal(t, shed+1, testutil.ToFloat64(shedTotal.WithLabelValues("sheds", "critical")))
+	assert.Equal(t, 2, l.Inflight())
+
+	first(false)
+	first(false)
+	assert.Equal(t, 1, l.Inflight(), "done gives the slot back once")
+	_, ok = l.Acquire(Critical)
+	assert.True(t, ok)
+}
+
+func TestLimiterPriorities(t *testing.T) {
+	l := NewLimiter(Options{Name: "priorities", Initial: 10, Min: 10, Max: 10})
+	admitted := func(p Priority) int {
+		n := 0
+		for {
+			if _, ok := l.Acquire(p); !ok {
+				return n
+			}
+			n++
+		}
+	}
+	// background fills half, normal what is left of 90%, critical the rest
+	assert.Equal(t, 5, admitted(Background))
+	assert.Equal(t, 4, admitted(Normal))
+	assert.Equal(t, 0, admitted(Background))
+	assert.Equal(t, 1, admitted(Critical))
+	assert.Equal(t, 10, l.Inflight())
+
+	for _, s := range []string{"critical", "normal", "background"} {
+		p, err := ParsePriority(s)
+		require.NoError(t, err)
+		assert.Equal(t, s, p.String())
+	}
+	_, err := ParsePriority("urgent")
+	assert.Error(t, err)
+	assert.True(t, Background < Normal && Normal < Critical)
+}
+
+func TestLimiterAdapts(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	l := NewLimiter(Options{Name: "adapts", Initial: 10, Min: 2, Max: 100, Clock: fake})
+
+	// steady latency at full use, the limit probes upwards
+	for i := 0; i < 20; i++ {
+		round(t, l, fake, 10*time.Millisecond)
+	}
+	grown := l.Limit()
+	assert.Greater(t, grown, 10)
+	assert.Equal(t, float64(grown), testutil.ToFloat64(limitGauge.WithLabelValues("adapts")))
+
+	// the database slows down, calls pile up and the limit backs off
+	for i := 0; i < 20; i++ {
+		round(t, l, fake, 100*time.Millisecond)
+	}
+	assert.Less(t, l.Limit(), grown)
+	assert.GreaterOrEqual(t, l.Limit(), 2)
+
+	// timeouts cut it further, their latency does not count
+	before := l.Limit()
+	done, ok := l.Acquire(Normal)
+	require.True(t, ok)
+	done(true)
+	assert.Less(t, l.Limit(), before)
+}
+
+func TestLimiterIdle(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	l := NewLimiter(Options{Name: "idle", Initial: 10, Clock: fake})
+	for i := 0; i < 50; i++ {
+		done, ok := l.Acquire(Normal)
+		require.True(t, ok)
+		fake.Advance(time.Millisecond)
+		done(false)
+	}
+	assert.Equal(t, 10, l.Limit(), "one call at a time says nothing about ten")
+}
+
+func TestInterceptor(t *testing.T) {
+	l := NewLimiter(Options{Name: "interceptor", Initial: 1, Min: 1})
+	interceptor := NewInterceptor(l, InterceptorOptions{Exempt: []string{"grpc.health.v1.Health"}}).UnaryServerInterceptor()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/blueprint.Blueprint/Call"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			close(started)
+			<-release
+			return "ok", nil
+		})
+	<-started
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/blueprint.Blueprint/Call"}, handler)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	typed, ok := apperrors.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, time.Second, typed.RetryAfter)
+	assert.Equal(t, "1", typed.Metadata["limit"])
+	assert.Equal(t, "normal", typed.Metadata["priority"])
+
+	resp, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler)
+	require.NoError(t, err, "exempt")
+	assert.Equal(t, "ok", resp)
+
+	close(release)
+	require.Eventually(t, func() bool { return l.Inflight() == 0 }, time.Second, time.Millisecond)
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/blueprint.Blueprint/Call"}, handler)
+	assert.NoError(t, err)
+}
+
+func TestInterceptorPriority(t *testing.T) {
+	i := NewInterceptor(NewLimiter(Options{}), InterceptorOptions{
+		Critical:   []string{"/blueprint.Trading/PlaceOrder", "CancelOrder"},
+		Background: []string{"blueprint.Reports"},
+		Header:     "X-Priority",
+	})
+	ctx := context.Background()
+	asking := func(p string) context.Context {
+		return metadata.NewIncomingContext(ctx, metadata.Pairs("x-priority", p))
+	}
+
+	assert.Equal(t, Critical, i.Priority(ctx, "/blueprint.Trading/PlaceOrder"))
+	assert.Equal(t, Critical, i.Priority(ctx, "/blueprint.Trading/CancelOrder"))
+	assert.Equal(t, Background, i.Priority(ctx, "/blueprint.Reports/Export"))
+	assert.Equal(t, Normal, i.Priority(ctx, "/blueprint.Blueprint/Call"))
+
+	assert.Equal(t, Background, i.Priority(asking("background"), "/blueprint.Trading/PlaceOrder"), "callers may lower")
+	assert.Equal(t, Normal, i.Priority(asking("critical"), "/blueprint.Blueprint/Call"), "but never raise")
+	assert.Equal(t, Background, i.Priority(asking("critical"), "/blueprint.Reports/Export"))
+	assert.Equal(t, Normal, i.Priority(asking("whenever"), "/blueprint.Blueprint/Call"))
+}
+
+func TestOverloaded(t *testing.T) {
+	assert.True(t, overloaded(context.DeadlineExceeded))
+	assert.True(t, overloaded(status.Error(codes.Unavailable, "redis down")))
+	assert.False(t, overloaded(context.Canceled))
+	assert.False(t, overloaded(status.Error(codes.InvalidArgument, "bad")))
+	assert.False(t, overloaded(nil))
+}
@@ -0,0 +1,150 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultAsyncBufferSize    = 8192
+	defaultAsyncFlushInterval = time.Second
+)
+
+var droppedEntries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_log_dropped_entries_total",
+	Help: "Log entries dropped because the async log buffer was full.",
+}, []string{"output"})
+
+func init() {
+	prometheus.MustRegister(droppedEntries)
+}
+
+// asyncWriter puts encoded entries in a bounded ring buffer and writes them
+// from a background goroutine. When the ring is full the entry is dropped
+// and counted, the caller never waits on disk or stdout
+type asyncWriter struct {
+	out     zapcore.WriteSyncer
+	dropped prometheus.Counter
+
+	mu    sync.Mutex
+	ring  [][]byte
+	head  int
+	count int
+
+	// held while a batch is written so Sync and the flusher keep entry order
+	writeMu sync.Mutex
+
+	drops    atomic.Uint64
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newAsyncWriter(out zapcore.WriteSyncer, name string, size int, flushInterval time.Duration) *asyncWriter {
+	if size <= 0 {
+		size = defaultAsyncBufferSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultAsyncFlushInterval
+	}
+
+	w := &asyncWriter{
+		out:     out,
+		dropped: droppedEntries.WithLabelValues(name),
+		ring:    make([][]byte, size),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go w.run(flushInterval)
+
+	return w
+}
+
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	// zap reuses the encoder buffer after Write returns
+	entry := make([]byte, len(p))
+	copy(entry, p)
+
+	w.mu.Lock()
+	if w.count == len(w.ring) {
+		w.mu.Unlock()
+		w.drops.Add(1)
+		w.dropped.Inc()
+		return len(p), nil
+	}
+	w.ring[(w.head+w.count)%len(w.ring)] = entry
+	w.count++
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+
+	return len(p), nil
+}
+
+// Sync drains the ring on the calling goroutine, then syncs the output
+func (w *asyncWriter) Sync() error {
+	w.drain()
+	return w.out.Sync()
+}
+
+func (w *asyncWriter) Close() error {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+	return w.out.Sync()
+}
+
+func (w *asyncWriter) Dropped() uint64 {
+	return w.drops.Load()
+}
+
+func (w *asyncWriter) run(flushInterval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.wake:
+			w.drain()
+		case <-ticker.C:
+			w.drain()
+			_ = w.out.Sync()
+		case <-w.stop:
+			w.drain()
+			return
+		}
+	}
+}
+
+func (w *asyncWriter) drain() {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	w.mu.Lock()
+	batch := make([][]byte, 0, w.count)
+	for w.count > 0 {
+		batch = append(batch, w.ring[w.head])
+		w.ring[w.head] = nil
+		w.head = (w.head + 1) % len(w.ring)
+		w.count--
+	}
+	w.mu.Unlock()
+
+	for _, entry := range batch {
+		_, _ = w.out.Write(entry)
+	}
+}
@@ -0,0 +1,74 @@
+package logger
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingSyncer holds every write until release is closed
+type blockingSyncer struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	release chan struct{}
+}
+
+func (b *blockingSyncer) Write(p []byte) (int, error) {
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *blockingSyncer) Sync() error { return nil }
+
+func (b *blockingSyncer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAsyncWriterKeepsOrder(t *testing.T) {
+	out := &blockingSyncer{release: make(chan struct{})}
+	close(out.release)
+
+	w := newAsyncWriter(out, "test", 16, time.Hour)
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		_, err := w.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, w.Sync())
+	assert.Equal(t, "a\nb\nc\n", out.String())
+	require.NoError(t, w.Close())
+}
+
+func TestAsyncWriterDropsWhenFull(t *testing.T) {
+	out := &blockingSyncer{release: make(chan struct{})}
+	w := newAsyncWriter(out, "test", 2, time.Hour)
+
+	// the flusher may already hold one entry blocked in out.Write, so write
+	// enough that at least one has to be dropped without blocking us
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			_, _ = w.Write([]byte("x\n"))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Write blocked on a full buffer")
+	}
+
+	assert.Greater(t, w.Dropped(), uint64(0))
+
+	close(out.release)
+	require.NoError(t, w.Close())
+}
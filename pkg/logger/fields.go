@@ -0,0 +1,78 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package logger
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Field is a strongly typed log field, it skips the reflection and the
+// interface boxing the sugared key/value API pays on every call
+type Field = zap.Field
+
+func String(key, value string) Field {
+	return zap.String(key, value)
+}
+
+func Int(key string, value int) Field {
+	return zap.Int(key, value)
+}
+
+func Int64(key string, value int64) Field {
+	return zap.Int64(key, value)
+}
+
+func Uint64(key string, value uint64) Field {
+	return zap.Uint64(key, value)
+}
+
+func Float64(key string, value float64) Field {
+	return zap.Float64(key, value)
+}
+
+func Bool(key string, value bool) Field {
+	return zap.Bool(key, value)
+}
+
+func Duration(key string, value time.Duration) Field {
+	return zap.Duration(key, value)
+}
+
+func Time(key string, value time.Time) Field {
+	return zap.Time(key, value)
+}
+
+// Err logs err under the "error" key, nil errors are skipped
+func Err(err error) Field {
+	return zap.Error(err)
+}
+
+// Any falls back to reflection, keep it off hot paths
+func Any(key string, value interface{}) Field {
+	return zap.Any(key, value)
+}
+
+// Zap returns the desugared logger for hot paths, use it with the typed
+// fields above: log.Zap().Info("msg", logger.String("key", v))
+func (l *Logger) Zap() *zap.Logger {
+	// the base logger skips one frame for the Log* helpers of this package,
+	// direct callers need that frame back to get their own file:line
+	return l.Desugar().WithOptions(zap.AddCallerSkip(-1))
+}
+
+// WithTypedFields is WithFields without the map and reflection
+func (l *Logger) WithTypedFields(fields ...Field) *Logger {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	merged := l.copyFields(len(enc.Fields))
+	for k, v := range enc.Fields {
+		merged[k] = v
+	}
+
+	return l.derive(l.Desugar().With(fields...).Sugar(), merged)
+}
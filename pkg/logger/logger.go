@@ -3,9 +3,11 @@ package logger
 
 import (
 	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
 	"context"
+	"fmt"
 	"os"
-	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -17,8 +19,11 @@ type Logger struct {
 	*zap.SugaredLogger
 	atomicLevel zap.AtomicLevel
 	config      *config.Config
-	mu          sync.RWMutex
+	// fields is never written after the logger is built, children get a copy
 	fields      map[string]any
+	async       []*asyncWriter
+	rotator     *rotator
+	modules     *moduleRegistry
 }
 
 type LoggerOptions struct {
@@ -31,6 +36,23 @@ type LoggerOptions struct {
 	DisableCaller  bool
 	DisableStacktrace bool
 	Sampling       bool
+	// Async moves file/console writes off the caller goroutine, entries are dropped when the buffer is full
+	Async              bool
+	AsyncBufferSize    int
+	AsyncFlushInterval time.Duration
+	// RotateInterval adds hourly or daily rotation on top of the MaxSize limit
+	RotateInterval string
+	// MaxTotalSize caps the disk usage in MB of the active file plus all backups
+	MaxTotalSize int
+	// Compressor replaces the default gzip of rotated files, e.g.
+	// CompressorFor a zstd codec
+	Compressor Compressor
+	// OnArchive is called with the final path of every archived file, e.g. to ship it off-host
+	OnArchive func(path string)
+	// ModuleLevels overrides the level of named child loggers, see Module
+	ModuleLevels map[string]string
+	// Clock schedules rotation and archive scans, clock.Real by default
+	Clock clock.Clock
 }
 
 var (
@@ -44,11 +66,24 @@ var (
 		DisableCaller:  false,
 		DisableStacktrace: true,
 		Sampling:       true,
+		AsyncBufferSize:    defaultAsyncBufferSize,
+		AsyncFlushInterval: defaultAsyncFlushInterval,
 	}
 )
 
 func NewLogger(cfg *config.Config) (*Logger, error) {
 	opts := buildLoggerOptions(cfg)
+
+	levels, err := ParseModuleLevels(cfg.Logger.ModuleLevels)
+	if err != nil {
+		return nil, err
+	}
+	opts.ModuleLevels = levels
+
+	if err := applyCompression(&opts, cfg); err != nil {
+		return nil, err
+	}
+
 	return NewLoggerWithOptions(cfg, opts)
 }
 
@@ -59,6 +94,11 @@ func NewLoggerWithOptions(cfg *config.Config, opts LoggerOptions) (*Logger, erro
 		atomicLevel.SetLevel(zapcore.InfoLevel)
 	}
 
+	modules, err := newModuleRegistry(atomicLevel, opts.ModuleLevels)
+	if err != nil {
+		return nil, err
+	}
+
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:        "timestamp",
 		LevelKey:       "level",
@@ -74,6 +114,10 @@ func NewLoggerWithOptions(cfg *config.Config, opts LoggerOptions) (*Logger, erro
 		EncodeCaller:   zapcore.ShortCallerEncoder,
 	}
 
+	if opts.RotateInterval != "" && opts.RotateInterval != RotateHourly && opts.RotateInterval != RotateDaily {
+		return nil, fmt.Errorf("unknown log rotate interval %q", opts.RotateInterval)
+	}
+
 	fileWriter := &lumberjack.Logger{
 		Filename:   opts.OutputPath,
 		MaxSize:    opts.MaxSize,
@@ -82,12 +126,32 @@ func NewLoggerWithOptions(cfg *config.Config, opts LoggerOptions) (*Logger, erro
 		Compress:   opts.Compress,
 	}
 
+	var rot *rotator
+	if rotatorEnabled(opts) {
+		// the rotator compresses itself so OnArchive sees the final file
+		fileWriter.Compress = false
+		rot = newRotator(fileWriter, opts)
+	}
+
 	consoleEncoder := zapcore.NewConsoleEncoder(encoderConfig)
 	fileEncoder := zapcore.NewJSONEncoder(encoderConfig)
 
-	core := zapcore.NewTee(
-		zapcore.NewCore(fileEncoder, zapcore.AddSync(fileWriter), atomicLevel),
-		zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), atomicLevel),
+	fileSync := zapcore.AddSync(fileWriter)
+	consoleSync := zapcore.AddSync(os.Stdout)
+
+	var async []*asyncWriter
+	if opts.Async {
+		fileAsync := newAsyncWriter(fileSync, "file", opts.AsyncBufferSize, opts.AsyncFlushInterval)
+		consoleAsync := newAsyncWriter(consoleSync, "console", opts.AsyncBufferSize, opts.AsyncFlushInterval)
+		async = []*asyncWriter{fileAsync, consoleAsync}
+		fileSync, consoleSync = fileAsync, consoleAsync
+	}
+
+	// outputs take everything, the level is applied by levelCore so module
+	// loggers can be more verbose than the root
+	var core zapcore.Core = zapcore.NewTee(
+		zapcore.NewCore(fileEncoder, fileSync, zapcore.DebugLevel),
+		zapcore.NewCore(consoleEncoder, consoleSync, zapcore.DebugLevel),
 	)
 
 	if opts.Sampling {
@@ -99,6 +163,8 @@ func NewLoggerWithOptions(cfg *config.Config, opts LoggerOptions) (*Logger, erro
 		)
 	}
 
+	core = &levelCore{Core: core, level: atomicLevel}
+
 	zapLogger := zap.New(
 		core,
 		zap.AddCaller(),
@@ -119,6 +185,9 @@ func NewLoggerWithOptions(cfg *config.Config, opts LoggerOptions) (*Logger, erro
 		atomicLevel:   atomicLevel,
 		config:        cfg,
 		fields:        make(map[string]interface{}),
+		async:         async,
+		rotator:       rot,
+		modules:       modules,
 	}, nil
 }
 
@@ -128,6 +197,22 @@ func buildLoggerOptions(cfg *config.Config) LoggerOptions {
 	if cfg.Logger.LogFile != "" {
 		opts.OutputPath = cfg.Logger.LogFile
 	}
+
+	if cfg.Logger.Async {
+		opts.Async = true
+	}
+
+	if cfg.Logger.RotateInterval != "" {
+		opts.RotateInterval = cfg.Logger.RotateInterval
+	}
+
+	if cfg.Logger.MaxTotalSize > 0 {
+		opts.MaxTotalSize = cfg.Logger.MaxTotalSize
+	}
+
+	if cfg.Logger.AsyncBufferSize > 0 {
+		opts.AsyncBufferSize = cfg.Logger.AsyncBufferSize
+	}
 	
 	return opts
 }
@@ -141,70 +226,71 @@ func (l *Logger) GetLevel() string {
 }
 
 func (l *Logger) WithContext(ctx context.Context) *Logger {
-	newLogger := &Logger{
-		SugaredLogger: l.SugaredLogger,
-		atomicLevel:   l.atomicLevel,
-		config:        l.config,
-		fields:        make(map[string]interface{}),
-	}
-	
-	if traceID := ctx.Value("trace_id"); traceID != nil {
-		newLogger = newLogger.WithField("trace_id", traceID)
+	if fields := ctxmeta.FromContext(ctx).Fields(); len(fields) > 0 {
+		return l.WithFields(fields)
 	}
-	
-	if userID := ctx.Value("user_id"); userID != nil {
-		newLogger = newLogger.WithField("user_id", userID)
-	}
-	
-	return newLogger
+	return l.Clone()
 }
 
+// WithField returns a child logger, l itself is left untouched so it is safe
+// to derive from the same logger on many goroutines
 func (l *Logger) WithField(key string, value interface{}) *Logger {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	
-	l.fields[key] = value
-	
-	return &Logger{
-		SugaredLogger: l.SugaredLogger.With(key, value),
-		atomicLevel:   l.atomicLevel,
-		config:        l.config,
-		fields:        l.fields,
-	}
+	fields := l.copyFields(1)
+	fields[key] = value
+
+	return l.derive(l.SugaredLogger.With(key, value), fields)
 }
 
 func (l *Logger) WithFields(fields map[string]interface{}) *Logger {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	
-	var args []interface{}
+	merged := l.copyFields(len(fields))
+
+	args := make([]interface{}, 0, len(fields)*2)
 	for k, v := range fields {
-		l.fields[k] = v
+		merged[k] = v
 		args = append(args, k, v)
 	}
-	
+
+	return l.derive(l.SugaredLogger.With(args...), merged)
+}
+
+// Clone returns an independent copy with the same fields and outputs
+func (l *Logger) Clone() *Logger {
+	return l.derive(l.SugaredLogger, l.copyFields(0))
+}
+
+// Named returns a child logger with name appended to the logger name, the
+// level is shared with l, use Module for an independent level
+func (l *Logger) Named(name string) *Logger {
+	return l.derive(l.SugaredLogger.Named(name), l.copyFields(0))
+}
+
+// derive wraps a new sugared logger, outputs, levels and modules stay shared
+func (l *Logger) derive(sugar *zap.SugaredLogger, fields map[string]interface{}) *Logger {
 	return &Logger{
-		SugaredLogger: l.SugaredLogger.With(args...),
+		SugaredLogger: sugar,
 		atomicLevel:   l.atomicLevel,
 		config:        l.config,
-		fields:        l.fields,
+		fields:        fields,
+		async:         l.async,
+		rotator:       l.rotator,
+		modules:       l.modules,
 	}
 }
 
+func (l *Logger) copyFields(extra int) map[string]interface{} {
+	fields := make(map[string]interface{}, len(l.fields)+extra)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	return fields
+}
+
 func (l *Logger) WithError(err error) *Logger {
 	return l.WithField("error", err.Error())
 }
 
 func (l *Logger) GetFields() map[string]interface{} {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	
-	fields := make(map[string]interface{})
-	for k, v := range l.fields {
-		fields[k] = v
-	}
-	
-	return fields
+	return l.copyFields(0)
 }
 
 func (l *Logger) Flush() error {
@@ -212,45 +298,65 @@ func (l *Logger) Flush() error {
 }
 
 func (l *Logger) Close() error {
-	return l.Sync()
+	err := l.Sync()
+	for _, w := range l.async {
+		if cerr := w.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if l.rotator != nil {
+		l.rotator.Close()
+	}
+	return err
+}
+
+// DroppedEntries is how many entries the async buffers had to drop
+func (l *Logger) DroppedEntries() uint64 {
+	var total uint64
+	for _, w := range l.async {
+		total += w.Dropped()
+	}
+	return total
 }
 
 func (l *Logger) LogRequest(method, path string, statusCode int, duration time.Duration) {
-	l.WithFields(map[string]interface{}{
-		"method":      method,
-		"path":        path,
-		"status_code": statusCode,
-		"duration_ms": duration.Milliseconds(),
-	}).Info("HTTP Request")
+	l.Desugar().Info("HTTP Request",
+		zap.String("method", method),
+		zap.String("path", path),
+		zap.Int("status_code", statusCode),
+		zap.Int64("duration_ms", duration.Milliseconds()),
+	)
 }
 
 func (l *Logger) LogGRPCRequest(method string, statusCode int, duration time.Duration) {
-	l.WithFields(map[string]interface{}{
-		"method":      method,
-		"status_code": statusCode,
-		"duration_ms": duration.Milliseconds(),
-	}).Info("gRPC Request")
+	l.Desugar().Info("gRPC Request",
+		zap.String("method", method),
+		zap.Int("status_code", statusCode),
+		zap.Int64("duration_ms", duration.Milliseconds()),
+	)
 }
 
 func (l *Logger) LogDatabaseQuery(query string, duration time.Duration, err error) {
-	fields := map[string]interface{}{
-		"query":       query,
-		"duration_ms": duration.Milliseconds(),
-	}
-	
 	if err != nil {
-		fields["error"] = err.Error()
-		l.WithFields(fields).Error("Database query failed")
-	} else {
-		l.WithFields(fields).Debug("Database query executed")
+		l.Desugar().Error("Database query failed",
+			zap.String("query", query),
+			zap.Int64("duration_ms", duration.Milliseconds()),
+			zap.String("error", err.Error()),
+		)
+		return
 	}
+
+	l.Desugar().Debug("Database query executed",
+		zap.String("query", query),
+		zap.Int64("duration_ms", duration.Milliseconds()),
+	)
 }
 
 func (l *Logger) LogCacheOperation(operation, key string, hit bool, duration time.Duration) {
-	l.WithFields(map[string]interface{}{
-		"operation":   operation,
-		"key":         key,
-		"cache_hit":   hit,
-		"duration_ms": duration.Milliseconds(),
-	}).Debug("Cache operation")
-}
\ No newline at end of file
+	l.Desugar().Debug("Cache operation",
+		zap.String("operation", operation),
+		zap.String("key", key),
+		zap.Bool("cache_hit", hit),
+		zap.Int64("duration_ms", duration.Milliseconds()),
+	)
+}
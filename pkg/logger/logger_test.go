@@ -0,0 +1,74 @@
+package logger
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"blueprint/pkg/ctxmeta"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFieldDoesNotMutateParent(t *testing.T) {
+	root := newTestLogger(t, LoggerOptions{Level: "info"})
+
+	parent := root.WithField("service", "blueprint")
+	a := parent.WithField("request", "a")
+	b := parent.WithFields(map[string]interface{}{"request": "b", "user": 1})
+
+	assert.Equal(t, map[string]interface{}{"service": "blueprint"}, parent.GetFields())
+	assert.Equal(t, "a", a.GetFields()["request"])
+	assert.Equal(t, "b", b.GetFields()["request"])
+	assert.NotContains(t, a.GetFields(), "user")
+	assert.Empty(t, root.GetFields())
+}
+
+func TestConcurrentWithField(t *testing.T) {
+	root := newTestLogger(t, LoggerOptions{Level: "error"})
+	parent := root.WithField("service", "blueprint")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := parent.WithField("n", i).WithFields(map[string]interface{}{"k": i}).Named("worker")
+			child.Debug("not written")
+			assert.Equal(t, i, child.GetFields()["n"])
+			_ = child.Clone().GetFields()
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, parent.GetFields(), 1)
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	root := newTestLogger(t, LoggerOptions{Level: "info"}).WithField("a", 1)
+	clone := root.Clone()
+
+	fields := clone.GetFields()
+	fields["b"] = 2
+
+	assert.NotContains(t, clone.GetFields(), "b")
+	assert.Equal(t, root.GetFields(), clone.GetFields())
+}
+
+func TestNamed(t *testing.T) {
+	root := newTestLogger(t, LoggerOptions{Level: "info"})
+	named := root.Named("db").Named("pool")
+	assert.Equal(t, "db.pool", named.Desugar().Name())
+	assert.Equal(t, "", root.Desugar().Name())
+}
+
+func TestWithContextTypedKeys(t *testing.T) {
+	root := newTestLogger(t, LoggerOptions{Level: "info"})
+	ctx := ctxmeta.WithTraceID(context.Background(), "t-1")
+	ctx = ctxmeta.WithUserID(ctx, "u-1")
+
+	fields := root.WithContext(ctx).GetFields()
+	assert.Equal(t, "t-1", fields["trace_id"])
+	assert.Equal(t, "u-1", fields["user_id"])
+	assert.Empty(t, root.GetFields())
+}
@@ -0,0 +1,158 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// levelCore gates an ungated core with its own level, so loggers that share
+// the same outputs can still log at different levels
+type levelCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(entry.Level) {
+		return ce
+	}
+	return c.Core.Check(entry, ce)
+}
+
+// moduleLevel follows the root level until an override is set
+type moduleLevel struct {
+	root     zap.AtomicLevel
+	level    zap.AtomicLevel
+	override atomic.Bool
+}
+
+func (m *moduleLevel) Enabled(level zapcore.Level) bool {
+	if m.override.Load() {
+		return m.level.Enabled(level)
+	}
+	return m.root.Enabled(level)
+}
+
+func (m *moduleLevel) String() string {
+	if m.override.Load() {
+		return m.level.String()
+	}
+	return m.root.String()
+}
+
+type moduleRegistry struct {
+	mu      sync.Mutex
+	root    zap.AtomicLevel
+	modules map[string]*moduleLevel
+}
+
+func newModuleRegistry(root zap.AtomicLevel, overrides map[string]string) (*moduleRegistry, error) {
+	r := &moduleRegistry{
+		root:    root,
+		modules: make(map[string]*moduleLevel),
+	}
+
+	for name, level := range overrides {
+		if err := r.set(name, level); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *moduleRegistry) get(name string) *moduleLevel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.modules[name]
+	if !ok {
+		m = &moduleLevel{root: r.root, level: zap.NewAtomicLevel()}
+		r.modules[name] = m
+	}
+	return m
+}
+
+func (r *moduleRegistry) set(name, level string) error {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid level %q for module %s: %w", level, name, err)
+	}
+
+	m := r.get(name)
+	m.level.SetLevel(lvl)
+	m.override.Store(true)
+	return nil
+}
+
+func (r *moduleRegistry) levels() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make(map[string]string, len(r.modules))
+	for name, m := range r.modules {
+		out[name] = m.String()
+	}
+	return out
+}
+
+// Module returns a named child logger with its own level. Without an override
+// it follows the root level, SetModuleLevel changes it at runtime
+func (l *Logger) Module(name string) *Logger {
+	m := l.modules.get(name)
+
+	zapLogger := l.Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if lc, ok := core.(*levelCore); ok {
+			return &levelCore{Core: lc.Core, level: m}
+		}
+		return &levelCore{Core: core, level: m}
+	})).Named(name)
+
+	return l.derive(zapLogger.Sugar(), l.copyFields(0))
+}
+
+func (l *Logger) SetModuleLevel(name, level string) error {
+	return l.modules.set(name, level)
+}
+
+// ResetModuleLevel drops the override so the module follows the root level again
+func (l *Logger) ResetModuleLevel(name string) {
+	l.modules.get(name).override.Store(false)
+}
+
+// ModuleLevels returns the effective level of every module seen so far
+func (l *Logger) ModuleLevels() map[string]string {
+	return l.modules.levels()
+}
+
+// ParseModuleLevels reads the "db=warn,cache=debug" format used by LOG_LEVELS
+func ParseModuleLevels(spec string) (map[string]string, error) {
+	out := make(map[string]string)
+	if strings.TrimSpace(spec) == "" {
+		return out, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		name, level, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || name == "" || level == "" {
+			return nil, fmt.Errorf("invalid module level %q, expected module=level", part)
+		}
+		out[strings.TrimSpace(name)] = strings.TrimSpace(level)
+	}
+
+	return out, nil
+}
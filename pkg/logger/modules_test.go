@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"path/filepath"
+	"testing"
+
+	"blueprint/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func newTestLogger(t *testing.T, opts LoggerOptions) *Logger {
+	t.Helper()
+	opts.OutputPath = filepath.Join(t.TempDir(), "test.log")
+	l, err := NewLoggerWithOptions(&config.Config{}, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestModuleLevels(t *testing.T) {
+	l := newTestLogger(t, LoggerOptions{
+		Level:        "info",
+		ModuleLevels: map[string]string{"db": "warn", "cache": "debug"},
+	})
+
+	db := l.Module("db")
+	cache := l.Module("cache")
+	grpc := l.Module("grpc")
+
+	assert.False(t, db.Desugar().Core().Enabled(zapcore.InfoLevel))
+	assert.True(t, db.Desugar().Core().Enabled(zapcore.WarnLevel))
+	assert.True(t, cache.Desugar().Core().Enabled(zapcore.DebugLevel))
+	assert.False(t, l.Desugar().Core().Enabled(zapcore.DebugLevel))
+
+	// modules without override follow the root level
+	assert.False(t, grpc.Desugar().Core().Enabled(zapcore.DebugLevel))
+	require.NoError(t, l.SetLevel("debug"))
+	assert.True(t, grpc.Desugar().Core().Enabled(zapcore.DebugLevel))
+
+	// runtime changes reach loggers that already exist
+	require.NoError(t, l.SetModuleLevel("db", "error"))
+	assert.False(t, db.Desugar().Core().Enabled(zapcore.WarnLevel))
+	l.ResetModuleLevel("db")
+	assert.True(t, db.Desugar().Core().Enabled(zapcore.DebugLevel))
+
+	assert.Equal(t, "debug", l.ModuleLevels()["cache"])
+	assert.Error(t, l.SetModuleLevel("db", "loud"))
+}
+
+func TestParseModuleLevels(t *testing.T) {
+	levels, err := ParseModuleLevels("db=warn, cache=debug")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"db": "warn", "cache": "debug"}, levels)
+
+	_, err = ParseModuleLevels("db")
+	assert.Error(t, err)
+}
@@ -0,0 +1,333 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/compress"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	RotateHourly = "hourly"
+	RotateDaily  = "daily"
+	// lumberjack also rotates by size on its own, pick those backups up on this period
+	archiveScanInterval = time.Minute
+)
+
+// Compressor archives a rotated file and returns the archive path, the source
+// file is removed by the rotator once it returns without error
+type Compressor func(path string) (string, error)
+
+// rotator adds time based rotation, total disk usage retention and archive
+// callbacks on top of lumberjack, which only knows about file size
+type rotator struct {
+	lj            *lumberjack.Logger
+	interval      string
+	maxTotalBytes int64
+	compress      Compressor
+	onArchive     func(path string)
+	clock         clock.Clock
+
+	mu       sync.Mutex
+	archived map[string]bool
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newRotator(lj *lumberjack.Logger, opts LoggerOptions) *rotator {
+	r := &rotator{
+		lj:            lj,
+		interval:      opts.RotateInterval,
+		maxTotalBytes: int64(opts.MaxTotalSize) * 1024 * 1024,
+		onArchive:     opts.OnArchive,
+		clock:         clock.Or(opts.Clock),
+		archived:      make(map[string]bool),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if opts.Compressor != nil {
+		r.compress = opts.Compressor
+	} else if opts.Compress {
+		gzip, _ := compress.New(compress.Gzip, compress.LevelDefault)
+		r.compress = CompressorFor(gzip)
+	}
+
+	r.seedArchived()
+
+	go r.run()
+
+	return r
+}
+
+// seedArchived marks backups left by a previous run so OnArchive only sees new files
+func (r *rotator) seedArchived() {
+	backups, err := r.backups()
+	if err != nil {
+		return
+	}
+	for _, path := range backups {
+		if r.compress == nil || isArchive(path) {
+			r.archived[path] = true
+		}
+	}
+}
+
+// rotatorEnabled is true when an option needs more than plain lumberjack
+func rotatorEnabled(opts LoggerOptions) bool {
+	return opts.RotateInterval != "" || opts.MaxTotalSize > 0 || opts.Compressor != nil || opts.OnArchive != nil
+}
+
+func (r *rotator) Close() error {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	<-r.done
+	return nil
+}
+
+func (r *rotator) run() {
+	defer close(r.done)
+
+	scan := r.clock.NewTicker(archiveScanInterval)
+	defer scan.Stop()
+
+	var rotateC <-chan time.Time
+	var rotateTimer clock.Timer
+	if r.interval != "" {
+		now := r.clock.Now()
+		rotateTimer = r.clock.NewTimer(nextRotation(now, r.interval).Sub(now))
+		defer rotateTimer.Stop()
+		rotateC = rotateTimer.C()
+	}
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-scan.C():
+			r.process()
+		case now := <-rotateC:
+			if err := r.lj.Rotate(); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: failed to rotate %s: %v\n", r.lj.Filename, err)
+			}
+			rotateTimer.Reset(nextRotation(now, r.interval).Sub(r.clock.Now()))
+			r.process()
+		}
+	}
+}
+
+// process archives new backups and then enforces the disk usage limit
+func (r *rotator) process() {
+	backups, err := r.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logger: failed to list log backups: %v\n", err)
+		return
+	}
+
+	for _, path := range backups {
+		if r.isArchived(path) {
+			continue
+		}
+
+		archive := path
+		if r.compress != nil && !isArchive(path) {
+			out, err := r.compress(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "logger: failed to compress %s: %v\n", path, err)
+				continue
+			}
+			if out != path {
+				_ = os.Remove(path)
+			}
+			archive = out
+		}
+
+		r.markArchived(archive)
+		if r.onArchive != nil {
+			r.onArchive(archive)
+		}
+	}
+
+	if r.maxTotalBytes > 0 {
+		r.enforceTotalSize()
+	}
+}
+
+func (r *rotator) enforceTotalSize() {
+	backups, err := r.backups()
+	if err != nil {
+		return
+	}
+
+	type fileInfo struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var total int64
+	if st, err := os.Stat(r.lj.Filename); err == nil {
+		total += st.Size()
+	}
+
+	files := make([]fileInfo, 0, len(backups))
+	for _, path := range backups {
+		st, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		total += st.Size()
+		files = append(files, fileInfo{path: path, size: st.Size(), modTime: st.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	// the active file is never removed, oldest backups go first
+	for _, f := range files {
+		if total <= r.maxTotalBytes {
+			return
+		}
+		if err := os.Remove(f.path); err == nil {
+			total -= f.size
+			r.mu.Lock()
+			delete(r.archived, f.path)
+			r.mu.Unlock()
+		}
+	}
+}
+
+// backups lists rotated files using lumberjack's name-<timestamp>.ext scheme
+func (r *rotator) backups() ([]string, error) {
+	dir := filepath.Dir(r.lj.Filename)
+	base := filepath.Base(r.lj.Filename)
+	ext := filepath.Ext(base)
+	prefix := base[:len(base)-len(ext)] + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || name == base || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasSuffix(name, ext) || isArchive(name) && strings.HasSuffix(strings.TrimSuffix(name, filepath.Ext(name)), ext) {
+			out = append(out, filepath.Join(dir, name))
+		}
+	}
+	return out, nil
+}
+
+func (r *rotator) isArchived(path string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.archived[path]
+}
+
+func (r *rotator) markArchived(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.archived[path] = true
+}
+
+func nextRotation(now time.Time, interval string) time.Time {
+	now = now.UTC()
+	switch interval {
+	case RotateHourly:
+		return now.Truncate(time.Hour).Add(time.Hour)
+	default:
+		return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// applyCompression sets how rotated files are archived from LOG_COMPRESSION
+// or the compression preset. Default gzip is left to lumberjack.
+func applyCompression(opts *LoggerOptions, cfg *config.Config) error {
+	p, err := compress.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	switch {
+	case p.Log == compress.None:
+		opts.Compress = false
+	case p.Log == compress.Gzip && p.LogLevel == compress.LevelDefault:
+	default:
+		codec, err := compress.New(p.Log, p.LogLevel)
+		if err != nil {
+			return err
+		}
+		opts.Compressor = CompressorFor(codec)
+	}
+	return nil
+}
+
+// isArchive reports whether path is a compressed backup, whatever the
+// codec it was archived with
+func isArchive(path string) bool {
+	for _, suffix := range compress.Suffixes() {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompressorFor archives rotated files with codec, named after the file
+// plus the codec's suffix
+func CompressorFor(codec compress.Codec) Compressor {
+	return func(path string) (string, error) {
+		src, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer src.Close()
+
+		target := path + codec.Suffix()
+		dst, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return "", err
+		}
+
+		w, err := codec.NewWriter(dst)
+		if err != nil {
+			dst.Close()
+			os.Remove(target)
+			return "", err
+		}
+		if _, err := io.Copy(w, src); err != nil {
+			dst.Close()
+			os.Remove(target)
+			return "", err
+		}
+		if err := w.Close(); err != nil {
+			dst.Close()
+			os.Remove(target)
+			return "", err
+		}
+		if err := dst.Close(); err != nil {
+			os.Remove(target)
+			return "", err
+		}
+
+		return target, nil
+	}
+}
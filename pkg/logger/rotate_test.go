@@ -0,0 +1,119 @@
+package logger
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/compress"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func TestRotatorArchivesAndEnforcesTotalSize(t *testing.T) {
+	dir := t.TempDir()
+	active := filepath.Join(dir, "blueprint.log")
+	require.NoError(t, os.WriteFile(active, make([]byte, 512*1024), 0644))
+
+	// three backups of 512KB each, oldest first
+	for i, ts := range []string{"2024-01-01T00-00-00.000", "2024-01-02T00-00-00.000", "2024-01-03T00-00-00.000"} {
+		path := filepath.Join(dir, "blueprint-"+ts+".log")
+		require.NoError(t, os.WriteFile(path, make([]byte, 512*1024), 0644))
+		mod := time.Now().Add(time.Duration(i-3) * time.Hour)
+		require.NoError(t, os.Chtimes(path, mod, mod))
+	}
+
+	var archived []string
+	r := newRotator(&lumberjack.Logger{Filename: active}, LoggerOptions{
+		MaxTotalSize: 1,
+		Compressor: func(path string) (string, error) {
+			// keep sizes predictable, just rename
+			return path + ".gz", os.Rename(path, path+".gz")
+		},
+		OnArchive: func(path string) { archived = append(archived, path) },
+	})
+	defer r.Close()
+
+	r.process()
+
+	assert.Len(t, archived, 3)
+	for _, path := range archived {
+		assert.True(t, strings.HasSuffix(path, ".log.gz"))
+	}
+
+	// 1MB budget keeps the active file and the newest backup only
+	backups, err := r.backups()
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	assert.Contains(t, backups[0], "2024-01-03")
+}
+
+func TestNextRotation(t *testing.T) {
+	now := time.Date(2024, 5, 10, 13, 45, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 5, 10, 14, 0, 0, 0, time.UTC), nextRotation(now, RotateHourly))
+	assert.Equal(t, time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC), nextRotation(now, RotateDaily))
+}
+
+func TestCompressorFor(t *testing.T) {
+	zstd, err := compress.New(compress.Zstd, compress.LevelFastest)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	active := filepath.Join(dir, "blueprint.log")
+	backup := filepath.Join(dir, "blueprint-2024-01-01T00-00-00.000.log")
+	lines := strings.Repeat(`{"level":"info","message":"Order placed"}`+"\n", 1000)
+	require.NoError(t, os.WriteFile(backup, []byte(lines), 0644))
+
+	var archived []string
+	r := newRotator(&lumberjack.Logger{Filename: active}, LoggerOptions{
+		Compressor: CompressorFor(zstd),
+		OnArchive:  func(path string) { archived = append(archived, path) },
+	})
+	defer r.Close()
+	r.process()
+
+	require.Equal(t, []string{backup + ".zst"}, archived)
+	_, err = os.Stat(backup)
+	assert.True(t, os.IsNotExist(err), "the plain backup is removed")
+
+	f, err := os.Open(backup + ".zst")
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	require.NoError(t, err)
+	got, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, lines, string(got))
+
+	// the archive is still a backup, for the disk budget, and not
+	// compressed again
+	backups, err := r.backups()
+	require.NoError(t, err)
+	assert.Equal(t, []string{backup + ".zst"}, backups)
+	r.process()
+	assert.Len(t, archived, 1)
+}
+
+func TestApplyCompression(t *testing.T) {
+	cfg := &config.Config{}
+	opts := defaultOptions
+	require.NoError(t, applyCompression(&opts, cfg))
+	assert.True(t, opts.Compress)
+	assert.Nil(t, opts.Compressor, "lumberjack gzips by default")
+
+	cfg.Compression.Log = compress.None
+	opts = defaultOptions
+	require.NoError(t, applyCompression(&opts, cfg))
+	assert.False(t, opts.Compress)
+
+	cfg.Compression = config.Compression{Preset: "latency"}
+	opts = defaultOptions
+	require.NoError(t, applyCompression(&opts, cfg))
+	assert.NotNil(t, opts.Compressor)
+}
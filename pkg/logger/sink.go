@@ -0,0 +1,73 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package logger
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrorSink receives every entry logged at error level or above, e.g. an error tracker
+type ErrorSink interface {
+	Report(entry zapcore.Entry, fields map[string]interface{})
+	// Flush blocks until queued reports are delivered, it runs before Fatal exits
+	Flush()
+}
+
+// AddErrorSink tees error and fatal entries into sink. Loggers derived before
+// the call keep their old core, so hook it right after NewLogger
+func (l *Logger) AddErrorSink(sink ErrorSink) {
+	zapLogger := l.Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		// stay behind the level gate, otherwise modules could not silence it
+		if lc, ok := core.(*levelCore); ok {
+			return &levelCore{Core: zapcore.NewTee(lc.Core, &sinkCore{sink: sink}), level: lc.level}
+		}
+		return zapcore.NewTee(core, &sinkCore{sink: sink})
+	}))
+	l.SugaredLogger = zapLogger.Sugar()
+}
+
+type sinkCore struct {
+	sink   ErrorSink
+	fields []zapcore.Field
+}
+
+func (c *sinkCore) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.ErrorLevel
+}
+
+func (c *sinkCore) With(fields []zapcore.Field) zapcore.Core {
+	merged := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	merged = append(merged, c.fields...)
+	merged = append(merged, fields...)
+	return &sinkCore{sink: c.sink, fields: merged}
+}
+
+func (c *sinkCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *sinkCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	c.sink.Report(entry, enc.Fields)
+
+	// same rule as zap's ioCore, anything above error is about to exit
+	if entry.Level > zapcore.ErrorLevel {
+		c.sink.Flush()
+	}
+	return nil
+}
+
+func (c *sinkCore) Sync() error {
+	c.sink.Flush()
+	return nil
+}
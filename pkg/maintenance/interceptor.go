@@ -0,0 +1,73 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package maintenance
+
+import (
+	"context"
+	"time"
+
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/grpcmethod"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// ReasonMaintenance is the ErrorInfo reason of calls turned down
+const ReasonMaintenance = "MAINTENANCE"
+
+// messageKey is the i18n key of the message callers get
+const messageKey = "maintenance_unavailable"
+
+const fallbackMessage = "The service is under maintenance, please try again later"
+
+func (s *Switch) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := s.Check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor turns down streams when they open, one already
+// open runs to its end
+func (s *Switch) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := s.Check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// Check is nil when fullMethod may run, Unavailable with a retry delay
+// while maintenance mode is on and it is not read-only
+func (s *Switch) Check(ctx context.Context, fullMethod string) error {
+	if !s.Enabled() || grpcmethod.MatchAny(s.opts.ReadOnly, fullMethod) {
+		return nil
+	}
+	rejected.WithLabelValues(fullMethod).Inc()
+
+	e := errors.New(codes.Unavailable, ReasonMaintenance, s.message(ctx)).
+		WithRetryAfter(s.RetryAfter())
+	if until := s.State().Until; !until.IsZero() {
+		e = e.WithMetadata("until", until.UTC().Format(time.RFC3339))
+	}
+	return e
+}
+
+// message is in the caller's language, English without a translation
+func (s *Switch) message(ctx context.Context) string {
+	if s.opts.Translator == nil {
+		return fallbackMessage
+	}
+	locale, ok := ctxmeta.Locale(ctx)
+	if !ok {
+		locale = s.opts.Locale
+	}
+	if msg := s.opts.Translator.Tr(locale, messageKey); msg != "" && msg != messageKey {
+		return msg
+	}
+	return fallbackMessage
+}
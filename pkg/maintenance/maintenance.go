@@ -0,0 +1,345 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package maintenance is the switch that takes the service into read-only
+// maintenance mode. While it is on only the ReadOnly methods run, every
+// other call gets Unavailable with a localized message and a retry delay,
+// and the readiness probe reports the service degraded.
+//
+//	sw := maintenance.New(cfg, log, translator)
+//	sw.SetStore(maintenance.NewRedisStore(rdb, cfg.Maintenance.Key))
+//	sw.Start()
+//
+// With a Store the switch is shared, Set writes it and every replica reads
+// it back within PollInterval. Without one each replica is switched on its
+// own and a restart turns it off.
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/health"
+	"blueprint/pkg/i18n"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+	defaultRetryAfter   = time.Minute
+	defaultLocale       = "en-US"
+)
+
+var (
+	modeGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "blueprint_maintenance_mode",
+		Help: "1 while the service is in maintenance mode.",
+	})
+	rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_maintenance_rejected_total",
+		Help: "Calls turned down because the service is in maintenance mode, by method.",
+	}, []string{"method"})
+	syncErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blueprint_maintenance_sync_errors_total",
+		Help: "Failed reads of the shared maintenance switch, the replica keeps its last state.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(modeGauge, rejected, syncErrors)
+}
+
+// State of the switch. Until is when maintenance is expected to be over,
+// zero when nobody said.
+type State struct {
+	Enabled bool      `json:"enabled"`
+	Reason  string    `json:"reason,omitempty"`
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"`
+}
+
+// Store shares the switch between replicas, Load of a switch never set is
+// the zero State
+type Store interface {
+	Load(ctx context.Context) (State, error)
+	Save(ctx context.Context, s State) error
+}
+
+// RedisStore keeps the State as JSON under one key, deleted while off
+type RedisStore struct {
+	client *redis.Client
+	key    string
+}
+
+func NewRedisStore(client *redis.Client, key string) *RedisStore {
+	return &RedisStore{client: client, key: key}
+}
+
+func (r *RedisStore) Load(ctx context.Context) (State, error) {
+	data, err := r.client.Get(ctx, r.key).Bytes()
+	if stderrors.Is(err, redis.Nil) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, err
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return State{}, fmt.Errorf("decoding %s: %w", r.key, err)
+	}
+	return s, nil
+}
+
+func (r *RedisStore) Save(ctx context.Context, s State) error {
+	if !s.Enabled {
+		return r.client.Del(ctx, r.key).Err()
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.key, data, 0).Err()
+}
+
+type Options struct {
+	// ReadOnly methods keep running in maintenance mode, full methods,
+	// services or bare method names
+	ReadOnly []string
+	// RetryAfter is the delay callers are given while the switch has no
+	// Until
+	RetryAfter time.Duration
+	// PollInterval is how often the Store is read
+	PollInterval time.Duration
+	// Translator nil answers in English, Locale is the language of callers
+	// that sent no accept-language
+	Translator i18n.Translator
+	Locale     string
+	Clock      clock.Clock
+}
+
+// Switch is the maintenance mode of this replica
+type Switch struct {
+	log  *logger.Logger
+	opts Options
+
+	mu      sync.RWMutex
+	state   State
+	store   Store
+	failing bool
+
+	cancel context.CancelFunc
+	group  *run.Group
+}
+
+// New takes its options from cfg.Maintenance, translator may be nil
+func New(cfg *config.Config, log *logger.Logger, translator i18n.Translator) *Switch {
+	return NewWithOptions(log, Options{
+		ReadOnly:     cfg.Maintenance.ReadOnly,
+		RetryAfter:   cfg.Maintenance.RetryAfter,
+		PollInterval: cfg.Maintenance.PollInterval,
+		Translator:   translator,
+		Locale:       cfg.Notify.Locale,
+	})
+}
+
+func NewWithOptions(log *logger.Logger, opts Options) *Switch {
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = defaultRetryAfter
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.Locale == "" {
+		opts.Locale = defaultLocale
+	}
+	opts.Clock = clock.Or(opts.Clock)
+	return &Switch{log: log, opts: opts}
+}
+
+// SetStore shares the switch through store, call it before Start. The
+// state in the store wins over the one of this replica.
+func (s *Switch) SetStore(store Store) {
+	s.mu.Lock()
+	s.store = store
+	s.mu.Unlock()
+}
+
+// State is the switch as this replica last saw it
+func (s *Switch) State() State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+// Enabled is false on a nil Switch
+func (s *Switch) Enabled() bool {
+	if s == nil {
+		return false
+	}
+	return s.State().Enabled
+}
+
+// Shared reports whether the switch goes through a Store
+func (s *Switch) Shared() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store != nil
+}
+
+// Set turns maintenance mode on or off and returns the state before.
+// Expected is how long maintenance should take, 0 when unknown. With a
+// Store a failed write changes nothing, replicas must not disagree.
+func (s *Switch) Set(ctx context.Context, enabled bool, reason string, expected time.Duration) (State, error) {
+	next := State{}
+	if enabled {
+		now := s.opts.Clock.Now()
+		next = State{Enabled: true, Reason: reason, Since: now}
+		if prev := s.State(); prev.Enabled {
+			// a new reason or end does not restart the clock
+			next.Since = prev.Since
+		}
+		if expected > 0 {
+			next.Until = now.Add(expected)
+		}
+	}
+
+	s.mu.RLock()
+	store := s.store
+	s.mu.RUnlock()
+	if store != nil {
+		if err := store.Save(ctx, next); err != nil {
+			return s.State(), err
+		}
+	}
+	return s.apply(next), nil
+}
+
+// apply makes next the state of this replica, logging a change
+func (s *Switch) apply(next State) State {
+	s.mu.Lock()
+	prev := s.state
+	s.state = next
+	s.mu.Unlock()
+
+	if next.Enabled {
+		modeGauge.Set(1)
+	} else {
+		modeGauge.Set(0)
+	}
+	if s.log == nil || prev.Enabled == next.Enabled {
+		return prev
+	}
+	if next.Enabled {
+		s.log.WithFields(map[string]interface{}{
+			"reason": next.Reason,
+			"until":  next.Until,
+		}).Warnf("Maintenance mode on, only %v keep running", s.opts.ReadOnly)
+	} else {
+		s.log.Warnf("Maintenance mode off after %s", s.opts.Clock.Now().Sub(prev.Since).Round(time.Second))
+	}
+	return prev
+}
+
+// Sync reads the Store once, on error the replica keeps its state
+func (s *Switch) Sync(ctx context.Context) error {
+	s.mu.RLock()
+	store := s.store
+	s.mu.RUnlock()
+	if store == nil {
+		return nil
+	}
+
+	state, err := store.Load(ctx)
+
+	s.mu.Lock()
+	wasFailing := s.failing
+	s.failing = err != nil
+	s.mu.Unlock()
+
+	if err != nil {
+		syncErrors.Inc()
+		// once per outage, not every poll
+		if !wasFailing && s.log != nil {
+			s.log.Warnf("Reading the maintenance switch failed, keeping maintenance mode %v: %v", s.Enabled(), err)
+		}
+		return err
+	}
+	if wasFailing && s.log != nil {
+		s.log.Infof("Maintenance switch readable again")
+	}
+	s.apply(state)
+	return nil
+}
+
+// Start reads the Store now and every PollInterval until Stop, without a
+// Store it does nothing
+func (s *Switch) Start() {
+	if !s.Shared() {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.Sync(ctx)
+
+	s.group = run.NewGroup(ctx, s.log)
+	s.group.Supervise("maintenance_sync", s.poll, run.Options{Clock: s.opts.Clock})
+}
+
+func (s *Switch) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.group != nil {
+		s.group.Wait()
+	}
+}
+
+func (s *Switch) poll(ctx context.Context) error {
+	ticker := s.opts.Clock.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			s.Sync(ctx)
+		}
+	}
+}
+
+// RetryAfter is how long callers should wait, until the expected end or
+// Options.RetryAfter, never below a second
+func (s *Switch) RetryAfter() time.Duration {
+	state := s.State()
+	if state.Until.IsZero() {
+		return s.opts.RetryAfter
+	}
+	if d := state.Until.Sub(s.opts.Clock.Now()); d > time.Second {
+		return d.Round(time.Second)
+	}
+	return time.Second
+}
+
+// Readiness is a lifecycle readiness check, degraded while maintenance mode
+// is on so the pod stays in rotation for the read-only calls
+func (s *Switch) Readiness(ctx context.Context) error {
+	state := s.State()
+	if !state.Enabled {
+		return nil
+	}
+	err := fmt.Errorf("maintenance mode since %s", state.Since.UTC().Format(time.RFC3339))
+	if state.Reason != "" {
+		err = fmt.Errorf("%w: %s", err, state.Reason)
+	}
+	return health.Degrade(err)
+}
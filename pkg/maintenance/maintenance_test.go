@@ -0,0 +1,181 @@
+package maintenance
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/health"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+type memStore struct {
+	mu    sync.Mutex
+	state State
+	err   error
+}
+
+func (m *memStore) Load(ctx context.Context) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state, m.err
+}
+
+func (m *memStore) Save(ctx context.Context, s State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.state = s
+	return nil
+}
+
+type mapTranslator map[string]string
+
+func (m mapTranslator) Tr(lang, key string, args ...interface{}) string {
+	if format, ok := m[lang+":"+key]; ok {
+		return fmt.Sprintf(format, args...)
+	}
+	return ""
+}
+
+var start = time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+func newSwitch(clk clock.Clock) *Switch {
+	return NewWithOptions(nil, Options{
+		ReadOnly:   []string{"Version", "grpc.health.v1.Health"},
+		RetryAfter: 2 * time.Minute,
+		Translator: mapTranslator{
+			"en-US:" + messageKey: "Down for maintenance",
+			"zh-CN:" + messageKey: "系统维护中",
+		},
+		Clock: clk,
+	})
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	sw := newSwitch(clock.NewFake(start))
+
+	assert.NoError(t, sw.Check(ctx, "/blueprint.Blueprint/Call"), "off")
+
+	_, err := sw.Set(ctx, true, "schema migration", 0)
+	require.NoError(t, err)
+
+	assert.NoError(t, sw.Check(ctx, "/blueprint.Blueprint/Version"))
+	assert.NoError(t, sw.Check(ctx, "/grpc.health.v1.Health/Check"))
+
+	err = sw.Check(ctx, "/blueprint.Blueprint/Call")
+	e, ok := errors.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.Unavailable, e.Code)
+	assert.Equal(t, ReasonMaintenance, e.Reason)
+	assert.Equal(t, "Down for maintenance", e.Message)
+	assert.Equal(t, 2*time.Minute, e.RetryAfter)
+	assert.NotContains(t, e.Message, "schema migration", "the reason is for operators")
+
+	e, _ = errors.FromError(sw.Check(ctxmeta.WithLocale(ctx, "zh-CN"), "/blueprint.Blueprint/Call"))
+	assert.Equal(t, "系统维护中", e.Message)
+	e, _ = errors.FromError(sw.Check(ctxmeta.WithLocale(ctx, "el-GR"), "/blueprint.Blueprint/Call"))
+	assert.Equal(t, fallbackMessage, e.Message, "no translation")
+
+	prev, err := sw.Set(ctx, false, "", 0)
+	require.NoError(t, err)
+	assert.True(t, prev.Enabled)
+	assert.NoError(t, sw.Check(ctx, "/blueprint.Blueprint/Call"))
+}
+
+func TestRetryAfterUntil(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(start)
+	sw := newSwitch(clk)
+
+	_, err := sw.Set(ctx, true, "", 30*time.Minute)
+	require.NoError(t, err)
+	clk.Advance(10 * time.Minute)
+	assert.Equal(t, 20*time.Minute, sw.RetryAfter())
+
+	e, _ := errors.FromError(sw.Check(ctx, "Call"))
+	assert.Equal(t, start.Add(30*time.Minute).Format(time.RFC3339), e.Metadata["until"])
+
+	clk.Advance(time.Hour)
+	assert.Equal(t, time.Second, sw.RetryAfter(), "overdue")
+
+	// a new end keeps when it began
+	_, err = sw.Set(ctx, true, "", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, start, sw.State().Since)
+}
+
+func TestReadiness(t *testing.T) {
+	ctx := context.Background()
+	sw := newSwitch(clock.NewFake(start))
+	assert.NoError(t, sw.Readiness(ctx))
+
+	_, err := sw.Set(ctx, true, "failover", 0)
+	require.NoError(t, err)
+	err = sw.Readiness(ctx)
+	assert.Equal(t, health.Degraded, health.StateOf(err), "read-only calls keep the pod in rotation")
+	assert.Contains(t, err.Error(), "failover")
+}
+
+func TestSharedSwitch(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	a, b := newSwitch(clock.NewFake(start)), newSwitch(clock.NewFake(start))
+	a.SetStore(store)
+	b.SetStore(store)
+
+	_, err := a.Set(ctx, true, "upgrade", 0)
+	require.NoError(t, err)
+	assert.False(t, b.Enabled(), "until it polls")
+	require.NoError(t, b.Sync(ctx))
+	assert.True(t, b.Enabled())
+	assert.Equal(t, "upgrade", b.State().Reason)
+
+	store.err = stderrors.New("redis down")
+	_, err = b.Set(ctx, false, "", 0)
+	assert.Error(t, err)
+	assert.True(t, b.Enabled(), "a failed write changes nothing")
+	assert.Error(t, b.Sync(ctx))
+	assert.True(t, b.Enabled(), "a failed read keeps the state")
+
+	store.err = nil
+	_, err = b.Set(ctx, false, "", 0)
+	require.NoError(t, err)
+	require.NoError(t, a.Sync(ctx))
+	assert.False(t, a.Enabled())
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewRedisStore(testsupport.Redis(t), "blueprint:maintenance")
+
+	s, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.False(t, s.Enabled, "never set")
+
+	on := State{Enabled: true, Reason: "upgrade", Since: start, Until: start.Add(time.Hour)}
+	require.NoError(t, store.Save(ctx, on))
+	s, err = store.Load(ctx)
+	require.NoError(t, err)
+	assert.True(t, s.Enabled)
+	assert.Equal(t, on.Reason, s.Reason)
+	assert.True(t, on.Until.Equal(s.Until))
+
+	require.NoError(t, store.Save(ctx, State{}))
+	s, err = store.Load(ctx)
+	require.NoError(t, err)
+	assert.False(t, s.Enabled)
+}
@@ -0,0 +1,294 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package netacl
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// ReasonAddressBlocked is the ErrorInfo reason of rejected calls
+const ReasonAddressBlocked = "ADDRESS_BLOCKED"
+
+const defaultReload = 10 * time.Second
+
+var (
+	rejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_netacl_rejected_total",
+		Help: "Calls turned down by the network ACL by rule: deny, not_allowed or unknown.",
+	}, []string{"rule"})
+	reloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_netacl_reloads_total",
+		Help: "Reloads of the network ACL rules file by result: ok or error.",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(rejections, reloads)
+}
+
+// Options for NewACLWithOptions, the lists as in ParseCIDRs
+type Options struct {
+	Allow []string
+	Deny  []string
+	// File holds more rules, see LoadFile, and is reloaded when it changes
+	File string
+	// TrustedProxies may pass the client on in x-forwarded-for, e.g. the
+	// gateway calling in over loopback. Peers on a unix socket always may.
+	TrustedProxies []string
+	// Reload is how often File is checked for changes, 0 uses the default
+	Reload time.Duration
+	Clock  clock.Clock
+}
+
+// ACL is a gRPC interceptor rejecting calls by client address with
+// PermissionDenied, each rejection is logged for audit
+type ACL struct {
+	log     *logger.Logger
+	opts    Options
+	static  Rules
+	trusted []*net.IPNet
+
+	rules    atomic.Value // Rules
+	reloadMu sync.Mutex
+	modTime  time.Time
+
+	cancel context.CancelFunc
+	group  *run.Group
+}
+
+func NewACL(cfg *config.Config, log *logger.Logger) (*ACL, error) {
+	return NewACLWithOptions(log, Options{
+		Allow:          cfg.NetACL.Allow,
+		Deny:           cfg.NetACL.Deny,
+		File:           cfg.NetACL.File,
+		TrustedProxies: cfg.NetACL.TrustedProxies,
+		Reload:         cfg.NetACL.Reload,
+	})
+}
+
+// NewACLWithOptions fails on a bad list or rules file, a rules file going
+// bad later only keeps the rules it had
+func NewACLWithOptions(log *logger.Logger, opts Options) (*ACL, error) {
+	if opts.Reload <= 0 {
+		opts.Reload = defaultReload
+	}
+	opts.Clock = clock.Or(opts.Clock)
+
+	static, err := ParseRules(opts.Allow, opts.Deny)
+	if err != nil {
+		return nil, err
+	}
+	trusted, err := ParseCIDRs(opts.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &ACL{log: log, opts: opts, static: static, trusted: trusted}
+	a.rules.Store(static)
+	if opts.File != "" {
+		if _, err := a.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Enabled is false when no rules are set, leave the interceptors out of
+// the chain then
+func (a *ACL) Enabled() bool {
+	return !a.static.Empty() || a.opts.File != ""
+}
+
+// Rules in effect, the env lists plus the rules file
+func (a *ACL) Rules() Rules {
+	return a.rules.Load().(Rules)
+}
+
+// Reload reads the rules file again if it changed since the last read.
+// On error the current rules stay.
+func (a *ACL) Reload() (changed bool, err error) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	info, err := os.Stat(a.opts.File)
+	if err != nil {
+		reloads.WithLabelValues("error").Inc()
+		return false, err
+	}
+	if info.ModTime().Equal(a.modTime) {
+		return false, nil
+	}
+
+	fileRules, err := LoadFile(a.opts.File)
+	if err != nil {
+		reloads.WithLabelValues("error").Inc()
+		return false, err
+	}
+	a.rules.Store(a.static.Merge(fileRules))
+	a.modTime = info.ModTime()
+	reloads.WithLabelValues("ok").Inc()
+	return true, nil
+}
+
+// Start checks the rules file for changes every Options.Reload until Stop
+func (a *ACL) Start() {
+	if a.opts.File == "" {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+
+	a.group = run.NewGroup(ctx, a.log)
+	a.group.Supervise("netacl_reload", a.poll, run.Options{Clock: a.opts.Clock})
+}
+
+func (a *ACL) Stop() {
+	if a.cancel != nil {
+		a.cancel()
+	}
+	if a.group != nil {
+		a.group.Wait()
+	}
+}
+
+func (a *ACL) poll(ctx context.Context) error {
+	ticker := a.opts.Clock.NewTicker(a.opts.Reload)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			changed, err := a.Reload()
+			if err != nil {
+				a.log.Errorf("Network ACL reload of %s failed, keeping the current rules: %v", a.opts.File, err)
+			} else if changed {
+				r := a.Rules()
+				a.log.Infof("Network ACL reloaded from %s: %d allow, %d deny", a.opts.File, len(r.Allow), len(r.Deny))
+			}
+		}
+	}
+}
+
+// UnaryServerInterceptor must run after the ctxmeta interceptor, the audit
+// entries carry its request and trace ids
+func (a *ACL) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := a.check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (a *ACL) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := a.check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (a *ACL) check(ctx context.Context, method string) error {
+	ip := a.ClientIP(ctx)
+	ok, rule := a.Rules().Check(ip)
+	if ok {
+		return nil
+	}
+
+	label := "not_allowed"
+	switch {
+	case strings.HasPrefix(rule, "deny"):
+		label = "deny"
+	case ip == nil:
+		label = "unknown"
+	}
+	rejections.WithLabelValues(label).Inc()
+
+	fields := map[string]interface{}{
+		"audit":       "netacl",
+		"grpc_method": method,
+		"client_ip":   ip.String(),
+		"rule":        rule,
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		fields["peer"] = p.Addr.String()
+	}
+	a.log.WithContext(ctx).WithFields(fields).Warn("Call rejected by network ACL")
+
+	return errors.New(codes.PermissionDenied, ReasonAddressBlocked, "address not allowed")
+}
+
+// ClientIP is the address the call came from: the transport peer, unless
+// that is a trusted proxy, then the last x-forwarded-for hop that is not
+// one. Nil when it can't be told.
+func (a *ACL) ClientIP(ctx context.Context) net.IP {
+	ip, trusted := a.peer(ctx)
+	if !trusted {
+		return ip
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	hops := strings.Split(strings.Join(md.Get(ctxmeta.HeaderForwarded), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		hopIP := net.ParseIP(hop)
+		if hopIP == nil {
+			return nil
+		}
+		ip = hopIP
+		if !contains(a.trusted, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// Trusted tells whether the peer of the call is a trusted proxy, the only
+// callers that may vouch for who is calling with x-user-id and x-tenant-id
+func (a *ACL) Trusted(ctx context.Context) bool {
+	_, trusted := a.peer(ctx)
+	return trusted
+}
+
+// peer is the transport peer's address and whether it is a trusted proxy,
+// unix sockets always are
+func (a *ACL) peer(ctx context.Context) (net.IP, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return nil, false
+	}
+	if p.Addr.Network() == "unix" {
+		return nil, true
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	ip := net.ParseIP(host)
+	return ip, ip != nil && contains(a.trusted, ip)
+}
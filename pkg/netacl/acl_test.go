@@ -0,0 +1,140 @@
+package netacl
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
+	apperrors "blueprint/pkg/errors"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func peerContext(addr net.Addr, forwarded ...string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	if len(forwarded) > 0 {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(ctxmeta.HeaderForwarded, forwarded[0]))
+	}
+	return ctx
+}
+
+func tcp(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}
+}
+
+func TestClientIP(t *testing.T) {
+	log, _ := testsupport.Logger(t)
+	acl, err := NewACLWithOptions(log, Options{TrustedProxies: []string{"127.0.0.1", "10.9.0.0/16"}})
+	require.NoError(t, err)
+
+	ip := func(ctx context.Context) string { return acl.ClientIP(ctx).String() }
+
+	assert.Equal(t, "203.0.113.5", ip(peerContext(tcp("203.0.113.5"))))
+	assert.Equal(t, "203.0.113.5", ip(peerContext(tcp("203.0.113.5"), "10.0.0.1")),
+		"untrusted peers can't claim another address")
+	assert.Equal(t, "198.51.100.7", ip(peerContext(tcp("127.0.0.1"), "198.51.100.7")), "the gateway passes the client on")
+	assert.Equal(t, "198.51.100.7", ip(peerContext(tcp("127.0.0.1"), "6.6.6.6, 198.51.100.7, 10.9.1.1")),
+		"the last untrusted hop, whatever the client put in front")
+	assert.Equal(t, "127.0.0.1", ip(peerContext(tcp("127.0.0.1"))), "no header, the proxy itself")
+	assert.Nil(t, acl.ClientIP(peerContext(tcp("127.0.0.1"), "not-an-ip")))
+	assert.Equal(t, "198.51.100.7", ip(peerContext(&net.UnixAddr{Name: "/tmp/grpc.sock", Net: "unix"}, "198.51.100.7")),
+		"unix socket peers are local proxies")
+	assert.Nil(t, acl.ClientIP(context.Background()))
+}
+
+func TestTrusted(t *testing.T) {
+	log, _ := testsupport.Logger(t)
+	acl, err := NewACLWithOptions(log, Options{TrustedProxies: []string{"127.0.0.1"}})
+	require.NoError(t, err)
+
+	assert.True(t, acl.Trusted(peerContext(tcp("127.0.0.1"))))
+	assert.True(t, acl.Trusted(peerContext(&net.UnixAddr{Name: "/tmp/grpc.sock", Net: "unix"})))
+	assert.False(t, acl.Trusted(peerContext(tcp("203.0.113.5"), "127.0.0.1")), "forwarded hops don't count")
+	assert.False(t, acl.Trusted(context.Background()))
+}
+
+func TestInterceptorRejectsAndAudits(t *testing.T) {
+	log, logs := testsupport.Logger(t)
+	acl, err := NewACLWithOptions(log, Options{Deny: []string{"203.0.113.0/24"}})
+	require.NoError(t, err)
+	require.True(t, acl.Enabled())
+
+	handled := 0
+	call := func(ctx context.Context) error {
+		_, err := acl.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/blueprint.Blueprint/Call"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				handled++
+				return "ok", nil
+			})
+		return err
+	}
+
+	require.NoError(t, call(peerContext(tcp("198.51.100.7"))))
+
+	ctx := ctxmeta.WithRequestID(peerContext(tcp("203.0.113.9")), "req-1")
+	err = call(ctx)
+	typed, ok := apperrors.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.PermissionDenied, typed.Code)
+	assert.Equal(t, ReasonAddressBlocked, typed.Reason)
+	assert.Equal(t, 1, handled)
+
+	entries := logs.Entries(t)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "netacl", entries[0]["audit"])
+	assert.Equal(t, "203.0.113.9", entries[0]["client_ip"])
+	assert.Equal(t, "deny 203.0.113.0/24", entries[0]["rule"])
+	assert.Equal(t, "/blueprint.Blueprint/Call", entries[0]["grpc_method"])
+	assert.Equal(t, "req-1", entries[0]["request_id"])
+}
+
+func TestReloadOnChange(t *testing.T) {
+	log, _ := testsupport.Logger(t)
+	path := filepath.Join(t.TempDir(), "acl")
+	require.NoError(t, os.WriteFile(path, []byte("deny 203.0.113.9\n"), 0o600))
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	acl, err := NewACLWithOptions(log, Options{Deny: []string{"6.6.6.6"}, File: path, Reload: time.Second, Clock: clk})
+	require.NoError(t, err)
+	require.Len(t, acl.Rules().Deny, 2, "env and file rules")
+
+	acl.Start()
+	defer acl.Stop()
+	clk.BlockUntil(1)
+
+	require.NoError(t, os.WriteFile(path, []byte("deny 203.0.113.9\ndeny 203.0.113.10\n"), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	clk.Advance(time.Second)
+	assert.Eventually(t, func() bool { return len(acl.Rules().Deny) == 3 }, 2*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte("deny nonsense\n"), 0o600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	changed, err := acl.Reload()
+	assert.Error(t, err)
+	assert.False(t, changed)
+	assert.Len(t, acl.Rules().Deny, 3, "a bad file keeps the rules")
+
+	_, err = NewACLWithOptions(log, Options{File: path})
+	assert.Error(t, err, "but fails at startup")
+}
+
+func TestDisabledByDefault(t *testing.T) {
+	log, _ := testsupport.Logger(t)
+	acl, err := NewACL(&config.Config{}, log)
+	require.NoError(t, err)
+	assert.False(t, acl.Enabled())
+}
@@ -0,0 +1,148 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package netacl turns gRPC calls down by client address, from CIDR allow
+// and deny lists set in the env or a rules file that is reloaded while the
+// service runs.
+package netacl
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Rules decide which addresses may call. Deny wins over Allow, an empty
+// Allow lets in every address that is not denied.
+type Rules struct {
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+}
+
+// ParseCIDRs reads CIDRs like 10.0.0.0/8, a bare address is a network of one
+func ParseCIDRs(specs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", spec)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", spec)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ParseRules parses both lists, the first bad entry fails the lot
+func ParseRules(allow, deny []string) (Rules, error) {
+	a, err := ParseCIDRs(allow)
+	if err != nil {
+		return Rules{}, fmt.Errorf("allow list: %w", err)
+	}
+	d, err := ParseCIDRs(deny)
+	if err != nil {
+		return Rules{}, fmt.Errorf("deny list: %w", err)
+	}
+	return Rules{Allow: a, Deny: d}, nil
+}
+
+// LoadFile reads a rules file, one "allow <cidr>" or "deny <cidr>" per
+// line, # starts a comment
+func LoadFile(path string) (Rules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Rules{}, err
+	}
+	defer f.Close()
+
+	var allow, deny []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return Rules{}, fmt.Errorf("%s:%d: want \"allow <cidr>\" or \"deny <cidr>\"", path, n)
+		}
+		switch fields[0] {
+		case "allow":
+			allow = append(allow, fields[1])
+		case "deny":
+			deny = append(deny, fields[1])
+		default:
+			return Rules{}, fmt.Errorf("%s:%d: unknown action %q", path, n, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Rules{}, err
+	}
+
+	rules, err := ParseRules(allow, deny)
+	if err != nil {
+		return Rules{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Merge adds other's lists to r's
+func (r Rules) Merge(other Rules) Rules {
+	return Rules{
+		Allow: append(append([]*net.IPNet{}, r.Allow...), other.Allow...),
+		Deny:  append(append([]*net.IPNet{}, r.Deny...), other.Deny...),
+	}
+}
+
+// Empty is true when the rules let everyone in
+func (r Rules) Empty() bool {
+	return len(r.Allow) == 0 && len(r.Deny) == 0
+}
+
+// Check says whether ip may call and if not which rule turned it down:
+// "deny <cidr>", "not allowed" or "unknown address" for a nil ip while an
+// allow list is set
+func (r Rules) Check(ip net.IP) (bool, string) {
+	if ip == nil {
+		if len(r.Allow) > 0 {
+			return false, "unknown address"
+		}
+		return true, ""
+	}
+	for _, n := range r.Deny {
+		if n.Contains(ip) {
+			return false, "deny " + n.String()
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true, ""
+	}
+	for _, n := range r.Allow {
+		if n.Contains(ip) {
+			return true, ""
+		}
+	}
+	return false, "not allowed"
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package netacl
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := ParseCIDRs([]string{"10.0.0.0/8", " 192.168.1.7 ", "::1", "2001:db8::/32"})
+	require.NoError(t, err)
+	require.Len(t, nets, 4)
+	assert.Equal(t, "192.168.1.7/32", nets[1].String())
+	assert.Equal(t, "::1/128", nets[2].String())
+
+	for _, bad := range []string{"10.0.0.0/33", "host.local", ""} {
+		_, err := ParseCIDRs([]string{bad})
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	rules, err := ParseRules([]string{"10.0.0.0/8"}, []string{"10.6.6.0/24"})
+	require.NoError(t, err)
+
+	ok, _ := rules.Check(net.ParseIP("10.1.2.3"))
+	assert.True(t, ok)
+
+	ok, rule := rules.Check(net.ParseIP("10.6.6.6"))
+	assert.False(t, ok, "deny wins over allow")
+	assert.Equal(t, "deny 10.6.6.0/24", rule)
+
+	ok, rule = rules.Check(net.ParseIP("8.8.8.8"))
+	assert.False(t, ok)
+	assert.Equal(t, "not allowed", rule)
+
+	ok, rule = rules.Check(nil)
+	assert.False(t, ok, "unknown addresses fail an allow list")
+	assert.Equal(t, "unknown address", rule)
+
+	denyOnly, err := ParseRules(nil, []string{"8.8.8.8"})
+	require.NoError(t, err)
+	ok, _ = denyOnly.Check(net.ParseIP("1.1.1.1"))
+	assert.True(t, ok, "no allow list lets everyone else in")
+	ok, _ = denyOnly.Check(nil)
+	assert.True(t, ok)
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acl")
+	require.NoError(t, os.WriteFile(path, []byte("# office\nallow 10.0.0.0/8\n\ndeny 10.6.6.6 # scanner\n"), 0o600))
+
+	rules, err := LoadFile(path)
+	require.NoError(t, err)
+	require.Len(t, rules.Allow, 1)
+	require.Len(t, rules.Deny, 1)
+	assert.Equal(t, "10.6.6.6/32", rules.Deny[0].String())
+
+	require.NoError(t, os.WriteFile(path, []byte("allow 10.0.0.0/8\nblock 1.2.3.4\n"), 0o600))
+	_, err = LoadFile(path)
+	assert.ErrorContains(t, err, ":2: unknown action")
+
+	require.NoError(t, os.WriteFile(path, []byte("deny 1.2.3.4/99\n"), 0o600))
+	_, err = LoadFile(path)
+	assert.ErrorContains(t, err, "invalid CIDR")
+}
@@ -0,0 +1,170 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+)
+
+// SMTPChannel mails every recipient, with PLAIN auth when user is set. The
+// server must offer STARTTLS for it, net/smtp refuses to send the password
+// in the clear.
+type SMTPChannel struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+	// send is smtp.SendMail, replaced in tests
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewSMTPChannel(addr, user, password, from string, to []string) *SMTPChannel {
+	c := &SMTPChannel{addr: addr, from: from, to: to, send: smtp.SendMail}
+	if user != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		c.auth = smtp.PlainAuth("", user, password, host)
+	}
+	return c
+}
+
+func (c *SMTPChannel) Name() string { return "smtp" }
+
+// Send has no way to pass ctx to net/smtp, the dial and server timeouts
+// bound it
+func (c *SMTPChannel) Send(ctx context.Context, n *Notification) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(c.to, ", "))
+	// subjects are localized, Q-encoding keeps them intact in any client
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Body(), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	if err := c.send(c.addr, c.auth, c.from, c.to, msg.Bytes()); err != nil {
+		return fmt.Errorf("smtp send failed: %w", err)
+	}
+	return nil
+}
+
+// SlackChannel posts to an incoming webhook
+type SlackChannel struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlackChannel(webhookURL string) *SlackChannel {
+	return &SlackChannel{url: webhookURL, client: &http.Client{Timeout: defaultTimeout}}
+}
+
+func (c *SlackChannel) Name() string { return "slack" }
+
+func (c *SlackChannel) Send(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, c.client, c.url, "", map[string]string{
+		"text": fmt.Sprintf("%s *%s*\n%s", severityEmoji(n.Severity), n.Subject, n.Body()),
+	})
+}
+
+func severityEmoji(s Severity) string {
+	switch s {
+	case Info:
+		return ":information_source:"
+	case Warning:
+		return ":warning:"
+	default:
+		return ":rotating_light:"
+	}
+}
+
+const telegramAPI = "https://api.telegram.org"
+
+// TelegramChannel sends through a bot to one chat, the bot must be a member
+type TelegramChannel struct {
+	api    string
+	token  string
+	chatID string
+	client *http.Client
+}
+
+func NewTelegramChannel(token, chatID string) *TelegramChannel {
+	return &TelegramChannel{api: telegramAPI, token: token, chatID: chatID, client: &http.Client{Timeout: defaultTimeout}}
+}
+
+func (c *TelegramChannel) Name() string { return "telegram" }
+
+func (c *TelegramChannel) Send(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, c.client, c.api+"/bot"+c.token+"/sendMessage", "", map[string]string{
+		"chat_id": c.chatID,
+		"text":    n.Subject + "\n\n" + n.Body(),
+	})
+}
+
+// SMSChannel posts {"to": [...], "text": "..."} to an SMS gateway with the
+// token as bearer, put a small adapter in front of providers that want
+// their own format
+type SMSChannel struct {
+	url    string
+	token  string
+	to     []string
+	client *http.Client
+}
+
+func NewSMSChannel(endpoint, token string, to []string) *SMSChannel {
+	return &SMSChannel{url: endpoint, token: token, to: to, client: &http.Client{Timeout: defaultTimeout}}
+}
+
+func (c *SMSChannel) Name() string { return "sms" }
+
+// Send texts the subject and text only, fields make SMS too long
+func (c *SMSChannel) Send(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, c.client, c.url, c.token, map[string]interface{}{
+		"to":   c.to,
+		"text": n.Subject + ": " + n.Text,
+	})
+}
+
+func postJSON(ctx context.Context, client *http.Client, endpoint, token string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// webhook and bot urls are secrets, keep them out of the logs
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("notification request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notification endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testNotification() *Notification {
+	return &Notification{
+		Severity: Critical,
+		Subject:  "[blueprint] Margin call A1",
+		Text:     "Account A1 at 80%",
+		Fields:   map[string]string{"pod": "p-1"},
+		Time:     time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+type captured struct {
+	path   string
+	auth   string
+	fields map[string]interface{}
+}
+
+func captureServer(t *testing.T, status int) (*httptest.Server, *captured) {
+	t.Helper()
+	got := &captured{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.path = r.URL.Path
+		got.auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got.fields)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func TestSlackChannel(t *testing.T) {
+	srv, got := captureServer(t, http.StatusOK)
+	require.NoError(t, NewSlackChannel(srv.URL).Send(context.Background(), testNotification()))
+	assert.Equal(t, ":rotating_light: *[blueprint] Margin call A1*\nAccount A1 at 80%\n\npod: p-1", got.fields["text"])
+}
+
+func TestTelegramChannel(t *testing.T) {
+	srv, got := captureServer(t, http.StatusOK)
+	c := NewTelegramChannel("bot-token", "-100123")
+	c.api = srv.URL
+	require.NoError(t, c.Send(context.Background(), testNotification()))
+	assert.Equal(t, "/botbot-token/sendMessage", got.path)
+	assert.Equal(t, "-100123", got.fields["chat_id"])
+}
+
+func TestSMSChannel(t *testing.T) {
+	srv, got := captureServer(t, http.StatusAccepted)
+	require.NoError(t, NewSMSChannel(srv.URL, "sms-token", []string{"+100"}).Send(context.Background(), testNotification()))
+	assert.Equal(t, "Bearer sms-token", got.auth)
+	assert.Equal(t, []interface{}{"+100"}, got.fields["to"])
+	assert.Equal(t, "[blueprint] Margin call A1: Account A1 at 80%", got.fields["text"])
+
+	srv, _ = captureServer(t, http.StatusBadGateway)
+	err := NewSMSChannel(srv.URL, "", []string{"+100"}).Send(context.Background(), testNotification())
+	assert.ErrorContains(t, err, "returned 502")
+}
+
+func TestPostErrorHidesURL(t *testing.T) {
+	c := NewTelegramChannel("secret-token", "1")
+	c.api = "http://127.0.0.1:1"
+	err := c.Send(context.Background(), testNotification())
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret-token")
+}
+
+func TestSMTPChannel(t *testing.T) {
+	c := NewSMTPChannel("smtp.internal:587", "user", "pass", "alerts@example.com", []string{"ops@example.com"})
+	var msg string
+	c.send = func(addr string, a smtp.Auth, from string, to []string, body []byte) error {
+		assert.Equal(t, "smtp.internal:587", addr)
+		assert.NotNil(t, a)
+		assert.Equal(t, []string{"ops@example.com"}, to)
+		msg = string(body)
+		return nil
+	}
+
+	require.NoError(t, c.Send(context.Background(), testNotification()))
+	assert.Contains(t, msg, "Subject: [blueprint] Margin call A1\r\n")
+	assert.Contains(t, msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	assert.Contains(t, msg, "\r\n\r\nAccount A1 at 80%\r\n\r\npod: p-1\r\n")
+}
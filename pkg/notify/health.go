@@ -0,0 +1,38 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package notify
+
+import "sync"
+
+// healthState remembers which readiness checks failed last time
+type healthState struct {
+	mu      sync.Mutex
+	failing map[string]bool
+}
+
+// ObserveCheck alerts when a readiness check starts failing and when it
+// passes again, not on every probe in between. It fits
+// lifecycle.SetCheckObserver.
+func (n *Notifier) ObserveCheck(name string, err error) {
+	n.health.mu.Lock()
+	if n.health.failing == nil {
+		n.health.failing = make(map[string]bool)
+	}
+	was := n.health.failing[name]
+	n.health.failing[name] = err != nil
+	n.health.mu.Unlock()
+
+	switch {
+	case err != nil && !was:
+		n.Send(Message{
+			Severity: Critical,
+			Key:      "health_check_failed",
+			Args:     []interface{}{name, err.Error()},
+		})
+	case err == nil && was:
+		n.Send(Message{
+			Severity: Warning,
+			Key:      "health_check_recovered",
+			Args:     []interface{}{name},
+		})
+	}
+}
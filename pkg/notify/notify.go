@@ -0,0 +1,339 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package notify sends operational alerts, a failing health check or a
+// margin call, to people through email, Slack, Telegram or an SMS gateway.
+// Messages are i18n keys rendered in the configured locale:
+//
+//	n.Send(notify.Message{
+//		Severity: notify.Critical,
+//		Key:      "margin_call",
+//		Args:     []interface{}{account, level, callLevel},
+//	})
+//
+// The text is the translation of Key and the subject the one of Key +
+// "_subject", both get Args. Send only queues, a worker delivers to every
+// channel whose minimum severity the message reaches, at most RateLimit
+// messages per channel and minute.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/i18n"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultQueueSize = 256
+	defaultTimeout   = 10 * time.Second
+	defaultLocale    = "en-US"
+	rateWindow       = time.Minute
+)
+
+var (
+	delivered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_notifications_total",
+		Help: "Notifications by channel and result: sent, error or rate_limited.",
+	}, []string{"channel", "result"})
+
+	dropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blueprint_notifications_dropped_total",
+		Help: "Notifications lost because the queue was full or the notifier closed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(delivered, dropped)
+}
+
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Critical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	default:
+		return "critical"
+	}
+}
+
+// Message is what callers send, Key and Args are rendered by the Translator
+type Message struct {
+	Severity Severity
+	Key      string
+	Args     []interface{}
+	// Locale overrides Options.Locale, e.g. the account holder's language
+	Locale string
+	// Fields are added under the text, e.g. the account id or pod name
+	Fields map[string]string
+}
+
+// Notification is a rendered Message as channels get it
+type Notification struct {
+	Severity Severity
+	Subject  string
+	Text     string
+	Fields   map[string]string
+	Time     time.Time
+}
+
+// Body is the text with the fields below it, sorted by name
+func (n *Notification) Body() string {
+	if len(n.Fields) == 0 {
+		return n.Text
+	}
+	names := make([]string, 0, len(n.Fields))
+	for name := range n.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(n.Text)
+	b.WriteString("\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n%s: %s", name, n.Fields[name])
+	}
+	return b.String()
+}
+
+// Channel delivers a notification to one kind of destination
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
+
+type Options struct {
+	// Service prefixes every subject, e.g. "[blueprint]"
+	Service    string
+	Locale     string
+	Translator i18n.Translator
+	// RateLimit is the most messages a channel sends per minute, 0 is
+	// unlimited. Alerts beyond it are dropped, a storm of them is one
+	// incident and the first ones tell it.
+	RateLimit int
+	QueueSize int
+	Timeout   time.Duration
+	Clock     clock.Clock
+}
+
+type route struct {
+	channel Channel
+	min     Severity
+	window  time.Time
+	sent    int
+}
+
+// Notifier queues messages and delivers them from a background worker so
+// the alerting code path never waits on SMTP or a webhook
+type Notifier struct {
+	log    *logger.Logger
+	opts   Options
+	queue  chan *Notification
+	routes []*route
+
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+
+	health healthState
+}
+
+// NewNotifier adds the channels configured in cfg.Notify, nil when none is
+func NewNotifier(cfg *config.Config, log *logger.Logger, tr i18n.Translator, service string) *Notifier {
+	nc := cfg.Notify
+	if !nc.Enabled() {
+		return nil
+	}
+
+	n := NewNotifierWithOptions(log, Options{
+		Service:    "[" + service + "]",
+		Locale:     nc.Locale,
+		Translator: tr,
+		RateLimit:  nc.RateLimit,
+	})
+	if nc.SMTPAddr != "" {
+		n.Add(NewSMTPChannel(nc.SMTPAddr, nc.SMTPUser, nc.SMTPPassword, nc.SMTPFrom, nc.SMTPTo), Warning)
+	}
+	if nc.SlackWebhook != "" {
+		n.Add(NewSlackChannel(nc.SlackWebhook), Warning)
+	}
+	if nc.TelegramToken != "" {
+		n.Add(NewTelegramChannel(nc.TelegramToken, nc.TelegramChatID), Warning)
+	}
+	// texts cost money and wake people up
+	if nc.SMSURL != "" {
+		n.Add(NewSMSChannel(nc.SMSURL, nc.SMSToken, nc.SMSTo), Critical)
+	}
+	return n
+}
+
+func NewNotifierWithOptions(log *logger.Logger, opts Options) *Notifier {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Locale == "" {
+		opts.Locale = defaultLocale
+	}
+	opts.Clock = clock.Or(opts.Clock)
+
+	n := &Notifier{
+		log:   log,
+		opts:  opts,
+		queue: make(chan *Notification, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	run.Go(log, "notify", n.run)
+	return n
+}
+
+// Add routes messages of at least min severity to ch, call it before the
+// first Send
+func (n *Notifier) Add(ch Channel, min Severity) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.routes = append(n.routes, &route{channel: ch, min: min})
+}
+
+// Send renders msg and queues it, false when it was dropped
+func (n *Notifier) Send(msg Message) bool {
+	notification := n.render(msg)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		dropped.Inc()
+		return false
+	}
+	select {
+	case n.queue <- notification:
+		return true
+	default:
+		dropped.Inc()
+		return false
+	}
+}
+
+// Close delivers what is queued and stops the worker
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	close(n.queue)
+	n.mu.Unlock()
+
+	<-n.done
+	return nil
+}
+
+func (n *Notifier) render(msg Message) *Notification {
+	locale := msg.Locale
+	if locale == "" {
+		locale = n.opts.Locale
+	}
+
+	text := n.translate(locale, msg.Key, msg.Args)
+	subject := n.translate(locale, msg.Key+"_subject", msg.Args)
+	if subject == "" {
+		subject = msg.Key
+	}
+	if text == "" {
+		// no translation, still better than losing the alert
+		text = strings.TrimSpace(fmt.Sprintln(append([]interface{}{msg.Key}, msg.Args...)...))
+	}
+	if n.opts.Service != "" {
+		subject = n.opts.Service + " " + subject
+	}
+
+	return &Notification{
+		Severity: msg.Severity,
+		Subject:  subject,
+		Text:     text,
+		Fields:   msg.Fields,
+		Time:     n.opts.Clock.Now(),
+	}
+}
+
+func (n *Notifier) translate(locale, key string, args []interface{}) string {
+	if n.opts.Translator == nil {
+		return ""
+	}
+	return n.opts.Translator.Tr(locale, key, args...)
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+
+	for notification := range n.queue {
+		n.mu.Lock()
+		routes := n.routes
+		n.mu.Unlock()
+
+		for _, r := range routes {
+			if notification.Severity < r.min {
+				continue
+			}
+			if !n.allow(r) {
+				delivered.WithLabelValues(r.channel.Name(), "rate_limited").Inc()
+				continue
+			}
+			n.deliver(r.channel, notification)
+		}
+	}
+}
+
+func (n *Notifier) deliver(ch Channel, notification *Notification) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.opts.Timeout)
+	defer cancel()
+
+	if err := ch.Send(ctx, notification); err != nil {
+		delivered.WithLabelValues(ch.Name(), "error").Inc()
+		if n.log != nil {
+			n.log.Warnf("Notification %q via %s failed: %v", notification.Subject, ch.Name(), err)
+		}
+		return
+	}
+	delivered.WithLabelValues(ch.Name(), "sent").Inc()
+}
+
+// allow counts r against RateLimit in fixed one minute windows, only the
+// worker calls it
+func (n *Notifier) allow(r *route) bool {
+	if n.opts.RateLimit <= 0 {
+		return true
+	}
+	now := n.opts.Clock.Now()
+	if now.Sub(r.window) >= rateWindow {
+		r.window = now
+		r.sent = 0
+	}
+	if r.sent >= n.opts.RateLimit {
+		return false
+	}
+	r.sent++
+	return true
+}
@@ -0,0 +1,176 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/i18n"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordChannel struct {
+	name string
+	err  error
+
+	mu   sync.Mutex
+	sent []*Notification
+}
+
+func (c *recordChannel) Name() string { return c.name }
+
+func (c *recordChannel) Send(ctx context.Context, n *Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, n)
+	return c.err
+}
+
+func (c *recordChannel) Sent() []*Notification {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Notification(nil), c.sent...)
+}
+
+type mapTranslator map[string]string
+
+func (m mapTranslator) Tr(lang, key string, args ...interface{}) string {
+	if format, ok := m[lang+":"+key]; ok {
+		return fmt.Sprintf(format, args...)
+	}
+	return ""
+}
+
+func TestRoutesBySeverity(t *testing.T) {
+	n := NewNotifierWithOptions(nil, Options{})
+	chat := &recordChannel{name: "chat"}
+	sms := &recordChannel{name: "sms"}
+	n.Add(chat, Warning)
+	n.Add(sms, Critical)
+
+	n.Send(Message{Severity: Info, Key: "info"})
+	n.Send(Message{Severity: Warning, Key: "warning"})
+	n.Send(Message{Severity: Critical, Key: "critical"})
+	require.NoError(t, n.Close())
+
+	assert.Len(t, chat.Sent(), 2)
+	require.Len(t, sms.Sent(), 1)
+	assert.Equal(t, "critical", sms.Sent()[0].Subject)
+}
+
+func TestRendersLocalizedText(t *testing.T) {
+	tr := mapTranslator{
+		"en-US:margin_call":         "Account %s at %s%%",
+		"en-US:margin_call_subject": "Margin call %[1]s",
+		"zh-CN:margin_call":         "账户 %s 保证金 %s%%",
+	}
+	n := NewNotifierWithOptions(nil, Options{Service: "[blueprint]", Translator: tr})
+	ch := &recordChannel{name: "chat"}
+	n.Add(ch, Info)
+
+	n.Send(Message{Severity: Critical, Key: "margin_call", Args: []interface{}{"A1", "80"}, Fields: map[string]string{"pod": "p-1"}})
+	n.Send(Message{Severity: Critical, Key: "margin_call", Args: []interface{}{"A2", "75"}, Locale: "zh-CN"})
+	n.Send(Message{Severity: Critical, Key: "unknown_key", Args: []interface{}{"x"}})
+	require.NoError(t, n.Close())
+
+	sent := ch.Sent()
+	require.Len(t, sent, 3)
+	assert.Equal(t, "[blueprint] Margin call A1", sent[0].Subject)
+	assert.Equal(t, "Account A1 at 80%\n\npod: p-1", sent[0].Body())
+	assert.Equal(t, "账户 A2 保证金 75%", sent[1].Text)
+	assert.Equal(t, "[blueprint] margin_call", sent[1].Subject, "no translated subject falls back to the key")
+	assert.Equal(t, "unknown_key x", sent[2].Text)
+}
+
+func TestI18nTemplates(t *testing.T) {
+	local, err := i18n.New(&config.Config{Setting: config.Setting{LocalPath: "../i18n/locales/*/*"}})
+	require.NoError(t, err)
+	n := NewNotifierWithOptions(nil, Options{Translator: local})
+
+	got := n.render(Message{Key: "health_check_failed", Args: []interface{}{"postgres", "connection refused"}})
+	assert.Equal(t, "Readiness check postgres failing", got.Subject)
+	assert.Equal(t, "Readiness check postgres is failing, the pod is out of rotation: connection refused", got.Text)
+	require.NoError(t, n.Close())
+}
+
+func TestRateLimitPerChannel(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	n := NewNotifierWithOptions(nil, Options{RateLimit: 2, Clock: fake})
+	ch := &recordChannel{name: "chat"}
+	n.Add(ch, Info)
+
+	limited := testutil.ToFloat64(delivered.WithLabelValues("chat", "rate_limited"))
+	for i := 0; i < 5; i++ {
+		n.Send(Message{Key: "storm"})
+	}
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(delivered.WithLabelValues("chat", "rate_limited")) == limited+3
+	}, time.Second, time.Millisecond)
+	fake.Advance(time.Minute)
+	n.Send(Message{Key: "later"})
+	require.NoError(t, n.Close())
+
+	sent := ch.Sent()
+	require.Len(t, sent, 3)
+	assert.Equal(t, "later", sent[2].Subject)
+}
+
+func TestChannelErrorsDoNotStopOthers(t *testing.T) {
+	n := NewNotifierWithOptions(nil, Options{})
+	broken := &recordChannel{name: "broken", err: errors.New("down")}
+	ok := &recordChannel{name: "ok"}
+	n.Add(broken, Info)
+	n.Add(ok, Info)
+
+	n.Send(Message{Key: "alert"})
+	require.NoError(t, n.Close())
+	assert.Len(t, ok.Sent(), 1)
+
+	assert.False(t, n.Send(Message{Key: "after close"}))
+}
+
+func TestObserveCheckAlertsOnTransitions(t *testing.T) {
+	n := NewNotifierWithOptions(nil, Options{})
+	ch := &recordChannel{name: "chat"}
+	n.Add(ch, Info)
+
+	n.ObserveCheck("redis", nil)
+	n.ObserveCheck("redis", errors.New("dial tcp: refused"))
+	n.ObserveCheck("redis", errors.New("dial tcp: refused"))
+	n.ObserveCheck("postgres", nil)
+	n.ObserveCheck("redis", nil)
+	require.NoError(t, n.Close())
+
+	sent := ch.Sent()
+	require.Len(t, sent, 2)
+	assert.Equal(t, Critical, sent[0].Severity)
+	assert.Equal(t, "health_check_failed redis dial tcp: refused", sent[0].Text)
+	assert.Equal(t, Warning, sent[1].Severity)
+	assert.Equal(t, "health_check_recovered", sent[1].Subject)
+}
+
+func TestNewNotifierFromConfig(t *testing.T) {
+	assert.Nil(t, NewNotifier(&config.Config{}, nil, nil, "blueprint"))
+
+	n := NewNotifier(&config.Config{Notify: config.Notify{
+		SlackWebhook: "https://hooks.slack.example/x",
+		SMSURL:       "https://sms.example/send",
+		SMSTo:        []string{"+100"},
+	}}, nil, nil, "blueprint")
+	require.NotNil(t, n)
+	defer n.Close()
+
+	require.Len(t, n.routes, 2)
+	assert.Equal(t, "slack", n.routes[0].channel.Name())
+	assert.Equal(t, Warning, n.routes[0].min)
+	assert.Equal(t, "sms", n.routes[1].channel.Name())
+	assert.Equal(t, Critical, n.routes[1].min)
+}
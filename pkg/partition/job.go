@@ -0,0 +1,129 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package partition
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/db"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/specs"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultInterval = time.Hour
+
+	// lockName keeps replicas from racing on the same DDL
+	lockName = "blueprint:partition"
+)
+
+var (
+	partitionChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_partition_checks_total",
+		Help: "Partition create statements by parent table and result, ok or error. Existing partitions count as ok.",
+	}, []string{"table", "result"})
+
+	partitionsReadyUntil = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_partition_ready_until_timestamp_seconds",
+		Help: "End of the last partition known to exist per parent table, alert when it gets close.",
+	}, []string{"table"})
+)
+
+func init() {
+	prometheus.MustRegister(partitionChecks, partitionsReadyUntil)
+}
+
+// execer is the part of *sql.DB a Job needs
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type Options struct {
+	Policies []Policy
+	// Interval between checks, well below the shortest period
+	Interval time.Duration
+	Clock    clock.Clock
+}
+
+// Job creates the partitions of its policies on Start and every Interval
+// after. Only one replica runs the DDL at a time, the others skip while a
+// postgres advisory lock is held.
+type Job struct {
+	*db.Periodic
+	exec execer
+	opts Options
+}
+
+// NewJob returns nil when cfg has no policies
+func NewJob(cfg *config.Config, sqlDB *sql.DB, log *logger.Logger) (*Job, error) {
+	if len(cfg.Partition.Policies) == 0 {
+		return nil, nil
+	}
+	policies, err := specs.ParseAll(cfg.Partition.Policies, ParsePolicy)
+	if err != nil {
+		return nil, err
+	}
+	return NewJobWithOptions(sqlDB, log, Options{
+		Policies: policies,
+		Interval: cfg.Partition.Interval,
+	}), nil
+}
+
+func NewJobWithOptions(sqlDB *sql.DB, log *logger.Logger, opts Options) *Job {
+	return newJob(sqlDB, log, opts, db.AdvisoryLocker(sqlDB, lockName))
+}
+
+func newJob(exec execer, log *logger.Logger, opts Options, lock db.LockFunc) *Job {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	opts.Clock = clock.Or(opts.Clock)
+	j := &Job{exec: exec, opts: opts}
+	j.Periodic = db.NewPeriodic(log, db.PeriodicOptions{
+		Name:     "partition",
+		Interval: opts.Interval,
+		Lock:     lock,
+		Clock:    opts.Clock,
+	}, j.ensureAll)
+	return j
+}
+
+// Start creates the partitions right away, inserts fail without them, and
+// keeps checking in the background until Stop
+func (j *Job) Start(ctx context.Context) {
+	j.Run(ctx)
+	j.Periodic.Start()
+}
+
+// ensureAll creates the missing partitions of every policy, a failing
+// table does not stop the others
+func (j *Job) ensureAll(ctx context.Context) error {
+	var firstErr error
+	for _, p := range j.opts.Policies {
+		if err := j.ensure(ctx, p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ensure stops at the first failure, later partitions would leave a gap
+func (j *Job) ensure(ctx context.Context, p Policy) error {
+	for _, from := range p.Upcoming(j.opts.Clock.Now()) {
+		if _, err := j.exec.ExecContext(ctx, p.CreateSQL(from)); err != nil {
+			partitionChecks.WithLabelValues(p.Table, "error").Inc()
+			return fmt.Errorf("partition %s: %w", p.Name(from), err)
+		}
+		partitionChecks.WithLabelValues(p.Table, "ok").Inc()
+
+		_, to := p.Bounds(from)
+		partitionsReadyUntil.WithLabelValues(p.Table).Set(float64(to.Unix()))
+	}
+	return nil
+}
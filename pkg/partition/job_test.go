@@ -0,0 +1,85 @@
+package partition
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDB struct {
+	mu      sync.Mutex
+	queries []string
+	fail    string
+}
+
+func (f *fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, query)
+	if f.fail != "" && strings.Contains(query, f.fail) {
+		return nil, errors.New("permission denied")
+	}
+	return driver.ResultNoRows, nil
+}
+
+func (f *fakeDB) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.queries)
+}
+
+func TestRunOnceCreatesUpcoming(t *testing.T) {
+	fake := &fakeDB{fail: "platform_tick_p20240302"}
+	j := newJob(fake, nil, Options{
+		Policies: []Policy{
+			{Table: "platform_tick", Period: Daily, Ahead: 3},
+			{Table: "platform_candle", Period: Monthly, Ahead: 1},
+		},
+		Clock: clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)),
+	}, nil)
+
+	err := j.RunOnce(context.Background())
+	assert.ErrorContains(t, err, "partition platform_tick_p20240302: permission denied")
+	require.Len(t, fake.queries, 4, "the tick partitions stop at the failure, the candle ones still run")
+	assert.Contains(t, fake.queries[2], "platform_candle_p202403")
+	assert.Contains(t, fake.queries[3], "platform_candle_p202404")
+}
+
+func TestRunOnceSkipsWithoutLock(t *testing.T) {
+	fake := &fakeDB{}
+	j := newJob(fake, nil, Options{Policies: []Policy{{Table: "platform_tick", Period: Daily}}}, func(ctx context.Context) (func(), bool, error) { return nil, false, nil })
+
+	require.NoError(t, j.RunOnce(context.Background()))
+	assert.Empty(t, fake.queries, "another replica holds the lock")
+}
+
+func TestStartCreatesRightAway(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	fake := &fakeDB{}
+	j := newJob(fake, nil, Options{
+		Policies: []Policy{{Table: "platform_tick", Period: Daily, Ahead: 1}},
+		Interval: time.Hour,
+		Clock:    clk,
+	}, nil)
+	j.Start(context.Background())
+	defer j.Stop()
+	assert.Equal(t, 2, fake.count(), "partitions exist before the first insert")
+
+	clk.BlockUntil(1)
+	clk.Advance(24 * time.Hour)
+	assert.Eventually(t, func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return strings.Contains(fake.queries[len(fake.queries)-1], "platform_tick_p20240303")
+	}, time.Second, time.Millisecond, "the next day's partition is added")
+}
@@ -0,0 +1,111 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package partition keeps time-range partitions of high volume postgres
+// tables ahead of the clock. The parent is created by a migration, e.g.
+//
+//	CREATE TABLE platform_tick (..., created_at timestamptz NOT NULL)
+//	PARTITION BY RANGE (created_at)
+//
+// and the Job adds the daily or monthly partitions for now and the next
+// few periods, named platform_tick_p20240301 or platform_tick_p202403.
+package partition
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Periods a partition covers, boundaries are UTC midnights
+const (
+	Daily   = "daily"
+	Monthly = "monthly"
+)
+
+const defaultAhead = 3
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Policy partitions Table by Period, keeping Ahead partitions after the
+// current one
+type Policy struct {
+	Table  string
+	Period string
+	Ahead  int
+}
+
+// ParsePolicy reads "table=daily|monthly[:ahead]", e.g.
+// "platform_tick=daily:7". Ahead defaults to 3.
+func ParsePolicy(spec string) (Policy, error) {
+	table, rest, ok := strings.Cut(spec, "=")
+	if !ok {
+		return Policy{}, fmt.Errorf("partition %q: want table=daily|monthly[:ahead]", spec)
+	}
+	for _, part := range strings.Split(table, ".") {
+		if !identifier.MatchString(part) {
+			return Policy{}, fmt.Errorf("partition %q: invalid table %q", spec, table)
+		}
+	}
+
+	period, aheadSpec, hasAhead := strings.Cut(rest, ":")
+	if period != Daily && period != Monthly {
+		return Policy{}, fmt.Errorf("partition %q: period %q is neither daily nor monthly", spec, period)
+	}
+
+	p := Policy{Table: table, Period: period, Ahead: defaultAhead}
+	if hasAhead {
+		ahead, err := strconv.Atoi(aheadSpec)
+		if err != nil || ahead < 0 {
+			return Policy{}, fmt.Errorf("partition %q: invalid ahead %q", spec, aheadSpec)
+		}
+		p.Ahead = ahead
+	}
+	return p, nil
+}
+
+// Bounds is the period of p holding t, from inclusive and to exclusive
+func (p Policy) Bounds(t time.Time) (from, to time.Time) {
+	t = t.UTC()
+	if p.Period == Monthly {
+		from = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 1, 0)
+	}
+	from = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 0, 1)
+}
+
+// Name is the partition of p starting at from, in the parent's schema
+func (p Policy) Name(from time.Time) string {
+	layout := "20060102"
+	if p.Period == Monthly {
+		layout = "200601"
+	}
+	return p.Table + "_p" + from.UTC().Format(layout)
+}
+
+// Upcoming are the start times of the partitions that should exist at
+// now: the current one and Ahead more
+func (p Policy) Upcoming(now time.Time) []time.Time {
+	from, _ := p.Bounds(now)
+	starts := make([]time.Time, 0, p.Ahead+1)
+	for i := 0; i <= p.Ahead; i++ {
+		starts = append(starts, from)
+		_, from = p.Bounds(from)
+	}
+	return starts
+}
+
+// CreateSQL creates the partition starting at from unless it exists
+func (p Policy) CreateSQL(from time.Time) string {
+	from, to := p.Bounds(from)
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		quote(p.Name(from)), quote(p.Table), from.Format(time.RFC3339), to.Format(time.RFC3339))
+}
+
+func quote(name string) string {
+	return pgx.Identifier(strings.Split(name, ".")).Sanitize()
+}
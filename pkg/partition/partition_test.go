@@ -0,0 +1,53 @@
+package partition
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("platform_tick=daily:7")
+	require.NoError(t, err)
+	assert.Equal(t, Policy{Table: "platform_tick", Period: Daily, Ahead: 7}, p)
+
+	p, err = ParsePolicy("market.platform_candle=monthly")
+	require.NoError(t, err)
+	assert.Equal(t, Policy{Table: "market.platform_candle", Period: Monthly, Ahead: 3}, p)
+
+	for _, bad := range []string{"platform_tick", "platform_tick=weekly", "platform_tick=daily:-1", "platform tick=daily", "=daily"} {
+		_, err := ParsePolicy(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestUpcomingMonthly(t *testing.T) {
+	p := Policy{Table: "platform_candle", Period: Monthly, Ahead: 2}
+	now := time.Date(2024, 11, 30, 23, 59, 0, 0, time.UTC)
+
+	var names []string
+	for _, from := range p.Upcoming(now) {
+		names = append(names, p.Name(from))
+	}
+	assert.Equal(t, []string{"platform_candle_p202411", "platform_candle_p202412", "platform_candle_p202501"}, names, "crosses the year")
+}
+
+func TestUpcomingDailyUsesUTC(t *testing.T) {
+	p := Policy{Table: "platform_tick", Period: Daily, Ahead: 1}
+	// 01:00 on March 1st in UTC+3 is still February 29th in UTC
+	now := time.Date(2024, 3, 1, 1, 0, 0, 0, time.FixedZone("UTC+3", 3*3600))
+
+	starts := p.Upcoming(now)
+	require.Len(t, starts, 2)
+	assert.Equal(t, "platform_tick_p20240229", p.Name(starts[0]))
+	assert.Equal(t, "platform_tick_p20240301", p.Name(starts[1]))
+}
+
+func TestCreateSQL(t *testing.T) {
+	p := Policy{Table: "market.platform_tick", Period: Daily}
+	assert.Equal(t,
+		`CREATE TABLE IF NOT EXISTS "market"."platform_tick_p20240229" PARTITION OF "market"."platform_tick" FOR VALUES FROM ('2024-02-29T00:00:00Z') TO ('2024-03-01T00:00:00Z')`,
+		p.CreateSQL(time.Date(2024, 2, 29, 15, 0, 0, 0, time.UTC)))
+}
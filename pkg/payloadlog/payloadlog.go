@@ -0,0 +1,187 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package payloadlog
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"time"
+	"unicode/utf8"
+
+	"blueprint/config"
+	"blueprint/pkg/grpcmethod"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/redact"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultMaxBytes = 4096
+	// logged instead of a payload the redaction failed on
+	unredactable = "<unredactable>"
+)
+
+var defaultRedactFields = []string{"password", "token", "secret", "authorization", "api_key"}
+
+// Options decide which calls get their payloads logged. A call is logged
+// when its method is listed in Methods or it falls in the SampleRate share
+// of the remaining traffic.
+type Options struct {
+	// SampleRate between 0 and 1
+	SampleRate float64
+	// Methods are always logged, as full method "/pkg.Service/Method",
+	// service "pkg.Service" or bare method name "Method"
+	Methods []string
+	// RedactFields are proto field names replaced at any depth, case insensitive
+	RedactFields []string
+	// MaxBytes truncates each payload, 0 uses the default
+	MaxBytes int
+}
+
+type Logger struct {
+	log    *logger.Logger
+	opts   Options
+	redact redact.Fields
+	sample func() float64
+}
+
+func NewLogger(cfg *config.Config, log *logger.Logger) *Logger {
+	return NewLoggerWithOptions(log, Options{
+		SampleRate:   cfg.PayloadLog.SampleRate,
+		Methods:      cfg.PayloadLog.Methods,
+		RedactFields: cfg.PayloadLog.RedactFields,
+		MaxBytes:     cfg.PayloadLog.MaxBytes,
+	})
+}
+
+func NewLoggerWithOptions(log *logger.Logger, opts Options) *Logger {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if opts.RedactFields == nil {
+		opts.RedactFields = defaultRedactFields
+	}
+
+	return &Logger{
+		log:    log,
+		opts:   opts,
+		redact: redact.NewFields(opts.RedactFields...),
+		sample: rand.Float64,
+	}
+}
+
+// Enabled is false when nothing would ever be logged, leave the
+// interceptors out of the chain then
+func (l *Logger) Enabled() bool {
+	return l.opts.SampleRate > 0 || len(l.opts.Methods) > 0
+}
+
+// UnaryServerInterceptor must run after the ctxmeta interceptor, the method,
+// request and trace id on each line come from there
+func (l *Logger) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !l.shouldLog(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		fields := map[string]interface{}{
+			"grpc_code":   status.Code(err).String(),
+			"duration_ms": time.Since(start).Milliseconds(),
+			"request":     l.encode(req),
+		}
+		if err == nil {
+			fields["response"] = l.encode(resp)
+		}
+		l.log.WithContext(ctx).WithFields(fields).Info("gRPC payload")
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs every message sent and received on a sampled stream
+func (l *Logger) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !l.shouldLog(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		log := l.log.WithContext(ss.Context())
+		err := handler(srv, &loggedStream{ServerStream: ss, l: l, log: log})
+		log.WithField("grpc_code", status.Code(err).String()).Info("gRPC stream closed")
+		return err
+	}
+}
+
+type loggedStream struct {
+	grpc.ServerStream
+	l   *Logger
+	log *logger.Logger
+}
+
+func (s *loggedStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.log.WithField("request", s.l.encode(m)).Info("gRPC stream recv")
+	}
+	return err
+}
+
+func (s *loggedStream) SendMsg(m interface{}) error {
+	s.log.WithField("response", s.l.encode(m)).Info("gRPC stream send")
+	return s.ServerStream.SendMsg(m)
+}
+
+func (l *Logger) shouldLog(fullMethod string) bool {
+	if grpcmethod.MatchAny(l.opts.Methods, fullMethod) {
+		return true
+	}
+	return l.opts.SampleRate > 0 && l.sample() < l.opts.SampleRate
+}
+
+// encode renders msg as JSON with proto field names, redacted and truncated
+func (l *Logger) encode(msg interface{}) string {
+	pm, ok := msg.(proto.Message)
+	if !ok {
+		return ""
+	}
+
+	raw, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(pm)
+	if err != nil {
+		return "<unmarshalable: " + err.Error() + ">"
+	}
+
+	return l.render(raw)
+}
+
+// render redacts and truncates raw JSON. A payload that can't be redacted
+// is left out rather than logged in the clear, the truncation keeps whole
+// runes so the line stays valid UTF-8.
+func (l *Logger) render(raw []byte) string {
+	if len(l.redact) > 0 {
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return unredactable
+		}
+		out, err := json.Marshal(redact.Value(v, l.redact))
+		if err != nil {
+			return unredactable
+		}
+		raw = out
+	}
+
+	if len(raw) > l.opts.MaxBytes {
+		cut := l.opts.MaxBytes
+		for cut > 0 && !utf8.RuneStart(raw[cut]) {
+			cut--
+		}
+		return string(raw[:cut]) + "...(truncated)"
+	}
+	return string(raw)
+}
@@ -0,0 +1,99 @@
+package payloadlog
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"blueprint/config"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/testsupport"
+	pb "blueprint/proto/blueprint"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func call(t *testing.T, l *Logger, method string, req interface{}) {
+	t.Helper()
+	ctx := ctxmeta.WithRequestID(context.Background(), "req-1")
+	_, err := l.UnaryServerInterceptor()(ctx, req, &grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &pb.CallResponse{Msg: "Hello"}, nil
+		})
+	require.NoError(t, err)
+}
+
+func TestMethodsAreAlwaysLogged(t *testing.T) {
+	log, logs := testsupport.Logger(t)
+	l := NewLoggerWithOptions(log, Options{Methods: []string{"Call"}})
+
+	call(t, l, "/blueprint.Blueprint/Call", &pb.CallRequest{Name: "value"})
+	call(t, l, "/blueprint.Blueprint/Other", &pb.CallRequest{Name: "skip"})
+
+	entries := logs.Entries(t)
+	require.Len(t, entries, 1)
+	assert.Equal(t, `{"name":"value"}`, entries[0]["request"])
+	assert.Equal(t, `{"msg":"Hello"}`, entries[0]["response"])
+	assert.Equal(t, "OK", entries[0]["grpc_code"])
+	assert.Equal(t, "req-1", entries[0]["request_id"])
+}
+
+func TestSampling(t *testing.T) {
+	log, logs := testsupport.Logger(t)
+	l := NewLoggerWithOptions(log, Options{SampleRate: 0.5})
+
+	draws := []float64{0.1, 0.9, 0.4}
+	l.sample = func() float64 {
+		v := draws[0]
+		draws = draws[1:]
+		return v
+	}
+
+	for i := 0; i < 3; i++ {
+		call(t, l, "/blueprint.Blueprint/Call", &pb.CallRequest{Name: "value"})
+	}
+	assert.Len(t, logs.Entries(t), 2)
+}
+
+func TestRedactionAndTruncation(t *testing.T) {
+	log, _ := testsupport.Logger(t)
+	l := NewLoggerWithOptions(log, Options{Methods: []string{"Call"}, MaxBytes: 80})
+
+	req, err := structpb.NewStruct(map[string]interface{}{
+		"user":  map[string]interface{}{"name": "bob", "Password": "hunter2"},
+		"items": []interface{}{map[string]interface{}{"token": "abc"}},
+	})
+	require.NoError(t, err)
+
+	out := l.encode(req)
+	assert.NotContains(t, out, "hunter2")
+	assert.NotContains(t, out, "abc")
+	assert.Contains(t, out, `"Password":"[REDACTED]"`)
+
+	long := l.encode(&pb.CallRequest{Name: strings.Repeat("x", 200)})
+	assert.True(t, strings.HasSuffix(long, "...(truncated)"))
+	assert.Len(t, long, 80+len("...(truncated)"))
+
+	// {"name":" is 9 bytes, the 80th byte is in the middle of an é
+	wide := l.encode(&pb.CallRequest{Name: strings.Repeat("é", 100)})
+	assert.True(t, utf8.ValidString(wide), wide)
+	assert.Equal(t, `{"name":"`+strings.Repeat("é", 35)+"...(truncated)", wide)
+}
+
+func TestRedactionFailsClosed(t *testing.T) {
+	log, _ := testsupport.Logger(t)
+	l := NewLoggerWithOptions(log, Options{Methods: []string{"Call"}})
+	assert.Equal(t, unredactable, l.render([]byte(`{"password":"hunter2"`)))
+
+	l = NewLoggerWithOptions(log, Options{Methods: []string{"Call"}, RedactFields: []string{}})
+	assert.Equal(t, `{"password":"hunter2"`, l.render([]byte(`{"password":"hunter2"`)), "nothing to redact")
+}
+
+func TestDisabledByDefault(t *testing.T) {
+	log, _ := testsupport.Logger(t)
+	assert.False(t, NewLogger(&config.Config{}, log).Enabled())
+}
@@ -0,0 +1,199 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package pooltune grows a connection pool while callers wait for
+// connections and shrinks it back once it sits mostly idle, within fixed
+// bounds. The redis and SQL pools plug in through Pool.
+package pooltune
+
+import (
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultInterval    = 10 * time.Second
+	defaultShrinkAfter = 6
+)
+
+var (
+	poolSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_pool_size",
+		Help: "Current connection pool size set by the tuner.",
+	}, []string{"pool"})
+
+	poolResizes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_pool_resizes_total",
+		Help: "Connection pool size changes by direction (grow, shrink).",
+	}, []string{"pool", "direction"})
+)
+
+func init() {
+	prometheus.MustRegister(poolSize, poolResizes)
+}
+
+// Stats is a pool sample, WaitCount and Timeouts are running totals
+type Stats struct {
+	Size      int
+	InUse     int
+	WaitCount int64
+	Timeouts  int64
+}
+
+type Pool interface {
+	Stats() Stats
+	Resize(size int)
+}
+
+type Options struct {
+	// Name labels metrics and logs, e.g. redis or postgres
+	Name string
+	Min  int
+	Max  int
+	// Interval between samples, 10s by default
+	Interval time.Duration
+	// Step is how much the size changes at once, a quarter of the current
+	// size (at least 1) when 0
+	Step int
+	// ShrinkAfter is how many samples in a row without waits and with at
+	// most half the pool in use it takes to shrink, 6 by default
+	ShrinkAfter int
+	Logger      *logger.Logger
+	Clock       clock.Clock
+}
+
+// Tuner resizes one pool, grow on any wait or timeout since the last
+// sample and shrink only after a calm streak so bursts do not flap it
+type Tuner struct {
+	pool Pool
+	opts Options
+
+	last  Stats
+	calm  int
+	stop  chan struct{}
+	done  chan struct{}
+	close sync.Once
+}
+
+func New(pool Pool, opts Options) *Tuner {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.ShrinkAfter <= 0 {
+		opts.ShrinkAfter = defaultShrinkAfter
+	}
+	if opts.Min < 1 {
+		opts.Min = 1
+	}
+	if opts.Max < opts.Min {
+		opts.Max = opts.Min
+	}
+	opts.Clock = clock.Or(opts.Clock)
+	return &Tuner{pool: pool, opts: opts}
+}
+
+// Start clamps the pool into bounds and samples it until Stop
+func (t *Tuner) Start() {
+	t.last = t.pool.Stats()
+	if size := t.clamp(t.last.Size); size != t.last.Size {
+		t.resize(t.last.Size, size, "bounds")
+	} else {
+		poolSize.WithLabelValues(t.opts.Name).Set(float64(size))
+	}
+
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	ticker := t.opts.Clock.NewTicker(t.opts.Interval)
+	run.Go(t.opts.Logger, "pooltune_"+t.opts.Name, func() {
+		defer close(t.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C():
+				t.sample()
+			}
+		}
+	})
+}
+
+func (t *Tuner) Stop() {
+	if t.stop == nil {
+		return
+	}
+	t.close.Do(func() {
+		close(t.stop)
+		<-t.done
+	})
+}
+
+// sample compares the pool with the previous sample and resizes it
+func (t *Tuner) sample() {
+	s := t.pool.Stats()
+	waited := s.WaitCount > t.last.WaitCount || s.Timeouts > t.last.Timeouts
+	t.last = s
+
+	switch {
+	case waited:
+		t.calm = 0
+		if size := t.clamp(s.Size + t.step(s.Size)); size > s.Size {
+			t.resize(s.Size, size, "waits")
+		}
+	case s.InUse <= s.Size/2:
+		t.calm++
+		if t.calm < t.opts.ShrinkAfter {
+			return
+		}
+		t.calm = 0
+		if size := t.clamp(s.Size - t.step(s.Size)); size < s.Size {
+			t.resize(s.Size, size, "idle")
+		}
+	default:
+		t.calm = 0
+	}
+}
+
+func (t *Tuner) resize(from, to int, reason string) {
+	t.pool.Resize(to)
+	t.last.Size = to
+	poolSize.WithLabelValues(t.opts.Name).Set(float64(to))
+
+	direction := "grow"
+	if to < from {
+		direction = "shrink"
+	}
+	poolResizes.WithLabelValues(t.opts.Name, direction).Inc()
+	if t.opts.Logger != nil {
+		t.opts.Logger.Infow("Connection pool resized",
+			"pool", t.opts.Name,
+			"from", from,
+			"to", to,
+			"reason", reason)
+	}
+}
+
+func (t *Tuner) step(size int) int {
+	if t.opts.Step > 0 {
+		return t.opts.Step
+	}
+	if step := size / 4; step > 1 {
+		return step
+	}
+	return 1
+}
+
+func (t *Tuner) clamp(size int) int {
+	if size < t.opts.Min {
+		return t.opts.Min
+	}
+	if size > t.opts.Max {
+		return t.opts.Max
+	}
+	return size
+}
@@ -0,0 +1,93 @@
+package pooltune
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePool struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+func (p *fakePool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+func (p *fakePool) Resize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Size = size
+}
+
+func (p *fakePool) set(fn func(s *Stats)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(&p.stats)
+}
+
+func TestTunerGrowsOnWaits(t *testing.T) {
+	poolSize.Reset()
+	poolResizes.Reset()
+	pool := &fakePool{stats: Stats{Size: 8, InUse: 8}}
+	tuner := New(pool, Options{Name: "grow", Min: 4, Max: 12})
+	tuner.last = pool.Stats()
+
+	pool.set(func(s *Stats) { s.WaitCount = 3 })
+	tuner.sample()
+	assert.Equal(t, 10, pool.Stats().Size, "grows by a quarter")
+
+	pool.set(func(s *Stats) { s.Timeouts = 1 })
+	tuner.sample()
+	assert.Equal(t, 12, pool.Stats().Size)
+
+	pool.set(func(s *Stats) { s.WaitCount = 9 })
+	tuner.sample()
+	assert.Equal(t, 12, pool.Stats().Size, "capped at Max")
+
+	assert.Equal(t, 12.0, testutil.ToFloat64(poolSize.WithLabelValues("grow")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(poolResizes.WithLabelValues("grow", "grow")))
+}
+
+func TestTunerShrinksAfterCalmStreak(t *testing.T) {
+	pool := &fakePool{stats: Stats{Size: 10, InUse: 2}}
+	tuner := New(pool, Options{Name: "shrink", Min: 9, Max: 20, Step: 2, ShrinkAfter: 3})
+	tuner.last = pool.Stats()
+
+	tuner.sample()
+	tuner.sample()
+	pool.set(func(s *Stats) { s.InUse = 8 })
+	tuner.sample()
+	assert.Equal(t, 10, pool.Stats().Size, "a busy sample resets the streak")
+
+	pool.set(func(s *Stats) { s.InUse = 1 })
+	for i := 0; i < 3; i++ {
+		tuner.sample()
+	}
+	assert.Equal(t, 9, pool.Stats().Size, "floored at Min")
+}
+
+func TestTunerStartClampsAndStops(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pool := &fakePool{stats: Stats{Size: 100}}
+	tuner := New(pool, Options{Name: "start", Min: 5, Max: 50, Interval: time.Second, Clock: fake})
+
+	tuner.Start()
+	assert.Equal(t, 50, pool.Stats().Size)
+
+	pool.set(func(s *Stats) { s.WaitCount = 1; s.Size = 40 })
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	assert.Eventually(t, func() bool { return pool.Stats().Size == 50 }, time.Second, time.Millisecond)
+
+	tuner.Stop()
+	tuner.Stop()
+}
@@ -0,0 +1,267 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package projection keeps read models up to date from the event bus. A
+// Runner subscribes every registered Projection under its own group and
+// applies each event with the projection's position in one transaction of
+// a Store, skipping events applied before:
+//
+//	runner := projection.New(bus, pg.DB, log, projection.Options{})
+//	runner.Register(projection.Projection{
+//		Name:   "account_balances",
+//		Topics: []string{"orders"},
+//		Apply: func(ctx context.Context, e *eventbus.Event) error {
+//			var order Order
+//			if err := e.Decode(&order); err != nil {
+//				return err
+//			}
+//			return projection.Tx(ctx).Exec(`UPDATE account_balances SET reserved = reserved + ? WHERE account_id = ?`,
+//				order.Amount, order.AccountID).Error
+//		},
+//	})
+//	runner.Start(ctx)
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/eventbus"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultInterval  = 15 * time.Second
+	defaultRetention = 7 * 24 * time.Hour
+
+	// GroupPrefix starts the subscriber group of every projection
+	GroupPrefix = "projection:"
+)
+
+var (
+	applied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_projection_applied_total",
+		Help: "Events handled by projections, by projection, topic and result: applied, duplicate or error.",
+	}, []string{"projection", "topic", "result"})
+	lag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_projection_lag_seconds",
+		Help: "Age of the last event a projection applied from a topic when it was applied.",
+	}, []string{"projection", "topic"})
+	position = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_projection_position_timestamp_seconds",
+		Help: "Unix time the last event a projection applied from a topic occurred at; time() minus it grows while the projection stalls.",
+	}, []string{"projection", "topic"})
+)
+
+func init() {
+	prometheus.MustRegister(applied, lag, position)
+}
+
+// Projection derives a read model from the events of Topics
+type Projection struct {
+	Name   string
+	Topics []string
+	// Apply updates the read model from e, inside the store's transaction
+	// (Tx or Pipe). An error rolls the change back and the bus delivers e
+	// again, up to its dead letters.
+	Apply func(ctx context.Context, e *eventbus.Event) error
+	// Reset empties the read model before a rebuild, optional
+	Reset func(ctx context.Context) error
+}
+
+type Options struct {
+	// Interval between refreshes of the position metrics and prunes of
+	// applied ids
+	Interval time.Duration
+	// Retention is how long applied ids are kept to skip redeliveries, 7d
+	// by default. It has to outlast the bus' redeliveries.
+	Retention time.Duration
+	Clock     clock.Clock
+}
+
+// Runner applies the events of its projections and tracks their positions
+type Runner struct {
+	bus   eventbus.Bus
+	store Store
+	log   *logger.Logger
+	opts  Options
+
+	mu          sync.RWMutex
+	projections map[string]Projection
+	started     bool
+
+	cancel context.CancelFunc
+	group  *run.Group
+}
+
+func New(bus eventbus.Bus, db *gorm.DB, log *logger.Logger, opts Options) *Runner {
+	return NewWithStore(bus, NewGormStore(db), log, opts)
+}
+
+func NewWithStore(bus eventbus.Bus, store Store, log *logger.Logger, opts Options) *Runner {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = defaultRetention
+	}
+	opts.Clock = clock.Or(opts.Clock)
+	return &Runner{bus: bus, store: store, log: log, opts: opts, projections: make(map[string]Projection)}
+}
+
+// Register adds p, before Start
+func (r *Runner) Register(p Projection) error {
+	if p.Name == "" || len(p.Topics) == 0 || p.Apply == nil {
+		return fmt.Errorf("projection %q: name, topics and apply are required", p.Name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started {
+		return fmt.Errorf("projection %s: register before Start", p.Name)
+	}
+	if _, ok := r.projections[p.Name]; ok {
+		return fmt.Errorf("projection %s: registered twice", p.Name)
+	}
+	r.projections[p.Name] = p
+	return nil
+}
+
+// Start subscribes every projection to its topics and refreshes the
+// metrics every Interval until Stop. New groups start at the end of the
+// stream, fill a new projection from history with eventbus.Backfill.
+func (r *Runner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	r.started = true
+	projections := make([]Projection, 0, len(r.projections))
+	for _, p := range r.projections {
+		projections = append(projections, p)
+	}
+	r.mu.Unlock()
+
+	r.refresh(ctx)
+	for _, p := range projections {
+		for _, topic := range p.Topics {
+			if err := r.bus.Subscribe(ctx, topic, GroupPrefix+p.Name, r.handler(p)); err != nil {
+				return fmt.Errorf("projection %s: %w", p.Name, err)
+			}
+		}
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.group = run.NewGroup(watchCtx, r.log)
+	r.group.Supervise("projection", r.run, run.Options{Clock: r.opts.Clock})
+	return nil
+}
+
+// Stop ends the metric refreshes, the subscriptions end with the bus
+func (r *Runner) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	if r.group != nil {
+		r.group.Wait()
+	}
+}
+
+func (r *Runner) handler(p Projection) eventbus.Handler {
+	return func(ctx context.Context, e *eventbus.Event) error {
+		now := r.opts.Clock.Now().UTC()
+		err := r.store.Apply(ctx, p.Name, e, now, func(ctx context.Context) error {
+			return p.Apply(ctx, e)
+		})
+		switch {
+		case errors.Is(err, ErrApplied):
+			applied.WithLabelValues(p.Name, e.Topic, "duplicate").Inc()
+			return nil
+		case err != nil:
+			applied.WithLabelValues(p.Name, e.Topic, "error").Inc()
+			return err
+		}
+		applied.WithLabelValues(p.Name, e.Topic, "applied").Inc()
+		lag.WithLabelValues(p.Name, e.Topic).Set(now.Sub(e.OccurredAt).Seconds())
+		position.WithLabelValues(p.Name, e.Topic).Set(float64(e.OccurredAt.UnixNano()) / 1e9)
+		return nil
+	}
+}
+
+// Positions reports where a projection is on each of its topics
+func (r *Runner) Positions(ctx context.Context, name string) ([]Position, error) {
+	return r.store.Positions(ctx, name)
+}
+
+// Reset empties a projection's read model and forgets its positions, so a
+// backfill of the history rebuilds it. Its events keep arriving meanwhile.
+func (r *Runner) Reset(ctx context.Context, name string) error {
+	r.mu.RLock()
+	p, ok := r.projections[name]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("projection %s: not registered", name)
+	}
+	if p.Reset != nil {
+		if err := p.Reset(ctx); err != nil {
+			return fmt.Errorf("projection %s: reset: %w", name, err)
+		}
+	}
+	if err := r.store.Reset(ctx, name); err != nil {
+		return fmt.Errorf("projection %s: reset: %w", name, err)
+	}
+	for _, topic := range p.Topics {
+		lag.DeleteLabelValues(name, topic)
+		position.DeleteLabelValues(name, topic)
+	}
+	return nil
+}
+
+func (r *Runner) run(ctx context.Context) error {
+	ticker := r.opts.Clock.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			r.refresh(ctx)
+		}
+	}
+}
+
+// refresh sets the position metrics from the store, so they are right
+// after a restart before any event arrived, and prunes old applied ids
+func (r *Runner) refresh(ctx context.Context) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.projections))
+	for name := range r.projections {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+
+	for _, name := range names {
+		positions, err := r.store.Positions(ctx, name)
+		if err != nil {
+			r.warn(ctx, "Reading projection positions failed: %v", err)
+			continue
+		}
+		for _, p := range positions {
+			position.WithLabelValues(name, p.Topic).Set(float64(p.OccurredAt.UnixNano()) / 1e9)
+		}
+	}
+	if _, err := r.store.Prune(ctx, r.opts.Clock.Now().Add(-r.opts.Retention)); err != nil {
+		r.warn(ctx, "Pruning applied projection events failed: %v", err)
+	}
+}
+
+func (r *Runner) warn(ctx context.Context, format string, args ...interface{}) {
+	if ctx.Err() == nil && r.log != nil {
+		r.log.Warnf(format, args...)
+	}
+}
@@ -0,0 +1,235 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	model "blueprint/model/blueprint"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/db"
+	"blueprint/pkg/eventbus"
+	"blueprint/pkg/testsupport"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// balances is a read model of order amounts by account
+type balances struct {
+	mu      sync.Mutex
+	amounts map[string]int
+	failOn  string
+}
+
+func (b *balances) apply(ctx context.Context, e *eventbus.Event) error {
+	var order struct {
+		Account string `json:"account"`
+		Amount  int    `json:"amount"`
+	}
+	if err := e.Decode(&order); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e.ID == b.failOn {
+		b.failOn = ""
+		return errors.New("read model unavailable")
+	}
+	b.amounts[order.Account] += order.Amount
+	return nil
+}
+
+func (b *balances) get(account string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.amounts[account]
+}
+
+func order(id, account string, amount int, at time.Time) *eventbus.Event {
+	return &eventbus.Event{ID: id, Type: "order.placed", OccurredAt: at, Data: []byte(fmt.Sprintf(`{"account":%q,"amount":%d}`, account, amount))}
+}
+
+func TestRunner(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	bus := eventbus.NewMemory(eventbus.Options{Redelivery: time.Millisecond})
+	defer bus.Close()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	read := &balances{amounts: make(map[string]int), failOn: "e-2"}
+
+	r := NewWithStore(bus, store, nil, Options{Clock: fake})
+	reset := false
+	require.NoError(t, r.Register(Projection{
+		Name: "balances", Topics: []string{"orders"}, Apply: read.apply,
+		Reset: func(ctx context.Context) error { reset = true; return nil },
+	}))
+	require.NoError(t, r.Start(ctx))
+	defer r.Stop()
+	assert.Error(t, r.Register(Projection{Name: "late", Topics: []string{"orders"}, Apply: read.apply}))
+
+	duplicates := testutil.ToFloat64(applied.WithLabelValues("balances", "orders", "duplicate"))
+	errs := testutil.ToFloat64(applied.WithLabelValues("balances", "orders", "error"))
+	at := fake.Now().Add(-time.Minute)
+	require.NoError(t, bus.Publish(ctx, "orders",
+		order("e-1", "A1", 5, at),
+		order("e-2", "A1", 7, at.Add(time.Second)),
+		order("e-1", "A1", 5, at), // redelivered by the producer
+	))
+
+	require.Eventually(t, func() bool {
+		positions, _ := r.Positions(ctx, "balances")
+		return len(positions) == 1 && positions[0].Applied == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 12, read.get("A1"), "the failed apply was retried, the duplicate skipped")
+	assert.Equal(t, duplicates+1, testutil.ToFloat64(applied.WithLabelValues("balances", "orders", "duplicate")))
+	assert.Equal(t, errs+1, testutil.ToFloat64(applied.WithLabelValues("balances", "orders", "error")))
+
+	positions, err := r.Positions(ctx, "balances")
+	require.NoError(t, err)
+	assert.Equal(t, "e-2", positions[0].EventID)
+	assert.Equal(t, at.Add(time.Second), positions[0].OccurredAt)
+	assert.Equal(t, 59.0, testutil.ToFloat64(lag.WithLabelValues("balances", "orders")))
+	assert.Equal(t, float64(at.Add(time.Second).Unix()), testutil.ToFloat64(position.WithLabelValues("balances", "orders")))
+
+	require.NoError(t, r.Reset(ctx, "balances"))
+	assert.True(t, reset)
+	positions, err = r.Positions(ctx, "balances")
+	require.NoError(t, err)
+	assert.Empty(t, positions)
+	assert.Error(t, r.Reset(ctx, "unknown"))
+}
+
+func TestRegister(t *testing.T) {
+	r := NewWithStore(nil, NewMemoryStore(), nil, Options{})
+	noop := func(context.Context, *eventbus.Event) error { return nil }
+	assert.Error(t, r.Register(Projection{Name: "no_topics", Apply: noop}))
+	assert.Error(t, r.Register(Projection{Name: "no_apply", Topics: []string{"orders"}}))
+	require.NoError(t, r.Register(Projection{Name: "ok", Topics: []string{"orders"}, Apply: noop}))
+	assert.Error(t, r.Register(Projection{Name: "ok", Topics: []string{"orders"}, Apply: noop}))
+}
+
+func TestPrune(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	bus := eventbus.NewMemory(eventbus.Options{})
+	defer bus.Close()
+	store := NewMemoryStore()
+	ctx := context.Background()
+	e := order("e-1", "A1", 1, fake.Now())
+	e.Topic = "orders"
+	noop := func(context.Context) error { return nil }
+	require.NoError(t, store.Apply(ctx, "balances", e, fake.Now(), noop))
+
+	r := NewWithStore(bus, store, nil, Options{Clock: fake, Interval: time.Minute, Retention: time.Hour})
+	require.NoError(t, r.Register(Projection{Name: "balances", Topics: []string{"orders"}, Apply: func(context.Context, *eventbus.Event) error { return nil }}))
+	require.NoError(t, r.Start(ctx))
+	defer r.Stop()
+	assert.Equal(t, float64(fake.Now().Unix()), testutil.ToFloat64(position.WithLabelValues("balances", "orders")), "set from the store on Start")
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Hour + time.Minute)
+	require.Eventually(t, func() bool {
+		return store.Apply(ctx, "balances", e, fake.Now(), noop) == nil
+	}, time.Second, time.Millisecond, "forgotten after Retention")
+}
+
+// storeContract runs against every Store, write records what fn wrote
+func storeContract(t *testing.T, store Store, write func(ctx context.Context, value string) error, read func() []string) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	e1 := &eventbus.Event{ID: "e-1", Topic: "orders", OccurredAt: now.Add(-time.Second)}
+	e2 := &eventbus.Event{ID: "e-2", Topic: "orders", OccurredAt: now}
+
+	require.NoError(t, store.Apply(ctx, "balances", e1, now, func(ctx context.Context) error { return write(ctx, "e-1") }))
+	err := store.Apply(ctx, "balances", e1, now, func(ctx context.Context) error { return write(ctx, "again") })
+	assert.ErrorIs(t, err, ErrApplied)
+
+	// a failing apply leaves neither the read model nor the position
+	err = store.Apply(ctx, "balances", e2, now, func(ctx context.Context) error {
+		if err := write(ctx, "half"); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	})
+	assert.ErrorContains(t, err, "boom")
+	assert.Equal(t, []string{"e-1"}, read())
+
+	require.NoError(t, store.Apply(ctx, "balances", e2, now, func(ctx context.Context) error { return write(ctx, "e-2") }))
+	assert.Equal(t, []string{"e-1", "e-2"}, read())
+	positions, err := store.Positions(ctx, "balances")
+	require.NoError(t, err)
+	assert.Equal(t, []Position{{Projection: "balances", Topic: "orders", EventID: "e-2", OccurredAt: now, Applied: 2, UpdatedAt: now}}, positions)
+
+	require.NoError(t, store.Reset(ctx, "balances"))
+	positions, err = store.Positions(ctx, "balances")
+	require.NoError(t, err)
+	assert.Empty(t, positions)
+	assert.NoError(t, store.Apply(ctx, "balances", e1, now, func(ctx context.Context) error { return nil }), "applies again after a reset")
+}
+
+func TestMemoryStore(t *testing.T) {
+	// the memory store has no transaction, fn fails before writing
+	var rows []string
+	storeContract(t, NewMemoryStore(), func(ctx context.Context, value string) error {
+		if value != "half" {
+			rows = append(rows, value)
+		}
+		return nil
+	}, func() []string { return rows })
+}
+
+type readModelRow struct {
+	Value string `gorm:"primaryKey"`
+}
+
+func (readModelRow) TableName() string { return "projection_test_rows" }
+
+func TestGormStore(t *testing.T) {
+	pg, err := db.NewPostgresDB(&config.Config{Postgres: testsupport.Postgres(t)}, nil)
+	require.NoError(t, err)
+	defer pg.Close()
+	for _, table := range []interface{}{&model.ProjectionPosition{}, &model.ProjectionEvent{}, &readModelRow{}} {
+		require.NoError(t, pg.DB.Migrator().DropTable(table))
+		require.NoError(t, pg.DB.AutoMigrate(table))
+	}
+
+	storeContract(t, NewGormStore(pg.DB), func(ctx context.Context, value string) error {
+		return Tx(ctx).Create(&readModelRow{Value: value}).Error
+	}, func() []string {
+		var values []string
+		require.NoError(t, pg.DB.Model(&readModelRow{}).Order("value").Pluck("value", &values).Error)
+		return values
+	})
+
+	n, err := NewGormStore(pg.DB).Prune(context.Background(), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	var left int64
+	require.NoError(t, pg.DB.Model(&model.ProjectionEvent{}).Count(&left).Error)
+	assert.Zero(t, left)
+}
+
+func TestRedisStore(t *testing.T) {
+	rdb := testsupport.Redis(t)
+	prefix := "test:" + t.Name() + ":"
+	list := prefix + "rows"
+	store := NewRedisStore(rdb, prefix, time.Hour)
+	t.Cleanup(func() { rdb.Del(context.Background(), list); store.Reset(context.Background(), "balances") })
+
+	storeContract(t, store, func(ctx context.Context, value string) error {
+		return Pipe(ctx).RPush(ctx, list, value).Err()
+	}, func() []string {
+		values, err := rdb.LRange(context.Background(), list, 0, -1).Result()
+		require.NoError(t, err)
+		return values
+	})
+
+	ttl, err := rdb.TTL(context.Background(), prefix+"balances:applied:e-1").Result()
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour.Seconds(), ttl.Seconds(), 5)
+}
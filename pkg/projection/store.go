@@ -0,0 +1,353 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	model "blueprint/model/blueprint"
+	"blueprint/pkg/eventbus"
+
+	goredis "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultRedisPrefix = "projection:"
+
+// ErrApplied is returned by Store.Apply for events the projection applied
+// before, the read model was left alone
+var ErrApplied = errors.New("event already applied")
+
+// Position is the last event a projection applied from a topic
+type Position struct {
+	Projection string
+	Topic      string
+	EventID    string
+	OccurredAt time.Time
+	Applied    int64
+	UpdatedAt  time.Time
+}
+
+// Store applies events to a read model together with the projection's
+// position, so a crash never leaves one without the other
+type Store interface {
+	// Apply runs fn and records e as applied in one transaction; fn sees
+	// the transaction through Tx or Pipe. ErrApplied when e was applied
+	// before, fn does not run then.
+	Apply(ctx context.Context, projection string, e *eventbus.Event, now time.Time, fn func(ctx context.Context) error) error
+	Positions(ctx context.Context, projection string) ([]Position, error)
+	// Reset forgets the positions and applied events of a projection
+	Reset(ctx context.Context, projection string) error
+	// Prune forgets applied events older than before, later redeliveries
+	// of them apply again
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+type txKey struct{}
+type pipeKey struct{}
+
+// Tx is the transaction of a GormStore apply, write the read model through
+// it. nil outside one.
+func Tx(ctx context.Context) *gorm.DB {
+	tx, _ := ctx.Value(txKey{}).(*gorm.DB)
+	return tx
+}
+
+// Pipe is the MULTI of a RedisStore apply, queue the read model writes on
+// it; they run with the position or not at all. nil outside one.
+func Pipe(ctx context.Context) goredis.Pipeliner {
+	pipe, _ := ctx.Value(pipeKey{}).(goredis.Pipeliner)
+	return pipe
+}
+
+// GormStore keeps positions in projection_positions and applied ids in
+// projection_events, db.Migrate creates both. Read models in the same
+// database are updated in the transaction of Apply.
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Apply(ctx context.Context, projection string, e *eventbus.Event, now time.Time, fn func(ctx context.Context) error) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.ProjectionEvent{Projection: projection, EventID: e.ID, AppliedAt: now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrApplied
+		}
+
+		if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "projection"}, {Name: "topic"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"event_id":    e.ID,
+				"occurred_at": e.OccurredAt,
+				"applied":     gorm.Expr("projection_positions.applied + 1"),
+				"updated_at":  now,
+			}),
+		}).Create(&model.ProjectionPosition{
+			Projection: projection,
+			Topic:      e.Topic,
+			EventID:    e.ID,
+			OccurredAt: e.OccurredAt,
+			Applied:    1,
+			UpdatedAt:  now,
+		}).Error
+	})
+	if err != nil && !errors.Is(err, ErrApplied) {
+		return fmt.Errorf("projection %s: %w", projection, err)
+	}
+	return err
+}
+
+func (s *GormStore) Positions(ctx context.Context, projection string) ([]Position, error) {
+	var rows []model.ProjectionPosition
+	if err := s.db.WithContext(ctx).Where("projection = ?", projection).Order("topic").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("projection %s: positions: %w", projection, err)
+	}
+	out := make([]Position, len(rows))
+	for i, row := range rows {
+		out[i] = Position{
+			Projection: row.Projection,
+			Topic:      row.Topic,
+			EventID:    row.EventID,
+			OccurredAt: row.OccurredAt.UTC(),
+			Applied:    row.Applied,
+			UpdatedAt:  row.UpdatedAt.UTC(),
+		}
+	}
+	return out, nil
+}
+
+func (s *GormStore) Reset(ctx context.Context, projection string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("projection = ?", projection).Delete(&model.ProjectionEvent{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("projection = ?", projection).Delete(&model.ProjectionPosition{}).Error
+	})
+}
+
+func (s *GormStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res := s.db.WithContext(ctx).Where("applied_at < ?", before).Delete(&model.ProjectionEvent{})
+	return res.RowsAffected, res.Error
+}
+
+// RedisStore keeps positions and applied ids under prefix, for read models
+// in redis. Applied ids expire after ttl instead of being pruned.
+type RedisStore struct {
+	rdb    *goredis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisStore uses "projection:" when prefix is empty and ttl as Prune
+// would, 7 days when 0
+func NewRedisStore(rdb *goredis.Client, prefix string, ttl time.Duration) *RedisStore {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	if ttl <= 0 {
+		ttl = defaultRetention
+	}
+	return &RedisStore{rdb: rdb, prefix: prefix, ttl: ttl}
+}
+
+func (s *RedisStore) applied(projection, id string) string {
+	return s.prefix + projection + ":applied:" + id
+}
+
+func (s *RedisStore) positions(projection string) string {
+	return s.prefix + projection + ":positions"
+}
+
+// Apply watches the applied key, a concurrent apply of the same event
+// fails the transaction and the bus delivers it again
+func (s *RedisStore) Apply(ctx context.Context, projection string, e *eventbus.Event, now time.Time, fn func(ctx context.Context) error) error {
+	key := s.applied(projection, e.ID)
+	err := s.rdb.Watch(ctx, func(tx *goredis.Tx) error {
+		n, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrApplied
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			if err := fn(context.WithValue(ctx, pipeKey{}, pipe)); err != nil {
+				return err
+			}
+			pipe.Set(ctx, key, now.UnixMilli(), s.ttl)
+			// one hash for all topics, fields are <topic>.<attribute>
+			positions := s.positions(projection)
+			pipe.HSet(ctx, positions,
+				e.Topic+".event_id", e.ID,
+				e.Topic+".occurred_at", e.OccurredAt.UnixMilli(),
+				e.Topic+".updated_at", now.UnixMilli(),
+			)
+			pipe.HIncrBy(ctx, positions, e.Topic+".applied", 1)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil && !errors.Is(err, ErrApplied) {
+		return fmt.Errorf("projection %s: %w", projection, err)
+	}
+	return err
+}
+
+func (s *RedisStore) Positions(ctx context.Context, projection string) ([]Position, error) {
+	fields, err := s.rdb.HGetAll(ctx, s.positions(projection)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("projection %s: positions: %w", projection, err)
+	}
+	byTopic := make(map[string]*Position)
+	var topics []string
+	for field, value := range fields {
+		dot := strings.LastIndexByte(field, '.')
+		if dot < 0 {
+			continue
+		}
+		topic := field[:dot]
+		p, ok := byTopic[topic]
+		if !ok {
+			p = &Position{Projection: projection, Topic: topic}
+			byTopic[topic] = p
+			topics = append(topics, topic)
+		}
+		n, _ := strconv.ParseInt(value, 10, 64)
+		switch field[dot+1:] {
+		case "event_id":
+			p.EventID = value
+		case "occurred_at":
+			p.OccurredAt = time.UnixMilli(n).UTC()
+		case "updated_at":
+			p.UpdatedAt = time.UnixMilli(n).UTC()
+		case "applied":
+			p.Applied = n
+		}
+	}
+	sort.Strings(topics)
+	out := make([]Position, len(topics))
+	for i, topic := range topics {
+		out[i] = *byTopic[topic]
+	}
+	return out, nil
+}
+
+func (s *RedisStore) Reset(ctx context.Context, projection string) error {
+	var keys []string
+	iter := s.rdb.Scan(ctx, 0, s.applied(projection, "*"), 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == 1000 {
+			if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	return s.rdb.Del(ctx, append(keys, s.positions(projection))...).Err()
+}
+
+// Prune has nothing to do, applied ids expire on their own
+func (s *RedisStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// MemoryStore is a Store for one process and tests, fn runs without a
+// transaction
+type MemoryStore struct {
+	mu        sync.Mutex
+	positions map[string]map[string]Position
+	applied   map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{positions: make(map[string]map[string]Position), applied: make(map[string]time.Time)}
+}
+
+func (s *MemoryStore) Apply(ctx context.Context, projection string, e *eventbus.Event, now time.Time, fn func(ctx context.Context) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := projection + "\x00" + e.ID
+	if _, ok := s.applied[key]; ok {
+		return ErrApplied
+	}
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	s.applied[key] = now
+	if s.positions[projection] == nil {
+		s.positions[projection] = make(map[string]Position)
+	}
+	p := s.positions[projection][e.Topic]
+	s.positions[projection][e.Topic] = Position{
+		Projection: projection,
+		Topic:      e.Topic,
+		EventID:    e.ID,
+		OccurredAt: e.OccurredAt,
+		Applied:    p.Applied + 1,
+		UpdatedAt:  now,
+	}
+	return nil
+}
+
+func (s *MemoryStore) Positions(ctx context.Context, projection string) ([]Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var topics []string
+	for topic := range s.positions[projection] {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	out := make([]Position, len(topics))
+	for i, topic := range topics {
+		out[i] = s.positions[projection][topic]
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, projection string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.positions, projection)
+	for key := range s.applied {
+		if strings.HasPrefix(key, projection+"\x00") {
+			delete(s.applied, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for key, at := range s.applied {
+		if at.Before(before) {
+			delete(s.applied, key)
+			n++
+		}
+	}
+	return n, nil
+}
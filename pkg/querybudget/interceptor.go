@@ -0,0 +1,75 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package querybudget
+
+import (
+	"context"
+
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+var (
+	callQueries = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blueprint_db_queries_per_call",
+		Help:    "Database queries run by one unary call, by method.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	}, []string{"grpc_method"})
+	overBudget = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_db_query_budget_exceeded_total",
+		Help: "Calls that ran more queries than their budget by method and action, logged or rejected.",
+	}, []string{"grpc_method", "action"})
+)
+
+func init() {
+	prometheus.MustRegister(callQueries, overBudget)
+}
+
+// Interceptor counts the queries of every unary call against its
+// method's budget, the first matching policy wins and the others get
+// limit. Streams are not budgeted, they run queries for as long as they
+// are open.
+type Interceptor struct {
+	limit    int
+	policies []Policy
+	reject   bool
+	log      *logger.Logger
+}
+
+func NewInterceptor(limit int, policies []Policy, reject bool, log *logger.Logger) *Interceptor {
+	return &Interceptor{limit: limit, policies: policies, reject: reject, log: log}
+}
+
+// Limit is the budget of fullMethod, 0 is unlimited
+func (i *Interceptor) Limit(fullMethod string) int {
+	for _, p := range i.policies {
+		if p.matches(fullMethod) {
+			return p.Limit
+		}
+	}
+	return i.limit
+}
+
+func (i *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, c := With(ctx, i.Limit(info.FullMethod), i.reject)
+		resp, err := handler(ctx, req)
+
+		queries := c.Queries()
+		ctxmeta.Observe(ctx, callQueries.WithLabelValues(info.FullMethod), float64(queries))
+		if c.Exceeded() {
+			action := "logged"
+			if i.reject {
+				action = "rejected"
+			}
+			overBudget.WithLabelValues(info.FullMethod, action).Inc()
+			if i.log != nil {
+				i.log.WithContext(ctx).Warnw("Call ran more database queries than its budget",
+					"method", info.FullMethod, "queries", queries, "budget", c.limit, "action", action, "tables", c.Tables())
+			}
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,134 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package querybudget caps the database queries of one call, so an N+1
+// loop shows up in production before it takes the database down. The
+// interceptor gives every unary call a Counter with its method's budget,
+// the db query counter plugin counts each query against it:
+//
+//	policies, _ := specs.ParseAll([]string{"/blueprint.Blueprint/Call=20"}, querybudget.ParsePolicy)
+//	budget := querybudget.NewInterceptor(100, policies, false, log)
+//
+// Calls over budget are logged with their queries by table. With
+// reject set the query crossing the budget fails with ResourceExhausted
+// instead, and so does every later one of the call.
+package querybudget
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"blueprint/pkg/errors"
+	"blueprint/pkg/grpcmethod"
+
+	"google.golang.org/grpc/codes"
+)
+
+// ReasonQueryBudget is the ErrorInfo reason of rejected queries
+const ReasonQueryBudget = "QUERY_BUDGET_EXCEEDED"
+
+// ErrExceeded is what a query over a rejecting budget fails with
+var ErrExceeded = errors.New(codes.ResourceExhausted, ReasonQueryBudget, "too many database queries for one call")
+
+// Policy overrides the budget of Method, as in PayloadLog.Methods a full
+// method, a service or a bare method name
+type Policy struct {
+	Method string
+	Limit  int
+}
+
+// ParsePolicy reads "method=limit"
+func ParsePolicy(spec string) (Policy, error) {
+	method, limitSpec, ok := strings.Cut(spec, "=")
+	if !ok || strings.TrimSpace(method) == "" {
+		return Policy{}, fmt.Errorf("query budget %q: want method=limit", spec)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(limitSpec))
+	if err != nil || limit < 0 {
+		return Policy{}, fmt.Errorf("query budget %q: invalid limit %q", spec, limitSpec)
+	}
+	return Policy{Method: strings.TrimSpace(method), Limit: limit}, nil
+}
+
+func (p Policy) matches(fullMethod string) bool {
+	return grpcmethod.Match(p.Method, fullMethod)
+}
+
+type key struct{}
+
+// Counter is the queries of one call, safe for the goroutines of a call
+type Counter struct {
+	limit  int
+	reject bool
+
+	mu      sync.Mutex
+	queries int
+	tables  map[string]int
+}
+
+// With puts a Counter allowing limit queries into ctx, 0 is unlimited and
+// only counts. A ctx already counting keeps its Counter.
+func With(ctx context.Context, limit int, reject bool) (context.Context, *Counter) {
+	if c, ok := FromContext(ctx); ok {
+		return ctx, c
+	}
+	c := &Counter{limit: limit, reject: reject, tables: make(map[string]int)}
+	return context.WithValue(ctx, key{}, c), c
+}
+
+func FromContext(ctx context.Context) (*Counter, bool) {
+	c, ok := ctx.Value(key{}).(*Counter)
+	return c, ok
+}
+
+// Count records a query on table, ErrExceeded once it is over a
+// rejecting budget. Without a Counter it does nothing.
+func Count(ctx context.Context, table string) error {
+	c, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.queries++
+	if table == "" {
+		table = "raw"
+	}
+	c.tables[table]++
+	if c.reject && c.over() {
+		return ErrExceeded
+	}
+	return nil
+}
+
+// Queries is how many queries the call ran so far
+func (c *Counter) Queries() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.queries
+}
+
+// Exceeded reports whether the call ran more queries than its budget
+func (c *Counter) Exceeded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.over()
+}
+
+func (c *Counter) over() bool {
+	return c.limit > 0 && c.queries > c.limit
+}
+
+// Tables are the queries by table, "raw" for Raw and Exec without a model
+func (c *Counter) Tables() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]int, len(c.tables))
+	for table, n := range c.tables {
+		out[table] = n
+	}
+	return out
+}
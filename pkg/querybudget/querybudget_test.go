@@ -0,0 +1,110 @@
+package querybudget
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"blueprint/config"
+	apperrors "blueprint/pkg/errors"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/specs"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := specs.ParseAll([]string{"/blueprint.Blueprint/Call=20", " Get = 0"}, ParsePolicy)
+	require.NoError(t, err)
+	assert.Equal(t, []Policy{{Method: "/blueprint.Blueprint/Call", Limit: 20}, {Method: "Get", Limit: 0}}, policies)
+
+	for _, spec := range []string{"Call", "=5", "Call=-1", "Call=many"} {
+		_, err := ParsePolicy(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCount(t *testing.T) {
+	assert.NoError(t, Count(context.Background(), "accounts"), "nothing to count outside a call")
+
+	ctx, c := With(context.Background(), 2, true)
+	nested, same := With(ctx, 50, false)
+	assert.Equal(t, ctx, nested)
+	assert.Same(t, c, same, "the outer budget holds")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, Count(ctx, "accounts"))
+		}()
+	}
+	wg.Wait()
+	assert.False(t, c.Exceeded())
+
+	err := Count(ctx, "")
+	require.ErrorIs(t, err, ErrExceeded)
+	typed, ok := apperrors.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, ReasonQueryBudget, typed.Reason)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.True(t, c.Exceeded())
+	assert.Equal(t, 3, c.Queries())
+	assert.Equal(t, map[string]int{"accounts": 2, "raw": 1}, c.Tables())
+
+	ctx, c = With(context.Background(), 0, true)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, Count(ctx, "accounts"), "0 only counts")
+	}
+	assert.False(t, c.Exceeded())
+}
+
+func TestInterceptor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	log, err := logger.NewLoggerWithOptions(&config.Config{}, logger.LoggerOptions{Level: "info", OutputPath: path})
+	require.NoError(t, err)
+	defer log.Close()
+
+	policies, err := specs.ParseAll([]string{"List=5"}, ParsePolicy)
+	require.NoError(t, err)
+	call := func(i *Interceptor, method string, queries int) error {
+		_, err := i.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				for n := 0; n < queries; n++ {
+					if err := Count(ctx, "accounts"); err != nil {
+						return nil, err
+					}
+				}
+				return "ok", nil
+			})
+		return err
+	}
+
+	logging := NewInterceptor(2, policies, false, log)
+	assert.Equal(t, 5, logging.Limit("/blueprint.Blueprint/List"))
+	assert.Equal(t, 2, logging.Limit("/blueprint.Blueprint/Call"))
+
+	logged := testutil.ToFloat64(overBudget.WithLabelValues("/blueprint.Blueprint/Call", "logged"))
+	require.NoError(t, call(logging, "/blueprint.Blueprint/List", 4))
+	require.NoError(t, call(logging, "/blueprint.Blueprint/Call", 3), "only logged")
+	assert.Equal(t, logged+1, testutil.ToFloat64(overBudget.WithLabelValues("/blueprint.Blueprint/Call", "logged")))
+
+	rejected := testutil.ToFloat64(overBudget.WithLabelValues("/blueprint.Blueprint/Call", "rejected"))
+	err = call(NewInterceptor(2, nil, true, log), "/blueprint.Blueprint/Call", 3)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, rejected+1, testutil.ToFloat64(overBudget.WithLabelValues("/blueprint.Blueprint/Call", "rejected")))
+
+	log.Sync()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "more database queries than its budget")
+	assert.NotContains(t, string(data), "/blueprint.Blueprint/List")
+}
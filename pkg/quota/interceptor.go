@@ -0,0 +1,133 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package quota
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// ReasonQuotaExceeded is the ErrorInfo reason of rejected calls
+const ReasonQuotaExceeded = "QUOTA_EXCEEDED"
+
+var quotaResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "blueprint_quota_total",
+	Help: "Calls seen by the quota interceptor by result: allowed, exceeded, unmetered or error.",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(quotaResults)
+}
+
+// Store is the part of Tracker the interceptor uses
+type Store interface {
+	Consume(ctx context.Context, apiKey string) (Usage, error)
+}
+
+// Interceptor charges every call carrying an API key, a stream once when
+// it opens, and turns calls over quota down with ResourceExhausted. Calls
+// without a key pass unmetered, authenticating them is not its job. When
+// redis fails calls are let through rather than failing the service with
+// it.
+type Interceptor struct {
+	store  Store
+	header string
+	clock  clock.Clock
+}
+
+// NewInterceptor passes every call through until SetStore is called. clk
+// times the Retry-After of refused calls, give it the Tracker's.
+func NewInterceptor(header string, clk clock.Clock) *Interceptor {
+	return &Interceptor{header: strings.ToLower(header), clock: clock.Or(clk)}
+}
+
+// SetStore plugs in the tracker once redis is up, call it before serving
+func (q *Interceptor) SetStore(store Store) {
+	q.store = store
+}
+
+func (q *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		header, err := q.charge(ctx)
+		if header != nil {
+			grpc.SetHeader(ctx, header)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor charges a stream as one call, however many
+// messages it carries
+func (q *Interceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		header, err := q.charge(ss.Context())
+		if header != nil {
+			ss.SetHeader(header)
+		}
+		if err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// charge consumes a call of the caller's key, header is nil when nothing
+// was charged
+func (q *Interceptor) charge(ctx context.Context) (metadata.MD, error) {
+	if q.store == nil {
+		return nil, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := md.Get(q.header)
+	if len(keys) == 0 || keys[0] == "" {
+		quotaResults.WithLabelValues("unmetered").Inc()
+		return nil, nil
+	}
+
+	usage, err := q.store.Consume(ctx, keys[0])
+	if err != nil {
+		quotaResults.WithLabelValues("error").Inc()
+		return nil, nil
+	}
+
+	if !usage.Allowed {
+		quotaResults.WithLabelValues("exceeded").Inc()
+		period := "daily"
+		if usage.Monthly.exceeded() {
+			period = "monthly"
+		}
+		return Headers(usage), errors.New(codes.ResourceExhausted, ReasonQuotaExceeded, period+" quota exceeded").
+			WithRetryAfter(usage.RetryAfter(q.clock.Now())).
+			WithMetadata("period", period)
+	}
+
+	quotaResults.WithLabelValues("allowed").Inc()
+	return Headers(usage), nil
+}
+
+// Headers are the x-quota-* response headers for usage, limited periods
+// only: limit, remaining and the reset time in unix seconds
+func Headers(usage Usage) metadata.MD {
+	md := metadata.MD{}
+	for name, p := range map[string]Period{"daily": usage.Daily, "monthly": usage.Monthly} {
+		if p.Limit <= 0 {
+			continue
+		}
+		md.Set("x-quota-"+name+"-limit", strconv.FormatInt(p.Limit, 10))
+		md.Set("x-quota-"+name+"-remaining", strconv.FormatInt(p.Remaining(), 10))
+		md.Set("x-quota-"+name+"-reset", strconv.FormatInt(p.Reset.Unix(), 10))
+	}
+	return md
+}
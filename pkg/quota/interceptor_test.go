@@ -0,0 +1,129 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeStore struct {
+	usage Usage
+	err   error
+	keys  []string
+}
+
+func (f *fakeStore) Consume(ctx context.Context, apiKey string) (Usage, error) {
+	f.keys = append(f.keys, apiKey)
+	return f.usage, f.err
+}
+
+func TestInterceptor(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC))
+	reset := clk.Now().Add(time.Hour)
+	store := &fakeStore{usage: Usage{
+		Daily:   Period{Used: 1, Limit: 1, Reset: reset},
+		Allowed: true,
+	}}
+	q := NewInterceptor("X-Api-Key", clk)
+	intercept := q.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/blueprint.Blueprint/Call"}
+	called := 0
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		called++
+		return "ok", nil
+	}
+	withKey := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "k1"))
+
+	_, err := intercept(withKey, nil, info, handler)
+	require.NoError(t, err)
+	assert.Empty(t, store.keys, "no store yet, everything passes")
+
+	q.SetStore(store)
+	_, err = intercept(withKey, nil, info, handler)
+	require.NoError(t, err)
+	_, err = intercept(context.Background(), nil, info, handler)
+	require.NoError(t, err, "calls without a key are unmetered")
+	assert.Equal(t, []string{"k1"}, store.keys)
+
+	store.usage.Allowed = false
+	_, err = intercept(withKey, nil, info, handler)
+	st := status.Convert(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	require.NotEmpty(t, st.Details())
+	var retry *errdetails.RetryInfo
+	for _, d := range st.Details() {
+		if r, ok := d.(*errdetails.RetryInfo); ok {
+			retry = r
+		}
+	}
+	require.NotNil(t, retry)
+	assert.Equal(t, time.Hour, retry.RetryDelay.AsDuration())
+
+	store.err = errors.New("redis down")
+	_, err = intercept(withKey, nil, info, handler)
+	assert.NoError(t, err, "fails open")
+	assert.Equal(t, 4, called)
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (s *fakeStream) Context() context.Context { return s.ctx }
+
+func (s *fakeStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	store := &fakeStore{usage: Usage{Daily: Period{Used: 1, Limit: 2, Reset: time.Now().Add(time.Hour)}, Allowed: true}}
+	q := NewInterceptor("X-Api-Key", nil)
+	q.SetStore(store)
+	intercept := q.StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/blueprint.Blueprint/Watch"}
+	opened := 0
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		opened++
+		return nil
+	}
+
+	ss := &fakeStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "k1"))}
+	require.NoError(t, intercept(nil, ss, info, handler))
+	assert.Equal(t, []string{"k1"}, store.keys, "a stream is one call")
+	assert.Equal(t, []string{"1"}, ss.header.Get("x-quota-daily-remaining"))
+
+	store.usage.Allowed = false
+	ss = &fakeStream{ctx: ss.ctx}
+	err := intercept(nil, ss, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.NotEmpty(t, ss.header, "the client still learns when the quota resets")
+	assert.Equal(t, 1, opened)
+
+	require.NoError(t, intercept(nil, &fakeStream{ctx: context.Background()}, info, handler), "unmetered without a key")
+}
+
+func TestHeaders(t *testing.T) {
+	reset := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	md := Headers(Usage{
+		Daily:   Period{Used: 3, Limit: 10, Reset: reset},
+		Monthly: Period{Used: 3},
+	})
+	assert.Equal(t, []string{"10"}, md.Get("x-quota-daily-limit"))
+	assert.Equal(t, []string{"7"}, md.Get("x-quota-daily-remaining"))
+	assert.Equal(t, []string{"1792195200"}, md.Get("x-quota-daily-reset"))
+	assert.Empty(t, md.Get("x-quota-monthly-limit"), "unlimited periods send nothing")
+}
@@ -0,0 +1,12 @@
+package quota
+
+import (
+	"testing"
+
+	"blueprint/pkg/testsupport"
+)
+
+// one redis container for the whole package
+func TestMain(m *testing.M) {
+	testsupport.Main(m)
+}
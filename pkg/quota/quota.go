@@ -0,0 +1,179 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package quota counts calls per API key against daily and monthly limits
+// in redis. Unlike pkg/ratelimit's per replica token buckets it is shared
+// by every replica and survives restarts, periods are calendar days and
+// months in UTC.
+package quota
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultPrefix = "quota"
+
+// keep counters a little past their period so a late read still sees them
+const expiryGrace = time.Hour
+
+// Limits per API key, 0 leaves that period unlimited
+type Limits struct {
+	Daily   int64
+	Monthly int64
+}
+
+// Period is the usage of one day or month
+type Period struct {
+	Used  int64
+	Limit int64
+	Reset time.Time
+}
+
+// Remaining calls in the period, -1 when unlimited
+func (p Period) Remaining() int64 {
+	if p.Limit <= 0 {
+		return -1
+	}
+	if p.Used >= p.Limit {
+		return 0
+	}
+	return p.Limit - p.Used
+}
+
+func (p Period) exceeded() bool {
+	return p.Limit > 0 && p.Used >= p.Limit
+}
+
+// Usage of one key. Allowed is false when Consume turned the call down,
+// the counters are not charged for it then.
+type Usage struct {
+	Daily   Period
+	Monthly Period
+	Allowed bool
+}
+
+// RetryAfter is how long until the exhausted period resets
+func (u Usage) RetryAfter(now time.Time) time.Duration {
+	reset := u.Daily.Reset
+	if u.Monthly.exceeded() {
+		reset = u.Monthly.Reset
+	}
+	return reset.Sub(now)
+}
+
+// consume charges both counters only if neither is at its limit, as one
+// script so concurrent calls on other replicas can't overshoot
+var consume = redis.NewScript(`
+local day = tonumber(redis.call('GET', KEYS[1]) or '0')
+local month = tonumber(redis.call('GET', KEYS[2]) or '0')
+local dayLimit, monthLimit = tonumber(ARGV[1]), tonumber(ARGV[2])
+if (dayLimit > 0 and day >= dayLimit) or (monthLimit > 0 and month >= monthLimit) then
+	return {day, month, 0}
+end
+day = redis.call('INCR', KEYS[1])
+if day == 1 then redis.call('PEXPIREAT', KEYS[1], ARGV[3]) end
+month = redis.call('INCR', KEYS[2])
+if month == 1 then redis.call('PEXPIREAT', KEYS[2], ARGV[4]) end
+return {day, month, 1}
+`)
+
+// Tracker keeps the counters
+type Tracker struct {
+	client *redis.Client
+	limits Limits
+	prefix string
+	clock  clock.Clock
+}
+
+func NewTracker(client *redis.Client, limits Limits) *Tracker {
+	return &Tracker{
+		client: client,
+		limits: limits,
+		prefix: defaultPrefix,
+		clock:  clock.Real,
+	}
+}
+
+// SetClock lets tests move across day and month boundaries
+func (t *Tracker) SetClock(c clock.Clock) {
+	t.clock = clock.Or(c)
+}
+
+// Limits the tracker enforces
+func (t *Tracker) Limits() Limits {
+	return t.limits
+}
+
+// Consume charges one call to apiKey unless that would exceed a limit
+func (t *Tracker) Consume(ctx context.Context, apiKey string) (Usage, error) {
+	now := t.clock.Now().UTC()
+	dayKey, monthKey, usage := t.periods(apiKey, now)
+
+	res, err := consume.Run(ctx, t.client, []string{dayKey, monthKey},
+		t.limits.Daily, t.limits.Monthly,
+		usage.Daily.Reset.Add(expiryGrace).UnixMilli(),
+		usage.Monthly.Reset.Add(expiryGrace).UnixMilli(),
+	).Int64Slice()
+	if err != nil {
+		return usage, fmt.Errorf("quota consume: %w", err)
+	}
+
+	usage.Daily.Used, usage.Monthly.Used, usage.Allowed = res[0], res[1], res[2] == 1
+	return usage, nil
+}
+
+// Usage reads apiKey's counters without charging a call
+func (t *Tracker) Usage(ctx context.Context, apiKey string) (Usage, error) {
+	now := t.clock.Now().UTC()
+	dayKey, monthKey, usage := t.periods(apiKey, now)
+
+	vals, err := t.client.MGet(ctx, dayKey, monthKey).Result()
+	if err != nil {
+		return usage, fmt.Errorf("quota usage: %w", err)
+	}
+	usage.Daily.Used = toInt(vals[0])
+	usage.Monthly.Used = toInt(vals[1])
+	usage.Allowed = !usage.Daily.exceeded() && !usage.Monthly.exceeded()
+	return usage, nil
+}
+
+// periods returns the counter keys of now's day and month and an empty
+// Usage with their limits and reset times
+func (t *Tracker) periods(apiKey string, now time.Time) (dayKey, monthKey string, usage Usage) {
+	// the {id} hash tag keeps both counters on one cluster slot for the script
+	id := "{" + KeyID(apiKey) + "}"
+	dayKey = fmt.Sprintf("%s:%s:d:%s", t.prefix, id, now.Format("20060102"))
+	monthKey = fmt.Sprintf("%s:%s:m:%s", t.prefix, id, now.Format("200601"))
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	usage = Usage{
+		Daily:   Period{Limit: t.limits.Daily, Reset: day.AddDate(0, 0, 1)},
+		Monthly: Period{Limit: t.limits.Monthly, Reset: month.AddDate(0, 1, 0)},
+	}
+	return dayKey, monthKey, usage
+}
+
+// KeyID is what identifies an API key in redis and logs, the key itself is
+// a secret and never stored
+func KeyID(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+func toInt(v interface{}) int64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
@@ -0,0 +1,61 @@
+package quota
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriods(t *testing.T) {
+	tr := NewTracker(nil, Limits{Daily: 10, Monthly: 100})
+	now := time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC)
+
+	dayKey, monthKey, usage := tr.periods("secret", now)
+	assert.Equal(t, "quota:{"+KeyID("secret")+"}:d:20261231", dayKey)
+	assert.Equal(t, "quota:{"+KeyID("secret")+"}:m:202612", monthKey)
+	assert.NotContains(t, dayKey, "secret", "the key itself is never stored")
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), usage.Daily.Reset)
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), usage.Monthly.Reset)
+	assert.Equal(t, time.Minute, usage.RetryAfter(now))
+
+	assert.Equal(t, int64(-1), Period{Used: 5}.Remaining(), "unlimited")
+	assert.Equal(t, int64(0), Period{Used: 12, Limit: 10}.Remaining())
+}
+
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	tr := NewTracker(testsupport.Redis(t), Limits{Daily: 2, Monthly: 3})
+	tr.SetClock(clk)
+
+	for i := 0; i < 2; i++ {
+		usage, err := tr.Consume(ctx, "key-a")
+		require.NoError(t, err)
+		assert.True(t, usage.Allowed)
+	}
+	usage, err := tr.Consume(ctx, "key-a")
+	require.NoError(t, err)
+	assert.False(t, usage.Allowed, "daily limit reached")
+	assert.Equal(t, int64(2), usage.Daily.Used, "a rejected call is not charged")
+
+	usage, err = tr.Consume(ctx, "key-b")
+	require.NoError(t, err)
+	assert.True(t, usage.Allowed, "keys are counted apart")
+
+	clk.Advance(24 * time.Hour)
+	usage, err = tr.Consume(ctx, "key-a")
+	require.NoError(t, err)
+	assert.True(t, usage.Allowed, "a new day")
+	assert.Equal(t, int64(3), usage.Monthly.Used)
+
+	usage, err = tr.Usage(ctx, "key-a")
+	require.NoError(t, err)
+	assert.False(t, usage.Allowed, "monthly limit reached")
+	assert.Equal(t, int64(1), usage.Daily.Used)
+}
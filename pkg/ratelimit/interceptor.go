@@ -0,0 +1,143 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	rateLimitResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_rate_limit_total",
+		Help: "Calls to rate limited methods by result: allowed or limited.",
+	}, []string{"grpc_method", "result"})
+	rateLimitWarnings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_rate_limit_warnings_total",
+		Help: "Callers warned to be close to the rate limit of a method.",
+	}, []string{"grpc_method"})
+)
+
+func init() {
+	prometheus.MustRegister(rateLimitResults, rateLimitWarnings)
+}
+
+// Interceptor turns down unary calls over their method's policy with
+// ResourceExhausted and a retry delay. Methods without a policy are not
+// limited. A caller missing the policy's key, e.g. an anonymous user, is
+// limited by client IP instead. Every limited call, allowed or not,
+// answers with the Headers of its bucket, and a caller getting close to
+// the limit is logged before it is turned down.
+type Interceptor struct {
+	limiters  []*Limiter
+	keyHeader string
+	log       *logger.Logger
+}
+
+// NewInterceptor reads API keys from keyHeader, clk nil is the wall clock.
+// The first matching policy wins. Callers left with warnAt of a burst,
+// 0.2 is a fifth, are logged to log once until their bucket filled up
+// again; policies with a Warn of their own keep it.
+func NewInterceptor(policies []Policy, keyHeader string, warnAt float64, log *logger.Logger, clk clock.Clock) *Interceptor {
+	i := &Interceptor{keyHeader: strings.ToLower(keyHeader), log: log}
+	for _, p := range policies {
+		if p.Warn == 0 {
+			p.Warn = int(math.Ceil(warnAt * float64(p.Burst)))
+		}
+		i.limiters = append(i.limiters, NewLimiter(p, clk))
+	}
+	return i
+}
+
+func (i *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		l := i.limiter(info.FullMethod)
+		if l == nil {
+			return handler(ctx, req)
+		}
+
+		key := i.key(ctx, l.policy.Key)
+		d := l.Take(key)
+		grpc.SetHeader(ctx, Headers(d))
+		if !d.Allowed {
+			rateLimitResults.WithLabelValues(info.FullMethod, "limited").Inc()
+			return nil, errors.RateLimited("rate limit exceeded", d.RetryAfter).
+				WithMetadata("limit", strconv.Itoa(l.policy.Rate)).
+				WithMetadata("period", l.policy.Period.String())
+		}
+
+		rateLimitResults.WithLabelValues(info.FullMethod, "allowed").Inc()
+		if d.Warn {
+			rateLimitWarnings.WithLabelValues(info.FullMethod).Inc()
+			if i.log != nil {
+				i.log.WithContext(ctx).Warnw("Caller is close to its rate limit",
+					"method", info.FullMethod, "caller", redact(key), "remaining", d.Remaining, "burst", d.Limit,
+					"rate", strconv.Itoa(l.policy.Rate)+"/"+l.policy.Period.String(), "reset", d.Reset)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Headers are the x-ratelimit-* response headers of d: the burst, the calls
+// left and the reset time in unix seconds, when the bucket is full again
+func Headers(d Decision) metadata.MD {
+	return metadata.Pairs(
+		"x-ratelimit-limit", strconv.Itoa(d.Limit),
+		"x-ratelimit-remaining", strconv.Itoa(d.Remaining),
+		"x-ratelimit-reset", strconv.FormatInt(d.Reset.Unix(), 10),
+	)
+}
+
+// redact keeps API keys out of the logs, a prefix tells them apart
+func redact(key string) string {
+	if k, ok := strings.CutPrefix(key, "apikey:"); ok && len(k) > 4 {
+		return "apikey:" + k[:4] + "..."
+	}
+	return key
+}
+
+func (i *Interceptor) limiter(fullMethod string) *Limiter {
+	for _, l := range i.limiters {
+		if l.policy.matches(fullMethod) {
+			return l
+		}
+	}
+	return nil
+}
+
+func (i *Interceptor) key(ctx context.Context, kind string) string {
+	return CallerKey(ctx, kind, i.keyHeader)
+}
+
+// CallerKey is who the call is charged to, one of the Key kinds with API
+// keys read from keyHeader, lower case. It is prefixed so a user id never
+// shares a bucket with an address. User and IP are what the ctxmeta
+// interceptor took from its Peers: x-user-id only from the gateway or
+// another trusted proxy, the address behind them, so a client can't pick
+// a fresh key per call.
+func CallerKey(ctx context.Context, kind, keyHeader string) string {
+	switch kind {
+	case KeyUser:
+		if id, ok := ctxmeta.UserID(ctx); ok {
+			return "user:" + id
+		}
+	case KeyAPIKey:
+		md, _ := metadata.FromIncomingContext(ctx)
+		if keys := md.Get(keyHeader); len(keys) > 0 && keys[0] != "" {
+			return "apikey:" + keys[0]
+		}
+	}
+	ip, _ := ctxmeta.ClientIP(ctx)
+	return "ip:" + ip
+}
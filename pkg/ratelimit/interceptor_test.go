@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
+	apperrors "blueprint/pkg/errors"
+	"blueprint/pkg/netacl"
+	"blueprint/pkg/specs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestInterceptor(t *testing.T) {
+	policies, err := specs.ParseAll([]string{"Call=1/1m:user", "Get=1/1m:apikey"}, ParsePolicy)
+	require.NoError(t, err)
+	clk := clock.NewFake(time.Unix(0, 0))
+	interceptor := NewInterceptor(policies, "X-API-Key", 0, nil, clk).UnaryServerInterceptor()
+
+	handled := 0
+	call := func(ctx context.Context, method string) error {
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				handled++
+				return "ok", nil
+			})
+		return err
+	}
+
+	alice := ctxmeta.WithUserID(ctxmeta.WithClientIP(context.Background(), "10.0.0.1"), "alice")
+	require.NoError(t, call(alice, "/blueprint.Blueprint/Call"))
+	err = call(alice, "/blueprint.Blueprint/Call")
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	typed, ok := apperrors.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, time.Minute, typed.RetryAfter)
+	assert.Equal(t, "1", typed.Metadata["limit"])
+
+	anonymous := ctxmeta.WithClientIP(context.Background(), "10.0.0.1")
+	assert.NoError(t, call(anonymous, "/blueprint.Blueprint/Call"), "no user, limited by IP")
+	assert.Error(t, call(anonymous, "/blueprint.Blueprint/Call"))
+
+	keyed := metadata.NewIncomingContext(anonymous, metadata.Pairs("x-api-key", "k1"))
+	require.NoError(t, call(keyed, "/blueprint.Blueprint/Get"))
+	assert.Error(t, call(keyed, "/blueprint.Blueprint/Get"))
+	assert.NoError(t, call(anonymous, "/blueprint.Blueprint/Get"), "no key, limited by IP")
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, call(alice, "/blueprint.Blueprint/Other"), "methods without a policy pass")
+	}
+	assert.Equal(t, 7, handled)
+}
+
+func TestCallerKeyTrusted(t *testing.T) {
+	acl, err := netacl.NewACLWithOptions(nil, netacl.Options{TrustedProxies: []string{"127.0.0.1"}})
+	require.NoError(t, err)
+
+	key := func(from string, kv ...string) string {
+		ctx := peer.NewContext(metadata.NewIncomingContext(context.Background(), metadata.Pairs(kv...)),
+			&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(from), Port: 4000}})
+		var got string
+		ctxmeta.UnaryServerInterceptor(acl)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/blueprint.Blueprint/Call"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				got = CallerKey(ctx, KeyUser, "")
+				return nil, nil
+			})
+		return got
+	}
+
+	assert.Equal(t, "user:42", key("127.0.0.1", ctxmeta.HeaderUserID, "42", ctxmeta.HeaderForwarded, "198.51.100.7"))
+	assert.Equal(t, "ip:198.51.100.7", key("127.0.0.1", ctxmeta.HeaderForwarded, "198.51.100.7"))
+	assert.Equal(t, "ip:203.0.113.5", key("203.0.113.5", ctxmeta.HeaderUserID, "42", ctxmeta.HeaderForwarded, "10.0.0.1"),
+		"an untrusted peer can't name a user or address")
+}
+
+func TestHeaders(t *testing.T) {
+	md := Headers(Decision{Limit: 20, Remaining: 7, Reset: time.Unix(1792195200, 0)})
+	assert.Equal(t, []string{"20"}, md.Get("x-ratelimit-limit"))
+	assert.Equal(t, []string{"7"}, md.Get("x-ratelimit-remaining"))
+	assert.Equal(t, []string{"1792195200"}, md.Get("x-ratelimit-reset"))
+}
+
+func TestNewInterceptorWarnAt(t *testing.T) {
+	i := NewInterceptor([]Policy{
+		{Method: "Call", Rate: 100, Period: time.Minute, Burst: 100},
+		{Method: "Get", Rate: 10, Period: time.Minute, Burst: 10, Warn: 5},
+		{Method: "List", Rate: 3, Period: time.Minute, Burst: 3},
+	}, "x-api-key", 0.2, nil, nil)
+	assert.Equal(t, 20, i.limiters[0].policy.Warn)
+	assert.Equal(t, 5, i.limiters[1].policy.Warn, "its own")
+	assert.Equal(t, 1, i.limiters[2].policy.Warn, "rounded up")
+
+	assert.Equal(t, "apikey:k1-s...", redact("apikey:k1-secret"))
+	assert.Equal(t, "user:alice", redact("user:alice"))
+}
@@ -0,0 +1,189 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package ratelimit limits calls per method and caller with token buckets
+// kept in this replica's memory.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/grpcmethod"
+)
+
+// Key extractors, who a bucket belongs to
+const (
+	// KeyUser is the x-user-id set by the gateway, see ctxmeta.Peers
+	KeyUser = "user"
+	// KeyIP is the client address, behind trusted proxies the last
+	// x-forwarded-for hop they did not add
+	KeyIP = "ip"
+	// KeyAPIKey is the API key header, the one quotas are charged to
+	KeyAPIKey = "apikey"
+)
+
+// Policy limits one method. Method is matched like cache.Policy, the full
+// method, the service or the bare method name. Each caller gets Rate calls
+// per Period with bursts of up to Burst calls. A caller left with Warn
+// calls or fewer is warned about, 0 never.
+type Policy struct {
+	Method string
+	Rate   int
+	Period time.Duration
+	Burst  int
+	Key    string
+	Warn   int
+}
+
+// ParsePolicy reads "method=rate/period[:burst][:key]", e.g.
+// "Call=100/1m:20:user". Burst defaults to rate and key to user.
+func ParsePolicy(spec string) (Policy, error) {
+	method, rest, ok := strings.Cut(spec, "=")
+	if !ok || strings.TrimSpace(method) == "" {
+		return Policy{}, fmt.Errorf("rate limit %q: want method=rate/period[:burst][:key]", spec)
+	}
+
+	parts := strings.Split(rest, ":")
+	rateSpec, periodSpec, ok := strings.Cut(parts[0], "/")
+	rate, err := strconv.Atoi(rateSpec)
+	if !ok || err != nil || rate <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %q: invalid rate %q", spec, parts[0])
+	}
+	period, err := time.ParseDuration(periodSpec)
+	if err != nil || period <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %q: invalid period %q", spec, periodSpec)
+	}
+
+	p := Policy{Method: strings.TrimSpace(method), Rate: rate, Period: period, Burst: rate, Key: KeyUser}
+	for _, part := range parts[1:] {
+		switch part {
+		case KeyUser, KeyIP, KeyAPIKey:
+			p.Key = part
+			continue
+		}
+		burst, err := strconv.Atoi(part)
+		if err != nil || burst <= 0 {
+			return Policy{}, fmt.Errorf("rate limit %q: %q is neither a burst nor one of user, ip, apikey", spec, part)
+		}
+		p.Burst = burst
+	}
+	return p, nil
+}
+
+func (p Policy) matches(fullMethod string) bool {
+	return grpcmethod.Match(p.Method, fullMethod)
+}
+
+// interval is the time it takes to earn back one call
+func (p Policy) interval() time.Duration {
+	return p.Period / time.Duration(p.Rate)
+}
+
+// Limiter keeps a token bucket per caller for one policy. Buckets that
+// have filled up again are dropped once a period, so idle callers cost
+// nothing.
+type Limiter struct {
+	policy Policy
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// warned since the bucket was last full
+	warned bool
+}
+
+// NewLimiter uses the wall clock when clk is nil
+func NewLimiter(p Policy, clk clock.Clock) *Limiter {
+	return &Limiter{
+		policy:  p,
+		clock:   clock.Or(clk),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Decision is what Take made of one call
+type Decision struct {
+	Allowed bool
+	// Limit is the burst, the most calls a caller has at once
+	Limit int
+	// Remaining are the whole calls left after this one
+	Remaining int
+	// Reset is when the bucket is full again
+	Reset time.Time
+	// RetryAfter is how long until a refused call would be allowed
+	RetryAfter time.Duration
+	// Warn is set on the first call that leaves Policy.Warn calls or
+	// fewer, the next only after the bucket filled up again
+	Warn bool
+}
+
+// Allow takes a call from key's bucket. When it is empty the call is
+// refused and retryAfter is how long until the next one is allowed.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	d := l.Take(key)
+	return d.Allowed, d.RetryAfter
+}
+
+// Take is Allow with what is left of key's bucket
+func (l *Limiter) Take(key string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.sweep(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(l.policy.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.refill(now, l.policy)
+
+	d := Decision{Limit: l.policy.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = time.Duration((1 - b.tokens) * float64(l.policy.interval()))
+	}
+	d.Remaining = int(b.tokens)
+	if d.Allowed && l.policy.Warn > 0 && d.Remaining <= l.policy.Warn && !b.warned {
+		d.Warn, b.warned = true, true
+	}
+	d.Reset = now.Add(time.Duration((float64(l.policy.Burst) - b.tokens) * float64(l.policy.interval())))
+	return d
+}
+
+func (b *bucket) refill(now time.Time, p Policy) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(elapsed) / float64(p.interval())
+		if b.tokens >= float64(p.Burst) {
+			b.tokens = float64(p.Burst)
+			b.warned = false
+		}
+		b.last = now
+	}
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.policy.Period {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		b.refill(now, l.policy)
+		if b.tokens >= float64(l.policy.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/specs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("Call=100/1m")
+	require.NoError(t, err)
+	assert.Equal(t, Policy{Method: "Call", Rate: 100, Period: time.Minute, Burst: 100, Key: KeyUser}, p)
+
+	p, err = ParsePolicy("/blueprint.Blueprint/Call=10/1s:20:apikey")
+	require.NoError(t, err)
+	assert.Equal(t, Policy{Method: "/blueprint.Blueprint/Call", Rate: 10, Period: time.Second, Burst: 20, Key: KeyAPIKey}, p)
+
+	p, err = ParsePolicy("Call=5/1h:ip")
+	require.NoError(t, err)
+	assert.Equal(t, 5, p.Burst)
+	assert.Equal(t, KeyIP, p.Key)
+
+	for _, bad := range []string{"Call", "=1/1s", "Call=0/1s", "Call=1", "Call=1/0s", "Call=1/1s:host", "Call=1/1s:-2"} {
+		_, err := ParsePolicy(bad)
+		assert.Error(t, err, bad)
+	}
+
+	_, err = specs.ParseAll([]string{"Call=1/1s", "Call=x"}, ParsePolicy)
+	assert.Error(t, err, "one bad spec fails the lot")
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	l := NewLimiter(Policy{Rate: 10, Period: time.Second, Burst: 3}, clk)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("alice")
+		require.True(t, ok)
+	}
+	ok, retryAfter := l.Allow("alice")
+	assert.False(t, ok, "burst used up")
+	assert.Equal(t, 100*time.Millisecond, retryAfter)
+
+	ok, _ = l.Allow("bob")
+	assert.True(t, ok, "buckets are per key")
+
+	clk.Advance(100 * time.Millisecond)
+	ok, _ = l.Allow("alice")
+	assert.True(t, ok, "one call earned back")
+	ok, _ = l.Allow("alice")
+	assert.False(t, ok)
+
+	clk.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("alice")
+		require.True(t, ok, "refills up to the burst only")
+	}
+	ok, _ = l.Allow("alice")
+	assert.False(t, ok)
+}
+
+func TestLimiterDropsIdleBuckets(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	l := NewLimiter(Policy{Rate: 1, Period: time.Second, Burst: 1}, clk)
+
+	l.Allow("alice")
+	clk.Advance(time.Second)
+	l.Allow("bob")
+	assert.NotContains(t, l.buckets, "alice", "full again, dropped")
+	assert.Contains(t, l.buckets, "bob")
+}
+
+func TestLimiterTake(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	l := NewLimiter(Policy{Rate: 10, Period: time.Second, Burst: 4, Warn: 1}, clk)
+
+	d := l.Take("alice")
+	assert.Equal(t, Decision{Allowed: true, Limit: 4, Remaining: 3, Reset: time.Unix(0, 0).Add(100 * time.Millisecond)}, d)
+
+	l.Take("alice")
+	d = l.Take("alice")
+	assert.True(t, d.Warn, "one call left")
+	d = l.Take("alice")
+	assert.False(t, d.Warn, "warned once")
+	assert.Equal(t, 0, d.Remaining)
+
+	d = l.Take("alice")
+	assert.False(t, d.Allowed)
+	assert.False(t, d.Warn, "refused calls are not warned about")
+	assert.Equal(t, 100*time.Millisecond, d.RetryAfter)
+	assert.Equal(t, time.Unix(0, 0).Add(400*time.Millisecond), d.Reset)
+
+	clk.Advance(200 * time.Millisecond)
+	l.Take("alice")
+	assert.False(t, l.Take("alice").Warn, "not full in between")
+
+	clk.Advance(time.Second)
+	for i := 0; i < 2; i++ {
+		l.Take("alice")
+	}
+	assert.True(t, l.Take("alice").Warn, "again once it filled up")
+}
@@ -0,0 +1,46 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package redact masks fields of decoded JSON, for payload logs and golden
+// files alike.
+package redact
+
+import "strings"
+
+// Placeholder replaces the value of a redacted field
+const Placeholder = "[REDACTED]"
+
+// Fields are the field names to redact, matched case insensitively
+type Fields map[string]struct{}
+
+func NewFields(names ...string) Fields {
+	f := make(Fields, len(names))
+	f.Add(names...)
+	return f
+}
+
+func (f Fields) Add(names ...string) {
+	for _, name := range names {
+		f[strings.ToLower(name)] = struct{}{}
+	}
+}
+
+// Value replaces the fields at any depth of v, a tree encoding/json
+// decoded into interface{}, with Placeholder. Maps and slices are changed
+// in place.
+func Value(v interface{}, fields Fields) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if _, ok := fields[strings.ToLower(k)]; ok {
+				t[k] = Placeholder
+				continue
+			}
+			t[k] = Value(val, fields)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = Value(val, fields)
+		}
+	}
+	return v
+}
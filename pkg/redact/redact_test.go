@@ -0,0 +1,28 @@
+package redact
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValue(t *testing.T) {
+	var v interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"Password": "hunter2",
+		"user": {"name": "ada", "token": {"value": "abc"}},
+		"keys": [{"api_key": "k1"}, {"id": 2}]
+	}`), &v))
+
+	out, err := json.Marshal(Value(v, NewFields("password", "TOKEN", "api_key")))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Password": "[REDACTED]",
+		"user": {"name": "ada", "token": "[REDACTED]"},
+		"keys": [{"api_key": "[REDACTED]"}, {"id": 2}]
+	}`, string(out))
+
+	assert.Equal(t, "plain", Value("plain", NewFields("plain")), "only field names match")
+}
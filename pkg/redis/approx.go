@@ -0,0 +1,311 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// UniqueCounter counts distinct items with a HyperLogLog, about 12KB per
+// key whatever the number of items, with a standard error of 0.81%
+type UniqueCounter struct {
+	client *redis.Client
+	key    string
+	ttl    time.Duration
+}
+
+// NewUniqueCounter counts under key, ttl 0 never expires it. Every Add
+// renews the ttl.
+func NewUniqueCounter(client *redis.Client, key string, ttl time.Duration) *UniqueCounter {
+	return &UniqueCounter{client: client, key: key, ttl: ttl}
+}
+
+func (r *RedisClient) UniqueCounter(key string, ttl time.Duration) *UniqueCounter {
+	return NewUniqueCounter(r.client, key, ttl)
+}
+
+// Add records items and reports whether the estimate changed
+func (u *UniqueCounter) Add(ctx context.Context, items ...string) (bool, error) {
+	if len(items) == 0 {
+		return false, nil
+	}
+	var added *redis.IntCmd
+	_, err := u.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		added = pipe.PFAdd(ctx, u.key, toArgs(items)...)
+		if u.ttl > 0 {
+			pipe.Expire(ctx, u.key, u.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("unique counter %s: %w", u.key, err)
+	}
+	return added.Val() == 1, nil
+}
+
+// Count is the estimated number of distinct items
+func (u *UniqueCounter) Count(ctx context.Context) (int64, error) {
+	return u.client.PFCount(ctx, u.key).Result()
+}
+
+// CountWith estimates the distinct items across this and other counters,
+// e.g. daily counters for a weekly figure, without changing any of them
+func (u *UniqueCounter) CountWith(ctx context.Context, others ...*UniqueCounter) (int64, error) {
+	keys := []string{u.key}
+	for _, o := range others {
+		keys = append(keys, o.key)
+	}
+	return u.client.PFCount(ctx, keys...).Result()
+}
+
+// Merge folds others into this counter
+func (u *UniqueCounter) Merge(ctx context.Context, others ...*UniqueCounter) error {
+	keys := make([]string, 0, len(others))
+	for _, o := range others {
+		keys = append(keys, o.key)
+	}
+	return u.client.PFMerge(ctx, u.key, keys...).Err()
+}
+
+const (
+	BloomModeRedisBloom = "redisbloom"
+	BloomModeBitmap     = "bitmap"
+
+	defaultBloomCapacity  = 1_000_000
+	defaultBloomErrorRate = 0.01
+	// a redis string holds at most 512MB
+	maxBloomBits = 1 << 32
+)
+
+// BloomOptions size a BloomFilter for Capacity items at ErrorRate false
+// positives, both only apply when the filter is first created
+type BloomOptions struct {
+	Capacity  int64
+	ErrorRate float64
+	// TTL is renewed on every Add, 0 never expires the filter
+	TTL time.Duration
+}
+
+// BloomFilter answers "seen before?" for event ids and the like without
+// keeping the ids. It uses RedisBloom when the server has the module and
+// falls back to a bitmap with the same sizing otherwise. A filter never
+// forgets and may say yes for an item it has not seen, at ErrorRate.
+type BloomFilter struct {
+	client *redis.Client
+	key    string
+	opts   BloomOptions
+	mode   string
+	bits   uint64
+	hashes int
+}
+
+// NewBloomFilter creates the filter under key unless it exists and picks
+// the implementation
+func NewBloomFilter(ctx context.Context, client *redis.Client, key string, opts BloomOptions) (*BloomFilter, error) {
+	if opts.Capacity <= 0 {
+		opts.Capacity = defaultBloomCapacity
+	}
+	if opts.ErrorRate <= 0 || opts.ErrorRate >= 1 {
+		opts.ErrorRate = defaultBloomErrorRate
+	}
+
+	b := &BloomFilter{client: client, key: key, opts: opts, mode: BloomModeRedisBloom}
+
+	err := client.BFReserve(ctx, key, opts.ErrorRate, opts.Capacity).Err()
+	switch {
+	case err == nil, isBloomExists(err):
+	case isUnknownCommand(err):
+		b.mode = BloomModeBitmap
+		b.bits, b.hashes = bloomSize(opts.Capacity, opts.ErrorRate)
+	default:
+		return nil, fmt.Errorf("bloom filter %s: %w", key, err)
+	}
+	return b, nil
+}
+
+func (r *RedisClient) BloomFilter(ctx context.Context, key string, opts BloomOptions) (*BloomFilter, error) {
+	return NewBloomFilter(ctx, r.client, key, opts)
+}
+
+// Mode is BloomModeRedisBloom or BloomModeBitmap
+func (b *BloomFilter) Mode() string {
+	return b.mode
+}
+
+// Add records items, for each it reports whether it was new. An item
+// reported as not new may be a false positive.
+func (b *BloomFilter) Add(ctx context.Context, items ...string) ([]bool, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	var added []bool
+	var err error
+	if b.mode == BloomModeRedisBloom {
+		added, err = b.addModule(ctx, items)
+	} else {
+		added, err = b.addBitmap(ctx, items)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bloom filter %s add: %w", b.key, err)
+	}
+	return added, nil
+}
+
+// Exists reports for each item whether it may have been added
+func (b *BloomFilter) Exists(ctx context.Context, items ...string) ([]bool, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	var found []bool
+	var err error
+	if b.mode == BloomModeRedisBloom {
+		found, err = b.client.BFMExists(ctx, b.key, toArgs(items)...).Result()
+	} else {
+		found, err = b.existsBitmap(ctx, items)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bloom filter %s exists: %w", b.key, err)
+	}
+	return found, nil
+}
+
+// Seen adds id and reports whether it was probably added before, for
+// dropping duplicate events
+func (b *BloomFilter) Seen(ctx context.Context, id string) (bool, error) {
+	added, err := b.Add(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return !added[0], nil
+}
+
+// Delete drops the filter, the next NewBloomFilter starts empty
+func (b *BloomFilter) Delete(ctx context.Context) error {
+	return b.client.Del(ctx, b.key).Err()
+}
+
+func (b *BloomFilter) addModule(ctx context.Context, items []string) ([]bool, error) {
+	var added *redis.BoolSliceCmd
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		added = pipe.BFMAdd(ctx, b.key, toArgs(items)...)
+		b.expire(ctx, pipe)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added.Val(), nil
+}
+
+// addBitmap sets every item's bits, an item is new when one of them was unset
+func (b *BloomFilter) addBitmap(ctx context.Context, items []string) ([]bool, error) {
+	cmds := make([][]*redis.IntCmd, len(items))
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, item := range items {
+			for _, pos := range bloomPositions(item, b.bits, b.hashes) {
+				cmds[i] = append(cmds[i], pipe.SetBit(ctx, b.key, int64(pos), 1))
+			}
+		}
+		b.expire(ctx, pipe)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	added := make([]bool, len(items))
+	for i, bits := range cmds {
+		for _, c := range bits {
+			if c.Val() == 0 {
+				added[i] = true
+				break
+			}
+		}
+	}
+	return added, nil
+}
+
+func (b *BloomFilter) existsBitmap(ctx context.Context, items []string) ([]bool, error) {
+	cmds := make([][]*redis.IntCmd, len(items))
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, item := range items {
+			for _, pos := range bloomPositions(item, b.bits, b.hashes) {
+				cmds[i] = append(cmds[i], pipe.GetBit(ctx, b.key, int64(pos)))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]bool, len(items))
+	for i, bits := range cmds {
+		found[i] = true
+		for _, c := range bits {
+			if c.Val() == 0 {
+				found[i] = false
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+func (b *BloomFilter) expire(ctx context.Context, pipe redis.Pipeliner) {
+	if b.opts.TTL > 0 {
+		pipe.Expire(ctx, b.key, b.opts.TTL)
+	}
+}
+
+// bloomSize is the optimal number of bits and hash functions for n items
+// at false positive rate p
+func bloomSize(n int64, p float64) (uint64, int) {
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	if m > maxBloomBits {
+		m = maxBloomBits
+	}
+	k := int(math.Round(m / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return uint64(m), k
+}
+
+// bloomPositions derives k bit positions from two FNV hashes
+// (Kirsch-Mitzenmacher double hashing)
+func bloomPositions(item string, m uint64, k int) []uint64 {
+	h1 := fnv.New64a()
+	h1.Write([]byte(item))
+	h2 := fnv.New64()
+	h2.Write([]byte(item))
+	a, c := h1.Sum64(), h2.Sum64()|1
+
+	pos := make([]uint64, k)
+	for i := range pos {
+		pos[i] = (a + uint64(i)*c) % m
+	}
+	return pos
+}
+
+func isBloomExists(err error) bool {
+	return strings.Contains(err.Error(), "item exists")
+}
+
+func isUnknownCommand(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "unknown command")
+}
+
+func toArgs(items []string) []interface{} {
+	args := make([]interface{}, len(items))
+	for i, item := range items {
+		args[i] = item
+	}
+	return args
+}
@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomSize(t *testing.T) {
+	bits, hashes := bloomSize(1_000_000, 0.01)
+	assert.Equal(t, uint64(9585059), bits)
+	assert.Equal(t, 7, hashes)
+
+	pos := bloomPositions("evt-1", bits, hashes)
+	assert.Len(t, pos, hashes)
+	assert.Equal(t, pos, bloomPositions("evt-1", bits, hashes), "positions are stable")
+	for _, p := range pos {
+		assert.Less(t, p, bits)
+	}
+}
+
+func TestUniqueCounter(t *testing.T) {
+	ctx := context.Background()
+	client := testsupport.Redis(t)
+	monday := NewUniqueCounter(client, "uv:mon", 0)
+	tuesday := NewUniqueCounter(client, "uv:tue", 0)
+
+	changed, err := monday.Add(ctx, "alice", "bob", "alice")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	_, err = tuesday.Add(ctx, "bob", "carol")
+	require.NoError(t, err)
+
+	n, err := monday.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	n, err = monday.CountWith(ctx, tuesday)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+}
+
+func TestBloomFilter(t *testing.T) {
+	ctx := context.Background()
+	bf, err := NewBloomFilter(ctx, testsupport.Redis(t), "bf:events", BloomOptions{Capacity: 1000, ErrorRate: 0.001})
+	require.NoError(t, err)
+	t.Logf("bloom filter mode %s", bf.Mode())
+
+	seen, err := bf.Seen(ctx, "evt-1")
+	require.NoError(t, err)
+	assert.False(t, seen)
+	seen, err = bf.Seen(ctx, "evt-1")
+	require.NoError(t, err)
+	assert.True(t, seen)
+
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, fmt.Sprintf("evt-%d", i+100))
+	}
+	added, err := bf.Add(ctx, ids...)
+	require.NoError(t, err)
+	assert.NotContains(t, added, false, "no false positives expected at this size")
+
+	found, err := bf.Exists(ctx, "evt-100", "evt-never")
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, found)
+}
@@ -0,0 +1,126 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	apperrors "blueprint/pkg/errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultBatchSize = 500
+
+// BatchOptions tune BatchExec
+type BatchOptions struct {
+	// Size is the number of commands per pipeline, 500 when 0
+	Size int
+	// Retry applies to each chunk. Only commands that failed with a network
+	// error are sent again, redis errors such as WRONGTYPE are final.
+	// Retryable defaults to network errors.
+	Retry apperrors.RetryOptions
+}
+
+// BatchError lists the inputs whose command failed, by input index.
+// redis.Nil replies are not failures.
+type BatchError struct {
+	Failed map[int]error
+}
+
+func (e *BatchError) Error() string {
+	first := e.Indexes()[0]
+	return fmt.Sprintf("redis batch: %d commands failed, first input %d: %v", len(e.Failed), first, e.Failed[first])
+}
+
+// Indexes are the failed inputs in order
+func (e *BatchError) Indexes() []int {
+	idx := make([]int, 0, len(e.Failed))
+	for i := range e.Failed {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	return idx
+}
+
+// BatchExec queues build(pipe, i) for every input i in [0, n) and sends
+// them in pipelines of opts.Size commands, so a bulk load of thousands of
+// keys neither blocks redis on one huge pipeline nor pays a round trip per
+// key. build queues exactly one command and returns it.
+//
+// The commands come back indexed like the inputs. When some fail the error
+// is a *BatchError, the other commands still ran. A command retried after a
+// network error may have been applied before the connection broke, keep
+// retried batches idempotent (SET, HSET) or set Retry.Attempts to 1.
+func BatchExec(ctx context.Context, client redis.Cmdable, n int, build func(pipe redis.Pipeliner, i int) redis.Cmder, opts BatchOptions) ([]redis.Cmder, error) {
+	if opts.Size <= 0 {
+		opts.Size = defaultBatchSize
+	}
+	if opts.Retry.Retryable == nil {
+		opts.Retry.Retryable = isConnError
+	}
+
+	cmds := make([]redis.Cmder, n)
+	for start := 0; start < n; start += opts.Size {
+		end := start + opts.Size
+		if end > n {
+			end = n
+		}
+		pending := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			pending = append(pending, i)
+		}
+
+		// the error is per command, the chunk is retried through pending
+		_ = apperrors.Retry(ctx, opts.Retry, func(ctx context.Context) error {
+			pipe := client.Pipeline()
+			for _, i := range pending {
+				cmds[i] = build(pipe, i)
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				failUnsent(cmds, pending, err)
+			}
+
+			var retry []int
+			var last error
+			for _, i := range pending {
+				if err := cmds[i].Err(); isConnError(err) {
+					retry = append(retry, i)
+					last = err
+				}
+			}
+			pending = retry
+			return last
+		})
+	}
+
+	failed := make(map[int]error)
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+			failed[i] = err
+		}
+	}
+	if len(failed) > 0 {
+		return cmds, &BatchError{Failed: failed}
+	}
+	return cmds, nil
+}
+
+// failUnsent sets err on the commands of a pipeline that never got a
+// connection, go-redis only sets command errors once something was written
+func failUnsent(cmds []redis.Cmder, pending []int, err error) {
+	for _, i := range pending {
+		if cmds[i].Err() != nil {
+			return
+		}
+	}
+	for _, i := range pending {
+		cmds[i].SetErr(err)
+	}
+}
+
+func (r *RedisClient) BatchExec(ctx context.Context, n int, build func(pipe redis.Pipeliner, i int) redis.Cmder, opts BatchOptions) ([]redis.Cmder, error) {
+	return BatchExec(ctx, r.client, n, build, opts)
+}
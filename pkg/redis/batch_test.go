@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	apperrors "blueprint/pkg/errors"
+	"blueprint/pkg/testsupport"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchExec(t *testing.T) {
+	ctx := context.Background()
+	client := testsupport.Redis(t)
+	require.NoError(t, client.LPush(ctx, "batch:list", "x").Err())
+
+	keys := make([]string, 25)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("batch:%d", i)
+	}
+	keys[7] = "batch:list"
+
+	pipelines := 0
+	client.AddHook(pipelineCounter{n: &pipelines})
+
+	_, err := BatchExec(ctx, client, len(keys), func(pipe redis.Pipeliner, i int) redis.Cmder {
+		if keys[i] == "batch:list" {
+			return pipe.Incr(ctx, keys[i])
+		}
+		return pipe.Set(ctx, keys[i], i, 0)
+	}, BatchOptions{Size: 10})
+
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, []int{7}, batchErr.Indexes(), "a WRONGTYPE reply maps back to its input")
+	assert.Equal(t, 3, pipelines, "25 commands in chunks of 10")
+
+	cmds, err := BatchExec(ctx, client, len(keys), func(pipe redis.Pipeliner, i int) redis.Cmder {
+		return pipe.Get(ctx, keys[i]+":missing")
+	}, BatchOptions{Size: 10})
+	require.NoError(t, err, "misses are not failures")
+	assert.ErrorIs(t, cmds[0].Err(), redis.Nil)
+
+	cmds, err = BatchExec(ctx, client, 3, func(pipe redis.Pipeliner, i int) redis.Cmder {
+		return pipe.Get(ctx, keys[i])
+	}, BatchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "2", cmds[2].(*redis.StringCmd).Val())
+}
+
+func TestBatchExecRetriesNetworkErrors(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer client.Close()
+
+	builds := make(map[int]int)
+	_, err := BatchExec(context.Background(), client, 5, func(pipe redis.Pipeliner, i int) redis.Cmder {
+		builds[i]++
+		return pipe.Set(context.Background(), "k", i, 0)
+	}, BatchOptions{Size: 2, Retry: apperrors.RetryOptions{Attempts: 2, BaseDelay: time.Millisecond}})
+
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, batchErr.Indexes())
+	assert.Equal(t, map[int]int{0: 2, 1: 2, 2: 2, 3: 2, 4: 2}, builds, "every chunk is sent Attempts times")
+}
+
+type pipelineCounter struct {
+	n *int
+}
+
+func (h pipelineCounter) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h pipelineCounter) ProcessHook(next redis.ProcessHook) redis.ProcessHook { return next }
+
+func (h pipelineCounter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		*h.n++
+		return next(ctx, cmds)
+	}
+}
@@ -0,0 +1,295 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultHealthInterval = 5 * time.Second
+	reconnectMinBackoff   = 100 * time.Millisecond
+	reconnectMaxBackoff   = 10 * time.Second
+	poolTimeoutError      = "redis: connection pool timeout"
+)
+
+var (
+	connDegraded = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "blueprint_redis_degraded",
+		Help: "1 while the redis connection is lost and being re-established.",
+	})
+
+	connLosses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blueprint_redis_connection_losses_total",
+		Help: "Times the redis connection was lost.",
+	})
+
+	reconnectAttempts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blueprint_redis_reconnect_attempts_total",
+		Help: "Probes sent to redis while degraded.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(connDegraded, connLosses, reconnectAttempts)
+}
+
+type ConnState int
+
+const (
+	StateConnected ConnState = iota
+	// StateDegraded means the last dial or command failed on the network,
+	// the client keeps probing with backoff until redis answers again
+	StateDegraded
+)
+
+func (s ConnState) String() string {
+	if s == StateDegraded {
+		return "degraded"
+	}
+	return "connected"
+}
+
+// ConnStatus is the connection state as of the last dial, command or probe
+type ConnStatus struct {
+	State ConnState
+	// Since is when State was entered
+	Since time.Time
+	// Attempts are the reconnect probes sent since the connection was lost
+	Attempts  int
+	Losses    uint64
+	LastError error
+}
+
+// connTracker follows connection health from what the hook sees and a
+// background probe, so readiness turns red when redis goes away and not
+// only when the next request fails
+type connTracker struct {
+	log      *logger.Logger
+	clock    clock.Clock
+	interval time.Duration
+
+	mu        sync.Mutex
+	status    ConnStatus
+	listeners []func(ConnStatus)
+
+	cancel context.CancelFunc
+	group  *run.Group
+}
+
+func newConnTracker(log *logger.Logger, interval time.Duration, c clock.Clock) *connTracker {
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	c = clock.Or(c)
+	return &connTracker{
+		log:      log,
+		clock:    c,
+		interval: interval,
+		status:   ConnStatus{State: StateConnected, Since: c.Now()},
+	}
+}
+
+func (t *connTracker) Status() ConnStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+func (t *connTracker) onChange(fn func(ConnStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.listeners = append(t.listeners, fn)
+}
+
+// observe records the outcome of a dial or command
+func (t *connTracker) observe(err error) {
+	if err != nil && !isConnError(err) {
+		return
+	}
+
+	t.mu.Lock()
+	prev := t.status
+	if err != nil {
+		t.status.LastError = err
+		if prev.State == StateDegraded {
+			t.mu.Unlock()
+			return
+		}
+		t.status.State = StateDegraded
+		t.status.Since = t.clock.Now()
+		t.status.Attempts = 0
+		t.status.Losses++
+	} else {
+		if prev.State == StateConnected {
+			t.mu.Unlock()
+			return
+		}
+		t.status.State = StateConnected
+		t.status.Since = t.clock.Now()
+	}
+	status := t.status
+	listeners := append([]func(ConnStatus){}, t.listeners...)
+	t.mu.Unlock()
+
+	if status.State == StateDegraded {
+		connDegraded.Set(1)
+		connLosses.Inc()
+		if t.log != nil {
+			t.log.Warnw("Redis connection lost", "error", err.Error())
+		}
+	} else {
+		connDegraded.Set(0)
+		if t.log != nil {
+			t.log.Infow("Redis connection restored",
+				"attempts", prev.Attempts,
+				"downtime", status.Since.Sub(prev.Since))
+		}
+	}
+
+	for _, fn := range listeners {
+		fn(status)
+	}
+}
+
+// start probes with ping every interval while connected and with growing
+// backoff while degraded, ping goes through the hook which records the result
+func (t *connTracker) start(ping func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+
+	t.group = run.NewGroup(ctx, t.log)
+	t.group.Supervise("redis_conn_probe", func(ctx context.Context) error {
+		for {
+			timer := t.clock.NewTimer(t.next())
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-timer.C():
+			}
+
+			if t.Status().State == StateDegraded {
+				t.mu.Lock()
+				t.status.Attempts++
+				t.mu.Unlock()
+				reconnectAttempts.Inc()
+			}
+
+			// no deadline of our own, the client's dial and read timeouts
+			// bound the probe and a hung redis counts as a failure
+			ping(ctx)
+		}
+	}, run.Options{Clock: t.clock})
+}
+
+func (t *connTracker) close() {
+	if t.cancel == nil {
+		return
+	}
+	t.cancel()
+	t.group.Wait()
+}
+
+// next is the wait before the following probe
+func (t *connTracker) next() time.Duration {
+	s := t.Status()
+	if s.State == StateConnected {
+		return t.interval
+	}
+	d := reconnectMinBackoff << s.Attempts
+	if d <= 0 || d > reconnectMaxBackoff {
+		d = reconnectMaxBackoff
+	}
+	return d
+}
+
+// connHook feeds every dial and command result to the tracker
+type connHook struct {
+	t *connTracker
+}
+
+func (h connHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			h.observe(ctx, err)
+		}
+		return conn, err
+	}
+}
+
+// observe skips calls whose context ended, the caller gave up and redis
+// may be fine
+func (h connHook) observe(ctx context.Context, err error) {
+	if ctx.Err() == nil {
+		h.t.observe(err)
+	}
+}
+
+func (h connHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		h.observe(ctx, err)
+		return err
+	}
+}
+
+func (h connHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		h.observe(ctx, err)
+		return err
+	}
+}
+
+// isConnError is true for errors that say redis is unreachable. Replies
+// from the server, misses, pool contention and our own Close say nothing
+// about the connection. go-redis does not export its pool timeout error.
+func isConnError(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) || errors.Is(err, redis.ErrClosed) || err.Error() == poolTimeoutError {
+		return false
+	}
+	var reply redis.Error
+	return !errors.As(err, &reply)
+}
+
+// State is StateDegraded from the first network failure until redis
+// answers again
+func (r *RedisClient) State() ConnState {
+	return r.conn.Status().State
+}
+
+func (r *RedisClient) Degraded() bool {
+	return r.State() == StateDegraded
+}
+
+func (r *RedisClient) ConnStatus() ConnStatus {
+	return r.conn.Status()
+}
+
+// OnStateChange calls fn on every transition between connected and
+// degraded, for circuit breakers and the like. fn must not block.
+func (r *RedisClient) OnStateChange(fn func(ConnStatus)) {
+	r.conn.onChange(fn)
+}
+
+// Readiness fails right away while degraded, otherwise it pings
+func (r *RedisClient) Readiness(ctx context.Context) error {
+	if s := r.conn.Status(); s.State == StateDegraded {
+		return fmt.Errorf("redis degraded since %s after %d reconnect attempts: %v",
+			s.Since.Format(time.RFC3339), s.Attempts, s.LastError)
+	}
+	return r.Ping(ctx)
+}
@@ -0,0 +1,204 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsConnError(t *testing.T) {
+	assert.True(t, isConnError(io.EOF))
+	assert.True(t, isConnError(errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")))
+
+	assert.False(t, isConnError(nil))
+	assert.False(t, isConnError(redis.Nil))
+	assert.False(t, isConnError(redis.ErrClosed))
+	assert.False(t, isConnError(errors.New(poolTimeoutError)))
+}
+
+func TestConnTrackerReconnect(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	tracker := newConnTracker(nil, time.Second, fake)
+	rc := &RedisClient{conn: tracker}
+
+	var mu sync.Mutex
+	var down bool
+	pinged := make(chan struct{}, 1)
+	tracker.start(func(ctx context.Context) error {
+		mu.Lock()
+		err := error(nil)
+		if down {
+			err = io.EOF
+		}
+		mu.Unlock()
+		tracker.observe(err)
+		pinged <- struct{}{}
+		return err
+	})
+	defer tracker.close()
+
+	var changes []ConnState
+	rc.OnStateChange(func(s ConnStatus) { changes = append(changes, s.State) })
+
+	probe := func(d time.Duration) {
+		t.Helper()
+		fake.BlockUntil(1)
+		fake.Advance(d)
+		select {
+		case <-pinged:
+		case <-time.After(time.Second):
+			t.Fatal("no probe")
+		}
+	}
+
+	probe(time.Second)
+	assert.False(t, rc.Degraded())
+
+	mu.Lock()
+	down = true
+	mu.Unlock()
+
+	// the idle probe notices the loss, then probes back off
+	probe(time.Second)
+	assert.True(t, rc.Degraded())
+	assert.Error(t, rc.Readiness(context.Background()))
+	assert.Equal(t, uint64(1), rc.ConnStatus().Losses)
+
+	probe(100 * time.Millisecond)
+	probe(200 * time.Millisecond)
+	assert.Equal(t, 2, rc.ConnStatus().Attempts)
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+
+	probe(400 * time.Millisecond)
+	s := rc.ConnStatus()
+	assert.Equal(t, StateConnected, s.State)
+	assert.Equal(t, 3, s.Attempts)
+	assert.Equal(t, []ConnState{StateDegraded, StateConnected}, changes)
+}
+
+func TestLazyClientStartsDegraded(t *testing.T) {
+	rc, err := NewRedisClientWithOptions(&config.Config{}, RedisOptions{
+		Addr:        "127.0.0.1:1",
+		DialTimeout: 100 * time.Millisecond,
+		MaxRetries:  -1,
+		Lazy:        true,
+	})
+	if err != nil {
+		t.Fatalf("lazy client: %v", err)
+	}
+	defer rc.Close()
+
+	assert.True(t, rc.Degraded())
+	assert.Error(t, rc.Readiness(context.Background()))
+}
+
+func TestClientFailsWhenUnreachable(t *testing.T) {
+	_, err := NewRedisClientWithOptions(&config.Config{}, RedisOptions{
+		Addr:        "127.0.0.1:1",
+		DialTimeout: 100 * time.Millisecond,
+		MaxRetries:  -1,
+	})
+	assert.Error(t, err)
+}
+
+// fakeModuleServer answers PING and a COMMAND INFO finding only JSON.GET,
+// everything else, HELLO included, is an unknown command
+func fakeModuleServer(t *testing.T, lis net.Listener) {
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					cmd, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					switch strings.ToUpper(cmd[0]) {
+					case "PING":
+						io.WriteString(conn, "+PONG\r\n")
+					case "COMMAND":
+						io.WriteString(conn, "*4\r\n*1\r\n$8\r\njson.get\r\n*-1\r\n*-1\r\n*-1\r\n")
+					default:
+						io.WriteString(conn, "-ERR unknown command\r\n")
+					}
+				}
+			}()
+		}
+	}()
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestLazyClientDetectsModulesOnReconnect(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	rc, err := NewRedisClientWithOptions(&config.Config{}, RedisOptions{
+		Addr:           addr,
+		DialTimeout:    100 * time.Millisecond,
+		MaxRetries:     -1,
+		HealthInterval: 50 * time.Millisecond,
+		Lazy:           true,
+	})
+	if err != nil {
+		t.Fatalf("lazy client: %v", err)
+	}
+	defer rc.Close()
+	assert.False(t, rc.Modules().JSON, "redis was down at start")
+
+	lis, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("port taken meanwhile: %v", err)
+	}
+	fakeModuleServer(t, lis)
+
+	assert.Eventually(t, func() bool { return rc.Modules().JSON }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, rc.Modules().Search)
+}
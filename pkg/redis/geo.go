@@ -0,0 +1,216 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GeoUnit is a distance unit redis understands
+type GeoUnit string
+
+const (
+	Meters     GeoUnit = "m"
+	Kilometers GeoUnit = "km"
+	Miles      GeoUnit = "mi"
+	Feet       GeoUnit = "ft"
+)
+
+var metersPer = map[GeoUnit]float64{
+	Meters:     1,
+	Kilometers: 1000,
+	Miles:      1609.344,
+	Feet:       0.3048,
+}
+
+// Convert turns distance d from unit u into unit to
+func (u GeoUnit) Convert(d float64, to GeoUnit) float64 {
+	return d * u.meters() / to.meters()
+}
+
+// meters per unit, an empty unit is kilometers like redis defaults to
+func (u GeoUnit) meters() float64 {
+	if m, ok := metersPer[u]; ok {
+		return m
+	}
+	return metersPer[Kilometers]
+}
+
+func (u GeoUnit) valid() bool {
+	_, ok := metersPer[u]
+	return ok
+}
+
+// GeoPoint is a named position, e.g. a liquidity provider or a datacenter
+type GeoPoint struct {
+	Name      string
+	Longitude float64
+	Latitude  float64
+}
+
+// GeoResult is a point found by Search with its distance from the query
+// center in the query's unit
+type GeoResult struct {
+	GeoPoint
+	Distance float64
+}
+
+// GeoQuery searches around a coordinate or around FromMember, within
+// Radius or, when Width and Height are set, a box. Results are nearest
+// first unless Farthest is set.
+type GeoQuery struct {
+	Longitude  float64
+	Latitude   float64
+	FromMember string
+
+	Radius float64
+	Width  float64
+	Height float64
+	// Unit applies to Radius, Width, Height and the result distances,
+	// kilometers when empty
+	Unit GeoUnit
+
+	Farthest bool
+	// Offset and Limit page through the results, Limit 0 returns all.
+	// GEOSEARCH has no offset so a page fetches Offset+Limit and drops the
+	// first Offset, keep deep pages for small indexes.
+	Offset int
+	Limit  int
+}
+
+// GeoIndex holds points in one sorted set
+type GeoIndex struct {
+	client *redis.Client
+	key    string
+}
+
+func NewGeoIndex(client *redis.Client, key string) *GeoIndex {
+	return &GeoIndex{client: client, key: key}
+}
+
+func (r *RedisClient) GeoIndex(key string) *GeoIndex {
+	return NewGeoIndex(r.client, key)
+}
+
+// Add stores or moves points
+func (g *GeoIndex) Add(ctx context.Context, points ...GeoPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	locs := make([]*redis.GeoLocation, len(points))
+	for i, p := range points {
+		locs[i] = &redis.GeoLocation{Name: p.Name, Longitude: p.Longitude, Latitude: p.Latitude}
+	}
+	if err := g.client.GeoAdd(ctx, g.key, locs...).Err(); err != nil {
+		return fmt.Errorf("geo %s add: %w", g.key, err)
+	}
+	return nil
+}
+
+func (g *GeoIndex) Remove(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	return g.client.ZRem(ctx, g.key, toArgs(names)...).Err()
+}
+
+// Position returns where name is stored, an error wrapping redis.Nil when
+// it is not. Redis stores positions as geohashes, expect drift in the
+// sixth decimal.
+func (g *GeoIndex) Position(ctx context.Context, name string) (GeoPoint, error) {
+	pos, err := g.client.GeoPos(ctx, g.key, name).Result()
+	if err != nil {
+		return GeoPoint{}, fmt.Errorf("geo %s position %s: %w", g.key, name, err)
+	}
+	if len(pos) == 0 || pos[0] == nil {
+		return GeoPoint{}, fmt.Errorf("geo %s: %s not found: %w", g.key, name, redis.Nil)
+	}
+	return GeoPoint{Name: name, Longitude: pos[0].Longitude, Latitude: pos[0].Latitude}, nil
+}
+
+// Distance between two stored points, an error wrapping redis.Nil when
+// either is missing
+func (g *GeoIndex) Distance(ctx context.Context, from, to string, unit GeoUnit) (float64, error) {
+	if unit == "" {
+		unit = Kilometers
+	}
+	d, err := g.client.GeoDist(ctx, g.key, from, to, string(unit)).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("geo %s: %s or %s not found: %w", g.key, from, to, redis.Nil)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("geo %s distance: %w", g.key, err)
+	}
+	return d, nil
+}
+
+// Search runs q, see GeoQuery
+func (g *GeoIndex) Search(ctx context.Context, q GeoQuery) ([]GeoResult, error) {
+	if q.Unit == "" {
+		q.Unit = Kilometers
+	}
+	if !q.Unit.valid() {
+		return nil, fmt.Errorf("geo %s: unknown unit %q", g.key, q.Unit)
+	}
+	if q.Radius <= 0 && (q.Width <= 0 || q.Height <= 0) {
+		return nil, fmt.Errorf("geo %s: search needs a radius or a box", g.key)
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return nil, fmt.Errorf("geo %s: negative offset or limit", g.key)
+	}
+
+	search := redis.GeoSearchQuery{
+		Member:    q.FromMember,
+		Longitude: q.Longitude,
+		Latitude:  q.Latitude,
+		Sort:      "ASC",
+	}
+	if q.Farthest {
+		search.Sort = "DESC"
+	}
+	if q.Radius > 0 {
+		search.Radius, search.RadiusUnit = q.Radius, string(q.Unit)
+	} else {
+		search.BoxWidth, search.BoxHeight, search.BoxUnit = q.Width, q.Height, string(q.Unit)
+	}
+	if q.Limit > 0 {
+		search.Count = q.Offset + q.Limit
+	}
+
+	locs, err := g.client.GeoSearchLocation(ctx, g.key, &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: search,
+		WithCoord:      true,
+		WithDist:       true,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("geo %s search: %w", g.key, err)
+	}
+
+	if q.Offset >= len(locs) {
+		return []GeoResult{}, nil
+	}
+	locs = locs[q.Offset:]
+
+	results := make([]GeoResult, len(locs))
+	for i, l := range locs {
+		results[i] = GeoResult{
+			GeoPoint: GeoPoint{Name: l.Name, Longitude: l.Longitude, Latitude: l.Latitude},
+			Distance: l.Dist,
+		}
+	}
+	return results, nil
+}
+
+// Nearest returns up to n points within radius of a coordinate, nearest first
+func (g *GeoIndex) Nearest(ctx context.Context, longitude, latitude, radius float64, unit GeoUnit, n int) ([]GeoResult, error) {
+	return g.Search(ctx, GeoQuery{
+		Longitude: longitude,
+		Latitude:  latitude,
+		Radius:    radius,
+		Unit:      unit,
+		Limit:     n,
+	})
+}
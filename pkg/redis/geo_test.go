@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"blueprint/pkg/testsupport"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoUnitConvert(t *testing.T) {
+	assert.InDelta(t, 1.609344, Miles.Convert(1, Kilometers), 1e-9)
+	assert.InDelta(t, 3280.84, Kilometers.Convert(1, Feet), 0.01)
+	assert.InDelta(t, 1500.0, GeoUnit("").Convert(1.5, Meters), 1e-9, "empty unit is kilometers")
+}
+
+func TestGeoIndex(t *testing.T) {
+	ctx := context.Background()
+	regions := NewGeoIndex(testsupport.Redis(t), "geo:regions")
+
+	require.NoError(t, regions.Add(ctx,
+		GeoPoint{Name: "frankfurt", Longitude: 8.6821, Latitude: 50.1109},
+		GeoPoint{Name: "london", Longitude: -0.1276, Latitude: 51.5072},
+		GeoPoint{Name: "amsterdam", Longitude: 4.9041, Latitude: 52.3676},
+		GeoPoint{Name: "singapore", Longitude: 103.8198, Latitude: 1.3521},
+	))
+
+	// from Paris
+	nearest, err := regions.Nearest(ctx, 2.3522, 48.8566, 1000, Kilometers, 2)
+	require.NoError(t, err)
+	require.Len(t, nearest, 2)
+	assert.Equal(t, "london", nearest[0].Name)
+	assert.InDelta(t, 344, nearest[0].Distance, 5)
+	assert.Equal(t, "amsterdam", nearest[1].Name)
+
+	page, err := regions.Search(ctx, GeoQuery{Longitude: 2.3522, Latitude: 48.8566, Radius: 1000, Offset: 2, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "frankfurt", page[0].Name)
+
+	d, err := regions.Distance(ctx, "london", "frankfurt", Miles)
+	require.NoError(t, err)
+	assert.InDelta(t, 396, d, 5)
+
+	pos, err := regions.Position(ctx, "singapore")
+	require.NoError(t, err)
+	assert.InDelta(t, 1.3521, pos.Latitude, 1e-4)
+
+	_, err = regions.Position(ctx, "tokyo")
+	assert.ErrorIs(t, err, redis.Nil)
+
+	_, err = regions.Search(ctx, GeoQuery{FromMember: "london"})
+	assert.Error(t, err, "radius or box required")
+}
@@ -0,0 +1,377 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// HashStore keeps small mutable objects such as user settings or account
+// state as one redis hash each, so single fields can be read and updated
+// without rewriting the whole value.
+//
+// Struct fields map to hash fields through `redis:"name"` tags, untagged
+// fields and `redis:"-"` are not stored, `redis:"name,omitempty"` skips zero
+// values on Save. Strings, numbers, bools, time.Time, time.Duration, []byte
+// and encoding.TextMarshaler are stored as text, anything else as JSON.
+type HashStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewHashStore stores objects under prefix+id, ttl 0 never expires them.
+// Every write renews the ttl.
+func NewHashStore(client *redis.Client, prefix string, ttl time.Duration) *HashStore {
+	return &HashStore{client: client, prefix: prefix, ttl: ttl}
+}
+
+// HashStore returns a HashStore on this client
+func (r *RedisClient) HashStore(prefix string, ttl time.Duration) *HashStore {
+	return NewHashStore(r.client, prefix, ttl)
+}
+
+func (h *HashStore) Key(id string) string {
+	return h.prefix + id
+}
+
+// Save writes every tagged field of v, a struct or pointer to one. Fields
+// already in the hash but not in v are left alone.
+func (h *HashStore) Save(ctx context.Context, id string, v interface{}) error {
+	values, err := encodeHash(v, nil)
+	if err != nil {
+		return fmt.Errorf("hash %s: %w", h.Key(id), err)
+	}
+	return h.write(ctx, id, values)
+}
+
+// SaveFields writes only the named hash fields of v
+func (h *HashStore) SaveFields(ctx context.Context, id string, v interface{}, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	values, err := encodeHash(v, fields)
+	if err != nil {
+		return fmt.Errorf("hash %s: %w", h.Key(id), err)
+	}
+	return h.write(ctx, id, values)
+}
+
+// Update sets hash fields directly, values are encoded like struct fields
+func (h *HashStore) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	values := make(map[string]interface{}, len(fields))
+	for name, value := range fields {
+		s, err := encodeField(reflect.ValueOf(value))
+		if err != nil {
+			return fmt.Errorf("hash %s field %s: %w", h.Key(id), name, err)
+		}
+		values[name] = s
+	}
+	return h.write(ctx, id, values)
+}
+
+// Load fills dest, a pointer to a struct, from the hash. A missing object
+// returns an error wrapping redis.Nil.
+func (h *HashStore) Load(ctx context.Context, id string, dest interface{}) error {
+	values, err := h.client.HGetAll(ctx, h.Key(id)).Result()
+	if err != nil {
+		return fmt.Errorf("hash %s: %w", h.Key(id), err)
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("hash %s not found: %w", h.Key(id), redis.Nil)
+	}
+	if err := decodeHash(values, dest); err != nil {
+		return fmt.Errorf("hash %s: %w", h.Key(id), err)
+	}
+	return nil
+}
+
+// LoadFields fills only the named fields of dest, fields missing from the
+// hash keep their value
+func (h *HashStore) LoadFields(ctx context.Context, id string, dest interface{}, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	raw, err := h.client.HMGet(ctx, h.Key(id), fields...).Result()
+	if err != nil {
+		return fmt.Errorf("hash %s: %w", h.Key(id), err)
+	}
+	values := make(map[string]string, len(fields))
+	for i, v := range raw {
+		if s, ok := v.(string); ok {
+			values[fields[i]] = s
+		}
+	}
+	if err := decodeHash(values, dest); err != nil {
+		return fmt.Errorf("hash %s: %w", h.Key(id), err)
+	}
+	return nil
+}
+
+// Incr adds delta to an integer field and returns the new value
+func (h *HashStore) Incr(ctx context.Context, id, field string, delta int64) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := h.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.HIncrBy(ctx, h.Key(id), field, delta)
+		h.expire(ctx, pipe, id)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("hash %s incr %s: %w", h.Key(id), field, err)
+	}
+	return incr.Val(), nil
+}
+
+// DeleteFields removes single fields, Delete the whole object
+func (h *HashStore) DeleteFields(ctx context.Context, id string, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return h.client.HDel(ctx, h.Key(id), fields...).Err()
+}
+
+func (h *HashStore) Delete(ctx context.Context, id string) error {
+	return h.client.Del(ctx, h.Key(id)).Err()
+}
+
+func (h *HashStore) Exists(ctx context.Context, id string) (bool, error) {
+	n, err := h.client.Exists(ctx, h.Key(id)).Result()
+	return n > 0, err
+}
+
+func (h *HashStore) write(ctx context.Context, id string, values map[string]interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+	_, err := h.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, h.Key(id), values)
+		h.expire(ctx, pipe, id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("hash %s: %w", h.Key(id), err)
+	}
+	return nil
+}
+
+func (h *HashStore) expire(ctx context.Context, pipe redis.Pipeliner, id string) {
+	if h.ttl > 0 {
+		pipe.Expire(ctx, h.Key(id), h.ttl)
+	}
+}
+
+// hashField is a tagged struct field
+type hashField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var hashFieldCache sync.Map // reflect.Type -> []hashField
+
+func hashFields(t reflect.Type) []hashField {
+	if cached, ok := hashFieldCache.Load(t); ok {
+		return cached.([]hashField)
+	}
+
+	var fields []hashField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("redis")
+		if !ok || tag == "-" || !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, hashField{name: name, index: f.Index, omitEmpty: opts == "omitempty"})
+	}
+
+	hashFieldCache.Store(t, fields)
+	return fields
+}
+
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return reflect.Value{}, fmt.Errorf("nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("%s is not a struct", rv.Type())
+	}
+	return rv, nil
+}
+
+// encodeHash turns the tagged fields of v into hash values, only those
+// named in only when it is not nil
+func encodeHash(v interface{}, only []string) (map[string]interface{}, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var want map[string]bool
+	if only != nil {
+		want = make(map[string]bool, len(only))
+		for _, name := range only {
+			want[name] = true
+		}
+	}
+
+	values := make(map[string]interface{})
+	for _, f := range hashFields(rv.Type()) {
+		if want != nil && !want[f.name] {
+			continue
+		}
+		fv := rv.FieldByIndex(f.index)
+		if want == nil && f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		s, err := encodeField(fv)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		values[f.name] = s
+	}
+	for _, name := range only {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("no field tagged %q", name)
+		}
+	}
+	return values, nil
+}
+
+func decodeHash(values map[string]string, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("decode into non pointer %T", dest)
+	}
+	rv, err := structValue(dest)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range hashFields(rv.Type()) {
+		s, ok := values[f.name]
+		if !ok {
+			continue
+		}
+		if err := decodeField(s, rv.FieldByIndex(f.index)); err != nil {
+			return fmt.Errorf("field %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	bytesType    = reflect.TypeOf([]byte(nil))
+)
+
+func encodeField(v reflect.Value) (string, error) {
+	if !v.IsValid() {
+		return "", nil
+	}
+	switch v.Type() {
+	case timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	case durationType:
+		return v.Interface().(time.Duration).String(), nil
+	case bytesType:
+		return string(v.Bytes()), nil
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		return string(b), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	}
+
+	b, err := json.Marshal(v.Interface())
+	return string(b), err
+}
+
+func decodeField(s string, v reflect.Value) error {
+	switch v.Type() {
+	case timeType:
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case bytesType:
+		v.SetBytes([]byte(s))
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return json.Unmarshal([]byte(s), v.Addr().Interface())
+	}
+	return nil
+}
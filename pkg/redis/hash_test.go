@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blueprint/pkg/testsupport"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type accountState struct {
+	ID        string         `redis:"id"`
+	Balance   float64        `redis:"balance"`
+	Orders    int64          `redis:"orders"`
+	Frozen    bool           `redis:"frozen"`
+	Cooldown  time.Duration  `redis:"cooldown"`
+	UpdatedAt time.Time      `redis:"updated_at"`
+	Limits    map[string]int `redis:"limits"`
+	Note      string         `redis:"note,omitempty"`
+	Scratch   string         `redis:"-"`
+	Untagged  string
+}
+
+func TestHashEncodeRoundTrip(t *testing.T) {
+	in := accountState{
+		ID:        "acc-1",
+		Balance:   1250.5,
+		Orders:    3,
+		Frozen:    true,
+		Cooldown:  90 * time.Second,
+		UpdatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Limits:    map[string]int{"BTC": 2},
+		Scratch:   "not stored",
+		Untagged:  "not stored",
+	}
+
+	values, err := encodeHash(&in, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":         "acc-1",
+		"balance":    "1250.5",
+		"orders":     "3",
+		"frozen":     "true",
+		"cooldown":   "1m30s",
+		"updated_at": "2024-05-01T12:00:00Z",
+		"limits":     `{"BTC":2}`,
+	}, values, "omitempty, untagged and - fields are skipped")
+
+	raw := make(map[string]string, len(values))
+	for k, v := range values {
+		raw[k] = v.(string)
+	}
+	var out accountState
+	require.NoError(t, decodeHash(raw, &out))
+	in.Scratch, in.Untagged = "", ""
+	assert.Equal(t, in, out)
+
+	only, err := encodeHash(in, []string{"balance"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"balance": "1250.5"}, only)
+
+	_, err = encodeHash(in, []string{"missing"})
+	assert.Error(t, err)
+}
+
+func TestHashStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewHashStore(testsupport.Redis(t), "account:", time.Hour)
+
+	err := store.Load(ctx, "acc-1", &accountState{})
+	assert.ErrorIs(t, err, redis.Nil)
+
+	require.NoError(t, store.Save(ctx, "acc-1", accountState{ID: "acc-1", Balance: 100}))
+	require.NoError(t, store.Update(ctx, "acc-1", map[string]interface{}{"frozen": true}))
+	orders, err := store.Incr(ctx, "acc-1", "orders", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), orders)
+
+	var got accountState
+	require.NoError(t, store.Load(ctx, "acc-1", &got))
+	assert.Equal(t, "acc-1", got.ID)
+	assert.Equal(t, 100.0, got.Balance)
+	assert.True(t, got.Frozen)
+	assert.Equal(t, int64(2), got.Orders)
+
+	require.NoError(t, store.SaveFields(ctx, "acc-1", accountState{Balance: 80}, "balance"))
+	var partial accountState
+	require.NoError(t, store.LoadFields(ctx, "acc-1", &partial, "balance", "id"))
+	assert.Equal(t, accountState{ID: "acc-1", Balance: 80}, partial)
+
+	require.NoError(t, store.Delete(ctx, "acc-1"))
+	ok, err := store.Exists(ctx, "acc-1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
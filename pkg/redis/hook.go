@@ -0,0 +1,119 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+const pipelineCommand = "pipeline"
+
+var (
+	commandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blueprint_redis_command_duration_seconds",
+		Help:    "Redis command latency, pipelines are observed once as a whole.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"command"})
+
+	commandsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_redis_commands_total",
+		Help: "Redis commands by result, ok or error. A redis.Nil miss counts as ok.",
+	}, []string{"command", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(commandDuration, commandsTotal)
+}
+
+// commandHook records latency and results for every command and logs the
+// ones slower than slow. NewRedisClientWithOptions adds it to each client.
+type commandHook struct {
+	log   *logger.Logger
+	slow  time.Duration
+	clock clock.Clock
+}
+
+func newCommandHook(log *logger.Logger, slow time.Duration, c clock.Clock) *commandHook {
+	return &commandHook{log: log, slow: slow, clock: clock.Or(c)}
+}
+
+func (h *commandHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *commandHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := h.clock.Now()
+		err := next(ctx, cmd)
+		elapsed := h.clock.Since(start)
+
+		name := cmd.Name()
+		h.observe(ctx, name, elapsed, cmd.Err())
+		if h.isSlow(elapsed) {
+			h.logSlow(name, elapsed, "key", commandKey(cmd))
+		}
+		return err
+	}
+}
+
+func (h *commandHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := h.clock.Now()
+		err := next(ctx, cmds)
+		elapsed := h.clock.Since(start)
+
+		for _, cmd := range cmds {
+			commandsTotal.WithLabelValues(cmd.Name(), result(cmd.Err())).Inc()
+		}
+		ctxmeta.Observe(ctx, commandDuration.WithLabelValues(pipelineCommand), elapsed.Seconds())
+		if h.isSlow(elapsed) {
+			h.logSlow(pipelineCommand, elapsed, "commands", len(cmds))
+		}
+		return err
+	}
+}
+
+func (h *commandHook) observe(ctx context.Context, name string, elapsed time.Duration, err error) {
+	ctxmeta.Observe(ctx, commandDuration.WithLabelValues(name), elapsed.Seconds())
+	commandsTotal.WithLabelValues(name, result(err)).Inc()
+}
+
+func (h *commandHook) isSlow(elapsed time.Duration) bool {
+	return h.log != nil && h.slow > 0 && elapsed >= h.slow
+}
+
+func (h *commandHook) logSlow(name string, elapsed time.Duration, kv ...interface{}) {
+	fields := append([]interface{}{"command", name, "duration", elapsed, "threshold", h.slow}, kv...)
+	h.log.Warnw("Slow redis command", fields...)
+}
+
+func result(err error) string {
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "error"
+	}
+	return "ok"
+}
+
+// commandKey is the first argument after the command name, values are never
+// logged since they can carry anything
+func commandKey(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return ""
+	}
+	if key, ok := args[1].(string); ok {
+		return key
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandHook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	log, err := logger.NewLoggerWithOptions(&config.Config{}, logger.LoggerOptions{
+		Level:      "info",
+		OutputPath: path,
+	})
+	require.NoError(t, err)
+	defer log.Close()
+
+	commandsTotal.Reset()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	h := newCommandHook(log, 50*time.Millisecond, fake)
+	ctx := context.Background()
+
+	run := func(cmd redis.Cmder, took time.Duration, err error) {
+		process := h.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+			fake.Advance(took)
+			cmd.SetErr(err)
+			return err
+		})
+		process(ctx, cmd)
+	}
+
+	run(redis.NewStringCmd(ctx, "hget", "fast-key", "field"), time.Millisecond, nil)
+	run(redis.NewStringCmd(ctx, "hget", "missing-key", "field"), time.Millisecond, redis.Nil)
+	run(redis.NewStringCmd(ctx, "hget", "slow-key", "field"), 80*time.Millisecond, errors.New("boom"))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(commandsTotal.WithLabelValues("hget", "ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(commandsTotal.WithLabelValues("hget", "error")))
+
+	pipeline := h.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		fake.Advance(time.Millisecond)
+		return nil
+	})
+	pipeline(ctx, []redis.Cmder{redis.NewStatusCmd(ctx, "hset", "k", "f", "v"), redis.NewIntCmd(ctx, "hlen", "k")})
+	assert.Equal(t, 1.0, testutil.ToFloat64(commandsTotal.WithLabelValues("hset", "ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(commandsTotal.WithLabelValues("hlen", "ok")))
+
+	log.Sync()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Slow redis command")
+	assert.Contains(t, string(data), "slow-key")
+	assert.NotContains(t, string(data), "fast-key")
+	assert.NotContains(t, string(data), "field", "only the key is logged")
+}
@@ -0,0 +1,272 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+)
+
+// RedisStats is the server side view from INFO, refreshed by UpdateStats
+// and every StatsInterval
+type RedisStats struct {
+	TotalCommands    uint64
+	FailedCommands   uint64
+	ConnectedClients uint32
+	BlockedClients   uint32
+
+	Memory      MemoryInfo
+	Clients     ClientsInfo
+	Replication ReplicationInfo
+	Stats       StatsInfo
+	// Keyspace is keyed by db number, empty dbs are left out
+	Keyspace  map[int]KeyspaceInfo
+	UpdatedAt time.Time
+}
+
+type MemoryInfo struct {
+	Used     int64
+	RSS      int64
+	Peak     int64
+	Max      int64
+	Policy   string
+	FragRate float64
+}
+
+type ClientsInfo struct {
+	Connected  int64
+	Blocked    int64
+	MaxClients int64
+}
+
+type ReplicationInfo struct {
+	// Role is master or slave
+	Role             string
+	ConnectedSlaves  int64
+	MasterReplOffset int64
+	// MasterHost, MasterPort and MasterLinkUp are set on replicas
+	MasterHost   string
+	MasterPort   int64
+	MasterLinkUp bool
+}
+
+type StatsInfo struct {
+	TotalConnections    int64
+	TotalCommands       int64
+	OpsPerSec           int64
+	RejectedConnections int64
+	ExpiredKeys         int64
+	EvictedKeys         int64
+	KeyspaceHits        int64
+	KeyspaceMisses      int64
+	// ErrorReplies needs redis 6.2 or later
+	ErrorReplies int64
+}
+
+// HitRate is hits over lookups, 0 before the first lookup
+func (s StatsInfo) HitRate() float64 {
+	total := s.KeyspaceHits + s.KeyspaceMisses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.KeyspaceHits) / float64(total)
+}
+
+type KeyspaceInfo struct {
+	Keys    int64
+	Expires int64
+	AvgTTL  time.Duration
+}
+
+// Info is INFO output by lower case section, then field
+type Info map[string]map[string]string
+
+// ParseInfo reads INFO output, "# Section" headers followed by
+// "field:value" lines
+func ParseInfo(raw string) Info {
+	info := make(Info)
+	section := ""
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			section = strings.ToLower(strings.TrimSpace(line[1:]))
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if info[section] == nil {
+			info[section] = make(map[string]string)
+		}
+		info[section][k] = v
+	}
+	return info
+}
+
+// Int is a field as an integer, 0 when missing or not a number
+func (i Info) Int(section, field string) int64 {
+	n, _ := strconv.ParseInt(i[section][field], 10, 64)
+	return n
+}
+
+func (i Info) Float(section, field string) float64 {
+	f, _ := strconv.ParseFloat(i[section][field], 64)
+	return f
+}
+
+func (i Info) String(section, field string) string {
+	return i[section][field]
+}
+
+// Stats maps the memory, clients, replication, stats and keyspace sections
+func (i Info) Stats() RedisStats {
+	s := RedisStats{
+		Memory: MemoryInfo{
+			Used:     i.Int("memory", "used_memory"),
+			RSS:      i.Int("memory", "used_memory_rss"),
+			Peak:     i.Int("memory", "used_memory_peak"),
+			Max:      i.Int("memory", "maxmemory"),
+			Policy:   i.String("memory", "maxmemory_policy"),
+			FragRate: i.Float("memory", "mem_fragmentation_ratio"),
+		},
+		Clients: ClientsInfo{
+			Connected:  i.Int("clients", "connected_clients"),
+			Blocked:    i.Int("clients", "blocked_clients"),
+			MaxClients: i.Int("clients", "maxclients"),
+		},
+		Replication: ReplicationInfo{
+			Role:             i.String("replication", "role"),
+			ConnectedSlaves:  i.Int("replication", "connected_slaves"),
+			MasterReplOffset: i.Int("replication", "master_repl_offset"),
+			MasterHost:       i.String("replication", "master_host"),
+			MasterPort:       i.Int("replication", "master_port"),
+			MasterLinkUp:     i.String("replication", "master_link_status") == "up",
+		},
+		Stats: StatsInfo{
+			TotalConnections:    i.Int("stats", "total_connections_received"),
+			TotalCommands:       i.Int("stats", "total_commands_processed"),
+			OpsPerSec:           i.Int("stats", "instantaneous_ops_per_sec"),
+			RejectedConnections: i.Int("stats", "rejected_connections"),
+			ExpiredKeys:         i.Int("stats", "expired_keys"),
+			EvictedKeys:         i.Int("stats", "evicted_keys"),
+			KeyspaceHits:        i.Int("stats", "keyspace_hits"),
+			KeyspaceMisses:      i.Int("stats", "keyspace_misses"),
+			ErrorReplies:        i.Int("stats", "total_error_replies"),
+		},
+		Keyspace: make(map[int]KeyspaceInfo),
+	}
+
+	s.TotalCommands = uint64(s.Stats.TotalCommands)
+	s.FailedCommands = uint64(s.Stats.ErrorReplies)
+	s.ConnectedClients = uint32(s.Clients.Connected)
+	s.BlockedClients = uint32(s.Clients.Blocked)
+
+	for name, value := range i["keyspace"] {
+		db, err := strconv.Atoi(strings.TrimPrefix(name, "db"))
+		if err != nil {
+			continue
+		}
+		s.Keyspace[db] = parseKeyspace(value)
+	}
+	return s
+}
+
+// parseKeyspace reads "keys=1,expires=0,avg_ttl=0"
+func parseKeyspace(value string) KeyspaceInfo {
+	var ks KeyspaceInfo
+	for _, pair := range strings.Split(value, ",") {
+		k, v, _ := strings.Cut(pair, "=")
+		n, _ := strconv.ParseInt(v, 10, 64)
+		switch k {
+		case "keys":
+			ks.Keys = n
+		case "expires":
+			ks.Expires = n
+		case "avg_ttl":
+			ks.AvgTTL = time.Duration(n) * time.Millisecond
+		}
+	}
+	return ks
+}
+
+// infoInt reads an integer "key:value" line from INFO output
+func infoInt(info, key string) (int64, bool) {
+	for _, fields := range ParseInfo(info) {
+		if v, ok := fields[key]; ok {
+			n, err := strconv.ParseInt(v, 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+// UpdateStats fetches INFO and replaces the stats GetStats returns
+func (r *RedisClient) UpdateStats() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// the default sections, redis before 7 takes one section per call
+	raw, err := r.client.Info(ctx).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get Redis stats: %w", err)
+	}
+
+	stats := ParseInfo(raw).Stats()
+	stats.UpdatedAt = clock.Or(r.clock).Now()
+
+	r.mu.Lock()
+	r.stats = stats
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *RedisClient) GetStats() RedisStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.stats
+}
+
+// statsRefresher calls UpdateStats right away and then every interval
+// until close
+type statsRefresher struct {
+	cancel context.CancelFunc
+	group  *run.Group
+}
+
+func startStatsRefresher(r *RedisClient, interval time.Duration, c clock.Clock, log *logger.Logger) *statsRefresher {
+	c = clock.Or(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &statsRefresher{cancel: cancel, group: run.NewGroup(ctx, log)}
+
+	s.group.Supervise("redis_stats", func(ctx context.Context) error {
+		ticker := c.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			// a lost connection is already logged by the conn tracker
+			if err := r.UpdateStats(); err != nil && log != nil && !r.Degraded() {
+				log.Warnw("Redis stats refresh failed", "error", err.Error())
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C():
+			}
+		}
+	}, run.Options{Clock: c})
+	return s
+}
+
+func (s *statsRefresher) close() {
+	s.cancel()
+	s.group.Wait()
+}
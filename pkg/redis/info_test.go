@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleInfo = "# Server\r\n" +
+	"redis_version:7.2.4\r\n" +
+	"\r\n" +
+	"# Clients\r\n" +
+	"connected_clients:12\r\n" +
+	"blocked_clients:2\r\n" +
+	"maxclients:10000\r\n" +
+	"\r\n" +
+	"# Memory\r\n" +
+	"used_memory:1048576\r\n" +
+	"used_memory_rss:2097152\r\n" +
+	"used_memory_peak:3145728\r\n" +
+	"maxmemory:0\r\n" +
+	"maxmemory_policy:noeviction\r\n" +
+	"mem_fragmentation_ratio:2.00\r\n" +
+	"\r\n" +
+	"# Stats\r\n" +
+	"total_connections_received:40\r\n" +
+	"total_commands_processed:1234\r\n" +
+	"instantaneous_ops_per_sec:17\r\n" +
+	"keyspace_hits:75\r\n" +
+	"keyspace_misses:25\r\n" +
+	"evicted_keys:3\r\n" +
+	"total_error_replies:5\r\n" +
+	"\r\n" +
+	"# Replication\r\n" +
+	"role:slave\r\n" +
+	"master_host:10.0.0.1\r\n" +
+	"master_port:6379\r\n" +
+	"master_link_status:up\r\n" +
+	"master_repl_offset:998\r\n" +
+	"\r\n" +
+	"# Keyspace\r\n" +
+	"db0:keys=10,expires=4,avg_ttl=1500\r\n" +
+	"db3:keys=1,expires=0,avg_ttl=0\r\n"
+
+func TestParseInfo(t *testing.T) {
+	info := ParseInfo(sampleInfo)
+	assert.Equal(t, "7.2.4", info.String("server", "redis_version"))
+	assert.Equal(t, int64(1234), info.Int("stats", "total_commands_processed"), "CRLF line endings are trimmed")
+	assert.Zero(t, info.Int("stats", "missing"))
+
+	s := info.Stats()
+	assert.Equal(t, MemoryInfo{Used: 1 << 20, RSS: 2 << 20, Peak: 3 << 20, Policy: "noeviction", FragRate: 2}, s.Memory)
+	assert.Equal(t, ClientsInfo{Connected: 12, Blocked: 2, MaxClients: 10000}, s.Clients)
+	assert.Equal(t, ReplicationInfo{Role: "slave", MasterReplOffset: 998, MasterHost: "10.0.0.1", MasterPort: 6379, MasterLinkUp: true}, s.Replication)
+	assert.Equal(t, int64(17), s.Stats.OpsPerSec)
+	assert.Equal(t, int64(3), s.Stats.EvictedKeys)
+	assert.InDelta(t, 0.75, s.Stats.HitRate(), 1e-9)
+
+	require.Len(t, s.Keyspace, 2)
+	assert.Equal(t, KeyspaceInfo{Keys: 10, Expires: 4, AvgTTL: 1500 * time.Millisecond}, s.Keyspace[0])
+	assert.Equal(t, int64(1), s.Keyspace[3].Keys)
+
+	assert.Equal(t, uint64(1234), s.TotalCommands)
+	assert.Equal(t, uint64(5), s.FailedCommands)
+	assert.Equal(t, uint32(12), s.ConnectedClients)
+	assert.Equal(t, uint32(2), s.BlockedClients)
+}
+
+func TestUpdateStats(t *testing.T) {
+	rc := newTestClient(t)
+
+	require.NoError(t, rc.UpdateStats())
+	s := rc.GetStats()
+	assert.Positive(t, s.TotalCommands)
+	assert.Positive(t, s.Memory.Used)
+	assert.Equal(t, "master", s.Replication.Role)
+	assert.False(t, s.UpdatedAt.IsZero())
+}
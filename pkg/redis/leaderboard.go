@@ -0,0 +1,250 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotRanked is returned by Rank for a member that has no score
+var ErrNotRanked = errors.New("member not ranked")
+
+// LeaderboardOptions shape a Leaderboard, the zero value ranks the highest
+// score first and keeps every member
+type LeaderboardOptions struct {
+	// Ascending ranks the lowest score first, e.g. for latencies
+	Ascending bool
+	// MaxSize trims the worst ranked members after every write, 0 keeps all
+	MaxSize int64
+	// TTL is renewed on every write so idle boards expire, 0 never expires
+	TTL time.Duration
+}
+
+// Leaderboard ranks members of one sorted set by score, e.g. traders by
+// PnL or symbols by activity. Ranks start at 0 for the best member.
+type Leaderboard struct {
+	client *redis.Client
+	key    string
+	opts   LeaderboardOptions
+}
+
+// RankedMember is a member with its score and 0 based rank
+type RankedMember struct {
+	Member string
+	Score  float64
+	Rank   int64
+}
+
+func NewLeaderboard(client *redis.Client, key string, opts LeaderboardOptions) *Leaderboard {
+	return &Leaderboard{client: client, key: key, opts: opts}
+}
+
+// Leaderboard returns a leaderboard stored under key
+func (r *RedisClient) Leaderboard(key string, opts LeaderboardOptions) *Leaderboard {
+	return NewLeaderboard(r.client, key, opts)
+}
+
+func (l *Leaderboard) Key() string {
+	return l.key
+}
+
+// SetScore replaces the score of member
+func (l *Leaderboard) SetScore(ctx context.Context, member string, score float64) error {
+	return l.SetScores(ctx, map[string]float64{member: score})
+}
+
+// SetScores replaces the scores of several members in one round trip
+func (l *Leaderboard) SetScores(ctx context.Context, scores map[string]float64) error {
+	if len(scores) == 0 {
+		return nil
+	}
+	members := make([]redis.Z, 0, len(scores))
+	for member, score := range scores {
+		members = append(members, redis.Z{Score: score, Member: member})
+	}
+
+	_, err := l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, l.key, members...)
+		l.afterWrite(ctx, pipe)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("leaderboard %s set scores: %w", l.key, err)
+	}
+	return nil
+}
+
+// IncrScore adds delta to the score of member and returns the new score
+func (l *Leaderboard) IncrScore(ctx context.Context, member string, delta float64) (float64, error) {
+	var incr *redis.FloatCmd
+	_, err := l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.ZIncrBy(ctx, l.key, delta, member)
+		l.afterWrite(ctx, pipe)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("leaderboard %s incr %s: %w", l.key, member, err)
+	}
+	return incr.Val(), nil
+}
+
+// SetScoreIfBetter only stores score when it beats the member's current
+// one, for best-ever boards. It reports whether the score was stored.
+func (l *Leaderboard) SetScoreIfBetter(ctx context.Context, member string, score float64) (bool, error) {
+	args := redis.ZAddArgs{GT: !l.opts.Ascending, LT: l.opts.Ascending, Ch: true,
+		Members: []redis.Z{{Score: score, Member: member}}}
+
+	var changed *redis.IntCmd
+	_, err := l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		changed = pipe.ZAddArgs(ctx, l.key, args)
+		l.afterWrite(ctx, pipe)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("leaderboard %s set %s: %w", l.key, member, err)
+	}
+	return changed.Val() > 0, nil
+}
+
+// Remove drops members from the board
+func (l *Leaderboard) Remove(ctx context.Context, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	return l.client.ZRem(ctx, l.key, toArgs(members)...).Err()
+}
+
+// Top returns the best n members
+func (l *Leaderboard) Top(ctx context.Context, n int64) ([]RankedMember, error) {
+	return l.Page(ctx, 0, n)
+}
+
+// Page returns limit members starting at rank offset
+func (l *Leaderboard) Page(ctx context.Context, offset, limit int64) ([]RankedMember, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	zs, err := l.client.ZRangeArgsWithScores(ctx, redis.ZRangeArgs{
+		Key:   l.key,
+		Start: offset,
+		Stop:  offset + limit - 1,
+		Rev:   !l.opts.Ascending,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("leaderboard %s page: %w", l.key, err)
+	}
+	return ranked(zs, offset), nil
+}
+
+// Rank returns the rank and score of member, ErrNotRanked when it has none
+func (l *Leaderboard) Rank(ctx context.Context, member string) (RankedMember, error) {
+	var rank *redis.IntCmd
+	var score *redis.FloatCmd
+	_, err := l.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		if l.opts.Ascending {
+			rank = pipe.ZRank(ctx, l.key, member)
+		} else {
+			rank = pipe.ZRevRank(ctx, l.key, member)
+		}
+		score = pipe.ZScore(ctx, l.key, member)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return RankedMember{}, fmt.Errorf("leaderboard %s %s: %w", l.key, member, ErrNotRanked)
+	}
+	if err != nil {
+		return RankedMember{}, fmt.Errorf("leaderboard %s rank %s: %w", l.key, member, err)
+	}
+	return RankedMember{Member: member, Score: score.Val(), Rank: rank.Val()}, nil
+}
+
+// Around returns member with up to n neighbours on each side, for "your
+// position" views
+func (l *Leaderboard) Around(ctx context.Context, member string, n int64) ([]RankedMember, error) {
+	me, err := l.Rank(ctx, member)
+	if err != nil {
+		return nil, err
+	}
+	start := me.Rank - n
+	if start < 0 {
+		start = 0
+	}
+	return l.Page(ctx, start, me.Rank+n-start+1)
+}
+
+// Count is the number of ranked members
+func (l *Leaderboard) Count(ctx context.Context) (int64, error) {
+	return l.client.ZCard(ctx, l.key).Result()
+}
+
+// Trim keeps the best keep members and returns how many were removed
+func (l *Leaderboard) Trim(ctx context.Context, keep int64) (int64, error) {
+	start, stop := l.trimRange(keep)
+	return l.client.ZRemRangeByRank(ctx, l.key, start, stop).Result()
+}
+
+// TrimScores removes members whose score is outside [min, max], e.g. to
+// keep a window of activity scored by timestamp. Use math.Inf for an open end.
+func (l *Leaderboard) TrimScores(ctx context.Context, min, max float64) (int64, error) {
+	var below, above *redis.IntCmd
+	_, err := l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		below = pipe.ZRemRangeByScore(ctx, l.key, "-inf", exclusive(min))
+		above = pipe.ZRemRangeByScore(ctx, l.key, exclusive(max), "+inf")
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("leaderboard %s trim scores: %w", l.key, err)
+	}
+	return below.Val() + above.Val(), nil
+}
+
+// TrimBefore keeps the members scored at or after since, for boards scored
+// by unix time such as recently active symbols
+func (l *Leaderboard) TrimBefore(ctx context.Context, since time.Time) (int64, error) {
+	return l.client.ZRemRangeByScore(ctx, l.key, "-inf", exclusive(float64(since.Unix()))).Result()
+}
+
+func (l *Leaderboard) afterWrite(ctx context.Context, pipe redis.Pipeliner) {
+	if l.opts.MaxSize > 0 {
+		start, stop := l.trimRange(l.opts.MaxSize)
+		pipe.ZRemRangeByRank(ctx, l.key, start, stop)
+	}
+	if l.opts.TTL > 0 {
+		pipe.Expire(ctx, l.key, l.opts.TTL)
+	}
+}
+
+// trimRange is the ascending rank range beyond the best keep members
+func (l *Leaderboard) trimRange(keep int64) (int64, int64) {
+	if l.opts.Ascending {
+		// the worst have the highest scores, at the end of the set
+		return keep, -1
+	}
+	return 0, -keep - 1
+}
+
+func ranked(zs []redis.Z, offset int64) []RankedMember {
+	out := make([]RankedMember, len(zs))
+	for i, z := range zs {
+		member, _ := z.Member.(string)
+		out[i] = RankedMember{Member: member, Score: z.Score, Rank: offset + int64(i)}
+	}
+	return out
+}
+
+// exclusive formats f as an exclusive ZRANGEBYSCORE bound
+func exclusive(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return "(" + strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderboardRanking(t *testing.T) {
+	ctx := context.Background()
+	lb := NewLeaderboard(testsupport.Redis(t), "lb:pnl", LeaderboardOptions{})
+
+	require.NoError(t, lb.SetScores(ctx, map[string]float64{"alice": 30, "bob": 10, "carol": 20, "dave": 5}))
+	score, err := lb.IncrScore(ctx, "bob", 25)
+	require.NoError(t, err)
+	assert.Equal(t, 35.0, score)
+
+	top, err := lb.Top(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []RankedMember{{"bob", 35, 0}, {"alice", 30, 1}}, top)
+
+	page, err := lb.Page(ctx, 2, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []RankedMember{{"carol", 20, 2}, {"dave", 5, 3}}, page)
+
+	carol, err := lb.Rank(ctx, "carol")
+	require.NoError(t, err)
+	assert.Equal(t, RankedMember{"carol", 20, 2}, carol)
+
+	_, err = lb.Rank(ctx, "nobody")
+	assert.ErrorIs(t, err, ErrNotRanked)
+
+	around, err := lb.Around(ctx, "bob", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []RankedMember{{"bob", 35, 0}, {"alice", 30, 1}}, around)
+
+	stored, err := lb.SetScoreIfBetter(ctx, "alice", 25)
+	require.NoError(t, err)
+	assert.False(t, stored, "lower score does not replace a better one")
+}
+
+func TestLeaderboardAscendingTrim(t *testing.T) {
+	ctx := context.Background()
+	lb := NewLeaderboard(testsupport.Redis(t), "lb:latency", LeaderboardOptions{Ascending: true, MaxSize: 2})
+
+	require.NoError(t, lb.SetScores(ctx, map[string]float64{"eu": 12, "us": 40, "ap": 25}))
+
+	top, err := lb.Top(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []RankedMember{{"eu", 12, 0}, {"ap", 25, 1}}, top, "MaxSize drops the slowest")
+}
+
+func TestLeaderboardTrimScores(t *testing.T) {
+	ctx := context.Background()
+	lb := NewLeaderboard(testsupport.Redis(t), "lb:activity", LeaderboardOptions{})
+
+	require.NoError(t, lb.SetScores(ctx, map[string]float64{"BTC": 100, "ETH": 200, "SOL": 300}))
+
+	removed, err := lb.TrimScores(ctx, 150, math.Inf(1))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	removed, err = lb.Trim(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	n, err := lb.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestExclusiveBound(t *testing.T) {
+	assert.Equal(t, "(1.5", exclusive(1.5))
+	assert.Equal(t, "+inf", exclusive(math.Inf(1)))
+	assert.Equal(t, "-inf", exclusive(math.Inf(-1)))
+}
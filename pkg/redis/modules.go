@@ -0,0 +1,233 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrModuleUnavailable is returned by module backed helpers when the server
+// was found without the module at connect time
+var ErrModuleUnavailable = errors.New("redis module not available")
+
+// Modules are the redis modules found at connect time
+type Modules struct {
+	JSON       bool
+	Search     bool
+	Bloom      bool
+	TimeSeries bool
+}
+
+// moduleProbes is one command per module, asked about with COMMAND INFO
+// since MODULE LIST is often blocked on managed redis
+var moduleProbes = []string{"JSON.GET", "FT.SEARCH", "BF.ADD", "TS.ADD"}
+
+func detectModules(ctx context.Context, client *redis.Client) (Modules, error) {
+	args := []interface{}{"COMMAND", "INFO"}
+	for _, c := range moduleProbes {
+		args = append(args, c)
+	}
+	reply, err := client.Do(ctx, args...).Slice()
+	if err != nil {
+		return Modules{}, err
+	}
+	return parseModules(reply), nil
+}
+
+// parseModules reads COMMAND INFO, unknown commands come back as nil
+func parseModules(reply []interface{}) Modules {
+	known := func(i int) bool { return i < len(reply) && reply[i] != nil }
+	return Modules{
+		JSON:       known(0),
+		Search:     known(1),
+		Bloom:      known(2),
+		TimeSeries: known(3),
+	}
+}
+
+func (r *RedisClient) Modules() Modules {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.modules
+}
+
+// detectModulesOnConnect runs the detection a lazy start had to skip once
+// redis is reachable; a failed one is tried again on the next reconnect
+func (r *RedisClient) detectModulesOnConnect(log *logger.Logger) {
+	var started atomic.Bool
+	r.conn.onChange(func(s ConnStatus) {
+		if s.State != StateConnected || !started.CompareAndSwap(false, true) {
+			return
+		}
+		// the listener runs inside a command's hook, detection must not
+		// hold it up
+		run.Go(log, "redis_module_detection", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			modules, err := detectModules(ctx, r.client)
+			if err != nil {
+				started.Store(false)
+				if log != nil {
+					log.Warnw("Redis module detection failed, module helpers stay disabled", "error", err.Error())
+				}
+				return
+			}
+			r.mu.Lock()
+			r.modules = modules
+			r.mu.Unlock()
+			if log != nil {
+				log.Infow("Redis modules detected after reconnect", "json", modules.JSON, "search", modules.Search,
+					"bloom", modules.Bloom, "timeseries", modules.TimeSeries)
+			}
+		})
+	})
+}
+
+func (r *RedisClient) requireModule(ok bool, name string) error {
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrModuleUnavailable, name)
+	}
+	return nil
+}
+
+// JSONSet stores v, encoded with encoding/json, at path in key. Use "$"
+// for the whole document.
+func (r *RedisClient) JSONSet(ctx context.Context, key, path string, v interface{}) error {
+	if err := r.requireModule(r.Modules().JSON, "RedisJSON"); err != nil {
+		return err
+	}
+	if err := r.client.JSONSet(ctx, key, path, v).Err(); err != nil {
+		return fmt.Errorf("json set %s %s: %w", key, path, err)
+	}
+	return nil
+}
+
+// JSONGet decodes the value at path into dest, an error wrapping redis.Nil
+// when the key does not exist. JSONPath paths starting with "$" return an
+// array of matches, legacy paths such as "." or ".field" a single value.
+func (r *RedisClient) JSONGet(ctx context.Context, key, path string, dest interface{}) error {
+	if err := r.requireModule(r.Modules().JSON, "RedisJSON"); err != nil {
+		return err
+	}
+	raw, err := r.client.JSONGet(ctx, key, path).Result()
+	if err == nil && raw == "" {
+		err = redis.Nil
+	}
+	if err != nil {
+		return fmt.Errorf("json get %s %s: %w", key, path, err)
+	}
+	if err := json.Unmarshal([]byte(raw), dest); err != nil {
+		return fmt.Errorf("json get %s %s: %w", key, path, err)
+	}
+	return nil
+}
+
+// JSONDel removes the value at path and returns how many were removed
+func (r *RedisClient) JSONDel(ctx context.Context, key, path string) (int64, error) {
+	if err := r.requireModule(r.Modules().JSON, "RedisJSON"); err != nil {
+		return 0, err
+	}
+	return r.client.JSONDel(ctx, key, path).Result()
+}
+
+// SearchOptions page and sort FT.SEARCH results
+type SearchOptions struct {
+	Offset     int
+	Limit      int
+	SortBy     string
+	Descending bool
+	// Return limits the fields returned, all when empty
+	Return []string
+	// Params fill $name placeholders in the query
+	Params map[string]interface{}
+}
+
+type SearchResult struct {
+	Total int
+	Docs  []SearchDoc
+}
+
+type SearchDoc struct {
+	ID     string
+	Fields map[string]string
+}
+
+// DecodeJSON decodes a document of a JSON index, returned whole under "$"
+func (d SearchDoc) DecodeJSON(dest interface{}) error {
+	raw, ok := d.Fields["$"]
+	if !ok {
+		return fmt.Errorf("search doc %s has no JSON body", d.ID)
+	}
+	return json.Unmarshal([]byte(raw), dest)
+}
+
+// CreateIndex creates a RediSearch index, an existing index is left as is
+func (r *RedisClient) CreateIndex(ctx context.Context, index string, opts *redis.FTCreateOptions, schema ...*redis.FieldSchema) error {
+	if err := r.requireModule(r.Modules().Search, "RediSearch"); err != nil {
+		return err
+	}
+	err := r.searchClient().FTCreate(ctx, index, opts, schema...).Err()
+	if err != nil && !isAlreadyExists(err) {
+		return fmt.Errorf("create index %s: %w", index, err)
+	}
+	return nil
+}
+
+// Search runs FT.SEARCH against index
+func (r *RedisClient) Search(ctx context.Context, index, query string, opts SearchOptions) (*SearchResult, error) {
+	if err := r.requireModule(r.Modules().Search, "RediSearch"); err != nil {
+		return nil, err
+	}
+
+	args := &redis.FTSearchOptions{
+		LimitOffset: opts.Offset,
+		Limit:       opts.Limit,
+		Params:      opts.Params,
+	}
+	if opts.SortBy != "" {
+		args.SortBy = []redis.FTSearchSortBy{{FieldName: opts.SortBy, Asc: !opts.Descending, Desc: opts.Descending}}
+	}
+	for _, f := range opts.Return {
+		args.Return = append(args.Return, redis.FTSearchReturn{FieldName: f})
+	}
+	if len(opts.Params) > 0 {
+		args.DialectVersion = 2
+	}
+
+	res, err := r.searchClient().FTSearchWithArgs(ctx, index, query, args).Result()
+	if err != nil {
+		return nil, fmt.Errorf("search %s: %w", index, err)
+	}
+
+	out := &SearchResult{Total: res.Total, Docs: make([]SearchDoc, len(res.Docs))}
+	for i, d := range res.Docs {
+		out.Docs[i] = SearchDoc{ID: d.ID, Fields: d.Fields}
+	}
+	return out, nil
+}
+
+// searchClient speaks RESP2 to the same server, go-redis only parses
+// RediSearch replies in RESP2 and the main client uses RESP3
+func (r *RedisClient) searchClient() *redis.Client {
+	if r.client.Options().Protocol != 3 {
+		return r.client
+	}
+	r.searchOnce.Do(func() {
+		opts := *r.client.Options()
+		opts.Protocol = 2
+		opts.PoolSize = 10
+		opts.MinIdleConns = 0
+		r.search = redis.NewClient(&opts)
+	})
+	return r.search
+}
@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/testsupport"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient connects a RedisClient the way the service does, to the
+// test redis
+func newTestClient(t *testing.T) *RedisClient {
+	t.Helper()
+	addr := testsupport.Redis(t).Options().Addr
+
+	rc, err := NewRedisClientWithOptions(&config.Config{}, RedisOptions{Addr: addr, Protocol: 3})
+	require.NoError(t, err)
+	t.Cleanup(func() { rc.Close() })
+	return rc
+}
+
+func TestParseModules(t *testing.T) {
+	info := []interface{}{"json.get", nil, []interface{}{"bf.add"}, nil}
+	assert.Equal(t, Modules{JSON: true, Bloom: true}, parseModules(info))
+	assert.Equal(t, Modules{}, parseModules(nil))
+}
+
+func TestModuleUnavailable(t *testing.T) {
+	rc := &RedisClient{}
+	ctx := context.Background()
+
+	assert.ErrorIs(t, rc.JSONSet(ctx, "k", "$", 1), ErrModuleUnavailable)
+	_, err := rc.Search(ctx, "idx", "*", SearchOptions{})
+	assert.ErrorIs(t, err, ErrModuleUnavailable)
+}
+
+type instrument struct {
+	Symbol string  `json:"symbol"`
+	Tick   float64 `json:"tick"`
+}
+
+func TestJSONAndSearch(t *testing.T) {
+	rc := newTestClient(t)
+	if !rc.Modules().JSON || !rc.Modules().Search {
+		t.Skip("redis without RedisJSON and RediSearch")
+	}
+	ctx := context.Background()
+
+	require.NoError(t, rc.JSONSet(ctx, "inst:BTC", "$", instrument{Symbol: "BTC", Tick: 0.5}))
+	require.NoError(t, rc.JSONSet(ctx, "inst:ETH", "$", instrument{Symbol: "ETH", Tick: 0.05}))
+
+	var got instrument
+	require.NoError(t, rc.JSONGet(ctx, "inst:BTC", ".", &got))
+	assert.Equal(t, instrument{Symbol: "BTC", Tick: 0.5}, got)
+	assert.ErrorIs(t, rc.JSONGet(ctx, "inst:none", ".", &got), redis.Nil)
+
+	require.NoError(t, rc.CreateIndex(ctx, "idx:inst",
+		&redis.FTCreateOptions{OnJSON: true, Prefix: []interface{}{"inst:"}},
+		&redis.FieldSchema{FieldName: "$.symbol", As: "symbol", FieldType: redis.SearchFieldTypeTag},
+		&redis.FieldSchema{FieldName: "$.tick", As: "tick", FieldType: redis.SearchFieldTypeNumeric, Sortable: true},
+	))
+
+	require.Eventually(t, func() bool {
+		res, err := rc.Search(ctx, "idx:inst", "@symbol:{ETH}", SearchOptions{})
+		return err == nil && res.Total == 1
+	}, 5*time.Second, 50*time.Millisecond, "index catches up")
+
+	res, err := rc.Search(ctx, "idx:inst", "*", SearchOptions{SortBy: "tick", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, res.Docs, 2)
+	require.NoError(t, res.Docs[0].DecodeJSON(&got))
+	assert.Equal(t, "ETH", got.Symbol)
+}
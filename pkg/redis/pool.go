@@ -0,0 +1,148 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/pooltune"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// errPoolTimeout reads like the go-redis pool timeout so isConnError and
+// callers matching on it treat both the same
+var errPoolTimeout = errors.New(poolTimeoutError)
+
+// poolLimiter caps the commands in flight at a size that can change at
+// runtime. go-redis fixes its pool size at creation, with auto tuning the
+// pool is created at the upper bound and the limiter is the effective size.
+type poolLimiter struct {
+	clock   clock.Clock
+	timeout time.Duration
+
+	mu       sync.Mutex
+	size     int
+	inUse    int
+	waiters  []chan struct{}
+	waits    int64
+	timeouts int64
+}
+
+func newPoolLimiter(size int, timeout time.Duration, c clock.Clock) *poolLimiter {
+	return &poolLimiter{size: size, timeout: timeout, clock: clock.Or(c)}
+}
+
+// acquire takes a slot, waiting up to the pool timeout for one
+func (l *poolLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.inUse < l.size {
+		l.inUse++
+		l.mu.Unlock()
+		return nil
+	}
+	l.waits++
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	var expired <-chan time.Time
+	if l.timeout > 0 {
+		timer := l.clock.NewTimer(l.timeout)
+		defer timer.Stop()
+		expired = timer.C()
+	}
+
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-expired:
+		err = errPoolTimeout
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, w := range l.waiters {
+		if w == ready {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			if err == errPoolTimeout {
+				l.timeouts++
+			}
+			return err
+		}
+	}
+	// handed a slot while giving up, pass it on
+	l.releaseLocked()
+	return err
+}
+
+func (l *poolLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseLocked()
+}
+
+// releaseLocked hands the slot to the oldest waiter unless the pool shrank
+// below what is in use
+func (l *poolLimiter) releaseLocked() {
+	if len(l.waiters) > 0 && l.inUse <= l.size {
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+		return
+	}
+	l.inUse--
+}
+
+func (l *poolLimiter) Resize(size int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.size = size
+	for l.inUse < l.size && len(l.waiters) > 0 {
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+		l.inUse++
+	}
+}
+
+func (l *poolLimiter) Stats() pooltune.Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return pooltune.Stats{Size: l.size, InUse: l.inUse, WaitCount: l.waits, Timeouts: l.timeouts}
+}
+
+func (l *poolLimiter) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (l *poolLimiter) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := l.acquire(ctx); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		defer l.release()
+		return next(ctx, cmd)
+	}
+}
+
+func (l *poolLimiter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := l.acquire(ctx); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		defer l.release()
+		return next(ctx, cmds)
+	}
+}
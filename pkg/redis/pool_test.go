@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := newPoolLimiter(1, 0, nil)
+
+	require.NoError(t, l.acquire(ctx))
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- l.acquire(ctx) }()
+	assert.Eventually(t, func() bool { return l.Stats().WaitCount == 1 }, time.Second, time.Millisecond)
+
+	l.Resize(2)
+	require.NoError(t, <-acquired, "growing hands the new slot to a waiter")
+	assert.Equal(t, 2, l.Stats().InUse)
+
+	l.Resize(1)
+	l.release()
+	assert.Equal(t, 1, l.Stats().InUse, "shrinking drains as slots are released")
+	l.release()
+	assert.Equal(t, 0, l.Stats().InUse)
+}
+
+func TestPoolLimiterTimeout(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := newPoolLimiter(1, time.Second, fake)
+	require.NoError(t, l.acquire(context.Background()))
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- l.acquire(context.Background()) }()
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+
+	err := <-acquired
+	assert.ErrorIs(t, err, errPoolTimeout)
+	assert.False(t, isConnError(err))
+	assert.Equal(t, int64(1), l.Stats().Timeouts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, l.acquire(ctx), context.Canceled)
+	assert.Equal(t, int64(1), l.Stats().Timeouts, "a cancelled caller is not a timeout")
+
+	l.release()
+	require.NoError(t, l.acquire(context.Background()), "the slot is free after waiters gave up")
+}
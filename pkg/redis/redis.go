@@ -8,6 +8,9 @@ import (
 	"time"
 
 	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/pooltune"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -28,15 +31,17 @@ const (
 type RedisClient struct {
 	client *redis.Client
 	config *config.Config
+	conn   *connTracker
+	clock  clock.Clock
 	mu     sync.RWMutex
 	stats  RedisStats
-}
+	// refresh is nil when StatsInterval is 0, tuner without PoolMaxSize
+	refresh *statsRefresher
+	tuner   *pooltune.Tuner
 
-type RedisStats struct {
-	TotalCommands   uint64
-	FailedCommands  uint64
-	ConnectedClients uint32
-	BlockedClients  uint32
+	modules    Modules
+	searchOnce sync.Once
+	search     *redis.Client
 }
 
 type RedisOptions struct {
@@ -55,53 +60,170 @@ type RedisOptions struct {
 	ReadBufferSize  int
 	WriteBufferSize int
 	Protocol        int // RESP protocol version (2 or 3)
+	// SentinelAddrs asks these sentinels for the master named SentinelMaster
+	// instead of dialing Addr
+	SentinelAddrs    []string
+	SentinelMaster   string
+	SentinelPassword string
+	// Logger receives commands slower than SlowThreshold, 0 turns that off
+	Logger        *logger.Logger
+	SlowThreshold time.Duration
+	// HealthInterval is how often an idle connection is probed, while
+	// degraded probes back off from 100ms to 10s
+	HealthInterval time.Duration
+	// StatsInterval refreshes GetStats from INFO, 0 only refreshes on
+	// UpdateStats
+	StatsInterval time.Duration
+	// PoolMaxSize turns on pool auto tuning: the pool starts at PoolSize
+	// and grows up to PoolMaxSize while commands wait for a connection,
+	// shrinking back towards PoolMinSize when idle
+	PoolMinSize int
+	PoolMaxSize int
+	// Lazy returns a degraded client instead of an error when redis is
+	// unreachable, it connects once redis answers a probe
+	Lazy  bool
+	Clock clock.Clock
+	// Hooks run inside the client's own, on every command but the probes
+	// of the health tracker too
+	Hooks []redis.Hook
 }
 
-func NewRedisClient(cfg *config.Config) (*RedisClient, error) {
+func NewRedisClient(cfg *config.Config, log *logger.Logger) (*RedisClient, error) {
 	opts := buildOptions(cfg)
+	opts.Logger = log
 	return NewRedisClientWithOptions(cfg, opts)
 }
 
+// OptionsFromConfig is what NewRedisClient connects with, for callers that
+// change some of it
+func OptionsFromConfig(cfg *config.Config) RedisOptions {
+	return buildOptions(cfg)
+}
+
 func NewRedisClientWithOptions(cfg *config.Config, opts RedisOptions) (*RedisClient, error) {
 	if opts.Addr == "" {
 		opts.Addr = "localhost:6379"
 	}
 
-	client := redis.NewClient(&redis.Options{
-		Addr:            opts.Addr,
-		Password:        opts.Password,
-		DB:              opts.DB,
-		PoolSize:        opts.PoolSize,
-		MinIdleConns:    opts.MinIdleConns,
-		PoolTimeout:     opts.PoolTimeout,
-		DialTimeout:     opts.DialTimeout,
-		ReadTimeout:     opts.ReadTimeout,
-		WriteTimeout:    opts.WriteTimeout,
-		MaxRetries:      opts.MaxRetries,
-		MaxRetryBackoff: opts.MaxRetryBackoff,
-		MinRetryBackoff: opts.MinRetryBackoff,
-		Protocol:        opts.Protocol,
-		OnConnect: func(ctx context.Context, cn *redis.Conn) error {
-			return cn.Ping(ctx).Err()
-		},
-	})
+	onConnect := func(ctx context.Context, cn *redis.Conn) error {
+		return cn.Ping(ctx).Err()
+	}
+
+	// go-redis cannot resize a pool, a tuned one is opened at the upper
+	// bound and limited below it
+	var limiter *poolLimiter
+	if opts.PoolMaxSize > 0 {
+		if opts.PoolSize <= 0 {
+			opts.PoolSize = defaultPoolSize
+		}
+		limiter = newPoolLimiter(opts.PoolSize, opts.PoolTimeout, opts.Clock)
+		opts.PoolSize = opts.PoolMaxSize
+	}
+
+	var client *redis.Client
+	if len(opts.SentinelAddrs) > 0 {
+		// the failover client follows the master sentinel announces
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       opts.SentinelMaster,
+			SentinelAddrs:    opts.SentinelAddrs,
+			SentinelPassword: opts.SentinelPassword,
+			Password:         opts.Password,
+			DB:               opts.DB,
+			PoolSize:         opts.PoolSize,
+			MinIdleConns:     opts.MinIdleConns,
+			PoolTimeout:      opts.PoolTimeout,
+			DialTimeout:      opts.DialTimeout,
+			ReadTimeout:      opts.ReadTimeout,
+			WriteTimeout:     opts.WriteTimeout,
+			MaxRetries:       opts.MaxRetries,
+			MaxRetryBackoff:  opts.MaxRetryBackoff,
+			MinRetryBackoff:  opts.MinRetryBackoff,
+			Protocol:         opts.Protocol,
+			OnConnect:        onConnect,
+		})
+	} else {
+		client = redis.NewClient(&redis.Options{
+			Addr:            opts.Addr,
+			Password:        opts.Password,
+			DB:              opts.DB,
+			PoolSize:        opts.PoolSize,
+			MinIdleConns:    opts.MinIdleConns,
+			PoolTimeout:     opts.PoolTimeout,
+			DialTimeout:     opts.DialTimeout,
+			ReadTimeout:     opts.ReadTimeout,
+			WriteTimeout:    opts.WriteTimeout,
+			MaxRetries:      opts.MaxRetries,
+			MaxRetryBackoff: opts.MaxRetryBackoff,
+			MinRetryBackoff: opts.MinRetryBackoff,
+			Protocol:        opts.Protocol,
+			OnConnect:       onConnect,
+		})
+	}
+
+	conn := newConnTracker(opts.Logger, opts.HealthInterval, opts.Clock)
+	client.AddHook(newCommandHook(opts.Logger, opts.SlowThreshold, opts.Clock))
+	client.AddHook(connHook{t: conn})
+	if limiter != nil {
+		client.AddHook(limiter)
+	}
+	for _, h := range opts.Hooks {
+		client.AddHook(h)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	var (
+		modules  Modules
+		degraded bool
+	)
 	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
-	}
-
-	// Check server info for version compatibility
-	info, err := client.Info(ctx, "server").Result()
-	if err == nil {
-		fmt.Printf("Connected to Redis server: %s\n", info[:50])
+		if !opts.Lazy {
+			return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+		}
+		// a timed out ping is not seen by the hook, mark it ourselves
+		conn.observe(err)
+		degraded = true
+		if opts.Logger != nil {
+			opts.Logger.Warnw("Redis unreachable, starting degraded, module helpers are disabled until it is back", "addr", opts.Addr, "error", err.Error())
+		}
+	} else {
+		// Check server info for version compatibility
+		info, err := client.Info(ctx, "server").Result()
+		if err == nil {
+			fmt.Printf("Connected to Redis server: %s\n", info[:50])
+		}
+
+		// module helpers fail fast with ErrModuleUnavailable when missing
+		modules, err = detectModules(ctx, client)
+		if err != nil && opts.Logger != nil {
+			opts.Logger.Warnw("Redis module detection failed, module helpers are disabled", "error", err.Error())
+		}
 	}
 
 	rc := &RedisClient{
-		client: client,
-		config: cfg,
+		client:  client,
+		config:  cfg,
+		conn:    conn,
+		clock:   opts.Clock,
+		modules: modules,
+	}
+	if degraded {
+		rc.detectModulesOnConnect(opts.Logger)
+	}
+	conn.start(func(ctx context.Context) error { return client.Ping(ctx).Err() })
+	if opts.StatsInterval > 0 {
+		rc.refresh = startStatsRefresher(rc, opts.StatsInterval, opts.Clock, opts.Logger)
+	}
+	if limiter != nil {
+		rc.tuner = pooltune.New(limiter, pooltune.Options{
+			Name:   "redis",
+			Min:    opts.PoolMinSize,
+			Max:    opts.PoolMaxSize,
+			Logger: opts.Logger,
+			Clock:  opts.Clock,
+		})
+		rc.tuner.Start()
 	}
 
 	return rc, nil
@@ -110,16 +232,27 @@ func NewRedisClientWithOptions(cfg *config.Config, opts RedisOptions) (*RedisCli
 func buildOptions(cfg *config.Config) RedisOptions {
 	opts := RedisOptions{
 		Addr:            cfg.Redis.RedisAddr,
+		DB:              cfg.Redis.DB,
 		PoolSize:        cfg.Redis.PoolSize,
 		MinIdleConns:    cfg.Redis.MinIdleConn,
-		PoolTimeout:     time.Duration(cfg.Redis.PoolTimeout) * time.Second,
-		DialTimeout:     defaultDialTimeout,
-		ReadTimeout:     defaultReadTimeout,
-		WriteTimeout:    defaultWriteTimeout,
-		MaxRetries:      defaultMaxRetries,
+		PoolTimeout:     cfg.Redis.PoolTimeout,
+		DialTimeout:     cfg.Redis.DialTimeout,
+		ReadTimeout:     cfg.Redis.ReadTimeout,
+		WriteTimeout:    cfg.Redis.WriteTimeout,
+		MaxRetries:      cfg.Redis.MaxRetries,
 		ReadBufferSize:  defaultReadBufferSize,
 		WriteBufferSize: defaultWriteBufferSize,
 		Protocol:        3, // Use RESP3 by default for better performance
+
+		SentinelAddrs:    cfg.Redis.SentinelAddrs,
+		SentinelMaster:   cfg.Redis.SentinelMaster,
+		SentinelPassword: cfg.Redis.SentinelPassword,
+		SlowThreshold:    cfg.Redis.SlowThreshold,
+		HealthInterval:   cfg.Redis.HealthInterval,
+		StatsInterval:    cfg.Redis.StatsInterval,
+		PoolMinSize:      cfg.Redis.PoolMinSize,
+		PoolMaxSize:      cfg.Redis.PoolMaxSize,
+		Lazy:             cfg.Cache.Optional,
 	}
 
 	if opts.Addr == "" {
@@ -138,6 +271,22 @@ func buildOptions(cfg *config.Config) RedisOptions {
 		opts.PoolTimeout = defaultPoolTimeout
 	}
 
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = defaultDialTimeout
+	}
+
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = defaultReadTimeout
+	}
+
+	if opts.WriteTimeout == 0 {
+		opts.WriteTimeout = defaultWriteTimeout
+	}
+
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultMaxRetries
+	}
+
 	// Note: Buffer size configuration removed in v9
 	// Redis v9 handles buffer optimization internally
 
@@ -149,6 +298,18 @@ func (r *RedisClient) GetClient() *redis.Client {
 }
 
 func (r *RedisClient) Close() error {
+	if r.tuner != nil {
+		r.tuner.Stop()
+	}
+	if r.refresh != nil {
+		r.refresh.close()
+	}
+	if r.conn != nil {
+		r.conn.close()
+	}
+	if r.search != nil {
+		r.search.Close()
+	}
 	if r.client != nil {
 		return r.client.Close()
 	}
@@ -217,30 +378,6 @@ func (r *RedisClient) FlushAll(ctx context.Context) error {
 	return r.client.FlushAll(ctx).Err()
 }
 
-// UpdateStats fetches current Redis statistics
-func (r *RedisClient) UpdateStats() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
-	info, err := r.client.Info(ctx, "stats").Result()
-	if err != nil {
-		return fmt.Errorf("failed to get Redis stats: %w", err)
-	}
-
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	
-	fmt.Sscanf(info, "total_commands_processed:%d", &r.stats.TotalCommands)
-	
-	return nil
-}
-
-func (r *RedisClient) GetStats() RedisStats {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	return r.stats
-}
-
 // Common operations with improved error handling
 
 func (r *RedisClient) SetWithExpiry(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
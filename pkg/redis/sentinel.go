@@ -0,0 +1,335 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultSentinelPoll = 10 * time.Second
+	switchMasterChannel = "+switch-master"
+)
+
+var (
+	sentinelMaster = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_redis_sentinel_master",
+		Help: "Current redis master as announced by sentinel, 1 for the active address.",
+	}, []string{"master", "addr"})
+
+	sentinelFailovers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_redis_failovers_total",
+		Help: "Redis master changes seen through sentinel.",
+	}, []string{"master"})
+
+	sentinelReplicaLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_redis_replica_lag_bytes",
+		Help: "Replication offset a replica is behind the master.",
+	}, []string{"master", "replica"})
+)
+
+func init() {
+	prometheus.MustRegister(sentinelMaster, sentinelFailovers, sentinelReplicaLag)
+}
+
+type SentinelOptions struct {
+	// Master is the name sentinel monitors the master under
+	Master   string
+	Addrs    []string
+	Password string
+	// Poll is how often master and replica lag are refreshed, failovers
+	// are also picked up right away from +switch-master
+	Poll time.Duration
+	// MaxLag in bytes fails HealthCheck when a replica is further behind, 0 disables
+	MaxLag int64
+	Clock  clock.Clock
+}
+
+// SentinelStatus is what the monitor last saw
+type SentinelStatus struct {
+	Master       string
+	MasterAddr   string
+	Failovers    uint64
+	LastFailover time.Time
+	// ReplicaLag in bytes by replica address
+	ReplicaLag map[string]int64
+	LastError  error
+}
+
+// SentinelMonitor follows a sentinel managed master: it reports the master
+// address, counts and logs failovers and measures replica lag. The client
+// is the failover client from NewRedisClient, it answers for the master.
+type SentinelMonitor struct {
+	client    *redis.Client
+	sentinels []*redis.SentinelClient
+	log       *logger.Logger
+	opts      SentinelOptions
+
+	mu       sync.Mutex
+	status   SentinelStatus
+	replicas map[string]bool
+
+	cancel context.CancelFunc
+	group  *run.Group
+}
+
+// NewSentinelMonitor returns nil when cfg is not in sentinel mode
+func NewSentinelMonitor(cfg *config.Config, client *redis.Client, log *logger.Logger) *SentinelMonitor {
+	if len(cfg.Redis.SentinelAddrs) == 0 {
+		return nil
+	}
+	return NewSentinelMonitorWithOptions(client, log, SentinelOptions{
+		Master:   cfg.Redis.SentinelMaster,
+		Addrs:    cfg.Redis.SentinelAddrs,
+		Password: cfg.Redis.SentinelPassword,
+		Poll:     cfg.Redis.SentinelPoll,
+		MaxLag:   int64(cfg.Redis.SentinelMaxLag),
+	})
+}
+
+func NewSentinelMonitorWithOptions(client *redis.Client, log *logger.Logger, opts SentinelOptions) *SentinelMonitor {
+	if opts.Poll <= 0 {
+		opts.Poll = defaultSentinelPoll
+	}
+	opts.Clock = clock.Or(opts.Clock)
+
+	m := &SentinelMonitor{
+		client:   client,
+		log:      log,
+		opts:     opts,
+		status:   SentinelStatus{Master: opts.Master, ReplicaLag: map[string]int64{}},
+		replicas: map[string]bool{},
+	}
+	for _, addr := range opts.Addrs {
+		m.sentinels = append(m.sentinels, redis.NewSentinelClient(&redis.Options{
+			Addr:     addr,
+			Password: opts.Password,
+		}))
+	}
+	return m
+}
+
+// Start refreshes once and keeps watching in the background until Stop
+func (m *SentinelMonitor) Start(ctx context.Context) {
+	m.refresh(ctx)
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+
+	m.group = run.NewGroup(watchCtx, m.log)
+	for i, s := range m.sentinels {
+		m.group.Supervise("redis_sentinel_watch "+m.opts.Addrs[i], func(ctx context.Context) error {
+			return m.watch(ctx, s)
+		}, run.Options{Clock: m.opts.Clock})
+	}
+	m.group.Supervise("redis_sentinel_poll", m.poll, run.Options{Clock: m.opts.Clock})
+}
+
+func (m *SentinelMonitor) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	if m.group != nil {
+		m.group.Wait()
+	}
+	for _, s := range m.sentinels {
+		s.Close()
+	}
+}
+
+func (m *SentinelMonitor) Status() SentinelStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.status
+	s.ReplicaLag = make(map[string]int64, len(m.status.ReplicaLag))
+	for k, v := range m.status.ReplicaLag {
+		s.ReplicaLag[k] = v
+	}
+	return s
+}
+
+// HealthCheck fails while no master is known or a replica lags more than MaxLag
+func (m *SentinelMonitor) HealthCheck(ctx context.Context) error {
+	s := m.Status()
+	if s.MasterAddr == "" {
+		return fmt.Errorf("no redis master known for %s: %v", s.Master, s.LastError)
+	}
+	if m.opts.MaxLag > 0 {
+		for replica, lag := range s.ReplicaLag {
+			if lag > m.opts.MaxLag {
+				return fmt.Errorf("redis replica %s is %d bytes behind, max %d", replica, lag, m.opts.MaxLag)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *SentinelMonitor) poll(ctx context.Context) error {
+	ticker := m.opts.Clock.NewTicker(m.opts.Poll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			m.refresh(ctx)
+		}
+	}
+}
+
+// watch follows +switch-master on one sentinel, the first sentinel to
+// announce a new master wins, the others repeat what we already know. A
+// subscription that breaks off is an error, the supervisor subscribes again.
+func (m *SentinelMonitor) watch(ctx context.Context, s *redis.SentinelClient) error {
+	pubsub := s.Subscribe(ctx, switchMasterChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return errors.New("sentinel subscription closed")
+			}
+			if name, addr, ok := parseSwitchMaster(msg.Payload); ok && name == m.opts.Master {
+				m.observeMaster(addr)
+			}
+		}
+	}
+}
+
+// refresh asks the sentinels in turn for the master and replicas
+func (m *SentinelMonitor) refresh(ctx context.Context) {
+	var err error
+	for _, s := range m.sentinels {
+		if err = m.refreshFrom(ctx, s); err == nil {
+			break
+		}
+	}
+
+	m.mu.Lock()
+	m.status.LastError = err
+	m.mu.Unlock()
+
+	if err != nil {
+		m.log.Warnw("Redis sentinel refresh failed", "master", m.opts.Master, "error", err.Error())
+	}
+}
+
+func (m *SentinelMonitor) refreshFrom(ctx context.Context, s *redis.SentinelClient) error {
+	hostPort, err := s.GetMasterAddrByName(ctx, m.opts.Master).Result()
+	if err != nil {
+		return err
+	}
+	if len(hostPort) != 2 {
+		return fmt.Errorf("unexpected master address %v", hostPort)
+	}
+	m.observeMaster(net.JoinHostPort(hostPort[0], hostPort[1]))
+
+	replicas, err := s.Replicas(ctx, m.opts.Master).Result()
+	if err != nil {
+		return err
+	}
+
+	info, err := m.client.Info(ctx, "replication").Result()
+	if err != nil {
+		return err
+	}
+	masterOffset, ok := infoInt(info, "master_repl_offset")
+	if !ok {
+		return fmt.Errorf("master_repl_offset missing from INFO replication")
+	}
+
+	m.observeReplicas(replicaLag(masterOffset, replicas))
+	return nil
+}
+
+// observeMaster records addr, a change from a known master is a failover
+func (m *SentinelMonitor) observeMaster(addr string) {
+	m.mu.Lock()
+	old := m.status.MasterAddr
+	if old == addr {
+		m.mu.Unlock()
+		return
+	}
+	m.status.MasterAddr = addr
+	if old != "" {
+		m.status.Failovers++
+		m.status.LastFailover = m.opts.Clock.Now()
+	}
+	m.mu.Unlock()
+
+	if old != "" {
+		sentinelMaster.DeleteLabelValues(m.opts.Master, old)
+		sentinelFailovers.WithLabelValues(m.opts.Master).Inc()
+		m.log.Warnw("Redis master failover", "master", m.opts.Master, "from", old, "to", addr)
+	} else {
+		m.log.Infow("Redis master found through sentinel", "master", m.opts.Master, "addr", addr)
+	}
+	sentinelMaster.WithLabelValues(m.opts.Master, addr).Set(1)
+}
+
+func (m *SentinelMonitor) observeReplicas(lag map[string]int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for replica := range m.replicas {
+		if _, ok := lag[replica]; !ok {
+			sentinelReplicaLag.DeleteLabelValues(m.opts.Master, replica)
+			delete(m.replicas, replica)
+		}
+	}
+	for replica, bytes := range lag {
+		sentinelReplicaLag.WithLabelValues(m.opts.Master, replica).Set(float64(bytes))
+		m.replicas[replica] = true
+	}
+	m.status.ReplicaLag = lag
+}
+
+// parseSwitchMaster reads "<name> <old-ip> <old-port> <new-ip> <new-port>"
+func parseSwitchMaster(payload string) (name, addr string, ok bool) {
+	parts := strings.Fields(payload)
+	if len(parts) != 5 {
+		return "", "", false
+	}
+	return parts[0], net.JoinHostPort(parts[3], parts[4]), true
+}
+
+// replicaLag turns SENTINEL REPLICAS output into bytes behind the master,
+// replicas sentinel flags as down are left out
+func replicaLag(masterOffset int64, replicas []map[string]string) map[string]int64 {
+	lag := make(map[string]int64, len(replicas))
+	for _, r := range replicas {
+		if strings.Contains(r["flags"], "down") {
+			continue
+		}
+		offset, err := strconv.ParseInt(r["slave-repl-offset"], 10, 64)
+		if err != nil {
+			continue
+		}
+		behind := masterOffset - offset
+		if behind < 0 {
+			behind = 0
+		}
+		lag[net.JoinHostPort(r["ip"], r["port"])] = behind
+	}
+	return lag
+}
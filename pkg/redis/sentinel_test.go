@@ -0,0 +1,109 @@
+package redis
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMonitor(t *testing.T, opts SentinelOptions) (*SentinelMonitor, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.log")
+	log, err := logger.NewLoggerWithOptions(&config.Config{}, logger.LoggerOptions{
+		Level:      "info",
+		OutputPath: path,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { log.Close() })
+
+	return NewSentinelMonitorWithOptions(nil, log, opts), path
+}
+
+func TestParseSwitchMaster(t *testing.T) {
+	name, addr, ok := parseSwitchMaster("mymaster 10.0.0.1 6379 10.0.0.2 6380")
+	require.True(t, ok)
+	assert.Equal(t, "mymaster", name)
+	assert.Equal(t, "10.0.0.2:6380", addr)
+
+	_, _, ok = parseSwitchMaster("mymaster 10.0.0.1 6379")
+	assert.False(t, ok)
+}
+
+func TestInfoInt(t *testing.T) {
+	info := "# Replication\r\nrole:master\r\nconnected_slaves:2\r\nmaster_repl_offset:1500\r\n"
+
+	n, ok := infoInt(info, "master_repl_offset")
+	require.True(t, ok)
+	assert.Equal(t, int64(1500), n)
+
+	_, ok = infoInt(info, "second_repl_offset")
+	assert.False(t, ok)
+}
+
+func TestReplicaLag(t *testing.T) {
+	lag := replicaLag(1500, []map[string]string{
+		{"ip": "10.0.0.2", "port": "6379", "flags": "slave", "slave-repl-offset": "1000"},
+		{"ip": "10.0.0.3", "port": "6379", "flags": "slave", "slave-repl-offset": "1600"},
+		{"ip": "10.0.0.4", "port": "6379", "flags": "s_down,slave", "slave-repl-offset": "0"},
+	})
+
+	assert.Equal(t, map[string]int64{
+		"10.0.0.2:6379": 500,
+		"10.0.0.3:6379": 0,
+	}, lag)
+}
+
+func TestSentinelMonitorFailover(t *testing.T) {
+	sentinelFailovers.Reset()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, path := newTestMonitor(t, SentinelOptions{Master: "failover-test", Clock: fake})
+	ctx := context.Background()
+
+	assert.Error(t, m.HealthCheck(ctx), "no master known yet")
+
+	m.observeMaster("10.0.0.1:6379")
+	require.NoError(t, m.HealthCheck(ctx))
+	assert.Equal(t, uint64(0), m.Status().Failovers, "first master is not a failover")
+
+	fake.Advance(time.Minute)
+	m.observeMaster("10.0.0.2:6379")
+	m.observeMaster("10.0.0.2:6379") // repeated by another sentinel
+
+	s := m.Status()
+	assert.Equal(t, "10.0.0.2:6379", s.MasterAddr)
+	assert.Equal(t, uint64(1), s.Failovers)
+	assert.Equal(t, fake.Now(), s.LastFailover)
+	assert.Equal(t, 1.0, testutil.ToFloat64(sentinelFailovers.WithLabelValues("failover-test")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(sentinelMaster.WithLabelValues("failover-test", "10.0.0.2:6379")))
+
+	m.log.Sync()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Redis master failover")
+}
+
+func TestSentinelMonitorReplicaLag(t *testing.T) {
+	sentinelReplicaLag.Reset()
+	m, _ := newTestMonitor(t, SentinelOptions{Master: "lag-test", MaxLag: 1000})
+	ctx := context.Background()
+	m.observeMaster("10.0.0.1:6379")
+
+	m.observeReplicas(map[string]int64{"10.0.0.2:6379": 200, "10.0.0.3:6379": 5000})
+	assert.Error(t, m.HealthCheck(ctx))
+	assert.Equal(t, 5000.0, testutil.ToFloat64(sentinelReplicaLag.WithLabelValues("lag-test", "10.0.0.3:6379")))
+
+	// a replica that went away drops out of the metric
+	m.observeReplicas(map[string]int64{"10.0.0.2:6379": 200})
+	require.NoError(t, m.HealthCheck(ctx))
+	assert.Equal(t, 1, testutil.CollectAndCount(sentinelReplicaLag))
+}
@@ -0,0 +1,192 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"blueprint/pkg/coalesce"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DownsampleRule keeps an aggregated copy of a series in its own key,
+// e.g. one minute averages of price ticks kept for a month
+type DownsampleRule struct {
+	Aggregation redis.Aggregator
+	Bucket      time.Duration
+	// Retention of the aggregated series, 0 keeps it forever
+	Retention time.Duration
+}
+
+// TimeSeriesOptions apply when the series is first created
+type TimeSeriesOptions struct {
+	// Retention drops raw samples older than this, 0 keeps them forever
+	Retention time.Duration
+	Labels    map[string]string
+	// DuplicatePolicy decides what a second sample at the same millisecond
+	// does: BLOCK, FIRST, LAST (default), MIN, MAX or SUM
+	DuplicatePolicy string
+	Rules           []DownsampleRule
+}
+
+// Sample is one point of a series
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// TimeSeries stores samples such as price ticks or latencies in
+// RedisTimeSeries for fast recent-window queries
+type TimeSeries struct {
+	client *redis.Client
+	key    string
+}
+
+// TimeSeries creates the series under key and its downsampling rules unless
+// they exist. It fails with ErrModuleUnavailable without RedisTimeSeries.
+func (r *RedisClient) TimeSeries(ctx context.Context, key string, opts TimeSeriesOptions) (*TimeSeries, error) {
+	if err := r.requireModule(r.Modules().TimeSeries, "RedisTimeSeries"); err != nil {
+		return nil, err
+	}
+	if opts.DuplicatePolicy == "" {
+		opts.DuplicatePolicy = "LAST"
+	}
+
+	create := func(key string, retention time.Duration, labels map[string]string) error {
+		err := r.client.TSCreateWithArgs(ctx, key, &redis.TSOptions{
+			Retention:       int(retention.Milliseconds()),
+			DuplicatePolicy: opts.DuplicatePolicy,
+			Labels:          labels,
+		}).Err()
+		if err != nil && !isAlreadyExists(err) {
+			return fmt.Errorf("timeseries %s create: %w", key, err)
+		}
+		return nil
+	}
+
+	if err := create(key, opts.Retention, opts.Labels); err != nil {
+		return nil, err
+	}
+	for _, rule := range opts.Rules {
+		dest := downsampleKey(key, rule.Aggregation, rule.Bucket)
+		if err := create(dest, rule.Retention, opts.Labels); err != nil {
+			return nil, err
+		}
+		err := r.client.TSCreateRule(ctx, key, dest, rule.Aggregation, int(rule.Bucket.Milliseconds())).Err()
+		if err != nil && !isAlreadyExists(err) {
+			return nil, fmt.Errorf("timeseries %s rule %s: %w", key, dest, err)
+		}
+	}
+
+	return &TimeSeries{client: r.client, key: key}, nil
+}
+
+func (ts *TimeSeries) Key() string {
+	return ts.key
+}
+
+// Downsampled is the series a rule writes to
+func (ts *TimeSeries) Downsampled(aggregation redis.Aggregator, bucket time.Duration) *TimeSeries {
+	return &TimeSeries{client: ts.client, key: downsampleKey(ts.key, aggregation, bucket)}
+}
+
+// Add appends a sample, the zero time stamps it with the server clock
+func (ts *TimeSeries) Add(ctx context.Context, at time.Time, value float64) error {
+	var stamp interface{} = "*"
+	if !at.IsZero() {
+		stamp = at.UnixMilli()
+	}
+	if err := ts.client.TSAdd(ctx, ts.key, stamp, value).Err(); err != nil {
+		return fmt.Errorf("timeseries %s add: %w", ts.key, err)
+	}
+	return nil
+}
+
+// AddMany appends samples in one round trip
+func (ts *TimeSeries) AddMany(ctx context.Context, samples ...Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	batch := make([][]interface{}, len(samples))
+	for i, s := range samples {
+		batch[i] = []interface{}{ts.key, s.Time.UnixMilli(), s.Value}
+	}
+	if err := ts.client.TSMAdd(ctx, batch).Err(); err != nil {
+		return fmt.Errorf("timeseries %s add: %w", ts.key, err)
+	}
+	return nil
+}
+
+// Coalesced buffers samples passed to its Add and writes them with AddMany
+// in batches, for series fed at tick rates. Samples need their Time set.
+// Close it on shutdown to write the last ones.
+func (ts *TimeSeries) Coalesced(opts coalesce.Options) *coalesce.Coalescer {
+	if opts.Name == "" {
+		opts.Name = ts.key
+	}
+	return coalesce.New(func(ctx context.Context, items []interface{}) error {
+		samples := make([]Sample, len(items))
+		for i, item := range items {
+			samples[i] = item.(Sample)
+		}
+		return ts.AddMany(ctx, samples...)
+	}, opts)
+}
+
+// Latest is the newest sample, an error wrapping redis.Nil when empty
+func (ts *TimeSeries) Latest(ctx context.Context) (Sample, error) {
+	v, err := ts.client.TSGet(ctx, ts.key).Result()
+	if err != nil {
+		return Sample{}, fmt.Errorf("timeseries %s latest: %w", ts.key, err)
+	}
+	if v.Timestamp == 0 && v.Value == 0 {
+		return Sample{}, fmt.Errorf("timeseries %s is empty: %w", ts.key, redis.Nil)
+	}
+	return toSample(v), nil
+}
+
+// Range returns the raw samples in [from, to]
+func (ts *TimeSeries) Range(ctx context.Context, from, to time.Time) ([]Sample, error) {
+	return ts.rangeWith(ctx, from, to, nil)
+}
+
+// Aggregate buckets the samples in [from, to] on the fly, for windows no
+// rule covers
+func (ts *TimeSeries) Aggregate(ctx context.Context, from, to time.Time, aggregation redis.Aggregator, bucket time.Duration) ([]Sample, error) {
+	return ts.rangeWith(ctx, from, to, &redis.TSRangeOptions{
+		Aggregator:     aggregation,
+		BucketDuration: int(bucket.Milliseconds()),
+	})
+}
+
+func (ts *TimeSeries) rangeWith(ctx context.Context, from, to time.Time, opts *redis.TSRangeOptions) ([]Sample, error) {
+	values, err := ts.client.TSRangeWithArgs(ctx, ts.key, int(from.UnixMilli()), int(to.UnixMilli()), opts).Result()
+	if err != nil {
+		return nil, fmt.Errorf("timeseries %s range: %w", ts.key, err)
+	}
+	samples := make([]Sample, len(values))
+	for i, v := range values {
+		samples[i] = toSample(v)
+	}
+	return samples, nil
+}
+
+// downsampleKey names a rule's series after its source, e.g.
+// ticks:BTC:avg:1m0s
+func downsampleKey(key string, aggregation redis.Aggregator, bucket time.Duration) string {
+	return fmt.Sprintf("%s:%s:%s", key, strings.ToLower(aggregation.String()), bucket)
+}
+
+func toSample(v redis.TSTimestampValue) Sample {
+	return Sample{Time: time.UnixMilli(v.Timestamp), Value: v.Value}
+}
+
+// isAlreadyExists matches the errors for an existing index, series or
+// rule, RedisTimeSeries reports the latter as "already has a src rule"
+func isAlreadyExists(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already exists") || strings.Contains(msg, "already has")
+}
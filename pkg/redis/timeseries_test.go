@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blueprint/pkg/coalesce"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownsampleKey(t *testing.T) {
+	assert.Equal(t, "ticks:BTC:avg:1m0s", downsampleKey("ticks:BTC", redis.Avg, time.Minute))
+}
+
+func TestTimeSeriesUnavailable(t *testing.T) {
+	_, err := (&RedisClient{}).TimeSeries(context.Background(), "ticks:BTC", TimeSeriesOptions{})
+	assert.ErrorIs(t, err, ErrModuleUnavailable)
+}
+
+func TestTimeSeries(t *testing.T) {
+	rc := newTestClient(t)
+	if !rc.Modules().TimeSeries {
+		t.Skip("redis without RedisTimeSeries")
+	}
+	ctx := context.Background()
+
+	ts, err := rc.TimeSeries(ctx, "ticks:BTC", TimeSeriesOptions{
+		Retention: time.Hour,
+		Labels:    map[string]string{"symbol": "BTC"},
+		Rules:     []DownsampleRule{{Aggregation: redis.Max, Bucket: time.Minute}},
+	})
+	require.NoError(t, err)
+
+	start := time.Now().Truncate(time.Minute).Add(-5 * time.Minute)
+	require.NoError(t, ts.AddMany(ctx,
+		Sample{Time: start, Value: 100},
+		Sample{Time: start.Add(10 * time.Second), Value: 104},
+		Sample{Time: start.Add(70 * time.Second), Value: 101},
+	))
+	// closes the second bucket so the rule writes it
+	require.NoError(t, ts.Add(ctx, start.Add(3*time.Minute), 99))
+
+	raw, err := ts.Range(ctx, start, start.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, raw, 2)
+
+	latest, err := ts.Latest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 99.0, latest.Value)
+
+	perMinute, err := ts.Aggregate(ctx, start, start.Add(2*time.Minute), redis.Avg, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, perMinute, 2)
+	assert.Equal(t, 102.0, perMinute[0].Value)
+
+	maxes, err := ts.Downsampled(redis.Max, time.Minute).Range(ctx, start, start.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, maxes, 2)
+	assert.Equal(t, []float64{104, 101}, []float64{maxes[0].Value, maxes[1].Value})
+
+	ticks := ts.Coalesced(coalesce.Options{MaxItems: 10, MaxDelay: time.Hour})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, ticks.Add(Sample{Time: start.Add(time.Duration(4*60+i) * time.Second), Value: float64(i)}))
+	}
+	require.NoError(t, ticks.Close(ctx), "closing writes what is buffered")
+	latest, err = ts.Latest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, latest.Value)
+
+	again, err := rc.TimeSeries(ctx, "ticks:BTC", TimeSeriesOptions{Rules: []DownsampleRule{{Aggregation: redis.Max, Bucket: time.Minute}}})
+	require.NoError(t, err, "existing series and rules are reused")
+	assert.Equal(t, ts.Key(), again.Key())
+}
@@ -0,0 +1,260 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package reporting
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/crash"
+	"blueprint/pkg/run"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultQueueSize = 256
+	defaultTimeout   = 5 * time.Second
+	flushTimeout     = 2 * time.Second
+)
+
+// Event is the backend neutral error event
+type Event struct {
+	ID          string                 `json:"event_id"`
+	Time        time.Time              `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Message     string                 `json:"message"`
+	Logger      string                 `json:"logger,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Release     string                 `json:"release,omitempty"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Caller      string                 `json:"caller,omitempty"`
+	Stack       string                 `json:"stack,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+// Transport delivers events to Sentry, a webhook or anything else
+type Transport interface {
+	Send(ctx context.Context, event *Event) error
+}
+
+type Options struct {
+	Environment string
+	Release     string
+	ServerName  string
+	// SampleRate applies to logged errors in the 0..1 range, crash reports are always sent
+	SampleRate float64
+	QueueSize  int
+	Timeout    time.Duration
+}
+
+// Reporter queues events and ships them from a background worker so the
+// logging call site never waits on the network
+type Reporter struct {
+	transport Transport
+	opts      Options
+	queue     chan *Event
+	pending   sync.WaitGroup
+	dropped   uint64
+
+	mu     sync.Mutex
+	closed bool
+	group  *run.Group
+}
+
+// NewReporter picks the transport from config, Sentry wins over the webhook
+func NewReporter(cfg *config.Config, release string) (*Reporter, error) {
+	var transport Transport
+	switch {
+	case cfg.ErrorTracking.SentryDSN != "":
+		t, err := NewSentryTransport(cfg.ErrorTracking.SentryDSN)
+		if err != nil {
+			return nil, err
+		}
+		transport = t
+	case cfg.ErrorTracking.WebhookURL != "":
+		transport = NewWebhookTransport(cfg.ErrorTracking.WebhookURL)
+	default:
+		return nil, fmt.Errorf("no error tracking backend configured")
+	}
+
+	hostname, _ := os.Hostname()
+	return NewReporterWithOptions(transport, Options{
+		Environment: cfg.Setting.Environment,
+		Release:     release,
+		ServerName:  hostname,
+		SampleRate:  cfg.ErrorTracking.SampleRate,
+	}), nil
+}
+
+func NewReporterWithOptions(transport Transport, opts Options) *Reporter {
+	if opts.QueueSize == 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	r := &Reporter{
+		transport: transport,
+		opts:      opts,
+		queue:     make(chan *Event, opts.QueueSize),
+	}
+
+	// no logger, it would loop back into us; a panicking transport is
+	// counted and the worker restarted
+	r.group = run.NewGroup(context.Background(), nil)
+	r.group.Supervise("error_tracking", r.run, run.Options{})
+
+	return r
+}
+
+// Report implements logger.ErrorSink
+func (r *Reporter) Report(entry zapcore.Entry, fields map[string]interface{}) {
+	// panics reach us through the crash sink with the full report
+	if _, ok := fields["crash_id"]; ok {
+		return
+	}
+
+	if !r.sampled() {
+		return
+	}
+
+	event := r.newEvent(entry.Level.String(), entry.Message)
+	event.Time = entry.Time.UTC()
+	event.Logger = entry.LoggerName
+	event.Stack = entry.Stack
+	if entry.Caller.Defined {
+		event.Caller = entry.Caller.TrimmedPath()
+	}
+	for k, v := range fields {
+		event.Extra[k] = v
+	}
+
+	r.enqueue(event)
+}
+
+// Send implements crash.Sink
+func (r *Reporter) Send(ctx context.Context, report *crash.Report) error {
+	event := r.newEvent("fatal", "panic: "+report.Panic)
+	event.Time = report.Time
+	event.Stack = report.Stack
+	event.Tags["crash_id"] = report.ID
+	if report.Method != "" {
+		event.Tags["grpc.method"] = report.Method
+	}
+	event.Extra["peer"] = report.Peer
+	event.Extra["metadata"] = report.Metadata
+	if report.Goroutines != "" {
+		event.Extra["goroutines"] = report.Goroutines
+	}
+
+	r.enqueue(event)
+	return nil
+}
+
+// Flush waits for queued events, bounded so a dead backend can't hang shutdown
+func (r *Reporter) Flush() {
+	done := make(chan struct{})
+	run.Go(nil, "error_tracking_flush", func() {
+		r.pending.Wait()
+		close(done)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(flushTimeout):
+	}
+}
+
+func (r *Reporter) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.queue)
+	r.mu.Unlock()
+
+	r.group.Wait()
+	return nil
+}
+
+// Dropped is the number of events lost because the queue was full
+func (r *Reporter) Dropped() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// run sends the queue until Close closes it
+func (r *Reporter) run(ctx context.Context) error {
+	for event := range r.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), r.opts.Timeout)
+		if err := r.transport.Send(ctx, event); err != nil {
+			// the logger would loop back into us, stderr is the only safe place
+			fmt.Fprintf(os.Stderr, "error tracking: failed to send event %s: %v\n", event.ID, err)
+		}
+		cancel()
+		r.pending.Done()
+	}
+	return nil
+}
+
+func (r *Reporter) enqueue(event *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	r.pending.Add(1)
+	select {
+	case r.queue <- event:
+	default:
+		r.pending.Done()
+		r.dropped++
+	}
+}
+
+func (r *Reporter) sampled() bool {
+	if r.opts.SampleRate >= 1 {
+		return true
+	}
+	if r.opts.SampleRate <= 0 {
+		return false
+	}
+	return mrand.Float64() < r.opts.SampleRate
+}
+
+func (r *Reporter) newEvent(level, message string) *Event {
+	return &Event{
+		ID:          newEventID(),
+		Time:        time.Now().UTC(),
+		Level:       level,
+		Message:     message,
+		Environment: r.opts.Environment,
+		Release:     r.opts.Release,
+		ServerName:  r.opts.ServerName,
+		Tags:        map[string]string{},
+		Extra:       map[string]interface{}{},
+	}
+}
+
+// newEventID is a 32 char hex uuid as Sentry expects
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%032x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,132 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const sentryClient = "blueprint-reporting/1.0"
+
+// SentryTransport posts events to the Sentry store endpoint derived from the DSN
+type SentryTransport struct {
+	endpoint string
+	auth     string
+	client   *http.Client
+}
+
+type sentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Logger      string                 `json:"logger,omitempty"`
+	Platform    string                 `json:"platform"`
+	Message     string                 `json:"message"`
+	Culprit     string                 `json:"culprit,omitempty"`
+	Release     string                 `json:"release,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+// NewSentryTransport parses a DSN of the form https://<key>@<host>/<project>
+func NewSentryTransport(dsn string) (*SentryTransport, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry dsn: %w", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid sentry dsn: missing public key")
+	}
+
+	path := strings.Trim(u.Path, "/")
+	idx := strings.LastIndex(path, "/")
+	project := path[idx+1:]
+	if project == "" {
+		return nil, fmt.Errorf("invalid sentry dsn: missing project id")
+	}
+
+	prefix := ""
+	if idx > 0 {
+		prefix = "/" + path[:idx]
+	}
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", sentryClient, u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+
+	return &SentryTransport{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project),
+		auth:     auth,
+		client:   &http.Client{Timeout: defaultTimeout},
+	}, nil
+}
+
+func (s *SentryTransport) Send(ctx context.Context, event *Event) error {
+	extra := event.Extra
+	if event.Stack != "" {
+		extra = make(map[string]interface{}, len(event.Extra)+1)
+		for k, v := range event.Extra {
+			extra[k] = v
+		}
+		extra["stacktrace"] = event.Stack
+	}
+
+	body, err := json.Marshal(sentryEvent{
+		EventID:     event.ID,
+		Timestamp:   event.Time.Format("2006-01-02T15:04:05.000Z"),
+		Level:       sentryLevel(event.Level),
+		Logger:      event.Logger,
+		Platform:    "go",
+		Message:     event.Message,
+		Culprit:     event.Caller,
+		Release:     event.Release,
+		Environment: event.Environment,
+		ServerName:  event.ServerName,
+		Tags:        event.Tags,
+		Extra:       extra,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal sentry event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build sentry request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sentry request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sentry returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// sentryLevel maps zap levels onto the ones Sentry understands
+func sentryLevel(level string) string {
+	switch level {
+	case "dpanic", "panic", "fatal":
+		return "fatal"
+	case "warn":
+		return "warning"
+	default:
+		return level
+	}
+}
@@ -0,0 +1,220 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/db"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/specs"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultInterval  = time.Hour
+	defaultBatchSize = 1000
+
+	// lockName keeps replicas from pruning the same tables at once
+	lockName = "blueprint:retention"
+)
+
+var (
+	rowsPruned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_retention_rows_total",
+		Help: "Rows removed by retention by table and action, deleted or archived.",
+	}, []string{"table", "action"})
+
+	batches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_retention_batches_total",
+		Help: "Retention batches by table and result, ok or error.",
+	}, []string{"table", "result"})
+
+	lastRun = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_retention_last_success_timestamp_seconds",
+		Help: "When a table was last pruned up to its cutoff.",
+	}, []string{"table"})
+
+	partitionsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_retention_partitions_dropped_total",
+		Help: "Partitions dropped by retention because all their rows were past the cutoff, by table.",
+	}, []string{"table"})
+)
+
+func init() {
+	prometheus.MustRegister(rowsPruned, batches, lastRun, partitionsDropped)
+}
+
+// execer is the part of *sql.DB a Job needs
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type Options struct {
+	Policies []Policy
+	// Interval between runs, each run prunes every table down to its cutoff
+	Interval time.Duration
+	// BatchSize rows are removed per statement, with BatchPause between
+	// statements so replication and other queries keep up
+	BatchSize  int
+	BatchPause time.Duration
+	Clock      clock.Clock
+}
+
+// Job prunes its policies' tables every Interval. Only one replica runs at
+// a time, the others skip the run while a postgres advisory lock is held.
+type Job struct {
+	*db.Periodic
+	exec execer
+	log  *logger.Logger
+	opts Options
+	// expired lists the partitions of p's table past cutoff, nil skips
+	// dropping them
+	expired func(ctx context.Context, p Policy, cutoff time.Time) ([]string, error)
+}
+
+// NewJob returns nil when cfg has no policies
+func NewJob(cfg *config.Config, sqlDB *sql.DB, log *logger.Logger) (*Job, error) {
+	if len(cfg.Retention.Policies) == 0 {
+		return nil, nil
+	}
+	policies, err := specs.ParseAll(cfg.Retention.Policies, ParsePolicy)
+	if err != nil {
+		return nil, err
+	}
+	return NewJobWithOptions(sqlDB, log, Options{
+		Policies:   policies,
+		Interval:   cfg.Retention.Interval,
+		BatchSize:  cfg.Retention.BatchSize,
+		BatchPause: cfg.Retention.BatchPause,
+	}), nil
+}
+
+func NewJobWithOptions(sqlDB *sql.DB, log *logger.Logger, opts Options) *Job {
+	j := newJob(sqlDB, log, opts, db.AdvisoryLocker(sqlDB, lockName))
+	j.expired = func(ctx context.Context, p Policy, cutoff time.Time) ([]string, error) {
+		return expiredPartitions(ctx, sqlDB, p, cutoff)
+	}
+	return j
+}
+
+func expiredPartitions(ctx context.Context, sqlDB *sql.DB, p Policy, cutoff time.Time) ([]string, error) {
+	rows, err := sqlDB.QueryContext(ctx, expiredSQL, quote(p.Table), p.Column, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func newJob(exec execer, log *logger.Logger, opts Options, lock db.LockFunc) *Job {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	opts.Clock = clock.Or(opts.Clock)
+	j := &Job{exec: exec, log: log, opts: opts}
+	j.Periodic = db.NewPeriodic(log, db.PeriodicOptions{
+		Name:     "retention",
+		Interval: opts.Interval,
+		Lock:     lock,
+		Clock:    opts.Clock,
+	}, j.pruneAll)
+	return j
+}
+
+// pruneAll prunes every table down to its cutoff, a failing table does not
+// stop the others
+func (j *Job) pruneAll(ctx context.Context) error {
+	var firstErr error
+	for _, p := range j.opts.Policies {
+		if err := j.prune(ctx, p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (j *Job) prune(ctx context.Context, p Policy) error {
+	start := j.opts.Clock.Now()
+	cutoff := start.Add(-p.MaxAge)
+	query := p.batchSQL()
+
+	if err := j.dropExpired(ctx, p, cutoff); err != nil {
+		return err
+	}
+
+	var total int64
+	for {
+		res, err := j.exec.ExecContext(ctx, query, cutoff, j.opts.BatchSize)
+		if err != nil {
+			batches.WithLabelValues(p.Table, "error").Inc()
+			return fmt.Errorf("retention %s: %w", p.Table, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("retention %s: %w", p.Table, err)
+		}
+		batches.WithLabelValues(p.Table, "ok").Inc()
+		rowsPruned.WithLabelValues(p.Table, p.action()).Add(float64(n))
+		total += n
+
+		if n < int64(j.opts.BatchSize) {
+			break
+		}
+		if j.opts.BatchPause > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-j.opts.Clock.After(j.opts.BatchPause):
+			}
+		}
+	}
+
+	lastRun.WithLabelValues(p.Table).Set(float64(j.opts.Clock.Now().Unix()))
+	if j.log != nil && total > 0 {
+		j.log.Infow("Retention pruned table", "table", p.Table, "action", p.action(), "rows", total,
+			"cutoff", cutoff, "duration", j.opts.Clock.Since(start))
+	}
+	return nil
+}
+
+// dropExpired drops the partitions holding only rows past cutoff, instant
+// where deleting them a batch at a time is not. Rows of archived tables are
+// moved one batch at a time all the same.
+func (j *Job) dropExpired(ctx context.Context, p Policy, cutoff time.Time) error {
+	if p.Archive != "" || j.expired == nil {
+		return nil
+	}
+	names, err := j.expired(ctx, p, cutoff)
+	if err != nil {
+		return fmt.Errorf("retention %s: %w", p.Table, err)
+	}
+	for _, name := range names {
+		// the regclass name comes quoted where it needs to be
+		if _, err := j.exec.ExecContext(ctx, "DROP TABLE "+name); err != nil {
+			return fmt.Errorf("retention %s: drop %s: %w", p.Table, name, err)
+		}
+		partitionsDropped.WithLabelValues(p.Table).Inc()
+		if j.log != nil {
+			j.log.Infow("Retention dropped partition", "table", p.Table, "partition", name, "cutoff", cutoff)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB hands out the row counts queued per table, then 0
+type fakeDB struct {
+	mu    sync.Mutex
+	rows  map[string][]int64
+	fail  map[string]error
+	calls []call
+}
+
+type call struct {
+	query  string
+	cutoff time.Time
+	limit  int
+}
+
+func (f *fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(args) == 0 {
+		f.calls = append(f.calls, call{query: query})
+		return driver.RowsAffected(0), nil
+	}
+	f.calls = append(f.calls, call{query: query, cutoff: args[0].(time.Time), limit: args[1].(int)})
+	for table, err := range f.fail {
+		if query == (Policy{Table: table, Column: "ts"}).batchSQL() {
+			return nil, err
+		}
+	}
+	for table, counts := range f.rows {
+		if query == (Policy{Table: table, Column: "ts"}).batchSQL() && len(counts) > 0 {
+			f.rows[table] = counts[1:]
+			return driver.RowsAffected(counts[0]), nil
+		}
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (f *fakeDB) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.calls)
+}
+
+func TestRunOnceBatchesUntilDone(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	fake := &fakeDB{rows: map[string][]int64{"platform_tick": {100, 100, 40}}}
+	j := newJob(fake, nil, Options{
+		Policies:  []Policy{{Table: "platform_tick", Column: "ts", MaxAge: 24 * time.Hour}, {Table: "platform_candle", Column: "ts", MaxAge: time.Hour}},
+		BatchSize: 100,
+		Clock:     clock.NewFake(now),
+	}, nil)
+
+	require.NoError(t, j.RunOnce(context.Background()))
+	require.Len(t, fake.calls, 4, "three tick batches, the last one short, and one empty candle batch")
+	assert.Equal(t, now.Add(-24*time.Hour), fake.calls[0].cutoff)
+	assert.Equal(t, 100, fake.calls[0].limit)
+	assert.Equal(t, now.Add(-time.Hour), fake.calls[3].cutoff)
+}
+
+func TestRunOnceContinuesAfterFailure(t *testing.T) {
+	fake := &fakeDB{
+		rows: map[string][]int64{"platform_candle": {5}},
+		fail: map[string]error{"platform_tick": errors.New("statement timeout")},
+	}
+	j := newJob(fake, nil, Options{
+		Policies:  []Policy{{Table: "platform_tick", Column: "ts", MaxAge: time.Hour}, {Table: "platform_candle", Column: "ts", MaxAge: time.Hour}},
+		BatchSize: 10,
+	}, nil)
+
+	err := j.RunOnce(context.Background())
+	assert.ErrorContains(t, err, "retention platform_tick: statement timeout")
+	assert.Len(t, fake.calls, 2, "the candle table is still pruned")
+}
+
+func TestRunOncePausesBetweenBatches(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	fake := &fakeDB{rows: map[string][]int64{"platform_tick": {10, 10, 3}}}
+	j := newJob(fake, nil, Options{
+		Policies:   []Policy{{Table: "platform_tick", Column: "ts", MaxAge: time.Hour}},
+		BatchSize:  10,
+		BatchPause: time.Second,
+		Clock:      clk,
+	}, nil)
+
+	done := make(chan error)
+	go func() { done <- j.RunOnce(context.Background()) }()
+
+	clk.BlockUntil(1)
+	assert.Equal(t, 1, fake.callCount(), "waits before the next batch")
+	clk.Advance(time.Second)
+	clk.BlockUntil(1)
+	assert.Equal(t, 2, fake.callCount())
+	clk.Advance(time.Second)
+	require.NoError(t, <-done)
+	assert.Equal(t, 3, fake.callCount())
+}
+
+func TestRunOnceDropsExpiredPartitions(t *testing.T) {
+	now := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	fake := &fakeDB{}
+	j := newJob(fake, nil, Options{
+		Policies: []Policy{
+			{Table: "platform_tick", Column: "ts", MaxAge: 7 * 24 * time.Hour},
+			{Table: "platform_audit", Column: "ts", MaxAge: time.Hour, Archive: "platform_audit_archive"},
+		},
+		Clock: clock.NewFake(now),
+	}, nil)
+	var asked []time.Time
+	j.expired = func(ctx context.Context, p Policy, cutoff time.Time) ([]string, error) {
+		asked = append(asked, cutoff)
+		return []string{"platform_tick_p20240301", "platform_tick_p20240302"}, nil
+	}
+
+	require.NoError(t, j.RunOnce(context.Background()))
+	assert.Equal(t, []time.Time{now.Add(-7 * 24 * time.Hour)}, asked, "archived tables keep their partitions")
+	require.Len(t, fake.calls, 4)
+	assert.Equal(t, "DROP TABLE platform_tick_p20240301", fake.calls[0].query)
+	assert.Equal(t, "DROP TABLE platform_tick_p20240302", fake.calls[1].query)
+	assert.Equal(t, (Policy{Table: "platform_tick", Column: "ts"}).batchSQL(), fake.calls[2].query, "rows of the partition still current")
+}
+
+func TestRunOnceSkipsWithoutLock(t *testing.T) {
+	fake := &fakeDB{}
+	j := newJob(fake, nil, Options{Policies: []Policy{{Table: "platform_tick", Column: "ts", MaxAge: time.Hour}}}, func(ctx context.Context) (func(), bool, error) { return nil, false, nil })
+
+	require.NoError(t, j.RunOnce(context.Background()))
+	assert.Empty(t, fake.calls, "another replica is pruning")
+}
+
+func TestStartRunsEveryInterval(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	fake := &fakeDB{}
+	j := newJob(fake, nil, Options{
+		Policies: []Policy{{Table: "platform_tick", Column: "ts", MaxAge: time.Hour}},
+		Interval: time.Minute,
+		Clock:    clk,
+	}, nil)
+	j.Start()
+	defer j.Stop()
+
+	clk.BlockUntil(1)
+	assert.Equal(t, 0, fake.callCount())
+	clk.Advance(time.Minute)
+	assert.Eventually(t, func() bool { return fake.callCount() == 1 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,106 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package retention prunes time-series tables (ticks, candles, audit
+// trails): rows older than a policy's age are deleted, or moved to an
+// archive table, in small batches so the tables stay online.
+package retention
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Policy keeps rows of Table whose Column, a timestamp, is at most MaxAge
+// old. Older rows are deleted, or moved into Archive when it is set, a
+// table with the same columns.
+type Policy struct {
+	Table   string
+	Column  string
+	MaxAge  time.Duration
+	Archive string
+}
+
+// ParsePolicy reads "table.column=age[:archive]", e.g.
+// "platform_tick.created_at=30d" or
+// "audit.platform_audit.created_at=90d:audit.platform_audit_archive". Age
+// is a Go duration or a number of days like 30d.
+func ParsePolicy(spec string) (Policy, error) {
+	target, rest, ok := strings.Cut(spec, "=")
+	dot := strings.LastIndex(target, ".")
+	if !ok || dot <= 0 {
+		return Policy{}, fmt.Errorf("retention %q: want table.column=age[:archive]", spec)
+	}
+
+	ageSpec, archive, _ := strings.Cut(rest, ":")
+	age, err := parseAge(ageSpec)
+	if err != nil || age <= 0 {
+		return Policy{}, fmt.Errorf("retention %q: invalid age %q", spec, ageSpec)
+	}
+
+	p := Policy{Table: target[:dot], Column: target[dot+1:], MaxAge: age, Archive: archive}
+	names := []string{p.Table, p.Column}
+	if archive != "" {
+		names = append(names, archive)
+	}
+	for _, name := range names {
+		for _, part := range strings.Split(name, ".") {
+			if !identifier.MatchString(part) {
+				return Policy{}, fmt.Errorf("retention %q: invalid name %q", spec, name)
+			}
+		}
+	}
+	return p, nil
+}
+
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// batchSQL removes up to $2 rows older than $1, moving them into the
+// archive in the same statement so a failure loses nothing. ctid picks the
+// rows without needing a primary key; each partition numbers its own, so
+// tableoid goes with it.
+func (p Policy) batchSQL() string {
+	table := quote(p.Table)
+	victims := fmt.Sprintf("DELETE FROM %s WHERE (tableoid, ctid) IN (SELECT tableoid, ctid FROM %s WHERE %s < $1 LIMIT $2)",
+		table, table, pgx.Identifier{p.Column}.Sanitize())
+	if p.Archive == "" {
+		return victims
+	}
+	return fmt.Sprintf("WITH moved AS (%s RETURNING *) INSERT INTO %s SELECT * FROM moved", victims, quote(p.Archive))
+}
+
+// expiredSQL lists the partitions of table $1, range partitioned by
+// column $2, that end at or before $3: every row in them is past the
+// cutoff. A table that is not partitioned has none.
+const expiredSQL = `SELECT c.oid::regclass::text
+FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = to_regclass($1)
+AND pg_get_partkeydef(i.inhparent) = 'RANGE (' || quote_ident($2) || ')'
+AND (regexp_match(pg_get_expr(c.relpartbound, c.oid), 'TO \(''([^'']+)''\)'))[1]::timestamptz <= $3`
+
+// action names what happens to old rows in logs and metrics
+func (p Policy) action() string {
+	if p.Archive != "" {
+		return "archived"
+	}
+	return "deleted"
+}
+
+func quote(name string) string {
+	return pgx.Identifier(strings.Split(name, ".")).Sanitize()
+}
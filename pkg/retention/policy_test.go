@@ -0,0 +1,51 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"blueprint/pkg/specs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("platform_tick.created_at=30d")
+	require.NoError(t, err)
+	assert.Equal(t, Policy{Table: "platform_tick", Column: "created_at", MaxAge: 30 * 24 * time.Hour}, p)
+
+	p, err = ParsePolicy("audit.platform_audit.created_at=2160h:audit.platform_audit_archive")
+	require.NoError(t, err)
+	assert.Equal(t, Policy{Table: "audit.platform_audit", Column: "created_at", MaxAge: 90 * 24 * time.Hour, Archive: "audit.platform_audit_archive"}, p)
+
+	for _, bad := range []string{
+		"platform_tick=30d",
+		".created_at=30d",
+		"platform_tick.created_at",
+		"platform_tick.created_at=0d",
+		"platform_tick.created_at=soon",
+		`platform_tick.created_at"; DROP TABLE x; --=30d`,
+		"platform_tick.created_at=30d:archive table",
+	} {
+		_, err := ParsePolicy(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := specs.ParseAll([]string{"platform_tick.ts=7d", "platform_candle.ts=365d"}, ParsePolicy)
+	require.NoError(t, err)
+	assert.Len(t, policies, 2)
+
+	_, err = specs.ParseAll([]string{"platform_tick.ts=7d", "broken"}, ParsePolicy)
+	assert.Error(t, err)
+}
+
+func TestBatchSQL(t *testing.T) {
+	p := Policy{Table: "platform_tick", Column: "created_at"}
+	assert.Equal(t, `DELETE FROM "platform_tick" WHERE (tableoid, ctid) IN (SELECT tableoid, ctid FROM "platform_tick" WHERE "created_at" < $1 LIMIT $2)`, p.batchSQL())
+
+	p = Policy{Table: "audit.platform_audit", Column: "created_at", Archive: "audit.platform_audit_archive"}
+	assert.Equal(t, `WITH moved AS (DELETE FROM "audit"."platform_audit" WHERE (tableoid, ctid) IN (SELECT tableoid, ctid FROM "audit"."platform_audit" WHERE "created_at" < $1 LIMIT $2) RETURNING *) INSERT INTO "audit"."platform_audit_archive" SELECT * FROM moved`, p.batchSQL())
+}
@@ -0,0 +1,187 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package run starts goroutines that cannot take the process down. A panic
+// in a goroutine of its own is fatal in Go whatever recover the caller has,
+// so background work goes through Go, or through a Group when it is long
+// running and should come back after a crash:
+//
+//	g := run.NewGroup(ctx, log)
+//	g.Supervise("retention", job.run, run.Options{})
+//	...
+//	err := g.Wait()
+//
+// Group is an errgroup, the first error of a plain Go cancels the others.
+// Supervised functions are restarted with backoff instead when they panic
+// or fail before the group's context is done.
+package run
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+var (
+	panics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_goroutine_panics_total",
+		Help: "Panics recovered in background goroutines, by goroutine name.",
+	}, []string{"name"})
+
+	restarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_goroutine_restarts_total",
+		Help: "Restarts of supervised goroutines after a panic or an error, by goroutine name.",
+	}, []string{"name"})
+)
+
+func init() {
+	prometheus.MustRegister(panics, restarts)
+}
+
+// PanicError is a recovered panic returned as an error
+type PanicError struct {
+	Name  string
+	Value interface{}
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("goroutine %s panicked: %v", p.Name, p.Value)
+}
+
+// Go runs fn in a new goroutine, a panic is logged with its stack and
+// counted instead of crashing the process
+func Go(log *logger.Logger, name string, fn func()) {
+	go func() {
+		_ = Safe(log, name, func() error {
+			fn()
+			return nil
+		})
+	}()
+}
+
+// Safe calls fn in the calling goroutine and turns a panic into a
+// *PanicError, logged and counted like Go does
+func Safe(log *logger.Logger, name string, fn func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			perr := &PanicError{Name: name, Value: p, Stack: debug.Stack()}
+			panics.WithLabelValues(name).Inc()
+			if log != nil {
+				log.Errorw("Goroutine panicked", "goroutine", name, "panic", fmt.Sprint(p), "stack", string(perr.Stack))
+			}
+			err = perr
+		}
+	}()
+	return fn()
+}
+
+// Options for a supervised goroutine
+type Options struct {
+	// MinBackoff is the wait before the first restart, doubling up to
+	// MaxBackoff. A run lasting MaxBackoff resets it.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Clock      clock.Clock
+}
+
+func (o Options) withDefaults() Options {
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = defaultMinBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = defaultMaxBackoff
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = o.MinBackoff
+	}
+	o.Clock = clock.Or(o.Clock)
+	return o
+}
+
+// Supervise runs fn until ctx is done, restarting it with backoff when it
+// panics or returns an error early. fn returning nil means it is finished
+// and is not restarted. Supervise blocks until then or until ctx is done.
+func Supervise(ctx context.Context, log *logger.Logger, name string, fn func(ctx context.Context) error, opts Options) {
+	opts = opts.withDefaults()
+	backoff := opts.MinBackoff
+
+	for {
+		started := opts.Clock.Now()
+		err := Safe(log, name, func() error { return fn(ctx) })
+		if ctx.Err() != nil || err == nil {
+			return
+		}
+
+		if opts.Clock.Since(started) >= opts.MaxBackoff {
+			backoff = opts.MinBackoff
+		}
+		if log != nil {
+			log.Warnf("Goroutine %s stopped: %v, restarting in %v", name, err, backoff)
+		}
+
+		timer := opts.Clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		restarts.WithLabelValues(name).Inc()
+
+		backoff *= 2
+		if backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
+
+// Group is an errgroup whose goroutines recover their panics
+type Group struct {
+	log *logger.Logger
+	g   *errgroup.Group
+	ctx context.Context
+}
+
+// NewGroup returns a group whose context is cancelled by the first error
+// of a Go function or when ctx is
+func NewGroup(ctx context.Context, log *logger.Logger) *Group {
+	g, gctx := errgroup.WithContext(ctx)
+	return &Group{log: log, g: g, ctx: gctx}
+}
+
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs fn once, its error or panic cancels the group
+func (g *Group) Go(name string, fn func(ctx context.Context) error) {
+	g.g.Go(func() error {
+		return Safe(g.log, name, func() error { return fn(g.ctx) })
+	})
+}
+
+// Supervise keeps fn running until the group's context is done, see
+// Supervise. It never cancels the group.
+func (g *Group) Supervise(name string, fn func(ctx context.Context) error, opts Options) {
+	g.g.Go(func() error {
+		Supervise(g.ctx, g.log, name, fn, opts)
+		return nil
+	})
+}
+
+// Wait blocks until every goroutine returned and returns the first error
+func (g *Group) Wait() error {
+	return g.g.Wait()
+}
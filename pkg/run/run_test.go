@@ -0,0 +1,119 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoRecoversPanic(t *testing.T) {
+	before := testutil.ToFloat64(panics.WithLabelValues("go-test"))
+
+	done := make(chan struct{})
+	Go(nil, "go-test", func() {
+		defer close(done)
+		panic("boom")
+	})
+
+	<-done
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(panics.WithLabelValues("go-test")) == before+1
+	}, time.Second, time.Millisecond)
+}
+
+func TestSafeReturnsPanicError(t *testing.T) {
+	err := Safe(nil, "safe-test", func() error { panic("boom") })
+
+	var perr *PanicError
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, "boom", perr.Value)
+	assert.NotEmpty(t, perr.Stack)
+	assert.EqualError(t, err, "goroutine safe-test panicked: boom")
+
+	assert.NoError(t, Safe(nil, "safe-test", func() error { return nil }))
+}
+
+func TestSuperviseRestartsWithBackoff(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Supervise(ctx, nil, "supervise-test", func(ctx context.Context) error {
+			switch atomic.AddInt32(&calls, 1) {
+			case 1:
+				panic("boom")
+			case 2:
+				return errors.New("failed")
+			default:
+				<-ctx.Done()
+				return ctx.Err()
+			}
+		}, Options{MinBackoff: time.Second, MaxBackoff: time.Minute, Clock: fake})
+	}()
+
+	// first restart after MinBackoff, the second one waits twice as long
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	fake.Advance(time.Second)
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 3 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestSuperviseFinishedIsNotRestarted(t *testing.T) {
+	var calls int32
+	Supervise(context.Background(), nil, "finished-test", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}, Options{})
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestGroupPanicCancelsOthers(t *testing.T) {
+	g := NewGroup(context.Background(), nil)
+
+	g.Go("waiter", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	g.Go("crasher", func(ctx context.Context) error { panic("boom") })
+
+	var perr *PanicError
+	require.ErrorAs(t, g.Wait(), &perr)
+	assert.Equal(t, "crasher", perr.Name)
+	assert.Error(t, g.Context().Err())
+}
+
+func TestGroupSuperviseStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := NewGroup(ctx, nil)
+
+	started := make(chan struct{})
+	g.Supervise("worker", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	}, Options{})
+
+	<-started
+	cancel()
+	assert.NoError(t, g.Wait())
+}
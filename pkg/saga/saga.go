@@ -0,0 +1,445 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package saga runs workflows that span services, e.g. placing an order
+// reserves margin with the account service, passes the risk check and
+// sends it to execution. There is no transaction across them, so every
+// step comes with a compensation that undoes it, and when a step fails the
+// completed ones are compensated in reverse order:
+//
+//	c.Register(saga.Definition{Name: "place_order", Steps: []saga.Step{
+//		{Name: "reserve_margin", Action: reserve, Compensate: release},
+//		{Name: "risk_check", Action: check},
+//		{Name: "execute", Action: execute, Compensate: cancel},
+//	}})
+//	err := c.Run(ctx, "place_order", orderID, map[string]string{"account": id})
+//
+// Progress is saved after every step, a coordinator that finds an instance
+// whose owner died (its lease ran out) carries it on from the saved step.
+// That step may have run before the crash, so actions and compensations
+// must be idempotent: pass Execution.Key as the idempotency key.
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	model "blueprint/model/blueprint"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/errors"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/run"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultLease     = time.Minute
+	defaultInterval  = 30 * time.Second
+	defaultBatchSize = 10
+)
+
+type Status string
+
+const (
+	Running      Status = "running"
+	Compensating Status = "compensating"
+	Completed    Status = "completed"
+	// Compensated sagas failed and were undone
+	Compensated Status = "compensated"
+	// Failed sagas could not be undone either, someone has to look at them
+	Failed Status = "failed"
+)
+
+var (
+	finished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_saga_finished_total",
+		Help: "Sagas by name and final status: completed, compensated or failed.",
+	}, []string{"saga", "status"})
+
+	stepFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_saga_step_failures_total",
+		Help: "Saga steps that failed after their retries, by phase: action or compensate.",
+	}, []string{"saga", "step", "phase"})
+
+	resumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blueprint_saga_resumed_total",
+		Help: "Saga instances taken over from a coordinator whose lease ran out.",
+	}, []string{"saga"})
+)
+
+func init() {
+	prometheus.MustRegister(finished, stepFailures, resumed)
+}
+
+// Step is one action of a saga and the compensation undoing it
+type Step struct {
+	Name   string
+	Action func(ctx context.Context, x *Execution) error
+	// Compensate is nil for steps with nothing to undo, like a check
+	Compensate func(ctx context.Context, x *Execution) error
+}
+
+type Definition struct {
+	Name  string
+	Steps []Step
+}
+
+// Execution is the instance as a step sees it
+type Execution struct {
+	ID   string
+	Saga string
+	Step string
+	// Data is shared by all steps, changes are saved with the step
+	Data map[string]string
+}
+
+// Key is unique per instance and step, retries and resumes repeat it
+func (x *Execution) Key() string {
+	return x.Saga + ":" + x.ID + ":" + x.Step
+}
+
+// Error is returned by Run when the saga did not complete
+type Error struct {
+	Saga   string
+	ID     string
+	Status Status
+	// Err is the failure of the step that stopped the saga
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("saga %s %s %s: %v", e.Saga, e.ID, e.Status, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+type Options struct {
+	// Lease is how long an instance stays with this coordinator after its
+	// last save, a step and its retries must finish well within it
+	Lease time.Duration
+	// Interval between looks for instances abandoned by other coordinators
+	Interval time.Duration
+	// Retry runs every action and compensation, errors.DefaultRetry by
+	// default. errors.Permanent fails a step right away.
+	Retry errors.RetryOptions
+	// Owner names this coordinator in the leases, host and pid by default
+	Owner string
+	Clock clock.Clock
+}
+
+// Coordinator runs the sagas registered with it and resumes the ones
+// other coordinators left behind
+type Coordinator struct {
+	store Store
+	log   *logger.Logger
+	opts  Options
+
+	mu   sync.RWMutex
+	defs map[string]Definition
+
+	cancel context.CancelFunc
+	group  *run.Group
+}
+
+func New(db *gorm.DB, log *logger.Logger, opts Options) *Coordinator {
+	return NewWithStore(NewGormStore(db), log, opts)
+}
+
+func NewWithStore(store Store, log *logger.Logger, opts Options) *Coordinator {
+	if opts.Lease <= 0 {
+		opts.Lease = defaultLease
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Retry.Attempts == 0 {
+		opts.Retry = errors.DefaultRetry
+	}
+	if opts.Owner == "" {
+		host, _ := os.Hostname()
+		opts.Owner = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	opts.Clock = clock.Or(opts.Clock)
+	opts.Retry.Clock = opts.Clock
+
+	return &Coordinator{store: store, log: log, opts: opts, defs: make(map[string]Definition)}
+}
+
+// Register adds def, register every saga before Start so no instance is
+// left without its definition
+func (c *Coordinator) Register(def Definition) error {
+	if def.Name == "" || len(def.Steps) == 0 {
+		return fmt.Errorf("saga %q: needs a name and steps", def.Name)
+	}
+	seen := make(map[string]bool, len(def.Steps))
+	for _, step := range def.Steps {
+		if step.Name == "" || step.Action == nil {
+			return fmt.Errorf("saga %q: step %q needs a name and an action", def.Name, step.Name)
+		}
+		if seen[step.Name] {
+			return fmt.Errorf("saga %q: step %q twice", def.Name, step.Name)
+		}
+		seen[step.Name] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.defs[def.Name]; ok {
+		return fmt.Errorf("saga %q: already registered", def.Name)
+	}
+	c.defs[def.Name] = def
+	return nil
+}
+
+// Run starts instance id of saga with data and runs it to the end. It
+// returns nil when every step completed, an *Error with the final status
+// otherwise. Should ctx end first, the instance is left to be resumed.
+func (c *Coordinator) Run(ctx context.Context, saga, id string, data map[string]string) error {
+	def, ok := c.definition(saga)
+	if !ok {
+		return fmt.Errorf("saga %q: not registered", saga)
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("saga %s %s: encode data: %w", saga, id, err)
+	}
+
+	now := c.opts.Clock.Now()
+	inst := &model.SagaInstance{
+		ID:         id,
+		Saga:       saga,
+		Status:     string(Running),
+		Data:       encoded,
+		Owner:      c.opts.Owner,
+		LeaseUntil: now.Add(c.opts.Lease),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := c.store.Create(ctx, inst); err != nil {
+		return err
+	}
+	return c.execute(ctx, def, inst)
+}
+
+// Resume runs the instances whose coordinator stopped saving them, until
+// none is left, and returns how many it took over
+func (c *Coordinator) Resume(ctx context.Context) (int, error) {
+	c.mu.RLock()
+	sagas := make([]string, 0, len(c.defs))
+	for name := range c.defs {
+		sagas = append(sagas, name)
+	}
+	c.mu.RUnlock()
+	if len(sagas) == 0 {
+		return 0, nil
+	}
+
+	total := 0
+	for {
+		now := c.opts.Clock.Now()
+		batch, err := c.store.Claim(ctx, sagas, c.opts.Owner, now, now.Add(c.opts.Lease), defaultBatchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(batch) == 0 {
+			return total, nil
+		}
+		for _, inst := range batch {
+			def, _ := c.definition(inst.Saga)
+			total++
+			resumed.WithLabelValues(inst.Saga).Inc()
+			if err := c.execute(ctx, def, inst); err != nil && ctx.Err() != nil {
+				return total, ctx.Err()
+			}
+		}
+	}
+}
+
+// Start resumes abandoned instances now and every Interval until Stop
+func (c *Coordinator) Start(ctx context.Context) {
+	c.resume(ctx)
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	c.group = run.NewGroup(watchCtx, c.log)
+	c.group.Supervise("saga", c.run, run.Options{Clock: c.opts.Clock})
+}
+
+// Stop waits for the saga being resumed to reach a step boundary
+func (c *Coordinator) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.group != nil {
+		c.group.Wait()
+	}
+}
+
+func (c *Coordinator) run(ctx context.Context) error {
+	ticker := c.opts.Clock.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			c.resume(ctx)
+		}
+	}
+}
+
+func (c *Coordinator) resume(ctx context.Context) {
+	if _, err := c.Resume(ctx); err != nil && ctx.Err() == nil && c.log != nil {
+		c.log.Warnf("Resuming sagas failed: %v", err)
+	}
+}
+
+func (c *Coordinator) definition(saga string) (Definition, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	def, ok := c.defs[saga]
+	return def, ok
+}
+
+// execute moves inst forward step by step, saving after each one, then
+// compensates back to the first step if an action failed
+func (c *Coordinator) execute(ctx context.Context, def Definition, inst *model.SagaInstance) error {
+	x := &Execution{ID: inst.ID, Saga: inst.Saga}
+	if err := json.Unmarshal(inst.Data, &x.Data); err != nil {
+		inst.Status, inst.Error = string(Failed), "decode data: "+err.Error()
+		return c.finish(ctx, inst, err)
+	}
+	if x.Data == nil {
+		x.Data = make(map[string]string)
+	}
+	if inst.Step >= len(def.Steps) {
+		// the definition lost steps since the instance was saved
+		err := fmt.Errorf("step %d of %d", inst.Step, len(def.Steps))
+		inst.Status, inst.Error = string(Failed), err.Error()
+		return c.finish(ctx, inst, err)
+	}
+
+	var cause error
+	for inst.Status == string(Running) {
+		step := def.Steps[inst.Step]
+		x.Step = step.Name
+		err := errors.Retry(ctx, c.opts.Retry, func(ctx context.Context) error {
+			return step.Action(ctx, x)
+		})
+		if ctx.Err() != nil {
+			c.release(inst)
+			return ctx.Err()
+		}
+
+		if err != nil {
+			stepFailures.WithLabelValues(inst.Saga, step.Name, "action").Inc()
+			cause = fmt.Errorf("%s: %w", step.Name, err)
+			inst.Status, inst.Error = string(Compensating), cause.Error()
+			inst.Step--
+		} else {
+			inst.Step++
+			if inst.Step == len(def.Steps) {
+				inst.Status = string(Completed)
+			}
+		}
+		if err := c.save(ctx, inst, x); err != nil {
+			return err
+		}
+	}
+
+	for inst.Status == string(Compensating) {
+		if inst.Step < 0 {
+			inst.Status = string(Compensated)
+			break
+		}
+		step := def.Steps[inst.Step]
+		if step.Compensate != nil {
+			x.Step = step.Name
+			err := errors.Retry(ctx, c.opts.Retry, func(ctx context.Context) error {
+				return step.Compensate(ctx, x)
+			})
+			if ctx.Err() != nil {
+				c.release(inst)
+				return ctx.Err()
+			}
+			if err != nil {
+				stepFailures.WithLabelValues(inst.Saga, step.Name, "compensate").Inc()
+				cause = fmt.Errorf("compensate %s: %w", step.Name, err)
+				inst.Status = string(Failed)
+				inst.Error = joinError(inst.Error, cause.Error())
+				break
+			}
+		}
+		inst.Step--
+		if err := c.save(ctx, inst, x); err != nil {
+			return err
+		}
+	}
+
+	if cause == nil && inst.Status != string(Completed) && inst.Error != "" {
+		// resumed while compensating, the action error is only in the row
+		cause = fmt.Errorf("%s", inst.Error)
+	}
+	return c.finish(ctx, inst, cause)
+}
+
+// finish saves the final status, terminal instances keep no lease
+func (c *Coordinator) finish(ctx context.Context, inst *model.SagaInstance, cause error) error {
+	inst.LeaseUntil = time.Time{}
+	inst.UpdatedAt = c.opts.Clock.Now()
+	if err := c.store.Save(ctx, inst); err != nil {
+		return err
+	}
+
+	finished.WithLabelValues(inst.Saga, inst.Status).Inc()
+	if inst.Status == string(Completed) {
+		return nil
+	}
+	if inst.Status == string(Failed) && c.log != nil {
+		c.log.Errorf("Saga %s %s failed and was not compensated: %s", inst.Saga, inst.ID, inst.Error)
+	}
+	return &Error{Saga: inst.Saga, ID: inst.ID, Status: Status(inst.Status), Err: cause}
+}
+
+// save records the progress of a step and renews the lease, terminal
+// states are saved by finish
+func (c *Coordinator) save(ctx context.Context, inst *model.SagaInstance, x *Execution) error {
+	data, err := json.Marshal(x.Data)
+	if err != nil {
+		return fmt.Errorf("saga %s %s: encode data: %w", inst.Saga, inst.ID, err)
+	}
+	inst.Data = data
+	if inst.Status == string(Completed) {
+		return nil
+	}
+	now := c.opts.Clock.Now()
+	inst.LeaseUntil = now.Add(c.opts.Lease)
+	inst.UpdatedAt = now
+	return c.store.Save(ctx, inst)
+}
+
+// release hands the instance to the next coordinator right away instead of
+// after the lease, ctx is already done
+func (c *Coordinator) release(inst *model.SagaInstance) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	inst.LeaseUntil = c.opts.Clock.Now()
+	if err := c.store.Save(ctx, inst); err != nil && c.log != nil {
+		c.log.Warnf("Releasing saga %s %s failed: %v", inst.Saga, inst.ID, err)
+	}
+}
+
+func joinError(prev, next string) string {
+	if prev == "" {
+		return next
+	}
+	return prev + "; " + next
+}
@@ -0,0 +1,323 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	model "blueprint/model/blueprint"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/db"
+	apperrors "blueprint/pkg/errors"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memStore is Store on a map, with the same lease rules as GormStore
+type memStore struct {
+	mu   sync.Mutex
+	rows map[string]model.SagaInstance
+}
+
+func newMemStore() *memStore {
+	return &memStore{rows: make(map[string]model.SagaInstance)}
+}
+
+func (s *memStore) Create(ctx context.Context, inst *model.SagaInstance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rows[inst.ID]; ok {
+		return ErrExists
+	}
+	s.rows[inst.ID] = *inst
+	return nil
+}
+
+func (s *memStore) Save(ctx context.Context, inst *model.SagaInstance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rows[inst.ID].Owner != inst.Owner {
+		return ErrLeaseLost
+	}
+	s.rows[inst.ID] = *inst
+	return nil
+}
+
+func (s *memStore) Claim(ctx context.Context, sagas []string, owner string, now, until time.Time, n int) ([]*model.SagaInstance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var claimed []*model.SagaInstance
+	for id, row := range s.rows {
+		unfinished := row.Status == string(Running) || row.Status == string(Compensating)
+		if len(claimed) == n || !unfinished || !row.LeaseUntil.Before(now) || !contains(sagas, row.Saga) {
+			continue
+		}
+		row.Owner, row.LeaseUntil = owner, until
+		s.rows[id] = row
+		claimed = append(claimed, &row)
+	}
+	return claimed, nil
+}
+
+func (s *memStore) Get(ctx context.Context, id string) (*model.SagaInstance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.rows[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &row, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// journal records the actions and compensations run, in order
+type journal struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (j *journal) step(name string, err error) func(context.Context, *Execution) error {
+	return func(ctx context.Context, x *Execution) error {
+		j.mu.Lock()
+		j.calls = append(j.calls, name)
+		j.mu.Unlock()
+		return err
+	}
+}
+
+func newCoordinator(store Store, fake *clock.Fake) *Coordinator {
+	return NewWithStore(store, nil, Options{
+		Owner: "test",
+		Retry: apperrors.RetryOptions{Attempts: 1},
+		Clock: fake,
+	})
+}
+
+func TestRunCompletes(t *testing.T) {
+	store := newMemStore()
+	c := newCoordinator(store, clock.NewFake(time.Unix(0, 0)))
+	require.NoError(t, c.Register(Definition{Name: "place_order", Steps: []Step{
+		{Name: "reserve", Action: func(ctx context.Context, x *Execution) error {
+			assert.Equal(t, "place_order:o-1:reserve", x.Key())
+			x.Data["reservation"] = "r-9"
+			return nil
+		}},
+		{Name: "execute", Action: func(ctx context.Context, x *Execution) error {
+			assert.Equal(t, "r-9", x.Data["reservation"])
+			assert.Equal(t, "A1", x.Data["account"])
+			return nil
+		}},
+	}}))
+
+	require.NoError(t, c.Run(context.Background(), "place_order", "o-1", map[string]string{"account": "A1"}))
+
+	row, err := store.Get(context.Background(), "o-1")
+	require.NoError(t, err)
+	assert.Equal(t, string(Completed), row.Status)
+	assert.Equal(t, 2, row.Step)
+	assert.JSONEq(t, `{"account":"A1","reservation":"r-9"}`, string(row.Data))
+	assert.True(t, row.LeaseUntil.IsZero())
+
+	assert.ErrorIs(t, c.Run(context.Background(), "place_order", "o-1", nil), ErrExists)
+}
+
+func TestFailedStepCompensatesInReverse(t *testing.T) {
+	store := newMemStore()
+	c := newCoordinator(store, clock.NewFake(time.Unix(0, 0)))
+	j := &journal{}
+	rejected := errors.New("risk rejected")
+	require.NoError(t, c.Register(Definition{Name: "place_order", Steps: []Step{
+		{Name: "reserve", Action: j.step("reserve", nil), Compensate: j.step("release", nil)},
+		{Name: "lock_price", Action: j.step("lock_price", nil)},
+		{Name: "risk_check", Action: j.step("risk_check", rejected), Compensate: j.step("never", nil)},
+		{Name: "execute", Action: j.step("execute", nil)},
+	}}))
+
+	err := c.Run(context.Background(), "place_order", "o-1", nil)
+	var sagaErr *Error
+	require.ErrorAs(t, err, &sagaErr)
+	assert.Equal(t, Compensated, sagaErr.Status)
+	assert.ErrorIs(t, err, rejected)
+	assert.Equal(t, []string{"reserve", "lock_price", "risk_check", "release"}, j.calls)
+
+	row, _ := store.Get(context.Background(), "o-1")
+	assert.Equal(t, string(Compensated), row.Status)
+	assert.Equal(t, "risk_check: risk rejected", row.Error)
+}
+
+func TestFailedCompensationNeedsAttention(t *testing.T) {
+	store := newMemStore()
+	c := newCoordinator(store, clock.NewFake(time.Unix(0, 0)))
+	j := &journal{}
+	require.NoError(t, c.Register(Definition{Name: "place_order", Steps: []Step{
+		{Name: "reserve", Action: j.step("reserve", nil), Compensate: j.step("release", errors.New("account service down"))},
+		{Name: "execute", Action: j.step("execute", errors.New("venue closed"))},
+	}}))
+
+	err := c.Run(context.Background(), "place_order", "o-1", nil)
+	var sagaErr *Error
+	require.ErrorAs(t, err, &sagaErr)
+	assert.Equal(t, Failed, sagaErr.Status)
+
+	row, _ := store.Get(context.Background(), "o-1")
+	assert.Equal(t, string(Failed), row.Status)
+	assert.Equal(t, 0, row.Step, "the step whose compensation failed")
+	assert.Equal(t, "execute: venue closed; compensate reserve: account service down", row.Error)
+}
+
+func TestRetriesTransientFailures(t *testing.T) {
+	c := NewWithStore(newMemStore(), nil, Options{
+		Retry: apperrors.RetryOptions{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	})
+	attempts := 0
+	require.NoError(t, c.Register(Definition{Name: "s", Steps: []Step{
+		{Name: "flaky", Action: func(ctx context.Context, x *Execution) error {
+			if attempts++; attempts < 3 {
+				return syscall.ECONNREFUSED
+			}
+			return nil
+		}},
+	}}))
+
+	require.NoError(t, c.Run(context.Background(), "s", "1", nil))
+	assert.Equal(t, 3, attempts)
+}
+
+func TestResumeAfterCrash(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	store := newMemStore()
+	// the first coordinator died after reserve, its lease ran out
+	store.rows["o-1"] = model.SagaInstance{
+		ID: "o-1", Saga: "place_order", Status: string(Running), Step: 1,
+		Data: []byte(`{"reservation":"r-9"}`), Owner: "dead", LeaseUntil: fake.Now().Add(-time.Second),
+	}
+	// still held by a live coordinator
+	store.rows["o-2"] = model.SagaInstance{
+		ID: "o-2", Saga: "place_order", Status: string(Running), Step: 1,
+		Data: []byte(`{}`), Owner: "alive", LeaseUntil: fake.Now().Add(time.Minute),
+	}
+	// was compensating, reserve is left to undo
+	store.rows["o-3"] = model.SagaInstance{
+		ID: "o-3", Saga: "place_order", Status: string(Compensating), Step: 0, Error: "execute: venue closed",
+		Data: []byte(`{}`), Owner: "dead", LeaseUntil: fake.Now().Add(-time.Second),
+	}
+
+	c := newCoordinator(store, fake)
+	j := &journal{}
+	require.NoError(t, c.Register(Definition{Name: "place_order", Steps: []Step{
+		{Name: "reserve", Action: j.step("reserve", nil), Compensate: j.step("release", nil)},
+		{Name: "execute", Action: func(ctx context.Context, x *Execution) error {
+			assert.Equal(t, "r-9", x.Data["reservation"])
+			return j.step("execute", nil)(ctx, x)
+		}},
+	}}))
+
+	n, err := c.Resume(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.ElementsMatch(t, []string{"execute", "release"}, j.calls)
+
+	assert.Equal(t, string(Completed), store.rows["o-1"].Status)
+	assert.Equal(t, string(Running), store.rows["o-2"].Status)
+	assert.Equal(t, string(Compensated), store.rows["o-3"].Status)
+}
+
+func TestLostLeaseStopsRun(t *testing.T) {
+	store := newMemStore()
+	c := newCoordinator(store, clock.NewFake(time.Unix(0, 0)))
+	j := &journal{}
+	require.NoError(t, c.Register(Definition{Name: "s", Steps: []Step{
+		{Name: "slow", Action: func(ctx context.Context, x *Execution) error {
+			// another coordinator decided this one was dead
+			store.mu.Lock()
+			row := store.rows[x.ID]
+			row.Owner = "other"
+			store.rows[x.ID] = row
+			store.mu.Unlock()
+			return nil
+		}},
+		{Name: "next", Action: j.step("next", nil)},
+	}}))
+
+	assert.ErrorIs(t, c.Run(context.Background(), "s", "1", nil), ErrLeaseLost)
+	assert.Empty(t, j.calls)
+}
+
+func TestCancelReleasesLease(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	store := newMemStore()
+	c := newCoordinator(store, fake)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, c.Register(Definition{Name: "s", Steps: []Step{
+		{Name: "shutdown", Action: func(ctx context.Context, x *Execution) error {
+			cancel()
+			return ctx.Err()
+		}},
+	}}))
+
+	assert.ErrorIs(t, c.Run(ctx, "s", "1", nil), context.Canceled)
+	row := store.rows["1"]
+	assert.Equal(t, string(Running), row.Status)
+	assert.Equal(t, 0, row.Step)
+	assert.Equal(t, fake.Now(), row.LeaseUntil, "the next Resume takes it over")
+}
+
+func TestRegisterValidates(t *testing.T) {
+	c := newCoordinator(newMemStore(), nil)
+	noop := func(context.Context, *Execution) error { return nil }
+
+	assert.Error(t, c.Register(Definition{Name: "empty"}))
+	assert.Error(t, c.Register(Definition{Name: "no_action", Steps: []Step{{Name: "a"}}}))
+	assert.Error(t, c.Register(Definition{Name: "twice", Steps: []Step{{Name: "a", Action: noop}, {Name: "a", Action: noop}}}))
+	require.NoError(t, c.Register(Definition{Name: "ok", Steps: []Step{{Name: "a", Action: noop}}}))
+	assert.Error(t, c.Register(Definition{Name: "ok", Steps: []Step{{Name: "a", Action: noop}}}))
+	assert.Error(t, c.Run(context.Background(), "unknown", "1", nil))
+}
+
+func TestGormStore(t *testing.T) {
+	pg, err := db.NewPostgresDB(&config.Config{Postgres: testsupport.Postgres(t)}, nil)
+	require.NoError(t, err)
+	defer pg.Close()
+
+	require.NoError(t, pg.DB.Migrator().DropTable(&model.SagaInstance{}))
+	require.NoError(t, pg.DB.AutoMigrate(&model.SagaInstance{}))
+
+	ctx := context.Background()
+	store := NewGormStore(pg.DB)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	inst := &model.SagaInstance{ID: "o-1", Saga: "place_order", Status: string(Running), Data: []byte(`{}`), Owner: "a", LeaseUntil: now.Add(-time.Second)}
+	require.NoError(t, store.Create(ctx, inst))
+	assert.ErrorIs(t, store.Create(ctx, inst), ErrExists)
+
+	claimed, err := store.Claim(ctx, []string{"place_order"}, "b", now, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, "b", claimed[0].Owner)
+
+	assert.ErrorIs(t, store.Save(ctx, inst), ErrLeaseLost, "a lost it to b")
+	claimed[0].Step = 1
+	require.NoError(t, store.Save(ctx, claimed[0]))
+
+	again, err := store.Claim(ctx, []string{"place_order"}, "c", now, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Empty(t, again, "b holds the lease")
+
+	row, err := store.Get(ctx, "o-1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, row.Step)
+	assert.Equal(t, "b", row.Owner)
+}
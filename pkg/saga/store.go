@@ -0,0 +1,109 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	model "blueprint/model/blueprint"
+	"blueprint/pkg/db"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrExists is returned by Run for an id that was used before
+	ErrExists = errors.New("saga instance already exists")
+	// ErrLeaseLost means another coordinator took the instance over, this
+	// one must stop running it
+	ErrLeaseLost = errors.New("saga lease lost")
+)
+
+// Store persists saga instances
+type Store interface {
+	// Create inserts inst, ErrExists when its id is taken
+	Create(ctx context.Context, inst *model.SagaInstance) error
+	// Save writes the progress of inst if inst.Owner still holds it,
+	// ErrLeaseLost otherwise
+	Save(ctx context.Context, inst *model.SagaInstance) error
+	// Claim hands up to n unfinished instances of the given sagas whose
+	// lease ran out before now to owner, until until
+	Claim(ctx context.Context, sagas []string, owner string, now, until time.Time, n int) ([]*model.SagaInstance, error)
+	Get(ctx context.Context, id string) (*model.SagaInstance, error)
+}
+
+// GormStore keeps instances in the saga_instances table, db.Migrate
+// creates it
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Create(ctx context.Context, inst *model.SagaInstance) error {
+	if err := s.db.WithContext(ctx).Create(inst).Error; err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrExists
+		}
+		return fmt.Errorf("saga %s: create: %w", inst.ID, err)
+	}
+	return nil
+}
+
+func (s *GormStore) Save(ctx context.Context, inst *model.SagaInstance) error {
+	res := s.db.WithContext(ctx).Model(&model.SagaInstance{}).
+		Where("id = ? AND owner = ?", inst.ID, inst.Owner).
+		Updates(map[string]interface{}{
+			"status":      inst.Status,
+			"step":        inst.Step,
+			"data":        inst.Data,
+			"error":       inst.Error,
+			"lease_until": inst.LeaseUntil,
+			"updated_at":  inst.UpdatedAt,
+		})
+	if res.Error != nil {
+		return fmt.Errorf("saga %s: save: %w", inst.ID, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *GormStore) Claim(ctx context.Context, sagas []string, owner string, now, until time.Time, n int) ([]*model.SagaInstance, error) {
+	var rows []*model.SagaInstance
+	err := db.ClaimNext(ctx, s.db, &rows, n,
+		func(q *gorm.DB) *gorm.DB {
+			return q.Where("saga IN ? AND status IN ? AND lease_until < ?",
+				sagas, []string{string(Running), string(Compensating)}, now).Order("lease_until")
+		},
+		func(tx *gorm.DB) error {
+			ids := make([]string, len(rows))
+			for i, row := range rows {
+				ids[i] = row.ID
+			}
+			return tx.Model(&model.SagaInstance{}).Where("id IN ?", ids).
+				Updates(map[string]interface{}{"owner": owner, "lease_until": until}).Error
+		})
+	if err != nil {
+		return nil, fmt.Errorf("saga claim: %w", err)
+	}
+	for _, row := range rows {
+		row.Owner, row.LeaseUntil = owner, until
+	}
+	return rows, nil
+}
+
+func (s *GormStore) Get(ctx context.Context, id string) (*model.SagaInstance, error) {
+	var inst model.SagaInstance
+	if err := s.db.WithContext(ctx).Take(&inst, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("saga %s: %w", id, err)
+	}
+	return &inst, nil
+}
@@ -0,0 +1,236 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package selftest runs the checks behind `blueprint selftest`: can the
+// service reach and use everything it needs, asked the way the service
+// asks. The Report is JSON for deploy pipelines and init containers to
+// gate on.
+//
+//	report := selftest.Run(ctx, 10*time.Second,
+//		selftest.Check{Name: "redis", Run: pingRedis},
+//		selftest.Check{Name: "cache", Needs: "redis", Run: func(ctx context.Context) (interface{}, error) {
+//			return selftest.CacheCycle(ctx, store)
+//		}},
+//	)
+package selftest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"blueprint/pkg/cache"
+	"blueprint/pkg/db"
+	"blueprint/pkg/i18n"
+
+	"gorm.io/gorm"
+)
+
+type Status string
+
+const (
+	Pass Status = "pass"
+	// Warn passed, with something an operator should look at
+	Warn Status = "warn"
+	Fail Status = "fail"
+	// Skip did not run, a check it Needs failed
+	Skip Status = "skip"
+)
+
+// Check is one step of the self-test. Details go into the report as they
+// are, next to the error.
+type Check struct {
+	Name string
+	// Needs names an earlier check that has to pass or warn, this one is
+	// skipped otherwise
+	Needs string
+	Run   func(ctx context.Context) (details interface{}, err error)
+}
+
+type Result struct {
+	Name       string      `json:"name"`
+	Status     Status      `json:"status"`
+	DurationMS float64     `json:"duration_ms"`
+	Error      string      `json:"error,omitempty"`
+	Details    interface{} `json:"details,omitempty"`
+}
+
+// Report is fail when any check failed or was skipped, warn when one
+// warned
+type Report struct {
+	Status Status    `json:"status"`
+	Time   time.Time `json:"time"`
+	Checks []Result  `json:"checks"`
+}
+
+// OK is what the exit code goes by, warnings pass
+func (r Report) OK() bool {
+	return r.Status != Fail
+}
+
+// warning marks a check result as passing with a warning
+type warning struct {
+	err error
+}
+
+func (w *warning) Error() string { return w.err.Error() }
+func (w *warning) Unwrap() error { return w.err }
+
+// Warning makes err a warning rather than a failure, nil stays nil
+func Warning(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &warning{err: err}
+}
+
+// Run runs checks one after the other, each under its own timeout, and
+// never stops early: the report lists everything that is wrong at once
+func Run(ctx context.Context, timeout time.Duration, checks ...Check) Report {
+	report := Report{Status: Pass, Time: time.Now().UTC()}
+	done := map[string]Status{}
+
+	for _, c := range checks {
+		r := Result{Name: c.Name}
+		if c.Needs != "" && done[c.Needs] != Pass && done[c.Needs] != Warn {
+			r.Status = Skip
+			r.Error = c.Needs + " did not pass"
+		} else {
+			r = run(ctx, timeout, c)
+		}
+		done[c.Name] = r.Status
+		report.Checks = append(report.Checks, r)
+
+		switch {
+		case r.Status == Fail || r.Status == Skip:
+			report.Status = Fail
+		case r.Status == Warn && report.Status == Pass:
+			report.Status = Warn
+		}
+	}
+	return report
+}
+
+func run(ctx context.Context, timeout time.Duration, c Check) (r Result) {
+	r = Result{Name: c.Name, Status: Pass}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		r.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+		// a broken dependency must fail its check, not the whole command
+		if p := recover(); p != nil {
+			r.Status, r.Error = Fail, fmt.Sprintf("panic: %v", p)
+		}
+	}()
+
+	details, err := c.Run(ctx)
+	r.Details = details
+	var w *warning
+	switch {
+	case stderrors.As(err, &w):
+		r.Status, r.Error = Warn, err.Error()
+	case err != nil:
+		r.Status, r.Error = Fail, err.Error()
+	}
+	return r
+}
+
+// CacheCycle writes a value under a key of its own, reads it back and
+// deletes it again
+func CacheCycle(ctx context.Context, store cache.Store) (interface{}, error) {
+	key := "selftest:" + randomID()
+	want := map[string]string{"written_at": time.Now().UTC().Format(time.RFC3339Nano)}
+	details := map[string]string{"key": key}
+
+	if err := store.SetWithTTL(ctx, key, want, time.Minute); err != nil {
+		return details, fmt.Errorf("write: %w", err)
+	}
+	var got map[string]string
+	if err := store.Get(ctx, key, &got); err != nil {
+		store.Delete(ctx, key)
+		return details, fmt.Errorf("read: %w", err)
+	}
+	if got["written_at"] != want["written_at"] {
+		store.Delete(ctx, key)
+		return details, fmt.Errorf("read back %v, wrote %v", got, want)
+	}
+	deleted, err := store.Delete(ctx, key)
+	if err != nil {
+		return details, fmt.Errorf("delete: %w", err)
+	}
+	if deleted != 1 {
+		return details, fmt.Errorf("delete removed %d keys, want 1", deleted)
+	}
+	return details, nil
+}
+
+var errRollback = stderrors.New("selftest rollback")
+
+// Transaction begins a transaction, asks whether it could write and rolls
+// it back. A read-only server, a replica behind the primary's address,
+// fails.
+func Transaction(ctx context.Context, gdb *gorm.DB) (interface{}, error) {
+	var readOnly string
+	err := gdb.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Raw("SHOW transaction_read_only").Scan(&readOnly).Error; err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if err != nil && !stderrors.Is(err, errRollback) {
+		return nil, err
+	}
+	details := map[string]bool{"read_only": readOnly == "on"}
+	if readOnly == "on" {
+		return details, stderrors.New("transactions are read-only, is this a replica?")
+	}
+	return details, nil
+}
+
+// Migrations fails when a table of db.Models is missing or lacks columns
+func Migrations(ctx context.Context, gdb *gorm.DB) (interface{}, error) {
+	status, err := db.MigrationStatus(ctx, gdb)
+	if err != nil {
+		return nil, err
+	}
+	var behind []string
+	for _, s := range status {
+		if !s.Migrated() {
+			behind = append(behind, s.Table)
+		}
+	}
+	if len(behind) > 0 {
+		return status, fmt.Errorf("not migrated: %s", strings.Join(behind, ", "))
+	}
+	return status, nil
+}
+
+// Locales fails when the locale files do not load and warns about keys a
+// locale lacks
+func Locales(pattern, base string) (interface{}, error) {
+	reports, err := i18n.Check(pattern, base)
+	if err != nil {
+		return nil, err
+	}
+	var incomplete []string
+	for _, r := range reports {
+		if len(r.Missing) > 0 {
+			incomplete = append(incomplete, fmt.Sprintf("%s (%d)", r.Locale, len(r.Missing)))
+		}
+	}
+	if len(incomplete) > 0 {
+		return reports, Warning(fmt.Errorf("keys missing in %s", strings.Join(incomplete, ", ")))
+	}
+	return reports, nil
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,146 @@
+package selftest
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	"blueprint/pkg/cache"
+	"blueprint/pkg/db"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func check(name, needs string, err error) Check {
+	return Check{Name: name, Needs: needs, Run: func(ctx context.Context) (interface{}, error) {
+		return map[string]string{"ran": name}, err
+	}}
+}
+
+func statuses(r Report) map[string]Status {
+	out := map[string]Status{}
+	for _, c := range r.Checks {
+		out[c.Name] = c.Status
+	}
+	return out
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	r := Run(ctx, time.Second, check("a", "", nil), check("b", "a", nil))
+	assert.Equal(t, Pass, r.Status)
+	assert.True(t, r.OK())
+	assert.Equal(t, map[string]string{"ran": "b"}, r.Checks[1].Details)
+
+	r = Run(ctx, time.Second, check("a", "", Warning(stderrors.New("stale"))), check("b", "a", nil))
+	assert.Equal(t, Warn, r.Status)
+	assert.True(t, r.OK())
+	assert.Equal(t, map[string]Status{"a": Warn, "b": Pass}, statuses(r))
+	assert.Equal(t, "stale", r.Checks[0].Error)
+
+	r = Run(ctx, time.Second,
+		check("a", "", stderrors.New("refused")),
+		check("b", "a", nil),
+		check("c", "b", nil),
+		check("d", "", Warning(stderrors.New("stale"))),
+	)
+	assert.Equal(t, Fail, r.Status)
+	assert.False(t, r.OK())
+	// everything runs that can, the report is complete
+	assert.Equal(t, map[string]Status{"a": Fail, "b": Skip, "c": Skip, "d": Warn}, statuses(r))
+	assert.Equal(t, "a did not pass", r.Checks[1].Error)
+}
+
+func TestRunTimeoutAndPanic(t *testing.T) {
+	r := Run(context.Background(), 10*time.Millisecond,
+		Check{Name: "slow", Run: func(ctx context.Context) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}},
+		Check{Name: "broken", Run: func(ctx context.Context) (interface{}, error) {
+			var store cache.Store
+			return nil, store.Ping(ctx)
+		}},
+	)
+	assert.Equal(t, map[string]Status{"slow": Fail, "broken": Fail}, statuses(r))
+	assert.Contains(t, r.Checks[0].Error, "deadline exceeded")
+	assert.Contains(t, r.Checks[1].Error, "panic")
+}
+
+// flakyStore loses what is written to it
+type flakyStore struct {
+	*cache.Memory
+}
+
+func (f flakyStore) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return nil
+}
+
+func TestCacheCycle(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemory()
+
+	details, err := CacheCycle(ctx, store)
+	require.NoError(t, err)
+	key := details.(map[string]string)["key"]
+	assert.Contains(t, key, "selftest:")
+	ok, err := store.Exists(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, ok, "the test key is cleaned up")
+
+	_, err = CacheCycle(ctx, flakyStore{cache.NewMemory()})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+}
+
+func TestLocales(t *testing.T) {
+	dir := t.TempDir()
+	write := func(locale, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, locale), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, locale, "example.yml"), []byte(content), 0o644))
+	}
+	write("en-US", "hello: Hello\nbye: Bye\n")
+	write("el-GR", "hello: Γεια\nbye: Αντίο\n")
+
+	_, err := Locales(filepath.Join(dir, "*", "*"), "en-US")
+	require.NoError(t, err)
+
+	write("zh-CN", "hello: 你好\n")
+	r := Run(context.Background(), time.Second, Check{Name: "locales", Run: func(ctx context.Context) (interface{}, error) {
+		return Locales(filepath.Join(dir, "*", "*"), "en-US")
+	}})
+	assert.Equal(t, Warn, r.Status)
+	assert.Contains(t, r.Checks[0].Error, "zh-CN (1)")
+
+	_, err = Locales(filepath.Join(dir, "missing", "*"), "en-US")
+	assert.Error(t, err)
+}
+
+func TestPostgresChecks(t *testing.T) {
+	cfg := &config.Config{Postgres: testsupport.Postgres(t)}
+	pg, err := db.NewPostgresDB(cfg, nil)
+	require.NoError(t, err)
+	defer pg.Close()
+	ctx := context.Background()
+
+	details, err := Transaction(ctx, pg.DB)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"read_only": false}, details)
+
+	require.NoError(t, db.Migrate(cfg))
+	_, err = Migrations(ctx, pg.DB)
+	require.NoError(t, err)
+
+	require.NoError(t, pg.DB.Exec("DROP TABLE platform_projection_event").Error)
+	t.Cleanup(func() { db.Migrate(cfg) })
+	_, err = Migrations(ctx, pg.DB)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "platform_projection_event")
+}
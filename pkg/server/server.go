@@ -0,0 +1,264 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package server
+
+import (
+	"blueprint/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+)
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// Server is anything the manager can serve on a listener and stop again.
+// Serve must return nil once Shutdown was called.
+type Server interface {
+	Serve(lis net.Listener) error
+	Shutdown(ctx context.Context) error
+}
+
+// Manager runs several servers, each on its own address, and stops all of
+// them as soon as one fails or the context is cancelled
+type Manager struct {
+	log             *logger.Logger
+	shutdownTimeout time.Duration
+	entries         []entry
+	listeners       []net.Listener
+}
+
+type entry struct {
+	name    string
+	network string
+	addr    string
+	mode    os.FileMode
+	srv     Server
+}
+
+func NewManager(log *logger.Logger, shutdownTimeout time.Duration) *Manager {
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+	return &Manager{
+		log:             log,
+		shutdownTimeout: shutdownTimeout,
+	}
+}
+
+// Add registers srv under name, addr is a tcp address like ":8080". The same
+// server may be added under several names to serve more than one address.
+func (m *Manager) Add(name, addr string, srv Server) {
+	m.entries = append(m.entries, entry{name: name, network: "tcp", addr: addr, srv: srv})
+}
+
+// AddUnix serves srv on a unix socket, a stale socket file left by a crash is
+// replaced and mode (e.g. 0660) is applied once the socket exists, 0 keeps
+// the umask default
+func (m *Manager) AddUnix(name, path string, mode os.FileMode, srv Server) {
+	m.entries = append(m.entries, entry{name: name, network: "unix", addr: path, mode: mode, srv: srv})
+}
+
+// Listen opens every address up front so a taken port fails before anything
+// serves, on error nothing is left open
+func (m *Manager) Listen() error {
+	if m.listeners != nil {
+		return nil
+	}
+
+	listeners := make([]net.Listener, 0, len(m.entries))
+	for _, e := range m.entries {
+		lis, err := e.listen()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("%s: failed to listen on %s: %w", e.name, e.addr, err)
+		}
+		listeners = append(listeners, lis)
+	}
+
+	m.listeners = listeners
+	return nil
+}
+
+// Addr returns the bound address of the named server, nil before Listen
+func (m *Manager) Addr(name string) net.Addr {
+	for i, e := range m.entries {
+		if e.name == name && i < len(m.listeners) {
+			return m.listeners[i].Addr()
+		}
+	}
+	return nil
+}
+
+// Run listens if Listen was not called yet and blocks until ctx is done or a
+// server fails. Every server gets a graceful shutdown bounded by the
+// shutdown timeout.
+func (m *Manager) Run(ctx context.Context) error {
+	if err := m.Listen(); err != nil {
+		return err
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	for i, e := range m.entries {
+		e, lis := e, m.listeners[i]
+		m.log.Infof("%s server listening on %v", e.name, lis.Addr())
+
+		g.Go(func() error {
+			if err := e.srv.Serve(lis); err != nil {
+				return fmt.Errorf("%s: %w", e.name, err)
+			}
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		<-gctx.Done()
+		return m.shutdown()
+	})
+
+	return g.Wait()
+}
+
+func (e entry) listen() (net.Listener, error) {
+	if e.network != "unix" {
+		return net.Listen(e.network, e.addr)
+	}
+
+	if err := removeStaleSocket(e.addr); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(e.addr), 0o755); err != nil {
+		return nil, err
+	}
+
+	lis, err := net.Listen("unix", e.addr)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode != 0 {
+		if err := os.Chmod(e.addr, e.mode); err != nil {
+			lis.Close()
+			return nil, err
+		}
+	}
+	return lis, nil
+}
+
+// removeStaleSocket deletes a socket file nobody listens on anymore, it
+// refuses to touch regular files or a socket that is still in use
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is already in use", path)
+	}
+	return os.Remove(path)
+}
+
+func (m *Manager) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, e := range m.entries {
+		wg.Add(1)
+		go func(e entry) {
+			defer wg.Done()
+			if err := e.srv.Shutdown(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: shutdown: %w", e.name, err))
+				mu.Unlock()
+				return
+			}
+			m.log.Infof("%s server stopped", e.name)
+		}(e)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// GRPC adapts a grpc.Server, Shutdown falls back to a hard Stop when the
+// graceful stop does not finish in time
+func GRPC(s *grpc.Server) Server {
+	return &grpcServer{s: s}
+}
+
+type grpcServer struct {
+	s *grpc.Server
+}
+
+func (g *grpcServer) Serve(lis net.Listener) error {
+	if err := g.s.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+func (g *grpcServer) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		g.s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		g.s.Stop()
+		return fmt.Errorf("graceful stop timed out, forced stop: %w", ctx.Err())
+	}
+}
+
+// HTTP adapts an http.Server
+func HTTP(s *http.Server) Server {
+	return &httpServer{s: s}
+}
+
+// NewHTTP wraps h in an http.Server with the header timeout we use everywhere
+func NewHTTP(h http.Handler) Server {
+	return HTTP(&http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: 5 * time.Second,
+	})
+}
+
+type httpServer struct {
+	s *http.Server
+}
+
+func (h *httpServer) Serve(lis net.Listener) error {
+	if err := h.s.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (h *httpServer) Shutdown(ctx context.Context) error {
+	return h.s.Shutdown(ctx)
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"blueprint/config"
+	"blueprint/pkg/logger"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func newTestLogger(t *testing.T) *logger.Logger {
+	t.Helper()
+	opts := logger.LoggerOptions{
+		Level:      "error",
+		OutputPath: filepath.Join(t.TempDir(), "test.log"),
+	}
+	log, err := logger.NewLoggerWithOptions(&config.Config{}, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { log.Close() })
+	return log
+}
+
+func TestManagerRunsAndStopsAll(t *testing.T) {
+	m := NewManager(newTestLogger(t), time.Second)
+	m.Add("grpc", "127.0.0.1:0", GRPC(grpc.NewServer()))
+	m.Add("http", "127.0.0.1:0", NewHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})))
+	require.NoError(t, m.Listen())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+
+	resp, err := http.Get("http://" + m.Addr("http").String())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("manager did not stop")
+	}
+
+	_, err = net.Dial("tcp", m.Addr("grpc").String())
+	assert.Error(t, err, "grpc listener should be closed")
+}
+
+type failingServer struct {
+	stopped chan struct{}
+}
+
+func (f *failingServer) Serve(net.Listener) error       { return errors.New("boom") }
+func (f *failingServer) Shutdown(context.Context) error { close(f.stopped); return nil }
+
+func TestManagerStopsOthersWhenOneFails(t *testing.T) {
+	m := NewManager(newTestLogger(t), time.Second)
+	failing := &failingServer{stopped: make(chan struct{})}
+	m.Add("grpc", "127.0.0.1:0", GRPC(grpc.NewServer()))
+	m.Add("broken", "127.0.0.1:0", failing)
+
+	err := m.Run(context.Background())
+	assert.EqualError(t, err, "broken: boom")
+
+	select {
+	case <-failing.stopped:
+	default:
+		t.Fatal("failed server was not shut down")
+	}
+}
+
+func TestManagerListenFailsOnTakenPort(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+
+	m := NewManager(newTestLogger(t), time.Second)
+	m.Add("free", "127.0.0.1:0", GRPC(grpc.NewServer()))
+	m.Add("taken", taken.Addr().String(), GRPC(grpc.NewServer()))
+
+	err = m.Listen()
+	assert.ErrorContains(t, err, "taken: failed to listen")
+	assert.Nil(t, m.Addr("free"))
+}
+
+func TestManagerUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "grpc.sock")
+
+	// a stale socket left behind by a crashed process
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	m := NewManager(newTestLogger(t), time.Second)
+	m.AddUnix("grpc-unix", path, 0o600, GRPC(grpc.NewServer()))
+	require.NoError(t, m.Listen())
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	conn.Close()
+
+	cancel()
+	require.NoError(t, <-done)
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "socket file should be removed on shutdown")
+}
+
+func TestManagerUnixSocketRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	require.NoError(t, os.WriteFile(path, []byte("keep me"), 0o600))
+
+	m := NewManager(newTestLogger(t), time.Second)
+	m.AddUnix("grpc-unix", path, 0o660, GRPC(grpc.NewServer()))
+
+	assert.ErrorContains(t, m.Listen(), "exists and is not a socket")
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "keep me", string(data))
+}
+
+func TestManagerUnixSocketInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grpc.sock")
+	busy, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer busy.Close()
+
+	m := NewManager(newTestLogger(t), time.Second)
+	m.AddUnix("grpc-unix", path, 0o660, GRPC(grpc.NewServer()))
+
+	assert.ErrorContains(t, m.Listen(), "already in use")
+}
@@ -0,0 +1,12 @@
+package settings
+
+import (
+	"testing"
+
+	"blueprint/pkg/testsupport"
+)
+
+// one postgres container for the whole package
+func TestMain(m *testing.M) {
+	testsupport.Main(m)
+}
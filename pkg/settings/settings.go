@@ -0,0 +1,399 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package settings holds runtime-tunable business parameters, spreads,
+// commission rates and the like: namespaced keys with a type, a default
+// and a description defined in code, overridden at runtime through the
+// admin RPCs. Overrides are rows of model.Setting. Reads go through the
+// cache and a write deletes the cached entry, so every replica sees it on
+// its next read.
+//
+//	s := settings.New(pg.DB, cacheClient, log, settings.Options{})
+//	s.Register(settings.Def{Namespace: "trading", Key: "spread_bps", Type: settings.Int, Default: "15", Description: "Spread added to quotes, in basis points"})
+//	spread, err := s.Int(ctx, "trading", "spread_bps")
+package settings
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	model "blueprint/model/blueprint"
+	"blueprint/pkg/cache"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Type string
+
+const (
+	String   Type = "string"
+	Int      Type = "int"
+	Float    Type = "float"
+	Bool     Type = "bool"
+	Duration Type = "duration"
+)
+
+var (
+	// ErrUnknown is returned for settings that were never registered
+	ErrUnknown = stderrors.New("unknown setting")
+	// ErrInvalid is returned for values that do not parse as the type of
+	// their setting
+	ErrInvalid = stderrors.New("invalid setting value")
+)
+
+const (
+	keyPrefix = "setting:"
+	// a read racing a write may cache the old value, it is gone after this
+	defaultTTL = time.Minute
+)
+
+// names keep cache keys unambiguous, FlushCachePrefix("setting:trading.")
+// drops one namespace
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Def is a setting as the code defines it
+type Def struct {
+	Namespace string
+	Key       string
+	Type      Type
+	// Default applies while there is no override, written like one
+	Default     string
+	Description string
+}
+
+// Name is "namespace.key"
+func (d Def) Name() string {
+	return d.Namespace + "." + d.Key
+}
+
+func (d Def) Validate() error {
+	if !namePattern.MatchString(d.Namespace) || !namePattern.MatchString(d.Key) {
+		return fmt.Errorf("setting %q: namespace and key must be lower case letters, digits and _", d.Name())
+	}
+	if err := d.Type.Check(d.Default); err != nil {
+		return fmt.Errorf("setting %s: default: %w", d.Name(), err)
+	}
+	return nil
+}
+
+// Check fails with ErrInvalid when value is not of type t: an integer, a
+// float, true or false, or a duration like 1m30s
+func (t Type) Check(value string) error {
+	var err error
+	switch t {
+	case String:
+	case Int:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case Float:
+		_, err = strconv.ParseFloat(value, 64)
+	case Bool:
+		_, err = strconv.ParseBool(value)
+	case Duration:
+		_, err = time.ParseDuration(value)
+	default:
+		return fmt.Errorf("unknown type %q, want string, int, float, bool or duration", t)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %q is not %s", ErrInvalid, value, t)
+	}
+	return nil
+}
+
+// Value is a setting with the value in force. The typed getters read it
+// as its type, it was checked when set.
+type Value struct {
+	Def
+	Value string
+	// Overridden is false while the default applies
+	Overridden bool
+	UpdatedAt  time.Time
+	// UpdatedBy is the x-user-id of the call that set the override
+	UpdatedBy string
+}
+
+func (v Value) Int() int64 {
+	n, _ := strconv.ParseInt(v.Value, 10, 64)
+	return n
+}
+
+func (v Value) Float() float64 {
+	f, _ := strconv.ParseFloat(v.Value, 64)
+	return f
+}
+
+func (v Value) Bool() bool {
+	b, _ := strconv.ParseBool(v.Value)
+	return b
+}
+
+func (v Value) Duration() time.Duration {
+	d, _ := time.ParseDuration(v.Value)
+	return d
+}
+
+type Options struct {
+	// TTL of cached values, 1m by default. Writes delete them, it only
+	// bounds how long a read racing a write may serve the old value.
+	TTL time.Duration
+}
+
+// Store reads and overrides the registered settings, it is safe for
+// concurrent use
+type Store struct {
+	db    *gorm.DB
+	cache cache.Store
+	log   *logger.Logger
+	opts  Options
+
+	mu   sync.RWMutex
+	defs map[string]Def
+}
+
+// New reads through store, or straight from db when store is nil
+func New(db *gorm.DB, store cache.Store, log *logger.Logger, opts Options) *Store {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultTTL
+	}
+	return &Store{db: db, cache: store, log: log, opts: opts, defs: make(map[string]Def)}
+}
+
+// Register defines settings, each name once
+func (s *Store) Register(defs ...Def) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range defs {
+		if err := d.Validate(); err != nil {
+			return err
+		}
+		if _, ok := s.defs[d.Name()]; ok {
+			return fmt.Errorf("setting %s is registered twice", d.Name())
+		}
+		s.defs[d.Name()] = d
+	}
+	return nil
+}
+
+// Defs are the settings of namespace, all of them for "", by name
+func (s *Store) Defs(namespace string) []Def {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Def, 0, len(s.defs))
+	for _, d := range s.defs {
+		if namespace == "" || d.Namespace == namespace {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out
+}
+
+func (s *Store) def(namespace, key string) (Def, error) {
+	s.mu.RLock()
+	d, ok := s.defs[namespace+"."+key]
+	s.mu.RUnlock()
+	if !ok {
+		return d, fmt.Errorf("%w %s.%s", ErrUnknown, namespace, key)
+	}
+	return d, nil
+}
+
+// Get is the value in force, the override or the default
+func (s *Store) Get(ctx context.Context, namespace, key string) (Value, error) {
+	d, err := s.def(namespace, key)
+	if err != nil {
+		return Value{}, err
+	}
+	e, err := s.read(ctx, d)
+	if err != nil {
+		return Value{}, err
+	}
+	return s.value(d, e), nil
+}
+
+func (s *Store) String(ctx context.Context, namespace, key string) (string, error) {
+	v, err := s.typed(ctx, namespace, key, String)
+	return v.Value, err
+}
+
+func (s *Store) Int(ctx context.Context, namespace, key string) (int64, error) {
+	v, err := s.typed(ctx, namespace, key, Int)
+	return v.Int(), err
+}
+
+func (s *Store) Float(ctx context.Context, namespace, key string) (float64, error) {
+	v, err := s.typed(ctx, namespace, key, Float)
+	return v.Float(), err
+}
+
+func (s *Store) Bool(ctx context.Context, namespace, key string) (bool, error) {
+	v, err := s.typed(ctx, namespace, key, Bool)
+	return v.Bool(), err
+}
+
+func (s *Store) Duration(ctx context.Context, namespace, key string) (time.Duration, error) {
+	v, err := s.typed(ctx, namespace, key, Duration)
+	return v.Duration(), err
+}
+
+// typed is Get for a caller expecting t, the zero Value on any error
+func (s *Store) typed(ctx context.Context, namespace, key string, t Type) (Value, error) {
+	v, err := s.Get(ctx, namespace, key)
+	if err != nil {
+		return Value{}, err
+	}
+	if v.Type != t {
+		return Value{}, fmt.Errorf("setting %s is %s, not %s", v.Name(), v.Type, t)
+	}
+	return v, nil
+}
+
+// Set overrides a setting, value written as its type
+func (s *Store) Set(ctx context.Context, namespace, key, value string) (Value, error) {
+	d, err := s.def(namespace, key)
+	if err != nil {
+		return Value{}, err
+	}
+	if err := d.Type.Check(value); err != nil {
+		return Value{}, fmt.Errorf("setting %s: %w", d.Name(), err)
+	}
+
+	row := model.Setting{Namespace: d.Namespace, Key: d.Key, Value: value}
+	err = s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "namespace"}, {Name: "key"}},
+		UpdateAll: true,
+	}).Create(&row).Error
+	if err != nil {
+		return Value{}, fmt.Errorf("setting %s: %w", d.Name(), err)
+	}
+	s.invalidate(ctx, d)
+	return s.value(d, entryOf(row)), nil
+}
+
+// Reset drops the override, the default applies again
+func (s *Store) Reset(ctx context.Context, namespace, key string) (Value, error) {
+	d, err := s.def(namespace, key)
+	if err != nil {
+		return Value{}, err
+	}
+	err = s.db.WithContext(ctx).
+		Where("namespace = ? AND key = ?", d.Namespace, d.Key).
+		Delete(&model.Setting{}).Error
+	if err != nil {
+		return Value{}, fmt.Errorf("setting %s: %w", d.Name(), err)
+	}
+	s.invalidate(ctx, d)
+	return s.value(d, entry{}), nil
+}
+
+// List is every setting of namespace, all of them for "", read from the
+// database rather than the cache: what an operator sees is what is stored
+func (s *Store) List(ctx context.Context, namespace string) ([]Value, error) {
+	q := s.db.WithContext(ctx)
+	if namespace != "" {
+		q = q.Where("namespace = ?", namespace)
+	}
+	var rows []model.Setting
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("settings: %w", err)
+	}
+	stored := make(map[string]model.Setting, len(rows))
+	for _, r := range rows {
+		stored[r.Namespace+"."+r.Key] = r
+	}
+
+	defs := s.Defs(namespace)
+	out := make([]Value, len(defs))
+	for i, d := range defs {
+		var e entry
+		if r, ok := stored[d.Name()]; ok {
+			e = entryOf(r)
+		}
+		out[i] = s.value(d, e)
+	}
+	return out, nil
+}
+
+// entry is what is cached of a setting, the row or that there is none
+type entry struct {
+	Value     string    `json:"value,omitempty"`
+	Set       bool      `json:"set"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+}
+
+func entryOf(r model.Setting) entry {
+	return entry{Value: r.Value, Set: true, UpdatedAt: r.UpdatedAt.UTC(), UpdatedBy: r.RequestUserID}
+}
+
+func (s *Store) read(ctx context.Context, d Def) (entry, error) {
+	var e entry
+	if s.cache != nil {
+		err := s.cache.Get(global(ctx), keyPrefix+d.Name(), &e)
+		if err == nil {
+			return e, nil
+		}
+		if !stderrors.Is(err, cache.ErrNotFound) && s.log != nil {
+			s.log.Warnw("Settings cache read failed, reading the database", "setting", d.Name(), "error", err.Error())
+		}
+	}
+
+	var row model.Setting
+	err := s.db.WithContext(ctx).Where("namespace = ? AND key = ?", d.Namespace, d.Key).Take(&row).Error
+	switch {
+	case stderrors.Is(err, gorm.ErrRecordNotFound):
+		e = entry{}
+	case err != nil:
+		return e, fmt.Errorf("setting %s: %w", d.Name(), err)
+	default:
+		e = entryOf(row)
+	}
+
+	if s.cache != nil {
+		if err := s.cache.SetWithTTL(global(ctx), keyPrefix+d.Name(), e, s.opts.TTL); err != nil && s.log != nil {
+			s.log.Warnw("Settings cache write failed", "setting", d.Name(), "error", err.Error())
+		}
+	}
+	return e, nil
+}
+
+func (s *Store) value(d Def, e entry) Value {
+	v := Value{Def: d, Value: d.Default}
+	if !e.Set {
+		return v
+	}
+	// the type changed since the override was set, it no longer applies
+	if err := d.Type.Check(e.Value); err != nil {
+		if s.log != nil {
+			s.log.Warnw("Settings override ignored, default applies", "setting", d.Name(), "error", err.Error())
+		}
+		return v
+	}
+	v.Value, v.Overridden, v.UpdatedAt, v.UpdatedBy = e.Value, true, e.UpdatedAt, e.UpdatedBy
+	return v
+}
+
+// invalidate deletes the cached value, a failure leaves it until the ttl
+func (s *Store) invalidate(ctx context.Context, d Def) {
+	if s.cache == nil {
+		return
+	}
+	if _, err := s.cache.Delete(global(context.WithoutCancel(ctx)), keyPrefix+d.Name()); err != nil && s.log != nil {
+		s.log.Warnw("Settings cache invalidation failed, replicas see the change within the ttl", "setting", d.Name(), "error", err.Error())
+	}
+}
+
+// global is ctx without the values cache keys are scoped by, settings are
+// the same for every tenant, user and locale and have one entry
+func global(ctx context.Context) context.Context {
+	ctx = ctxmeta.WithTenantID(ctx, "")
+	ctx = ctxmeta.WithUserID(ctx, "")
+	return ctxmeta.WithLocale(ctx, "")
+}
@@ -0,0 +1,140 @@
+package settings
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blueprint/config"
+	model "blueprint/model/blueprint"
+	"blueprint/pkg/cache"
+	"blueprint/pkg/ctxmeta"
+	"blueprint/pkg/db"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var (
+	spread     = Def{Namespace: "trading", Key: "spread_bps", Type: Int, Default: "15", Description: "Spread added to quotes"}
+	commission = Def{Namespace: "trading", Key: "commission_rate", Type: Float, Default: "0.001", Description: "Commission per trade"}
+	cooldown   = Def{Namespace: "risk", Key: "cooldown", Type: Duration, Default: "30s"}
+)
+
+func TestRegister(t *testing.T) {
+	s := New(nil, nil, nil, Options{})
+	require.NoError(t, s.Register(spread, commission, cooldown))
+	assert.Error(t, s.Register(spread), "twice")
+
+	for _, bad := range []Def{
+		{Namespace: "Trading", Key: "spread", Type: Int, Default: "1"},
+		{Namespace: "trading", Key: "spread.bps", Type: Int, Default: "1"},
+		{Namespace: "trading", Key: "spread", Type: Int, Default: "1.5"},
+		{Namespace: "trading", Key: "spread", Type: "decimal", Default: "1"},
+	} {
+		assert.Error(t, s.Register(bad), bad.Name())
+	}
+
+	assert.Equal(t, []Def{commission, spread}, s.Defs("trading"))
+	assert.Len(t, s.Defs(""), 3)
+
+	_, err := s.Get(context.Background(), "trading", "fee")
+	assert.ErrorIs(t, err, ErrUnknown)
+}
+
+func TestTypeCheck(t *testing.T) {
+	assert.NoError(t, Bool.Check("true"))
+	assert.NoError(t, Duration.Check("1m30s"))
+	assert.NoError(t, String.Check(""))
+	assert.ErrorIs(t, Int.Check("ten"), ErrInvalid)
+	assert.ErrorIs(t, Duration.Check("30"), ErrInvalid)
+}
+
+func newStore(t *testing.T, store cache.Store) (*Store, *gorm.DB) {
+	cfg := &config.Config{Postgres: testsupport.Postgres(t)}
+	pg, err := db.NewPostgresDB(cfg, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { pg.Close() })
+	require.NoError(t, db.Migrate(cfg))
+	require.NoError(t, pg.DB.Exec("DELETE FROM platform_setting").Error)
+
+	s := New(pg.DB, store, nil, Options{})
+	require.NoError(t, s.Register(spread, commission, cooldown))
+	return s, pg.DB
+}
+
+func TestStore(t *testing.T) {
+	s, _ := newStore(t, nil)
+	ctx := ctxmeta.WithUserID(context.Background(), "ops-1")
+
+	v, err := s.Get(ctx, "trading", "spread_bps")
+	require.NoError(t, err)
+	assert.Equal(t, "15", v.Value)
+	assert.False(t, v.Overridden)
+
+	v, err = s.Set(ctx, "trading", "spread_bps", "20")
+	require.NoError(t, err)
+	assert.True(t, v.Overridden)
+	assert.Equal(t, "ops-1", v.UpdatedBy)
+	n, err := s.Int(ctx, "trading", "spread_bps")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), n)
+
+	_, err = s.Set(ctx, "trading", "spread_bps", "25")
+	require.NoError(t, err, "upserts")
+	n, _ = s.Int(ctx, "trading", "spread_bps")
+	assert.Equal(t, int64(25), n)
+
+	_, err = s.Set(ctx, "trading", "spread_bps", "wide")
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, err = s.Float(ctx, "trading", "spread_bps")
+	assert.Error(t, err, "not a float")
+
+	d, err := s.Duration(ctx, "risk", "cooldown")
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, d)
+
+	list, err := s.List(ctx, "trading")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "0.001", list[0].Value)
+	assert.Equal(t, "25", list[1].Value)
+
+	v, err = s.Reset(ctx, "trading", "spread_bps")
+	require.NoError(t, err)
+	assert.Equal(t, "15", v.Value)
+	n, _ = s.Int(ctx, "trading", "spread_bps")
+	assert.Equal(t, int64(15), n)
+}
+
+func TestStoreCache(t *testing.T) {
+	store := cache.NewMemory()
+	s, gdb := newStore(t, store)
+	ctx := context.Background()
+
+	_, err := s.Get(ctx, "trading", "commission_rate")
+	require.NoError(t, err)
+	// written behind the store's back, the cached default still applies
+	require.NoError(t, gdb.Create(&model.Setting{Namespace: "trading", Key: "commission_rate", Value: "0.002"}).Error)
+	f, err := s.Float(ctx, "trading", "commission_rate")
+	require.NoError(t, err)
+	assert.Equal(t, 0.001, f)
+
+	// a write through the store invalidates, for any tenant
+	_, err = s.Set(ctx, "trading", "commission_rate", "0.003")
+	require.NoError(t, err)
+	f, err = s.Float(ctxmeta.WithTenantID(ctx, "acme"), "trading", "commission_rate")
+	require.NoError(t, err)
+	assert.Equal(t, 0.003, f)
+
+	// an override the type no longer takes falls back to the default
+	require.NoError(t, gdb.Model(&model.Setting{}).Where("key = ?", "commission_rate").Update("value", "n/a").Error)
+	_, err = store.Delete(ctx, keyPrefix+commission.Name())
+	require.NoError(t, err)
+	v, err := s.Get(ctx, "trading", "commission_rate")
+	require.NoError(t, err)
+	assert.False(t, v.Overridden)
+	assert.Equal(t, "0.001", v.Value)
+}
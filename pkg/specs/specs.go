@@ -0,0 +1,18 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package specs parses the lists of "name=value" specs config carries,
+// rate limits, cache and retention policies and the like.
+package specs
+
+// ParseAll parses every spec with parse, the first bad one fails the lot
+func ParseAll[T any](specs []string, parse func(spec string) (T, error)) ([]T, error) {
+	parsed := make([]T, 0, len(specs))
+	for _, spec := range specs {
+		v, err := parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, v)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,31 @@
+package specs
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAll(t *testing.T) {
+	parsed, err := ParseAll([]string{"1", "2"}, strconv.Atoi)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, parsed)
+
+	parsed, err = ParseAll(nil, strconv.Atoi)
+	require.NoError(t, err)
+	assert.Empty(t, parsed)
+
+	calls := 0
+	_, err = ParseAll([]string{"1", "x", "3"}, func(spec string) (int, error) {
+		calls++
+		if spec == "x" {
+			return 0, fmt.Errorf("bad spec %q", spec)
+		}
+		return 0, nil
+	})
+	assert.EqualError(t, err, `bad spec "x"`, "the first bad one fails the lot")
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,253 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package startup runs the initialization of the service as a dependency
+// graph. A step starts as soon as the steps it comes After are ready, so
+// independent connections like redis and postgres come up in parallel, and
+// every failure is reported at once instead of the first one exiting.
+//
+//	g := startup.NewGraph(log)
+//	g.Add(startup.Step{Name: "redis", Optional: true, Run: connectRedis})
+//	g.Add(startup.Step{Name: "postgres", Run: connectPostgres})
+//	g.Add(startup.Step{Name: "migrate", After: []string{"postgres"}, Run: migrate})
+//	res, err := g.Run(ctx)
+//
+// An Optional step may fail without failing the start, the service comes
+// up degraded and Result.Degraded names what is missing.
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	stepSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_startup_step_seconds",
+		Help: "How long each startup step took, failed steps included.",
+	}, []string{"step"})
+
+	stepDegraded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_startup_degraded",
+		Help: "1 for each optional startup step that failed or was skipped, the service runs without it.",
+	}, []string{"step"})
+)
+
+func init() {
+	prometheus.MustRegister(stepSeconds, stepDegraded)
+}
+
+// Status of a step once Run returns
+type Status string
+
+const (
+	Ready   Status = "ready"
+	Failed  Status = "failed"
+	Skipped Status = "skipped"
+)
+
+type Step struct {
+	Name string
+	// After are the steps that must be ready first, the step is skipped
+	// when one of them is not
+	After []string
+	// Optional steps failing or skipped leave the service degraded
+	// instead of failing the start
+	Optional bool
+	Run      func(ctx context.Context) error
+}
+
+// Outcome is how one step went
+type Outcome struct {
+	Status   Status
+	Err      error
+	Duration time.Duration
+}
+
+type Result struct {
+	Steps map[string]Outcome
+	// optional are the names of the optional steps
+	optional map[string]bool
+}
+
+// Ready reports whether the step ran and succeeded
+func (r *Result) Ready(name string) bool {
+	return r.Steps[name].Status == Ready
+}
+
+// Degraded are the optional steps that failed or were skipped, sorted
+func (r *Result) Degraded() []string {
+	var names []string
+	for name, o := range r.Steps {
+		if r.optional[name] && o.Status != Ready {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+type Graph struct {
+	log   *logger.Logger
+	steps []Step
+}
+
+func NewGraph(log *logger.Logger) *Graph {
+	return &Graph{log: log}
+}
+
+func (g *Graph) Add(s Step) {
+	g.steps = append(g.steps, s)
+}
+
+// Run checks the graph, then runs every step once its dependencies are
+// done. The error joins the failures of the required steps, nil means the
+// service may start, degraded or not.
+func (g *Graph) Run(ctx context.Context) (*Result, error) {
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+
+	res := &Result{Steps: make(map[string]Outcome, len(g.steps)), optional: make(map[string]bool)}
+	done := make(map[string]chan struct{}, len(g.steps))
+	for _, s := range g.steps {
+		done[s.Name] = make(chan struct{})
+		res.optional[s.Name] = s.Optional
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, s := range g.steps {
+		wg.Add(1)
+		go func(s Step) {
+			defer wg.Done()
+			defer close(done[s.Name])
+
+			var missing []string
+			for _, dep := range s.After {
+				<-done[dep]
+				mu.Lock()
+				ready := res.Ready(dep)
+				mu.Unlock()
+				if !ready {
+					missing = append(missing, dep)
+				}
+			}
+
+			o := g.runStep(ctx, s, missing)
+			mu.Lock()
+			res.Steps[s.Name] = o
+			mu.Unlock()
+		}(s)
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, s := range g.steps {
+		o := res.Steps[s.Name]
+		if s.Optional || o.Status == Ready {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", s.Name, o.Err))
+	}
+	return res, errors.Join(errs...)
+}
+
+func (g *Graph) runStep(ctx context.Context, s Step, missing []string) Outcome {
+	if len(missing) > 0 {
+		err := fmt.Errorf("skipped, needs %s", strings.Join(missing, ", "))
+		g.report(s, err)
+		return Outcome{Status: Skipped, Err: err}
+	}
+
+	start := time.Now()
+	err := s.Run(ctx)
+	o := Outcome{Status: Ready, Err: err, Duration: time.Since(start)}
+	stepSeconds.WithLabelValues(s.Name).Set(o.Duration.Seconds())
+	if err != nil {
+		o.Status = Failed
+		g.report(s, err)
+		return o
+	}
+
+	stepDegraded.WithLabelValues(s.Name).Set(0)
+	if g.log != nil {
+		g.log.Infof("Startup step %s ready in %v", s.Name, o.Duration.Round(time.Millisecond))
+	}
+	return o
+}
+
+func (g *Graph) report(s Step, err error) {
+	if s.Optional {
+		stepDegraded.WithLabelValues(s.Name).Set(1)
+	}
+	if g.log == nil {
+		return
+	}
+	if s.Optional {
+		g.log.Warnf("Optional startup step %s: %v, starting without it", s.Name, err)
+		return
+	}
+	g.log.Errorf("Startup step %s: %v", s.Name, err)
+}
+
+// validate fails on duplicate names, unknown dependencies and cycles
+// before anything runs
+func (g *Graph) validate() error {
+	deps := make(map[string][]string, len(g.steps))
+	for _, s := range g.steps {
+		if s.Name == "" || s.Run == nil {
+			return fmt.Errorf("startup step %q: name and run are required", s.Name)
+		}
+		if _, dup := deps[s.Name]; dup {
+			return fmt.Errorf("startup step %q added twice", s.Name)
+		}
+		deps[s.Name] = s.After
+	}
+	for name, after := range deps {
+		for _, dep := range after {
+			if _, ok := deps[dep]; !ok {
+				return fmt.Errorf("startup step %q: unknown dependency %q", name, dep)
+			}
+		}
+	}
+
+	// depth first, visiting marks steps on the current path
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(deps))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("startup steps form a cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path[:len(path):len(path)], name)
+		for _, dep := range deps[name] {
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, s := range g.steps {
+		if err := visit(s.Name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
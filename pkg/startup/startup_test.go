@@ -0,0 +1,117 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ok(ctx context.Context) error { return nil }
+
+func TestRunStartsIndependentStepsInParallel(t *testing.T) {
+	// each waits for the other, only a parallel start gets past the barrier
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	wait := func(ctx context.Context) error {
+		barrier.Done()
+		done := make(chan struct{})
+		go func() { barrier.Wait(); close(done) }()
+		select {
+		case <-done:
+			return nil
+		case <-time.After(time.Second):
+			return errors.New("ran alone")
+		}
+	}
+
+	g := NewGraph(nil)
+	g.Add(Step{Name: "redis", Run: wait})
+	g.Add(Step{Name: "postgres", Run: wait})
+	res, err := g.Run(context.Background())
+	require.NoError(t, err)
+	assert.True(t, res.Ready("redis"))
+	assert.True(t, res.Ready("postgres"))
+}
+
+func TestRunOrdersByDependency(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	step := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	g := NewGraph(nil)
+	g.Add(Step{Name: "retention", After: []string{"migrate"}, Run: step("retention")})
+	g.Add(Step{Name: "migrate", After: []string{"postgres"}, Run: step("migrate")})
+	g.Add(Step{Name: "postgres", Run: step("postgres")})
+	_, err := g.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"postgres", "migrate", "retention"}, order)
+}
+
+func TestRunReportsEveryFailure(t *testing.T) {
+	g := NewGraph(nil)
+	g.Add(Step{Name: "redis", Run: func(context.Context) error { return errors.New("connection refused") }})
+	g.Add(Step{Name: "postgres", Run: func(context.Context) error { return errors.New("bad password") }})
+	g.Add(Step{Name: "migrate", After: []string{"postgres"}, Run: ok})
+
+	res, err := g.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "redis: connection refused")
+	assert.Contains(t, err.Error(), "postgres: bad password")
+	assert.Contains(t, err.Error(), "migrate: skipped, needs postgres")
+	assert.Equal(t, Skipped, res.Steps["migrate"].Status)
+}
+
+func TestRunStartsDegradedWithoutOptionalSteps(t *testing.T) {
+	g := NewGraph(nil)
+	g.Add(Step{Name: "redis", Optional: true, Run: func(context.Context) error { return errors.New("connection refused") }})
+	g.Add(Step{Name: "cache", After: []string{"redis"}, Optional: true, Run: ok})
+	g.Add(Step{Name: "postgres", Run: ok})
+
+	res, err := g.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cache", "redis"}, res.Degraded())
+	assert.True(t, res.Ready("postgres"))
+	assert.Equal(t, Failed, res.Steps["redis"].Status)
+}
+
+func TestRunRejectsBadGraphs(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []Step
+		want  string
+	}{
+		{"unknown", []Step{{Name: "migrate", After: []string{"postgres"}, Run: ok}}, `unknown dependency "postgres"`},
+		{"duplicate", []Step{{Name: "redis", Run: ok}, {Name: "redis", Run: ok}}, "added twice"},
+		{"cycle", []Step{
+			{Name: "a", After: []string{"b"}, Run: ok},
+			{Name: "b", After: []string{"a"}, Run: ok},
+		}, "cycle: a -> b -> a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGraph(nil)
+			ran := false
+			for _, s := range tt.steps {
+				run := s.Run
+				s.Run = func(ctx context.Context) error { ran = true; return run(ctx) }
+				g.Add(s)
+			}
+			_, err := g.Run(context.Background())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+			assert.False(t, ran, "nothing runs")
+		})
+	}
+}
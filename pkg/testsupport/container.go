@@ -0,0 +1,196 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package testsupport starts the infrastructure integration tests need in
+// docker containers and removes them afterwards. Tests ask for a service,
+// e.g. Redis(t), and get a ready client or config. When docker is missing
+// the test is skipped with the reason, set TEST_REQUIRE_INFRA=1 in CI to
+// fail instead. TEST_REDIS_ADDR and TEST_POSTGRES_URL point the tests at
+// running services and skip docker altogether, a redis only with
+// TEST_REDIS_FLUSH=1 as its database is flushed.
+package testsupport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	TEST_REQUIRE_INFRA = "TEST_REQUIRE_INFRA"
+
+	containerLabel = "blueprint.testsupport=1"
+	readyTimeout   = 60 * time.Second
+)
+
+// Spec describes a container, Port is the container port tests connect to
+type Spec struct {
+	Image string
+	Port  string
+	Env   map[string]string
+	Args  []string
+	// Ready is polled with the mapped host:port until it returns nil
+	Ready func(ctx context.Context, addr string) error
+}
+
+// Container is a started container, Addr is reachable from the test
+type Container struct {
+	ID   string
+	Addr string
+}
+
+var shared = struct {
+	sync.Mutex
+	enabled    bool
+	containers map[string]*Container
+}{containers: make(map[string]*Container)}
+
+// Main runs the tests of a package with one container per image shared by
+// all of them, removed once m.Run returns. Use it from TestMain:
+//
+//	func TestMain(m *testing.M) { testsupport.Main(m) }
+//
+// Without it every test gets, and tears down, its own containers.
+func Main(m *testing.M) {
+	shared.Lock()
+	shared.enabled = true
+	shared.Unlock()
+
+	code := m.Run()
+
+	shared.Lock()
+	for _, c := range shared.containers {
+		remove(c.ID)
+	}
+	shared.Unlock()
+
+	os.Exit(code)
+}
+
+// Run starts spec, or hands out the shared container under Main, and waits
+// until it is ready
+func Run(t testing.TB, spec Spec) *Container {
+	t.Helper()
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		unavailable(t, "docker not found: %v", err)
+	}
+
+	shared.Lock()
+	defer shared.Unlock()
+
+	if c, ok := shared.containers[spec.Image]; ok {
+		return c
+	}
+
+	c, err := start(spec)
+	if err != nil {
+		unavailable(t, "starting %s: %v", spec.Image, err)
+	}
+
+	if shared.enabled {
+		shared.containers[spec.Image] = c
+	} else {
+		t.Cleanup(func() { remove(c.ID) })
+	}
+	return c
+}
+
+func start(spec Spec) (*Container, error) {
+	args := []string{"run", "-d", "--rm", "--label", containerLabel, "-p", "127.0.0.1::" + spec.Port}
+	for k, v := range spec.Env {
+		args = append(args, "-e", k+"="+v)
+	}
+	args = append(append(args, spec.Image), spec.Args...)
+
+	id, err := docker(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Container{ID: id}
+	if c.Addr, err = mappedAddr(id, spec.Port); err != nil {
+		remove(id)
+		return nil, err
+	}
+
+	if err := waitReady(spec, c.Addr); err != nil {
+		logs, _ := docker("logs", "--tail", "20", id)
+		remove(id)
+		return nil, fmt.Errorf("%w\n%s", err, logs)
+	}
+	return c, nil
+}
+
+// mappedAddr turns "127.0.0.1:49153" from docker port into an address, the
+// first line wins when docker lists ipv4 and ipv6
+func mappedAddr(id, port string) (string, error) {
+	out, err := docker("port", id, port+"/tcp")
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(out, "\n")
+	host, p, err := net.SplitHostPort(strings.TrimSpace(line))
+	if err != nil {
+		return "", fmt.Errorf("unexpected docker port output %q", out)
+	}
+	if host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, p), nil
+}
+
+func waitReady(spec Spec, addr string) error {
+	if spec.Ready == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+	defer cancel()
+
+	for {
+		attempt, attemptCancel := context.WithTimeout(ctx, 2*time.Second)
+		err := spec.Ready(attempt, addr)
+		attemptCancel()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s not ready after %v: %w", spec.Image, readyTimeout, err)
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+func remove(id string) {
+	_, _ = docker("rm", "-f", "-v", id)
+}
+
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// unavailable skips the test, or fails it when TEST_REQUIRE_INFRA is set
+func unavailable(t testing.TB, format string, args ...interface{}) {
+	t.Helper()
+	msg := fmt.Sprintf(format, args...)
+	if os.Getenv(TEST_REQUIRE_INFRA) != "" {
+		t.Fatalf("integration infrastructure required: %s", msg)
+	}
+	t.Skipf("integration infrastructure unavailable, set %s=1 to fail instead: %s", TEST_REQUIRE_INFRA, msg)
+}
@@ -0,0 +1,140 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package testsupport
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"blueprint/pkg/redact"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// TEST_UPDATE_GOLDEN=1 rewrites golden files with the current output
+const TEST_UPDATE_GOLDEN = "TEST_UPDATE_GOLDEN"
+
+// LoadProto reads a fixture into msg, protojson for .json files and text
+// format for .textproto/.txtpb. Relative paths are under testdata/.
+func LoadProto(t testing.TB, path string, msg proto.Message) {
+	t.Helper()
+
+	data := readFixture(t, path)
+	var err error
+	switch filepath.Ext(path) {
+	case ".textproto", ".txtpb":
+		err = prototext.Unmarshal(data, msg)
+	default:
+		err = protojson.Unmarshal(data, msg)
+	}
+	if err != nil {
+		t.Fatalf("fixture %s: %v", path, err)
+	}
+}
+
+// LoadJSON reads a JSON fixture into v, relative paths are under testdata/
+func LoadJSON(t testing.TB, path string, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(readFixture(t, path), v); err != nil {
+		t.Fatalf("fixture %s: %v", path, err)
+	}
+}
+
+func readFixture(t testing.TB, path string) []byte {
+	t.Helper()
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join("testdata", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("fixture: %v", err)
+	}
+	return data
+}
+
+// GoldenOption adjusts what Golden compares
+type GoldenOption func(*golden)
+
+type golden struct {
+	redact redact.Fields
+}
+
+// Redact replaces the named fields at any depth before comparing, for ids,
+// timestamps and durations that differ on every run
+func Redact(fields ...string) GoldenOption {
+	return func(g *golden) {
+		g.redact.Add(fields...)
+	}
+}
+
+// Golden compares got with testdata/golden/<name>.json. Proto messages are
+// encoded with protojson and proto field names, anything else with
+// encoding/json. Keys are sorted and the output indented so the files diff
+// well; run with TEST_UPDATE_GOLDEN=1 to write them.
+func Golden(t testing.TB, name string, got interface{}, opts ...GoldenOption) {
+	t.Helper()
+
+	g := &golden{redact: redact.NewFields()}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	actual, err := g.normalize(got)
+	if err != nil {
+		t.Fatalf("golden %s: %v", name, err)
+	}
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if os.Getenv(TEST_UPDATE_GOLDEN) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("golden %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, actual, 0o644); err != nil {
+			t.Fatalf("golden %s: %v", name, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden %s: %v (run with %s=1 to create it)", name, err, TEST_UPDATE_GOLDEN)
+	}
+	if !bytes.Equal(want, actual) {
+		t.Errorf("golden %s mismatch, run with %s=1 to update\n--- want\n%s\n--- got\n%s", name, TEST_UPDATE_GOLDEN, want, actual)
+	}
+}
+
+// normalize encodes v, applies the redactions and re-encodes it with sorted
+// keys and a trailing newline
+func (g *golden) normalize(v interface{}) ([]byte, error) {
+	var raw []byte
+	var err error
+	if msg, ok := v.(proto.Message); ok {
+		raw, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	} else {
+		raw, err = json.Marshal(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tree interface{}
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(redact.Value(tree, g.redact)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
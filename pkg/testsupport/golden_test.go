@@ -0,0 +1,49 @@
+package testsupport
+
+import (
+	"testing"
+
+	pb "blueprint/proto/blueprint"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestLoadProtoFormats(t *testing.T) {
+	fromJSON := &pb.CallRequest{}
+	LoadProto(t, "call_request.json", fromJSON)
+
+	fromText := &pb.CallRequest{}
+	LoadProto(t, "call_request.textproto", fromText)
+
+	assert.Equal(t, "fixture", fromJSON.Name)
+	assert.True(t, proto.Equal(fromJSON, fromText))
+
+	var raw map[string]string
+	LoadJSON(t, "call_request.json", &raw)
+	assert.Equal(t, "fixture", raw["name"])
+}
+
+func TestGoldenRedacts(t *testing.T) {
+	g := &golden{redact: map[string]struct{}{}}
+	Redact("request_id", "Time")(g)
+
+	out, err := g.normalize(map[string]interface{}{
+		"msg":   "hi",
+		"meta":  []interface{}{map[string]interface{}{"request_id": "abc", "time": "now"}},
+		"count": 2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "count": 2,
+  "meta": [
+    {
+      "request_id": "[REDACTED]",
+      "time": "[REDACTED]"
+    }
+  ],
+  "msg": "hi"
+}
+`, string(out))
+}
@@ -0,0 +1,165 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package grpctest runs the service in-process for end-to-end RPC tests.
+// It sits apart from testsupport because it imports app and with it every
+// package whose tests use testsupport.
+package grpctest
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"blueprint/app"
+	"blueprint/config"
+	"blueprint/handler"
+	"blueprint/pkg/cache"
+	"blueprint/pkg/clock"
+	"blueprint/pkg/logger"
+	"blueprint/pkg/quota"
+	pb "blueprint/proto/blueprint"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufSize = 1 << 20
+
+// ServerOptions swap out what GRPC wires by default: Config(t), an
+// in-memory cache, no database and the wall clock, which also drives the
+// rate limits and the load shedder. The interceptors are the ones
+// app.BuildServerDeps builds for Config, only their stores are swapped.
+type ServerOptions struct {
+	Config *config.Config
+	Cache  cache.Store
+	Store  handler.Store
+	Clock  clock.Clock
+	// Quota is the store of the quota interceptor Config.Quota turns on
+	Quota quota.Store
+	// Register adds more services next to Blueprint
+	Register func(s *grpc.Server)
+}
+
+// Server is a running in-process gRPC server and a client connected to it
+type Server struct {
+	Conn    *grpc.ClientConn
+	Client  pb.BlueprintClient
+	Handler *handler.Blueprint
+	Cache   cache.Store
+	Log     *logger.Logger
+	// Deps are the interceptors of the chain, e.g. to switch maintenance
+	// mode on
+	Deps app.ServerDeps
+}
+
+// GRPC boots the production interceptor chain from app.BuildServerDeps and
+// app.NewGRPCServer with the Blueprint handler on a bufconn listener. Everything is stopped when
+// the test ends.
+func GRPC(t testing.TB, opts ServerOptions) *Server {
+	t.Helper()
+
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = Config(t)
+	}
+	store := opts.Cache
+	if store == nil {
+		store = cache.NewMemory()
+	}
+
+	log := Logger(t)
+	deps, err := app.BuildServerDeps(cfg, log, opts.Clock, nil)
+	if err != nil {
+		t.Fatalf("server deps: %v", err)
+	}
+	deps.Start()
+	t.Cleanup(deps.Stop)
+
+	if deps.Responses != nil {
+		deps.Responses.SetStore(store)
+	}
+	if opts.Quota != nil {
+		if deps.Quotas == nil {
+			t.Fatalf("a quota store needs Config.Quota limits")
+		}
+		deps.Quotas.SetStore(opts.Quota)
+	}
+
+	s := app.NewGRPCServer(cfg, log, deps)
+
+	h := handler.NewBlueprint(nil, log.Module("handler"), store, opts.Store)
+	h.Clock = clock.Or(opts.Clock)
+	pb.RegisterBlueprintServer(s, h)
+	if opts.Register != nil {
+		opts.Register(s)
+	}
+
+	lis := bufconn.Listen(bufSize)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &Server{
+		Conn:    conn,
+		Client:  pb.NewBlueprintClient(conn),
+		Handler: h,
+		Cache:   store,
+		Log:     log,
+		Deps:    deps,
+	}
+}
+
+// Config loads the config the way the service does, from the env with
+// placeholders for the required values, and ignores any .env file
+func Config(t testing.TB) *config.Config {
+	t.Helper()
+
+	t.Setenv(config.ENV_FILE, filepath.Join(t.TempDir(), ".env"))
+	required := map[string]string{
+		config.GPRC_HOST:         "127.0.0.1",
+		config.GRPC_PORT:         "3000",
+		config.REDIS_URL:         "127.0.0.1:6379",
+		config.REDIS_PASSWORD:    "test",
+		config.POSTGRES_HOST:     "127.0.0.1",
+		config.POSTGRES_PORT:     "5432",
+		config.POSTGRES_USER:     "test",
+		config.POSTGRES_PASSWORD: "test",
+		config.POSTGRES_DB:       "platform_test",
+	}
+	for k, v := range required {
+		t.Setenv(k, v)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load test config: %v", err)
+	}
+	return cfg
+}
+
+// Logger only logs errors, to a file in the test's temp dir
+func Logger(t testing.TB) *logger.Logger {
+	t.Helper()
+
+	log, err := logger.NewLoggerWithOptions(&config.Config{}, logger.LoggerOptions{
+		Level:      "error",
+		OutputPath: filepath.Join(t.TempDir(), "test.log"),
+	})
+	if err != nil {
+		t.Fatalf("test logger: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+	return log
+}
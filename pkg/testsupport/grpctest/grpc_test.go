@@ -0,0 +1,134 @@
+package grpctest
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blueprint/pkg/clock"
+	apperrors "blueprint/pkg/errors"
+	"blueprint/pkg/maintenance"
+	"blueprint/pkg/testsupport"
+	pb "blueprint/proto/blueprint"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// countingStore counts the queries Call runs against the database
+type countingStore struct {
+	queries atomic.Int32
+}
+
+func (s *countingStore) CountTables(ctx context.Context) (int64, error) {
+	s.queries.Add(1)
+	return 1, nil
+}
+
+func (s *countingStore) Ping(ctx context.Context) error { return nil }
+
+func TestGRPCCall(t *testing.T) {
+	srv := GRPC(t, ServerOptions{})
+
+	rsp, err := srv.Client.Call(context.Background(), &pb.CallRequest{Name: "value"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello value from Platform", rsp.Msg)
+}
+
+func TestGRPCValidation(t *testing.T) {
+	srv := GRPC(t, ServerOptions{})
+
+	_, err := srv.Client.Call(context.Background(), &pb.CallRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	typed, ok := apperrors.FromError(err)
+	require.True(t, ok, "details should survive the interceptor chain")
+	assert.Equal(t, apperrors.ReasonInvalidArgument, typed.Reason)
+	require.Len(t, typed.Violations, 1)
+	assert.Equal(t, "name", typed.Violations[0].Field)
+}
+
+func TestGRPCResponseCache(t *testing.T) {
+	store := &countingStore{}
+	srv := GRPC(t, ServerOptions{Store: store})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := srv.Client.Call(ctx, &pb.CallRequest{Name: "cached"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), store.queries.Load(), "repeated calls are served from the cache")
+
+	bypass := metadata.AppendToOutgoingContext(ctx, "x-cache-bypass", "1")
+	_, err := srv.Client.Call(bypass, &pb.CallRequest{Name: "cached"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), store.queries.Load())
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	cfg := Config(t)
+	cfg.ResponseCache.Enabled = false
+	clk := clock.NewFake(time.Unix(0, 0))
+	srv := GRPC(t, ServerOptions{Config: cfg, Clock: clk})
+	ctx := context.Background()
+
+	call := func() error {
+		_, err := srv.Client.Call(ctx, &pb.CallRequest{Name: "busy"})
+		return err
+	}
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, call())
+	}
+
+	err := call()
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	typed, ok := apperrors.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, time.Minute/100, typed.RetryAfter, "until the next call is earned back")
+
+	clk.Advance(time.Minute)
+	assert.NoError(t, call())
+}
+
+func TestGRPCMaintenance(t *testing.T) {
+	cfg := Config(t)
+	cfg.Maintenance.ReadOnly = []string{"Version"}
+	cfg.Maintenance.RetryAfter = time.Minute
+	srv := GRPC(t, ServerOptions{Config: cfg})
+	mode := srv.Deps.Maintenance
+	ctx := context.Background()
+
+	_, err := mode.Set(ctx, true, "upgrade", 0)
+	require.NoError(t, err)
+
+	_, err = srv.Client.Call(ctx, &pb.CallRequest{Name: "value"})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	typed, ok := apperrors.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, maintenance.ReasonMaintenance, typed.Reason)
+	assert.Equal(t, time.Minute, typed.RetryAfter)
+
+	_, err = srv.Client.Version(ctx, &pb.VersionRequest{})
+	assert.NoError(t, err, "read-only calls keep working")
+
+	_, err = mode.Set(ctx, false, "", 0)
+	require.NoError(t, err)
+	_, err = srv.Client.Call(ctx, &pb.CallRequest{Name: "value"})
+	assert.NoError(t, err)
+}
+
+func TestGoldenCall(t *testing.T) {
+	srv := GRPC(t, ServerOptions{})
+
+	req := &pb.CallRequest{}
+	testsupport.LoadProto(t, "call_request.json", req)
+
+	rsp, err := srv.Client.Call(context.Background(), req)
+	require.NoError(t, err)
+	testsupport.Golden(t, "call_response", rsp)
+}
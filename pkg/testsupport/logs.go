@@ -0,0 +1,58 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package testsupport
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"blueprint/config"
+	"blueprint/pkg/logger"
+)
+
+// Logs captures what a logger writes so a test can read the entries back
+type Logs struct {
+	log  *logger.Logger
+	path string
+}
+
+// Logger returns an info level logger writing JSON lines to a temp file,
+// closed when the test ends
+func Logger(t testing.TB) (*logger.Logger, *Logs) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.log")
+	log, err := logger.NewLoggerWithOptions(&config.Config{}, logger.LoggerOptions{
+		Level:      "info",
+		OutputPath: path,
+	})
+	if err != nil {
+		t.Fatalf("test logger: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+	return log, &Logs{log: log, path: path}
+}
+
+// Entries flushes the logger and decodes every entry written so far
+func (l *Logs) Entries(t testing.TB) []map[string]interface{} {
+	t.Helper()
+	l.log.Sync()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		t.Fatalf("read logs: %v", err)
+	}
+	defer f.Close()
+
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("log entry %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
@@ -0,0 +1,128 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+package testsupport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"blueprint/config"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	TEST_REDIS_ADDR = "TEST_REDIS_ADDR"
+	// TEST_REDIS_FLUSH=1 confirms the database at TEST_REDIS_ADDR may be
+	// flushed by every test
+	TEST_REDIS_FLUSH  = "TEST_REDIS_FLUSH"
+	TEST_POSTGRES_URL = "TEST_POSTGRES_URL"
+
+	postgresDB       = "platform_test"
+	postgresUser     = "test"
+	postgresPassword = "test"
+)
+
+// same images as stack.yaml
+var (
+	RedisSpec = Spec{
+		Image: "redis:6-alpine",
+		Port:  "6379",
+		Ready: func(ctx context.Context, addr string) error {
+			c := redis.NewClient(&redis.Options{Addr: addr})
+			defer c.Close()
+			return c.Ping(ctx).Err()
+		},
+	}
+
+	PostgresSpec = Spec{
+		Image: "postgres:16-alpine",
+		Port:  "5432",
+		Env: map[string]string{
+			"POSTGRES_DB":       postgresDB,
+			"POSTGRES_USER":     postgresUser,
+			"POSTGRES_PASSWORD": postgresPassword,
+		},
+		Ready: func(ctx context.Context, addr string) error {
+			conn, err := pgx.Connect(ctx, postgresURL(addr))
+			if err != nil {
+				return err
+			}
+			return conn.Close(ctx)
+		},
+	}
+)
+
+// Redis returns a client on an empty database, closed when the test ends.
+// The database is flushed, so one at TEST_REDIS_ADDR is only used with
+// TEST_REDIS_FLUSH=1 confirming it holds nothing worth keeping.
+func Redis(t testing.TB) *redis.Client {
+	t.Helper()
+
+	addr := os.Getenv(TEST_REDIS_ADDR)
+	if addr == "" {
+		addr = Run(t, RedisSpec).Addr
+	} else if os.Getenv(TEST_REDIS_FLUSH) != "1" {
+		t.Fatalf("the tests flush the redis database at %s, set %s=1 if it holds nothing worth keeping", addr, TEST_REDIS_FLUSH)
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+
+	if err := client.FlushDB(context.Background()).Err(); err != nil {
+		unavailable(t, "redis at %s: %v", addr, err)
+	}
+	return client
+}
+
+// Postgres returns the connection settings of a test database, feed them
+// to db.NewPostgresDB through config.Config.Postgres
+func Postgres(t testing.TB) config.Postgres {
+	t.Helper()
+
+	raw := os.Getenv(TEST_POSTGRES_URL)
+	if raw == "" {
+		raw = postgresURL(Run(t, PostgresSpec).Addr)
+	}
+
+	cfg, err := parsePostgresURL(raw)
+	if err != nil {
+		t.Fatalf("%s: %v", TEST_POSTGRES_URL, err)
+	}
+	return cfg
+}
+
+func postgresURL(addr string) string {
+	return fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", postgresUser, postgresPassword, addr, postgresDB)
+}
+
+func parsePostgresURL(raw string) (config.Postgres, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return config.Postgres{}, err
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return config.Postgres{}, err
+	}
+	password, _ := u.User.Password()
+
+	// the libpq TLS parameters, so TLS can be tested against a real server
+	q := u.Query()
+	return config.Postgres{
+		PostgresHost:     host,
+		PostgresPort:     port,
+		PostgresUser:     u.User.Username(),
+		PostgresPassword: password,
+		PostgresDBName:   strings.TrimPrefix(u.Path, "/"),
+		SSLMode:          q.Get("sslmode"),
+		SSLRootCert:      q.Get("sslrootcert"),
+		SSLCert:          q.Get("sslcert"),
+		SSLKey:           q.Get("sslkey"),
+	}, nil
+}
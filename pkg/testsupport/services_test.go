@@ -0,0 +1,58 @@
+package testsupport
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"blueprint/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePostgresURL(t *testing.T) {
+	cfg, err := parsePostgresURL(postgresURL("127.0.0.1:49153"))
+	require.NoError(t, err)
+	assert.Equal(t, config.Postgres{
+		PostgresHost:     "127.0.0.1",
+		PostgresPort:     "49153",
+		PostgresUser:     postgresUser,
+		PostgresPassword: postgresPassword,
+		PostgresDBName:   postgresDB,
+		SSLMode:          "disable",
+	}, cfg)
+
+	cfg, err = parsePostgresURL("postgres://u:p@db:5432/app?sslmode=verify-full&sslrootcert=/certs/ca.pem&sslcert=/certs/client.pem&sslkey=/certs/client.key")
+	require.NoError(t, err)
+	assert.Equal(t, "verify-full", cfg.SSLMode)
+	assert.Equal(t, "/certs/ca.pem", cfg.SSLRootCert)
+	assert.Equal(t, "/certs/client.pem", cfg.SSLCert)
+	assert.Equal(t, "/certs/client.key", cfg.SSLKey)
+}
+
+// fatalTB records Fatalf and stops the goroutine like testing.T does
+type fatalTB struct {
+	testing.TB
+	fatal string
+}
+
+func (f *fatalTB) Fatalf(format string, args ...interface{}) {
+	f.fatal = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func TestRedisRefusesUnconfirmedFlush(t *testing.T) {
+	t.Setenv(TEST_REDIS_ADDR, "shared.redis:6379")
+	t.Setenv(TEST_REDIS_FLUSH, "")
+
+	tb := &fatalTB{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Redis(tb)
+	}()
+	<-done
+	assert.Contains(t, tb.fatal, "shared.redis:6379")
+	assert.Contains(t, tb.fatal, "TEST_REDIS_FLUSH=1")
+}
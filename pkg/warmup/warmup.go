@@ -0,0 +1,225 @@
+// Owner: JeelRupapara (zeelrupapara@gmail.com)
+
+// Package warmup gets the service ready for traffic before it says so.
+// Right after a rollout the pools are empty and the cache is cold, the
+// first requests pay for dialing redis and postgres and for loading the
+// hottest keys. A Warmer opens the connections up front and fills the
+// keys chosen in config, the readiness probe flips once it is done:
+//
+//	w := warmup.New(warmup.Options{Redis: rdb, RedisConns: 10, DB: sqlDB, DBConns: 5, Cache: c, Keys: keys})
+//	w.Prime("config:fees", time.Hour, loadFees)
+//	result, err := w.Run(ctx)
+//
+// Warming up is best effort, a failure is reported but the connections
+// and keys that did come up stay warm.
+package warmup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"blueprint/pkg/cache"
+	"blueprint/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	warmedConns = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blueprint_warmup_connections",
+		Help: "Connections opened before the service reported ready, by pool.",
+	}, []string{"pool"})
+	warmupSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "blueprint_warmup_seconds",
+		Help: "How long the warm-up before readiness took.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(warmedConns, warmupSeconds)
+}
+
+// Fetcher is the part of cache.Cache priming needs
+type Fetcher interface {
+	Fetch(ctx context.Context, key string, dest interface{}, ttl time.Duration, load cache.Loader) error
+}
+
+type Options struct {
+	// Redis gets RedisConns connections, usually its MinIdleConns, which
+	// go-redis otherwise dials in the background after start
+	Redis      *redis.Client
+	RedisConns int
+	// DB gets DBConns connections, keep them within its max idle conns or
+	// the pool closes the extra ones right away
+	DB      *sql.DB
+	DBConns int
+	// Cache is filled with the Keys that have a primer, keys nobody
+	// registered are logged and skipped
+	Cache Fetcher
+	Keys  []string
+	Log   *logger.Logger
+}
+
+// Result is what was warmed up
+type Result struct {
+	RedisConns int
+	DBConns    int
+	Keys       int
+}
+
+// Fields returns the result as logger fields
+func (r Result) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"redis_conns": r.RedisConns,
+		"db_conns":    r.DBConns,
+		"cache_keys":  r.Keys,
+	}
+}
+
+type primer struct {
+	ttl  time.Duration
+	load cache.Loader
+}
+
+// Warmer warms up what its Options name, register primers before Run
+type Warmer struct {
+	opts Options
+
+	mu      sync.Mutex
+	primers map[string]primer
+}
+
+func New(opts Options) *Warmer {
+	return &Warmer{opts: opts, primers: map[string]primer{}}
+}
+
+// Prime registers how key is loaded, Run only loads it when it is one of
+// the configured Keys. ttl 0 uses the cache's default expiration.
+func (w *Warmer) Prime(key string, ttl time.Duration, load cache.Loader) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.primers[key] = primer{ttl: ttl, load: load}
+}
+
+// Run opens the connections and fills the keys in parallel and returns
+// once all of them are done or ctx ends. The error joins every failure.
+func (w *Warmer) Run(ctx context.Context) (Result, error) {
+	start := time.Now()
+	defer func() { warmupSeconds.Set(time.Since(start).Seconds()) }()
+
+	var (
+		wg       sync.WaitGroup
+		res      Result
+		redisErr error
+		dbErr    error
+		cacheErr error
+	)
+	if w.opts.Redis != nil && w.opts.RedisConns > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res.RedisConns, redisErr = Redis(ctx, w.opts.Redis, w.opts.RedisConns)
+			warmedConns.WithLabelValues("redis").Set(float64(res.RedisConns))
+		}()
+	}
+	if w.opts.DB != nil && w.opts.DBConns > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res.DBConns, dbErr = DB(ctx, w.opts.DB, w.opts.DBConns)
+			warmedConns.WithLabelValues("postgres").Set(float64(res.DBConns))
+		}()
+	}
+	if w.opts.Cache != nil && len(w.opts.Keys) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res.Keys, cacheErr = w.prime(ctx)
+		}()
+	}
+	wg.Wait()
+
+	return res, errors.Join(redisErr, dbErr, cacheErr)
+}
+
+// prime loads the configured keys one after the other, they share the
+// pools warmed up next to them
+func (w *Warmer) prime(ctx context.Context) (int, error) {
+	w.mu.Lock()
+	primers := make(map[string]primer, len(w.primers))
+	for key, p := range w.primers {
+		primers[key] = p
+	}
+	w.mu.Unlock()
+
+	var errs []error
+	primed := 0
+	for _, key := range w.opts.Keys {
+		p, ok := primers[key]
+		if !ok {
+			if w.opts.Log != nil {
+				w.opts.Log.Warnw("No primer registered for cache key", "key", key)
+			}
+			continue
+		}
+		// a hit leaves the key as it is, only a miss calls the loader
+		var raw json.RawMessage
+		if err := w.opts.Cache.Fetch(ctx, key, &raw, p.ttl, p.load); err != nil {
+			errs = append(errs, fmt.Errorf("priming %s: %w", key, err))
+			continue
+		}
+		primed++
+	}
+	return primed, errors.Join(errs...)
+}
+
+// Redis opens n connections of client's pool and returns how many it got.
+// They are held until all are open, so each is a connection of its own,
+// then handed back to the pool as idle ones.
+func Redis(ctx context.Context, client *redis.Client, n int) (int, error) {
+	conns := make([]*redis.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for len(conns) < n {
+		conn := client.Conn()
+		if err := conn.Ping(ctx).Err(); err != nil {
+			conn.Close()
+			return len(conns), fmt.Errorf("warming redis connection %d: %w", len(conns)+1, err)
+		}
+		conns = append(conns, conn)
+	}
+	return len(conns), nil
+}
+
+// DB opens n connections of db's pool like Redis does
+func DB(ctx context.Context, db *sql.DB, n int) (int, error) {
+	conns := make([]*sql.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for len(conns) < n {
+		conn, err := db.Conn(ctx)
+		if err == nil {
+			err = conn.PingContext(ctx)
+			if err != nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			return len(conns), fmt.Errorf("warming database connection %d: %w", len(conns)+1, err)
+		}
+		conns = append(conns, conn)
+	}
+	return len(conns), nil
+}
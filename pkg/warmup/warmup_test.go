@@ -0,0 +1,99 @@
+package warmup
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blueprint/pkg/cache"
+	"blueprint/pkg/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDriver opens connections that only answer pings
+type countingDriver struct{ opened atomic.Int32 }
+
+func (d *countingDriver) Open(string) (driver.Conn, error) {
+	d.opened.Add(1)
+	return countingConn{}, nil
+}
+
+type countingConn struct{}
+
+func (countingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (countingConn) Close() error                        { return nil }
+func (countingConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+func (countingConn) Ping(context.Context) error          { return nil }
+
+var drv = &countingDriver{}
+
+func init() {
+	sql.Register("warmup-counting", drv)
+}
+
+// fetcher is a cache that misses every key once
+type fetcher struct{ stored map[string]interface{} }
+
+func (f *fetcher) Fetch(ctx context.Context, key string, dest interface{}, ttl time.Duration, load cache.Loader) error {
+	if _, ok := f.stored[key]; ok {
+		return nil
+	}
+	v, err := load(ctx)
+	if err != nil {
+		return err
+	}
+	f.stored[key] = v
+	data, _ := json.Marshal(v)
+	return json.Unmarshal(data, dest)
+}
+
+func TestDB(t *testing.T) {
+	db, err := sql.Open("warmup-counting", "")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxIdleConns(4)
+	before := drv.opened.Load()
+
+	n, err := DB(context.Background(), db, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, int32(3), drv.opened.Load()-before, "one connection each")
+	assert.Equal(t, 3, db.Stats().Idle, "handed back to the pool")
+}
+
+func TestPrime(t *testing.T) {
+	f := &fetcher{stored: map[string]interface{}{}}
+	w := New(Options{Cache: f, Keys: []string{"config:fees", "config:unknown", "config:symbols", "config:broken"}})
+	loads := 0
+	w.Prime("config:fees", time.Hour, func(ctx context.Context) (interface{}, error) {
+		loads++
+		return map[string]float64{"taker": 0.001}, nil
+	})
+	w.Prime("config:symbols", 0, func(ctx context.Context) (interface{}, error) { return []string{"BTCUSD"}, nil })
+	w.Prime("config:broken", 0, func(ctx context.Context) (interface{}, error) { return nil, errors.New("no database") })
+	w.Prime("config:unused", 0, func(ctx context.Context) (interface{}, error) { t.Fatal("not configured"); return nil, nil })
+
+	res, err := w.Run(context.Background())
+	assert.ErrorContains(t, err, "priming config:broken")
+	assert.Equal(t, Result{Keys: 2}, res)
+	assert.Contains(t, f.stored, "config:symbols")
+
+	res, _ = w.Run(context.Background())
+	assert.Equal(t, 2, res.Keys)
+	assert.Equal(t, 1, loads, "a warm key is not loaded again")
+}
+
+func TestRedis(t *testing.T) {
+	client := testsupport.Redis(t)
+	n, err := Redis(context.Background(), client, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.GreaterOrEqual(t, client.PoolStats().IdleConns, uint32(5))
+}
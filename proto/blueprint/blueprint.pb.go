@@ -112,6 +112,605 @@ func (x *CallResponse) GetMsg() string {
 	return ""
 }
 
+type VersionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VersionRequest) Reset() {
+	*x = VersionRequest{}
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VersionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VersionRequest) ProtoMessage() {}
+
+func (x *VersionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VersionRequest.ProtoReflect.Descriptor instead.
+func (*VersionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_blueprint_blueprint_proto_rawDescGZIP(), []int{2}
+}
+
+type VersionResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Service string                 `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+	Version string                 `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	Commit  string                 `protobuf:"bytes,3,opt,name=commit,proto3" json:"commit,omitempty"`
+	// RFC 3339
+	BuildTime string `protobuf:"bytes,4,opt,name=build_time,json=buildTime,proto3" json:"build_time,omitempty"`
+	GoVersion string `protobuf:"bytes,5,opt,name=go_version,json=goVersion,proto3" json:"go_version,omitempty"`
+	// the tree had uncommitted changes
+	Modified      bool `protobuf:"varint,6,opt,name=modified,proto3" json:"modified,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VersionResponse) Reset() {
+	*x = VersionResponse{}
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VersionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VersionResponse) ProtoMessage() {}
+
+func (x *VersionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VersionResponse.ProtoReflect.Descriptor instead.
+func (*VersionResponse) Descriptor() ([]byte, []int) {
+	return file_proto_blueprint_blueprint_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *VersionResponse) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *VersionResponse) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *VersionResponse) GetCommit() string {
+	if x != nil {
+		return x.Commit
+	}
+	return ""
+}
+
+func (x *VersionResponse) GetBuildTime() string {
+	if x != nil {
+		return x.BuildTime
+	}
+	return ""
+}
+
+func (x *VersionResponse) GetGoVersion() string {
+	if x != nil {
+		return x.GoVersion
+	}
+	return ""
+}
+
+func (x *VersionResponse) GetModified() bool {
+	if x != nil {
+		return x.Modified
+	}
+	return false
+}
+
+// AccountFields are what callers set, validation errors name them by these
+// field names in the caller's locale
+type AccountFields struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// required
+	NameEn string `protobuf:"bytes,1,opt,name=name_en,json=nameEn,proto3" json:"name_en,omitempty"`
+	// Arabic script, optional
+	NameAr  string `protobuf:"bytes,2,opt,name=name_ar,json=nameAr,proto3" json:"name_ar,omitempty"`
+	Contact string `protobuf:"bytes,3,opt,name=contact,proto3" json:"contact,omitempty"`
+	Address string `protobuf:"bytes,4,opt,name=address,proto3" json:"address,omitempty"`
+	Tel     string `protobuf:"bytes,5,opt,name=tel,proto3" json:"tel,omitempty"`
+	Mobile  string `protobuf:"bytes,6,opt,name=mobile,proto3" json:"mobile,omitempty"`
+	// unique, compared lower case
+	Email string `protobuf:"bytes,7,opt,name=email,proto3" json:"email,omitempty"`
+	// http or https
+	Web           string `protobuf:"bytes,8,opt,name=web,proto3" json:"web,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AccountFields) Reset() {
+	*x = AccountFields{}
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccountFields) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccountFields) ProtoMessage() {}
+
+func (x *AccountFields) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccountFields.ProtoReflect.Descriptor instead.
+func (*AccountFields) Descriptor() ([]byte, []int) {
+	return file_proto_blueprint_blueprint_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AccountFields) GetNameEn() string {
+	if x != nil {
+		return x.NameEn
+	}
+	return ""
+}
+
+func (x *AccountFields) GetNameAr() string {
+	if x != nil {
+		return x.NameAr
+	}
+	return ""
+}
+
+func (x *AccountFields) GetContact() string {
+	if x != nil {
+		return x.Contact
+	}
+	return ""
+}
+
+func (x *AccountFields) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *AccountFields) GetTel() string {
+	if x != nil {
+		return x.Tel
+	}
+	return ""
+}
+
+func (x *AccountFields) GetMobile() string {
+	if x != nil {
+		return x.Mobile
+	}
+	return ""
+}
+
+func (x *AccountFields) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *AccountFields) GetWeb() string {
+	if x != nil {
+		return x.Web
+	}
+	return ""
+}
+
+type Account struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	AccountId int64                  `protobuf:"varint,1,opt,name=account_id,json=accountId,proto3" json:"account_id,omitempty"`
+	NameEn    string                 `protobuf:"bytes,2,opt,name=name_en,json=nameEn,proto3" json:"name_en,omitempty"`
+	NameAr    string                 `protobuf:"bytes,3,opt,name=name_ar,json=nameAr,proto3" json:"name_ar,omitempty"`
+	// the name in the caller's accept-language, name_ar for ar locales when set
+	Name    string `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
+	Contact string `protobuf:"bytes,5,opt,name=contact,proto3" json:"contact,omitempty"`
+	Address string `protobuf:"bytes,6,opt,name=address,proto3" json:"address,omitempty"`
+	Tel     string `protobuf:"bytes,7,opt,name=tel,proto3" json:"tel,omitempty"`
+	Mobile  string `protobuf:"bytes,8,opt,name=mobile,proto3" json:"mobile,omitempty"`
+	Email   string `protobuf:"bytes,9,opt,name=email,proto3" json:"email,omitempty"`
+	Web     string `protobuf:"bytes,10,opt,name=web,proto3" json:"web,omitempty"`
+	// unix milliseconds
+	CreateAt int64 `protobuf:"varint,11,opt,name=create_at,json=createAt,proto3" json:"create_at,omitempty"`
+	UpdateAt int64 `protobuf:"varint,12,opt,name=update_at,json=updateAt,proto3" json:"update_at,omitempty"`
+	// pass it back to UpdateAccount
+	Version       int32 `protobuf:"varint,13,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Account) Reset() {
+	*x = Account{}
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Account) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Account) ProtoMessage() {}
+
+func (x *Account) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Account.ProtoReflect.Descriptor instead.
+func (*Account) Descriptor() ([]byte, []int) {
+	return file_proto_blueprint_blueprint_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Account) GetAccountId() int64 {
+	if x != nil {
+		return x.AccountId
+	}
+	return 0
+}
+
+func (x *Account) GetNameEn() string {
+	if x != nil {
+		return x.NameEn
+	}
+	return ""
+}
+
+func (x *Account) GetNameAr() string {
+	if x != nil {
+		return x.NameAr
+	}
+	return ""
+}
+
+func (x *Account) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Account) GetContact() string {
+	if x != nil {
+		return x.Contact
+	}
+	return ""
+}
+
+func (x *Account) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *Account) GetTel() string {
+	if x != nil {
+		return x.Tel
+	}
+	return ""
+}
+
+func (x *Account) GetMobile() string {
+	if x != nil {
+		return x.Mobile
+	}
+	return ""
+}
+
+func (x *Account) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *Account) GetWeb() string {
+	if x != nil {
+		return x.Web
+	}
+	return ""
+}
+
+func (x *Account) GetCreateAt() int64 {
+	if x != nil {
+		return x.CreateAt
+	}
+	return 0
+}
+
+func (x *Account) GetUpdateAt() int64 {
+	if x != nil {
+		return x.UpdateAt
+	}
+	return 0
+}
+
+func (x *Account) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type CreateAccountRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Fields        *AccountFields         `protobuf:"bytes,1,opt,name=fields,proto3" json:"fields,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateAccountRequest) Reset() {
+	*x = CreateAccountRequest{}
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateAccountRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateAccountRequest) ProtoMessage() {}
+
+func (x *CreateAccountRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateAccountRequest.ProtoReflect.Descriptor instead.
+func (*CreateAccountRequest) Descriptor() ([]byte, []int) {
+	return file_proto_blueprint_blueprint_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CreateAccountRequest) GetFields() *AccountFields {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type GetAccountRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     int64                  `protobuf:"varint,1,opt,name=account_id,json=accountId,proto3" json:"account_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAccountRequest) Reset() {
+	*x = GetAccountRequest{}
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAccountRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAccountRequest) ProtoMessage() {}
+
+func (x *GetAccountRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAccountRequest.ProtoReflect.Descriptor instead.
+func (*GetAccountRequest) Descriptor() ([]byte, []int) {
+	return file_proto_blueprint_blueprint_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetAccountRequest) GetAccountId() int64 {
+	if x != nil {
+		return x.AccountId
+	}
+	return 0
+}
+
+type UpdateAccountRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     int64                  `protobuf:"varint,1,opt,name=account_id,json=accountId,proto3" json:"account_id,omitempty"`
+	Version       int32                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	Fields        *AccountFields         `protobuf:"bytes,3,opt,name=fields,proto3" json:"fields,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateAccountRequest) Reset() {
+	*x = UpdateAccountRequest{}
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateAccountRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateAccountRequest) ProtoMessage() {}
+
+func (x *UpdateAccountRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateAccountRequest.ProtoReflect.Descriptor instead.
+func (*UpdateAccountRequest) Descriptor() ([]byte, []int) {
+	return file_proto_blueprint_blueprint_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *UpdateAccountRequest) GetAccountId() int64 {
+	if x != nil {
+		return x.AccountId
+	}
+	return 0
+}
+
+func (x *UpdateAccountRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *UpdateAccountRequest) GetFields() *AccountFields {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type DeleteAccountRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     int64                  `protobuf:"varint,1,opt,name=account_id,json=accountId,proto3" json:"account_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteAccountRequest) Reset() {
+	*x = DeleteAccountRequest{}
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteAccountRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteAccountRequest) ProtoMessage() {}
+
+func (x *DeleteAccountRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteAccountRequest.ProtoReflect.Descriptor instead.
+func (*DeleteAccountRequest) Descriptor() ([]byte, []int) {
+	return file_proto_blueprint_blueprint_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DeleteAccountRequest) GetAccountId() int64 {
+	if x != nil {
+		return x.AccountId
+	}
+	return 0
+}
+
+type DeleteAccountResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteAccountResponse) Reset() {
+	*x = DeleteAccountResponse{}
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteAccountResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteAccountResponse) ProtoMessage() {}
+
+func (x *DeleteAccountResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_blueprint_blueprint_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteAccountResponse.ProtoReflect.Descriptor instead.
+func (*DeleteAccountResponse) Descriptor() ([]byte, []int) {
+	return file_proto_blueprint_blueprint_proto_rawDescGZIP(), []int{10}
+}
+
 var File_proto_blueprint_blueprint_proto protoreflect.FileDescriptor
 
 const file_proto_blueprint_blueprint_proto_rawDesc = "" +
@@ -120,9 +719,64 @@ const file_proto_blueprint_blueprint_proto_rawDesc = "" +
 	"\vCallRequest\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\" \n" +
 	"\fCallResponse\x12\x10\n" +
-	"\x03msg\x18\x01 \x01(\tR\x03msg2F\n" +
+	"\x03msg\x18\x01 \x01(\tR\x03msg\"\x10\n" +
+	"\x0eVersionRequest\"\xb7\x01\n" +
+	"\x0fVersionResponse\x12\x18\n" +
+	"\aservice\x18\x01 \x01(\tR\aservice\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\tR\aversion\x12\x16\n" +
+	"\x06commit\x18\x03 \x01(\tR\x06commit\x12\x1d\n" +
+	"\n" +
+	"build_time\x18\x04 \x01(\tR\tbuildTime\x12\x1d\n" +
+	"\n" +
+	"go_version\x18\x05 \x01(\tR\tgoVersion\x12\x1a\n" +
+	"\bmodified\x18\x06 \x01(\bR\bmodified\"\xc7\x01\n" +
+	"\rAccountFields\x12\x17\n" +
+	"\aname_en\x18\x01 \x01(\tR\x06nameEn\x12\x17\n" +
+	"\aname_ar\x18\x02 \x01(\tR\x06nameAr\x12\x18\n" +
+	"\acontact\x18\x03 \x01(\tR\acontact\x12\x18\n" +
+	"\aaddress\x18\x04 \x01(\tR\aaddress\x12\x10\n" +
+	"\x03tel\x18\x05 \x01(\tR\x03tel\x12\x16\n" +
+	"\x06mobile\x18\x06 \x01(\tR\x06mobile\x12\x14\n" +
+	"\x05email\x18\a \x01(\tR\x05email\x12\x10\n" +
+	"\x03web\x18\b \x01(\tR\x03web\"\xc8\x02\n" +
+	"\aAccount\x12\x1d\n" +
+	"\n" +
+	"account_id\x18\x01 \x01(\x03R\taccountId\x12\x17\n" +
+	"\aname_en\x18\x02 \x01(\tR\x06nameEn\x12\x17\n" +
+	"\aname_ar\x18\x03 \x01(\tR\x06nameAr\x12\x12\n" +
+	"\x04name\x18\x04 \x01(\tR\x04name\x12\x18\n" +
+	"\acontact\x18\x05 \x01(\tR\acontact\x12\x18\n" +
+	"\aaddress\x18\x06 \x01(\tR\aaddress\x12\x10\n" +
+	"\x03tel\x18\a \x01(\tR\x03tel\x12\x16\n" +
+	"\x06mobile\x18\b \x01(\tR\x06mobile\x12\x14\n" +
+	"\x05email\x18\t \x01(\tR\x05email\x12\x10\n" +
+	"\x03web\x18\n" +
+	" \x01(\tR\x03web\x12\x1b\n" +
+	"\tcreate_at\x18\v \x01(\x03R\bcreateAt\x12\x1b\n" +
+	"\tupdate_at\x18\f \x01(\x03R\bupdateAt\x12\x18\n" +
+	"\aversion\x18\r \x01(\x05R\aversion\"H\n" +
+	"\x14CreateAccountRequest\x120\n" +
+	"\x06fields\x18\x01 \x01(\v2\x18.blueprint.AccountFieldsR\x06fields\"2\n" +
+	"\x11GetAccountRequest\x12\x1d\n" +
+	"\n" +
+	"account_id\x18\x01 \x01(\x03R\taccountId\"\x81\x01\n" +
+	"\x14UpdateAccountRequest\x12\x1d\n" +
+	"\n" +
+	"account_id\x18\x01 \x01(\x03R\taccountId\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x05R\aversion\x120\n" +
+	"\x06fields\x18\x03 \x01(\v2\x18.blueprint.AccountFieldsR\x06fields\"5\n" +
+	"\x14DeleteAccountRequest\x12\x1d\n" +
+	"\n" +
+	"account_id\x18\x01 \x01(\x03R\taccountId\"\x17\n" +
+	"\x15DeleteAccountResponse2\xb2\x03\n" +
 	"\tBlueprint\x129\n" +
-	"\x04Call\x12\x16.blueprint.CallRequest\x1a\x17.blueprint.CallResponse\"\x00B\fZ\n" +
+	"\x04Call\x12\x16.blueprint.CallRequest\x1a\x17.blueprint.CallResponse\"\x00\x12B\n" +
+	"\aVersion\x12\x19.blueprint.VersionRequest\x1a\x1a.blueprint.VersionResponse\"\x00\x12F\n" +
+	"\rCreateAccount\x12\x1f.blueprint.CreateAccountRequest\x1a\x12.blueprint.Account\"\x00\x12@\n" +
+	"\n" +
+	"GetAccount\x12\x1c.blueprint.GetAccountRequest\x1a\x12.blueprint.Account\"\x00\x12F\n" +
+	"\rUpdateAccount\x12\x1f.blueprint.UpdateAccountRequest\x1a\x12.blueprint.Account\"\x00\x12T\n" +
+	"\rDeleteAccount\x12\x1f.blueprint.DeleteAccountRequest\x1a .blueprint.DeleteAccountResponse\"\x00B\fZ\n" +
 	"/blueprintb\x06proto3"
 
 var (
@@ -137,19 +791,40 @@ func file_proto_blueprint_blueprint_proto_rawDescGZIP() []byte {
 	return file_proto_blueprint_blueprint_proto_rawDescData
 }
 
-var file_proto_blueprint_blueprint_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_blueprint_blueprint_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_proto_blueprint_blueprint_proto_goTypes = []any{
-	(*CallRequest)(nil),  // 0: blueprint.CallRequest
-	(*CallResponse)(nil), // 1: blueprint.CallResponse
+	(*CallRequest)(nil),           // 0: blueprint.CallRequest
+	(*CallResponse)(nil),          // 1: blueprint.CallResponse
+	(*VersionRequest)(nil),        // 2: blueprint.VersionRequest
+	(*VersionResponse)(nil),       // 3: blueprint.VersionResponse
+	(*AccountFields)(nil),         // 4: blueprint.AccountFields
+	(*Account)(nil),               // 5: blueprint.Account
+	(*CreateAccountRequest)(nil),  // 6: blueprint.CreateAccountRequest
+	(*GetAccountRequest)(nil),     // 7: blueprint.GetAccountRequest
+	(*UpdateAccountRequest)(nil),  // 8: blueprint.UpdateAccountRequest
+	(*DeleteAccountRequest)(nil),  // 9: blueprint.DeleteAccountRequest
+	(*DeleteAccountResponse)(nil), // 10: blueprint.DeleteAccountResponse
 }
 var file_proto_blueprint_blueprint_proto_depIdxs = []int32{
-	0, // 0: blueprint.Blueprint.Call:input_type -> blueprint.CallRequest
-	1, // 1: blueprint.Blueprint.Call:output_type -> blueprint.CallResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	4,  // 0: blueprint.CreateAccountRequest.fields:type_name -> blueprint.AccountFields
+	4,  // 1: blueprint.UpdateAccountRequest.fields:type_name -> blueprint.AccountFields
+	0,  // 2: blueprint.Blueprint.Call:input_type -> blueprint.CallRequest
+	2,  // 3: blueprint.Blueprint.Version:input_type -> blueprint.VersionRequest
+	6,  // 4: blueprint.Blueprint.CreateAccount:input_type -> blueprint.CreateAccountRequest
+	7,  // 5: blueprint.Blueprint.GetAccount:input_type -> blueprint.GetAccountRequest
+	8,  // 6: blueprint.Blueprint.UpdateAccount:input_type -> blueprint.UpdateAccountRequest
+	9,  // 7: blueprint.Blueprint.DeleteAccount:input_type -> blueprint.DeleteAccountRequest
+	1,  // 8: blueprint.Blueprint.Call:output_type -> blueprint.CallResponse
+	3,  // 9: blueprint.Blueprint.Version:output_type -> blueprint.VersionResponse
+	5,  // 10: blueprint.Blueprint.CreateAccount:output_type -> blueprint.Account
+	5,  // 11: blueprint.Blueprint.GetAccount:output_type -> blueprint.Account
+	5,  // 12: blueprint.Blueprint.UpdateAccount:output_type -> blueprint.Account
+	10, // 13: blueprint.Blueprint.DeleteAccount:output_type -> blueprint.DeleteAccountResponse
+	8,  // [8:14] is the sub-list for method output_type
+	2,  // [2:8] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_proto_blueprint_blueprint_proto_init() }
@@ -163,7 +838,7 @@ func file_proto_blueprint_blueprint_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_blueprint_blueprint_proto_rawDesc), len(file_proto_blueprint_blueprint_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   1,
 		},